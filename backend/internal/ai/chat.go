@@ -2,10 +2,13 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
+	"unicode/utf8"
 
-	"github.com/google/generative-ai-go/genai"
 	"gorm.io/gorm"
 )
 
@@ -13,6 +16,8 @@ import (
 type ChatRequest struct {
 	Message string        `json:"message"`
 	History []ChatMessage `json:"history"`
+	// Summary of messages older than History, from a stored conversation
+	Summary string `json:"-"`
 }
 
 type ChatMessage struct {
@@ -22,23 +27,75 @@ type ChatMessage struct {
 
 // ChatResponse represents the AI's answer
 type ChatResponse struct {
-	Response string `json:"response"`
+	Response  string     `json:"response"`
+	Citations []Citation `json:"citations"`
 }
 
+// Citation is a record the answer is based on
+type Citation struct {
+	ID    string `json:"id"` // e.g. finding:42
+	Kind  string `json:"kind"`
+	Title string `json:"title,omitempty"`
+}
+
+const (
+	// Retrieved records added to the prompt
+	retrievalK = 8
+	// Tool calls the model may make before it has to answer
+	maxToolRounds = 5
+	// Longer tool results are cut, so one call cannot fill the context
+	maxToolResult = 16 << 10
+	// Estimated tokens of history sent with a query; older messages are
+	// dropped
+	historyTokens = 6000
+)
+
+// Record IDs cited in answers, e.g. [finding:42]
+var citationPattern = regexp.MustCompile(`\b[a-z_]+:[A-Za-z0-9._:/-]*[A-Za-z0-9]`)
+
 // ChatEngine handles the conversational logic
 type ChatEngine struct {
-	model *genai.GenerativeModel
-	db    *gorm.DB
+	llm       *Client
+	db        *gorm.DB
+	retriever Retriever
+	tools     map[string]Tool
+	specs     []ToolSpec
 }
 
-func NewChatEngine(client *genai.Client, db *gorm.DB) *ChatEngine {
-	model := client.GenerativeModel("gemini-1.5-flash")
+// NewChatEngine uses llm's chat route; without a provider ProcessQuery
+// returns ErrNotConfigured
+func NewChatEngine(llm *Client, db *gorm.DB) *ChatEngine {
+	if llm == nil {
+		llm = NewClient()
+	}
 	return &ChatEngine{
-		model: model,
+		llm:   llm,
 		db:    db,
+		tools: make(map[string]Tool),
 	}
 }
 
+// SetRetriever adds the records most relevant to each query to the prompt.
+// Without one, the latest Critical and High findings are used.
+func (e *ChatEngine) SetRetriever(r Retriever) {
+	e.retriever = r
+}
+
+// SetTools lets the model run read-only queries while answering
+func (e *ChatEngine) SetTools(tools []Tool) {
+	e.tools = make(map[string]Tool, len(tools))
+	e.specs = nil
+	for _, t := range tools {
+		e.tools[t.Spec.Name] = t
+		e.specs = append(e.specs, t.Spec)
+	}
+}
+
+// Available reports whether the engine can answer queries
+func (e *ChatEngine) Available() bool {
+	return e.llm.Available(FeatureChat)
+}
+
 // Local struct to avoid import cycle with scanner package
 type VulnContext struct {
 	Title       string
@@ -51,74 +108,190 @@ func (VulnContext) TableName() string {
 	return "vulns"
 }
 
-func (e *ChatEngine) ProcessQuery(ctx context.Context, req ChatRequest) (string, error) {
-	// 1. Gather Context from DB (RAG-lite)
-	var recentVulns []VulnContext
-	// We use the local struct which maps to the 'vulns' table
-	e.db.Where("severity IN ?", []string{"Critical", "High"}).Order("id desc").Limit(5).Find(&recentVulns)
+func (e *ChatEngine) ProcessQuery(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return e.Answer(ctx, req, nil)
+}
+
+// Answer is like ProcessQuery, but passes the answer to onDelta as it is
+// generated
+func (e *ChatEngine) Answer(ctx context.Context, req ChatRequest, onDelta func(string)) (*ChatResponse, error) {
+	if !e.Available() {
+		return nil, ErrNotConfigured
+	}
 
+	// 1. Gather Context
+	sources := make(map[string]Citation)
 	contextStr := "Current System Context:\n"
-	if len(recentVulns) > 0 {
-		contextStr += "Recent High Severity Vulnerabilities:\n"
-		for _, v := range recentVulns {
-			contextStr += fmt.Sprintf("- [%s] %s: %s\n", v.Severity, v.Title, v.Description)
+	if e.retriever != nil {
+		hits := e.retriever.Search(req.Message, retrievalK)
+		if len(hits) > 0 {
+			contextStr += "Records relevant to the question:\n"
+			for _, h := range hits {
+				contextStr += fmt.Sprintf("- [%s] %s: %s\n", h.ID, h.Title, truncate(h.Text, 300))
+				sources[h.ID] = Citation{ID: h.ID, Kind: h.Kind, Title: h.Title}
+			}
+		} else {
+			contextStr += "No indexed records match the question.\n"
 		}
 	} else {
-		contextStr += "No recent critical vulnerabilities found.\n"
+		var recentVulns []VulnContext
+		// We use the local struct which maps to the 'vulns' table
+		e.db.Where("severity IN ?", []string{"Critical", "High"}).Order("id desc").Limit(5).Find(&recentVulns)
+		if len(recentVulns) > 0 {
+			contextStr += "Recent High Severity Vulnerabilities:\n"
+			for _, v := range recentVulns {
+				contextStr += fmt.Sprintf("- [%s] %s: %s\n", v.Severity, v.Title, v.Description)
+			}
+		} else {
+			contextStr += "No recent critical vulnerabilities found.\n"
+		}
 	}
 
-	// 2. Construct Chat Session
-	cs := e.model.StartChat()
-
-	// Set History
-	var history []*genai.Content
-
-	// System Prompt as first history item
-	systemPrompt := `You are CyberShield AI, an elite security operations assistant. 
+	systemPrompt := `You are CyberShield AI, an elite security operations assistant.
 Your goal is to help security analysts identify threats, understand vulnerabilities, and suggest remediations.
 Use the provided system context to answer questions about the current security posture.
 If the user asks about something not in the context, answer based on your general cybersecurity knowledge.
 Be concise, professional, and actionable.`
+	if len(e.specs) > 0 {
+		systemPrompt += `
+Use the tools to look up records that are not in the context, e.g. logs or blocked IPs in a time range.
+Cite every record you rely on by its ID in square brackets, e.g. [finding:42].`
+	}
+	// To the hour, so the same question asked again shares a cache entry
+	systemPrompt += "\nThe current time, to the hour, is " + time.Now().UTC().Truncate(time.Hour).Format(time.RFC3339) + "."
+	if req.Summary != "" {
+		systemPrompt += "\n\nSummary of the earlier conversation:\n" + req.Summary
+	}
 
-	// Add system prompt + context as the first "turned" message
-	history = append(history, &genai.Content{
-		Parts: []genai.Part{genai.Text(systemPrompt + "\n\n" + contextStr)},
-		Role:  "user",
-	})
-	history = append(history, &genai.Content{
-		Parts: []genai.Part{genai.Text("Understood. I am ready to assist.")},
-		Role:  "model",
-	})
-
-	for _, msg := range req.History {
-		role := "user"
+	// 2. Replay the conversation
+	history := TrimHistory(req.History, historyTokens)
+	messages := make([]Message, 0, len(history)+1)
+	for _, msg := range history {
+		role := RoleUser
 		if msg.Role == "model" || msg.Role == "assistant" {
-			role = "model"
+			role = RoleAssistant
+		}
+		messages = append(messages, Message{Role: role, Content: msg.Content})
+	}
+	messages = append(messages, Message{Role: RoleUser, Content: req.Message})
+
+	// 3. Generate Response, running the tools the model asks for. Text sent
+	// alongside tool calls is part of the answer, as it has been streamed.
+	var used []string
+	var answer strings.Builder
+	for round := 0; ; round++ {
+		r := Request{System: systemPrompt + "\n\n" + contextStr, Messages: messages}
+		if round < maxToolRounds {
+			r.Tools = e.specs
 		}
-		history = append(history, &genai.Content{
-			Parts: []genai.Part{genai.Text(msg.Content)},
-			Role:  role,
-		})
+		resp, err := e.llm.Stream(ctx, FeatureChat, r, onDelta)
+		if err != nil {
+			return nil, err
+		}
+		answer.WriteString(resp.Text)
+		if len(resp.ToolCalls) == 0 || round == maxToolRounds {
+			if strings.TrimSpace(resp.Text) == "" {
+				return nil, fmt.Errorf("no answer after %d tool calls", round)
+			}
+			text := answer.String()
+			return &ChatResponse{Response: text, Citations: citations(text, sources, used)}, nil
+		}
+		if strings.TrimSpace(resp.Text) != "" {
+			answer.WriteString("\n\n")
+			if onDelta != nil {
+				onDelta("\n\n")
+			}
+		}
+
+		messages = append(messages, Message{Role: RoleAssistant, Content: resp.Text, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			content, cited := e.runTool(ctx, call)
+			messages = append(messages, Message{Role: RoleTool, Content: content, ToolCallID: call.ID, ToolName: call.Name})
+			for _, id := range cited {
+				if _, ok := sources[id]; !ok {
+					sources[id] = Citation{ID: id, Kind: kindOf(id)}
+					used = append(used, id)
+				}
+			}
+		}
+	}
+}
+
+// TrimHistory keeps the newest messages whose estimated size fits in
+// tokens
+func TrimHistory(history []ChatMessage, tokens int) []ChatMessage {
+	start := len(history)
+	for start > 0 {
+		n := EstimateTokens(history[start-1].Content)
+		if n > tokens {
+			break
+		}
+		tokens -= n
+		start--
 	}
+	return history[start:]
+}
 
-	cs.History = history
+// EstimateTokens approximates the tokens of text at four bytes each, as
+// for English prose
+func EstimateTokens(text string) int {
+	return len(text)/4 + 1
+}
 
-	// 3. Generate Response
-	resp, err := cs.SendMessage(ctx, genai.Text(req.Message))
+// runTool returns the result as JSON; errors are returned to the model so
+// it can correct its arguments
+func (e *ChatEngine) runTool(ctx context.Context, call ToolCall) (string, []string) {
+	tool, ok := e.tools[call.Name]
+	if !ok {
+		return toolError(fmt.Errorf("unknown tool %q", call.Name)), nil
+	}
+	result, err := tool.Run(ctx, Args(call.Arguments))
 	if err != nil {
-		return "", fmt.Errorf("gemini error: %v", err)
+		return toolError(err), nil
 	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("empty response from AI")
+	data, err := json.Marshal(result)
+	if err != nil {
+		return toolError(err), nil
 	}
+	return truncate(string(data), maxToolResult), result.Citations
+}
 
-	var sb strings.Builder
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if txt, ok := part.(genai.Text); ok {
-			sb.WriteString(string(txt))
+func toolError(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
+
+// citations lists the known records cited in text, then the other records
+// returned by tools
+func citations(text string, sources map[string]Citation, used []string) []Citation {
+	out := []Citation{}
+	seen := make(map[string]bool)
+	for _, id := range citationPattern.FindAllString(text, -1) {
+		if c, ok := sources[id]; ok && !seen[id] {
+			seen[id] = true
+			out = append(out, c)
+		}
+	}
+	for _, id := range used {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, sources[id])
 		}
 	}
+	return out
+}
+
+func kindOf(id string) string {
+	kind, _, _ := strings.Cut(id, ":")
+	return kind
+}
 
-	return sb.String(), nil
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
 }
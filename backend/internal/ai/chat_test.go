@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestChatEngine_ProcessQuery(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	type vuln struct {
+		ID uint
+		VulnContext
+	}
+	require.NoError(t, db.Table("vulns").AutoMigrate(&vuln{}))
+	require.NoError(t, db.Table("vulns").Create(&vuln{VulnContext: VulnContext{Title: "Log4Shell", Severity: "Critical"}}).Error)
+
+	llm := NewClient()
+	mock := NewMock()
+	llm.AddProvider(mock, "m")
+	engine := NewChatEngine(llm, db)
+	require.True(t, engine.Available())
+
+	first, err := engine.ProcessQuery(context.Background(), ChatRequest{
+		Message: "What should I patch first?",
+		History: []ChatMessage{{Role: "user", Content: "hi"}, {Role: "model", Content: "hello"}},
+	})
+	require.NoError(t, err)
+	second, _ := engine.ProcessQuery(context.Background(), ChatRequest{
+		Message: "What should I patch first?",
+		History: []ChatMessage{{Role: "user", Content: "hi"}, {Role: "model", Content: "hello"}},
+	})
+	assert.Equal(t, first, second, "the mock is deterministic")
+
+	req := mock.Requests()[0]
+	assert.Contains(t, req.System, "Log4Shell")
+	assert.Equal(t, []Message{
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, Content: "hello"},
+		{Role: RoleUser, Content: "What should I patch first?"},
+	}, req.Messages)
+}
+
+func TestChatEngine_Tools(t *testing.T) {
+	index := NewIndex()
+	index.Replace("finding", []Document{
+		{ID: "finding:7", Title: "High DAST finding: SQL Injection", Text: "Target api.example.com, login form"},
+		{ID: "finding:8", Title: "Low DAST finding: Missing header", Text: "Target www.example.com"},
+	})
+
+	llm := NewClient()
+	mock := NewMock().
+		CallTool("blocked", "list_blocked_ips", map[string]any{"since": "12h"}).
+		Reply("blocked_ip:3", "203.0.113.9 was blocked for brute force [blocked_ip:3].")
+	llm.AddProvider(mock, "m")
+	engine := NewChatEngine(llm, nil)
+	engine.SetRetriever(index)
+
+	var gotArgs Args
+	engine.SetTools([]Tool{{
+		Spec: ToolSpec{Name: "list_blocked_ips", Params: []Param{{Name: "since", Type: "string"}}},
+		Run: func(ctx context.Context, args Args) (ToolResult, error) {
+			gotArgs = args
+			return ToolResult{
+				Data:      []map[string]any{{"id": 3, "ip_address": "203.0.113.9"}, {"id": 4, "ip_address": "198.51.100.1"}},
+				Citations: []string{"blocked_ip:3", "blocked_ip:4"},
+			}, nil
+		},
+	}})
+
+	resp, err := engine.ProcessQuery(context.Background(), ChatRequest{Message: "Show blocked IPs from last night"})
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.9 was blocked for brute force [blocked_ip:3].", resp.Response)
+	assert.Equal(t, "12h", gotArgs.String("since"))
+	assert.Equal(t, []Citation{{ID: "blocked_ip:3", Kind: "blocked_ip"}, {ID: "blocked_ip:4", Kind: "blocked_ip"}}, resp.Citations,
+		"cited records come first, then the other records the tools returned")
+
+	reqs := mock.Requests()
+	require.Len(t, reqs, 2)
+	assert.Len(t, reqs[0].Tools, 1)
+	second := reqs[1].Messages
+	require.Len(t, second, 3)
+	assert.Equal(t, "list_blocked_ips", second[1].ToolCalls[0].Name)
+	assert.Equal(t, RoleTool, second[2].Role)
+	assert.Equal(t, second[1].ToolCalls[0].ID, second[2].ToolCallID)
+	var result ToolResult
+	require.NoError(t, json.Unmarshal([]byte(second[2].Content), &result))
+	assert.Len(t, result.Citations, 2)
+
+	// Retrieved records are in the prompt and can be cited
+	mock.Reply("SQL", "Patch the login form [finding:7].")
+	resp, err = engine.ProcessQuery(context.Background(), ChatRequest{Message: "Which scans found SQL injection?"})
+	require.NoError(t, err)
+	assert.Contains(t, mock.Requests()[2].System, "[finding:7] High DAST finding: SQL Injection")
+	assert.Equal(t, []Citation{{ID: "finding:7", Kind: "finding", Title: "High DAST finding: SQL Injection"}}, resp.Citations)
+}
+
+func TestChatEngine_ToolErrors(t *testing.T) {
+	llm := NewClient()
+	mock := NewMock().CallTool("drop", "drop_table", nil)
+	llm.AddProvider(mock, "m")
+	engine := NewChatEngine(llm, nil)
+	engine.SetRetriever(NewIndex())
+	engine.SetTools([]Tool{{Spec: ToolSpec{Name: "list_scans"}}})
+
+	_, err := engine.ProcessQuery(context.Background(), ChatRequest{Message: "drop the scans table"})
+	require.NoError(t, err)
+	last := mock.Requests()[1].Messages
+	assert.JSONEq(t, `{"error":"unknown tool \"drop_table\""}`, last[len(last)-1].Content, "unknown tools are reported to the model")
+}
@@ -0,0 +1,292 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Who can read a conversation. Only the owner can add messages or change
+// it.
+const (
+	VisibilityPrivate = "private"
+	VisibilityOrg     = "org" // Every user of the organisation
+)
+
+var (
+	// ErrConversationNotFound is also returned for conversations the user
+	// cannot read
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrNotOwner             = errors.New("only the owner can change a conversation")
+	ErrInvalidVisibility    = errors.New("visibility must be private or org")
+)
+
+// Conversation is a stored chat with the assistant. Messages up to
+// SummarizedThrough are sent to the model as Summary instead of verbatim.
+type Conversation struct {
+	ID                string                `json:"id" gorm:"primaryKey;size:36"`
+	UserID            string                `json:"user_id" gorm:"index;not null"`
+	Title             string                `json:"title"`
+	Visibility        string                `json:"visibility" gorm:"default:private"`
+	Summary           string                `json:"summary,omitempty"`
+	SummarizedThrough uint                  `json:"-"`
+	CreatedAt         time.Time             `json:"created_at"`
+	UpdatedAt         time.Time             `json:"updated_at"`
+	Messages          []ConversationMessage `json:"messages,omitempty"`
+	// Records cited by the answers, in order of first citation
+	References []Citation `json:"references,omitempty" gorm:"-"`
+}
+
+type ConversationMessage struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	ConversationID string     `json:"conversation_id" gorm:"index;size:36"`
+	Role           Role       `json:"role"` // user or assistant
+	Content        string     `json:"content"`
+	Citations      []Citation `json:"citations,omitempty" gorm:"serializer:json"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Characters of the first message used as the title of a new conversation
+const titleLength = 60
+
+const summaryPrompt = `Summarise the conversation between a security analyst and an assistant below, so it can continue without the original messages.
+Keep facts, decisions, open questions and record IDs in square brackets, e.g. [finding:42]. Write at most 200 words.`
+
+// ConversationStore keeps conversations in the database and answers
+// their messages with a ChatEngine. When the history outgrows
+// HistoryTokens, all but the last KeepRecent messages are summarised.
+type ConversationStore struct {
+	db     *gorm.DB
+	engine *ChatEngine
+
+	HistoryTokens int
+	KeepRecent    int
+}
+
+func NewConversationStore(db *gorm.DB, engine *ChatEngine) *ConversationStore {
+	return &ConversationStore{
+		db:            db,
+		engine:        engine,
+		HistoryTokens: 4000,
+		KeepRecent:    6,
+	}
+}
+
+func validVisibility(v string) bool {
+	return v == VisibilityPrivate || v == VisibilityOrg
+}
+
+// Create starts an empty conversation. Without a title, the first message
+// names it.
+func (s *ConversationStore) Create(userID, title, visibility string) (*Conversation, error) {
+	if visibility == "" {
+		visibility = VisibilityPrivate
+	}
+	if !validVisibility(visibility) {
+		return nil, ErrInvalidVisibility
+	}
+	conv := &Conversation{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Title:      strings.TrimSpace(title),
+		Visibility: visibility,
+	}
+	if err := s.db.Create(conv).Error; err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// List returns the user's conversations and those shared with the
+// organisation, most recently active first, without messages
+func (s *ConversationStore) List(userID string) ([]Conversation, error) {
+	convs := []Conversation{}
+	err := s.db.Where("user_id = ? OR visibility = ?", userID, VisibilityOrg).
+		Order("updated_at DESC").Find(&convs).Error
+	return convs, err
+}
+
+// Get returns a conversation the user can read, with its messages and
+// references
+func (s *ConversationStore) Get(id, userID string) (*Conversation, error) {
+	conv, err := s.find(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("conversation_id = ?", id).Order("id").Find(&conv.Messages).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, m := range conv.Messages {
+		for _, c := range m.Citations {
+			if !seen[c.ID] {
+				seen[c.ID] = true
+				conv.References = append(conv.References, c)
+			}
+		}
+	}
+	return conv, nil
+}
+
+// CanRead reports whether the user can read a conversation
+func (s *ConversationStore) CanRead(id, userID string) bool {
+	_, err := s.find(id, userID)
+	return err == nil
+}
+
+// Update renames or shares a conversation; nil values are left unchanged
+func (s *ConversationStore) Update(id, userID string, title, visibility *string) (*Conversation, error) {
+	conv, err := s.owned(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]any{}
+	if title != nil {
+		updates["title"] = strings.TrimSpace(*title)
+	}
+	if visibility != nil {
+		if !validVisibility(*visibility) {
+			return nil, ErrInvalidVisibility
+		}
+		updates["visibility"] = *visibility
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(conv).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return s.Get(id, userID)
+}
+
+// Delete removes a conversation and its messages
+func (s *ConversationStore) Delete(id, userID string) error {
+	if _, err := s.owned(id, userID); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", id).Delete(&ConversationMessage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Conversation{}, "id = ?", id).Error
+	})
+}
+
+// Send answers a message in the context of the conversation's history,
+// passing the answer to onDelta as it is generated. The message and the
+// answer are stored only once the answer is complete.
+func (s *ConversationStore) Send(ctx context.Context, id, userID, message string, onDelta func(string)) (question, answer *ConversationMessage, err error) {
+	conv, err := s.owned(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !s.engine.Available() {
+		return nil, nil, ErrNotConfigured
+	}
+	var msgs []ConversationMessage
+	if err := s.db.Where("conversation_id = ? AND id > ?", id, conv.SummarizedThrough).Order("id").Find(&msgs).Error; err != nil {
+		return nil, nil, err
+	}
+	msgs = s.compact(ctx, conv, msgs)
+
+	req := ChatRequest{Message: message, Summary: conv.Summary}
+	for _, m := range msgs {
+		req.History = append(req.History, ChatMessage{Role: string(m.Role), Content: m.Content})
+	}
+	resp, err := s.engine.Answer(ctx, req, onDelta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	question = &ConversationMessage{ConversationID: id, Role: RoleUser, Content: message}
+	answer = &ConversationMessage{ConversationID: id, Role: RoleAssistant, Content: resp.Response, Citations: resp.Citations}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(question).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(answer).Error; err != nil {
+			return err
+		}
+		updates := map[string]any{"updated_at": time.Now()}
+		if conv.Title == "" {
+			updates["title"] = truncate(strings.Join(strings.Fields(message), " "), titleLength)
+		}
+		return tx.Model(conv).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return question, answer, nil
+}
+
+// compact summarises all but the newest messages once the history is over
+// budget, and returns the messages to send verbatim. If summarising fails,
+// every message is returned and the engine drops the oldest.
+func (s *ConversationStore) compact(ctx context.Context, conv *Conversation, msgs []ConversationMessage) []ConversationMessage {
+	if len(msgs) <= s.KeepRecent {
+		return msgs
+	}
+	total := EstimateTokens(conv.Summary)
+	for _, m := range msgs {
+		total += EstimateTokens(m.Content)
+	}
+	if total <= s.HistoryTokens {
+		return msgs
+	}
+
+	old, recent := msgs[:len(msgs)-s.KeepRecent], msgs[len(msgs)-s.KeepRecent:]
+	var transcript strings.Builder
+	if conv.Summary != "" {
+		transcript.WriteString("Summary of the conversation so far:\n" + conv.Summary + "\n\n")
+	}
+	for _, m := range old {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", m.Role, m.Content)
+	}
+	resp, err := s.engine.llm.Generate(ctx, FeatureSummary, Request{
+		System:   summaryPrompt,
+		Messages: []Message{{Role: RoleUser, Content: transcript.String()}},
+	})
+	if err != nil {
+		slog.Warn("Failed to summarise conversation", "conversation", conv.ID, "error", err)
+		return msgs
+	}
+
+	through := old[len(old)-1].ID
+	err = s.db.Model(conv).UpdateColumns(map[string]any{"summary": resp.Text, "summarized_through": through}).Error
+	if err != nil {
+		slog.Warn("Failed to save conversation summary", "conversation", conv.ID, "error", err)
+		return msgs
+	}
+	conv.Summary, conv.SummarizedThrough = resp.Text, through
+	return recent
+}
+
+// find returns a conversation the user can read
+func (s *ConversationStore) find(id, userID string) (*Conversation, error) {
+	var conv Conversation
+	err := s.db.Where("id = ? AND (user_id = ? OR visibility = ?)", id, userID, VisibilityOrg).First(&conv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// owned returns a conversation the user can change
+func (s *ConversationStore) owned(id, userID string) (*Conversation, error) {
+	conv, err := s.find(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.UserID != userID {
+		return nil, ErrNotOwner
+	}
+	return conv, nil
+}
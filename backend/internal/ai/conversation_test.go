@@ -0,0 +1,128 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newConversationStore(t *testing.T) (*ConversationStore, *Mock) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&Conversation{}, &ConversationMessage{}))
+
+	llm := NewClient()
+	mock := NewMock()
+	llm.AddProvider(mock, "m")
+	engine := NewChatEngine(llm, db)
+	engine.SetRetriever(NewIndex())
+	return NewConversationStore(db, engine), mock
+}
+
+func TestConversationStore(t *testing.T) {
+	store, mock := newConversationStore(t)
+	mock.Reply("patch", "Patch [finding:7] first.")
+	ctx := context.Background()
+
+	conv, err := store.Create("alice", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, VisibilityPrivate, conv.Visibility)
+
+	var streamed strings.Builder
+	question, answer, err := store.Send(ctx, conv.ID, "alice", "What should I patch first?", func(s string) { streamed.WriteString(s) })
+	require.NoError(t, err)
+	assert.Equal(t, "What should I patch first?", question.Content)
+	assert.Equal(t, "Patch [finding:7] first.", answer.Content)
+	assert.Equal(t, answer.Content, streamed.String(), "the streamed fragments make up the answer")
+
+	_, _, err = store.Send(ctx, conv.ID, "alice", "And then?", nil)
+	require.NoError(t, err)
+	reqs := mock.Requests()
+	assert.Equal(t, []Message{
+		{Role: RoleUser, Content: "What should I patch first?"},
+		{Role: RoleAssistant, Content: "Patch [finding:7] first."},
+		{Role: RoleUser, Content: "And then?"},
+	}, reqs[len(reqs)-1].Messages, "the history is replayed from the database")
+
+	got, err := store.Get(conv.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "What should I patch first?", got.Title)
+	assert.Len(t, got.Messages, 4)
+
+	// Private conversations are invisible to other users
+	_, err = store.Get(conv.ID, "bob")
+	assert.True(t, errors.Is(err, ErrConversationNotFound))
+	list, err := store.List("bob")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	org := VisibilityOrg
+	_, err = store.Update(conv.ID, "bob", nil, &org)
+	assert.True(t, errors.Is(err, ErrConversationNotFound))
+	_, err = store.Update(conv.ID, "alice", nil, &org)
+	require.NoError(t, err)
+
+	// Shared conversations can be read, but not continued, by others
+	got, err = store.Get(conv.ID, "bob")
+	require.NoError(t, err)
+	assert.Len(t, got.Messages, 4)
+	list, err = store.List("bob")
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+	_, _, err = store.Send(ctx, conv.ID, "bob", "hi", nil)
+	assert.True(t, errors.Is(err, ErrNotOwner))
+	assert.True(t, errors.Is(store.Delete(conv.ID, "bob"), ErrNotOwner))
+
+	require.NoError(t, store.Delete(conv.ID, "alice"))
+	_, err = store.Get(conv.ID, "alice")
+	assert.True(t, errors.Is(err, ErrConversationNotFound))
+}
+
+func TestConversationStore_Summarizes(t *testing.T) {
+	store, mock := newConversationStore(t)
+	store.HistoryTokens = 40
+	store.KeepRecent = 2
+	mock.Reply("user: question", "Alice asked about [finding:7].")
+	ctx := context.Background()
+
+	conv, err := store.Create("alice", "Triage", VisibilityPrivate)
+	require.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		_, _, err := store.Send(ctx, conv.ID, "alice", fmt.Sprintf("question %d %s", i, strings.Repeat("detail ", 10)), nil)
+		require.NoError(t, err)
+	}
+
+	got, err := store.Get(conv.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice asked about [finding:7].", got.Summary)
+	assert.Len(t, got.Messages, 8, "summarised messages are kept")
+
+	reqs := mock.Requests()
+	last := reqs[len(reqs)-1]
+	assert.Contains(t, last.System, "Alice asked about [finding:7].")
+	require.Len(t, last.Messages, 3, "only the newest messages are sent verbatim")
+	assert.True(t, strings.HasPrefix(last.Messages[0].Content, "question 3"))
+}
+
+func TestTrimHistory(t *testing.T) {
+	history := []ChatMessage{
+		{Role: "user", Content: strings.Repeat("a", 400)},
+		{Role: "model", Content: strings.Repeat("b", 40)},
+		{Role: "user", Content: strings.Repeat("c", 40)},
+	}
+	assert.Equal(t, history[1:], TrimHistory(history, 30))
+	assert.Equal(t, history, TrimHistory(history, 200))
+	assert.Empty(t, TrimHistory(history, 5))
+}
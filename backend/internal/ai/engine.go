@@ -4,46 +4,32 @@ import (
 	"context"
 	"fmt"
 	"strings"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
 )
 
 // RemediationEngine handles generating fixes for vulnerabilities
 type RemediationEngine struct {
-	Client *genai.Client // Exported to share with ChatEngine
-	model  *genai.GenerativeModel
+	llm *Client
 }
 
-func NewRemediationEngine(apiKey string) *RemediationEngine {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		// In a real app, we should handle this error better or propagate it.
-		// For now, we'll just log it if we could, but since constructor signature
-		// is fixed, we might panic or return nil (which is risky).
-		// Let's assume the key is valid or client creation is lazy enough.
-		// Actually, genai.NewClient checks options.
-		fmt.Printf("Error creating Gemini client: %v\n", err)
-		return nil
+// NewRemediationEngine uses llm's remediation and dependencies routes.
+// Without a provider the engine is still usable; the AI methods return
+// ErrNotConfigured.
+func NewRemediationEngine(llm *Client) *RemediationEngine {
+	if llm == nil {
+		llm = NewClient()
 	}
+	return &RemediationEngine{llm: llm}
+}
 
-	model := client.GenerativeModel("gemini-1.5-flash") // Use a cost-effective model
-	return &RemediationEngine{
-		Client: client,
-		model:  model,
-	}
+// Available reports whether feature, FeatureRemediation or
+// FeatureDependencies, has a provider
+func (e *RemediationEngine) Available(feature Feature) bool {
+	return e.llm.Available(feature)
 }
 
 // GenerateFix creates a context-aware remediation plan
 func (e *RemediationEngine) GenerateFix(ctx context.Context, vulnTitle, vulnDesc, techStack string) (string, error) {
-	if e.Client == nil {
-		return "", fmt.Errorf("gemini client not initialized")
-	}
-
-	// 1. Construct the Prompt
 	prompt := fmt.Sprintf(`
-You are a Senior Security Engineer.
 Vulnerability: %s
 Description: %s
 Technology Stack: %s
@@ -52,35 +38,19 @@ Provide a secure code snippet to fix this issue.
 Explain the fix in 2 sentences.
 `, vulnTitle, vulnDesc, techStack)
 
-	// 2. Call Gemini API
-	resp, err := e.model.GenerateContent(ctx, genai.Text(prompt))
+	resp, err := e.llm.Generate(ctx, FeatureRemediation, Request{
+		System:   "You are a Senior Security Engineer.",
+		Messages: []Message{{Role: RoleUser, Content: prompt}},
+	})
 	if err != nil {
-		return "", fmt.Errorf("gemini API error: %v", err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no response from gemini")
-	}
-
-	// Extract text from parts
-	var sb strings.Builder
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if txt, ok := part.(genai.Text); ok {
-			sb.WriteString(string(txt))
-		}
+		return "", err
 	}
-
-	return sb.String(), nil
+	return resp.Text, nil
 }
 
 // AnalyzeDependencies checks for vulnerabilities in dependency files
 func (e *RemediationEngine) AnalyzeDependencies(ctx context.Context, filename, content string) (string, error) {
-	if e.Client == nil {
-		return "", fmt.Errorf("gemini client not initialized")
-	}
-
 	prompt := fmt.Sprintf(`
-You are a Supply Chain Security Expert.
 Analyze the following %s file for security vulnerabilities, outdated packages, and license issues.
 Content:
 %s
@@ -89,48 +59,112 @@ List the top 3 critical issues found. If none, say "No critical issues found".
 Format as a bulleted list.
 `, filename, content)
 
-	resp, err := e.model.GenerateContent(ctx, genai.Text(prompt))
+	resp, err := e.llm.Generate(ctx, FeatureDependencies, Request{
+		System:   "You are a Supply Chain Security Expert.",
+		Messages: []Message{{Role: RoleUser, Content: prompt}},
+	})
 	if err != nil {
-		return "", fmt.Errorf("gemini API error: %v", err)
+		return "", err
 	}
+	return resp.Text, nil
+}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no response from gemini")
-	}
+// PatchRequest describes a finding in one file of a repository
+type PatchRequest struct {
+	Title       string
+	Description string
+	Solution    string
+	File        string // Relative to the repository root
+	Line        int    // 0 when the finding has no line
+	Source      string // Content of File
+	// A rejected earlier attempt and the reason, so the model can correct it
+	PreviousPatch string
+	PreviousError string
+}
 
-	var sb strings.Builder
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if txt, ok := part.(genai.Text); ok {
-			sb.WriteString(string(txt))
-		}
-	}
+const (
+	// Files up to this many lines are sent whole; of longer ones, the lines
+	// around the finding
+	patchFullLines   = 400
+	patchWindowLines = 150
+)
 
-	return sb.String(), nil
+// GeneratePatch asks the model for a unified diff fixing a finding
+func (e *RemediationEngine) GeneratePatch(ctx context.Context, req PatchRequest) (string, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Vulnerability: %s\nDescription: %s\n", req.Title, req.Description)
+	if req.Solution != "" {
+		fmt.Fprintf(&prompt, "Suggested solution: %s\n", req.Solution)
+	}
+	if req.Line > 0 {
+		fmt.Fprintf(&prompt, "Location: %s, line %d\n", req.File, req.Line)
+	} else {
+		fmt.Fprintf(&prompt, "Location: %s\n", req.File)
+	}
+	prompt.WriteString("\nSource, with line numbers that are not part of the file:\n")
+	prompt.WriteString(numberLines(req.Source, req.Line))
+	if req.PreviousPatch != "" {
+		fmt.Fprintf(&prompt, "\nYour previous patch was rejected: %s\n```diff\n%s\n```\n", req.PreviousError, req.PreviousPatch)
+	}
+	fmt.Fprintf(&prompt, `
+Fix the vulnerability with the smallest change that keeps the code working.
+Reply with only a unified diff in git format, with paths a/%[1]s and b/%[1]s, in a diff code block.`, req.File)
+
+	resp, err := e.llm.Generate(ctx, FeatureRemediation, Request{
+		System:   "You are a Senior Security Engineer. You write minimal, correct patches.",
+		Messages: []Message{{Role: RoleUser, Content: prompt.String()}},
+	})
+	if err != nil {
+		return "", err
+	}
+	patch := extractDiff(resp.Text)
+	if patch == "" {
+		return "", fmt.Errorf("model did not return a diff")
+	}
+	return patch, nil
 }
 
-// AnalyzeCode performs SAST-like analysis on a snippet (Stub)
-func (e *RemediationEngine) AnalyzeCode(codeSnippet string) ([]string, error) {
-	if strings.Contains(codeSnippet, "eval(") {
-		return []string{"Critical: Avoid using eval() as it can lead to RCE."}, nil
+// numberLines prefixes lines with their number. Long files are cut to
+// the lines around line.
+func numberLines(source string, line int) string {
+	lines := strings.Split(source, "\n")
+	first, last := 0, len(lines)
+	if len(lines) > patchFullLines {
+		first = max(line-1-patchWindowLines, 0)
+		last = min(first+2*patchWindowLines, len(lines))
+	}
+	var sb strings.Builder
+	for i := first; i < last; i++ {
+		fmt.Fprintf(&sb, "%5d| %s\n", i+1, lines[i])
 	}
-	return []string{}, nil
+	return sb.String()
 }
 
-// CreateFixPR simulates creating a GitHub Pull Request
-func (e *RemediationEngine) CreateFixPR(ctx context.Context, repo, branch, title, body string) (string, error) {
-	// In a real implementation, this would use go-github client.
-	// client := github.NewClient(...)
-	// pr, _, err := client.PullRequests.Create(...)
-
-	// Mock implementation
-	prURL := fmt.Sprintf("https://github.com/%s/pull/123", repo)
-	fmt.Printf("Creating PR for repo %s on branch %s: %s\n", repo, branch, prURL)
-
-	return prURL, nil
+// extractDiff returns the diff in a code block, or the text from the first
+// diff header
+func extractDiff(text string) string {
+	if start := strings.Index(text, "```"); start >= 0 {
+		body := text[start+3:]
+		if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+			body = body[nl+1:]
+		}
+		if end := strings.Index(body, "```"); end >= 0 {
+			body = body[:end]
+		}
+		text = body
+	}
+	for _, header := range []string{"diff --git ", "--- "} {
+		if i := strings.Index(text, header); i == 0 || i > 0 && text[i-1] == '\n' {
+			text = text[i:]
+			break
+		}
+	}
+	if !strings.Contains(text, "@@") {
+		return ""
+	}
+	return strings.TrimRight(text, "\n ") + "\n"
 }
 
 func (e *RemediationEngine) Close() {
-	if e.Client != nil {
-		e.Client.Close()
-	}
+	e.llm.Close()
 }
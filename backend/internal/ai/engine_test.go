@@ -2,36 +2,52 @@ package ai
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 )
 
 func TestGenerateFix(t *testing.T) {
-	apiKey := "dummy-key"
-	if apiKey == "dummy-key" {
-		t.Skip("Skipping TestGenerateFix: GEMINI_API_KEY not set")
-	}
-
-	engine := NewRemediationEngine(apiKey)
+	llm := NewClient()
+	mock := NewMock().Reply("SQL Injection", "Use parameterized queries.")
+	llm.AddProvider(mock, "mock-model")
+	engine := NewRemediationEngine(llm)
 
 	fix, err := engine.GenerateFix(context.Background(), "SQL Injection", "Input not sanitized", "Go/Gin")
 	if err != nil {
 		t.Fatalf("GenerateFix failed: %v", err)
 	}
 
-	if fix == "" {
-		t.Error("Expected fix to be generated, got empty string")
+	if fix != "Use parameterized queries." {
+		t.Errorf("Expected the mock fix, got %q", fix)
+	}
+	reqs := mock.Requests()
+	if len(reqs) != 1 || reqs[0].Model != "mock-model" || !strings.Contains(reqs[0].Messages[0].Content, "Go/Gin") {
+		t.Errorf("Unexpected request: %+v", reqs)
 	}
 }
 
-func TestAnalyzeCode(t *testing.T) {
-	engine := NewRemediationEngine("dummy-key")
+func TestGenerateFix_NoProvider(t *testing.T) {
+	engine := NewRemediationEngine(nil)
 
-	issues, err := engine.AnalyzeCode("func main() { eval(input) }")
-	if err != nil {
-		t.Fatalf("AnalyzeCode failed: %v", err)
+	if engine.Available(FeatureRemediation) {
+		t.Error("Expected remediation to be unavailable")
 	}
+	if _, err := engine.GenerateFix(context.Background(), "XSS", "", ""); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured, got %v", err)
+	}
+}
 
-	if len(issues) == 0 {
-		t.Error("Expected issues to be found in unsafe code")
+func TestExtractDiff(t *testing.T) {
+	diff := "--- a/app.py\n+++ b/app.py\n@@ -1 +1 @@\n-eval(x)\n+int(x)\n"
+	cases := map[string]string{
+		"Here is the fix:\n```diff\n" + diff + "```\nIt removes eval.": diff,
+		diff:                  diff,
+		"Sorry, I can't help.": "",
+	}
+	for text, want := range cases {
+		if got := extractDiff(text); got != want {
+			t.Errorf("extractDiff(%q) = %q, want %q", text, got, want)
+		}
 	}
 }
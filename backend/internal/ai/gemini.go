@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// Gemini calls Google's hosted Gemini API. Prompts leave the network, so
+// deployments that must keep findings private should use a local provider.
+type Gemini struct {
+	client *genai.Client
+}
+
+func NewGemini(ctx context.Context, apiKey string) (*Gemini, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("create Gemini client: %w", err)
+	}
+	return &Gemini{client: client}, nil
+}
+
+func (g *Gemini) Name() string { return "gemini" }
+
+func (g *Gemini) Generate(ctx context.Context, req Request) (*Response, error) {
+	cs, last, err := g.chat(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cs.SendMessage(ctx, last...)
+	if err != nil {
+		return nil, err
+	}
+	return geminiResponse(resp, req.Model)
+}
+
+// Stream passes on the text of each streamed chunk; tool calls and usage
+// are taken from the merged response
+func (g *Gemini) Stream(ctx context.Context, req Request, onDelta func(string)) (*Response, error) {
+	cs, last, err := g.chat(req)
+	if err != nil {
+		return nil, err
+	}
+	iter := cs.SendMessageStream(ctx, last...)
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range resp.Candidates {
+			if c.Content == nil {
+				continue
+			}
+			for _, part := range c.Content.Parts {
+				if text, ok := part.(genai.Text); ok && text != "" {
+					onDelta(string(text))
+				}
+			}
+		}
+	}
+	return geminiResponse(iter.MergedResponse(), req.Model)
+}
+
+// chat starts a session with the history of req and returns the parts of
+// its last message
+func (g *Gemini) chat(req Request) (*genai.ChatSession, []genai.Part, error) {
+	if len(req.Messages) == 0 {
+		return nil, nil, fmt.Errorf("no messages")
+	}
+	model := g.client.GenerativeModel(req.Model)
+	if req.System != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(req.System))
+	}
+	if req.Temperature > 0 {
+		model.SetTemperature(float32(req.Temperature))
+	}
+	if req.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(req.MaxTokens))
+	}
+	if len(req.Tools) > 0 {
+		model.Tools = []*genai.Tool{geminiTool(req.Tools)}
+	}
+
+	contents := geminiContents(req.Messages)
+	cs := model.StartChat()
+	cs.History = contents[:len(contents)-1]
+	return cs, contents[len(contents)-1].Parts, nil
+}
+
+func geminiResponse(resp *genai.GenerateContentResponse, model string) (*Response, error) {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("no candidates")
+	}
+
+	var sb strings.Builder
+	out := &Response{Model: model}
+	for i, part := range resp.Candidates[0].Content.Parts {
+		switch p := part.(type) {
+		case genai.Text:
+			sb.WriteString(string(p))
+		case genai.FunctionCall:
+			out.ToolCalls = append(out.ToolCalls, ToolCall{ID: fmt.Sprintf("call_%d", i), Name: p.Name, Arguments: p.Args})
+		}
+	}
+	out.Text = sb.String()
+	if u := resp.UsageMetadata; u != nil {
+		out.Usage = Usage{InputTokens: int(u.PromptTokenCount), OutputTokens: int(u.CandidatesTokenCount)}
+	}
+	return out, nil
+}
+
+// geminiContents converts messages to Gemini's turns, where the results of
+// parallel tool calls form one turn
+func geminiContents(msgs []Message) []*genai.Content {
+	var contents []*genai.Content
+	for _, msg := range msgs {
+		var part genai.Part = genai.Text(msg.Content)
+		role := "user"
+		switch msg.Role {
+		case RoleAssistant:
+			role = "model"
+		case RoleTool:
+			part = genai.FunctionResponse{Name: msg.ToolName, Response: map[string]any{"result": msg.Content}}
+			if last := len(contents) - 1; last >= 0 && isFunctionResponse(contents[last]) {
+				contents[last].Parts = append(contents[last].Parts, part)
+				continue
+			}
+		}
+		c := &genai.Content{Role: role}
+		if msg.Content != "" || msg.Role == RoleTool {
+			c.Parts = append(c.Parts, part)
+		}
+		for _, call := range msg.ToolCalls {
+			c.Parts = append(c.Parts, genai.FunctionCall{Name: call.Name, Args: call.Arguments})
+		}
+		contents = append(contents, c)
+	}
+	return contents
+}
+
+func isFunctionResponse(c *genai.Content) bool {
+	if len(c.Parts) == 0 {
+		return false
+	}
+	_, ok := c.Parts[0].(genai.FunctionResponse)
+	return ok
+}
+
+func geminiTool(specs []ToolSpec) *genai.Tool {
+	types := map[string]genai.Type{
+		"string":  genai.TypeString,
+		"integer": genai.TypeInteger,
+		"number":  genai.TypeNumber,
+		"boolean": genai.TypeBoolean,
+	}
+	tool := &genai.Tool{}
+	for _, spec := range specs {
+		params := &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{}}
+		for _, p := range spec.Params {
+			params.Properties[p.Name] = &genai.Schema{Type: types[p.Type], Description: p.Description, Enum: p.Enum}
+			if p.Required {
+				params.Required = append(params.Required, p.Name)
+			}
+		}
+		decl := &genai.FunctionDeclaration{Name: spec.Name, Description: spec.Description}
+		if len(spec.Params) > 0 {
+			decl.Parameters = params
+		}
+		tool.FunctionDeclarations = append(tool.FunctionDeclarations, decl)
+	}
+	return tool
+}
+
+func (g *Gemini) Close() error {
+	return g.client.Close()
+}
@@ -0,0 +1,255 @@
+package ai
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Document is a record the chat assistant can retrieve. ID has the form
+// kind:id, e.g. finding:42, and is how answers cite the record.
+type Document struct {
+	ID    string    `json:"id"`
+	Kind  string    `json:"kind"`
+	Title string    `json:"title"`
+	Text  string    `json:"text"`
+	Time  time.Time `json:"time,omitempty"`
+}
+
+type Hit struct {
+	Document
+	Score float64 `json:"score"`
+}
+
+// Retriever finds the documents most relevant to a query
+type Retriever interface {
+	Search(query string, k int, kinds ...string) []Hit
+}
+
+const (
+	vectorDims = 256
+	// BM25 parameters
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// Reciprocal rank fusion constant
+	rrfK = 60
+	// Minimum similarity for a document found only by the vector search
+	minCosine = 0.3
+)
+
+// Index is an in-memory hybrid index. Keyword search ranks documents with
+// BM25; vector search compares hashed character trigrams, which matches
+// spelling variants such as "injections" and "injection" without an
+// embedding model. The two rankings are merged with reciprocal rank
+// fusion. Nothing leaves the process.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*indexedDoc
+	df       map[string]int
+	totalLen int
+}
+
+type indexedDoc struct {
+	Document
+	tf     map[string]int
+	length int
+	vec    []float32
+}
+
+func NewIndex() *Index {
+	return &Index{docs: make(map[string]*indexedDoc), df: make(map[string]int)}
+}
+
+// Replace swaps all documents of a kind for docs
+func (ix *Index) Replace(kind string, docs []Document) {
+	indexed := make([]*indexedDoc, 0, len(docs))
+	for _, d := range docs {
+		d.Kind = kind
+		indexed = append(indexed, newIndexedDoc(d))
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for id, d := range ix.docs {
+		if d.Kind == kind {
+			ix.remove(id, d)
+		}
+	}
+	for _, d := range indexed {
+		if old, ok := ix.docs[d.ID]; ok {
+			ix.remove(d.ID, old)
+		}
+		ix.docs[d.ID] = d
+		ix.totalLen += d.length
+		for term := range d.tf {
+			ix.df[term]++
+		}
+	}
+}
+
+func (ix *Index) remove(id string, d *indexedDoc) {
+	delete(ix.docs, id)
+	ix.totalLen -= d.length
+	for term := range d.tf {
+		if ix.df[term]--; ix.df[term] <= 0 {
+			delete(ix.df, term)
+		}
+	}
+}
+
+// Len returns the number of documents, per kind
+func (ix *Index) Len() map[string]int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, d := range ix.docs {
+		counts[d.Kind]++
+	}
+	return counts
+}
+
+// Search returns up to k documents, optionally of the given kinds, best
+// first
+func (ix *Index) Search(query string, k int, kinds ...string) []Hit {
+	terms := tokenize(query)
+	if len(terms) == 0 || k <= 0 {
+		return nil
+	}
+	qvec := trigramVector(terms)
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	n := float64(len(ix.docs))
+	avgLen := float64(ix.totalLen) / math.Max(n, 1)
+
+	type scored struct {
+		doc       *indexedDoc
+		bm25, cos float64
+		bmRank    int
+	}
+	var candidates []*scored
+	for _, d := range ix.docs {
+		if len(kinds) > 0 && !contains(kinds, d.Kind) {
+			continue
+		}
+		s := &scored{doc: d, cos: dot(qvec, d.vec)}
+		for _, t := range terms {
+			tf := float64(d.tf[t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(ix.df[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			s.bm25 += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(d.length)/avgLen))
+		}
+		if s.bm25 > 0 || s.cos >= minCosine {
+			candidates = append(candidates, s)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].bm25 > candidates[j].bm25 })
+	for i, c := range candidates {
+		c.bmRank = i + 1
+		if c.bm25 == 0 {
+			c.bmRank = 0
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].cos > candidates[j].cos })
+	hits := make([]Hit, 0, len(candidates))
+	for i, c := range candidates {
+		var score float64
+		if c.cos >= minCosine {
+			score += 1.0 / float64(rrfK+i+1)
+		}
+		if c.bmRank > 0 {
+			score += 1.0 / float64(rrfK+c.bmRank)
+		}
+		hits = append(hits, Hit{Document: c.doc.Document, Score: score})
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+func newIndexedDoc(d Document) *indexedDoc {
+	terms := tokenize(d.Title + " " + d.Text)
+	tf := make(map[string]int, len(terms))
+	for _, t := range terms {
+		tf[t]++
+	}
+	return &indexedDoc{Document: d, tf: tf, length: len(terms), vec: trigramVector(terms)}
+}
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "by": true, "for": true, "from": true,
+	"in": true, "is": true, "of": true, "on": true, "or": true, "the": true, "to": true,
+	"was": true, "what": true, "which": true, "with": true, "show": true, "me": true,
+}
+
+// tokenize lower-cases text and splits it into letters and digits, so
+// api.example.com becomes api, example and com
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := fields[:0]
+	for _, f := range fields {
+		if !stopwords[f] {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// trigramVector hashes the character trigrams of terms into a unit vector
+func trigramVector(terms []string) []float32 {
+	vec := make([]float32, vectorDims)
+	h := fnv.New32a()
+	for _, t := range terms {
+		padded := []rune("^" + t + "$")
+		for i := 0; i+3 <= len(padded); i++ {
+			h.Reset()
+			h.Write([]byte(string(padded[i : i+3])))
+			vec[h.Sum32()%vectorDims]++
+		}
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v * v)
+	}
+	if norm > 0 {
+		inv := float32(1 / math.Sqrt(norm))
+		for i := range vec {
+			vec[i] *= inv
+		}
+	}
+	return vec
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i] * b[i])
+	}
+	return sum
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
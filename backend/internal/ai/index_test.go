@@ -0,0 +1,40 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex_Search(t *testing.T) {
+	ix := NewIndex()
+	ix.Replace("finding", []Document{
+		{ID: "finding:1", Title: "SQL Injection in login", Text: "Target api.example.com"},
+		{ID: "finding:2", Title: "Cross-site scripting", Text: "Target www.example.com"},
+		{ID: "finding:3", Title: "Outdated TLS", Text: "Target mail.example.com"},
+	})
+	ix.Replace("playbook", []Document{
+		{ID: "playbook:pb-1", Title: "Block Malicious IPs", Text: "Trigger HighThreatScore"},
+	})
+
+	hits := ix.Search("SQL injection on api.example.com", 2)
+	require.NotEmpty(t, hits)
+	assert.Equal(t, "finding:1", hits[0].ID)
+	assert.Equal(t, "finding", hits[0].Kind)
+
+	hits = ix.Search("injections", 5)
+	require.NotEmpty(t, hits, "trigram vectors match spelling variants")
+	assert.Equal(t, "finding:1", hits[0].ID)
+
+	hits = ix.Search("block", 5, "finding")
+	for _, h := range hits {
+		assert.Equal(t, "finding", h.Kind)
+	}
+	assert.Empty(t, ix.Search("the of and", 5))
+
+	// Replacing a kind drops its old documents
+	ix.Replace("finding", []Document{{ID: "finding:4", Title: "Open S3 bucket"}})
+	assert.Equal(t, map[string]int{"finding": 1, "playbook": 1}, ix.Len())
+	assert.Empty(t, ix.Search("scripting", 5))
+}
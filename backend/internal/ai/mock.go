@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Mock is a deterministic provider for tests and demos. It answers with
+// the first reply whose key occurs in the last message, or else with a
+// digest of the request, and records every request.
+type Mock struct {
+	mu       sync.Mutex
+	replies  []mockReply
+	requests []Request
+	err      error
+}
+
+type mockReply struct {
+	substr string
+	text   string
+	call   *ToolCall
+}
+
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+func (m *Mock) Name() string { return "mock" }
+
+// Reply answers messages containing substr with text. Replies are matched
+// in the order they were added.
+func (m *Mock) Reply(substr, text string) *Mock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies = append(m.replies, mockReply{substr: substr, text: text})
+	return m
+}
+
+// CallTool answers user messages containing substr with a call to a tool
+func (m *Mock) CallTool(substr, name string, args map[string]any) *Mock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies = append(m.replies, mockReply{substr: substr, call: &ToolCall{Name: name, Arguments: args}})
+	return m
+}
+
+// Fail makes every call return err
+func (m *Mock) Fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Requests returns the requests received so far
+func (m *Mock) Requests() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Request(nil), m.requests...)
+}
+
+func (m *Mock) Generate(ctx context.Context, req Request) (*Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, req)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var last Message
+	if len(req.Messages) > 0 {
+		last = req.Messages[len(req.Messages)-1]
+	}
+	text := ""
+	for i, r := range m.replies {
+		if !strings.Contains(last.Content, r.substr) {
+			continue
+		}
+		if r.call == nil {
+			text = r.text
+			break
+		}
+		if last.Role == RoleUser {
+			call := *r.call
+			call.ID = fmt.Sprintf("call_%d", i)
+			return &Response{ToolCalls: []ToolCall{call}, Model: req.Model}, nil
+		}
+	}
+	if text == "" {
+		h := sha256.New()
+		h.Write([]byte(req.System))
+		for _, msg := range req.Messages {
+			h.Write([]byte(string(msg.Role) + ":" + msg.Content + "\n"))
+		}
+		text = "mock response " + hex.EncodeToString(h.Sum(nil))[:12]
+	}
+
+	var input int
+	for _, msg := range req.Messages {
+		input += len(strings.Fields(msg.Content))
+	}
+	return &Response{
+		Text:  text,
+		Model: req.Model,
+		Usage: Usage{InputTokens: input + len(strings.Fields(req.System)), OutputTokens: len(strings.Fields(text))},
+	}, nil
+}
+
+// Stream sends the response word by word
+func (m *Mock) Stream(ctx context.Context, req Request, onDelta func(string)) (*Response, error) {
+	resp, err := m.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range strings.SplitAfter(resp.Text, " ") {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if word != "" {
+			onDelta(word)
+		}
+	}
+	return resp, nil
+}
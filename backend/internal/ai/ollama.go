@@ -0,0 +1,149 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Ollama calls a local Ollama server's chat API
+type Ollama struct {
+	host   string
+	client *http.Client
+}
+
+func NewOllama(host string) *Ollama {
+	return &Ollama{
+		host:   strings.TrimRight(host, "/"),
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (o *Ollama) Name() string { return "ollama" }
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature,omitempty"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// Ollama passes arguments as an object and does not identify calls
+type ollamaToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []openAITool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	// Set on the last chunk of a stream
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+}
+
+func (o *Ollama) Generate(ctx context.Context, req Request) (*Response, error) {
+	var resp ollamaResponse
+	if err := postJSON(ctx, o.client, o.host+"/api/chat", "", o.request(req), &resp); err != nil {
+		return nil, err
+	}
+	out := &Response{Model: req.Model}
+	resp.addTo(out)
+	out.Text = resp.Message.Content
+	return out, nil
+}
+
+// Stream reads the completion as newline-delimited JSON objects
+func (o *Ollama) Stream(ctx context.Context, req Request, onDelta func(string)) (*Response, error) {
+	body := o.request(req)
+	body.Stream = true
+	resp, err := post(ctx, o.client, o.host+"/api/chat", "", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var sb strings.Builder
+	out := &Response{Model: req.Model}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaResponse
+		if err := dec.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decode stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, errors.New(chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			sb.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		chunk.addTo(out)
+		if chunk.Done {
+			break
+		}
+	}
+	out.Text = sb.String()
+	return out, nil
+}
+
+// addTo copies the model, usage and tool calls of a response or stream
+// chunk
+func (resp ollamaResponse) addTo(out *Response) {
+	out.Model = valueOr(resp.Model, out.Model)
+	if resp.PromptEvalCount > 0 || resp.EvalCount > 0 {
+		out.Usage = Usage{InputTokens: resp.PromptEvalCount, OutputTokens: resp.EvalCount}
+	}
+	for _, tc := range resp.Message.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, ToolCall{
+			ID:        fmt.Sprintf("call_%d", len(out.ToolCalls)),
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+}
+
+func (o *Ollama) request(req Request) ollamaRequest {
+	body := ollamaRequest{Model: req.Model, Tools: openAITools(req.Tools)}
+	if req.System != "" {
+		body.Messages = append(body.Messages, ollamaMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		msg := ollamaMessage{Role: string(m.Role), Content: m.Content, ToolName: m.ToolName}
+		for _, call := range m.ToolCalls {
+			var tc ollamaToolCall
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = call.Arguments
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		body.Messages = append(body.Messages, msg)
+	}
+	if req.Temperature > 0 || req.MaxTokens > 0 {
+		body.Options = &ollamaOptions{Temperature: req.Temperature, NumPredict: req.MaxTokens}
+	}
+	return body
+}
@@ -0,0 +1,285 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAICompatible calls a server implementing OpenAI's chat completions
+// API, such as vLLM, LM Studio or llama.cpp's server. baseURL includes the
+// version prefix, e.g. http://localhost:8000/v1.
+type OpenAICompatible struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewOpenAICompatible(baseURL, apiKey string) *OpenAICompatible {
+	return &OpenAICompatible{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		// Local models can be slow to answer long prompts
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (o *OpenAICompatible) Name() string { return "openai" }
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON object
+	} `json:"function"`
+}
+
+// openAITool is also the tool format of Ollama
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Tools       []openAITool    `json:"tools,omitempty"`
+	Temperature float64         `json:"temperature,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// openAIChunk is one event of a streamed completion
+type openAIChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	// Sent in the last event
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (o *OpenAICompatible) Generate(ctx context.Context, req Request) (*Response, error) {
+	var resp openAIResponse
+	if err := postJSON(ctx, o.client, o.baseURL+"/chat/completions", o.apiKey, o.request(req), &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices")
+	}
+	msg := resp.Choices[0].Message
+	out := &Response{
+		Text:  msg.Content,
+		Model: valueOr(resp.Model, req.Model),
+		Usage: Usage{InputTokens: resp.Usage.PromptTokens, OutputTokens: resp.Usage.CompletionTokens},
+	}
+	for _, tc := range msg.ToolCalls {
+		call, err := tc.toolCall()
+		if err != nil {
+			return nil, err
+		}
+		out.ToolCalls = append(out.ToolCalls, call)
+	}
+	return out, nil
+}
+
+func (o *OpenAICompatible) request(req Request) openAIRequest {
+	body := openAIRequest{
+		Model:       req.Model,
+		Tools:       openAITools(req.Tools),
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+	}
+	if req.System != "" {
+		body.Messages = append(body.Messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		msg := openAIMessage{Role: string(m.Role), Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			tc := openAIToolCall{ID: call.ID, Type: "function"}
+			tc.Function.Name = call.Name
+			args, _ := json.Marshal(call.Arguments)
+			tc.Function.Arguments = string(args)
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		body.Messages = append(body.Messages, msg)
+	}
+	return body
+}
+
+// Stream reads the completion as server-sent events. Tool calls arrive in
+// fragments, which are joined by their index.
+func (o *OpenAICompatible) Stream(ctx context.Context, req Request, onDelta func(string)) (*Response, error) {
+	body := o.request(req)
+	body.Stream = true
+	body.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	resp, err := post(ctx, o.client, o.baseURL+"/chat/completions", o.apiKey, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var sb strings.Builder
+	var calls []openAIToolCall
+	out := &Response{Model: req.Model}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("decode stream: %w", err)
+		}
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			out.Usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			sb.WriteString(delta.Content)
+			onDelta(delta.Content)
+		}
+		for _, d := range delta.ToolCalls {
+			for len(calls) <= d.Index {
+				calls = append(calls, openAIToolCall{Type: "function"})
+			}
+			tc := &calls[d.Index]
+			if d.ID != "" {
+				tc.ID = d.ID
+			}
+			tc.Function.Name += d.Function.Name
+			tc.Function.Arguments += d.Function.Arguments
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	out.Text = sb.String()
+	for _, tc := range calls {
+		call, err := tc.toolCall()
+		if err != nil {
+			return nil, err
+		}
+		out.ToolCalls = append(out.ToolCalls, call)
+	}
+	return out, nil
+}
+
+func (tc openAIToolCall) toolCall() (ToolCall, error) {
+	var args map[string]any
+	if tc.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+			return ToolCall{}, fmt.Errorf("arguments of %s: %w", tc.Function.Name, err)
+		}
+	}
+	return ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: args}, nil
+}
+
+func openAITools(specs []ToolSpec) []openAITool {
+	var tools []openAITool
+	for _, spec := range specs {
+		t := openAITool{Type: "function"}
+		t.Function.Name = spec.Name
+		t.Function.Description = spec.Description
+		t.Function.Parameters = spec.jsonSchema()
+		tools = append(tools, t)
+	}
+	return tools
+}
+
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, in, out any) error {
+	resp, err := post(ctx, client, url, apiKey, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// post sends in as JSON and returns the response if it succeeded. The
+// caller closes the body.
+func post(ctx context.Context, client *http.Client, url, apiKey string, in any) (*http.Response, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
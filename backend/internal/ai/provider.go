@@ -0,0 +1,362 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Role of a message in a conversation
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+	// Result of a tool call, answering the assistant's previous message
+	RoleTool Role = "tool"
+)
+
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+	// Calls requested by an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Call a tool message answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	ToolName   string `json:"tool_name,omitempty"`
+}
+
+// Request is a provider-neutral completion request
+type Request struct {
+	Model    string
+	System   string
+	Messages []Message
+	// Tools the model may call instead of answering
+	Tools []ToolSpec
+	// Zero values leave the provider's defaults
+	Temperature float64
+	MaxTokens   int
+}
+
+// Usage counts the tokens of one call, when the provider reports them
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type Response struct {
+	Text      string     `json:"text"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Model     string     `json:"model"`
+	Usage     Usage      `json:"usage"`
+}
+
+// Provider generates completions with one backend, such as Gemini or a
+// local model server
+type Provider interface {
+	Name() string
+	Generate(ctx context.Context, req Request) (*Response, error)
+}
+
+// StreamingProvider is a provider that can return text as it is
+// generated. onDelta receives each fragment in order; the response holds
+// the whole text.
+type StreamingProvider interface {
+	Provider
+	Stream(ctx context.Context, req Request, onDelta func(string)) (*Response, error)
+}
+
+// Features that use a model. Each can be routed to its own provider and
+// model.
+type Feature string
+
+const (
+	FeatureRemediation  Feature = "remediation"
+	FeatureChat         Feature = "chat"
+	FeatureDependencies Feature = "dependencies"
+	// Condensing long chat conversations
+	FeatureSummary Feature = "summary"
+	// Translating questions into log queries and summarising the results
+	FeatureQuery Feature = "query"
+)
+
+var features = []Feature{FeatureRemediation, FeatureChat, FeatureDependencies, FeatureSummary, FeatureQuery}
+
+// ErrNotConfigured is returned for features without a provider. Callers
+// should disable the feature rather than fail.
+var ErrNotConfigured = errors.New("no AI provider configured")
+
+// Route selects the provider and model of a feature
+type Route struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+func (r Route) String() string { return r.Provider + ":" + r.Model }
+
+// FeatureStatus reports where a feature is routed
+type FeatureStatus struct {
+	Feature Feature `json:"feature"`
+	Enabled bool    `json:"enabled"`
+	Route   *Route  `json:"route,omitempty"`
+}
+
+// Client routes each feature's requests to its provider and model
+type Client struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+	models    map[string]string // Default model per provider
+	def       string            // Default provider
+	routes    map[Feature]Route
+	meter     *Meter
+}
+
+// NewClient creates a client without providers; every feature is disabled
+// until one is added
+func NewClient() *Client {
+	return &Client{
+		providers: make(map[string]Provider),
+		models:    make(map[string]string),
+		routes:    make(map[Feature]Route),
+	}
+}
+
+// AddProvider registers a provider with the model used when a feature
+// does not name one. The first provider added becomes the default.
+func (c *Client) AddProvider(p Provider, defaultModel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.providers[p.Name()] = p
+	c.models[p.Name()] = defaultModel
+	if c.def == "" {
+		c.def = p.Name()
+	}
+}
+
+// SetDefault selects the provider of features without a route
+func (c *Client) SetDefault(provider string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.providers[provider]; !ok {
+		return fmt.Errorf("unknown AI provider %q", provider)
+	}
+	c.def = provider
+	return nil
+}
+
+// SetRoute routes a feature. spec is "provider:model", "provider" or, on
+// the default provider, "model". Model names may contain colons, as in
+// Ollama's "llama3.1:8b".
+func (c *Client) SetRoute(feature Feature, spec string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var route Route
+	name, model, _ := strings.Cut(spec, ":")
+	if _, ok := c.providers[name]; ok {
+		route = Route{Provider: name, Model: model}
+	} else if c.def != "" {
+		route = Route{Provider: c.def, Model: spec}
+	} else {
+		return fmt.Errorf("%s: %w", feature, ErrNotConfigured)
+	}
+	if route.Model == "" {
+		route.Model = c.models[route.Provider]
+	}
+	c.routes[feature] = route
+	return nil
+}
+
+// Resolve returns the provider and model of a feature
+func (c *Client) Resolve(feature Feature) (Provider, Route, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	route, ok := c.routes[feature]
+	if !ok {
+		if c.def == "" {
+			return nil, Route{}, ErrNotConfigured
+		}
+		route = Route{Provider: c.def, Model: c.models[c.def]}
+	}
+	p, ok := c.providers[route.Provider]
+	if !ok {
+		return nil, Route{}, ErrNotConfigured
+	}
+	return p, route, nil
+}
+
+// Available reports whether a feature has a provider
+func (c *Client) Available(feature Feature) bool {
+	_, _, err := c.Resolve(feature)
+	return err == nil
+}
+
+// SetMeter caches, accounts and limits the calls of every feature; call
+// before use
+func (c *Client) SetMeter(m *Meter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.meter = m
+}
+
+// Generate sends a request to the feature's provider, filling in its
+// model
+func (c *Client) Generate(ctx context.Context, feature Feature, req Request) (*Response, error) {
+	p, route, err := c.Resolve(feature)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = route.Model
+	return c.metered(ctx, feature, route, req, nil, func() (*Response, error) {
+		return generate(ctx, p, req)
+	})
+}
+
+func generate(ctx context.Context, p Provider, req Request) (*Response, error) {
+	resp, err := p.Generate(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	if strings.TrimSpace(resp.Text) == "" && len(resp.ToolCalls) == 0 {
+		return nil, fmt.Errorf("%s: empty response", p.Name())
+	}
+	return resp, nil
+}
+
+// metered runs do through the meter, if there is one
+func (c *Client) metered(ctx context.Context, feature Feature, route Route, req Request, onDelta func(string), do func() (*Response, error)) (*Response, error) {
+	c.mu.RLock()
+	m := c.meter
+	c.mu.RUnlock()
+	if m == nil {
+		return do()
+	}
+	return m.call(ctx, feature, route, req, onDelta, do)
+}
+
+// Stream is like Generate, but passes text to onDelta as it is generated.
+// Providers that cannot stream, and cached responses, send the whole text
+// at once.
+func (c *Client) Stream(ctx context.Context, feature Feature, req Request, onDelta func(string)) (*Response, error) {
+	p, route, err := c.Resolve(feature)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = route.Model
+	return c.metered(ctx, feature, route, req, onDelta, func() (*Response, error) {
+		sp, ok := p.(StreamingProvider)
+		if !ok || onDelta == nil {
+			resp, err := generate(ctx, p, req)
+			if err == nil && onDelta != nil && resp.Text != "" {
+				onDelta(resp.Text)
+			}
+			return resp, err
+		}
+		resp, err := sp.Stream(ctx, req, onDelta)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Name(), err)
+		}
+		if strings.TrimSpace(resp.Text) == "" && len(resp.ToolCalls) == 0 {
+			return nil, fmt.Errorf("%s: empty response", p.Name())
+		}
+		return resp, nil
+	})
+}
+
+// Status lists the route of every feature
+func (c *Client) Status() []FeatureStatus {
+	out := make([]FeatureStatus, 0, len(features))
+	for _, f := range features {
+		st := FeatureStatus{Feature: f}
+		if _, route, err := c.Resolve(f); err == nil {
+			st.Enabled, st.Route = true, &route
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// Providers returns the names of the registered providers
+func (c *Client) Providers() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.providers))
+	for name := range c.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close releases providers that hold connections, such as Gemini
+func (c *Client) Close() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, p := range c.providers {
+		if closer, ok := p.(interface{ Close() error }); ok {
+			closer.Close()
+		}
+	}
+}
+
+// ClientFromEnv registers the providers that are configured:
+//   - Gemini with GEMINI_API_KEY (model GEMINI_MODEL)
+//   - an OpenAI-compatible server, such as vLLM or LM Studio, with
+//     OPENAI_BASE_URL and optionally OPENAI_API_KEY (model OPENAI_MODEL)
+//   - Ollama with OLLAMA_HOST (model OLLAMA_MODEL)
+//   - the mock provider when AI_PROVIDER is mock
+//
+// AI_PROVIDER selects the default provider, or none to disable AI, and
+// AI_MODEL_<FEATURE> routes a feature, e.g. AI_MODEL_CHAT=ollama:llama3.1.
+// getenv looks up settings, so secrets can come from a secrets manager.
+func ClientFromEnv(getenv func(string) string) (*Client, error) {
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	c := NewClient()
+	def := getenv("AI_PROVIDER")
+	if def == "none" {
+		return c, nil
+	}
+
+	if key := getenv("GEMINI_API_KEY"); key != "" {
+		p, err := NewGemini(context.Background(), key)
+		if err != nil {
+			return c, err
+		}
+		c.AddProvider(p, valueOr(getenv("GEMINI_MODEL"), "gemini-1.5-flash"))
+	}
+	if base := getenv("OPENAI_BASE_URL"); base != "" {
+		c.AddProvider(NewOpenAICompatible(base, getenv("OPENAI_API_KEY")), getenv("OPENAI_MODEL"))
+	}
+	if host := getenv("OLLAMA_HOST"); host != "" || def == "ollama" {
+		c.AddProvider(NewOllama(valueOr(host, "http://localhost:11434")), valueOr(getenv("OLLAMA_MODEL"), "llama3.1"))
+	}
+	if def == "mock" {
+		c.AddProvider(NewMock(), "mock")
+	}
+
+	if def != "" {
+		if err := c.SetDefault(def); err != nil {
+			return c, err
+		}
+	}
+	for _, f := range features {
+		if spec := getenv("AI_MODEL_" + strings.ToUpper(string(f))); spec != "" {
+			if err := c.SetRoute(f, spec); err != nil {
+				return c, err
+			}
+		}
+	}
+	return c, nil
+}
+
+func valueOr(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,160 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestOpenAICompatible_Generate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var req openAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "qwen2.5-coder", req.Model)
+		assert.Equal(t, []openAIMessage{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}}, req.Messages)
+		w.Write([]byte(`{"model":"qwen2.5-coder","choices":[{"message":{"role":"assistant","content":"hello"}}],"usage":{"prompt_tokens":7,"completion_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAICompatible(srv.URL+"/v1/", "secret")
+	resp, err := p.Generate(context.Background(), Request{
+		Model:    "qwen2.5-coder",
+		System:   "be brief",
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Text)
+	assert.Equal(t, Usage{InputTokens: 7, OutputTokens: 1}, resp.Usage)
+}
+
+func TestOllama_Generate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		var req ollamaRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.False(t, req.Stream)
+		assert.Equal(t, "llama3.1:8b", req.Model)
+		w.Write([]byte(`{"model":"llama3.1:8b","message":{"role":"assistant","content":"fixed"},"prompt_eval_count":12,"eval_count":3}`))
+	}))
+	defer srv.Close()
+
+	resp, err := NewOllama(srv.URL).Generate(context.Background(), Request{
+		Model:    "llama3.1:8b",
+		Messages: []Message{{Role: RoleUser, Content: "fix it"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "fixed", resp.Text)
+	assert.Equal(t, 12, resp.Usage.InputTokens)
+
+	// Server errors carry the status and body
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `model "x" not found`, http.StatusNotFound)
+	}))
+	defer failing.Close()
+	_, err = NewOllama(failing.URL).Generate(context.Background(), Request{Model: "x", Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
+
+func TestOpenAICompatible_Stream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"model":"mistral","choices":[{"delta":{"role":"assistant","content":"Looking"}}]}`,
+			`{"choices":[{"delta":{"content":" it up"}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","function":{"name":"list_scans","arguments":"{\"since\""}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"24h\"}"}}]}}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":20,"completion_tokens":9}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}))
+	defer srv.Close()
+
+	var deltas []string
+	resp, err := NewOpenAICompatible(srv.URL, "").Stream(context.Background(), Request{
+		Model:    "mistral",
+		Messages: []Message{{Role: RoleUser, Content: "scans today?"}},
+	}, func(s string) { deltas = append(deltas, s) })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Looking", " it up"}, deltas)
+	assert.Equal(t, "Looking it up", resp.Text)
+	assert.Equal(t, []ToolCall{{ID: "call_a", Name: "list_scans", Arguments: map[string]any{"since": "24h"}}}, resp.ToolCalls)
+	assert.Equal(t, Usage{InputTokens: 20, OutputTokens: 9}, resp.Usage)
+}
+
+func TestOllama_Stream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		w.Write([]byte(`{"model":"llama3.1","message":{"role":"assistant","content":"Patch"},"done":false}
+{"model":"llama3.1","message":{"role":"assistant","content":" now."},"done":false}
+{"model":"llama3.1","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":30,"eval_count":2}
+`))
+	}))
+	defer srv.Close()
+
+	var deltas []string
+	resp, err := NewOllama(srv.URL).Stream(context.Background(), Request{
+		Model:    "llama3.1",
+		Messages: []Message{{Role: RoleUser, Content: "what now?"}},
+	}, func(s string) { deltas = append(deltas, s) })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Patch", " now."}, deltas)
+	assert.Equal(t, "Patch now.", resp.Text)
+	assert.Equal(t, Usage{InputTokens: 30, OutputTokens: 2}, resp.Usage)
+}
+
+func TestClientFromEnv_Routes(t *testing.T) {
+	env := map[string]string{
+		"AI_PROVIDER":          "ollama",
+		"OLLAMA_HOST":          "http://ollama:11434",
+		"OPENAI_BASE_URL":      "http://vllm:8000/v1",
+		"OPENAI_MODEL":         "mistral",
+		"AI_MODEL_CHAT":        "llama3.1:70b",
+		"AI_MODEL_REMEDIATION": "openai:qwen2.5-coder",
+	}
+	llm, err := ClientFromEnv(func(k string) string { return env[k] })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ollama", "openai"}, llm.Providers())
+
+	_, route, err := llm.Resolve(FeatureChat)
+	require.NoError(t, err)
+	assert.Equal(t, Route{Provider: "ollama", Model: "llama3.1:70b"}, route, "model names may contain colons")
+	_, route, _ = llm.Resolve(FeatureRemediation)
+	assert.Equal(t, Route{Provider: "openai", Model: "qwen2.5-coder"}, route)
+	_, route, _ = llm.Resolve(FeatureDependencies)
+	assert.Equal(t, Route{Provider: "ollama", Model: "llama3.1"}, route, "unrouted features use the default provider")
+
+	_, err = ClientFromEnv(func(k string) string { return map[string]string{"AI_PROVIDER": "gemini"}[k] })
+	assert.Error(t, err, "selecting a provider that is not configured")
+}
+
+func TestClientFromEnv_Disabled(t *testing.T) {
+	llm, err := ClientFromEnv(func(string) string { return "" })
+	require.NoError(t, err)
+	for _, st := range llm.Status() {
+		assert.False(t, st.Enabled, st.Feature)
+	}
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	_, err = NewChatEngine(llm, db).ProcessQuery(context.Background(), ChatRequest{Message: "status?"})
+	assert.True(t, errors.Is(err, ErrNotConfigured))
+}
@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ToolSpec describes a function the model may call
+type ToolSpec struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Params      []Param `json:"params"`
+}
+
+// Param is one argument of a tool. Type is string, integer, number or
+// boolean.
+type Param struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Required    bool     `json:"required,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// jsonSchema returns the parameters as the JSON Schema object used by the
+// OpenAI and Ollama APIs
+func (s ToolSpec) jsonSchema() map[string]any {
+	props := make(map[string]any, len(s.Params))
+	required := []string{}
+	for _, p := range s.Params {
+		prop := map[string]any{"type": p.Type, "description": p.Description}
+		if len(p.Enum) > 0 {
+			prop["enum"] = p.Enum
+		}
+		props[p.Name] = prop
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+// ToolCall is a call requested by the model
+type ToolCall struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// Tool is a read-only function the chat assistant can run
+type Tool struct {
+	Spec ToolSpec
+	Run  func(ctx context.Context, args Args) (ToolResult, error)
+}
+
+// ToolResult is returned to the model as JSON. Citations identify the
+// records in Data, e.g. "finding:42".
+type ToolResult struct {
+	Data      any      `json:"data"`
+	Citations []string `json:"citations,omitempty"`
+}
+
+// Args reads the arguments of a tool call, which models do not always
+// type correctly
+type Args map[string]any
+
+func (a Args) String(name string) string {
+	switch v := a[name].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Int returns the argument, or def if it is missing or not a number
+func (a Args) Int(name string, def int) int {
+	switch v := a[name].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// Time parses an RFC 3339 time, a date, or a duration before now such as
+// "12h"
+func (a Args) Time(name string, now time.Time) (time.Time, bool, error) {
+	s := a.String(name)
+	if s == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, true, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%s: expected an RFC 3339 time, a date or a duration, got %q", name, s)
+}
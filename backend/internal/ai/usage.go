@@ -0,0 +1,515 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// DefaultOrg is the organisation of calls made without one, including
+// background jobs
+const DefaultOrg = "default"
+
+// Caller identifies who a model call is made for
+type Caller struct {
+	UserID string // Empty for background jobs
+	OrgID  string
+}
+
+type callerKey struct{}
+
+// WithCaller attributes the model calls made with ctx to caller
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFrom returns the caller of ctx, in DefaultOrg if none was set
+func CallerFrom(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey{}).(Caller)
+	if caller.OrgID == "" {
+		caller.OrgID = DefaultOrg
+	}
+	return caller
+}
+
+// UsageRecord is one model call. Cached calls were answered from the
+// cache and cost nothing.
+type UsageRecord struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+	UserID       string    `json:"user_id" gorm:"index"`
+	OrgID        string    `json:"org_id" gorm:"index"`
+	Feature      Feature   `json:"feature"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cost         float64   `json:"cost"` // USD
+	Cached       bool      `json:"cached"`
+}
+
+// Scopes of a budget
+const (
+	ScopeOrg  = "org"
+	ScopeUser = "user"
+)
+
+// Budget limits the model usage of an organisation or a user. Zero
+// fields are unlimited. A Budget with an empty Subject is the default for
+// its scope.
+type Budget struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	Scope             string    `json:"scope" gorm:"uniqueIndex:idx_ai_budget;not null"`
+	Subject           string    `json:"subject" gorm:"uniqueIndex:idx_ai_budget"` // Organisation or user ID
+	MonthlyTokens     int64     `json:"monthly_tokens"`
+	MonthlyCost       float64   `json:"monthly_cost"` // USD
+	RequestsPerMinute int       `json:"requests_per_minute"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func (Budget) TableName() string { return "ai_budgets" }
+
+var (
+	ErrBudgetExceeded = errors.New("AI budget exceeded")
+	ErrRateLimited    = errors.New("AI request quota exceeded")
+	ErrInvalidBudget  = errors.New("invalid budget")
+)
+
+// LimitError explains which budget or quota stopped a call. It wraps
+// ErrBudgetExceeded or ErrRateLimited.
+type LimitError struct {
+	Err        error
+	Scope      string
+	Subject    string
+	Detail     string
+	RetryAfter time.Duration // Until the quota or budget allows calls again
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v for %s %s: %s", e.Err, e.Scope, e.Subject, e.Detail)
+}
+
+func (e *LimitError) Unwrap() error { return e.Err }
+
+// Price of a model in USD per million tokens
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// ParsePrices reads "openai:gpt-4o=2.5/10,gemini-1.5-flash=0.075/0.3".
+// A price is looked up by provider:model, then by model.
+func ParsePrices(spec string) (map[string]Price, error) {
+	prices := make(map[string]Price)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, price, ok := strings.Cut(entry, "=")
+		in, out, ok2 := strings.Cut(price, "/")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("price %q: expected model=input/output", entry)
+		}
+		p := Price{}
+		var err error
+		if p.Input, err = strconv.ParseFloat(in, 64); err != nil {
+			return nil, fmt.Errorf("price %q: %w", entry, err)
+		}
+		if p.Output, err = strconv.ParseFloat(out, 64); err != nil {
+			return nil, fmt.Errorf("price %q: %w", entry, err)
+		}
+		prices[strings.TrimSpace(model)] = p
+	}
+	return prices, nil
+}
+
+// Meter caches model responses and accounts and limits the calls of a
+// Client. Budgets are checked before a call, so the call that crosses a
+// budget completes.
+type Meter struct {
+	db      *gorm.DB
+	rdb     *redis.Client // nil disables the cache
+	limiter ratelimit.Limiter
+	prices  map[string]Price
+	now     func() time.Time
+	// The cache is skipped for cacheBackoff after a Redis error
+	mu            sync.Mutex
+	cacheFailedAt time.Time
+	// Responses are cached for CacheTTL; zero disables the cache
+	CacheTTL time.Duration
+	// Prefix of the cache keys in Redis
+	CachePrefix string
+}
+
+func NewMeter(db *gorm.DB, rdb *redis.Client, limiter ratelimit.Limiter, prices map[string]Price) *Meter {
+	if prices == nil {
+		prices = make(map[string]Price)
+	}
+	return &Meter{
+		db:          db,
+		rdb:         rdb,
+		limiter:     limiter,
+		prices:      prices,
+		now:         time.Now,
+		CacheTTL:    24 * time.Hour,
+		CachePrefix: "cybershield:ai:cache:",
+	}
+}
+
+func (m *Meter) price(route Route) Price {
+	if p, ok := m.prices[route.String()]; ok {
+		return p
+	}
+	return m.prices[route.Model]
+}
+
+// call answers req from the cache, or checks the caller's limits, runs do
+// and records its usage
+func (m *Meter) call(ctx context.Context, feature Feature, route Route, req Request, onDelta func(string), do func() (*Response, error)) (*Response, error) {
+	caller := CallerFrom(ctx)
+	key := m.cacheKey(route, req)
+	if resp := m.cached(ctx, key); resp != nil {
+		if onDelta != nil && resp.Text != "" {
+			onDelta(resp.Text)
+		}
+		m.record(caller, feature, route, resp.Usage, true)
+		return resp, nil
+	}
+
+	if err := m.check(ctx, caller); err != nil {
+		return nil, err
+	}
+	resp, err := do()
+	if err != nil {
+		return nil, err
+	}
+	usage := resp.Usage
+	// Not every provider reports usage
+	if usage.InputTokens == 0 && usage.OutputTokens == 0 {
+		usage = estimateUsage(req, resp)
+	}
+	m.record(caller, feature, route, usage, false)
+	m.store(ctx, key, resp)
+	return resp, nil
+}
+
+func estimateUsage(req Request, resp *Response) Usage {
+	in := EstimateTokens(req.System)
+	for _, msg := range req.Messages {
+		in += EstimateTokens(msg.Content)
+	}
+	out := EstimateTokens(resp.Text)
+	for _, call := range resp.ToolCalls {
+		args, _ := json.Marshal(call.Arguments)
+		out += EstimateTokens(call.Name + string(args))
+	}
+	return Usage{InputTokens: in, OutputTokens: out}
+}
+
+func (m *Meter) record(caller Caller, feature Feature, route Route, usage Usage, cached bool) {
+	rec := UsageRecord{
+		CreatedAt:    m.now(),
+		UserID:       caller.UserID,
+		OrgID:        caller.OrgID,
+		Feature:      feature,
+		Provider:     route.Provider,
+		Model:        route.Model,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		Cached:       cached,
+	}
+	if !cached {
+		p := m.price(route)
+		rec.Cost = (float64(usage.InputTokens)*p.Input + float64(usage.OutputTokens)*p.Output) / 1e6
+	}
+	if err := m.db.Create(&rec).Error; err != nil {
+		slog.Warn("Failed to record AI usage", "error", err)
+	}
+}
+
+// cacheKey hashes the input of a request with whitespace normalised, so
+// the same prompt formatted differently shares an entry
+func (m *Meter) cacheKey(route Route, req Request) string {
+	normalised := struct {
+		Route       string
+		System      string
+		Messages    []Message
+		Tools       []ToolSpec
+		Temperature float64
+		MaxTokens   int
+	}{route.String(), normalise(req.System), make([]Message, len(req.Messages)), req.Tools, req.Temperature, req.MaxTokens}
+	for i, msg := range req.Messages {
+		msg.Content = normalise(msg.Content)
+		normalised.Messages[i] = msg
+	}
+	data, _ := json.Marshal(normalised)
+	sum := sha256.Sum256(data)
+	return m.CachePrefix + hex.EncodeToString(sum[:])
+}
+
+func normalise(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Time to wait before using the cache again after a failure
+const cacheBackoff = 30 * time.Second
+
+// cacheUsable reports whether the cache is configured and Redis has not
+// failed recently
+func (m *Meter) cacheUsable() bool {
+	if m.rdb == nil || m.CacheTTL <= 0 {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return time.Since(m.cacheFailedAt) >= cacheBackoff
+}
+
+// cacheFailed logs a Redis error and skips the cache for a while, so an
+// outage costs one warning and no extra latency per call
+func (m *Meter) cacheFailed(msg string, err error) {
+	slog.Warn(msg, "error", err)
+	m.mu.Lock()
+	m.cacheFailedAt = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *Meter) cached(ctx context.Context, key string) *Response {
+	if !m.cacheUsable() {
+		return nil
+	}
+	data, err := m.rdb.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			m.cacheFailed("AI cache lookup failed, skipping the cache", err)
+		}
+		return nil
+	}
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil
+	}
+	return &resp
+}
+
+func (m *Meter) store(ctx context.Context, key string, resp *Response) {
+	if !m.cacheUsable() {
+		return
+	}
+	data, _ := json.Marshal(resp)
+	if err := m.rdb.Set(ctx, key, data, m.CacheTTL).Err(); err != nil {
+		m.cacheFailed("AI cache update failed, skipping the cache", err)
+	}
+}
+
+// monthStart returns the start of the calendar month of t, in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// check returns a LimitError if the caller's organisation or the caller
+// is over a quota or budget
+func (m *Meter) check(ctx context.Context, caller Caller) error {
+	subjects := []struct{ scope, subject string }{{ScopeOrg, caller.OrgID}}
+	if caller.UserID != "" {
+		subjects = append(subjects, struct{ scope, subject string }{ScopeUser, caller.UserID})
+	}
+	for _, s := range subjects {
+		budget, err := m.budgetFor(s.scope, s.subject)
+		if err != nil {
+			return err
+		}
+		if budget == nil {
+			continue
+		}
+		if err := m.checkBudget(budget, s.scope, s.subject); err != nil {
+			return err
+		}
+		if budget.RequestsPerMinute > 0 && m.limiter != nil {
+			limit := ratelimit.Limit{Rate: budget.RequestsPerMinute, Period: time.Minute}
+			res, err := m.limiter.Allow(ctx, "ai:"+s.scope+":"+s.subject, limit)
+			if err != nil {
+				slog.Warn("AI quota check failed", "error", err)
+				continue
+			}
+			if !res.Allowed {
+				return &LimitError{Err: ErrRateLimited, Scope: s.scope, Subject: s.subject,
+					Detail: fmt.Sprintf("at most %d requests per minute", budget.RequestsPerMinute), RetryAfter: res.RetryAfter}
+			}
+		}
+	}
+	return nil
+}
+
+// budgetFor returns the budget of a subject, or else the default of its
+// scope, or nil
+func (m *Meter) budgetFor(scope, subject string) (*Budget, error) {
+	var budgets []Budget
+	err := m.db.Where("scope = ? AND subject IN ?", scope, []string{subject, ""}).Find(&budgets).Error
+	if err != nil {
+		return nil, err
+	}
+	var def *Budget
+	for i := range budgets {
+		if budgets[i].Subject == subject {
+			return &budgets[i], nil
+		}
+		def = &budgets[i]
+	}
+	return def, nil
+}
+
+func (m *Meter) checkBudget(budget *Budget, scope, subject string) error {
+	if budget.MonthlyTokens <= 0 && budget.MonthlyCost <= 0 {
+		return nil
+	}
+	now := m.now()
+	start := monthStart(now)
+	column := "org_id"
+	if scope == ScopeUser {
+		column = "user_id"
+	}
+	var used struct {
+		Tokens int64
+		Cost   float64
+	}
+	err := m.db.Model(&UsageRecord{}).
+		Select("COALESCE(SUM(input_tokens + output_tokens), 0) AS tokens, COALESCE(SUM(cost), 0) AS cost").
+		Where(column+" = ? AND created_at >= ? AND cached = ?", subject, start, false).
+		Scan(&used).Error
+	if err != nil {
+		return err
+	}
+
+	reset := start.AddDate(0, 1, 0)
+	exceeded := func(detail string) error {
+		return &LimitError{Err: ErrBudgetExceeded, Scope: scope, Subject: subject,
+			Detail: detail + "; it resets on " + reset.Format("2006-01-02"), RetryAfter: reset.Sub(now)}
+	}
+	if budget.MonthlyTokens > 0 && used.Tokens >= budget.MonthlyTokens {
+		return exceeded(fmt.Sprintf("%d of %d monthly tokens used", used.Tokens, budget.MonthlyTokens))
+	}
+	if budget.MonthlyCost > 0 && used.Cost >= budget.MonthlyCost {
+		return exceeded(fmt.Sprintf("$%.2f of $%.2f monthly budget used", used.Cost, budget.MonthlyCost))
+	}
+	return nil
+}
+
+// Budgets lists the configured budgets
+func (m *Meter) Budgets() ([]Budget, error) {
+	var budgets []Budget
+	err := m.db.Order("scope, subject").Find(&budgets).Error
+	return budgets, err
+}
+
+// SetBudget creates or replaces the budget of b.Scope and b.Subject
+func (m *Meter) SetBudget(b *Budget) error {
+	if b.Scope != ScopeOrg && b.Scope != ScopeUser {
+		return fmt.Errorf("%w: scope must be %s or %s", ErrInvalidBudget, ScopeOrg, ScopeUser)
+	}
+	if b.MonthlyTokens < 0 || b.MonthlyCost < 0 || b.RequestsPerMinute < 0 {
+		return fmt.Errorf("%w: limits cannot be negative", ErrInvalidBudget)
+	}
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		var existing Budget
+		err := tx.Where("scope = ? AND subject = ?", b.Scope, b.Subject).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		b.ID = existing.ID
+		return tx.Save(b).Error
+	})
+}
+
+// DeleteBudget removes a budget; the subject falls back to the default of
+// its scope
+func (m *Meter) DeleteBudget(scope, subject string) error {
+	return m.db.Where("scope = ? AND subject = ?", scope, subject).Delete(&Budget{}).Error
+}
+
+// UsageFilter selects usage records. Zero fields match everything.
+type UsageFilter struct {
+	From   time.Time
+	To     time.Time
+	UserID string
+	OrgID  string
+}
+
+// UsageRow sums the usage of one group
+type UsageRow struct {
+	Key          string  `json:"key"`
+	Requests     int64   `json:"requests"`
+	Cached       int64   `json:"cached"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// UsageReport sums usage in a period, overall and per group
+type UsageReport struct {
+	From    time.Time  `json:"from"`
+	To      time.Time  `json:"to"`
+	GroupBy string     `json:"group_by"`
+	Total   UsageRow   `json:"total"`
+	Rows    []UsageRow `json:"rows"`
+}
+
+// Columns usage can be grouped by
+var usageGroups = map[string]string{
+	"user": "user_id", "org": "org_id", "feature": "feature", "model": "model", "provider": "provider",
+	"day": "DATE(created_at)",
+}
+
+// Report sums the usage matching filter, grouped by user, org, feature,
+// model, provider or day
+func (m *Meter) Report(filter UsageFilter, groupBy string) (*UsageReport, error) {
+	column, ok := usageGroups[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("cannot group usage by %q", groupBy)
+	}
+	if m.db.Dialector.Name() == "postgres" && groupBy == "day" {
+		column = "TO_CHAR(created_at, 'YYYY-MM-DD')"
+	}
+	q := func() *gorm.DB {
+		q := m.db.Model(&UsageRecord{})
+		if !filter.From.IsZero() {
+			q = q.Where("created_at >= ?", filter.From)
+		}
+		if !filter.To.IsZero() {
+			q = q.Where("created_at < ?", filter.To)
+		}
+		if filter.UserID != "" {
+			q = q.Where("user_id = ?", filter.UserID)
+		}
+		if filter.OrgID != "" {
+			q = q.Where("org_id = ?", filter.OrgID)
+		}
+		return q
+	}
+	const sums = "COUNT(*) AS requests, COALESCE(SUM(CASE WHEN cached THEN 1 ELSE 0 END), 0) AS cached, " +
+		"COALESCE(SUM(input_tokens), 0) AS input_tokens, COALESCE(SUM(output_tokens), 0) AS output_tokens, COALESCE(SUM(cost), 0) AS cost"
+
+	report := &UsageReport{From: filter.From, To: filter.To, GroupBy: groupBy, Rows: []UsageRow{}}
+	if err := q().Select(sums).Scan(&report.Total).Error; err != nil {
+		return nil, err
+	}
+	err := q().Select(column + " AS key, " + sums).Group(column).Order("cost DESC, requests DESC").Scan(&report.Rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
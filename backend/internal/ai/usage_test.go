@@ -0,0 +1,181 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cybershield-ai/core/internal/ratelimit"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newMeteredClient(t *testing.T, prices map[string]Price) (*Client, *Mock, *Meter) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&UsageRecord{}, &Budget{}))
+
+	mr := miniredis.RunT(t)
+	meter := NewMeter(db, redis.NewClient(&redis.Options{Addr: mr.Addr()}), ratelimit.NewMemoryLimiter(), prices)
+	llm := NewClient()
+	mock := NewMock()
+	llm.AddProvider(mock, "m")
+	llm.SetMeter(meter)
+	return llm, mock, meter
+}
+
+func TestMeter_Cache(t *testing.T) {
+	llm, mock, meter := newMeteredClient(t, nil)
+	ctx := WithCaller(context.Background(), Caller{UserID: "7"})
+	mock.Reply("patch", "upgrade log4j")
+
+	first, err := llm.Generate(ctx, FeatureChat, Request{Messages: []Message{{Role: RoleUser, Content: "What should I  patch?"}}})
+	require.NoError(t, err)
+	var streamed string
+	second, err := llm.Stream(ctx, FeatureChat, Request{Messages: []Message{{Role: RoleUser, Content: " What should I patch?\n"}}},
+		func(s string) { streamed += s })
+	require.NoError(t, err)
+
+	assert.Len(t, mock.Requests(), 1, "whitespace does not change the cache key")
+	assert.Equal(t, first.Text, second.Text)
+	assert.Equal(t, "upgrade log4j", streamed)
+
+	_, err = llm.Generate(ctx, FeatureChat, Request{Messages: []Message{{Role: RoleUser, Content: "What should I patch today?"}}})
+	require.NoError(t, err)
+	assert.Len(t, mock.Requests(), 2)
+
+	report, err := meter.Report(UsageFilter{UserID: "7"}, "org")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), report.Total.Requests)
+	assert.Equal(t, int64(1), report.Total.Cached)
+	require.Len(t, report.Rows, 1)
+	assert.Equal(t, DefaultOrg, report.Rows[0].Key)
+}
+
+func TestMeter_CacheSkippedWhileRedisIsDown(t *testing.T) {
+	llm, mock, meter := newMeteredClient(t, nil)
+	mr := miniredis.RunT(t)
+	meter.rdb = redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	mr.Close()
+
+	ctx := context.Background()
+	req := Request{Messages: []Message{{Role: RoleUser, Content: "What should I patch?"}}}
+	_, err := llm.Generate(ctx, FeatureChat, req)
+	require.NoError(t, err)
+	assert.False(t, meter.cacheUsable(), "a Redis error skips the cache")
+	_, err = llm.Generate(ctx, FeatureChat, req)
+	require.NoError(t, err)
+	assert.Len(t, mock.Requests(), 2)
+
+	meter.cacheFailedAt = time.Now().Add(-cacheBackoff)
+	assert.True(t, meter.cacheUsable(), "the cache is tried again after the backoff")
+}
+
+func TestMeter_TokenBudget(t *testing.T) {
+	llm, _, meter := newMeteredClient(t, nil)
+	meter.CacheTTL = 0
+	require.NoError(t, meter.SetBudget(&Budget{Scope: ScopeUser, MonthlyTokens: 5}))
+	alice := WithCaller(context.Background(), Caller{UserID: "alice"})
+	bob := WithCaller(context.Background(), Caller{UserID: "bob"})
+	req := Request{Messages: []Message{{Role: RoleUser, Content: "one two three four five six"}}}
+
+	_, err := llm.Generate(alice, FeatureChat, req)
+	require.NoError(t, err)
+	_, err = llm.Generate(alice, FeatureChat, req)
+	require.ErrorIs(t, err, ErrBudgetExceeded)
+	var limit *LimitError
+	require.True(t, errors.As(err, &limit))
+	assert.Equal(t, ScopeUser, limit.Scope)
+	assert.Equal(t, "alice", limit.Subject)
+	assert.Positive(t, limit.RetryAfter)
+
+	_, err = llm.Generate(bob, FeatureChat, req)
+	assert.NoError(t, err, "the default applies to each user separately")
+
+	// A user's own budget overrides the default
+	require.NoError(t, meter.SetBudget(&Budget{Scope: ScopeUser, Subject: "alice", MonthlyTokens: 1000}))
+	_, err = llm.Generate(alice, FeatureChat, req)
+	assert.NoError(t, err)
+	budgets, err := meter.Budgets()
+	require.NoError(t, err)
+	assert.Len(t, budgets, 2)
+}
+
+func TestMeter_CostBudget(t *testing.T) {
+	llm, _, meter := newMeteredClient(t, map[string]Price{"mock:m": {Input: 1e6, Output: 1e6}})
+	meter.CacheTTL = 0
+	require.NoError(t, meter.SetBudget(&Budget{Scope: ScopeOrg, Subject: DefaultOrg, MonthlyCost: 5}))
+	ctx := context.Background()
+	req := Request{Messages: []Message{{Role: RoleUser, Content: "one two three four five six"}}}
+
+	_, err := llm.Generate(ctx, FeatureRemediation, req)
+	require.NoError(t, err)
+	report, err := meter.Report(UsageFilter{}, "feature")
+	require.NoError(t, err)
+	require.Len(t, report.Rows, 1)
+	assert.Equal(t, string(FeatureRemediation), report.Rows[0].Key)
+	assert.InDelta(t, float64(report.Total.InputTokens+report.Total.OutputTokens), report.Total.Cost, 0.001)
+
+	_, err = llm.Generate(ctx, FeatureRemediation, req)
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+}
+
+func TestMeter_RequestsPerMinute(t *testing.T) {
+	llm, mock, meter := newMeteredClient(t, nil)
+	meter.CacheTTL = 0
+	require.NoError(t, meter.SetBudget(&Budget{Scope: ScopeOrg, RequestsPerMinute: 2}))
+	ctx := context.Background()
+	req := Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+
+	for i := 0; i < 2; i++ {
+		_, err := llm.Generate(ctx, FeatureChat, req)
+		require.NoError(t, err)
+	}
+	_, err := llm.Generate(ctx, FeatureChat, req)
+	require.ErrorIs(t, err, ErrRateLimited)
+	var limit *LimitError
+	require.True(t, errors.As(err, &limit))
+	assert.Positive(t, limit.RetryAfter)
+	assert.Len(t, mock.Requests(), 2)
+}
+
+func TestMeter_SetBudgetValidates(t *testing.T) {
+	_, _, meter := newMeteredClient(t, nil)
+	assert.ErrorIs(t, meter.SetBudget(&Budget{Scope: "team"}), ErrInvalidBudget)
+	assert.ErrorIs(t, meter.SetBudget(&Budget{Scope: ScopeUser, MonthlyTokens: -1}), ErrInvalidBudget)
+}
+
+func TestMeter_ReportByDay(t *testing.T) {
+	llm, _, meter := newMeteredClient(t, nil)
+	meter.CacheTTL = 0
+	day := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	meter.now = func() time.Time { return day }
+	_, err := llm.Generate(context.Background(), FeatureChat, Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	require.NoError(t, err)
+
+	report, err := meter.Report(UsageFilter{From: day.Add(-time.Hour)}, "day")
+	require.NoError(t, err)
+	require.Len(t, report.Rows, 1)
+	assert.Equal(t, "2026-03-14", report.Rows[0].Key)
+
+	_, err = meter.Report(UsageFilter{}, "colour")
+	assert.Error(t, err)
+}
+
+func TestParsePrices(t *testing.T) {
+	prices, err := ParsePrices("openai:gpt-4o=2.5/10, llama3.1=0/0")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Price{"openai:gpt-4o": {Input: 2.5, Output: 10}, "llama3.1": {}}, prices)
+
+	_, err = ParsePrices("gpt-4o=2.5")
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/auth"
+	"github.com/cybershield-ai/core/internal/mailer"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	verificationTokenTTL = 48 * time.Hour
+	resetTokenTTL        = 30 * time.Minute
+)
+
+var appBaseURL = getEnv("APP_BASE_URL", "http://localhost:5173")
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (s *Server) verifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := s.tokenStore.Redeem(req.Token, auth.PurposeEmailVerification)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	if err := s.userStore.MarkEmailVerified(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+func (s *Server) resendVerification(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(string)
+
+	user, err := s.userStore.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusOK, gin.H{"message": "Email already verified"})
+		return
+	}
+
+	s.sendVerificationEmail(user)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+func (s *Server) forgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Same answer whether or not the account exists, to avoid enumeration
+	if user, err := s.userStore.GetUserByUsername(req.Email); err == nil {
+		token, err := s.tokenStore.Issue(user.ID, auth.PurposePasswordReset, resetTokenTTL)
+		if err != nil {
+			slog.Error("Failed to issue reset token", "error", err)
+		} else {
+			s.sendEmail(mailer.TemplatePasswordReset, user.Email, gin.H{
+				"Name":      displayName(user),
+				"Link":      appBaseURL + "/reset-password?token=" + url.QueryEscape(token),
+				"ExpiresIn": "30 minutes",
+			})
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a reset link has been sent"})
+}
+
+func (s *Server) resetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Checked, not spent, so a password the policy rejects doesn't cost the
+	// user their link
+	userID, err := s.tokenStore.Check(req.Token, auth.PurposePasswordReset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+
+	user, err := s.userStore.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+
+	if err := s.passwordPolicy.Validate(req.Password, user.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.userStore.ResetPassword(s.tokenStore, req.Token, req.Password); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Clicking the emailed link proves ownership of the address
+	if !user.EmailVerified {
+		s.userStore.MarkEmailVerified(user.ID)
+	}
+
+	s.sendEmail(mailer.TemplatePasswordChanged, user.Email, gin.H{
+		"Name":      displayName(user),
+		"ChangedAt": time.Now().UTC().Format(time.RFC1123),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated. Please sign in again."})
+}
+
+func (s *Server) sendVerificationEmail(user *auth.User) {
+	token, err := s.tokenStore.Issue(user.ID, auth.PurposeEmailVerification, verificationTokenTTL)
+	if err != nil {
+		slog.Error("Failed to issue verification token", "error", err)
+		return
+	}
+	s.sendEmail(mailer.TemplateVerifyEmail, user.Email, gin.H{
+		"Name":      displayName(user),
+		"Link":      appBaseURL + "/verify-email?token=" + url.QueryEscape(token),
+		"ExpiresIn": "48 hours",
+	})
+}
+
+func (s *Server) sendEmail(template, to string, data any) {
+	deliverEmail(s.mailer, template, to, data)
+}
+
+// deliverEmail renders and sends in the background so SMTP latency never
+// shows up in response times
+func deliverEmail(m mailer.Mailer, template, to string, data any) {
+	msg, err := mailer.Render(template, to, data)
+	if err != nil {
+		slog.Error("Failed to render email", "template", template, "error", err)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := m.Send(ctx, msg); err != nil {
+			slog.Error("Failed to send email", "template", template, "error", err)
+		}
+	}()
+}
+
+func displayName(user *auth.User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+	return user.Email
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/cache"
+	"github.com/cybershield-ai/core/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newAIMeter accounts model calls with the prices of AI_PRICES and caches
+// responses in Redis for AI_CACHE_TTL (default 24h, 0 disables)
+func newAIMeter(db *gorm.DB, limiter ratelimit.Limiter) *ai.Meter {
+	prices, err := ai.ParsePrices(os.Getenv("AI_PRICES"))
+	if err != nil {
+		slog.Error("Invalid AI_PRICES, costs will be zero", "error", err)
+	}
+	meter := ai.NewMeter(db, cache.RDB, limiter, prices)
+	if v := os.Getenv("AI_CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Error("Invalid AI_CACHE_TTL, using the default", "error", err)
+		} else {
+			meter.CacheTTL = ttl
+		}
+	}
+	return meter
+}
+
+// withAICaller attributes the model calls of a request to its user. Until
+// organisations are modelled every user is in ai.DefaultOrg.
+func withAICaller(c *gin.Context) {
+	caller := ai.Caller{UserID: currentUserID(c), OrgID: c.GetString("OrgID")}
+	c.Request = c.Request.WithContext(ai.WithCaller(c.Request.Context(), caller))
+	c.Next()
+}
+
+// aiLimitError responds to a call stopped by a budget or quota, and
+// reports whether err was one
+func aiLimitError(c *gin.Context, err error) bool {
+	var limit *ai.LimitError
+	if !errors.As(err, &limit) {
+		return false
+	}
+	if limit.RetryAfter > 0 {
+		c.Header("Retry-After", ratelimit.Seconds(limit.RetryAfter))
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": limit.Error()})
+	return true
+}
+
+func isAdmin(c *gin.Context) bool {
+	role, _ := c.Get("role")
+	return role == "admin"
+}
+
+// getAIUsage reports model usage between ?from and ?to (RFC 3339 or
+// dates, default the current month) grouped by ?group_by: user (default),
+// org, feature, model, provider or day. Users other than admins only see
+// their own usage.
+func (s *Server) getAIUsage(c *gin.Context) {
+	now := time.Now().UTC()
+	filter := ai.UsageFilter{
+		From:  time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+		OrgID: c.Query("org"),
+	}
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + ", expected RFC 3339 or a date"})
+				return
+			}
+		}
+		*dst = t
+	}
+	if isAdmin(c) {
+		filter.UserID = c.Query("user")
+	} else {
+		filter.UserID = currentUserID(c)
+	}
+
+	report, err := s.aiMeter.Report(filter, c.DefaultQuery("group_by", "user"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) getAIBudgets(c *gin.Context) {
+	budgets, err := s.aiMeter.Budgets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch budgets"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets})
+}
+
+// setAIBudget creates or replaces the budget of an organisation or user;
+// an empty subject sets the default of the scope
+func (s *Server) setAIBudget(c *gin.Context) {
+	var budget ai.Budget
+	if err := c.ShouldBindJSON(&budget); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := s.aiMeter.SetBudget(&budget)
+	if errors.Is(err, ai.ErrInvalidBudget) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to save AI budget", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save budget"})
+		return
+	}
+	c.JSON(http.StatusOK, budget)
+}
+
+// deleteAIBudget removes the budget of ?subject in a scope
+func (s *Server) deleteAIBudget(c *gin.Context) {
+	if err := s.aiMeter.DeleteBudget(c.Param("scope"), c.Query("subject")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete budget"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
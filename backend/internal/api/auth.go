@@ -1,7 +1,10 @@
 package api
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/cybershield-ai/core/internal/auth"
@@ -29,12 +32,19 @@ func (s *Server) register(c *gin.Context) {
 		return
 	}
 
+	if err := s.passwordPolicy.Validate(req.Password, req.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	user, err := s.userStore.Create(req.Email, req.Password, req.Name)
 	if err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 
+	s.sendVerificationEmail(user)
+
 	token, err := generateToken(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -54,11 +64,27 @@ func (s *Server) login(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	if err := s.loginGuard.Check(req.Email, ip); err != nil {
+		var throttled *auth.ThrottledError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			status := http.StatusTooManyRequests
+			if throttled.Locked {
+				status = http.StatusLocked
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	user, err := s.userStore.Authenticate(req.Email, req.Password)
 	if err != nil {
+		s.loginGuard.RecordFailure(req.Email, ip, c.Request.URL.Path)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	s.loginGuard.RecordSuccess(req.Email)
 
 	token, err := generateToken(user)
 	if err != nil {
@@ -76,6 +102,7 @@ func generateToken(user *auth.User) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": user.ID,
 		"role":    user.Role,
+		"iat":     time.Now().Unix(),
 		"exp":     time.Now().Add(24 * time.Hour).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/realtime"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateConversationRequest struct {
+	Title      string `json:"title"`
+	Visibility string `json:"visibility"` // private (default) or org
+}
+
+type UpdateConversationRequest struct {
+	Title      *string `json:"title"`
+	Visibility *string `json:"visibility"`
+}
+
+type ChatMessageRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// conversationError maps store errors to responses
+func conversationError(c *gin.Context, err error) {
+	if aiLimitError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, ai.ErrConversationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+	case errors.Is(err, ai.ErrInvalidVisibility):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ai.ErrNotOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ai.ErrNotConfigured):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI chat is disabled: no provider configured"})
+	default:
+		slog.Error("Chat conversation request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process conversation"})
+	}
+}
+
+func (s *Server) listConversations(c *gin.Context) {
+	convs, err := s.conversations.List(currentUserID(c))
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversations": convs})
+}
+
+func (s *Server) createConversation(c *gin.Context) {
+	var req CreateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conv, err := s.conversations.Create(currentUserID(c), req.Title, req.Visibility)
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, conv)
+}
+
+func (s *Server) getConversation(c *gin.Context) {
+	conv, err := s.conversations.Get(c.Param("id"), currentUserID(c))
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+func (s *Server) updateConversation(c *gin.Context) {
+	var req UpdateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conv, err := s.conversations.Update(c.Param("id"), currentUserID(c), req.Title, req.Visibility)
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+func (s *Server) deleteConversation(c *gin.Context) {
+	if err := s.conversations.Delete(c.Param("id"), currentUserID(c)); err != nil {
+		conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted"})
+}
+
+// sendChatMessage answers a message in a conversation. The answer is
+// published to the conversation's topic as it is generated. With
+// Accept: text/event-stream or ?stream=true the response is a stream of
+// chat.delta events ending in chat.done or chat.error; otherwise it is
+// the stored question and answer.
+func (s *Server) sendChatMessage(c *gin.Context) {
+	var req ChatMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id := c.Param("id")
+	topic := realtime.ChatTopic(id)
+	stream := c.Query("stream") == "true" || strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+
+	// The stream starts with the first fragment, so errors before it,
+	// such as an unknown conversation, get a status code
+	started := false
+	send := func(eventType string, data any) {
+		if !started {
+			h := c.Writer.Header()
+			h.Set("Content-Type", "text/event-stream")
+			h.Set("Cache-Control", "no-cache")
+			h.Set("X-Accel-Buffering", "no")
+			c.Status(http.StatusOK)
+			started = true
+		}
+		writeSSE(c.Writer, realtime.Event{Topic: topic, Type: eventType, Time: time.Now().UTC(), Data: data})
+		c.Writer.Flush()
+	}
+	onDelta := func(text string) {
+		delta := gin.H{"conversation_id": id, "text": text}
+		s.wsManager.PublishTransient(topic, realtime.TypeChatDelta, delta)
+		if stream {
+			send(realtime.TypeChatDelta, delta)
+		}
+	}
+
+	question, answer, err := s.conversations.Send(c.Request.Context(), id, currentUserID(c), req.Message, onDelta)
+	if err != nil {
+		if !started {
+			conversationError(c, err)
+			return
+		}
+		slog.Error("Chat conversation request failed", "error", err)
+		send("chat.error", gin.H{"error": "Failed to answer the message"})
+		return
+	}
+	s.wsManager.Publish(topic, realtime.TypeChatMessage, question)
+	s.wsManager.Publish(topic, realtime.TypeChatMessage, answer)
+
+	result := gin.H{"question": question, "answer": answer}
+	if stream {
+		send("chat.done", result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/auth"
+	"github.com/cybershield-ai/core/internal/realtime"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newChatServer(t *testing.T) string {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&ai.Conversation{}, &ai.ConversationMessage{}))
+
+	llm := ai.NewClient()
+	llm.AddProvider(ai.NewMock().Reply("exposed", "Two findings are exposed [finding:3]."), "m")
+	engine := ai.NewChatEngine(llm, db)
+	index := ai.NewIndex()
+	index.Replace("finding", []ai.Document{{ID: "finding:3", Title: "High finding: Exposed admin panel"}})
+	engine.SetRetriever(index)
+	s := &Server{
+		conversations: ai.NewConversationStore(db, engine),
+		wsManager:     NewWebSocketManager(nil, nil, nil),
+	}
+	s.wsManager.SetTopicAuthorizer(func(userID, topic string) bool {
+		id, _ := realtime.ChatConversation(topic)
+		return s.conversations.CanRead(id, userID)
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", s.wsManager.HandleConnections)
+	authenticated := r.Group("/", func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-User")) })
+	authenticated.POST("/chat/conversations", s.createConversation)
+	authenticated.GET("/chat/conversations/:id", s.getConversation)
+	authenticated.POST("/chat/conversations/:id/messages", s.sendChatMessage)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func chatRequest(t *testing.T, method, url, user, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", user)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func dialChat(t *testing.T, url, userID, topic string) (*websocket.Conn, wsReply) {
+	t.Helper()
+	token, err := generateToken(&auth.User{ID: userID, Role: "user"})
+	require.NoError(t, err)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws?topics="+topic+"&token="+token, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var reply wsReply
+	require.NoError(t, conn.ReadJSON(&reply))
+	return conn, reply
+}
+
+func TestChatConversation_Stream(t *testing.T) {
+	url := newChatServer(t)
+
+	resp := chatRequest(t, http.MethodPost, url+"/chat/conversations", "alice", `{}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var conv ai.Conversation
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&conv))
+	topic := realtime.ChatTopic(conv.ID)
+
+	_, reply := dialChat(t, url, "bob", topic)
+	assert.Equal(t, []string{topic}, reply.Rejected, "private conversations are not streamed to others")
+	ws, reply := dialChat(t, url, "alice", topic)
+	require.Equal(t, []string{topic}, reply.Topics)
+
+	resp = chatRequest(t, http.MethodPost, url+"/chat/conversations/"+conv.ID+"/messages?stream=true", "bob", `{"message":"hi"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "errors before the answer keep their status")
+
+	resp = chatRequest(t, http.MethodPost, url+"/chat/conversations/"+conv.ID+"/messages?stream=true", "alice", `{"message":"What is exposed?"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	var streamed strings.Builder
+	var done struct {
+		Data struct {
+			Answer ai.ConversationMessage `json:"answer"`
+		} `json:"data"`
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e realtime.Event
+		require.NoError(t, json.Unmarshal([]byte(data), &e))
+		switch e.Type {
+		case realtime.TypeChatDelta:
+			streamed.WriteString(e.Data.(map[string]any)["text"].(string))
+		case "chat.done":
+			require.NoError(t, json.Unmarshal([]byte(data), &done))
+		}
+	}
+	assert.Equal(t, "Two findings are exposed [finding:3].", streamed.String())
+	assert.Equal(t, streamed.String(), done.Data.Answer.Content)
+	assert.Equal(t, []ai.Citation{{ID: "finding:3", Kind: "finding", Title: "High finding: Exposed admin panel"}}, done.Data.Answer.Citations)
+
+	// Subscribers see the fragments, then the stored messages
+	var event realtime.Event
+	require.NoError(t, ws.ReadJSON(&event))
+	assert.Equal(t, realtime.TypeChatDelta, event.Type)
+	assert.Empty(t, event.ID, "fragments are not replayed")
+	for event.Type == realtime.TypeChatDelta {
+		require.NoError(t, ws.ReadJSON(&event))
+	}
+	assert.Equal(t, realtime.TypeChatMessage, event.Type)
+	assert.NotEmpty(t, event.ID)
+
+	resp = chatRequest(t, http.MethodGet, url+"/chat/conversations/"+conv.ID, "alice", "")
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&conv))
+	assert.Equal(t, "What is exposed?", conv.Title)
+	assert.Len(t, conv.Messages, 2)
+	assert.Equal(t, []ai.Citation{{ID: "finding:3", Kind: "finding", Title: "High finding: Exposed admin panel"}}, conv.References)
+}
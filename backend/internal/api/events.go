@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/realtime"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleEvent forwards domain events to WebSocket subscribers
+func (m *WebSocketManager) HandleEvent(ctx context.Context, ev events.Event) error {
+	p, err := ev.Payload()
+	if err != nil {
+		return nil
+	}
+	switch p := p.(type) {
+	case *events.FindingCreated:
+		m.Publish(realtime.TopicFindings, ev.Type, p)
+	case *events.ScanCompleted:
+		m.Publish(realtime.ScanTopic(p.ScanID), ev.Type, p)
+	case *events.DetectionRaised:
+		m.Publish(realtime.TopicSimulation, ev.Type, p)
+	case *events.PlaybookCompleted:
+		m.Publish(realtime.TopicPlaybooks, ev.Type, p)
+	}
+	return nil
+}
+
+func (s *Server) getEventStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, s.eventBus.Status())
+}
+
+func (s *Server) getDeadLetters(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	dead, err := s.eventBus.DeadLetters(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dead letters"})
+		return
+	}
+	c.JSON(http.StatusOK, dead)
+}
+
+func (s *Server) redeliverDeadLetter(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := s.eventBus.Redeliver(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, events.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) getAuditLog(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	before, _ := strconv.ParseUint(c.Query("before"), 10, 64)
+	entries, err := s.auditLog.List(c.Query("type"), uint(before), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// FirewallBlock is a blocklist entry with the enforcement points holding it
+type FirewallBlock struct {
+	IPAddress  string     `json:"ip_address"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	EnforcedBy []string   `json:"enforced_by"` // Always includes "api"
+	Skipped    bool       `json:"skipped,omitempty"`
+}
+
+func (s *Server) getFirewallStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, s.firewall.Status())
+}
+
+func (s *Server) getFirewallBlocks(c *gin.Context) {
+	entries, err := s.monitorStore.GetBlockedIPs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocked IPs"})
+		return
+	}
+
+	status := s.firewall.Status()
+	blocks := make([]FirewallBlock, 0, len(entries))
+	for _, e := range entries {
+		block := FirewallBlock{
+			IPAddress:  e.IPAddress,
+			Reason:     e.Reason,
+			ExpiresAt:  e.ExpiresAt,
+			EnforcedBy: []string{"api"},
+		}
+		if p, _, err := database.ParsePrefix(e.IPAddress); err == nil {
+			block.EnforcedBy = append(block.EnforcedBy, s.firewall.Holders(p)...)
+			for _, skipped := range status.Skipped {
+				if skipped.Overlaps(p) {
+					block.Skipped = true
+				}
+			}
+		}
+		blocks = append(blocks, block)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backends": s.firewall.Backends(), "blocks": blocks})
+}
+
+func (s *Server) syncFirewall(c *gin.Context) {
+	if err := s.firewall.Sync(c.Request.Context()); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "status": s.firewall.Status()})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.firewall.Status())
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cybershield-ai/core/internal/gateway"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func (s *Server) getGatewayUpstreams(c *gin.Context) {
+	upstreams, err := s.apiGateway.ListUpstreams()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch upstreams"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"upstreams": upstreams})
+}
+
+// saveGatewayUpstream handles both create (POST) and update (PUT /:id)
+func (s *Server) saveGatewayUpstream(c *gin.Context) {
+	var upstream models.GatewayUpstream
+	if err := c.ShouldBindJSON(&upstream); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, ok := optionalID(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upstream ID"})
+		return
+	}
+	upstream.ID = id
+
+	err := s.apiGateway.SaveUpstream(&upstream)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upstream not found"})
+		return
+	}
+	if errors.Is(err, gateway.ErrInvalidConfig) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save upstream"})
+		return
+	}
+
+	c.JSON(http.StatusOK, upstream)
+}
+
+func (s *Server) deleteGatewayUpstream(c *gin.Context) {
+	id, ok := optionalID(c)
+	if !ok || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upstream ID"})
+		return
+	}
+	if err := s.apiGateway.DeleteUpstream(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete upstream"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upstream deleted"})
+}
+
+func (s *Server) getGatewayRoutes(c *gin.Context) {
+	routes, err := s.apiGateway.ListRoutes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch routes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"prefix": gateway.ProxyPrefix, "routes": routes})
+}
+
+// saveGatewayRoute handles both create (POST) and update (PUT /:id)
+func (s *Server) saveGatewayRoute(c *gin.Context) {
+	var route models.GatewayRoute
+	if err := c.ShouldBindJSON(&route); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, ok := optionalID(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		return
+	}
+	route.ID = id
+
+	err := s.apiGateway.SaveRoute(&route)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+		return
+	}
+	if errors.Is(err, gateway.ErrInvalidConfig) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save route"})
+		return
+	}
+
+	c.JSON(http.StatusOK, route)
+}
+
+func (s *Server) deleteGatewayRoute(c *gin.Context) {
+	id, ok := optionalID(c)
+	if !ok || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		return
+	}
+	if err := s.apiGateway.DeleteRoute(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete route"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Route deleted"})
+}
+
+// optionalID reads the :id parameter, returning 0 when the route has none
+func optionalID(c *gin.Context) (uint, bool) {
+	param := c.Param("id")
+	if param == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(param, 10, 64)
+	return uint(id), err == nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+type GeoPolicyRequest struct {
+	Kind   string `json:"kind" binding:"required"`   // country or asn
+	Value  string `json:"value" binding:"required"`  // e.g. "RU" or "AS14061"
+	Action string `json:"action" binding:"required"` // block or challenge
+	Reason string `json:"reason"`
+}
+
+func (s *Server) getGeoPolicies(c *gin.Context) {
+	policies, err := s.monitorStore.GetGeoPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch geo policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+func (s *Server) saveGeoPolicy(c *gin.Context) {
+	var req GeoPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := &models.GeoPolicy{
+		Kind:      req.Kind,
+		Value:     req.Value,
+		Action:    req.Action,
+		Reason:    req.Reason,
+		CreatedBy: currentUserID(c),
+	}
+	err := s.monitorStore.SaveGeoPolicy(policy)
+	if errors.Is(err, database.ErrInvalidGeoPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save geo policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func (s *Server) deleteGeoPolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+		return
+	}
+	if err := s.monitorStore.DeleteGeoPolicy(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete geo policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Geo policy deleted"})
+}
+
+// geoStatsWindow reads ?hours (default 24, max 30 days), ?limit and
+// ?attacks=true, which counts only requests with a detected attack
+func geoStatsWindow(c *gin.Context) (time.Time, int, bool) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 || hours > 24*30 {
+		hours = 24
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	return time.Now().Add(-time.Duration(hours) * time.Hour), limit, c.Query("attacks") == "true"
+}
+
+func (s *Server) getTopCountries(c *gin.Context) {
+	since, limit, attacksOnly := geoStatsWindow(c)
+	rows, err := s.monitorStore.TopCountries(since, limit, attacksOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate countries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"since": since, "countries": rows})
+}
+
+func (s *Server) getTopASNs(c *gin.Context) {
+	since, limit, attacksOnly := geoStatsWindow(c)
+	rows, err := s.monitorStore.TopASNs(since, limit, attacksOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate ASNs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"since": since, "asns": rows})
+}
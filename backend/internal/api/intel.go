@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cybershield-ai/core/internal/intel"
+	"github.com/gin-gonic/gin"
+)
+
+// Largest feed file accepted; the uncompressed EPSS file is about 10 MB
+const maxFeedSize = 64 << 20
+
+// getFindings lists findings by priority. ?known_exploited=true keeps
+// those in the KEV catalog; ?severity, ?cve, ?min_priority and ?limit
+// narrow the list further.
+func (s *Server) getFindings(c *gin.Context) {
+	filter := intel.FindingFilter{
+		Severity: c.Query("severity"),
+		CVE:      c.Query("cve"),
+	}
+	filter.KnownExploited, _ = strconv.ParseBool(c.Query("known_exploited"))
+	if v := c.Query("min_priority"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_priority"})
+			return
+		}
+		filter.MinPriority = n
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	findings, total, err := s.exploitIntel.Findings(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch findings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"findings": findings, "total": total})
+}
+
+func (s *Server) getIntelStatus(c *gin.Context) {
+	imports, err := s.exploitIntel.Store().Imports()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed status"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"feeds": imports})
+}
+
+func (s *Server) getCVEIntel(c *gin.Context) {
+	cve := strings.ToUpper(c.Param("id"))
+	found, err := s.exploitIntel.Store().Lookup([]string{cve})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up CVE"})
+		return
+	}
+	info, ok := found[cve]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CVE is in neither feed"})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// parseCVSS scores ?vector
+func (s *Server) parseCVSS(c *gin.Context) {
+	cvss, err := intel.ParseCVSS(c.Query("vector"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cvss": cvss, "severity": cvss.Severity()})
+}
+
+// importIntelFeed replaces the kev or epss feed with the file in the
+// request body and re-enriches the findings
+func (s *Server) importIntelFeed(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxFeedSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Feed file too large"})
+		return
+	}
+
+	imp, err := s.exploitIntel.Import(c.Request.Context(), c.Param("feed"), data)
+	switch {
+	case errors.Is(err, intel.ErrUnknownFeed):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, intel.ErrInvalidFeed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		slog.Error("Feed import failed", "feed", c.Param("feed"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import feed"})
+	default:
+		c.JSON(http.StatusOK, imp)
+	}
+}
+
+// refreshIntel re-reads KEV_FILE and EPSS_FILE now
+func (s *Server) refreshIntel(c *gin.Context) {
+	if err := s.exploitIntel.Refresh(c.Request.Context()); err != nil {
+		slog.Error("Feed refresh failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.getIntelStatus(c)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/logquery"
+	"github.com/gin-gonic/gin"
+)
+
+type TranslateQueryRequest struct {
+	Question string `json:"question" binding:"required"`
+}
+
+type RunQueryRequest struct {
+	Query logquery.Query `json:"query"`
+	// The question the query answers; with Summarize the result is
+	// summarised in answer to it
+	Question  string `json:"question"`
+	Summarize bool   `json:"summarize"`
+}
+
+func (s *Server) getLogQuerySchema(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"datasets": logquery.Datasets()})
+}
+
+// translateLogQuery returns the query for a question without running it,
+// so the analyst can review it first
+func (s *Server) translateLogQuery(c *gin.Context) {
+	var req TranslateQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	translation, err := s.queryTranslator.Translate(c.Request.Context(), req.Question)
+	if aiLimitError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, ai.ErrNotConfigured):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Query translation is disabled: no provider configured"})
+		return
+	case errors.Is(err, logquery.ErrNoQuery):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		slog.Error("Query translation failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to translate question"})
+		return
+	}
+	c.JSON(http.StatusOK, translation)
+}
+
+func (s *Server) runLogQuery(c *gin.Context) {
+	var req RunQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := s.queryEngine.Run(c.Request.Context(), req.Query)
+	if errors.Is(err, logquery.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Log query failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run query"})
+		return
+	}
+
+	resp := gin.H{"query": req.Query, "result": result}
+	if req.Summarize && req.Question != "" {
+		// The result is still useful without a summary
+		summary, err := s.queryTranslator.Summarize(c.Request.Context(), req.Question, req.Query, result)
+		var limit *ai.LimitError
+		switch {
+		case errors.As(err, &limit):
+			resp["summary_error"] = limit.Error()
+		case err != nil:
+			slog.Warn("Query summary failed", "error", err)
+			resp["summary_error"] = "Failed to summarise the result"
+		default:
+			resp["summary"] = summary
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -1,27 +1,150 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/models"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// getMonitorLogs searches security logs. Filters: ip, path (prefix),
+// attack_type, status, account, min_risk, max_risk, since and until
+// (RFC 3339). Pass next_cursor back as cursor for the following page.
 func (s *Server) getMonitorLogs(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "50")
-	limit, _ := strconv.Atoi(limitStr)
+	filter, err := logFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 
-	logs, err := s.monitorStore.GetSecurityLogs(limit)
+	page, err := s.monitorStore.SearchSecurityLogs(filter, c.Query("cursor"), limit)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch logs"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"logs": logs})
+	c.JSON(http.StatusOK, page)
+}
+
+func logFilterFromQuery(c *gin.Context) (database.LogFilter, error) {
+	filter := database.LogFilter{
+		IP:         c.Query("ip"),
+		Path:       c.Query("path"),
+		AttackType: c.Query("attack_type"),
+		Status:     c.Query("status"),
+		Account:    c.Query("account"),
+	}
+	for name, dst := range map[string]**int{"min_risk": &filter.MinRisk, "max_risk": &filter.MaxRisk} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s", name)
+			}
+			*dst = &n
+		}
+	}
+	for name, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, expected RFC 3339", name)
+			}
+			*dst = &t
+		}
+	}
+	return filter, nil
+}
+
+// getMonitorLogStats aggregates the logs matching the same filters as
+// getMonitorLogs. ?bucket sets the histogram width (default 1h) and ?top
+// the number of IPs and paths returned.
+func (s *Server) getMonitorLogStats(c *gin.Context) {
+	filter, err := logFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Since == nil {
+		since := time.Now().Add(-24 * time.Hour)
+		filter.Since = &since
+	}
+	bucket, err := time.ParseDuration(c.DefaultQuery("bucket", "1h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bucket"})
+		return
+	}
+	top, _ := strconv.Atoi(c.DefaultQuery("top", "10"))
+
+	stats, err := s.monitorStore.AggregateSecurityLogs(filter, bucket, top)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (s *Server) pruneMonitorLogs(c *gin.Context) {
+	result, err := s.monitorStore.PruneSecurityLogs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prune logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// scrubMonitorLogs redacts logs stored before redaction was configured;
+// ?dry_run=true only counts them
+func (s *Server) scrubMonitorLogs(c *gin.Context) {
+	result, err := s.monitorStore.ScrubSecurityLogs(c.Query("dry_run") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scrub logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) getLogArchives(c *gin.Context) {
+	archives, err := s.monitorStore.ListLogArchives()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list archives"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"archives": archives})
+}
+
+func (s *Server) downloadLogArchive(c *gin.Context) {
+	path, err := s.monitorStore.LogArchivePath(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archive not found"})
+		return
+	}
+
+	c.FileAttachment(path, c.Param("name"))
 }
 
 type BlockIPRequest struct {
+	IP       string `json:"ip" binding:"required"` // Address or CIDR prefix
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"` // e.g. "72h"; "0" blocks permanently, default 24h
+}
+
+type AllowIPRequest struct {
 	IP     string `json:"ip" binding:"required"`
 	Reason string `json:"reason"`
 }
@@ -34,7 +157,28 @@ func (s *Server) blockIP(c *gin.Context) {
 	}
 
 	// Default block for 24 hours manually
-	err := s.monitorStore.BlockIP(req.IP, req.Reason, "Admin", 24*time.Hour)
+	duration := 24 * time.Hour
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if req.Duration == "0" {
+			d, err = 0, nil
+		}
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duration"})
+			return
+		}
+		duration = d
+	}
+
+	err := s.monitorStore.BlockIP(req.IP, req.Reason, "Admin", duration)
+	if errors.Is(err, database.ErrInvalidAddress) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, database.ErrAllowlisted) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block IP"})
 		return
@@ -43,9 +187,18 @@ func (s *Server) blockIP(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "IP blocked successfully"})
 }
 
+// ipParam reads a catch-all route parameter so CIDR prefixes such as
+// 10.0.0.0/8 can be passed in the path
+func ipParam(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("ip"), "/")
+}
+
 func (s *Server) unblockIP(c *gin.Context) {
-	ip := c.Param("ip")
-	err := s.monitorStore.UnblockIP(ip)
+	err := s.monitorStore.UnblockIP(ipParam(c))
+	if errors.Is(err, database.ErrInvalidAddress) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock IP"})
 		return
@@ -63,3 +216,131 @@ func (s *Server) getBlockedIPs(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"blocked_ips": ips})
 }
+
+func (s *Server) getBlockedIP(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	entry, err := s.monitorStore.GetBlockedIP(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch entry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+func (s *Server) getAllowedIPs(c *gin.Context) {
+	ips, err := s.monitorStore.GetAllowedIPs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch allowed IPs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"allowed_ips": ips})
+}
+
+func (s *Server) allowIP(c *gin.Context) {
+	var req AllowIPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := s.monitorStore.AllowIP(req.IP, req.Reason, "Admin")
+	if errors.Is(err, database.ErrInvalidAddress) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to allow IP"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "IP allowlisted successfully"})
+}
+
+func (s *Server) removeAllowedIP(c *gin.Context) {
+	err := s.monitorStore.RemoveAllowedIP(ipParam(c))
+	if errors.Is(err, database.ErrInvalidAddress) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove allowed IP"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "IP removed from allowlist"})
+}
+
+// importBlocklist accepts a JSON array of entries or, for any other content
+// type, one address or CIDR per line. ?action=allow imports a text list as
+// allowlist entries; ?duration and ?reason apply to entries without their
+// own.
+func (s *Server) importBlocklist(c *gin.Context) {
+	var duration time.Duration
+	if v := c.Query("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duration"})
+			return
+		}
+		duration = d
+	}
+
+	var entries []database.BlocklistEntry
+	var err error
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		entries, err = database.ParseBlocklistJSON(c.Request.Body)
+	} else {
+		entries, err = database.ParseBlocklistText(c.Request.Body)
+		for i := range entries {
+			entries[i].Action = c.Query("action")
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := s.monitorStore.ImportBlocklist(entries, c.DefaultQuery("reason", "Imported"), "Admin", duration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import blocklist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// exportBlocklist returns the active entries as JSON, or as plain text with
+// ?format=txt
+func (s *Server) exportBlocklist(c *gin.Context) {
+	action := c.DefaultQuery("action", models.IPActionBlock)
+	if action == "all" {
+		action = ""
+	}
+
+	entries, err := s.monitorStore.ExportBlocklist(action)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export blocklist"})
+		return
+	}
+
+	if c.Query("format") == "txt" {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="blocklist.txt"`)
+		c.Status(http.StatusOK)
+		database.WriteBlocklistText(c.Writer, entries)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
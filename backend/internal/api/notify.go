@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/auth"
+	"github.com/cybershield-ai/core/internal/integrations"
+	"github.com/cybershield-ai/core/internal/mailer"
+	"github.com/gin-gonic/gin"
+)
+
+// securityNotifier forwards login guard events to the security team's
+// alerting integrations and emails the affected user
+type securityNotifier struct {
+	integrations *integrations.IntegrationManager
+	users        *auth.UserStore
+	mailer       mailer.Mailer
+}
+
+func (n *securityNotifier) AccountLocked(account, ip string, until time.Time) {
+	slog.Warn("Account locked after repeated failed logins", "account", account, "ip", ip, "until", until)
+	n.alert(fmt.Sprintf("Account %s locked until %s after repeated failed logins from %s",
+		account, until.UTC().Format(time.RFC3339), ip))
+
+	// Lockouts are tracked for unknown accounts too; only mail real users
+	if n.users == nil || n.mailer == nil {
+		return
+	}
+	if user, err := n.users.GetUserByUsername(account); err == nil {
+		deliverEmail(n.mailer, mailer.TemplateAccountLocked, user.Email, gin.H{
+			"Name":  displayName(user),
+			"Until": until.UTC().Format(time.RFC1123),
+			"IP":    ip,
+		})
+	}
+}
+
+func (n *securityNotifier) IPBlocked(ip string, accounts []string) {
+	slog.Warn("IP blocked for password spraying", "ip", ip, "accounts", len(accounts))
+	n.alert(fmt.Sprintf("Blocked %s for password spraying against %d accounts: %s",
+		ip, len(accounts), strings.Join(accounts, ", ")))
+}
+
+func (n *securityNotifier) alert(message string) {
+	if n.integrations == nil {
+		return
+	}
+	// Webhooks can be slow; never hold up the login response on them
+	go func() {
+		if err := n.integrations.SendAlert(integrations.Slack, message); err != nil {
+			slog.Debug("Security alert not delivered", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/cybershield-ai/core/internal/automation"
+	"github.com/gin-gonic/gin"
+)
+
+// Largest playbook YAML file accepted
+const maxPlaybookFile = 1 << 20
+
+func playbookActor(c *gin.Context) automation.Actor {
+	return automation.Actor{UserID: currentUserID(c), Role: c.GetString("role")}
+}
+
+// playbookError maps store errors to responses
+func playbookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, automation.ErrPlaybookNotFound), errors.Is(err, automation.ErrVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, automation.ErrInvalidPlaybook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, automation.ErrPlaybookExists), errors.Is(err, automation.ErrPlaybookDisabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, automation.ErrNotPermitted):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		slog.Error("Playbook request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process playbook"})
+	}
+}
+
+func (s *Server) getPlaybooks(c *gin.Context) {
+	playbooks, err := s.playbooks.List()
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"playbooks": playbooks})
+}
+
+func (s *Server) getPlaybook(c *gin.Context) {
+	pb, err := s.playbooks.Get(c.Param("id"))
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pb)
+}
+
+// getPlaybookSchema lists the triggers with the fields of their events,
+// and the parameters of each action type, for editors
+func (s *Server) getPlaybookSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"triggers": automation.Triggers(),
+		"fields":   automation.TriggerFields(),
+		"actions":  automation.ActionTypes(),
+	})
+}
+
+// createPlaybook stores a playbook owned by the current user
+func (s *Server) createPlaybook(c *gin.Context) {
+	var pb automation.Playbook
+	if err := c.ShouldBindJSON(&pb); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.playbooks.Create(playbookActor(c), &pb); err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, pb)
+}
+
+// updatePlaybook replaces the definition of a playbook as a new version
+func (s *Server) updatePlaybook(c *gin.Context) {
+	var def automation.Playbook
+	if err := c.ShouldBindJSON(&def); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pb, err := s.playbooks.Update(playbookActor(c), c.Param("id"), def)
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pb)
+}
+
+func (s *Server) deletePlaybook(c *gin.Context) {
+	if err := s.playbooks.Delete(playbookActor(c), c.Param("id")); err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// setPlaybookPermissions changes who may edit and run a playbook, and
+// may hand it to another existing user
+func (s *Server) setPlaybookPermissions(c *gin.Context) {
+	var perms automation.Permissions
+	if err := c.ShouldBindJSON(&perms); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if perms.OwnerID != "" {
+		if _, err := s.userStore.GetByID(perms.OwnerID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown owner"})
+			return
+		}
+	}
+	pb, err := s.playbooks.SetPermissions(playbookActor(c), c.Param("id"), perms)
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pb)
+}
+
+func (s *Server) getPlaybookVersions(c *gin.Context) {
+	versions, err := s.playbooks.Versions(c.Param("id"))
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// rollbackPlaybook restores an earlier version as a new version
+func (s *Server) rollbackPlaybook(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+	pb, err := s.playbooks.Rollback(playbookActor(c), c.Param("id"), version)
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pb)
+}
+
+// exportPlaybooks returns playbooks as YAML: those named by ?id, or all
+func (s *Server) exportPlaybooks(c *gin.Context) {
+	data, err := s.playbooks.Export(c.QueryArray("id")...)
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="playbooks.yaml"`)
+	c.Data(http.StatusOK, "application/yaml", data)
+}
+
+// importPlaybooks creates or updates the playbooks of the YAML file in
+// the request body, all or none
+func (s *Server) importPlaybooks(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPlaybookFile))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Playbook file too large"})
+		return
+	}
+	playbooks, err := s.playbooks.Import(playbookActor(c), data)
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"playbooks": playbooks})
+}
+
+// getPlaybookRuns lists the latest runs of a playbook with the outcome of
+// each action
+func (s *Server) getPlaybookRuns(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	runs, err := s.playbooks.Runs(c.Param("id"), limit)
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+func (s *Server) runPlaybook(c *gin.Context) {
+	run, err := s.automationEngine.RunPlaybook(playbookActor(c), c.Param("id"))
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	if run.Failed() {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Some playbook actions failed", "run": run})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Playbook executed successfully", "run": run})
+}
+
+func (s *Server) togglePlaybook(c *gin.Context) {
+	id := c.Param("id")
+	pb, err := s.playbooks.Get(id)
+	if err == nil {
+		pb, err = s.playbooks.SetEnabled(playbookActor(c), id, !pb.Enabled)
+	}
+	if err != nil {
+		playbookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Playbook toggled", "enabled": pb.Enabled})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/cybershield-ai/core/internal/sast"
+	"github.com/gin-gonic/gin"
+)
+
+type SASTScanRequest struct {
+	// Directory to analyse, relative to SAST_ROOT
+	Path string `json:"path"`
+}
+
+func (s *Server) startSASTScan(c *gin.Context) {
+	var req SASTScanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Path == "" {
+		req.Path = "."
+	}
+
+	scanID, err := s.sastScanner.Start(c.Request.Context(), req.Path)
+	switch {
+	case errors.Is(err, sast.ErrOutsideRoot), errors.Is(err, sast.ErrNotDirectory):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		slog.Error("SAST scan start failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start scan"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"scan_id": scanID})
+}
+
+func (s *Server) getSASTScans(c *gin.Context) {
+	history, err := s.sastScanner.GetHistory(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scans": history})
+}
+
+func (s *Server) getSASTScan(c *gin.Context) {
+	result, err := s.sastScanner.GetResults(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) getSASTRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"rules": s.sastScanner.Analyzer().Rules()})
+}
@@ -1,65 +1,106 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cybershield-ai/core/internal/ai"
 	"github.com/cybershield-ai/core/internal/apm"
 	"github.com/cybershield-ai/core/internal/auth"
+	"github.com/cybershield-ai/core/internal/autofix"
 	"github.com/cybershield-ai/core/internal/automation"
+	"github.com/cybershield-ai/core/internal/cache"
 	"github.com/cybershield-ai/core/internal/cloud"
 	"github.com/cybershield-ai/core/internal/compliance"
 	"github.com/cybershield-ai/core/internal/container"
 	"github.com/cybershield-ai/core/internal/context"
 	"github.com/cybershield-ai/core/internal/crypto"
 	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/firewall"
 	"github.com/cybershield-ai/core/internal/gateway"
+	"github.com/cybershield-ai/core/internal/geoip"
 	"github.com/cybershield-ai/core/internal/hardware"
 	"github.com/cybershield-ai/core/internal/honeypot"
 	"github.com/cybershield-ai/core/internal/iac"
 	"github.com/cybershield-ai/core/internal/identity"
 	"github.com/cybershield-ai/core/internal/infrastructure"
 	"github.com/cybershield-ai/core/internal/integrations"
+	"github.com/cybershield-ai/core/internal/intel"
 	"github.com/cybershield-ai/core/internal/isolation"
+	"github.com/cybershield-ai/core/internal/knowledge"
+	"github.com/cybershield-ai/core/internal/logquery"
+	"github.com/cybershield-ai/core/internal/mailer"
 	"github.com/cybershield-ai/core/internal/middleware"
 	"github.com/cybershield-ai/core/internal/models"
 	"github.com/cybershield-ai/core/internal/phishing"
+	"github.com/cybershield-ai/core/internal/ratelimit"
+	"github.com/cybershield-ai/core/internal/realtime"
+	"github.com/cybershield-ai/core/internal/redact"
 	"github.com/cybershield-ai/core/internal/redhat"
 	"github.com/cybershield-ai/core/internal/redteam"
 	"github.com/cybershield-ai/core/internal/reporting"
+	"github.com/cybershield-ai/core/internal/sast"
 	"github.com/cybershield-ai/core/internal/scanner"
 	"github.com/cybershield-ai/core/internal/scheduler"
+	"github.com/cybershield-ai/core/internal/scim"
 	"github.com/cybershield-ai/core/internal/secrets"
 	"github.com/cybershield-ai/core/internal/simulation"
 	"github.com/cybershield-ai/core/internal/ueba"
 	"github.com/cybershield-ai/core/internal/voice"
+	"github.com/cybershield-ai/core/internal/waf"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"golang.org/x/time/rate"
 )
 
 type Server struct {
 	router             *gin.Engine
 	userStore          *auth.UserStore
+	groupStore         *auth.GroupStore
+	loginGuard         *auth.LoginGuard
+	wafEngine          *waf.Engine
+	wafPolicies        *waf.PolicyStore
+	tokenStore         *auth.TokenStore
+	passwordPolicy     *auth.PasswordPolicy
+	mailer             mailer.Mailer
 	orchestrator       *scanner.Orchestrator
+	sastScanner        *sast.Scanner
+	exploitIntel       *intel.Enricher
 	scheduler          *scheduler.Scheduler
 	wsManager          *WebSocketManager
+	eventBus           *events.Bus
+	auditLog           *events.AuditLog
+	llm                *ai.Client
+	aiMeter            *ai.Meter
+	knowledgeIndex     *ai.Index
 	aiEngine           *ai.RemediationEngine
+	fixer              *autofix.Fixer
+	queryEngine        *logquery.Engine
+	queryTranslator    *logquery.Translator
 	monitorStore       *database.MonitorStore
+	firewall           *firewall.Enforcer
 	complianceManager  *compliance.Manager
 	cloudManager       *cloud.CloudManager
 	integrationManager *integrations.IntegrationManager
 	automationEngine   *automation.AutomationEngine
+	playbooks          *automation.Store
 	uebaEngine         *ueba.UEBAEngine
 	honeypotManager    *honeypot.HoneypotManager
 	apiGateway         *gateway.APIGateway
+	rateLimiter        ratelimit.Limiter
+	gatewayProxy       *gateway.Proxy
 	containerScanner   *container.ContainerScanner
 	iacScanner         *iac.IaCScanner
 	awsScanner         *scanner.AWSScanner
 	chatEngine         *ai.ChatEngine
+	conversations      *ai.ConversationStore
 	phishingManager    *phishing.PhishingManager
 	telemetryEngine    *hardware.TelemetryEngine
 	itdrEngine         *identity.ITDREngine
@@ -117,36 +158,72 @@ func NewServer(secretsManager secrets.Manager) *Server {
 	}
 
 	// Auto Migration
-	if err := db.AutoMigrate(&auth.User{}, &scanner.ScanResult{}, &scanner.Vuln{}, &scheduler.ScheduledScan{}, &models.SecurityLog{}, &models.BlockedIP{}); err != nil {
+	if err := db.AutoMigrate(&auth.User{}, &auth.ActionToken{}, &auth.Group{}, &scanner.ScanResult{}, &scanner.Vuln{}, &scheduler.ScheduledScan{}, &models.SecurityLog{}, &models.BlockedIP{}, &models.GeoPolicy{}, &waf.RoutePolicy{}, &waf.Exclusion{}, &events.OutboxEvent{}, &events.EventCursor{}, &events.DeadLetter{}, &events.AuditEntry{}, &ai.Conversation{}, &ai.ConversationMessage{}, &models.CloudTrailAlert{}, &ai.UsageRecord{}, &ai.Budget{}, &intel.KEVEntry{}, &intel.EPSSScore{}, &intel.FeedImport{}, &automation.Playbook{}, &automation.PlaybookVersion{}, &automation.PlaybookRun{}); err != nil {
 		panic("failed to migrate database: " + err.Error())
 	}
 
-	r := gin.Default()
+	// Domain event bus; subscribers are registered once all engines exist
+	var eventTransport events.Transport
+	if getEnv("EVENT_TRANSPORT", "outbox") == "redis" {
+		if cache.RDB != nil {
+			eventTransport = events.NewRedisTransport(cache.RDB, getEnv("EVENT_STREAM", "cybershield:events"))
+		} else {
+			slog.Warn("EVENT_TRANSPORT is redis but Redis is not configured, delivering from the outbox")
+		}
+	}
+	eventBus := events.NewBus(db, eventTransport)
+	auditLog := events.NewAuditLog(db)
 
-	// Initialize WebSocket Manager
-	wsManager := NewWebSocketManager()
-	go wsManager.HandleMessages()
+	r := gin.Default()
 
-	// Initialize AI Engines
-	apiKey, _ := secretsManager.GetSecret("GEMINI_API_KEY")
-	if apiKey == "" {
-		slog.Warn("GEMINI_API_KEY is not set. AI features will be disabled.")
-	} else {
-		slog.Info("GEMINI_API_KEY is set.")
+	// Initialize AI Engines. Keys come from the secrets manager, the
+	// rest of the provider settings from the environment.
+	llm, err := ai.ClientFromEnv(func(key string) string {
+		if strings.HasSuffix(key, "_API_KEY") {
+			v, _ := secretsManager.GetSecret(key)
+			return v
+		}
+		return os.Getenv(key)
+	})
+	if err != nil {
+		slog.Error("Invalid AI provider configuration", "error", err)
 	}
-	aiEngine := ai.NewRemediationEngine(apiKey)
-	var chatEngine *ai.ChatEngine
-	if aiEngine != nil && aiEngine.Client != nil {
-		chatEngine = ai.NewChatEngine(aiEngine.Client, db)
-		slog.Info("ChatEngine initialized successfully.")
-	} else {
-		slog.Error("Failed to initialize ChatEngine.")
+	for _, st := range llm.Status() {
+		if st.Enabled {
+			slog.Info("AI feature enabled", "feature", st.Feature, "route", st.Route.String())
+		} else {
+			slog.Warn("No AI provider configured, feature disabled", "feature", st.Feature)
+		}
+	}
+	aiEngine := ai.NewRemediationEngine(llm)
+	fixer, err := autofix.FromEnv(db, aiEngine, func(key string) string {
+		if key == "FORGE_TOKEN" {
+			v, _ := secretsManager.GetSecret(key)
+			return v
+		}
+		return os.Getenv(key)
+	})
+	if err != nil {
+		slog.Error("Invalid fix repository configuration", "error", err)
 	}
+	chatEngine := ai.NewChatEngine(llm, db)
 
 	// Initialize Scanners
 	zapScanner := scanner.NewZAPScanner("dummy-zap-key")
 	scaScanner := scanner.NewSCAScanner(db, aiEngine)
 	orchestrator := scanner.NewOrchestrator(db, zapScanner, scaScanner)
+	orchestrator.SetEmitter(eventBus)
+	exploitIntel := intel.NewEnricher(db)
+	exploitIntel.KEVFile = os.Getenv("KEV_FILE")
+	exploitIntel.EPSSFile = os.Getenv("EPSS_FILE")
+	orchestrator.SetEnricher(exploitIntel)
+	sastRules, err := sast.LoadRules(os.Getenv("SAST_RULES_DIR"))
+	if err != nil {
+		slog.Error("Invalid SAST rules, using the built-in rules", "error", err)
+		sastRules, _ = sast.LoadRules("")
+	}
+	sastScanner := sast.NewScanner(db, sast.NewAnalyzer(sastRules), getEnv("SAST_ROOT", "."))
+	sastScanner.SetEmitter(eventBus)
 
 	// Initialize Scheduler
 	sched := scheduler.NewScheduler(db, orchestrator)
@@ -154,7 +231,62 @@ func NewServer(secretsManager secrets.Manager) *Server {
 
 	// Initialize Stores and Managers
 	userStore := auth.NewUserStore(db)
+	// Realtime events reach the clients of every replica through Redis;
+	// without it they stay within this process
+	realtimeHub := realtime.NewHub(cache.RDB, getEnv("REALTIME_PREFIX", "cybershield:realtime"), realtimeLogSize())
+	realtimeHub.Start()
+	wsManager := NewWebSocketManager(userStore, strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ","), realtimeHub)
+	orchestrator.SetPublisher(wsManager)
+	groupStore := auth.NewGroupStore(db, auth.ParseRoleMapping(os.Getenv("SCIM_GROUP_ROLES")))
 	monitorStore := database.NewMonitorStore(db)
+	monitorStore.SetPublisher(wsManager)
+	monitorStore.SetEmitter(eventBus)
+	if err := monitorStore.SeedAllowlist(); err != nil {
+		slog.Warn("Failed to seed IP allowlist", "error", err)
+	}
+	firewallBackends, err := firewall.FromEnv()
+	if err != nil {
+		slog.Warn("Failed to configure firewall backends", "error", err)
+	}
+	firewallEnforcer := firewall.NewEnforcer(monitorStore, firewallBackends...)
+	if len(firewallBackends) > 0 {
+		interval := time.Minute
+		if d, err := time.ParseDuration(os.Getenv("FIREWALL_SYNC_INTERVAL")); err == nil && d > 0 {
+			interval = d
+		}
+		monitorStore.OnChange(firewallEnforcer.Trigger)
+		firewallEnforcer.Start(interval)
+	}
+	monitorStore.StartSweeper(time.Minute)
+	monitorStore.SetLogPolicy(logPolicyFromEnv())
+	monitorStore.StartRetention(time.Hour)
+	if redactor, err := redact.FromEnv(); err != nil {
+		slog.Warn("Invalid redaction config, using defaults", "error", err)
+	} else {
+		monitorStore.SetRedactor(redactor)
+	}
+	geoResolver, err := geoip.NewFromEnv()
+	if err != nil {
+		slog.Warn("Failed to open GeoIP databases", "error", err)
+	} else if geoResolver != nil {
+		monitorStore.SetGeoResolver(geoResolver)
+	}
+	wafEngine, err := waf.NewEngine(wafConfigFromEnv())
+	if err != nil {
+		panic("failed to load WAF rules: " + err.Error())
+	}
+	wafEngine.Watch(10 * time.Second)
+	wafMode, err := waf.ParseMode(getEnv("WAF_MODE", string(waf.ModeBlock)))
+	if err != nil {
+		panic(err.Error())
+	}
+	wafPolicies, err := waf.NewPolicyStore(db, wafMode)
+	if err != nil {
+		panic("failed to load WAF policies: " + err.Error())
+	}
+	if err := wafPolicies.SeedRoutes(); err != nil {
+		slog.Warn("Failed to seed WAF route policies", "error", err)
+	}
 
 	complianceManager := compliance.NewManager(db)
 	// Initialize Scanners
@@ -172,10 +304,59 @@ func NewServer(secretsManager secrets.Manager) *Server {
 
 	cloudManager := cloud.NewCloudManager(db, awsScanner)
 	integrationManager := integrations.NewIntegrationManager(db)
-	automationEngine := automation.NewAutomationEngine(integrationManager)
+	mail := mailer.NewFromEnv()
+	tokenStore := auth.NewTokenStore(db, []byte(getEnv("TOKEN_SECRET", string(jwtSecret))))
+	passwordPolicy := auth.DefaultPasswordPolicy()
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		if err := passwordPolicy.LoadBreachedHashes(path); err != nil {
+			slog.Warn("Failed to load breached password list", "path", path, "error", err)
+		}
+	}
+	loginGuard := auth.NewLoginGuard(auth.DefaultGuardConfig(), monitorStore, &securityNotifier{
+		integrations: integrationManager,
+		users:        userStore,
+		mailer:       mail,
+	})
+	loginGuard.StartSweeper(time.Minute)
+	playbookStore := automation.NewStore(db)
+	if err := playbookStore.SeedDefaults(); err != nil {
+		slog.Warn("Failed to seed default playbooks", "error", err)
+	}
+	automationEngine := automation.NewAutomationEngine(playbookStore, integrationManager, monitorStore)
+	automationEngine.SetEmitter(eventBus)
+
+	// The chat assistant retrieves records from a local index and queries
+	// the database with read-only tools
+	knowledgeIndex := ai.NewIndex()
+	knowledgeIndexer := knowledge.NewIndexer(db, knowledgeIndex, automationEngine)
+	chatEngine.SetRetriever(knowledgeIndex)
+	chatEngine.SetTools(knowledge.Tools(db, knowledgeIndex, automationEngine))
+	conversations := ai.NewConversationStore(db, chatEngine)
+	wsManager.SetTopicAuthorizer(func(userID, topic string) bool {
+		id, _ := realtime.ChatConversation(topic)
+		return conversations.CanRead(id, userID)
+	})
 	uebaEngine := ueba.NewUEBAEngine(db)
 	honeypotManager := honeypot.NewHoneypotManager(db)
 	apiGateway := gateway.NewAPIGateway(db)
+	gatewayTargets, err := gateway.ParseTargets(os.Getenv("GATEWAY_ALLOWED_TARGETS"))
+	if err != nil {
+		panic("invalid GATEWAY_ALLOWED_TARGETS: " + err.Error())
+	}
+	apiGateway.AllowTargets(gatewayTargets)
+	apiGateway.StartRefresher(30 * time.Second)
+	rateLimiter := ratelimit.New(cache.RDB)
+	aiMeter := newAIMeter(db, rateLimiter)
+	llm.SetMeter(aiMeter)
+	gatewayProxy := gateway.NewProxy(apiGateway, rateLimiter, wafEngine, wafPolicies, monitorStore, func(r *http.Request) (string, string, error) {
+		claims, err := middleware.Authenticate(r, userStore)
+		if err != nil {
+			return "", "", err
+		}
+		userID, _ := claims["user_id"].(string)
+		role, _ := claims["role"].(string)
+		return userID, role, nil
+	})
 
 	phishingManager := phishing.NewPhishingManager(db)
 	telemetryEngine := hardware.NewTelemetryEngine(db)
@@ -205,6 +386,8 @@ func NewServer(secretsManager secrets.Manager) *Server {
 	admissionEngine := redhat.NewAdmissionEngine(db)
 	raspEngine := redhat.NewRASPEngine(db)
 	edrEngine := redhat.NewEDREngine(db)
+	edrEngine.SetEmitter(eventBus)
+	honeypotManager.SetEmitter(eventBus)
 	schemaEngine := redhat.NewSchemaEngine(db)
 	botEngine := redhat.NewBotEngine(db)
 	sbomEngine := redhat.NewSBOMEngine()
@@ -223,26 +406,69 @@ func NewServer(secretsManager secrets.Manager) *Server {
 	digitalTwinEngine := redhat.NewDigitalTwinEngine(db)
 	godModeEngine := redhat.NewGodModeEngine(db)
 	simEngine := simulation.NewSimulationEngine(db)
+	simEngine.SetEmitter(eventBus)
+
+	eventBus.Subscribe(events.Subscription{Name: "automation", Handler: automationEngine.HandleEvent})
+	eventBus.Subscribe(events.Subscription{
+		Name:    "integrations",
+		Types:   []string{events.TypeFindingCreated, events.TypeDetectionRaised},
+		Handler: integrationManager.HandleEvent,
+	})
+	eventBus.Subscribe(events.Subscription{Name: "audit", Handler: auditLog.Handle})
+	// Every replica keeps its own index
+	eventBus.Subscribe(events.Subscription{
+		Name:      "knowledge",
+		Types:     []string{events.TypeFindingCreated, events.TypeScanCompleted, events.TypeIPBlocked, events.TypeIPUnblocked, events.TypePlaybookCompleted},
+		Broadcast: true,
+		Handler:   knowledgeIndexer.HandleEvent,
+	})
+	// The hub fans events out to every replica, so one replica forwards each
+	eventBus.Subscribe(events.Subscription{Name: "websocket", Handler: wsManager.HandleEvent})
+	eventBus.Start()
+	knowledgeIndexer.Start()
+	exploitIntel.Start()
 
 	s := &Server{
 		router:             r,
 		userStore:          userStore,
+		groupStore:         groupStore,
+		loginGuard:         loginGuard,
+		wafEngine:          wafEngine,
+		wafPolicies:        wafPolicies,
+		tokenStore:         tokenStore,
+		passwordPolicy:     passwordPolicy,
+		mailer:             mail,
 		orchestrator:       orchestrator,
+		sastScanner:        sastScanner,
+		exploitIntel:       exploitIntel,
 		scheduler:          sched,
 		wsManager:          wsManager,
+		eventBus:           eventBus,
+		auditLog:           auditLog,
+		llm:                llm,
+		aiMeter:            aiMeter,
+		knowledgeIndex:     knowledgeIndex,
 		aiEngine:           aiEngine,
+		fixer:              fixer,
+		queryEngine:        logquery.NewEngine(db),
+		queryTranslator:    logquery.NewTranslator(llm),
 		monitorStore:       monitorStore,
+		firewall:           firewallEnforcer,
 		complianceManager:  complianceManager,
 		cloudManager:       cloudManager,
 		integrationManager: integrationManager,
 		automationEngine:   automationEngine,
+		playbooks:          playbookStore,
 		uebaEngine:         uebaEngine,
 		honeypotManager:    honeypotManager,
 		apiGateway:         apiGateway,
+		rateLimiter:        rateLimiter,
+		gatewayProxy:       gatewayProxy,
 		containerScanner:   containerScanner,
 		iacScanner:         iacScanner,
 		awsScanner:         awsScanner,
 		chatEngine:         chatEngine,
+		conversations:      conversations,
 		phishingManager:    phishingManager,
 		telemetryEngine:    telemetryEngine,
 		itdrEngine:         itdrEngine,
@@ -302,22 +528,47 @@ func NewServer(secretsManager secrets.Manager) *Server {
 func (s *Server) RegisterRoutes() {
 	// Middleware
 	s.router.Use(middleware.CORSMiddleware())
-	s.router.Use(middleware.RateLimitMiddleware(rate.Limit(10), 20)) // 10 req/s, burst 20
+	s.router.Use(middleware.RateLimitMiddleware(s.rateLimiter, s.apiGateway))
 	s.router.Use(middleware.SecurityHeaders())
 	s.router.Use(middleware.MetricsMiddleware())
-	s.router.Use(middleware.SecurityMiddleware(s.monitorStore))
+	challengeDifficulty, _ := strconv.Atoi(getEnv("CHALLENGE_DIFFICULTY", "18"))
+	challenger := middleware.NewChallenger([]byte(getEnv("CHALLENGE_SECRET", string(jwtSecret))), challengeDifficulty)
+	s.router.Use(middleware.GeoPolicyMiddleware(s.monitorStore, challenger))
+	s.router.Use(middleware.SecurityMiddleware(s.monitorStore, s.wafEngine, s.wafPolicies))
 
-	// WebSocket
+	// WebSocket and Server-Sent Events
 	s.router.GET("/ws", s.serveWs)
+	s.router.GET("/sse", s.serveSSE)
 
 	// Metrics
 	s.router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	// Reverse proxy for upstreams registered with the API gateway
+	s.router.Any(gateway.ProxyPrefix+"/*path", s.gatewayProxy.Handle)
+
+	// SCIM provisioning (only when the IdP token is configured)
+	if scimToken, _ := s.secretsManager.GetSecret("SCIM_BEARER_TOKEN"); scimToken != "" {
+		baseURL := getEnv("SCIM_BASE_URL", "http://localhost:"+getEnv("PORT", "8080")+"/scim/v2")
+		scim.NewHandler(s.userStore, s.groupStore, scimToken, baseURL).Register(s.router.Group("/scim/v2"))
+	} else {
+		slog.Info("SCIM_BEARER_TOKEN is not set. SCIM provisioning is disabled.")
+	}
+
+	// Honeypot sensors report hits (only when their token is configured)
+	if honeypotToken, _ := s.secretsManager.GetSecret("HONEYPOT_TOKEN"); honeypotToken != "" {
+		s.router.POST("/api/v1/webhooks/honeypots/:id/hits", middleware.RequireBearer(honeypotToken), s.recordHoneypotHit)
+	} else {
+		slog.Info("HONEYPOT_TOKEN is not set. Honeypot hit reporting is disabled.")
+	}
+
 	v1 := s.router.Group("/api/v1")
 	{
 		// Auth Routes
 		v1.POST("/auth/register", s.register)
 		v1.POST("/auth/login", s.login)
+		v1.POST("/auth/verify-email", s.verifyEmail)
+		v1.POST("/auth/password/forgot", s.forgotPassword)
+		v1.POST("/auth/password/reset", s.resetPassword)
 
 		// Public Routes (Webhooks)
 		v1.POST("/webhooks/stripe", s.handleStripeWebhook)
@@ -325,16 +576,29 @@ func (s *Server) RegisterRoutes() {
 
 		// Protected Routes
 		authenticated := v1.Group("/")
-		authenticated.Use(middleware.AuthMiddleware())
+		authenticated.Use(middleware.AuthMiddleware(s.userStore), withAICaller)
 		{
+			// Account Routes
+			authenticated.POST("/auth/verify-email/resend", s.resendVerification)
+
 			// Scan Routes
 			authenticated.POST("/scan", s.startScan)
 			authenticated.GET("/scan/:id", s.getScanStatus)
 			authenticated.GET("/scan/:id/results", s.getScanResults)
 			authenticated.GET("/scans/history", s.getScanHistory)
+			authenticated.POST("/sast/scans", s.startSASTScan)
+			authenticated.GET("/sast/scans", s.getSASTScans)
+			authenticated.GET("/sast/scans/:id", s.getSASTScan)
+			authenticated.GET("/sast/rules", s.getSASTRules)
 
 			// Dashboard Routes
 			authenticated.GET("/dashboard/stats", s.getDashboardStats)
+			authenticated.GET("/findings", s.getFindings)
+			authenticated.GET("/intel/feeds", s.getIntelStatus)
+			authenticated.POST("/intel/feeds/refresh", middleware.RequireRole("admin"), s.refreshIntel)
+			authenticated.PUT("/intel/feeds/:feed", middleware.RequireRole("admin"), s.importIntelFeed)
+			authenticated.GET("/intel/cve/:id", s.getCVEIntel)
+			authenticated.GET("/intel/cvss", s.parseCVSS)
 
 			// Phishing Routes
 			authenticated.GET("/phishing/campaigns", s.getPhishingCampaigns)
@@ -349,16 +613,68 @@ func (s *Server) RegisterRoutes() {
 
 			// Remediation Routes
 			authenticated.POST("/remediate/fix", s.generateFix)
-			authenticated.POST("/remediate/pr", s.createFixPR)
+			authenticated.POST("/remediate/pr", middleware.RequireRole("admin"), s.createFixPR)
+
+			// Log Query Routes
+			authenticated.GET("/logs/query/schema", s.getLogQuerySchema)
+			authenticated.POST("/logs/query/translate", s.translateLogQuery)
+			authenticated.POST("/logs/query", s.runLogQuery)
 
 			// Chat Routes
 			authenticated.POST("/chat", s.handleChat)
+			authenticated.GET("/chat/conversations", s.listConversations)
+			authenticated.POST("/chat/conversations", s.createConversation)
+			authenticated.GET("/chat/conversations/:id", s.getConversation)
+			authenticated.PATCH("/chat/conversations/:id", s.updateConversation)
+			authenticated.DELETE("/chat/conversations/:id", s.deleteConversation)
+			authenticated.POST("/chat/conversations/:id/messages", s.sendChatMessage)
+			authenticated.GET("/ai/status", s.getAIStatus)
+			authenticated.GET("/ai/usage", s.getAIUsage)
+			authenticated.GET("/ai/budgets", s.getAIBudgets)
+			authenticated.PUT("/ai/budgets", middleware.RequireRole("admin"), s.setAIBudget)
+			authenticated.DELETE("/ai/budgets/:scope", middleware.RequireRole("admin"), s.deleteAIBudget)
 
 			// Monitor Routes
 			authenticated.GET("/monitor/logs", s.getMonitorLogs)
+			authenticated.GET("/monitor/logs/stats", s.getMonitorLogStats)
+			authenticated.POST("/monitor/logs/prune", middleware.RequireRole("admin"), s.pruneMonitorLogs)
+			authenticated.POST("/monitor/logs/scrub", middleware.RequireRole("admin"), s.scrubMonitorLogs)
+			authenticated.GET("/monitor/logs/archives", s.getLogArchives)
+			authenticated.GET("/monitor/logs/archives/:name", middleware.RequireRole("admin"), s.downloadLogArchive)
 			authenticated.GET("/monitor/blocked", s.getBlockedIPs)
-			authenticated.POST("/monitor/block", s.blockIP)
-			authenticated.POST("/monitor/unblock/:ip", s.unblockIP)
+			authenticated.GET("/monitor/blocked/:id", s.getBlockedIP)
+			authenticated.POST("/monitor/block", middleware.RequireRole("admin"), s.blockIP)
+			authenticated.POST("/monitor/unblock/*ip", middleware.RequireRole("admin"), s.unblockIP)
+			authenticated.GET("/monitor/allowed", s.getAllowedIPs)
+			authenticated.POST("/monitor/allow", middleware.RequireRole("admin"), s.allowIP)
+			authenticated.DELETE("/monitor/allow/*ip", middleware.RequireRole("admin"), s.removeAllowedIP)
+			authenticated.GET("/monitor/blocklist/export", s.exportBlocklist)
+			authenticated.POST("/monitor/blocklist/import", middleware.RequireRole("admin"), s.importBlocklist)
+			authenticated.GET("/monitor/firewall", s.getFirewallStatus)
+			authenticated.GET("/monitor/firewall/blocks", s.getFirewallBlocks)
+			authenticated.POST("/monitor/firewall/sync", middleware.RequireRole("admin"), s.syncFirewall)
+			authenticated.POST("/monitor/logs/:id/false-positive", middleware.RequireRole("admin"), s.markFalsePositive)
+			authenticated.GET("/monitor/geo/policies", s.getGeoPolicies)
+			authenticated.PUT("/monitor/geo/policies", middleware.RequireRole("admin"), s.saveGeoPolicy)
+			authenticated.DELETE("/monitor/geo/policies/:id", middleware.RequireRole("admin"), s.deleteGeoPolicy)
+			authenticated.GET("/monitor/stats/countries", s.getTopCountries)
+			authenticated.GET("/monitor/stats/asns", s.getTopASNs)
+
+			// WAF Routes
+			authenticated.GET("/monitor/waf/policies", s.getWAFPolicies)
+			authenticated.PUT("/monitor/waf/policies", middleware.RequireRole("admin"), s.saveWAFPolicy)
+			authenticated.DELETE("/monitor/waf/policies/:id", middleware.RequireRole("admin"), s.deleteWAFPolicy)
+			authenticated.GET("/monitor/waf/exclusions", s.getWAFExclusions)
+			authenticated.POST("/monitor/waf/exclusions", middleware.RequireRole("admin"), s.createWAFExclusion)
+			authenticated.DELETE("/monitor/waf/exclusions/:id", middleware.RequireRole("admin"), s.deleteWAFExclusion)
+			authenticated.GET("/monitor/waf/stats", s.getWAFStats)
+			authenticated.POST("/monitor/waf/reload", middleware.RequireRole("admin"), s.reloadWAFRules)
+
+			// Event Bus Routes
+			authenticated.GET("/events/status", s.getEventStatus)
+			authenticated.GET("/events/dead-letters", s.getDeadLetters)
+			authenticated.POST("/events/dead-letters/:id/redeliver", middleware.RequireRole("admin"), s.redeliverDeadLetter)
+			authenticated.GET("/audit", s.getAuditLog)
 
 			// Compliance Routes
 			authenticated.GET("/compliance/standards", s.getComplianceStandards)
@@ -378,6 +694,17 @@ func (s *Server) RegisterRoutes() {
 
 			// Automation routes
 			authenticated.GET("/playbooks", s.getPlaybooks)
+			authenticated.POST("/playbooks", s.createPlaybook)
+			authenticated.GET("/playbooks/schema", s.getPlaybookSchema)
+			authenticated.GET("/playbooks/export", s.exportPlaybooks)
+			authenticated.POST("/playbooks/import", s.importPlaybooks)
+			authenticated.GET("/playbooks/:id", s.getPlaybook)
+			authenticated.PUT("/playbooks/:id", s.updatePlaybook)
+			authenticated.DELETE("/playbooks/:id", s.deletePlaybook)
+			authenticated.PUT("/playbooks/:id/permissions", s.setPlaybookPermissions)
+			authenticated.GET("/playbooks/:id/versions", s.getPlaybookVersions)
+			authenticated.GET("/playbooks/:id/runs", s.getPlaybookRuns)
+			authenticated.POST("/playbooks/:id/versions/:version/rollback", s.rollbackPlaybook)
 			authenticated.POST("/playbooks/:id/run", s.runPlaybook)
 			authenticated.POST("/playbooks/:id/toggle", s.togglePlaybook)
 
@@ -393,7 +720,18 @@ func (s *Server) RegisterRoutes() {
 
 			// Gateway routes
 			authenticated.GET("/gateway/rules", s.getGatewayRules)
-			authenticated.POST("/gateway/rules/:id/toggle", s.toggleGatewayRule)
+			authenticated.POST("/gateway/rules", middleware.RequireRole("admin"), s.createGatewayRule)
+			authenticated.PUT("/gateway/rules/:id", middleware.RequireRole("admin"), s.updateGatewayRule)
+			authenticated.DELETE("/gateway/rules/:id", middleware.RequireRole("admin"), s.deleteGatewayRule)
+			authenticated.POST("/gateway/rules/:id/toggle", middleware.RequireRole("admin"), s.toggleGatewayRule)
+			authenticated.GET("/gateway/upstreams", s.getGatewayUpstreams)
+			authenticated.POST("/gateway/upstreams", middleware.RequireRole("admin"), s.saveGatewayUpstream)
+			authenticated.PUT("/gateway/upstreams/:id", middleware.RequireRole("admin"), s.saveGatewayUpstream)
+			authenticated.DELETE("/gateway/upstreams/:id", middleware.RequireRole("admin"), s.deleteGatewayUpstream)
+			authenticated.GET("/gateway/routes", s.getGatewayRoutes)
+			authenticated.POST("/gateway/routes", middleware.RequireRole("admin"), s.saveGatewayRoute)
+			authenticated.PUT("/gateway/routes/:id", middleware.RequireRole("admin"), s.saveGatewayRoute)
+			authenticated.DELETE("/gateway/routes/:id", middleware.RequireRole("admin"), s.deleteGatewayRoute)
 
 			// Container Routes
 			authenticated.GET("/containers/scan", s.getContainerScans)
@@ -488,6 +826,16 @@ func (s *Server) serveWs(c *gin.Context) {
 	s.wsManager.HandleConnections(c)
 }
 
+func (s *Server) serveSSE(c *gin.Context) {
+	s.wsManager.HandleSSE(c)
+}
+
+// realtimeLogSize is the number of events kept for SSE replay
+func realtimeLogSize() int {
+	n, _ := strconv.Atoi(os.Getenv("REALTIME_LOG_SIZE"))
+	return n
+}
+
 // Handlers
 
 func (s *Server) startScan(c *gin.Context) {
@@ -583,12 +931,14 @@ func (s *Server) generateFix(c *gin.Context) {
 		return
 	}
 
-	if s.aiEngine == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI Engine not initialized"})
+	fix, err := s.aiEngine.GenerateFix(c.Request.Context(), req.Title, req.Description, req.TechStack)
+	if aiLimitError(c, err) {
+		return
+	}
+	if errors.Is(err, ai.ErrNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI remediation is disabled: no provider configured"})
 		return
 	}
-
-	fix, err := s.aiEngine.GenerateFix(c.Request.Context(), req.Title, req.Description, req.TechStack)
 	if err != nil {
 		slog.Error("AI Generation Error", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate fix"})
@@ -600,31 +950,37 @@ func (s *Server) generateFix(c *gin.Context) {
 	})
 }
 
+// createFixPR fixes a finding in a configured repository and opens a pull
+// request. The patch is rejected, without a pull request, if it does not
+// apply or the repository's checks fail.
 func (s *Server) createFixPR(c *gin.Context) {
-	var req struct {
-		Repo   string `json:"repo"`
-		Branch string `json:"branch"`
-		Title  string `json:"title"`
-		Body   string `json:"body"`
-	}
+	var req autofix.Request
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if s.aiEngine == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI Engine not initialized"})
+	result, err := s.fixer.CreatePR(c.Request.Context(), req)
+	if aiLimitError(c, err) {
 		return
 	}
-
-	prURL, err := s.aiEngine.CreateFixPR(c.Request.Context(), req.Repo, req.Branch, req.Title, req.Body)
-	if err != nil {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusCreated, result)
+	case errors.Is(err, ai.ErrNotConfigured):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI remediation is disabled: no provider configured"})
+	case errors.Is(err, autofix.ErrNoRepository):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, autofix.ErrFindingNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Finding not found"})
+	case errors.Is(err, autofix.ErrNoLocation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, autofix.ErrPatchRejected), errors.Is(err, autofix.ErrChecksFailed):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "result": result})
+	default:
 		slog.Error("PR Creation Error", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PR"})
-		return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PR", "result": result})
 	}
-
-	c.JSON(http.StatusOK, gin.H{"pr_url": prURL})
 }
 
 func (s *Server) handleChat(c *gin.Context) {
@@ -634,19 +990,26 @@ func (s *Server) handleChat(c *gin.Context) {
 		return
 	}
 
-	if s.chatEngine == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Chat Engine not initialized"})
+	response, err := s.chatEngine.ProcessQuery(c.Request.Context(), req)
+	if aiLimitError(c, err) {
+		return
+	}
+	if errors.Is(err, ai.ErrNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI chat is disabled: no provider configured"})
 		return
 	}
-
-	response, err := s.chatEngine.ProcessQuery(c.Request.Context(), req)
 	if err != nil {
 		slog.Error("Chat processing failed", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process chat query: %v", err)})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"response": response})
+	c.JSON(http.StatusOK, response)
+}
+
+// getAIStatus lets the UI hide features that have no provider
+func (s *Server) getAIStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": s.llm.Providers(), "features": s.llm.Status(), "index": s.knowledgeIndex.Len()})
 }
 
 func (s *Server) getComplianceStandards(c *gin.Context) {
@@ -736,29 +1099,6 @@ func (s *Server) sendTestIntegrationMessage(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Test message sent"})
 }
 
-func (s *Server) getPlaybooks(c *gin.Context) {
-	playbooks := s.automationEngine.GetPlaybooks()
-	c.JSON(http.StatusOK, gin.H{"playbooks": playbooks})
-}
-
-func (s *Server) runPlaybook(c *gin.Context) {
-	id := c.Param("id")
-	if err := s.automationEngine.RunPlaybook(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Playbook executed successfully"})
-}
-
-func (s *Server) togglePlaybook(c *gin.Context) {
-	id := c.Param("id")
-	if err := s.automationEngine.TogglePlaybook(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Playbook toggled"})
-}
-
 func (s *Server) generateCustomReport(c *gin.Context) {
 	var config reporting.ReportConfig
 	if err := c.ShouldBindJSON(&config); err != nil {
@@ -809,6 +1149,33 @@ func (s *Server) getHoneypots(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"honeypots": honeypots})
 }
 
+// recordHoneypotHit counts an interaction reported by a honeypot sensor,
+// which can trigger playbooks
+func (s *Server) recordHoneypotHit(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid honeypot ID"})
+		return
+	}
+	var hit honeypot.Hit
+	if err := c.ShouldBindJSON(&hit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	node, err := s.honeypotManager.RecordHit(uint(id), hit)
+	switch {
+	case errors.Is(err, honeypot.ErrHoneypotNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, honeypot.ErrInvalidSource):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		slog.Error("Failed to record honeypot hit", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record hit"})
+	default:
+		c.JSON(http.StatusOK, node)
+	}
+}
+
 func (s *Server) getGatewayRules(c *gin.Context) {
 	rules := s.apiGateway.GetRules()
 	c.JSON(http.StatusOK, gin.H{"rules": rules})
@@ -823,6 +1190,42 @@ func (s *Server) toggleGatewayRule(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Rule toggled"})
 }
 
+func (s *Server) createGatewayRule(c *gin.Context) {
+	var rule models.GatewayRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = 0
+	if err := s.apiGateway.CreateRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (s *Server) updateGatewayRule(c *gin.Context) {
+	var update models.GatewayRule
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule, err := s.apiGateway.UpdateRule(c.Param("id"), update)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (s *Server) deleteGatewayRule(c *gin.Context) {
+	if err := s.apiGateway.DeleteRule(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted"})
+}
+
 func (s *Server) getContainerScans(c *gin.Context) {
 	results := s.containerScanner.GetScans()
 	c.JSON(http.StatusOK, gin.H{"results": results})
@@ -846,12 +1249,21 @@ func (s *Server) getDashboardStats(c *gin.Context) {
 		High     int `json:"high"`
 		Medium   int `json:"medium"`
 		Low      int `json:"low"`
-		Score    int `json:"score"`
+		// Findings in the KEV catalog
+		KnownExploited int `json:"known_exploited"`
+		Score          int `json:"score"`
 	}
 
+	// Each finding weighs its priority, so a known exploited critical
+	// finding costs 9.5 points and one unlikely to be exploited about 6
+	weightedVulns := 0.0
 	for _, scan := range history {
 		for _, vuln := range scan.Vulnerabilities {
 			stats.Vulns++
+			weightedVulns += intel.Priority(vuln) / 10
+			if vuln.KnownExploited {
+				stats.KnownExploited++
+			}
 			switch vuln.Severity {
 			case "Critical":
 				stats.Critical++
@@ -865,9 +1277,7 @@ func (s *Server) getDashboardStats(c *gin.Context) {
 		}
 	}
 
-	// Calculate simple score (inverse of weighted vulns)
-	weightedVulns := (stats.Critical * 10) + (stats.High * 5) + (stats.Medium * 2) + stats.Low
-	stats.Score = 100 - weightedVulns
+	stats.Score = 100 - int(math.Round(weightedVulns))
 	if stats.Score < 0 {
 		stats.Score = 0
 	}
@@ -875,6 +1285,42 @@ func (s *Server) getDashboardStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// wafConfigFromEnv reads WAF_RULES_DIR, WAF_PARANOIA_LEVEL and
+// WAF_ANOMALY_THRESHOLD
+func wafConfigFromEnv() waf.Config {
+	cfg := waf.DefaultConfig()
+	cfg.RulesDir = os.Getenv("WAF_RULES_DIR")
+	if n, err := strconv.Atoi(os.Getenv("WAF_PARANOIA_LEVEL")); err == nil {
+		cfg.Paranoia = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("WAF_ANOMALY_THRESHOLD")); err == nil {
+		cfg.Threshold = n
+	}
+	return cfg
+}
+
+// logPolicyFromEnv reads LOG_SAMPLE_RATE, LOG_SKIP_PATHS,
+// LOG_KEEP_BENIGN_PAYLOAD, LOG_RETENTION_DAYS, LOG_BENIGN_RETENTION_DAYS and
+// LOG_ARCHIVE_DIR
+func logPolicyFromEnv() database.LogPolicy {
+	p := database.DefaultLogPolicy()
+	if f, err := strconv.ParseFloat(os.Getenv("LOG_SAMPLE_RATE"), 64); err == nil && f >= 0 && f <= 1 {
+		p.BenignSampleRate = f
+	}
+	if v, ok := os.LookupEnv("LOG_SKIP_PATHS"); ok {
+		p.SkipPaths = strings.Split(v, ",")
+	}
+	p.KeepBenignPayload = os.Getenv("LOG_KEEP_BENIGN_PAYLOAD") == "true"
+	if n, err := strconv.Atoi(os.Getenv("LOG_RETENTION_DAYS")); err == nil {
+		p.Retention = time.Duration(n) * 24 * time.Hour
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOG_BENIGN_RETENTION_DAYS")); err == nil {
+		p.BenignRetention = time.Duration(n) * 24 * time.Hour
+	}
+	p.ArchiveDir = os.Getenv("LOG_ARCHIVE_DIR")
+	return p
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -1111,18 +1557,19 @@ func (s *Server) handleAWSWebhook(c *gin.Context) {
 		return
 	}
 
-	alert, err := s.awsScanner.HandleCloudTrailEvent(event)
-	if err != nil {
-		slog.Error("Failed to handle AWS event", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal processing error"})
+	alert := scanner.CloudTrailAlert(event)
+	if alert == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "processed", "alert": ""})
 		return
 	}
 
-	if alert != "" {
-		slog.Warn("AWS Security Alert", "alert", alert)
-		// In a real system, we'd trigger an incident or notification here
-		// s.notificationManager.Send(alert)
+	slog.Warn("AWS Security Alert", "alert", alert.Message)
+	// Stored so alerts can be searched with the log queries
+	if err := s.monitorStore.CreateCloudTrailAlert(alert); err != nil {
+		slog.Error("Failed to store AWS alert", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal processing error"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "processed", "alert": alert})
+	c.JSON(http.StatusOK, gin.H{"status": "processed", "alert": alert.Message})
 }
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/realtime"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Comment lines keep proxies from closing idle streams
+	sseKeepAlive = 15 * time.Second
+	// Sent when events after Last-Event-ID are no longer in the log, so
+	// the client should reload its state
+	sseResetType = "stream.reset"
+)
+
+// HandleSSE streams the events of the topics query parameter as
+// Server-Sent Events, for clients that cannot use WebSockets. EventSource
+// cannot set headers, so the token may be passed as ?token=. On reconnect
+// the events missed since Last-Event-ID are replayed from the hub's log.
+func (m *WebSocketManager) HandleSSE(c *gin.Context) {
+	userID, err := m.authenticate(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var topics []string
+	for _, t := range strings.Split(c.Query("topics"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			topics = append(topics, t)
+		}
+	}
+	// Register before replaying, so no event falls between the two
+	client := m.register(nil, userID)
+	defer m.remove(client)
+	reply := m.subscribe(client, topics)
+	if len(reply.Topics) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid topics", "rejected": reply.Rejected})
+		return
+	}
+	subscribed := make(map[string]bool, len(reply.Topics))
+	for _, t := range reply.Topics {
+		subscribed[t] = true
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	// Live events up to the last replayed one were already sent
+	var replayed string
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	if lastID != "" {
+		missed, complete, err := m.hub.Since(c.Request.Context(), lastID)
+		if err != nil {
+			slog.Warn("Failed to replay realtime events", "error", err)
+		}
+		if !complete || err != nil {
+			writeSSE(w, realtime.Event{Type: sseResetType, Time: time.Now().UTC(), Data: gin.H{"last_event_id": lastID}})
+		}
+		for _, e := range missed {
+			if subscribed[e.Topic] {
+				if writeSSE(w, e) != nil {
+					return
+				}
+			}
+			replayed = e.ID
+		}
+	}
+	w.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-client.done:
+			return
+		case msg := <-client.send:
+			e, ok := msg.(realtime.Event)
+			if !ok {
+				continue
+			}
+			if replayed != "" && e.ID != "" && realtime.CompareIDs(e.ID, replayed) <= 0 {
+				continue
+			}
+			if writeSSE(w, e) != nil {
+				return
+			}
+			w.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
+
+// writeSSE writes one event; the data line is the same envelope sent over
+// WebSockets
+func writeSSE(w gin.ResponseWriter, e realtime.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", e.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
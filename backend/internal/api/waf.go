@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cybershield-ai/core/internal/waf"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WAFRouteRequest struct {
+	PathPrefix string `json:"path_prefix" binding:"required"`
+	Mode       string `json:"mode" binding:"required"`
+}
+
+type WAFExclusionRequest struct {
+	RuleID     string `json:"rule_id"`
+	PathPrefix string `json:"path_prefix"`
+	Parameter  string `json:"parameter"`
+	Role       string `json:"role"`
+	Reason     string `json:"reason"`
+}
+
+type FalsePositiveRequest struct {
+	// "parameter" (default) excludes each matched rule only for the
+	// parameter it fired on; "rule" excludes the matched rules for the
+	// whole route
+	Scope  string `json:"scope"`
+	Role   string `json:"role"` // Limit the exclusion to callers with this role
+	Reason string `json:"reason"`
+}
+
+func (s *Server) getWAFPolicies(c *gin.Context) {
+	routes, err := s.wafPolicies.ListRoutes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch WAF policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"default_mode": s.wafPolicies.Policy().DefaultMode,
+		"routes":       routes,
+	})
+}
+
+func (s *Server) saveWAFPolicy(c *gin.Context) {
+	var req WAFRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mode, err := waf.ParseMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !strings.HasPrefix(req.PathPrefix, "/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path_prefix must start with /"})
+		return
+	}
+
+	route, err := s.wafPolicies.SaveRoute(req.PathPrefix, mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save WAF policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, route)
+}
+
+func (s *Server) deleteWAFPolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+		return
+	}
+	if err := s.wafPolicies.DeleteRoute(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete WAF policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "WAF policy deleted"})
+}
+
+func (s *Server) getWAFExclusions(c *gin.Context) {
+	exclusions, err := s.wafPolicies.ListExclusions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch WAF exclusions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exclusions": exclusions})
+}
+
+func (s *Server) createWAFExclusion(c *gin.Context) {
+	var req WAFExclusionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RuleID == "" && req.PathPrefix == "" && req.Parameter == "" && req.Role == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An exclusion needs at least one of rule_id, path_prefix, parameter or role"})
+		return
+	}
+
+	exclusion := &waf.Exclusion{
+		RuleID:     req.RuleID,
+		PathPrefix: req.PathPrefix,
+		Parameter:  req.Parameter,
+		Role:       req.Role,
+		Reason:     req.Reason,
+		CreatedBy:  currentUserID(c),
+	}
+	if err := s.wafPolicies.CreateExclusion(exclusion); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create WAF exclusion"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, exclusion)
+}
+
+func (s *Server) deleteWAFExclusion(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exclusion ID"})
+		return
+	}
+	if err := s.wafPolicies.DeleteExclusion(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete WAF exclusion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "WAF exclusion deleted"})
+}
+
+// markFalsePositive turns the rule matches on a security log into
+// exclusions for that route, and lifts the automatic IP block if the
+// request caused one
+func (s *Server) markFalsePositive(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log ID"})
+		return
+	}
+
+	var req FalsePositiveRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Scope == "" {
+		req.Scope = "parameter"
+	}
+	if req.Scope != "parameter" && req.Scope != "rule" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be parameter or rule"})
+		return
+	}
+
+	entry, err := s.monitorStore.GetSecurityLog(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Log not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch log"})
+		return
+	}
+	if len(entry.Matches) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Log has no WAF rule matches"})
+		return
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "False positive on security log " + strconv.FormatUint(id, 10)
+	}
+	logID := entry.ID
+
+	var exclusions []*waf.Exclusion
+	for _, m := range entry.Matches {
+		exclusion := &waf.Exclusion{
+			RuleID:        m.RuleID,
+			PathPrefix:    entry.Path,
+			Role:          req.Role,
+			Reason:        reason,
+			CreatedBy:     currentUserID(c),
+			SecurityLogID: &logID,
+		}
+		if req.Scope == "parameter" {
+			exclusion.Parameter = m.Target
+		}
+		if err := s.wafPolicies.CreateExclusion(exclusion); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create WAF exclusion"})
+			return
+		}
+		exclusions = append(exclusions, exclusion)
+	}
+
+	if entry.Status == "Blocked" {
+		if err := s.monitorStore.UnblockIP(entry.IPAddress); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock IP"})
+			return
+		}
+	}
+	if err := s.monitorStore.SetSecurityLogStatus(entry.ID, "False Positive"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exclusions": exclusions})
+}
+
+func (s *Server) getWAFStats(c *gin.Context) {
+	c.JSON(http.StatusOK, s.wafEngine.Stats())
+}
+
+func (s *Server) reloadWAFRules(c *gin.Context) {
+	if err := s.wafEngine.Reload(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "WAF rules reloaded", "rules": len(s.wafEngine.Rules())})
+}
+
+func currentUserID(c *gin.Context) string {
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(string)
+	return id
+}
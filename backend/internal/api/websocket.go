@@ -1,83 +1,364 @@
 package api
 
 import (
-	"log"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/cybershield-ai/core/internal/middleware"
+	"github.com/cybershield-ai/core/internal/realtime"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for dev
-	},
+const (
+	// Events queued per client before it is evicted as a slow consumer
+	wsSendBuffer = 256
+	// Time allowed to write one message
+	wsWriteWait = 10 * time.Second
+	// Clients that do not answer pings within this are dropped
+	wsPongWait = 60 * time.Second
+	// Must be shorter than wsPongWait
+	wsPingPeriod = wsPongWait * 9 / 10
+	// Largest client message; clients only send subscription requests
+	wsMaxMessage = 4096
+	// Browsers cannot set headers on WebSocket requests, so the token may
+	// instead be sent as the second of two subprotocols: "bearer, <token>"
+	wsTokenProtocol = "bearer"
+)
+
+// wsRequest is a message from a client
+type wsRequest struct {
+	Action string   `json:"action"` // subscribe or unsubscribe
+	Topics []string `json:"topics"`
 }
 
-type LogMessage struct {
-	Timestamp string `json:"timestamp"`
-	Level     string `json:"level"`
-	Message   string `json:"message"`
+// wsReply acknowledges a request
+type wsReply struct {
+	Type     string   `json:"type"` // subscribed, unsubscribed or error
+	Topics   []string `json:"topics,omitempty"`
+	Rejected []string `json:"rejected,omitempty"` // Unknown topics
+	Error    string   `json:"error,omitempty"`
+}
+
+// wsClient is a connected WebSocket or Server-Sent Events client
+type wsClient struct {
+	conn   *websocket.Conn // Nil for Server-Sent Events
+	userID string
+	send   chan any
+	topics map[string]bool // Guarded by WebSocketManager.mutex
+
+	done    chan struct{}
+	once    sync.Once
+	evicted atomic.Bool
 }
 
+// WebSocketManager pushes realtime events to authenticated clients that
+// subscribe to topics, over WebSockets or Server-Sent Events. Events are
+// published through the hub, which fans them out to every replica; each
+// replica only tracks its own clients. Each client has a bounded send
+// queue; a client that falls behind is disconnected rather than slowing
+// down publishers.
 type WebSocketManager struct {
-	clients   map[*websocket.Conn]bool
-	broadcast chan LogMessage
-	mutex     sync.Mutex
+	sessions middleware.SessionValidator
+	origins  map[string]bool
+	upgrader websocket.Upgrader
+	hub      *realtime.Hub
+	// Decides per user on topics that are not open to everyone
+	authorize func(userID, topic string) bool
+
+	mutex   sync.RWMutex
+	clients map[*wsClient]bool
+	topics  map[string]map[*wsClient]bool
+}
+
+// NewWebSocketManager accepts browser connections from allowedOrigins
+// (scheme://host[:port]) and from the API's own host. Connections without
+// an Origin header, from non-browser clients, are always accepted. A nil
+// hub keeps events within this process.
+func NewWebSocketManager(sessions middleware.SessionValidator, allowedOrigins []string, hub *realtime.Hub) *WebSocketManager {
+	if hub == nil {
+		hub = realtime.NewHub(nil, "", 0)
+	}
+	m := &WebSocketManager{
+		sessions: sessions,
+		hub:      hub,
+		origins:  make(map[string]bool),
+		clients:  make(map[*wsClient]bool),
+		topics:   make(map[string]map[*wsClient]bool),
+	}
+	for _, o := range allowedOrigins {
+		if o = strings.TrimSpace(o); o != "" {
+			m.origins[strings.TrimSuffix(o, "/")] = true
+		}
+	}
+	m.upgrader = websocket.Upgrader{
+		CheckOrigin:  m.checkOrigin,
+		Subprotocols: []string{wsTokenProtocol},
+	}
+	hub.Listen(m.deliver)
+	return m
+}
+
+func (m *WebSocketManager) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || m.origins["*"] || m.origins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
-func NewWebSocketManager() *WebSocketManager {
-	return &WebSocketManager{
-		clients:   make(map[*websocket.Conn]bool),
-		broadcast: make(chan LogMessage),
+// authenticate accepts a bearer token from the Authorization header, the
+// token query parameter or the subprotocol list
+func (m *WebSocketManager) authenticate(r *http.Request) (string, error) {
+	if r.Header.Get("Authorization") == "" {
+		token := r.URL.Query().Get("token")
+		protocols := websocket.Subprotocols(r)
+		if token == "" && len(protocols) == 2 && protocols[0] == wsTokenProtocol {
+			token = protocols[1]
+		}
+		if token != "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	claims, err := middleware.Authenticate(r, m.sessions)
+	if err != nil {
+		return "", err
 	}
+	userID, _ := claims["user_id"].(string)
+	return userID, nil
 }
 
 func (m *WebSocketManager) HandleConnections(c *gin.Context) {
-	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	userID, err := m.authenticate(c.Request)
 	if err != nil {
-		log.Fatal(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
 	}
-	defer ws.Close()
 
+	conn, err := m.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already replied with an HTTP error
+		slog.Warn("WebSocket upgrade failed", "error", err)
+		return
+	}
+
+	client := m.register(conn, userID)
+	if topics := c.Query("topics"); topics != "" {
+		client.enqueue(m.subscribe(client, strings.Split(topics, ",")))
+	}
+
+	go m.writePump(client)
+	m.readPump(client)
+}
+
+func (m *WebSocketManager) register(conn *websocket.Conn, userID string) *wsClient {
+	client := &wsClient{
+		conn:   conn,
+		userID: userID,
+		send:   make(chan any, wsSendBuffer),
+		topics: make(map[string]bool),
+		done:   make(chan struct{}),
+	}
 	m.mutex.Lock()
-	m.clients[ws] = true
+	m.clients[client] = true
 	m.mutex.Unlock()
+	return client
+}
+
+// readPump handles subscription requests and pongs until the connection
+// fails
+func (m *WebSocketManager) readPump(client *wsClient) {
+	defer m.remove(client)
+
+	client.conn.SetReadLimit(wsMaxMessage)
+	client.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
 
 	for {
-		// Keep connection alive, read (and ignore) messages
-		var msg map[string]interface{}
-		err := ws.ReadJSON(&msg)
+		_, raw, err := client.conn.ReadMessage()
 		if err != nil {
-			m.mutex.Lock()
-			delete(m.clients, ws)
-			m.mutex.Unlock()
-			break
+			return
+		}
+		var req wsRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			client.enqueue(wsReply{Type: "error", Error: "invalid message"})
+			continue
+		}
+		switch req.Action {
+		case "subscribe":
+			client.enqueue(m.subscribe(client, req.Topics))
+		case "unsubscribe":
+			client.enqueue(m.unsubscribe(client, req.Topics))
+		default:
+			client.enqueue(wsReply{Type: "error", Error: "unknown action"})
 		}
 	}
 }
 
-func (m *WebSocketManager) HandleMessages() {
+// writePump is the only writer to the connection
+func (m *WebSocketManager) writePump(client *wsClient) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		client.conn.Close()
+	}()
+
 	for {
-		msg := <-m.broadcast
-		m.mutex.Lock()
-		for client := range m.clients {
-			err := client.WriteJSON(msg)
-			if err != nil {
-				client.Close()
-				delete(m.clients, client)
+		select {
+		case <-client.done:
+			if client.evicted.Load() {
+				client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+				client.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"))
+			}
+			return
+		case msg := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := client.conn.WriteJSON(msg); err != nil {
+				return
 			}
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// SetTopicAuthorizer restricts chat topics to the users authorize
+// accepts; without one, they are rejected
+func (m *WebSocketManager) SetTopicAuthorizer(authorize func(userID, topic string) bool) {
+	m.authorize = authorize
+}
+
+func (m *WebSocketManager) allowed(userID, topic string) bool {
+	if !realtime.ValidTopic(topic) {
+		return false
+	}
+	if _, ok := realtime.ChatConversation(topic); ok {
+		return m.authorize != nil && m.authorize(userID, topic)
+	}
+	return true
+}
+
+func (m *WebSocketManager) subscribe(client *wsClient, topics []string) wsReply {
+	var accepted, rejected []string
+	// Authorising may query the database, so it happens before locking
+	var allowed []string
+	for _, t := range topics {
+		t = strings.TrimSpace(t)
+		if m.allowed(client.userID, t) {
+			allowed = append(allowed, t)
+		} else {
+			rejected = append(rejected, t)
+		}
+	}
+	m.mutex.Lock()
+	for _, t := range allowed {
+		if m.topics[t] == nil {
+			m.topics[t] = make(map[*wsClient]bool)
+		}
+		m.topics[t][client] = true
+		client.topics[t] = true
+		accepted = append(accepted, t)
+	}
+	m.mutex.Unlock()
+
+	return wsReply{Type: "subscribed", Topics: accepted, Rejected: rejected}
+}
+
+func (m *WebSocketManager) unsubscribe(client *wsClient, topics []string) wsReply {
+	m.mutex.Lock()
+	for _, t := range topics {
+		m.dropTopic(client, t)
+	}
+	m.mutex.Unlock()
+	return wsReply{Type: "unsubscribed", Topics: topics}
+}
+
+// dropTopic must be called with the mutex held
+func (m *WebSocketManager) dropTopic(client *wsClient, topic string) {
+	delete(client.topics, topic)
+	if subs := m.topics[topic]; subs != nil {
+		delete(subs, client)
+		if len(subs) == 0 {
+			delete(m.topics, topic)
 		}
-		m.mutex.Unlock()
 	}
 }
 
-func (m *WebSocketManager) BroadcastLog(level, message string) {
-	msg := LogMessage{
-		Timestamp: "Now", // In real app, use time.Now().Format(...)
-		Level:     level,
-		Message:   message,
+func (m *WebSocketManager) remove(client *wsClient) {
+	m.mutex.Lock()
+	delete(m.clients, client)
+	for t := range client.topics {
+		m.dropTopic(client, t)
+	}
+	m.mutex.Unlock()
+	client.close()
+}
+
+// Publish sends an event to the subscribers of topic on every replica
+// without blocking
+func (m *WebSocketManager) Publish(topic, eventType string, data any) {
+	m.hub.Publish(topic, eventType, data)
+}
+
+// PublishTransient is like Publish, but the event is not replayed to
+// clients that reconnect
+func (m *WebSocketManager) PublishTransient(topic, eventType string, data any) {
+	m.hub.PublishTransient(topic, eventType, data)
+}
+
+// deliver queues an event for the local subscribers of its topic.
+// Subscribers whose queue is full are evicted.
+func (m *WebSocketManager) deliver(event realtime.Event) {
+	topic := event.Topic
+	var slow []*wsClient
+	m.mutex.RLock()
+	for client := range m.topics[topic] {
+		if !client.enqueue(event) {
+			slow = append(slow, client)
+		}
 	}
-	m.broadcast <- msg
+	m.mutex.RUnlock()
+
+	for _, client := range slow {
+		if client.evicted.CompareAndSwap(false, true) {
+			slog.Warn("Evicting slow realtime client", "user_id", client.userID, "topic", topic)
+		}
+		m.remove(client)
+	}
+}
+
+// Clients returns the number of connected clients
+func (m *WebSocketManager) Clients() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.clients)
+}
+
+// enqueue queues msg and reports false when the queue is full
+func (c *wsClient) enqueue(msg any) bool {
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops the write pump, which closes the connection and so ends the
+// read pump
+func (c *wsClient) close() {
+	c.once.Do(func() { close(c.done) })
 }
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/auth"
+	"github.com/cybershield-ai/core/internal/realtime"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWSServer(t *testing.T) (*WebSocketManager, string) {
+	m, url := newRealtimeServer(t)
+	return m, "ws" + strings.TrimPrefix(url, "http") + "/ws"
+}
+
+func newRealtimeServer(t *testing.T) (*WebSocketManager, string) {
+	gin.SetMode(gin.TestMode)
+	m := NewWebSocketManager(nil, []string{"https://app.example.com"}, nil)
+	r := gin.New()
+	r.GET("/ws", m.HandleConnections)
+	r.GET("/sse", m.HandleSSE)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return m, srv.URL
+}
+
+func TestWebSocket_RequiresToken(t *testing.T) {
+	_, url := newWSServer(t)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	token, err := generateToken(&auth.User{ID: "u1", Role: "admin"})
+	require.NoError(t, err)
+	header := http.Header{"Origin": {"https://evil.example.com"}}
+	_, resp, err = websocket.DefaultDialer.Dial(url+"?token="+token, header)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "unknown origins are rejected")
+}
+
+func TestWebSocket_Subscribe(t *testing.T) {
+	m, url := newWSServer(t)
+	token, err := generateToken(&auth.User{ID: "u1", Role: "admin"})
+	require.NoError(t, err)
+
+	// Token as a subprotocol, the way browsers send it
+	dialer := websocket.Dialer{Subprotocols: []string{"bearer", token}}
+	header := http.Header{"Origin": {"https://app.example.com"}}
+	conn, _, err := dialer.Dial(url+"?topics=findings", header)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var reply wsReply
+	require.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, wsReply{Type: "subscribed", Topics: []string{"findings"}}, reply)
+
+	require.NoError(t, conn.WriteJSON(wsRequest{Action: "subscribe", Topics: []string{"scan:42", "secrets"}}))
+	require.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, []string{"scan:42"}, reply.Topics)
+	assert.Equal(t, []string{"secrets"}, reply.Rejected)
+
+	m.Publish(realtime.TopicPlaybooks, "playbook.completed", "not subscribed")
+	m.Publish(realtime.ScanTopic("42"), realtime.TypeScanProgress, map[string]int{"progress": 50})
+	var event realtime.Event
+	require.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, "scan:42", event.Topic)
+	assert.Equal(t, realtime.TypeScanProgress, event.Type)
+	assert.Equal(t, map[string]any{"progress": float64(50)}, event.Data)
+	assert.Equal(t, 1, m.Clients())
+}
+
+// readSSE returns the id and event lines of the next event
+func readSSE(t *testing.T, r *bufio.Reader) (id, event string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case line == "" && event != "":
+			return id, event
+		}
+	}
+}
+
+func TestSSE_ReplaysFromLastEventID(t *testing.T) {
+	m, url := newRealtimeServer(t)
+	token, err := generateToken(&auth.User{ID: "u1", Role: "admin"})
+	require.NoError(t, err)
+
+	resp, err := http.Get(url + "/sse?topics=findings")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = http.Get(url + "/sse?topics=secrets&token=" + token)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(url + "/sse?topics=findings&token=" + token)
+	require.NoError(t, err)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	stream := bufio.NewReader(resp.Body)
+	require.Eventually(t, func() bool { return m.Clients() == 1 }, time.Second, 10*time.Millisecond)
+	m.Publish(realtime.TopicFindings, "finding.created", "first")
+	firstID, event := readSSE(t, stream)
+	assert.Equal(t, "finding.created", event)
+	resp.Body.Close()
+
+	// Published while the client is away
+	m.Publish(realtime.TopicPlaybooks, "playbook.completed", "other topic")
+	m.Publish(realtime.TopicFindings, "finding.created", "second")
+
+	req, _ := http.NewRequest("GET", url+"/sse?topics=findings&token="+token, nil)
+	req.Header.Set("Last-Event-ID", firstID)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	stream = bufio.NewReader(resp.Body)
+	secondID, _ := readSSE(t, stream)
+	assert.Equal(t, 1, realtime.CompareIDs(secondID, firstID))
+
+	m.Publish(realtime.TopicFindings, "finding.created", "third")
+	thirdID, _ := readSSE(t, stream)
+	assert.Equal(t, 1, realtime.CompareIDs(thirdID, secondID), "replayed events are not sent twice")
+}
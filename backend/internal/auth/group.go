@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Group is a set of users provisioned by the identity provider. Groups
+// listed in the RoleMapping decide the role of their members.
+type Group struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	DisplayName string    `json:"display_name" gorm:"uniqueIndex;not null"`
+	ExternalID  string    `json:"external_id,omitempty" gorm:"index"`
+	Members     []User    `json:"members" gorm:"many2many:group_members"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RoleMapping maps group display names to platform roles. Order matters:
+// a user in several mapped groups gets the role listed first.
+type RoleMapping []RoleMappingEntry
+
+type RoleMappingEntry struct {
+	Group string
+	Role  string
+}
+
+// ParseRoleMapping reads "Group A=admin;Group B=analyst"
+func ParseRoleMapping(spec string) RoleMapping {
+	var mapping RoleMapping
+	for _, pair := range strings.Split(spec, ";") {
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			continue
+		}
+		mapping = append(mapping, RoleMappingEntry{Group: group, Role: role})
+	}
+	return mapping
+}
+
+// RoleFor returns the role for a user belonging to the given groups
+func (m RoleMapping) RoleFor(groups []string) string {
+	for _, entry := range m {
+		for _, g := range groups {
+			if strings.EqualFold(entry.Group, g) {
+				return entry.Role
+			}
+		}
+	}
+	return "user"
+}
+
+// GroupStore manages provisioned groups and keeps member roles in sync
+type GroupStore struct {
+	db      *gorm.DB
+	mapping RoleMapping
+}
+
+func NewGroupStore(db *gorm.DB, mapping RoleMapping) *GroupStore {
+	return &GroupStore{db: db, mapping: mapping}
+}
+
+func (s *GroupStore) List() ([]Group, error) {
+	var groups []Group
+	err := s.db.Preload("Members").Order("created_at asc").Find(&groups).Error
+	return groups, err
+}
+
+func (s *GroupStore) Get(id string) (*Group, error) {
+	var group Group
+	if err := s.db.Preload("Members").Where("id = ?", id).First(&group).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("group not found")
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GroupsOf returns the display names of every group the user belongs to
+func (s *GroupStore) GroupsOf(userID string) ([]Group, error) {
+	var groups []Group
+	err := s.db.Joins("JOIN group_members ON group_members.group_id = groups.id").
+		Where("group_members.user_id = ?", userID).Find(&groups).Error
+	return groups, err
+}
+
+// Memberships returns the groups of every user that belongs to one, keyed
+// by user ID, in a single query
+func (s *GroupStore) Memberships() (map[string][]Group, error) {
+	var rows []struct {
+		UserID      string
+		ID          string
+		DisplayName string
+		ExternalID  string
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+	}
+	err := s.db.Table("group_members").
+		Select("group_members.user_id, groups.id, groups.display_name, groups.external_id, groups.created_at, groups.updated_at").
+		Joins("JOIN groups ON groups.id = group_members.group_id").
+		Order("groups.created_at asc").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	memberships := make(map[string][]Group)
+	for _, r := range rows {
+		memberships[r.UserID] = append(memberships[r.UserID], Group{
+			ID: r.ID, DisplayName: r.DisplayName, ExternalID: r.ExternalID, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt,
+		})
+	}
+	return memberships, nil
+}
+
+func (s *GroupStore) Create(group *Group, memberIDs []string) error {
+	group.ID = uuid.New().String()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Members").Create(group).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errors.New("group already exists")
+			}
+			return err
+		}
+		return s.setMembers(tx, group, memberIDs, nil)
+	})
+}
+
+// Save updates the group and replaces its membership, re-deriving the role
+// of everyone who joined or left
+func (s *GroupStore) Save(group *Group, memberIDs []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var previous []string
+		if err := tx.Table("group_members").Where("group_id = ?", group.ID).Pluck("user_id", &previous).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Members").Save(group).Error; err != nil {
+			return err
+		}
+		return s.setMembers(tx, group, memberIDs, previous)
+	})
+}
+
+func (s *GroupStore) Delete(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var members []string
+		if err := tx.Table("group_members").Where("group_id = ?", id).Pluck("user_id", &members).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM group_members WHERE group_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", id).Delete(&Group{}).Error; err != nil {
+			return err
+		}
+		return s.syncRoles(tx, members)
+	})
+}
+
+func (s *GroupStore) setMembers(tx *gorm.DB, group *Group, memberIDs, previous []string) error {
+	var members []User
+	if len(memberIDs) > 0 {
+		if err := tx.Where("id IN ?", memberIDs).Find(&members).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(group).Association("Members").Replace(members); err != nil {
+		return err
+	}
+	group.Members = members
+	return s.syncRoles(tx, append(previous, memberIDs...))
+}
+
+// syncRoles recomputes the role of each user from their group memberships
+func (s *GroupStore) syncRoles(tx *gorm.DB, userIDs []string) error {
+	if len(s.mapping) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, id := range userIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var names []string
+		if err := tx.Table("groups").
+			Joins("JOIN group_members ON group_members.group_id = groups.id").
+			Where("group_members.user_id = ?", id).
+			Pluck("groups.display_name", &names).Error; err != nil {
+			return err
+		}
+		// Role claims live in issued tokens, so a change revokes sessions
+		role := s.mapping.RoleFor(names)
+		revokedAt := time.Now().Truncate(time.Second)
+		if err := tx.Model(&User{}).Where("id = ? AND role <> ?", id, role).Updates(map[string]interface{}{
+			"role":                 role,
+			"sessions_valid_after": &revokedAt,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/models"
+)
+
+// AttackTypeCredential tags SecurityLog entries produced by the login guard
+const AttackTypeCredential = "Credential Attack"
+
+// GuardConfig controls how aggressively failed logins are throttled
+type GuardConfig struct {
+	Window           time.Duration // Failures older than this are forgotten
+	DelayAfter       int           // Failures per account before progressive delays start
+	BaseDelay        time.Duration // First delay, doubled on every further failure
+	MaxDelay         time.Duration
+	LockoutThreshold int // Failures per account before a temporary lockout
+	LockoutDuration  time.Duration
+	IPDelayAfter     int // Failures per IP (any account) before delays start
+	IPSprayThreshold int // Distinct accounts failed from one IP before it is blocked
+	IPBlockDuration  time.Duration
+}
+
+// DefaultGuardConfig returns the thresholds used in production
+func DefaultGuardConfig() GuardConfig {
+	return GuardConfig{
+		Window:           15 * time.Minute,
+		DelayAfter:       3,
+		BaseDelay:        time.Second,
+		MaxDelay:         30 * time.Second,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		IPDelayAfter:     10,
+		IPSprayThreshold: 5,
+		IPBlockDuration:  24 * time.Hour,
+	}
+}
+
+// LockoutNotifier is told about lockouts and blocks so the user and the
+// security team can react
+type LockoutNotifier interface {
+	AccountLocked(account, ip string, until time.Time)
+	IPBlocked(ip string, accounts []string)
+}
+
+// ThrottledError is returned when a login attempt must be refused before
+// the password is even checked
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account temporarily locked, retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+type accountRecord struct {
+	failures    []time.Time
+	nextAllowed time.Time
+	lockedUntil time.Time
+}
+
+type ipRecord struct {
+	failures    []time.Time
+	accounts    map[string]time.Time
+	nextAllowed time.Time
+}
+
+// LoginGuard tracks failed login attempts per account and per source IP
+type LoginGuard struct {
+	mu       sync.Mutex
+	cfg      GuardConfig
+	accounts map[string]*accountRecord
+	ips      map[string]*ipRecord
+	store    *database.MonitorStore
+	notifier LockoutNotifier
+	now      func() time.Time
+}
+
+func NewLoginGuard(cfg GuardConfig, store *database.MonitorStore, notifier LockoutNotifier) *LoginGuard {
+	g := &LoginGuard{
+		cfg:      cfg,
+		accounts: make(map[string]*accountRecord),
+		ips:      make(map[string]*ipRecord),
+		store:    store,
+		notifier: notifier,
+		now:      time.Now,
+	}
+	return g
+}
+
+// StartSweeper forgets idle records every interval, so the maps don't
+// grow without bound, until the returned stop func is called
+func (g *LoginGuard) StartSweeper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				g.sweep()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// Check returns a *ThrottledError if a login for account from ip must be
+// refused right now
+func (g *LoginGuard) Check(account, ip string) error {
+	account = normalizeAccount(account)
+	now := g.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if rec, ok := g.accounts[account]; ok {
+		if now.Before(rec.lockedUntil) {
+			return &ThrottledError{RetryAfter: rec.lockedUntil.Sub(now), Locked: true}
+		}
+		if now.Before(rec.nextAllowed) {
+			return &ThrottledError{RetryAfter: rec.nextAllowed.Sub(now)}
+		}
+	}
+	if rec, ok := g.ips[ip]; ok && now.Before(rec.nextAllowed) {
+		return &ThrottledError{RetryAfter: rec.nextAllowed.Sub(now)}
+	}
+	return nil
+}
+
+// RecordFailure registers a failed login and applies delays, lockouts and
+// IP blocks as thresholds are crossed
+func (g *LoginGuard) RecordFailure(account, ip, path string) {
+	account = normalizeAccount(account)
+	now := g.now()
+
+	g.mu.Lock()
+	acc := g.accounts[account]
+	if acc == nil {
+		acc = &accountRecord{}
+		g.accounts[account] = acc
+	}
+	acc.failures = append(prune(acc.failures, now.Add(-g.cfg.Window)), now)
+	accFailures := len(acc.failures)
+
+	locked := false
+	if accFailures >= g.cfg.LockoutThreshold {
+		acc.lockedUntil = now.Add(g.cfg.LockoutDuration)
+		acc.failures = nil
+		locked = true
+	} else if accFailures >= g.cfg.DelayAfter {
+		acc.nextAllowed = now.Add(g.backoff(accFailures - g.cfg.DelayAfter))
+	}
+
+	rec := g.ips[ip]
+	if rec == nil {
+		rec = &ipRecord{accounts: make(map[string]time.Time)}
+		g.ips[ip] = rec
+	}
+	rec.failures = append(prune(rec.failures, now.Add(-g.cfg.Window)), now)
+	rec.accounts[account] = now
+	for a, seen := range rec.accounts {
+		if seen.Before(now.Add(-g.cfg.Window)) {
+			delete(rec.accounts, a)
+		}
+	}
+	if len(rec.failures) >= g.cfg.IPDelayAfter {
+		rec.nextAllowed = now.Add(g.backoff(len(rec.failures) - g.cfg.IPDelayAfter))
+	}
+
+	var sprayed []string
+	if len(rec.accounts) >= g.cfg.IPSprayThreshold {
+		for a := range rec.accounts {
+			sprayed = append(sprayed, a)
+		}
+		delete(g.ips, ip)
+	}
+	lockedUntil := acc.lockedUntil
+	g.mu.Unlock()
+
+	entry := &models.SecurityLog{
+		IPAddress:  ip,
+		Method:     "POST",
+		Path:       path,
+		Account:    account,
+		RiskScore:  riskForFailures(accFailures),
+		AttackType: AttackTypeCredential,
+		Status:     "Logged",
+		Payload:    fmt.Sprintf("failed login (%d in window)", accFailures),
+	}
+
+	switch {
+	case sprayed != nil:
+		entry.RiskScore = 100
+		entry.Status = "Blocked"
+		entry.Payload = fmt.Sprintf("password spraying: %d accounts targeted", len(sprayed))
+	case locked:
+		entry.RiskScore = 80
+		entry.Status = "Locked"
+		entry.Payload = fmt.Sprintf("account locked until %s", lockedUntil.UTC().Format(time.RFC3339))
+	}
+
+	if g.store != nil {
+		g.store.CreateSecurityLog(entry)
+		if sprayed != nil && !g.store.IsIPAllowed(ip) {
+			reason := fmt.Sprintf("%s: password spraying across %d accounts", AttackTypeCredential, len(sprayed))
+			g.store.BlockIP(ip, reason, "System", g.cfg.IPBlockDuration, entry.ID)
+		}
+	}
+
+	if g.notifier != nil {
+		if locked {
+			g.notifier.AccountLocked(account, ip, lockedUntil)
+		}
+		if sprayed != nil {
+			g.notifier.IPBlocked(ip, sprayed)
+		}
+	}
+}
+
+// RecordSuccess clears the failure history of an account after a good login
+func (g *LoginGuard) RecordSuccess(account string) {
+	account = normalizeAccount(account)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.accounts, account)
+}
+
+func (g *LoginGuard) backoff(step int) time.Duration {
+	if step > 16 {
+		return g.cfg.MaxDelay
+	}
+	d := g.cfg.BaseDelay << uint(step)
+	if d > g.cfg.MaxDelay {
+		d = g.cfg.MaxDelay
+	}
+	return d
+}
+
+func (g *LoginGuard) sweep() {
+	now := g.now()
+	cutoff := now.Add(-g.cfg.Window)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for k, rec := range g.accounts {
+		rec.failures = prune(rec.failures, cutoff)
+		if len(rec.failures) == 0 && now.After(rec.lockedUntil) && now.After(rec.nextAllowed) {
+			delete(g.accounts, k)
+		}
+	}
+	for k, rec := range g.ips {
+		rec.failures = prune(rec.failures, cutoff)
+		if len(rec.failures) == 0 && now.After(rec.nextAllowed) {
+			delete(g.ips, k)
+		}
+	}
+}
+
+func prune(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+func riskForFailures(n int) int {
+	score := n * 10
+	if score > 70 {
+		score = 70
+	}
+	return score
+}
+
+func normalizeAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
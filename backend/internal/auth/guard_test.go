@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	locked  []string
+	blocked []string
+}
+
+func (n *recordingNotifier) AccountLocked(account, ip string, until time.Time) {
+	n.locked = append(n.locked, account)
+}
+
+func (n *recordingNotifier) IPBlocked(ip string, accounts []string) {
+	n.blocked = append(n.blocked, ip)
+}
+
+func newTestGuard(notifier LockoutNotifier) (*LoginGuard, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := &LoginGuard{
+		cfg:      DefaultGuardConfig(),
+		accounts: make(map[string]*accountRecord),
+		ips:      make(map[string]*ipRecord),
+		notifier: notifier,
+	}
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+func TestLoginGuard_ProgressiveDelay(t *testing.T) {
+	g, now := newTestGuard(nil)
+
+	for i := 0; i < 2; i++ {
+		g.RecordFailure("victim@example.com", "10.0.0.1", "/api/v1/auth/login")
+	}
+	assert.NoError(t, g.Check("victim@example.com", "10.0.0.1"))
+
+	g.RecordFailure("Victim@Example.com", "10.0.0.1", "/api/v1/auth/login")
+	err := g.Check("victim@example.com", "10.0.0.2")
+
+	var throttled *ThrottledError
+	assert.True(t, errors.As(err, &throttled))
+	assert.False(t, throttled.Locked)
+	assert.Equal(t, time.Second, throttled.RetryAfter)
+
+	*now = now.Add(2 * time.Second)
+	assert.NoError(t, g.Check("victim@example.com", "10.0.0.1"))
+}
+
+func TestLoginGuard_Lockout(t *testing.T) {
+	notifier := &recordingNotifier{}
+	g, now := newTestGuard(notifier)
+
+	for i := 0; i < g.cfg.LockoutThreshold; i++ {
+		*now = now.Add(time.Minute)
+		g.RecordFailure("victim@example.com", fmt.Sprintf("10.0.0.%d", i), "/api/v1/auth/login")
+	}
+
+	var throttled *ThrottledError
+	assert.True(t, errors.As(g.Check("victim@example.com", "10.9.9.9"), &throttled))
+	assert.True(t, throttled.Locked)
+	assert.Equal(t, []string{"victim@example.com"}, notifier.locked)
+
+	*now = now.Add(g.cfg.LockoutDuration + time.Second)
+	assert.NoError(t, g.Check("victim@example.com", "10.9.9.9"))
+}
+
+func TestLoginGuard_PasswordSpraying(t *testing.T) {
+	notifier := &recordingNotifier{}
+	g, _ := newTestGuard(notifier)
+
+	for i := 0; i < g.cfg.IPSprayThreshold; i++ {
+		g.RecordFailure(fmt.Sprintf("user%d@example.com", i), "203.0.113.7", "/api/v1/auth/login")
+	}
+
+	assert.Equal(t, []string{"203.0.113.7"}, notifier.blocked)
+	assert.Empty(t, notifier.locked)
+}
+
+func TestLoginGuard_SuccessResetsAccount(t *testing.T) {
+	g, _ := newTestGuard(nil)
+
+	for i := 0; i < 5; i++ {
+		g.RecordFailure("user@example.com", "10.0.0.1", "/api/v1/auth/login")
+	}
+	g.RecordSuccess("user@example.com")
+
+	assert.NoError(t, g.Check("user@example.com", "10.0.0.3"))
+}
+
+func TestLoginGuard_Sweeper(t *testing.T) {
+	g, now := newTestGuard(nil)
+	g.RecordFailure("alice", "198.51.100.7", "/api/v1/auth/login")
+	*now = now.Add(time.Hour)
+
+	stop := g.StartSweeper(time.Millisecond)
+	assert.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return len(g.accounts) == 0 && len(g.ips) == 0
+	}, time.Second, time.Millisecond, "idle records are forgotten")
+	stop()
+	stop()
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrBreachedPassword = errors.New("password appears in a known data breach, choose a different one")
+
+// PasswordPolicy enforces length limits and rejects passwords found in a
+// local breached-password hash list
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	breached  map[[sha1.Size]byte]struct{}
+}
+
+// DefaultPasswordPolicy requires 12 characters; bcrypt ignores anything
+// past 72 bytes so longer passwords are refused rather than truncated
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{MinLength: 12, MaxLength: 72}
+}
+
+// LoadBreachedHashes reads SHA-1 hashes, one per line, in the format used
+// by the Have I Been Pwned downloads ("HASH" or "HASH:COUNT")
+func (p *PasswordPolicy) LoadBreachedHashes(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if p.breached == nil {
+		p.breached = make(map[[sha1.Size]byte]struct{})
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		raw, err := hex.DecodeString(hash)
+		if err != nil || len(raw) != sha1.Size {
+			continue
+		}
+		var key [sha1.Size]byte
+		copy(key[:], raw)
+		p.breached[key] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Validate returns an error describing the first rule the password breaks
+func (p *PasswordPolicy) Validate(password, email string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("password must be at most %d bytes", p.MaxLength)
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		return errors.New("password must not be your email address")
+	}
+	if _, found := p.breached[sha1.Sum([]byte(password))]; found {
+		return ErrBreachedPassword
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TokenPurpose scopes a token to a single flow so a verification link can't
+// be replayed as a password reset
+type TokenPurpose string
+
+const (
+	PurposePasswordReset     TokenPurpose = "password_reset"
+	PurposeEmailVerification TokenPurpose = "email_verification"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ActionToken is the server-side record of an emailed token. Only the ID is
+// stored; the signature is recomputed on redemption.
+type ActionToken struct {
+	ID        string       `gorm:"primaryKey"`
+	UserID    string       `gorm:"index;not null"`
+	Purpose   TokenPurpose `gorm:"index;not null"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// TokenStore issues and redeems signed, single-use, expiring tokens
+type TokenStore struct {
+	db     *gorm.DB
+	secret []byte
+}
+
+func NewTokenStore(db *gorm.DB, secret []byte) *TokenStore {
+	return &TokenStore{db: db, secret: secret}
+}
+
+// Issue creates a token for the user. Outstanding tokens with the same
+// purpose are revoked so only the latest email works.
+func (s *TokenStore) Issue(userID string, purpose TokenPurpose, ttl time.Duration) (string, error) {
+	now := time.Now()
+	if err := s.db.Model(&ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	tok := ActionToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.db.Create(&tok).Error; err != nil {
+		return "", err
+	}
+
+	return tok.ID + "." + s.sign(tok), nil
+}
+
+// Check validates the token without spending it, returning the user it was
+// issued to
+func (s *TokenStore) Check(token string, purpose TokenPurpose) (string, error) {
+	tok, err := s.lookup(s.db, token, purpose)
+	if err != nil {
+		return "", err
+	}
+	return tok.UserID, nil
+}
+
+// Redeem validates the token and marks it used, returning the user it was
+// issued to
+func (s *TokenStore) Redeem(token string, purpose TokenPurpose) (string, error) {
+	return s.redeem(s.db, token, purpose)
+}
+
+func (s *TokenStore) redeem(db *gorm.DB, token string, purpose TokenPurpose) (string, error) {
+	tok, err := s.lookup(db, token, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	// Conditional update so two concurrent redemptions can't both succeed
+	res := db.Model(&ActionToken{}).Where("id = ? AND used_at IS NULL", tok.ID).Update("used_at", time.Now())
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected != 1 {
+		return "", ErrInvalidToken
+	}
+
+	return tok.UserID, nil
+}
+
+// lookup finds an unused, unexpired token with a valid signature
+func (s *TokenStore) lookup(db *gorm.DB, token string, purpose TokenPurpose) (*ActionToken, error) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || id == "" || sig == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var tok ActionToken
+	if err := db.Where("id = ?", id).First(&tok).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if tok.Purpose != purpose || !hmac.Equal([]byte(sig), []byte(s.sign(tok))) {
+		return nil, ErrInvalidToken
+	}
+	if tok.UsedAt != nil || time.Now().After(tok.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	return &tok, nil
+}
+
+func (s *TokenStore) sign(tok ActionToken) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s|%s|%s|%d", tok.ID, tok.UserID, tok.Purpose, tok.ExpiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
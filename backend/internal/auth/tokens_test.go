@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupTokenDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&ActionToken{}))
+	return db
+}
+
+func TestTokenStore_SingleUse(t *testing.T) {
+	store := NewTokenStore(setupTokenDB(t), []byte("test-secret"))
+
+	token, err := store.Issue("user-1", PurposePasswordReset, time.Hour)
+	require.NoError(t, err)
+
+	userID, err := store.Redeem(token, PurposePasswordReset)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+
+	_, err = store.Redeem(token, PurposePasswordReset)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestTokenStore_Rejects(t *testing.T) {
+	store := NewTokenStore(setupTokenDB(t), []byte("test-secret"))
+
+	token, err := store.Issue("user-1", PurposeEmailVerification, time.Hour)
+	require.NoError(t, err)
+
+	_, err = store.Redeem(token, PurposePasswordReset)
+	assert.ErrorIs(t, err, ErrInvalidToken, "wrong purpose")
+
+	_, err = store.Redeem(token+"x", PurposeEmailVerification)
+	assert.ErrorIs(t, err, ErrInvalidToken, "tampered signature")
+
+	other := NewTokenStore(store.db, []byte("other-secret"))
+	_, err = other.Redeem(token, PurposeEmailVerification)
+	assert.ErrorIs(t, err, ErrInvalidToken, "wrong key")
+
+	expired, err := store.Issue("user-2", PurposeEmailVerification, -time.Minute)
+	require.NoError(t, err)
+	_, err = store.Redeem(expired, PurposeEmailVerification)
+	assert.ErrorIs(t, err, ErrInvalidToken, "expired")
+}
+
+func TestTokenStore_IssueRevokesPrevious(t *testing.T) {
+	store := NewTokenStore(setupTokenDB(t), []byte("test-secret"))
+
+	first, _ := store.Issue("user-1", PurposePasswordReset, time.Hour)
+	second, _ := store.Issue("user-1", PurposePasswordReset, time.Hour)
+
+	_, err := store.Redeem(first, PurposePasswordReset)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = store.Redeem(second, PurposePasswordReset)
+	assert.NoError(t, err)
+}
+
+func TestUserStore_ResetPassword(t *testing.T) {
+	db := setupTokenDB(t)
+	require.NoError(t, db.AutoMigrate(&User{}))
+	tokens := NewTokenStore(db, []byte("test-secret"))
+	users := NewUserStore(db)
+
+	user, err := users.Create("alice@example.com", "Original-Passw0rd!", "Alice")
+	require.NoError(t, err)
+	token, err := tokens.Issue(user.ID, PurposePasswordReset, time.Hour)
+	require.NoError(t, err)
+
+	// Checking leaves the token usable
+	userID, err := tokens.Check(token, PurposePasswordReset)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	require.NoError(t, users.ResetPassword(tokens, token, "Replacement-Passw0rd!"))
+	_, err = users.Authenticate("alice@example.com", "Replacement-Passw0rd!")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, users.ResetPassword(tokens, token, "Another-Passw0rd!"), ErrInvalidToken)
+	_, err = tokens.Check(token, PurposePasswordReset)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	sum := sha1.Sum([]byte("correcthorsebattery"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte(hex.EncodeToString(sum[:])+":42\n"), 0o600))
+
+	policy := DefaultPasswordPolicy()
+	require.NoError(t, policy.LoadBreachedHashes(path))
+
+	assert.Error(t, policy.Validate("short", ""))
+	assert.ErrorIs(t, policy.Validate("correcthorsebattery", ""), ErrBreachedPassword)
+	assert.Error(t, policy.Validate("analyst@example.com", "analyst@example.com"))
+	assert.NoError(t, policy.Validate("a-much-better-passphrase", "analyst@example.com"))
+}
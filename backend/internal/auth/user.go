@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
@@ -19,8 +21,20 @@ type User struct {
 	Role         string    `json:"role" gorm:"default:'user'"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	EmailVerified      bool       `json:"email_verified"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at,omitempty"`
+	SessionsValidAfter *time.Time `json:"-"` // Tokens issued before this are rejected
+
+	ExternalID string `json:"external_id,omitempty" gorm:"index"` // IdP identifier set by SCIM
+	Disabled   bool   `json:"disabled"`                           // Deprovisioned users can't sign in
 }
 
+var (
+	ErrSessionRevoked = errors.New("session has been revoked")
+	ErrUserDisabled   = errors.New("user account is disabled")
+)
+
 // UserStore manages user data
 type UserStore struct {
 	db *gorm.DB
@@ -67,6 +81,9 @@ func (s *UserStore) Authenticate(email, password string) (*User, error) {
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
 		return nil, errors.New("invalid credentials")
 	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
 
 	return &user, nil
 }
@@ -82,3 +99,123 @@ func (s *UserStore) GetUserByUsername(username string) (*User, error) {
 	}
 	return &user, nil
 }
+
+func (s *UserStore) GetByID(id string) (*User, error) {
+	var user User
+	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetPassword replaces the user's password and revokes every session
+// issued before the change
+func (s *UserStore) SetPassword(id, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return setPasswordHash(s.db, id, hashedPassword)
+}
+
+// ResetPassword redeems a password reset token and sets the password of the
+// user it was issued to in one transaction, so the token is spent only if
+// the password changes
+func (s *UserStore) ResetPassword(tokens *TokenStore, token, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := tokens.redeem(tx, token, PurposePasswordReset)
+		if err != nil {
+			return err
+		}
+		return setPasswordHash(tx, userID, hashedPassword)
+	})
+}
+
+// setPasswordHash stores the hash and revokes sessions issued before now
+func setPasswordHash(db *gorm.DB, id string, hashedPassword []byte) error {
+	revokedAt := time.Now().Truncate(time.Second)
+	return db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"password_hash":        string(hashedPassword),
+		"sessions_valid_after": &revokedAt,
+	}).Error
+}
+
+func (s *UserStore) MarkEmailVerified(id string) error {
+	now := time.Now()
+	return s.db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": &now,
+	}).Error
+}
+
+// ValidateSession rejects tokens for unknown users and tokens issued before
+// the user's sessions were last revoked
+func (s *UserStore) ValidateSession(userID string, issuedAt time.Time) error {
+	user, err := s.GetByID(userID)
+	if err != nil || user.Disabled {
+		return ErrSessionRevoked
+	}
+	if user.SessionsValidAfter != nil && issuedAt.Before(*user.SessionsValidAfter) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// Provision creates a user on behalf of an identity provider. The password
+// is random and unknown; the user signs in via a password reset.
+func (s *UserStore) Provision(user *User) error {
+	unusable := make([]byte, 32)
+	if _, err := rand.Read(unusable); err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(unusable)), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user.ID = uuid.New().String()
+	user.PasswordHash = string(hashedPassword)
+	if user.Role == "" {
+		user.Role = "user"
+	}
+
+	if err := s.db.Create(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errors.New("user already exists")
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) List() ([]User, error) {
+	var users []User
+	err := s.db.Order("created_at asc").Find(&users).Error
+	return users, err
+}
+
+// Update saves profile and status changes. Disabling a user revokes all of
+// their sessions immediately.
+func (s *UserStore) Update(user *User) error {
+	if user.Disabled {
+		revokedAt := time.Now().Truncate(time.Second)
+		user.SessionsValidAfter = &revokedAt
+	}
+	return s.db.Save(user).Error
+}
+
+func (s *UserStore) Delete(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM group_members WHERE user_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&User{}).Error
+	})
+}
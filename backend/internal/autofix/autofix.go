@@ -0,0 +1,412 @@
+// Package autofix turns AI-generated patches into pull requests. For a
+// finding in a configured repository it clones the repository, asks the
+// model for a diff, checks that the diff applies and that the project
+// still builds and passes its tests, and pushes a branch for review.
+package autofix
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/scanner"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoRepository    = errors.New("no repository configured for fixes")
+	ErrFindingNotFound = errors.New("finding not found")
+	// The finding has no file, or the file is not in the repository
+	ErrNoLocation    = errors.New("finding has no file in the repository")
+	ErrPatchRejected = errors.New("patch does not apply")
+	ErrChecksFailed  = errors.New("checks failed")
+)
+
+// Repository is a repository fixes are proposed to
+type Repository struct {
+	// Path on the forge, e.g. acme/shop
+	Name string `json:"name"`
+	// Clone and push URL; git sends the forge token to an HTTPS URL
+	// without credentials
+	URL        string `json:"url"`
+	BaseBranch string `json:"base_branch"`
+	// Shell command that must succeed on the patched tree, e.g.
+	// "go build ./... && go test ./..."
+	Check string `json:"check,omitempty"`
+}
+
+// Result of a fix attempt. Diff and CheckOutput are also set when checks
+// fail.
+type Result struct {
+	Branch      string `json:"branch,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Diff        string `json:"diff"`
+	CheckOutput string `json:"check_output,omitempty"`
+}
+
+// Request selects the finding to fix. File and Line override the
+// finding's location.
+type Request struct {
+	FindingID uint   `json:"finding_id" binding:"required"`
+	Repo      string `json:"repo"` // Optional with a single repository
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+}
+
+// Output kept from a failed check
+const maxCheckOutput = 4 << 10
+
+// Fixer proposes fixes for findings
+type Fixer struct {
+	db     *gorm.DB
+	engine *ai.RemediationEngine
+	forge  Forge
+	token  string
+	repos  map[string]Repository
+
+	// Patches generated per fix, each after the previous one was rejected
+	Attempts     int
+	CheckTimeout time.Duration
+	AuthorName   string
+	AuthorEmail  string
+}
+
+func NewFixer(db *gorm.DB, engine *ai.RemediationEngine, forge Forge, token string, repos ...Repository) *Fixer {
+	f := &Fixer{
+		db:           db,
+		engine:       engine,
+		forge:        forge,
+		token:        token,
+		repos:        make(map[string]Repository),
+		Attempts:     2,
+		CheckTimeout: 10 * time.Minute,
+		AuthorName:   "CyberShield Autofix",
+		AuthorEmail:  "autofix@cybershield.local",
+	}
+	for _, r := range repos {
+		if r.BaseBranch == "" {
+			r.BaseBranch = "main"
+		}
+		f.repos[r.Name] = r
+	}
+	return f
+}
+
+// Repositories returns the configured repositories
+func (f *Fixer) Repositories() []Repository {
+	repos := make([]Repository, 0, len(f.repos))
+	for _, r := range f.repos {
+		repos = append(repos, r)
+	}
+	return repos
+}
+
+// Available reports whether fixes can be proposed
+func (f *Fixer) Available() bool {
+	return f.forge != nil && len(f.repos) > 0
+}
+
+func (f *Fixer) repository(name string) (Repository, error) {
+	if !f.Available() {
+		return Repository{}, ErrNoRepository
+	}
+	if name == "" && len(f.repos) == 1 {
+		for _, r := range f.repos {
+			return r, nil
+		}
+	}
+	r, ok := f.repos[name]
+	if !ok {
+		return Repository{}, fmt.Errorf("%w: %q", ErrNoRepository, name)
+	}
+	return r, nil
+}
+
+// CreatePR fixes a finding on a new branch and opens a pull request
+func (f *Fixer) CreatePR(ctx context.Context, req Request) (*Result, error) {
+	repo, err := f.repository(req.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if !f.engine.Available(ai.FeatureRemediation) {
+		return nil, ai.ErrNotConfigured
+	}
+	var finding scanner.Vuln
+	if err := f.db.WithContext(ctx).First(&finding, req.FindingID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFindingNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	file, line := valueOr(req.File, finding.File), finding.Line
+	if req.File != "" {
+		line = req.Line
+	}
+	if file == "" {
+		return nil, ErrNoLocation
+	}
+
+	dir, err := os.MkdirTemp("", "autofix-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	creds := f.credentials(repo.URL)
+	if _, err := f.run(ctx, "", creds, "clone", "--quiet", "--depth", "1", "--branch", repo.BaseBranch, repo.URL, dir); err != nil {
+		return nil, err
+	}
+
+	path, err := repoPath(dir, file)
+	if err != nil {
+		return nil, err
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoLocation, file)
+	}
+	// The path as git reports it, e.g. app/net.py for ./app/net.py
+	target := filepath.ToSlash(strings.TrimPrefix(path, dir+string(filepath.Separator)))
+
+	patchReq := ai.PatchRequest{
+		Title:       finding.Title,
+		Description: finding.Description,
+		Solution:    finding.Solution,
+		File:        filepath.ToSlash(file),
+		Line:        line,
+		Source:      string(source),
+	}
+	result := &Result{}
+	for attempt := 1; ; attempt++ {
+		patch, err := f.engine.GeneratePatch(ctx, patchReq)
+		if err != nil {
+			return nil, err
+		}
+		result.Diff = patch
+		applyErr := f.apply(ctx, dir, target, patch)
+		if applyErr == nil {
+			break
+		}
+		if attempt >= f.Attempts {
+			return result, fmt.Errorf("%w: %v", ErrPatchRejected, applyErr)
+		}
+		patchReq.PreviousPatch, patchReq.PreviousError = patch, applyErr.Error()
+	}
+
+	if repo.Check != "" {
+		out, err := f.check(ctx, dir, repo.Check)
+		result.CheckOutput = out
+		if err != nil {
+			return result, fmt.Errorf("%w: %v", ErrChecksFailed, err)
+		}
+	}
+
+	result.Branch = fmt.Sprintf("autofix/finding-%d-%s", finding.ID, time.Now().UTC().Format("20060102150405"))
+	title := fmt.Sprintf("Fix %s in %s", finding.Title, filepath.ToSlash(file))
+	author := fmt.Sprintf("%s <%s>", f.AuthorName, f.AuthorEmail)
+	steps := [][]string{
+		{"checkout", "--quiet", "-b", result.Branch},
+		// Only the patched file: the check may have left build output behind
+		{"add", "--", target},
+		{"-c", "user.name=" + f.AuthorName, "-c", "user.email=" + f.AuthorEmail,
+			"commit", "--quiet", "--author", author, "-m", title, "-m", fmt.Sprintf("Finding #%d (%s severity).", finding.ID, finding.Severity)},
+	}
+	for _, args := range steps {
+		if _, err := f.git(ctx, dir, args...); err != nil {
+			return result, err
+		}
+	}
+	if _, err := f.run(ctx, dir, creds, "push", "--quiet", "origin", result.Branch); err != nil {
+		return result, err
+	}
+
+	result.URL, err = f.forge.OpenPullRequest(ctx, PullRequest{
+		Repo:  repo.Name,
+		Head:  result.Branch,
+		Base:  repo.BaseBranch,
+		Title: title,
+		Body:  prBody(finding, repo.Check != ""),
+	})
+	if err != nil {
+		return result, fmt.Errorf("open pull request on %s: %w", f.forge.Name(), err)
+	}
+	return result, nil
+}
+
+// apply checks the patch against the tree before changing it. Line counts
+// in model-written hunks are often off, so they are recounted. Patches may
+// only change the file of the finding.
+func (f *Fixer) apply(ctx context.Context, dir, target, patch string) error {
+	file, err := os.CreateTemp("", "autofix-*.patch")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(patch); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+	stat, err := f.git(ctx, dir, "apply", "--numstat", "-z", "--recount", file.Name())
+	if err != nil {
+		return err
+	}
+	for _, path := range patchPaths(stat) {
+		if path != target {
+			return fmt.Errorf("the patch changes %s; only %s may be changed", path, target)
+		}
+	}
+	if _, err := f.git(ctx, dir, "apply", "--check", "--recount", file.Name()); err != nil {
+		return err
+	}
+	_, err = f.git(ctx, dir, "apply", "--recount", file.Name())
+	return err
+}
+
+// patchPaths lists the paths in git apply --numstat -z output. Each entry
+// is "added<TAB>deleted<TAB>path<NUL>", or for renames and copies
+// "added<TAB>deleted<TAB><NUL>from<NUL>to<NUL>".
+func patchPaths(numstat string) []string {
+	var paths []string
+	fields := strings.Split(numstat, "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[2] != "" {
+			paths = append(paths, parts[2])
+			continue
+		}
+		for j := 0; j < 2 && i+1 < len(fields); j++ {
+			i++
+			paths = append(paths, fields[i])
+		}
+	}
+	return paths
+}
+
+// Environment passed to checks. The rest, including the server's
+// secrets, is withheld from the repository's build scripts.
+var checkEnv = []string{"PATH", "HOME", "TMPDIR", "LANG", "GOPATH", "GOCACHE", "GOMODCACHE", "GOPROXY", "GOFLAGS", "NPM_CONFIG_CACHE", "PIP_CACHE_DIR"}
+
+// check runs the repository's check command and returns the end of its
+// output
+func (f *Fixer) check(ctx context.Context, dir, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.CheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = []string{}
+	for _, name := range checkEnv {
+		if v, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+v)
+		}
+	}
+	out, err := cmd.CombinedOutput()
+	if len(out) > maxCheckOutput {
+		out = out[len(out)-maxCheckOutput:]
+	}
+	return string(out), err
+}
+
+// git runs git without prompting for credentials
+func (f *Fixer) git(ctx context.Context, dir string, args ...string) (string, error) {
+	return f.run(ctx, dir, nil, args...)
+}
+
+// run runs git with extra environment. The token is removed from errors,
+// which can echo it.
+func (f *Fixer) run(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := fmt.Sprintf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+		if f.token != "" {
+			msg = strings.ReplaceAll(msg, f.token, "***")
+		}
+		return string(out), errors.New(msg)
+	}
+	return string(out), nil
+}
+
+// credentials returns the environment that makes git send the forge token
+// to an HTTPS remote without credentials of its own. It is passed only to
+// clone and push, so the token stays out of the clone's config, the remote
+// URL and process arguments, where the check command could read it.
+func (f *Fixer) credentials(remote string) []string {
+	u, err := url.Parse(remote)
+	if err != nil || u.Scheme != "https" || u.User != nil || f.token == "" {
+		return nil
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte(f.forge.GitUser() + ":" + f.token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + basic,
+	}
+}
+
+// repoPath resolves file within the checkout, rejecting paths that leave
+// it or enter .git
+func repoPath(dir, file string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(file))
+	if filepath.IsAbs(clean) || clean == "." || strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("%w: %s", ErrNoLocation, file)
+	}
+	if first, _, _ := strings.Cut(filepath.ToSlash(clean), "/"); first == ".git" {
+		return "", fmt.Errorf("%w: %s", ErrNoLocation, file)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+func prBody(finding scanner.Vuln, checked bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Proposed fix for finding #%d: **%s** (%s severity).\n\n%s\n", finding.ID, finding.Title, finding.Severity, finding.Description)
+	if finding.Solution != "" {
+		fmt.Fprintf(&sb, "\nSuggested solution: %s\n", finding.Solution)
+	}
+	sb.WriteString("\nThe patch was generated by a model. It applies cleanly")
+	if checked {
+		sb.WriteString(" and the repository checks pass")
+	}
+	sb.WriteString(", but it needs a careful review before merging.\n")
+	return sb.String()
+}
+
+// FromEnv configures the forge from FORGE_TYPE (github, gitlab or gitea),
+// FORGE_URL and FORGE_TOKEN, and a repository from FIX_REPO, its path on
+// the forge, FIX_REPO_URL, FIX_BASE_BRANCH and FIX_CHECK_COMMAND. Without
+// FIX_REPO the fixer is unavailable.
+func FromEnv(db *gorm.DB, engine *ai.RemediationEngine, getenv func(string) string) (*Fixer, error) {
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	name := getenv("FIX_REPO")
+	if name == "" {
+		return NewFixer(db, engine, nil, ""), nil
+	}
+	token := getenv("FORGE_TOKEN")
+	forge, err := NewForge(valueOr(getenv("FORGE_TYPE"), "github"), getenv("FORGE_URL"), token)
+	if err != nil {
+		return NewFixer(db, engine, nil, ""), err
+	}
+	repo := Repository{
+		Name:       name,
+		URL:        getenv("FIX_REPO_URL"),
+		BaseBranch: getenv("FIX_BASE_BRANCH"),
+		Check:      getenv("FIX_CHECK_COMMAND"),
+	}
+	if repo.URL == "" {
+		return NewFixer(db, engine, nil, ""), fmt.Errorf("FIX_REPO_URL is required with FIX_REPO")
+	}
+	return NewFixer(db, engine, forge, token, repo), nil
+}
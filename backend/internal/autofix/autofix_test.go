@@ -0,0 +1,185 @@
+package autofix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/scanner"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const vulnerable = `import subprocess
+
+def ping(host):
+    return subprocess.run("ping -c 1 " + host, shell=True)
+`
+
+const fix = "```diff\n" + `--- a/app/net.py
++++ b/app/net.py
+@@ -3,2 +3,2 @@
+ def ping(host):
+-    return subprocess.run("ping -c 1 " + host, shell=True)
++    return subprocess.run(["ping", "-c", "1", host])
+` + "```"
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return string(out)
+}
+
+// newRemote creates a bare repository with one vulnerable file on main
+func newRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	remote := filepath.Join(root, "shop.git")
+	run(t, root, "init", "--quiet", "--bare", "--initial-branch=main", remote)
+	work := filepath.Join(root, "work")
+	run(t, root, "clone", "--quiet", remote, work)
+	require.NoError(t, os.MkdirAll(filepath.Join(work, "app"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "app", "net.py"), []byte(vulnerable), 0o644))
+	run(t, work, "checkout", "--quiet", "-b", "main")
+	run(t, work, "add", ".")
+	run(t, work, "commit", "--quiet", "-m", "init")
+	run(t, work, "push", "--quiet", "origin", "main")
+	return remote
+}
+
+// giteaStub records the pull requests opened through the Gitea API
+type giteaStub struct {
+	mu  sync.Mutex
+	prs []map[string]string
+}
+
+func (g *giteaStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/repos/acme/shop/pulls" || r.Header.Get("Authorization") != "token s3cret" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var pr map[string]string
+	json.NewDecoder(r.Body).Decode(&pr)
+	g.mu.Lock()
+	g.prs = append(g.prs, pr)
+	g.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"number":1,"html_url":"https://gitea.example.com/acme/shop/pulls/1"}`))
+}
+
+func newFixer(t *testing.T, reply, check string) (*Fixer, *giteaStub, string, *ai.Mock) {
+	t.Helper()
+	remote := newRemote(t)
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&scanner.Vuln{}))
+	require.NoError(t, db.Create(&scanner.Vuln{
+		ID: 7, Title: "Command Injection", Description: "host is passed to a shell", Severity: "High",
+		Category: "SAST", File: "app/net.py", Line: 4,
+	}).Error)
+
+	llm := ai.NewClient()
+	mock := ai.NewMock().Reply("Command Injection", reply)
+	llm.AddProvider(mock, "m")
+
+	stub := &giteaStub{}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	forge, err := NewForge("gitea", srv.URL+"/api/v1", "s3cret")
+	require.NoError(t, err)
+	return NewFixer(db, ai.NewRemediationEngine(llm), forge, "s3cret", Repository{Name: "acme/shop", URL: remote, Check: check}), stub, remote, mock
+}
+
+func TestFixer_CreatePR(t *testing.T) {
+	fixer, stub, remote, mock := newFixer(t, fix, `! grep -rq "shell=True" app && mkdir -p build && echo out > build/app.pyc && echo x >> README`)
+
+	result, err := fixer.CreatePR(context.Background(), Request{FindingID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitea.example.com/acme/shop/pulls/1", result.URL)
+	assert.True(t, strings.HasPrefix(result.Branch, "autofix/finding-7-"))
+	assert.Contains(t, mock.Requests()[0].Messages[0].Content, "    4|     return subprocess.run", "the model sees numbered lines")
+
+	require.Len(t, stub.prs, 1)
+	assert.Equal(t, result.Branch, stub.prs[0]["head"])
+	assert.Equal(t, "main", stub.prs[0]["base"])
+	assert.Equal(t, "Fix Command Injection in app/net.py", stub.prs[0]["title"])
+
+	// The branch was pushed with the patched file and nothing else
+	patched := run(t, remote, "show", result.Branch+":app/net.py")
+	assert.Contains(t, patched, `subprocess.run(["ping", "-c", "1", host])`)
+	assert.Contains(t, run(t, remote, "log", "-1", "--format=%an", result.Branch), "CyberShield Autofix")
+	assert.Equal(t, "app/net.py\n", run(t, remote, "diff", "--name-only", "main", result.Branch))
+}
+
+func TestFixer_RejectsBadPatches(t *testing.T) {
+	wrong := strings.Replace(fix, `"ping -c 1 " + host`, `"ping " + host`, 1)
+	fixer, stub, remote, mock := newFixer(t, wrong, "")
+
+	result, err := fixer.CreatePR(context.Background(), Request{FindingID: 7})
+	assert.True(t, errors.Is(err, ErrPatchRejected), err)
+	assert.Contains(t, result.Diff, `"ping " + host`)
+	reqs := mock.Requests()
+	require.Len(t, reqs, 2, "the model gets a second attempt")
+	assert.Contains(t, reqs[1].Messages[0].Content, "previous patch was rejected")
+	assert.Empty(t, stub.prs)
+	assert.NotContains(t, run(t, remote, "branch"), "autofix/")
+}
+
+func TestFixer_ChecksMustPass(t *testing.T) {
+	fixer, stub, remote, _ := newFixer(t, fix, `echo "tests failed"; exit 1`)
+
+	result, err := fixer.CreatePR(context.Background(), Request{FindingID: 7})
+	assert.True(t, errors.Is(err, ErrChecksFailed), err)
+	assert.Contains(t, result.CheckOutput, "tests failed")
+	assert.Empty(t, stub.prs)
+	assert.NotContains(t, run(t, remote, "branch"), "autofix/")
+
+	_, err = fixer.CreatePR(context.Background(), Request{FindingID: 7, File: "../etc/passwd"})
+	assert.True(t, errors.Is(err, ErrNoLocation))
+	_, err = fixer.CreatePR(context.Background(), Request{FindingID: 8})
+	assert.True(t, errors.Is(err, ErrFindingNotFound))
+	_, err = fixer.CreatePR(context.Background(), Request{FindingID: 7, Repo: "acme/other"})
+	assert.True(t, errors.Is(err, ErrNoRepository))
+}
+
+func TestFixer_PatchMayOnlyChangeTheFinding(t *testing.T) {
+	extra := strings.TrimSuffix(fix, "```") + `diff --git a/.github/workflows/exfiltrate.yml b/.github/workflows/exfiltrate.yml
+new file mode 100644
+--- /dev/null
++++ b/.github/workflows/exfiltrate.yml
+@@ -0,0 +1 @@
++on: push
+` + "```"
+	fixer, stub, _, mock := newFixer(t, extra, "")
+
+	result, err := fixer.CreatePR(context.Background(), Request{FindingID: 7})
+	assert.True(t, errors.Is(err, ErrPatchRejected), err)
+	assert.Contains(t, err.Error(), ".github/workflows/exfiltrate.yml")
+	assert.Contains(t, result.Diff, "exfiltrate.yml")
+	assert.Contains(t, mock.Requests()[1].Messages[0].Content, "only app/net.py may be changed")
+	assert.Empty(t, stub.prs)
+
+	assert.Equal(t, []string{"app/net.py", "old.py", "new.py", "b.py"}, patchPaths("1\t1\tapp/net.py\x000\t0\t\x00old.py\x00new.py\x002\t0\tb.py\x00"))
+}
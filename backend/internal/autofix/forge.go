@@ -0,0 +1,143 @@
+package autofix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PullRequest asks to merge Head into Base of Repo, a path on the forge
+// such as acme/shop
+type PullRequest struct {
+	Repo  string
+	Head  string
+	Base  string
+	Title string
+	Body  string
+}
+
+// Forge opens pull requests (merge requests on GitLab) on a code host
+type Forge interface {
+	Name() string
+	// OpenPullRequest returns the web URL of the new request
+	OpenPullRequest(ctx context.Context, pr PullRequest) (string, error)
+	// GitUser is the user name to push with over HTTPS, with the token as
+	// password
+	GitUser() string
+}
+
+// NewForge creates a client for kind github, gitlab or gitea. apiURL may
+// be empty for github.com and gitlab.com.
+func NewForge(kind, apiURL, token string) (Forge, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch kind {
+	case "github":
+		return &GitHub{api: strings.TrimRight(valueOr(apiURL, "https://api.github.com"), "/"), token: token, client: client}, nil
+	case "gitlab":
+		return &GitLab{api: strings.TrimRight(valueOr(apiURL, "https://gitlab.com/api/v4"), "/"), token: token, client: client}, nil
+	case "gitea":
+		if apiURL == "" {
+			return nil, fmt.Errorf("gitea needs the API URL, e.g. https://gitea.example.com/api/v1")
+		}
+		return &Gitea{api: strings.TrimRight(apiURL, "/"), token: token, client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown forge %q", kind)
+}
+
+// GitHub opens pull requests through the REST API
+type GitHub struct {
+	api    string
+	token  string
+	client *http.Client
+}
+
+func (g *GitHub) Name() string    { return "github" }
+func (g *GitHub) GitUser() string { return "x-access-token" }
+
+func (g *GitHub) OpenPullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	var out struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err := postJSON(ctx, g.client, g.api+"/repos/"+pr.Repo+"/pulls", "Bearer "+g.token, map[string]string{
+		"title": pr.Title, "body": pr.Body, "head": pr.Head, "base": pr.Base,
+	}, &out)
+	return out.HTMLURL, err
+}
+
+// GitLab opens merge requests through the REST API
+type GitLab struct {
+	api    string
+	token  string
+	client *http.Client
+}
+
+func (g *GitLab) Name() string    { return "gitlab" }
+func (g *GitLab) GitUser() string { return "oauth2" }
+
+func (g *GitLab) OpenPullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	var out struct {
+		WebURL string `json:"web_url"`
+	}
+	err := postJSON(ctx, g.client, g.api+"/projects/"+url.PathEscape(pr.Repo)+"/merge_requests", "Bearer "+g.token, map[string]string{
+		"title": pr.Title, "description": pr.Body, "source_branch": pr.Head, "target_branch": pr.Base,
+	}, &out)
+	return out.WebURL, err
+}
+
+// Gitea opens pull requests through the REST API; Forgejo is compatible
+type Gitea struct {
+	api    string
+	token  string
+	client *http.Client
+}
+
+func (g *Gitea) Name() string    { return "gitea" }
+func (g *Gitea) GitUser() string { return "autofix" }
+
+func (g *Gitea) OpenPullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	var out struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err := postJSON(ctx, g.client, g.api+"/repos/"+pr.Repo+"/pulls", "token "+g.token, map[string]string{
+		"title": pr.Title, "body": pr.Body, "head": pr.Head, "base": pr.Base,
+	}, &out)
+	return out.HTMLURL, err
+}
+
+func postJSON(ctx context.Context, client *http.Client, url, authorization string, in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func valueOr(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
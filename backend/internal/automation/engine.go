@@ -1,134 +1,217 @@
 package automation
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
-	"runtime"
 	"time"
 
+	"github.com/cybershield-ai/core/internal/events"
 	"github.com/cybershield-ai/core/internal/integrations"
 )
 
-type ActionType string
-
-const (
-	ActionBlockIP   ActionType = "BlockIP"
-	ActionSendAlert ActionType = "SendAlert"
-	ActionLogEvent  ActionType = "LogEvent"
-)
-
-type Playbook struct {
-	ID          string     `json:"id"`
-	Name        string     `json:"name"`
-	Description string     `json:"description"`
-	Trigger     string     `json:"trigger"` // e.g., "HighSeverityVuln"
-	Actions     []Action   `json:"actions"`
-	Enabled     bool       `json:"enabled"`
-	LastRun     *time.Time `json:"last_run"`
+// IPBlocker adds entries to the blocklist, which the firewall enforcer
+// pushes to the configured enforcement points
+type IPBlocker interface {
+	BlockIP(ip string, reason string, blockedBy string, duration time.Duration, logIDs ...uint) error
+	IsIPAllowed(ip string) bool
 }
 
-type Action struct {
-	Type   ActionType        `json:"type"`
-	Params map[string]string `json:"params"`
-}
+// Default block duration for the BlockIP action
+const defaultBlockDuration = 24 * time.Hour
 
 type AutomationEngine struct {
-	Playbooks          []Playbook
+	store              *Store
 	integrationManager *integrations.IntegrationManager
+	blocker            IPBlocker
+	emitter            events.Emitter
 }
 
-func NewAutomationEngine(im *integrations.IntegrationManager) *AutomationEngine {
+func NewAutomationEngine(store *Store, im *integrations.IntegrationManager, blocker IPBlocker) *AutomationEngine {
 	return &AutomationEngine{
+		store:              store,
 		integrationManager: im,
-		Playbooks: []Playbook{
-			{
-				ID:          "pb-001",
-				Name:        "Block Malicious IPs",
-				Description: "Automatically block IPs with high threat score",
-				Trigger:     "HighThreatScore",
-				Enabled:     true,
-				Actions: []Action{
-					{Type: ActionBlockIP, Params: map[string]string{"ip": "192.168.1.100"}}, // Demo IP
-					{Type: ActionLogEvent, Params: map[string]string{"level": "WARN"}},
-				},
-			},
-			{
-				ID:          "pb-002",
-				Name:        "Critical Vuln Alert",
-				Description: "Send alert to Slack when critical vulnerability found",
-				Trigger:     "CriticalVulnerability",
-				Enabled:     true,
-				Actions: []Action{
-					{Type: ActionSendAlert, Params: map[string]string{"channel": "#security-alerts"}},
-				},
-			},
-		},
+		blocker:            blocker,
 	}
 }
 
+// SetEmitter emits a PlaybookCompleted event after each run
+func (e *AutomationEngine) SetEmitter(em events.Emitter) {
+	e.emitter = em
+}
+
+// GetPlaybooks returns the stored playbooks, or none if they cannot be
+// read
 func (e *AutomationEngine) GetPlaybooks() []Playbook {
-	return e.Playbooks
+	playbooks, err := e.store.List()
+	if err != nil {
+		fmt.Printf("[Automation] Failed to list playbooks: %v\n", err)
+	}
+	return playbooks
 }
 
-func (e *AutomationEngine) RunPlaybook(id string) error {
-	for i, pb := range e.Playbooks {
-		if pb.ID == id {
-			if !pb.Enabled {
-				return fmt.Errorf("playbook is disabled")
-			}
+// RunPlaybook runs an enabled playbook on behalf of actor and returns the
+// run with the outcome of each action. Runs by hand have no cooldown.
+func (e *AutomationEngine) RunPlaybook(actor Actor, id string) (*PlaybookRun, error) {
+	pb, err := e.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !pb.CanRun(actor) {
+		return nil, ErrNotPermitted
+	}
+	if !pb.Enabled {
+		return nil, ErrPlaybookDisabled
+	}
+	run, err := e.store.startRun(*pb, "manual", "", "")
+	if err != nil {
+		return nil, err
+	}
+	return run, e.run(*pb, run, nil)
+}
 
-			now := time.Now()
-			e.Playbooks[i].LastRun = &now
-			fmt.Printf("[Automation] Running Playbook: %s\n", pb.Name)
+// HandleEvent runs the enabled playbooks triggered by a domain event whose
+// filter it passes. Playbooks trigger on the event type, e.g.
+// "waf.blocked", or on:
+//   - CriticalVulnerability: a critical finding
+//   - HighThreatScore: a real (not simulated) high or critical detection
+//
+// A playbook runs at most once per event, and not again for the same
+// dedupe key within its cooldown.
+func (e *AutomationEngine) HandleEvent(ctx context.Context, ev events.Event) error {
+	triggers := []string{ev.Type}
+	p, _ := ev.Payload()
+	switch p := p.(type) {
+	case *events.FindingCreated:
+		if p.Severity == "Critical" {
+			triggers = append(triggers, TriggerCriticalVulnerability)
+		}
+	case *events.DetectionRaised:
+		if !p.Simulated && (p.Severity == "High" || p.Severity == "Critical") {
+			triggers = append(triggers, TriggerHighThreatScore)
+		}
+	case *events.PlaybookCompleted:
+		// Never let playbooks trigger each other
+		return nil
+	}
 
-			for _, action := range pb.Actions {
-				if err := e.executeAction(action); err != nil {
-					fmt.Printf("  - Action Failed: %s (%v)\n", action.Type, err)
-				} else {
-					fmt.Printf("  - Action Executed: %s\n", action.Type)
-				}
-			}
-			return nil
+	matched, err := e.store.Triggered(triggers)
+	if err != nil {
+		return err
+	}
+	var fields map[string]any
+	if p != nil {
+		fields = eventFields(p)
+	}
+
+	for _, pb := range matched {
+		if ok, err := pb.filter(fields); err != nil {
+			fmt.Printf("[Automation] Skipping %s, filter failed: %v\n", pb.Name, err)
+			continue
+		} else if !ok {
+			continue
+		}
+		key, err := render(pb.DedupeKey, fields)
+		if err != nil {
+			fmt.Printf("[Automation] Skipping %s, dedupe key failed: %v\n", pb.Name, err)
+			continue
+		}
+		run, err := e.store.startRun(pb, pb.Trigger, ev.ID, key)
+		if err != nil {
+			// Retried; playbooks that already ran are skipped then
+			return err
+		}
+		if run == nil {
+			continue
 		}
+		// Failures are reported rather than retried, since the actions
+		// that succeeded would run again
+		if err := e.run(pb, run, fields); err != nil {
+			fmt.Printf("[Automation] Failed to record run of %s: %v\n", pb.Name, err)
+		}
+	}
+	return nil
+}
+
+// run executes the actions of a started run, with parameters filled in
+// from the fields of the triggering event
+func (e *AutomationEngine) run(pb Playbook, run *PlaybookRun, fields map[string]any) error {
+	fmt.Printf("[Automation] Running Playbook: %s\n", pb.Name)
+
+	for _, action := range pb.Actions {
+		result := events.ActionOutcome{Type: string(action.Type)}
+		params, err := action.params(fields)
+		if err == nil {
+			err = e.executeAction(pb, Action{Type: action.Type, Params: params})
+		}
+		if err != nil {
+			fmt.Printf("  - Action Failed: %s (%v)\n", action.Type, err)
+			result.Error = err.Error()
+		} else {
+			fmt.Printf("  - Action Executed: %s\n", action.Type)
+		}
+		run.Actions = append(run.Actions, result)
+	}
+	if err := e.store.finishRun(run); err != nil {
+		fmt.Printf("[Automation] Failed to record outcome of %s: %v\n", pb.Name, err)
+	}
+
+	if e.emitter == nil {
+		return nil
 	}
-	return fmt.Errorf("playbook not found")
+	causedBy := ""
+	if run.EventID != nil {
+		causedBy = *run.EventID
+	}
+	return e.emitter.Emit(events.PlaybookCompleted{
+		PlaybookID: pb.ID, Name: pb.Name, Trigger: run.Trigger, CausedBy: causedBy, StartedAt: run.StartedAt, Actions: run.Actions,
+	})
 }
 
-func (e *AutomationEngine) executeAction(action Action) error {
+func (e *AutomationEngine) executeAction(pb Playbook, action Action) error {
 	switch action.Type {
 	case ActionBlockIP:
+		// Blocks go through the blocklist so they are idempotent, expire and
+		// reach every firewall backend
 		ip := action.Params["ip"]
 		if ip == "" {
 			return fmt.Errorf("missing ip param")
 		}
-		if runtime.GOOS == "windows" {
-			// Real Windows Firewall Block
-			cmd := exec.Command("netsh", "advfirewall", "firewall", "add", "rule", "name=\"CyberShield Block "+ip+"\"", "dir=in", "action=block", "remoteip="+ip)
-			return cmd.Run()
-		} else {
-			// Linux
-			cmd := exec.Command("iptables", "-A", "INPUT", "-s", ip, "-j", "DROP")
-			return cmd.Run()
+		if e.blocker == nil {
+			return fmt.Errorf("blocklist not available")
+		}
+		if e.blocker.IsIPAllowed(ip) {
+			return fmt.Errorf("%s is allowlisted, not blocking it", ip)
+		}
+		duration := defaultBlockDuration
+		if d := action.Params["duration"]; d != "" {
+			parsed, err := time.ParseDuration(d)
+			if err != nil {
+				return fmt.Errorf("invalid duration param: %w", err)
+			}
+			duration = parsed
+		}
+		reason := action.Params["reason"]
+		if reason == "" {
+			reason = "Playbook: " + pb.Name
 		}
+		return e.blocker.BlockIP(ip, reason, "Playbook", duration)
 	case ActionSendAlert:
 		if e.integrationManager != nil {
-			return e.integrationManager.SendAlert(integrations.Slack, "Playbook Triggered: "+action.Params["channel"])
+			message := "Playbook Triggered: " + action.Params["channel"]
+			if m := action.Params["message"]; m != "" {
+				message += ": " + m
+			}
+			return e.integrationManager.SendAlert(integrations.Slack, message)
 		}
 		return fmt.Errorf("integration manager not available")
 	case ActionLogEvent:
-		fmt.Printf("[LOG] %s\n", action.Params["level"])
+		level := action.Params["level"]
+		if level == "" {
+			level = "INFO"
+		}
+		fmt.Printf("[LOG] %s %s: %s\n", level, pb.Name, action.Params["message"])
 		return nil
 	default:
 		return fmt.Errorf("unknown action type")
 	}
 }
-
-func (e *AutomationEngine) TogglePlaybook(id string) error {
-	for i, pb := range e.Playbooks {
-		if pb.ID == id {
-			e.Playbooks[i].Enabled = !pb.Enabled
-			return nil
-		}
-	}
-	return fmt.Errorf("playbook not found")
-}
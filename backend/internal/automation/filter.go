@@ -0,0 +1,603 @@
+package automation
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter is a parsed filter expression over the fields of an event, e.g.
+//
+//	severity >= "High" && category in ["SQL Injection", "XSS"]
+//
+// Operands are field names, quoted strings, numbers, true and false.
+// Operators are ==, !=, <, <=, >, >=, in [...], contains, matches (a
+// regular expression), &&, || and !, with parentheses for grouping.
+// Strings compare without regard to case, and severities (Info, Low,
+// Medium, High, Critical) order by rank.
+type Filter struct {
+	root node
+}
+
+// node evaluates part of an expression against event fields
+type node func(fields map[string]any) (any, error)
+
+// valueType is the type of an expression, known once it is parsed
+type valueType int
+
+const (
+	anyType valueType = iota // Not known until the filter runs
+	textType
+	numberType
+	boolType
+	listType
+)
+
+func (t valueType) String() string {
+	switch t {
+	case textType:
+		return "text"
+	case numberType:
+		return "a number"
+	case boolType:
+		return "true or false"
+	case listType:
+		return "a list"
+	}
+	return "any value"
+}
+
+func typeOf(v any) valueType {
+	switch v.(type) {
+	case string:
+		return textType
+	case float64:
+		return numberType
+	case bool:
+		return boolType
+	case []string:
+		return listType
+	}
+	return anyType
+}
+
+// expr is a parsed part of an expression with its type
+type expr struct {
+	eval node
+	typ  valueType
+	// The value of constants
+	constant any
+}
+
+// ParseFilter parses a filter expression over events with fields, whose
+// values give the type of each field. Field names and the types of
+// operands are checked as the expression is parsed; with nil fields they
+// are checked by Match.
+func ParseFilter(src string, fields map[string]any) (*Filter, error) {
+	p := &filterParser{src: src, fields: fields}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err := want(root, boolType, "the filter"); err != nil {
+		return nil, err
+	}
+	return &Filter{root: root.eval}, nil
+}
+
+// want checks that an expression of a known type has type t
+func want(e expr, t valueType, what string) error {
+	if e.typ != anyType && e.typ != t {
+		return fmt.Errorf("%s needs %s, not %s", what, t, e.typ)
+	}
+	return nil
+}
+
+// Match evaluates the filter against the fields of an event
+func (f *Filter) Match(fields map[string]any) (bool, error) {
+	v, err := f.root(fields)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("filter is %s, not true or false", describe(v))
+	}
+	return b, nil
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+type filterParser struct {
+	src    string
+	fields map[string]any
+	tokens []token
+	pos    int
+}
+
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func (p *filterParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(s) && s[end] != s[i] {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return fmt.Errorf("unterminated string at %d", i+1)
+			}
+			text := s[i+1 : end]
+			if r == '"' {
+				unquoted, err := strconv.Unquote(s[i : end+1])
+				if err != nil {
+					return fmt.Errorf("invalid string at %d", i+1)
+				}
+				text = unquoted
+			}
+			p.tokens = append(p.tokens, token{tokString, text})
+			i = end + 1
+		case r == '-' || unicode.IsDigit(r):
+			end := i + 1
+			for end < len(s) && (unicode.IsDigit(rune(s[end])) || s[end] == '.') {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokNumber, s[i:end]})
+			i = end
+		case r == '_' || unicode.IsLetter(r):
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end]))) {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokIdent, s[i:end]})
+			i = end
+		default:
+			op := ""
+			for _, o := range filterOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("unexpected %q at %d", r, i+1)
+			}
+			p.tokens = append(p.tokens, token{tokOp, op})
+			i += len(op)
+		}
+	}
+	if len(p.tokens) == 0 {
+		return fmt.Errorf("empty expression")
+	}
+	return nil
+}
+
+func (p *filterParser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{kind: -1}
+}
+
+// accept consumes the next token if it is the operator or keyword text
+func (p *filterParser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokOp || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %q at end of expression", text)
+		}
+		return fmt.Errorf("expected %q, found %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *filterParser) or() (expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return expr{}, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return expr{}, err
+		}
+		if left, err = logical(left, right, true); err != nil {
+			return expr{}, err
+		}
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return expr{}, err
+	}
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return expr{}, err
+		}
+		if left, err = logical(left, right, false); err != nil {
+			return expr{}, err
+		}
+	}
+	return left, nil
+}
+
+// logical combines two conditions, evaluating the right one only when
+// needed
+func logical(left, right expr, or bool) (expr, error) {
+	op := "&&"
+	if or {
+		op = "||"
+	}
+	for _, e := range []expr{left, right} {
+		if err := want(e, boolType, op); err != nil {
+			return expr{}, err
+		}
+	}
+	return expr{typ: boolType, eval: func(fields map[string]any) (any, error) {
+		for _, n := range []node{left.eval, right.eval} {
+			v, err := n(fields)
+			if err != nil {
+				return nil, err
+			}
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s is not true or false", describe(v))
+			}
+			if b == or {
+				return or, nil
+			}
+		}
+		return !or, nil
+	}}, nil
+}
+
+func (p *filterParser) unary() (expr, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return expr{}, err
+		}
+		if err := want(operand, boolType, "!"); err != nil {
+			return expr{}, err
+		}
+		return expr{typ: boolType, eval: func(fields map[string]any) (any, error) {
+			v, err := operand.eval(fields)
+			if err != nil {
+				return nil, err
+			}
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("cannot negate %s", describe(v))
+			}
+			return !b, nil
+		}}, nil
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (expr, error) {
+	left, err := p.operand()
+	if err != nil {
+		return expr{}, err
+	}
+	switch t := p.peek(); {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.pos++
+		right, err := p.operand()
+		if err != nil {
+			return expr{}, err
+		}
+		return compare(t.text, left, right)
+	case p.accept("in"):
+		list, err := p.list()
+		if err != nil {
+			return expr{}, err
+		}
+		for _, item := range list {
+			if err := want(item, left.typ, "in"); err != nil {
+				return expr{}, err
+			}
+		}
+		return expr{typ: boolType, eval: func(fields map[string]any) (any, error) {
+			v, err := left.eval(fields)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range list {
+				w, err := item.eval(fields)
+				if err != nil {
+					return nil, err
+				}
+				if equal(v, w) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}}, nil
+	case p.accept("contains"):
+		right, err := p.operand()
+		if err != nil {
+			return expr{}, err
+		}
+		return contains(left, right)
+	case p.accept("matches"):
+		t := p.peek()
+		if t.kind != tokString {
+			return expr{}, fmt.Errorf("matches needs a quoted regular expression")
+		}
+		p.pos++
+		re, err := regexp.Compile(t.text)
+		if err != nil {
+			return expr{}, fmt.Errorf("invalid regular expression %q: %v", t.text, err)
+		}
+		if err := want(left, textType, "matches"); err != nil {
+			return expr{}, err
+		}
+		return expr{typ: boolType, eval: func(fields map[string]any) (any, error) {
+			v, err := left.eval(fields)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("matches needs text, not %s", describe(v))
+			}
+			return re.MatchString(s), nil
+		}}, nil
+	}
+	return left, nil
+}
+
+func (p *filterParser) list() ([]expr, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	var items []expr
+	for {
+		item, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.accept("]") {
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *filterParser) operand() (expr, error) {
+	if p.accept("(") {
+		inner, err := p.or()
+		if err != nil {
+			return expr{}, err
+		}
+		return inner, p.expect(")")
+	}
+	t := p.peek()
+	if p.pos >= len(p.tokens) {
+		return expr{}, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case tokString:
+		return constant(t.text), nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return expr{}, fmt.Errorf("invalid number %q", t.text)
+		}
+		return constant(n), nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		case "in", "contains", "matches":
+			return expr{}, fmt.Errorf("unexpected %q", t.text)
+		}
+		name := t.text
+		typ := anyType
+		if p.fields != nil {
+			v, ok := p.fields[name]
+			if !ok {
+				return expr{}, fmt.Errorf("unknown field %q", name)
+			}
+			typ = typeOf(v)
+		}
+		return expr{typ: typ, eval: func(fields map[string]any) (any, error) {
+			v, ok := fields[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown field %q", name)
+			}
+			return v, nil
+		}}, nil
+	}
+	return expr{}, fmt.Errorf("unexpected %q", t.text)
+}
+
+func constant(v any) expr {
+	return expr{typ: typeOf(v), constant: v, eval: func(map[string]any) (any, error) { return v, nil }}
+}
+
+// compare checks the operand types of a comparison. Only numbers and
+// severities are ordered.
+func compare(op string, left, right expr) (expr, error) {
+	known := left.typ != anyType && right.typ != anyType
+	if known && left.typ != right.typ {
+		return expr{}, fmt.Errorf("cannot compare %s %s %s", left.typ, op, right.typ)
+	}
+	if op != "==" && op != "!=" {
+		for _, e := range []expr{left, right} {
+			if e.typ != anyType && e.typ != numberType && e.typ != textType {
+				return expr{}, fmt.Errorf("%s needs numbers or severities, not %s", op, e.typ)
+			}
+			if s, ok := e.constant.(string); ok {
+				if _, ok := severityRank[strings.ToLower(s)]; !ok {
+					return expr{}, fmt.Errorf("%s needs numbers or severities, not %q", op, s)
+				}
+			}
+		}
+	}
+	return expr{typ: boolType, eval: func(fields map[string]any) (any, error) {
+		a, err := left.eval(fields)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right.eval(fields)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "==":
+			return equal(a, b), nil
+		case "!=":
+			return !equal(a, b), nil
+		}
+		x, y, err := ordered(a, b)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compare %s %s %s", describe(a), op, describe(b))
+		}
+		switch op {
+		case "<":
+			return x < y, nil
+		case "<=":
+			return x <= y, nil
+		case ">":
+			return x > y, nil
+		default:
+			return x >= y, nil
+		}
+	}}, nil
+}
+
+func contains(left, right expr) (expr, error) {
+	if left.typ != anyType && left.typ != textType && left.typ != listType {
+		return expr{}, fmt.Errorf("%s cannot contain anything", left.typ)
+	}
+	if err := want(right, textType, "contains"); err != nil {
+		return expr{}, err
+	}
+	return expr{typ: boolType, eval: func(fields map[string]any) (any, error) {
+		a, err := left.eval(fields)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right.eval(fields)
+		if err != nil {
+			return nil, err
+		}
+		switch a := a.(type) {
+		case string:
+			s, ok := b.(string)
+			if !ok {
+				return nil, fmt.Errorf("text cannot contain %s", describe(b))
+			}
+			return strings.Contains(strings.ToLower(a), strings.ToLower(s)), nil
+		case []string:
+			for _, item := range a {
+				if equal(item, b) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return nil, fmt.Errorf("%s cannot contain anything", describe(a))
+	}}, nil
+}
+
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case string:
+		t, ok := b.(string)
+		return ok && strings.EqualFold(a, t)
+	case []string:
+		t, ok := b.([]string)
+		return ok && slices.EqualFunc(a, t, strings.EqualFold)
+	}
+	if _, ok := b.([]string); ok {
+		return false
+	}
+	return a == b
+}
+
+// Severity ranks, for ordering comparisons
+var severityRank = map[string]float64{"info": 0, "low": 1, "medium": 2, "high": 3, "critical": 4}
+
+func ordered(a, b any) (float64, float64, error) {
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			return x, y, nil
+		}
+	}
+	if s, ok := a.(string); ok {
+		if t, ok := b.(string); ok {
+			// Empty severities rank below Info
+			x, okX := severityRank[strings.ToLower(s)]
+			y, okY := severityRank[strings.ToLower(t)]
+			if s == "" {
+				x, okX = -1, true
+			}
+			if okX && okY {
+				return x, y, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("not ordered")
+}
+
+func describe(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		return "a list"
+	case nil:
+		return "nothing"
+	}
+	return fmt.Sprint(v)
+}
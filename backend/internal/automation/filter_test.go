@@ -0,0 +1,77 @@
+package automation
+
+import (
+	"testing"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Match(t *testing.T) {
+	fields := eventFields(&events.WAFBlocked{
+		IP: "198.51.100.7", CountryCode: "RU", Method: "POST", Path: "/api/v1/auth/login",
+		AttackType: "SQL Injection", RiskScore: 12, RuleIDs: []string{"942100", "942190"},
+	})
+
+	for expr, want := range map[string]bool{
+		`attack_type == "sql injection"`:                       true,
+		`risk_score >= 10 && country_code in ["RU", "CN"]`:     true,
+		`risk_score > 20 || path contains "LOGIN"`:             true,
+		`!(method == 'POST')`:                                  false,
+		`rule_ids contains "942190"`:                           true,
+		`path matches "^/api/v1/(auth|admin)/"`:                true,
+		`ip != "198.51.100.7" && risk_score < 100`:             false,
+		`country_code in ["US"] || (risk_score == 12 && true)`: true,
+		`rule_ids == rule_ids`:                                 true,
+	} {
+		f, err := ParseFilter(expr, fields)
+		require.NoError(t, err, expr)
+		got, err := f.Match(fields)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, got, expr)
+	}
+}
+
+func TestFilter_Severity(t *testing.T) {
+	f, err := ParseFilter(`severity >= "High" && category != "Info"`, eventFields(&events.FindingCreated{}))
+	require.NoError(t, err)
+	for severity, want := range map[string]bool{"Critical": true, "high": true, "Medium": false, "": false} {
+		got, err := f.Match(eventFields(&events.FindingCreated{Severity: severity, Category: "Web"}))
+		require.NoError(t, err)
+		assert.Equal(t, want, got, severity)
+	}
+}
+
+func TestFilter_Errors(t *testing.T) {
+	for _, expr := range []string{"", `severity ==`, `(risk_score > 1`, `path matches "("`, `ip in "x"`, `"unterminated`, `risk_score # 1`} {
+		_, err := ParseFilter(expr, nil)
+		assert.Error(t, err, expr)
+	}
+
+	// Names and types are checked when parsing, given the fields, including
+	// those of operands a run would skip, and otherwise when matching
+	fields := eventFields(&events.WAFBlocked{RuleIDs: []string{"942100"}})
+	for _, expr := range []string{
+		`risk_score > "High"`, `country`, `risk_score`, `risk_score matches "1"`, `!path`, `risk_score > 1 && path`,
+		`path > "/admin"`, `rule_ids == "942100"`, `rule_ids in ["942100"]`, `risk_score contains 1`, `path contains 1`,
+		`country_code in ["RU", 1]`, `ip == true || risk_score > 1`,
+	} {
+		_, err := ParseFilter(expr, fields)
+		assert.Error(t, err, expr)
+	}
+	for _, expr := range []string{`risk_score > path`, `country`, `risk_score`, `risk_score matches "1"`, `!path`} {
+		f, err := ParseFilter(expr, nil)
+		require.NoError(t, err, expr)
+		_, err = f.Match(fields)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestFilter_ListEquality(t *testing.T) {
+	f, err := ParseFilter(`rule_ids == "942100" || "942100" == rule_ids || rule_ids == tags`, nil)
+	require.NoError(t, err)
+	got, err := f.Match(map[string]any{"rule_ids": []string{"942100"}, "tags": []string{"942100"}})
+	require.NoError(t, err, "lists compare without panicking")
+	assert.True(t, got)
+}
@@ -0,0 +1,444 @@
+package automation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrPlaybookNotFound = errors.New("playbook not found")
+	ErrPlaybookExists   = errors.New("playbook already exists")
+	ErrPlaybookDisabled = errors.New("playbook is disabled")
+	ErrVersionNotFound  = errors.New("playbook version not found")
+	ErrNotPermitted     = errors.New("not permitted on this playbook")
+	// Wraps the validation errors of definitions
+	ErrInvalidPlaybook = errors.New("invalid playbook")
+)
+
+type ActionType string
+
+const (
+	ActionBlockIP   ActionType = "BlockIP"
+	ActionSendAlert ActionType = "SendAlert"
+	ActionLogEvent  ActionType = "LogEvent"
+)
+
+// Playbook is a stored playbook. Its definition (ID, name, description,
+// trigger, actions and whether it is enabled) is what YAML files hold;
+// every change to it is a new version.
+type Playbook struct {
+	ID          string `json:"id" yaml:"id" gorm:"primaryKey"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description,omitempty"`
+	// Event type or named trigger that runs the playbook; empty for
+	// playbooks only run by hand
+	Trigger string `json:"trigger" yaml:"trigger,omitempty"`
+	// Filter expression over the event's fields, see ParseFilter
+	Filter string `json:"filter,omitempty" yaml:"filter,omitempty"`
+	// Minimum time between triggered runs, e.g. 10m. With DedupeKey, a
+	// template such as "{{.source_ip}}", it applies per key instead.
+	Cooldown  string   `json:"cooldown,omitempty" yaml:"cooldown,omitempty"`
+	DedupeKey string   `json:"dedupe_key,omitempty" yaml:"dedupe_key,omitempty"`
+	Actions   []Action `json:"actions" yaml:"actions" gorm:"serializer:json"`
+	Enabled   bool     `json:"enabled" yaml:"enabled"`
+
+	// Besides admins, the owner may edit, run and delete the playbook,
+	// editors may edit and run it and runners may run it. "*" is every
+	// user.
+	OwnerID   string     `json:"owner_id" yaml:"-" gorm:"index"`
+	Editors   []string   `json:"editors,omitempty" yaml:"-" gorm:"serializer:json"`
+	Runners   []string   `json:"runners,omitempty" yaml:"-" gorm:"serializer:json"`
+	Version   int        `json:"version" yaml:"-"`
+	LastRun   *time.Time `json:"last_run" yaml:"-"`
+	CreatedAt time.Time  `json:"created_at" yaml:"-"`
+	UpdatedAt time.Time  `json:"updated_at" yaml:"-"`
+}
+
+// Action is a step of a playbook. Params may be templates such as
+// "{{.source_ip}}", filled in from the triggering event.
+type Action struct {
+	Type   ActionType        `json:"type" yaml:"type"`
+	Params map[string]string `json:"params" yaml:"params,omitempty"`
+}
+
+// PlaybookVersion is the definition of a playbook as it was saved
+type PlaybookVersion struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	PlaybookID string    `json:"playbook_id" gorm:"uniqueIndex:idx_playbook_version"`
+	Version    int       `json:"version" gorm:"uniqueIndex:idx_playbook_version"`
+	Definition string    `json:"definition"` // YAML
+	AuthorID   string    `json:"author_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PlaybookRun records a run of a playbook. Triggered runs are recorded
+// once per event, so redelivered events do not run playbooks again.
+type PlaybookRun struct {
+	ID         uint                   `json:"id" gorm:"primaryKey"`
+	PlaybookID string                 `json:"playbook_id" gorm:"index;uniqueIndex:idx_playbook_run_event"`
+	EventID    *string                `json:"event_id,omitempty" gorm:"uniqueIndex:idx_playbook_run_event"`
+	Trigger    string                 `json:"trigger"`
+	DedupeKey  string                 `json:"dedupe_key,omitempty" gorm:"index"`
+	StartedAt  time.Time              `json:"started_at" gorm:"index"`
+	Actions    []events.ActionOutcome `json:"actions" gorm:"serializer:json"`
+}
+
+// Failed reports whether any action of the run failed
+func (r *PlaybookRun) Failed() bool {
+	for _, a := range r.Actions {
+		if a.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor is the user changing or running a playbook
+type Actor struct {
+	UserID string
+	Role   string
+}
+
+func (a Actor) admin() bool { return a.Role == "admin" }
+
+func listed(users []string, userID string) bool {
+	for _, u := range users {
+		if u == "*" || (u == userID && userID != "") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Playbook) owned(a Actor) bool {
+	return a.admin() || (p.OwnerID != "" && p.OwnerID == a.UserID)
+}
+
+// CanEdit reports whether a may change the definition of the playbook
+func (p *Playbook) CanEdit(a Actor) bool {
+	return p.owned(a) || listed(p.Editors, a.UserID)
+}
+
+// CanRun reports whether a may run the playbook by hand
+func (p *Playbook) CanRun(a Actor) bool {
+	return p.CanEdit(a) || listed(p.Runners, a.UserID)
+}
+
+// blocksIPs reports whether the playbook blocks addresses, which only
+// admins may set up, whether it runs on events or by hand
+func (p *Playbook) blocksIPs() bool {
+	for _, a := range p.Actions {
+		if a.Type == ActionBlockIP {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSave returns an error unless a may save the definition
+func (p *Playbook) checkSave(a Actor) error {
+	if p.blocksIPs() && !a.admin() {
+		return fmt.Errorf("%w: only admins may save playbooks that block IPs", ErrNotPermitted)
+	}
+	return nil
+}
+
+// Triggers raised by domain events, besides the event type itself
+const (
+	TriggerCriticalVulnerability = "CriticalVulnerability"
+	TriggerHighThreatScore       = "HighThreatScore"
+)
+
+// Triggers lists what a playbook can trigger on. Playbooks never trigger
+// on the completion of other playbooks.
+func Triggers() []string {
+	return []string{
+		TriggerCriticalVulnerability, TriggerHighThreatScore,
+		events.TypeFindingCreated, events.TypeScanCompleted, events.TypeIPBlocked,
+		events.TypeIPUnblocked, events.TypeDetectionRaised, events.TypeWAFBlocked,
+		events.TypeCloudTrailAlert, events.TypeHoneypotHit,
+	}
+}
+
+// Parameters of each action type, and the check of their values. Values
+// filled in from events have their own check when rendered is set.
+type param struct {
+	required bool
+	check    func(string) error
+	rendered func(string) error
+}
+
+var actionParams = map[ActionType]map[string]param{
+	ActionBlockIP: {
+		"ip":       {required: true, check: checkBlockTarget, rendered: checkSingleAddress},
+		"duration": {check: checkDuration},
+		"reason":   {},
+	},
+	ActionSendAlert: {
+		"channel": {required: true},
+		"message": {},
+	},
+	ActionLogEvent: {
+		"level":   {check: checkLevel},
+		"message": {},
+	},
+}
+
+// Broadest prefixes a playbook may block
+const (
+	minBlockBits4 = 16
+	minBlockBits6 = 48
+)
+
+func checkBlockTarget(v string) error {
+	if _, err := netip.ParseAddr(v); err == nil {
+		return nil
+	}
+	p, err := netip.ParsePrefix(v)
+	if err != nil {
+		return fmt.Errorf("%q is not an IP address or CIDR prefix", v)
+	}
+	bits := minBlockBits6
+	switch {
+	case p.Addr().Is4():
+		bits = minBlockBits4
+	case p.Addr().Is4In6():
+		bits = 96 + minBlockBits4
+	}
+	if p.Bits() < bits {
+		return fmt.Errorf("%q is too broad, the broadest prefix a playbook may block is /%d", v, bits)
+	}
+	return nil
+}
+
+// checkSingleAddress keeps events from widening a block to a network
+func checkSingleAddress(v string) error {
+	if _, err := netip.ParseAddr(v); err != nil {
+		return fmt.Errorf("%q is not a single IP address", v)
+	}
+	return nil
+}
+
+func checkDuration(v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("%q is not a positive duration such as 24h", v)
+	}
+	return nil
+}
+
+func checkLevel(v string) error {
+	switch v {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+		return nil
+	}
+	return fmt.Errorf("%q is not one of DEBUG, INFO, WARN or ERROR", v)
+}
+
+// ActionTypes lists the action types with their parameters, required
+// ones first
+func ActionTypes() map[ActionType][]string {
+	types := make(map[ActionType][]string, len(actionParams))
+	for t, params := range actionParams {
+		var names []string
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if params[names[i]].required != params[names[j]].required {
+				return params[names[i]].required
+			}
+			return names[i] < names[j]
+		})
+		types[t] = names
+	}
+	return types
+}
+
+var playbookID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidPlaybook, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the definition of a playbook. Filters and templates
+// may only refer to fields of the trigger's event.
+func (p *Playbook) Validate() error {
+	if !playbookID.MatchString(p.ID) {
+		return invalid("id %q must be lower-case letters, digits, - and _", p.ID)
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return invalid("name is required")
+	}
+	if p.Trigger != "" {
+		known := false
+		for _, t := range Triggers() {
+			known = known || t == p.Trigger
+		}
+		if !known {
+			return invalid("unknown trigger %q, expected one of %s", p.Trigger, strings.Join(Triggers(), ", "))
+		}
+	}
+	fields := triggerFields(p.Trigger)
+	if p.Filter != "" {
+		if fields == nil {
+			return invalid("a filter needs a trigger")
+		}
+		if _, err := ParseFilter(p.Filter, fields); err != nil {
+			return invalid("filter: %v", err)
+		}
+	}
+	if p.Cooldown != "" {
+		if err := checkDuration(p.Cooldown); err != nil {
+			return invalid("cooldown: %v", err)
+		}
+	}
+	if p.DedupeKey != "" {
+		if p.Cooldown == "" {
+			return invalid("a dedupe_key needs a cooldown")
+		}
+		if err := checkTemplate(p.DedupeKey, fields); err != nil {
+			return invalid("dedupe_key: %v", err)
+		}
+	}
+	if len(p.Actions) == 0 {
+		return invalid("at least one action is required")
+	}
+	for i, a := range p.Actions {
+		params, ok := actionParams[a.Type]
+		if !ok {
+			return invalid("action %d: unknown type %q", i+1, a.Type)
+		}
+		for name, value := range a.Params {
+			spec, ok := params[name]
+			if !ok {
+				return invalid("action %d (%s): unknown parameter %q", i+1, a.Type, name)
+			}
+			if isTemplate(value) {
+				// Checked once filled in, when the playbook runs
+				if err := checkTemplate(value, fields); err != nil {
+					return invalid("action %d (%s): %s: %v", i+1, a.Type, name, err)
+				}
+			} else if spec.check != nil {
+				if err := spec.check(value); err != nil {
+					return invalid("action %d (%s): %s: %v", i+1, a.Type, name, err)
+				}
+			}
+		}
+		for name, spec := range params {
+			if spec.required && a.Params[name] == "" {
+				return invalid("action %d (%s): %s is required", i+1, a.Type, name)
+			}
+		}
+	}
+	return nil
+}
+
+func checkTemplate(value string, fields map[string]any) error {
+	if fields == nil {
+		return fmt.Errorf("templates need a trigger")
+	}
+	_, err := render(value, fields)
+	return err
+}
+
+// filter reports whether an event with fields passes the playbook's filter
+func (p *Playbook) filter(fields map[string]any) (bool, error) {
+	if p.Filter == "" {
+		return true, nil
+	}
+	f, err := ParseFilter(p.Filter, fields)
+	if err != nil {
+		return false, err
+	}
+	return f.Match(fields)
+}
+
+// params fills in the templates of an action's parameters and checks the
+// values
+func (a Action) params(fields map[string]any) (map[string]string, error) {
+	params := make(map[string]string, len(a.Params))
+	for name, value := range a.Params {
+		if !isTemplate(value) {
+			params[name] = value
+			continue
+		}
+		rendered, err := render(value, fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		spec := actionParams[a.Type][name]
+		check := spec.check
+		if spec.rendered != nil {
+			check = spec.rendered
+		}
+		if check != nil {
+			if err := check(rendered); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		params[name] = rendered
+	}
+	return params, nil
+}
+
+// definition returns the fields of p held in YAML
+func (p *Playbook) definition() Playbook {
+	return Playbook{
+		ID: p.ID, Name: p.Name, Description: p.Description, Trigger: p.Trigger, Filter: p.Filter,
+		Cooldown: p.Cooldown, DedupeKey: p.DedupeKey, Actions: p.Actions, Enabled: p.Enabled,
+	}
+}
+
+// playbookFile is the YAML format: one playbook, or a list under
+// "playbooks"
+type playbookFile struct {
+	Playbooks []Playbook `yaml:"playbooks"`
+}
+
+// MarshalYAML writes playbook definitions as a "playbooks" list
+func MarshalYAML(playbooks []Playbook) ([]byte, error) {
+	file := playbookFile{Playbooks: make([]Playbook, len(playbooks))}
+	for i := range playbooks {
+		file.Playbooks[i] = playbooks[i].definition()
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseYAML reads playbook definitions. Unknown fields are rejected so
+// typos do not pass silently.
+func ParseYAML(data []byte) ([]Playbook, error) {
+	var probe map[string]any
+	if err := yaml.Unmarshal(data, &probe); err != nil {
+		return nil, invalid("%v", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if _, ok := probe["playbooks"]; ok {
+		var file playbookFile
+		if err := dec.Decode(&file); err != nil {
+			return nil, invalid("%v", err)
+		}
+		return file.Playbooks, nil
+	}
+	var pb Playbook
+	if err := dec.Decode(&pb); err != nil {
+		return nil, invalid("%v", err)
+	}
+	return []Playbook{pb}, nil
+}
@@ -0,0 +1,406 @@
+package automation
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store keeps playbooks and their versions in the database
+type Store struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db, now: time.Now}
+}
+
+// DefaultPlaybooks are created when there are no playbooks
+func DefaultPlaybooks() []Playbook {
+	return []Playbook{
+		{
+			ID:          "pb-001",
+			Name:        "High Threat Detections",
+			Description: "Log real detections with a high or critical severity",
+			Trigger:     TriggerHighThreatScore,
+			Enabled:     true,
+			Actions: []Action{
+				{Type: ActionLogEvent, Params: map[string]string{"level": "WARN"}},
+			},
+		},
+		{
+			ID:          "pb-002",
+			Name:        "Critical Vuln Alert",
+			Description: "Send alert to Slack when critical vulnerability found",
+			Trigger:     TriggerCriticalVulnerability,
+			Enabled:     true,
+			Actions: []Action{
+				{Type: ActionSendAlert, Params: map[string]string{"channel": "#security-alerts"}},
+			},
+		},
+		{
+			ID:          "pb-003",
+			Name:        "Block Honeypot Attackers",
+			Description: "Block addresses that touch a honeypot, alerting once an hour per address",
+			Trigger:     events.TypeHoneypotHit,
+			Cooldown:    "1h",
+			DedupeKey:   "{{.source_ip}}",
+			Enabled:     true,
+			Actions: []Action{
+				{Type: ActionBlockIP, Params: map[string]string{"ip": "{{.source_ip}}", "duration": "24h", "reason": "Honeypot {{.name}} hit"}},
+				{Type: ActionSendAlert, Params: map[string]string{"channel": "#security-alerts", "message": "{{.summary}}"}},
+			},
+		},
+	}
+}
+
+// SeedDefaults creates DefaultPlaybooks, owned by admins only, if there
+// are no playbooks yet
+func (s *Store) SeedDefaults() error {
+	var count int64
+	if err := s.db.Model(&Playbook{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, pb := range DefaultPlaybooks() {
+			if err := s.create(tx, Actor{Role: "admin"}, &pb); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// List returns every playbook by name
+func (s *Store) List() ([]Playbook, error) {
+	var playbooks []Playbook
+	err := s.db.Order("name").Order("id").Find(&playbooks).Error
+	return playbooks, err
+}
+
+// Triggered returns the enabled playbooks with one of the triggers
+func (s *Store) Triggered(triggers []string) ([]Playbook, error) {
+	var playbooks []Playbook
+	// TRIGGER is a keyword, so the column is left to gorm to quote
+	err := s.db.Where(map[string]any{"enabled": true, "trigger": triggers}).Order("id").Find(&playbooks).Error
+	return playbooks, err
+}
+
+func (s *Store) Get(id string) (*Playbook, error) {
+	return s.get(s.db, id)
+}
+
+func (s *Store) get(tx *gorm.DB, id string) (*Playbook, error) {
+	var pb Playbook
+	err := tx.Where("id = ?", id).First(&pb).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPlaybookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb, nil
+}
+
+// Create stores a new playbook owned by actor. Without an ID, one is
+// generated.
+func (s *Store) Create(actor Actor, pb *Playbook) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.create(tx, actor, pb)
+	})
+}
+
+func (s *Store) create(tx *gorm.DB, actor Actor, pb *Playbook) error {
+	if pb.ID == "" {
+		pb.ID = "pb-" + uuid.NewString()[:8]
+	}
+	def := pb.definition()
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	if err := def.checkSave(actor); err != nil {
+		return err
+	}
+	var count int64
+	if err := tx.Model(&Playbook{}).Where("id = ?", pb.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPlaybookExists
+	}
+	*pb = def
+	pb.OwnerID = actor.UserID
+	pb.Version = 1
+	if err := tx.Create(pb).Error; err != nil {
+		return err
+	}
+	return s.saveVersion(tx, actor, pb)
+}
+
+func (s *Store) saveVersion(tx *gorm.DB, actor Actor, pb *Playbook) error {
+	data, err := MarshalYAML([]Playbook{*pb})
+	if err != nil {
+		return err
+	}
+	return tx.Create(&PlaybookVersion{
+		PlaybookID: pb.ID,
+		Version:    pb.Version,
+		Definition: string(data),
+		AuthorID:   actor.UserID,
+		CreatedAt:  s.now(),
+	}).Error
+}
+
+// Update replaces the definition of a playbook, as a new version
+func (s *Store) Update(actor Actor, id string, def Playbook) (*Playbook, error) {
+	var pb *Playbook
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pb, err = s.update(tx, actor, id, def)
+		return err
+	})
+	return pb, err
+}
+
+func (s *Store) update(tx *gorm.DB, actor Actor, id string, def Playbook) (*Playbook, error) {
+	pb, err := s.get(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !pb.CanEdit(actor) {
+		return nil, ErrNotPermitted
+	}
+	def.ID = id
+	def = def.definition()
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	if err := def.checkSave(actor); err != nil {
+		return nil, err
+	}
+	pb.Name, pb.Description, pb.Trigger, pb.Actions, pb.Enabled = def.Name, def.Description, def.Trigger, def.Actions, def.Enabled
+	pb.Filter, pb.Cooldown, pb.DedupeKey = def.Filter, def.Cooldown, def.DedupeKey
+	pb.Version++
+	if err := tx.Save(pb).Error; err != nil {
+		return nil, err
+	}
+	return pb, s.saveVersion(tx, actor, pb)
+}
+
+// SetEnabled turns a playbook on or off. This is not a new version.
+func (s *Store) SetEnabled(actor Actor, id string, enabled bool) (*Playbook, error) {
+	pb, err := s.get(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if !pb.CanEdit(actor) {
+		return nil, ErrNotPermitted
+	}
+	pb.Enabled = enabled
+	return pb, s.db.Model(pb).Update("enabled", enabled).Error
+}
+
+// Permissions of a playbook. An empty OwnerID keeps the current owner.
+type Permissions struct {
+	OwnerID string   `json:"owner_id"`
+	Editors []string `json:"editors"`
+	Runners []string `json:"runners"`
+}
+
+// SetPermissions changes who may edit and run a playbook. Only its owner
+// and admins may.
+func (s *Store) SetPermissions(actor Actor, id string, perms Permissions) (*Playbook, error) {
+	pb, err := s.get(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if !pb.owned(actor) {
+		return nil, ErrNotPermitted
+	}
+	if perms.OwnerID != "" {
+		pb.OwnerID = perms.OwnerID
+	}
+	pb.Editors, pb.Runners = perms.Editors, perms.Runners
+	err = s.db.Model(pb).Select("owner_id", "editors", "runners").Updates(pb).Error
+	return pb, err
+}
+
+// Delete removes a playbook, its versions and its runs. Only its owner and admins
+// may.
+func (s *Store) Delete(actor Actor, id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		pb, err := s.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if !pb.owned(actor) {
+			return ErrNotPermitted
+		}
+		if err := tx.Where("playbook_id = ?", id).Delete(&PlaybookVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("playbook_id = ?", id).Delete(&PlaybookRun{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(pb).Error
+	})
+}
+
+// Versions lists the versions of a playbook, newest first
+func (s *Store) Versions(id string) ([]PlaybookVersion, error) {
+	if _, err := s.get(s.db, id); err != nil {
+		return nil, err
+	}
+	var versions []PlaybookVersion
+	err := s.db.Where("playbook_id = ?", id).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// Rollback restores the definition of an earlier version as a new
+// version. Whether the playbook is enabled does not change.
+func (s *Store) Rollback(actor Actor, id string, version int) (*Playbook, error) {
+	var pb *Playbook
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var v PlaybookVersion
+		err := tx.Where("playbook_id = ? AND version = ?", id, version).First(&v).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if _, err := s.get(tx, id); err != nil {
+				return err
+			}
+			return ErrVersionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		defs, err := ParseYAML([]byte(v.Definition))
+		if err != nil {
+			return err
+		}
+		current, err := s.get(tx, id)
+		if err != nil {
+			return err
+		}
+		def := defs[0]
+		def.Enabled = current.Enabled
+		pb, err = s.update(tx, actor, id, def)
+		return err
+	})
+	return pb, err
+}
+
+// Import creates the playbooks of a YAML file and updates those that
+// exist, all or none. Updates need permission to edit.
+func (s *Store) Import(actor Actor, data []byte) ([]Playbook, error) {
+	defs, err := ParseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, def := range defs {
+		if def.ID != "" && seen[def.ID] {
+			return nil, invalid("playbook %q appears twice", def.ID)
+		}
+		seen[def.ID] = true
+	}
+
+	imported := make([]Playbook, 0, len(defs))
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, def := range defs {
+			if def.ID != "" {
+				if _, err := s.get(tx, def.ID); err == nil {
+					pb, err := s.update(tx, actor, def.ID, def)
+					if err != nil {
+						return err
+					}
+					imported = append(imported, *pb)
+					continue
+				} else if !errors.Is(err, ErrPlaybookNotFound) {
+					return err
+				}
+			}
+			if err := s.create(tx, actor, &def); err != nil {
+				return err
+			}
+			imported = append(imported, def)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// Export writes playbooks as YAML: those with the given IDs, or all
+func (s *Store) Export(ids ...string) ([]byte, error) {
+	var playbooks []Playbook
+	q := s.db.Order("id")
+	if len(ids) > 0 {
+		q = q.Where("id IN ?", ids)
+	}
+	if err := q.Find(&playbooks).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 && len(playbooks) < len(ids) {
+		return nil, ErrPlaybookNotFound
+	}
+	return MarshalYAML(playbooks)
+}
+
+// Runs lists the latest runs of a playbook, newest first
+func (s *Store) Runs(id string, limit int) ([]PlaybookRun, error) {
+	if _, err := s.get(s.db, id); err != nil {
+		return nil, err
+	}
+	var runs []PlaybookRun
+	err := s.db.Where("playbook_id = ?", id).Order("started_at DESC").Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// startRun records that a playbook starts running. A triggered run
+// (eventID set) is skipped, returning nil, if the playbook already ran for
+// the event or ran for key within its cooldown.
+func (s *Store) startRun(pb Playbook, trigger, eventID, key string) (*PlaybookRun, error) {
+	run := &PlaybookRun{PlaybookID: pb.ID, Trigger: trigger, DedupeKey: key, StartedAt: s.now()}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if eventID != "" {
+			run.EventID = &eventID
+			var count int64
+			if err := tx.Model(&PlaybookRun{}).Where("playbook_id = ? AND event_id = ?", pb.ID, eventID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				run = nil
+				return nil
+			}
+			if cooldown, err := time.ParseDuration(pb.Cooldown); err == nil && cooldown > 0 {
+				since := run.StartedAt.Add(-cooldown)
+				q := tx.Model(&PlaybookRun{}).Where("playbook_id = ? AND dedupe_key = ? AND event_id IS NOT NULL AND started_at > ?", pb.ID, key, since)
+				if err := q.Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					run = nil
+					return nil
+				}
+			}
+		}
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Playbook{}).Where("id = ?", pb.ID).Update("last_run", run.StartedAt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// finishRun records the outcome of a run's actions
+func (s *Store) finishRun(run *PlaybookRun) error {
+	return s.db.Model(run).Select("actions").Updates(run).Error
+}
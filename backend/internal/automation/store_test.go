@@ -0,0 +1,362 @@
+package automation
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestStore(t *testing.T) *Store {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&Playbook{}, &PlaybookVersion{}, &PlaybookRun{}))
+	return NewStore(db)
+}
+
+var (
+	admin = Actor{UserID: "1", Role: "admin"}
+	alice = Actor{UserID: "2", Role: "user"}
+	bob   = Actor{UserID: "3", Role: "user"}
+)
+
+func blockPlaybook() Playbook {
+	return Playbook{
+		ID:      "block-scanner",
+		Name:    "Block scanner",
+		Trigger: events.TypeDetectionRaised,
+		Enabled: true,
+		Actions: []Action{{Type: ActionBlockIP, Params: map[string]string{"ip": "203.0.113.0/24", "duration": "1h"}}},
+	}
+}
+
+// alertPlaybook doesn't block anything, so any user may save it
+func alertPlaybook() Playbook {
+	return Playbook{
+		ID:      "notify-soc",
+		Name:    "Notify SOC",
+		Enabled: true,
+		Actions: []Action{{Type: ActionSendAlert, Params: map[string]string{"channel": "#soc"}}},
+	}
+}
+
+func TestPlaybook_Validate(t *testing.T) {
+	require.NoError(t, (&Playbook{ID: "pb-1", Name: "Manual", Actions: []Action{{Type: ActionLogEvent}}}).Validate())
+
+	for name, mutate := range map[string]func(*Playbook){
+		"bad id":          func(p *Playbook) { p.ID = "Block Scanner" },
+		"no name":         func(p *Playbook) { p.Name = " " },
+		"unknown trigger": func(p *Playbook) { p.Trigger = "Sometimes" },
+		"no actions":      func(p *Playbook) { p.Actions = nil },
+		"unknown action":  func(p *Playbook) { p.Actions[0].Type = "Reboot" },
+		"unknown param":   func(p *Playbook) { p.Actions[0].Params["port"] = "22" },
+		"missing param":   func(p *Playbook) { delete(p.Actions[0].Params, "ip") },
+		"bad address":     func(p *Playbook) { p.Actions[0].Params["ip"] = "192.168.1" },
+		"broad prefix":    func(p *Playbook) { p.Actions[0].Params["ip"] = "0.0.0.0/0" },
+		"broad v6 prefix": func(p *Playbook) { p.Actions[0].Params["ip"] = "2001:db8::/32" },
+		"broad mapped":    func(p *Playbook) { p.Actions[0].Params["ip"] = "::ffff:0.0.0.0/96" },
+		"bad duration":    func(p *Playbook) { p.Actions[0].Params["duration"] = "-1h" },
+		"bad filter":      func(p *Playbook) { p.Filter = `severity ==` },
+		"unknown field":   func(p *Playbook) { p.Filter = `source_ip == "192.0.2.1"` },
+		"filter type":     func(p *Playbook) { p.Filter = `severity > 3` },
+		"manual filter":   func(p *Playbook) { p.Trigger, p.Filter = "", `true` },
+		"bad template":    func(p *Playbook) { p.Actions[0].Params["ip"] = "{{.source_ip}}" },
+		"manual template": func(p *Playbook) { p.Trigger, p.Actions[0].Params["ip"] = "", "{{.source}}" },
+		"bad cooldown":    func(p *Playbook) { p.Cooldown = "soon" },
+		"key no cooldown": func(p *Playbook) { p.DedupeKey = "{{.source}}" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			pb := blockPlaybook()
+			mutate(&pb)
+			assert.ErrorIs(t, pb.Validate(), ErrInvalidPlaybook)
+		})
+	}
+}
+
+func TestPlaybook_ValidateEventFields(t *testing.T) {
+	pb := blockPlaybook()
+	pb.Trigger = TriggerHighThreatScore
+	pb.Filter = `engine == "EDR" && severity >= "High"`
+	pb.Cooldown, pb.DedupeKey = "30m", "{{.source}}"
+	pb.Actions[0].Params["ip"] = "{{.source}}"
+	assert.NoError(t, pb.Validate(), "named triggers have the fields of their event")
+}
+
+func TestStore_VersionsAndRollback(t *testing.T) {
+	store := newTestStore(t)
+	pb := alertPlaybook()
+	require.NoError(t, store.Create(alice, &pb))
+	assert.Equal(t, "2", pb.OwnerID)
+	assert.Equal(t, 1, pb.Version)
+	assert.ErrorIs(t, store.Create(alice, &Playbook{ID: pb.ID, Name: "Again", Actions: pb.Actions}), ErrPlaybookExists)
+
+	def := alertPlaybook()
+	def.Name = "Notify the incident channel"
+	def.Actions[0].Params["channel"] = "#incident"
+	updated, err := store.Update(alice, pb.ID, def)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+
+	_, err = store.SetEnabled(alice, pb.ID, false)
+	require.NoError(t, err)
+	versions, err := store.Versions(pb.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 2, "enabling is not a new version")
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Contains(t, versions[0].Definition, "#incident")
+
+	restored, err := store.Rollback(alice, pb.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, restored.Version)
+	assert.Equal(t, "Notify SOC", restored.Name)
+	assert.Equal(t, "#soc", restored.Actions[0].Params["channel"])
+	assert.False(t, restored.Enabled, "rolling back keeps the playbook disabled")
+
+	_, err = store.Rollback(alice, pb.ID, 9)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+	_, err = store.Rollback(alice, "missing", 1)
+	assert.ErrorIs(t, err, ErrPlaybookNotFound)
+}
+
+func TestStore_Permissions(t *testing.T) {
+	store := newTestStore(t)
+	pb := alertPlaybook()
+	require.NoError(t, store.Create(alice, &pb))
+
+	_, err := store.Update(bob, pb.ID, alertPlaybook())
+	assert.ErrorIs(t, err, ErrNotPermitted)
+	assert.False(t, pb.CanRun(bob))
+	_, err = store.SetPermissions(bob, pb.ID, Permissions{OwnerID: bob.UserID})
+	assert.ErrorIs(t, err, ErrNotPermitted)
+
+	_, err = store.SetPermissions(alice, pb.ID, Permissions{OwnerID: alice.UserID, Editors: []string{bob.UserID}, Runners: []string{"*"}})
+	require.NoError(t, err)
+	stored, err := store.Get(pb.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.CanEdit(bob))
+	assert.True(t, stored.CanRun(Actor{UserID: "4"}))
+	assert.Equal(t, alice.UserID, stored.OwnerID)
+
+	_, err = store.SetPermissions(alice, pb.ID, Permissions{Editors: []string{bob.UserID}, Runners: []string{"*"}})
+	require.NoError(t, err)
+	stored, err = store.Get(pb.ID)
+	require.NoError(t, err)
+	assert.Equal(t, alice.UserID, stored.OwnerID, "an empty owner keeps the current one")
+	_, err = store.Update(bob, pb.ID, alertPlaybook())
+	assert.NoError(t, err)
+	assert.ErrorIs(t, store.Delete(bob, pb.ID), ErrNotPermitted, "editors cannot delete")
+
+	require.NoError(t, store.Delete(admin, pb.ID))
+	_, err = store.Get(pb.ID)
+	assert.ErrorIs(t, err, ErrPlaybookNotFound)
+}
+
+func TestStore_BlockingPlaybooksNeedAdmin(t *testing.T) {
+	store := newTestStore(t)
+	pb := blockPlaybook()
+	assert.ErrorIs(t, store.Create(alice, &pb), ErrNotPermitted)
+	data, err := MarshalYAML([]Playbook{blockPlaybook()})
+	require.NoError(t, err)
+	_, err = store.Import(alice, data)
+	assert.ErrorIs(t, err, ErrNotPermitted)
+
+	require.NoError(t, store.Create(admin, &pb))
+	_, err = store.SetPermissions(admin, pb.ID, Permissions{Editors: []string{alice.UserID}})
+	require.NoError(t, err)
+	def := blockPlaybook()
+	def.Actions[0].Params["ip"] = "198.51.100.0/24"
+	_, err = store.Update(alice, pb.ID, def)
+	assert.ErrorIs(t, err, ErrNotPermitted, "editors cannot change what is blocked")
+	manual := blockPlaybook()
+	manual.Trigger = ""
+	_, err = store.Update(alice, pb.ID, manual)
+	assert.ErrorIs(t, err, ErrNotPermitted, "nor block by hand")
+	manual.ID = "block-by-hand"
+	assert.ErrorIs(t, store.Create(alice, &manual), ErrNotPermitted)
+	_, err = store.Rollback(alice, pb.ID, 1)
+	assert.ErrorIs(t, err, ErrNotPermitted)
+}
+
+func TestStore_ImportExport(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SeedDefaults())
+	require.NoError(t, store.SeedDefaults(), "seeding twice changes nothing")
+
+	imported, err := store.Import(admin, []byte(`
+playbooks:
+  - id: pb-002
+    name: Critical Vuln Alert
+    trigger: CriticalVulnerability
+    enabled: true
+    actions:
+      - type: SendAlert
+        params: {channel: "#appsec"}
+  - id: block-scanner
+    name: Block scanner
+    trigger: detection.raised
+    actions:
+      - type: BlockIP
+        params: {ip: 203.0.113.7}
+`))
+	require.NoError(t, err)
+	require.Len(t, imported, 2)
+	assert.Equal(t, 2, imported[0].Version, "existing playbooks are updated")
+	assert.Equal(t, 1, imported[1].Version)
+
+	_, err = store.Import(admin, []byte("id: x\nname: X\nactions: [{type: LogEvent}]\nowner_id: 1\n"))
+	assert.ErrorIs(t, err, ErrInvalidPlaybook, "unknown fields are rejected")
+	_, err = store.Import(admin, []byte("playbooks:\n  - {id: ok, name: OK, actions: [{type: LogEvent}]}\n  - {id: bad, name: Bad, actions: []}\n"))
+	assert.ErrorIs(t, err, ErrInvalidPlaybook)
+	_, err = store.Get("ok")
+	assert.ErrorIs(t, err, ErrPlaybookNotFound, "imports are all or none")
+
+	data, err := store.Export("block-scanner")
+	require.NoError(t, err)
+	parsed, err := ParseYAML(data)
+	require.NoError(t, err)
+	require.Len(t, parsed, 1)
+	assert.Equal(t, "203.0.113.7", parsed[0].Actions[0].Params["ip"])
+	_, err = store.Export("missing")
+	assert.ErrorIs(t, err, ErrPlaybookNotFound)
+}
+
+type recordingBlocker struct{ ips, allowed []string }
+
+func (b *recordingBlocker) BlockIP(ip, reason, blockedBy string, duration time.Duration, logIDs ...uint) error {
+	b.ips = append(b.ips, ip)
+	return nil
+}
+
+func (b *recordingBlocker) IsIPAllowed(ip string) bool {
+	return slices.Contains(b.allowed, ip)
+}
+
+func TestAutomationEngine_Triggers(t *testing.T) {
+	store := newTestStore(t)
+	pb := blockPlaybook()
+	require.NoError(t, store.Create(admin, &pb))
+	blocker := &recordingBlocker{}
+	engine := NewAutomationEngine(store, nil, blocker)
+
+	ev := events.Event{ID: "e1", Type: events.TypeDetectionRaised, Time: time.Now(), Data: []byte(`{"engine":"EDR","severity":"Low"}`)}
+	require.NoError(t, engine.HandleEvent(context.Background(), ev))
+	assert.Equal(t, []string{"203.0.113.0/24"}, blocker.ips)
+	stored, _ := store.Get(pb.ID)
+	assert.NotNil(t, stored.LastRun)
+
+	_, err := engine.RunPlaybook(bob, pb.ID)
+	assert.ErrorIs(t, err, ErrNotPermitted)
+	_, err = store.SetEnabled(admin, pb.ID, false)
+	require.NoError(t, err)
+	_, err = engine.RunPlaybook(admin, pb.ID)
+	assert.ErrorIs(t, err, ErrPlaybookDisabled)
+	require.NoError(t, engine.HandleEvent(context.Background(), ev))
+	assert.Len(t, blocker.ips, 1, "disabled playbooks do not trigger")
+}
+
+func honeypotHit(id, sourceIP, name string) events.Event {
+	data, _ := json.Marshal(events.HoneypotHit{HoneypotID: 1, Name: name, Kind: "SSH", SourceIP: sourceIP, Port: 22})
+	return events.Event{ID: id, Type: events.TypeHoneypotHit, Time: time.Now(), Data: data}
+}
+
+func TestAutomationEngine_EventTemplatesAndCooldown(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	pb := Playbook{
+		ID:        "block-honeypot",
+		Name:      "Block honeypot attackers",
+		Trigger:   events.TypeHoneypotHit,
+		Filter:    `kind in ["SSH", "HTTP"] && name != "Canary"`,
+		Cooldown:  "1h",
+		DedupeKey: "{{.source_ip}}",
+		Enabled:   true,
+		Actions: []Action{
+			{Type: ActionBlockIP, Params: map[string]string{"ip": "{{.source_ip}}", "reason": "Honeypot {{.name}}"}},
+		},
+	}
+	require.NoError(t, store.Create(admin, &pb))
+	blocker := &recordingBlocker{}
+	engine := NewAutomationEngine(store, nil, blocker)
+	ctx := context.Background()
+
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e1", "198.51.100.7", "Fake SSH")))
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e1", "198.51.100.7", "Fake SSH")), "redelivered")
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e2", "198.51.100.7", "Fake SSH")), "within the cooldown")
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e3", "203.0.113.9", "Fake SSH")), "another key")
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e4", "192.0.2.1", "Canary")), "filtered out")
+	assert.Equal(t, []string{"198.51.100.7", "203.0.113.9"}, blocker.ips)
+
+	now = now.Add(61 * time.Minute)
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e5", "198.51.100.7", "Fake SSH")))
+	assert.Len(t, blocker.ips, 3, "the cooldown has passed")
+
+	run, err := engine.RunPlaybook(admin, pb.ID)
+	require.NoError(t, err)
+	assert.True(t, run.Failed(), "the caller learns that the action failed")
+	runs, err := store.Runs(pb.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 4)
+	assert.Equal(t, "manual", runs[0].Trigger)
+	assert.Contains(t, runs[0].Actions[0].Error, "needs a triggering event")
+	require.NotNil(t, runs[1].EventID)
+	assert.Equal(t, "e5", *runs[1].EventID)
+	assert.Equal(t, "198.51.100.7", runs[1].DedupeKey)
+	assert.Empty(t, runs[1].Actions[0].Error)
+}
+
+func TestAutomationEngine_BlockIPSkipsAllowlist(t *testing.T) {
+	store := newTestStore(t)
+	pb := Playbook{
+		ID:      "block-honeypot",
+		Name:    "Block honeypot attackers",
+		Trigger: events.TypeHoneypotHit,
+		Enabled: true,
+		Actions: []Action{{Type: ActionBlockIP, Params: map[string]string{"ip": "{{.source_ip}}"}}},
+	}
+	require.NoError(t, store.Create(admin, &pb))
+	blocker := &recordingBlocker{allowed: []string{"192.0.2.10"}}
+	engine := NewAutomationEngine(store, nil, blocker)
+	ctx := context.Background()
+
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e1", "192.0.2.10", "Fake SSH")))
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e2", "10.0.0.0/8", "Fake SSH")))
+	require.NoError(t, engine.HandleEvent(ctx, honeypotHit("e3", "198.51.100.7", "Fake SSH")))
+	assert.Equal(t, []string{"198.51.100.7"}, blocker.ips)
+
+	runs, err := store.Runs(pb.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Contains(t, runs[2].Actions[0].Error, "allowlisted")
+	assert.Contains(t, runs[1].Actions[0].Error, "not a single IP address", "events cannot widen a block")
+	assert.Empty(t, runs[0].Actions[0].Error)
+}
+
+func TestAutomationEngine_TemplateValuesAreChecked(t *testing.T) {
+	store := newTestStore(t)
+	pb := blockPlaybook()
+	pb.Trigger = events.TypeDetectionRaised
+	pb.Actions[0].Params["ip"] = "{{.source}}"
+	require.NoError(t, store.Create(admin, &pb))
+	blocker := &recordingBlocker{}
+	engine := NewAutomationEngine(store, nil, blocker)
+
+	ev := events.Event{ID: "e1", Type: events.TypeDetectionRaised, Time: time.Now(), Data: []byte(`{"engine":"EDR","source":"nmap"}`)}
+	require.NoError(t, engine.HandleEvent(context.Background(), ev))
+	assert.Empty(t, blocker.ips)
+	runs, err := store.Runs(pb.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Contains(t, runs[0].Actions[0].Error, "not a single IP address")
+}
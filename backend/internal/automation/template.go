@@ -0,0 +1,103 @@
+package automation
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/events"
+)
+
+// triggerEvents are the event types behind named triggers
+var triggerEvents = map[string]string{
+	TriggerCriticalVulnerability: events.TypeFindingCreated,
+	TriggerHighThreatScore:       events.TypeDetectionRaised,
+}
+
+// triggerFields returns the fields of the event behind a trigger, with
+// zero values, or nil for playbooks run only by hand
+func triggerFields(trigger string) map[string]any {
+	eventType := trigger
+	if t, ok := triggerEvents[trigger]; ok {
+		eventType = t
+	}
+	p := events.New(eventType)
+	if p == nil {
+		return nil
+	}
+	return eventFields(p)
+}
+
+// TriggerFields lists, for each trigger, the event fields that filters
+// and templates can refer to
+func TriggerFields() map[string][]string {
+	fields := make(map[string][]string)
+	for _, trigger := range Triggers() {
+		for name := range triggerFields(trigger) {
+			fields[trigger] = append(fields[trigger], name)
+		}
+		sort.Strings(fields[trigger])
+	}
+	return fields
+}
+
+// eventFields flattens an event payload into the fields that filters and
+// templates refer to, named as in its JSON. Numbers are float64, times
+// RFC 3339 text, and summary is the event's one-line description.
+func eventFields(p events.Payload) map[string]any {
+	fields := map[string]any{"summary": p.Summary()}
+	v := reflect.Indirect(reflect.ValueOf(p))
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		switch f := v.Field(i).Interface().(type) {
+		case string, bool, []string:
+			fields[name] = f
+		case int:
+			fields[name] = float64(f)
+		case uint:
+			fields[name] = float64(f)
+		case float64:
+			fields[name] = f
+		case time.Time:
+			fields[name] = f.Format(time.RFC3339)
+		case *time.Time:
+			if f != nil {
+				fields[name] = f.Format(time.RFC3339)
+			} else {
+				fields[name] = ""
+			}
+		}
+	}
+	return fields
+}
+
+// isTemplate reports whether a parameter takes values from the event
+func isTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// render fills in a template parameter, such as "{{.source_ip}}", from the
+// fields of the triggering event
+func render(value string, fields map[string]any) (string, error) {
+	if !isTemplate(value) {
+		return value, nil
+	}
+	if fields == nil {
+		return "", fmt.Errorf("%q needs a triggering event", value)
+	}
+	tmpl, err := template.New("param").Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, fields); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -9,8 +9,11 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// RDB is the shared Redis client, or nil when Redis is not reachable
 var RDB *redis.Client
 
+// InitRedis connects to REDIS_HOST:REDIS_PORT. RDB stays nil if the server
+// does not answer, so callers fall back to in-process state.
 func InitRedis() error {
 	host := os.Getenv("REDIS_HOST")
 	if host == "" {
@@ -23,7 +26,7 @@ func InitRedis() error {
 
 	addr := fmt.Sprintf("%s:%s", host, port)
 
-	RDB = redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: "", // no password set
 		DB:       0,  // use default DB
@@ -32,10 +35,13 @@ func InitRedis() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := RDB.Ping(ctx).Result()
+	_, err := client.Ping(ctx).Result()
 	if err != nil {
+		client.Close()
+		RDB = nil
 		return fmt.Errorf("failed to connect to Redis at %s: %w", addr, err)
 	}
+	RDB = client
 
 	fmt.Printf("Connected to Redis at %s\n", addr)
 	return nil
@@ -21,50 +21,88 @@ type ComplianceMapping struct {
 	Control  Control
 }
 
+// categoryMappings lists the controls relevant to vulnerability categories
+// containing any of the keywords
+var categoryMappings = []struct {
+	keywords []string
+	mappings []ComplianceMapping
+}{
+	{[]string{"SQL", "INJECTION"}, []ComplianceMapping{
+		{ISO27001, Control{"A.14.1.2", "Securing application services on public networks"}},
+		{NIST, Control{"PR.IP-1", "Data is protected at rest"}}, // Loose mapping
+		{PCI_DSS, Control{"6.5.1", "Injection flaws"}},
+	}},
+	{[]string{"XSS", "SCRIPTING"}, []ComplianceMapping{
+		{ISO27001, Control{"A.14.1.3", "Protecting application services transactions"}},
+		{PCI_DSS, Control{"6.5.7", "Cross-site scripting (XSS)"}},
+	}},
+	{[]string{"SCA", "DEPENDENCY"}, []ComplianceMapping{
+		{ISO27001, Control{"A.14.2.6", "Secure development environment"}}, // Supply chain
+		{NIST, Control{"ID.SC-1", "Cyber supply chain risk management processes are identified"}},
+		{GDPR, Control{"Art. 32", "Security of processing"}},
+	}},
+	{[]string{"AUTH", "PASSWORD"}, []ComplianceMapping{
+		{ISO27001, Control{"A.9.2.1", "User registration and de-registration"}},
+		{GDPR, Control{"Art. 32", "Security of processing"}},
+		{PCI_DSS, Control{"8.2", "Use strong passwords"}},
+	}},
+}
+
+// Default catch-all for general vulnerabilities
+var defaultMappings = []ComplianceMapping{
+	{ISO27001, Control{"A.12.6.1", "Management of technical vulnerabilities"}},
+	{NIST, Control{"DE.CM-8", "Vulnerability scans are performed"}},
+}
+
 // MapVulnerability returns a list of compliance controls relevant to a vulnerability category
 func MapVulnerability(category string) []ComplianceMapping {
 	var mappings []ComplianceMapping
 	category = strings.ToUpper(category)
 
-	// Common mappings based on vulnerability type
-	if strings.Contains(category, "SQL") || strings.Contains(category, "INJECTION") {
-		mappings = append(mappings,
-			ComplianceMapping{ISO27001, Control{"A.14.1.2", "Securing application services on public networks"}},
-			ComplianceMapping{NIST, Control{"PR.IP-1", "Data is protected at rest"}}, // Loose mapping
-			ComplianceMapping{PCI_DSS, Control{"6.5.1", "Injection flaws"}},
-		)
+	for _, cm := range categoryMappings {
+		for _, kw := range cm.keywords {
+			if strings.Contains(category, kw) {
+				mappings = append(mappings, cm.mappings...)
+				break
+			}
+		}
 	}
 
-	if strings.Contains(category, "XSS") || strings.Contains(category, "SCRIPTING") {
-		mappings = append(mappings,
-			ComplianceMapping{ISO27001, Control{"A.14.1.3", "Protecting application services transactions"}},
-			ComplianceMapping{PCI_DSS, Control{"6.5.7", "Cross-site scripting (XSS)"}},
-		)
+	if len(mappings) == 0 {
+		mappings = append(mappings, defaultMappings...)
 	}
 
-	if strings.Contains(category, "SCA") || strings.Contains(category, "DEPENDENCY") {
-		mappings = append(mappings,
-			ComplianceMapping{ISO27001, Control{"A.14.2.6", "Secure development environment"}}, // Supply chain
-			ComplianceMapping{NIST, Control{"ID.SC-1", "Cyber supply chain risk management processes are identified"}},
-			ComplianceMapping{GDPR, Control{"Art. 32", "Security of processing"}},
-		)
-	}
+	return mappings
+}
 
-	if strings.Contains(category, "AUTH") || strings.Contains(category, "PASSWORD") {
-		mappings = append(mappings,
-			ComplianceMapping{ISO27001, Control{"A.9.2.1", "User registration and de-registration"}},
-			ComplianceMapping{GDPR, Control{"Art. 32", "Security of processing"}},
-			ComplianceMapping{PCI_DSS, Control{"8.2", "Use strong passwords"}},
-		)
+// Controls returns every mapped control once, with the vulnerability
+// categories it covers
+func Controls() []MappedControl {
+	var out []MappedControl
+	index := make(map[ComplianceMapping]int)
+	add := func(m ComplianceMapping, categories []string) {
+		i, ok := index[m]
+		if !ok {
+			i = len(out)
+			index[m] = i
+			out = append(out, MappedControl{ComplianceMapping: m})
+		}
+		out[i].Categories = append(out[i].Categories, categories...)
 	}
-
-	// Default catch-all for general vulnerabilities
-	if len(mappings) == 0 {
-		mappings = append(mappings,
-			ComplianceMapping{ISO27001, Control{"A.12.6.1", "Management of technical vulnerabilities"}},
-			ComplianceMapping{NIST, Control{"DE.CM-8", "Vulnerability scans are performed"}},
-		)
+	for _, cm := range categoryMappings {
+		for _, m := range cm.mappings {
+			add(m, cm.keywords)
+		}
 	}
+	for _, m := range defaultMappings {
+		add(m, nil)
+	}
+	return out
+}
 
-	return mappings
+// MappedControl is a control with the category keywords mapped to it; none
+// means it applies to every vulnerability without a specific mapping
+type MappedControl struct {
+	ComplianceMapping
+	Categories []string
 }
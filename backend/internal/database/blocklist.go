@@ -0,0 +1,171 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/models"
+	"gorm.io/gorm"
+)
+
+// Maximum number of entries accepted in a single import
+const maxImportEntries = 100000
+
+// BlocklistEntry is the portable form of a list entry used for import and
+// export
+type BlocklistEntry struct {
+	IPAddress string     `json:"ip_address"`
+	Action    string     `json:"action,omitempty"` // block (default) or allow
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ImportResult reports what an import did
+type ImportResult struct {
+	Imported    int      `json:"imported"`
+	Invalid     []string `json:"invalid,omitempty"`
+	Allowlisted []string `json:"allowlisted,omitempty"`
+}
+
+// ParseBlocklistText reads one address or CIDR per line. Anything after the
+// address is taken as the reason; "#" and ";" start comments, which keeps
+// common published feeds (Spamhaus DROP, FireHOL) importable as-is.
+func ParseBlocklistText(r io.Reader) ([]BlocklistEntry, error) {
+	var entries []BlocklistEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		ip, rest := line, ""
+		if i := strings.IndexAny(line, " \t#;"); i >= 0 {
+			ip, rest = line[:i], line[i:]
+		}
+		reason := strings.TrimSpace(strings.TrimLeft(rest, " \t#;"))
+		entries = append(entries, BlocklistEntry{IPAddress: ip, Reason: reason})
+		if len(entries) > maxImportEntries {
+			return nil, fmt.Errorf("blocklist exceeds %d entries", maxImportEntries)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// ImportBlocklist upserts entries in a single transaction. Invalid
+// addresses and blocks of allowlisted prefixes are skipped and reported
+// rather than failing the import.
+// defaultReason and duration apply to entries that don't set their own.
+func (s *MonitorStore) ImportBlocklist(entries []BlocklistEntry, defaultReason, by string, duration time.Duration) (*ImportResult, error) {
+	if len(entries) > maxImportEntries {
+		return nil, fmt.Errorf("blocklist exceeds %d entries", maxImportEntries)
+	}
+
+	result := &ImportResult{}
+	var defaultExpiry *time.Time
+	if duration > 0 {
+		t := s.now().Add(duration)
+		defaultExpiry = &t
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, e := range entries {
+			p, canonical, err := ParsePrefix(e.IPAddress)
+			if err != nil {
+				result.Invalid = append(result.Invalid, e.IPAddress)
+				continue
+			}
+			action := e.Action
+			if action != models.IPActionAllow {
+				action = models.IPActionBlock
+			}
+			if action == models.IPActionBlock && s.allowlisted(p) {
+				result.Allowlisted = append(result.Allowlisted, canonical)
+				continue
+			}
+			reason := e.Reason
+			if reason == "" {
+				reason = defaultReason
+			}
+			expiresAt := e.ExpiresAt
+			if expiresAt == nil {
+				expiresAt = defaultExpiry
+			}
+
+			var entry models.BlockedIP
+			if err := tx.Unscoped().Where("ip_address = ?", canonical).Limit(1).Find(&entry).Error; err != nil {
+				return err
+			}
+			entry.IPAddress = canonical
+			entry.Action = action
+			entry.Reason = reason
+			entry.BlockedBy = by
+			entry.ExpiresAt = expiresAt
+			entry.DeletedAt = gorm.DeletedAt{}
+			if err := tx.Unscoped().Save(&entry).Error; err != nil {
+				return err
+			}
+			if action == models.IPActionBlock && s.emitter != nil {
+				err := s.emitter.EmitTx(tx, events.IPBlocked{IP: canonical, Reason: reason, BlockedBy: by, ExpiresAt: expiresAt})
+				if err != nil {
+					return err
+				}
+			}
+			result.Imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, s.Refresh()
+}
+
+// ExportBlocklist returns all unexpired entries for action ("block" or
+// "allow"; empty for both)
+func (s *MonitorStore) ExportBlocklist(action string) ([]BlocklistEntry, error) {
+	query := s.db.Where("expires_at IS NULL OR expires_at > ?", s.now()).Order("ip_address")
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	var rows []models.BlockedIP
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	entries := make([]BlocklistEntry, len(rows))
+	for i, r := range rows {
+		entries[i] = BlocklistEntry{IPAddress: r.IPAddress, Action: r.Action, Reason: r.Reason, ExpiresAt: r.ExpiresAt}
+	}
+	return entries, nil
+}
+
+// WriteBlocklistText writes entries in the format read by ParseBlocklistText
+func WriteBlocklistText(w io.Writer, entries []BlocklistEntry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		line := e.IPAddress
+		if e.Reason != "" {
+			// Reasons are free text; keep them on one line
+			line += " # " + strings.Join(strings.Fields(e.Reason), " ")
+		}
+		if _, err := fmt.Fprintln(bw, line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ParseBlocklistJSON reads the JSON export format
+func ParseBlocklistJSON(r io.Reader) ([]BlocklistEntry, error) {
+	var entries []BlocklistEntry
+	dec := json.NewDecoder(io.LimitReader(r, 64<<20))
+	if err := dec.Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
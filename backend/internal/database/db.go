@@ -73,6 +73,8 @@ func InitDB() (*gorm.DB, error) {
 		&models.HardwareTelemetry{},
 		&models.UserBehavior{},
 		&models.GatewayRule{},
+		&models.GatewayUpstream{},
+		&models.GatewayRoute{},
 		&models.IntegrationConfig{},
 	)
 	if err != nil {
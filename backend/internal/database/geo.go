@@ -0,0 +1,168 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/geoip"
+	"github.com/cybershield-ai/core/internal/models"
+)
+
+// ErrInvalidGeoPolicy is returned for policies with an unknown kind, action
+// or malformed value
+var ErrInvalidGeoPolicy = errors.New("invalid geo policy")
+
+// GeoCount is one row of a top countries / top ASNs aggregation
+type GeoCount struct {
+	Key     string `json:"key"`   // Country code or AS number
+	Label   string `json:"label"` // Country name or AS organisation
+	Count   int64  `json:"count"`
+	Blocked int64  `json:"blocked"`
+}
+
+// SetGeoResolver enables GeoIP enrichment of security logs and country/ASN
+// policies
+func (s *MonitorStore) SetGeoResolver(r geoip.Resolver) {
+	s.geo = r
+}
+
+// LookupGeo resolves an address, returning zero Info without a resolver
+func (s *MonitorStore) LookupGeo(ip string) geoip.Info {
+	if s.geo == nil {
+		return geoip.Info{}
+	}
+	return s.geo.Lookup(ip)
+}
+
+func (s *MonitorStore) enrich(log *models.SecurityLog) {
+	if s.geo == nil || log.CountryCode != "" || log.ASN != 0 {
+		return
+	}
+	info := s.geo.Lookup(log.IPAddress)
+	log.CountryCode = info.CountryCode
+	log.Country = info.Country
+	log.City = info.City
+	log.ASN = info.ASN
+	log.ASOrg = info.ASOrg
+}
+
+// NormalizeGeoPolicy validates a policy and canonicalises its value:
+// upper-case country codes and bare AS numbers ("AS13335" becomes "13335")
+func NormalizeGeoPolicy(p *models.GeoPolicy) error {
+	p.Kind = strings.ToLower(strings.TrimSpace(p.Kind))
+	p.Action = strings.ToLower(strings.TrimSpace(p.Action))
+	value := strings.ToUpper(strings.TrimSpace(p.Value))
+
+	switch p.Kind {
+	case models.GeoPolicyCountry:
+		if len(value) != 2 {
+			return fmt.Errorf("%w: country must be a two-letter ISO code", ErrInvalidGeoPolicy)
+		}
+	case models.GeoPolicyASN:
+		value = strings.TrimPrefix(value, "AS")
+		if n, err := strconv.ParseUint(value, 10, 32); err != nil || n == 0 {
+			return fmt.Errorf("%w: asn must be a number such as AS13335", ErrInvalidGeoPolicy)
+		}
+	default:
+		return fmt.Errorf("%w: kind must be country or asn", ErrInvalidGeoPolicy)
+	}
+	if p.Action != models.GeoActionBlock && p.Action != models.GeoActionChallenge {
+		return fmt.Errorf("%w: action must be block or challenge", ErrInvalidGeoPolicy)
+	}
+	p.Value = value
+	return nil
+}
+
+func geoPolicyKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+// SaveGeoPolicy creates or updates the policy for a country or ASN
+func (s *MonitorStore) SaveGeoPolicy(p *models.GeoPolicy) error {
+	if err := NormalizeGeoPolicy(p); err != nil {
+		return err
+	}
+	var existing models.GeoPolicy
+	if err := s.db.Where("kind = ? AND value = ?", p.Kind, p.Value).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+	p.ID = existing.ID
+	p.CreatedAt = existing.CreatedAt
+	if err := s.db.Save(p).Error; err != nil {
+		return err
+	}
+	return s.Refresh()
+}
+
+func (s *MonitorStore) DeleteGeoPolicy(id uint) error {
+	if err := s.db.Delete(&models.GeoPolicy{}, id).Error; err != nil {
+		return err
+	}
+	return s.Refresh()
+}
+
+func (s *MonitorStore) GetGeoPolicies() ([]models.GeoPolicy, error) {
+	var policies []models.GeoPolicy
+	err := s.db.Order("kind, value").Find(&policies).Error
+	return policies, err
+}
+
+// GeoPolicyFor returns the policy that applies to ip, if any, along with
+// the lookup result. ASN policies are more specific than country ones and
+// win when both match.
+func (s *MonitorStore) GeoPolicyFor(ip string) (*models.GeoPolicy, geoip.Info) {
+	policies := s.lists.Load().geo
+	if s.geo == nil || len(policies) == 0 {
+		return nil, geoip.Info{}
+	}
+
+	info := s.geo.Lookup(ip)
+	if info.ASN != 0 {
+		if p, ok := policies[geoPolicyKey(models.GeoPolicyASN, strconv.FormatUint(uint64(info.ASN), 10))]; ok {
+			return &p, info
+		}
+	}
+	if info.CountryCode != "" {
+		if p, ok := policies[geoPolicyKey(models.GeoPolicyCountry, info.CountryCode)]; ok {
+			return &p, info
+		}
+	}
+	return nil, info
+}
+
+// TopCountries aggregates security logs by country since the given time.
+// attacksOnly restricts the count to requests with a detected attack.
+func (s *MonitorStore) TopCountries(since time.Time, limit int, attacksOnly bool) ([]GeoCount, error) {
+	return s.topGeo("country_code", "country", since, limit, attacksOnly)
+}
+
+// TopASNs aggregates security logs by autonomous system since the given time
+func (s *MonitorStore) TopASNs(since time.Time, limit int, attacksOnly bool) ([]GeoCount, error) {
+	return s.topGeo("asn", "as_org", since, limit, attacksOnly)
+}
+
+// keyColumn and labelColumn are fixed column names, never user input
+func (s *MonitorStore) topGeo(keyColumn, labelColumn string, since time.Time, limit int, attacksOnly bool) ([]GeoCount, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+
+	query := s.db.Model(&models.SecurityLog{}).
+		Select(fmt.Sprintf(`%s AS key, MAX(%s) AS label, COUNT(*) AS count, SUM(CASE WHEN status = 'Blocked' THEN 1 ELSE 0 END) AS blocked`, keyColumn, labelColumn)).
+		Where("created_at >= ?", since)
+	if keyColumn == "asn" {
+		query = query.Where("asn <> 0")
+	} else {
+		query = query.Where(keyColumn + " <> ''")
+	}
+	if attacksOnly {
+		query = query.Where("attack_type <> ?", "None")
+	}
+
+	var rows []GeoCount
+	err := query.Group(keyColumn).Order("count DESC").Limit(limit).Scan(&rows).Error
+	return rows, err
+}
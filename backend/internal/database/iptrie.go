@@ -0,0 +1,140 @@
+package database
+
+import (
+	"math/bits"
+	"net/netip"
+)
+
+// ipKey is a 128-bit address; IPv4 is stored in its IPv4-mapped IPv6 form
+// so both families share one tree
+type ipKey struct {
+	hi, lo uint64
+}
+
+func keyFromAddr(a netip.Addr) ipKey {
+	b := a.As16()
+	var k ipKey
+	for i := 0; i < 8; i++ {
+		k.hi = k.hi<<8 | uint64(b[i])
+		k.lo = k.lo<<8 | uint64(b[i+8])
+	}
+	return k
+}
+
+// keyFromPrefix returns the masked key and its length in the 128-bit space
+func keyFromPrefix(p netip.Prefix) (ipKey, int) {
+	p = p.Masked()
+	bits := p.Bits()
+	if p.Addr().Is4() {
+		bits += 96
+	}
+	return keyFromAddr(p.Addr()), bits
+}
+
+func (k ipKey) bit(i int) int {
+	if i < 64 {
+		return int(k.hi>>(63-i)) & 1
+	}
+	return int(k.lo>>(127-i)) & 1
+}
+
+func (k ipKey) mask(n int) ipKey {
+	switch {
+	case n <= 0:
+		return ipKey{}
+	case n < 64:
+		return ipKey{hi: k.hi &^ (^uint64(0) >> n)}
+	case n < 128:
+		return ipKey{hi: k.hi, lo: k.lo &^ (^uint64(0) >> (n - 64))}
+	}
+	return k
+}
+
+// commonBits is the length of the shared prefix of a and b, capped at n
+func commonBits(a, b ipKey, n int) int {
+	c := 128
+	if x := a.hi ^ b.hi; x != 0 {
+		c = bits.LeadingZeros64(x)
+	} else if x := a.lo ^ b.lo; x != 0 {
+		c = 64 + bits.LeadingZeros64(x)
+	}
+	return min(c, n)
+}
+
+type trieNode[V any] struct {
+	key   ipKey
+	bits  int
+	child [2]*trieNode[V]
+	value V
+	set   bool // false for branch nodes created by a split
+}
+
+// ipTrie is a path-compressed binary radix tree keyed by prefix. Lookups
+// walk at most one node per distinct prefix length on the path, so large
+// imported blocklists stay cheap to query.
+type ipTrie[V any] struct {
+	root *trieNode[V]
+	size int
+}
+
+func (t *ipTrie[V]) Insert(p netip.Prefix, v V) {
+	key, n := keyFromPrefix(p)
+	leaf := &trieNode[V]{key: key, bits: n, value: v, set: true}
+
+	link := &t.root
+	for {
+		cur := *link
+		if cur == nil {
+			*link = leaf
+			t.size++
+			return
+		}
+
+		common := commonBits(key, cur.key, min(n, cur.bits))
+		switch {
+		case common == cur.bits && common == n:
+			if !cur.set {
+				t.size++
+			}
+			cur.value, cur.set = v, true
+			return
+		case common == cur.bits:
+			link = &cur.child[key.bit(cur.bits)]
+			continue
+		case common == n:
+			leaf.child[cur.key.bit(n)] = cur
+			*link = leaf
+		default:
+			branch := &trieNode[V]{key: key.mask(common), bits: common}
+			branch.child[key.bit(common)] = leaf
+			branch.child[cur.key.bit(common)] = cur
+			*link = branch
+		}
+		t.size++
+		return
+	}
+}
+
+// Matches returns the values of every prefix containing addr, from the
+// least to the most specific
+func (t *ipTrie[V]) Matches(addr netip.Addr) []V {
+	key := keyFromAddr(addr.Unmap())
+	var out []V
+	for n := t.root; n != nil; {
+		if commonBits(key, n.key, n.bits) < n.bits {
+			break
+		}
+		if n.set {
+			out = append(out, n.value)
+		}
+		if n.bits == 128 {
+			break
+		}
+		n = n.child[key.bit(n.bits)]
+	}
+	return out
+}
+
+func (t *ipTrie[V]) Len() int {
+	return t.size
+}
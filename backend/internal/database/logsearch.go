@@ -0,0 +1,216 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned for cursors not produced by SearchSecurityLogs
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Maximum page size for SearchSecurityLogs
+const maxLogPage = 500
+
+// LogFilter selects security logs. Zero fields match everything.
+type LogFilter struct {
+	IP         string // Exact address
+	Path       string // Path prefix
+	AttackType string
+	Status     string
+	Account    string
+	MinRisk    *int
+	MaxRisk    *int
+	Since      *time.Time
+	Until      *time.Time
+}
+
+func (f LogFilter) apply(q *gorm.DB) *gorm.DB {
+	if f.IP != "" {
+		q = q.Where("ip_address = ?", f.IP)
+	}
+	if f.Path != "" {
+		q = q.Where("path LIKE ? ESCAPE '\\'", escapeLike(f.Path)+"%")
+	}
+	if f.AttackType != "" {
+		q = q.Where("attack_type = ?", f.AttackType)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.Account != "" {
+		q = q.Where("account = ?", f.Account)
+	}
+	if f.MinRisk != nil {
+		q = q.Where("risk_score >= ?", *f.MinRisk)
+	}
+	if f.MaxRisk != nil {
+		q = q.Where("risk_score <= ?", *f.MaxRisk)
+	}
+	if f.Since != nil {
+		q = q.Where("created_at >= ?", *f.Since)
+	}
+	if f.Until != nil {
+		q = q.Where("created_at < ?", *f.Until)
+	}
+	return q
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// LogPage is one page of search results. NextCursor is empty on the last
+// page.
+type LogPage struct {
+	Logs       []models.SecurityLog `json:"logs"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// Cursors are opaque to clients; they encode the last ID of a page, which
+// stays stable while new logs are inserted at the head
+func encodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("id:" + strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeCursor(cursor string) (uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(string(raw), "id:"), 10, 64)
+	if err != nil || !strings.HasPrefix(string(raw), "id:") {
+		return 0, ErrInvalidCursor
+	}
+	return uint(id), nil
+}
+
+// SearchSecurityLogs returns logs matching filter, newest first. Pass the
+// NextCursor of a page to fetch the one after it.
+func (s *MonitorStore) SearchSecurityLogs(filter LogFilter, cursor string, limit int) (*LogPage, error) {
+	if limit <= 0 || limit > maxLogPage {
+		limit = 50
+	}
+	q := filter.apply(s.db.Model(&models.SecurityLog{}))
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where("id < ?", after)
+	}
+
+	page := &LogPage{}
+	// Fetch one extra row to know whether there is a next page
+	if err := q.Order("id desc").Limit(limit + 1).Find(&page.Logs).Error; err != nil {
+		return nil, err
+	}
+	if len(page.Logs) > limit {
+		page.Logs = page.Logs[:limit]
+		page.NextCursor = encodeCursor(page.Logs[limit-1].ID)
+	}
+	return page, nil
+}
+
+// LogBucket is a count for one value of a grouped column
+type LogBucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// LogTimeBucket is a count for one interval of a histogram
+type LogTimeBucket struct {
+	Time    time.Time `json:"time"`
+	Count   int64     `json:"count"`
+	Blocked int64     `json:"blocked"`
+}
+
+// LogAggregates summarises the logs matching a filter
+type LogAggregates struct {
+	Total        int64           `json:"total"`
+	ByStatus     []LogBucket     `json:"by_status"`
+	ByAttackType []LogBucket     `json:"by_attack_type"`
+	TopIPs       []LogBucket     `json:"top_ips"`
+	TopPaths     []LogBucket     `json:"top_paths"`
+	Histogram    []LogTimeBucket `json:"histogram"`
+}
+
+// AggregateSecurityLogs counts the logs matching filter by status, attack
+// type, source IP and path, plus a histogram with the given bucket width
+// (at least a minute)
+func (s *MonitorStore) AggregateSecurityLogs(filter LogFilter, bucket time.Duration, top int) (*LogAggregates, error) {
+	if top <= 0 || top > 100 {
+		top = 10
+	}
+	base := func() *gorm.DB {
+		return filter.apply(s.db.Model(&models.SecurityLog{}))
+	}
+
+	agg := &LogAggregates{}
+	if err := base().Count(&agg.Total).Error; err != nil {
+		return nil, err
+	}
+	groups := []struct {
+		column string
+		limit  int
+		out    *[]LogBucket
+	}{
+		{"status", 0, &agg.ByStatus},
+		{"attack_type", 0, &agg.ByAttackType},
+		{"ip_address", top, &agg.TopIPs},
+		{"path", top, &agg.TopPaths},
+	}
+	for _, g := range groups {
+		q := base().Select(g.column + " AS key, COUNT(*) AS count").Group(g.column).Order("count DESC")
+		if g.limit > 0 {
+			q = q.Limit(g.limit)
+		}
+		if err := q.Scan(g.out).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	agg.Histogram, err = s.histogram(base(), bucket)
+	if err != nil {
+		return nil, err
+	}
+	return agg, nil
+}
+
+// histogram buckets by unix time so the same query works on SQLite and
+// PostgreSQL
+func (s *MonitorStore) histogram(q *gorm.DB, bucket time.Duration) ([]LogTimeBucket, error) {
+	width := int64(bucket / time.Second)
+	if width < 60 {
+		width = 60
+	}
+	epoch := "CAST(strftime('%s', created_at) AS INTEGER)"
+	if s.db.Dialector.Name() == "postgres" {
+		epoch = "CAST(EXTRACT(EPOCH FROM created_at) AS BIGINT)"
+	}
+	expr := fmt.Sprintf("(%s / %d) * %d", epoch, width, width)
+
+	var rows []struct {
+		Bucket  int64
+		Count   int64
+		Blocked int64
+	}
+	err := q.Select(expr + " AS bucket, COUNT(*) AS count, SUM(CASE WHEN status = 'Blocked' THEN 1 ELSE 0 END) AS blocked").
+		Group("bucket").Order("bucket").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]LogTimeBucket, len(rows))
+	for i, r := range rows {
+		out[i] = LogTimeBucket{Time: time.Unix(r.Bucket, 0).UTC(), Count: r.Count, Blocked: r.Blocked}
+	}
+	return out, nil
+}
@@ -2,23 +2,116 @@ package database
 
 import (
 	"errors"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/geoip"
 	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/realtime"
+	"github.com/cybershield-ai/core/internal/redact"
 	"gorm.io/gorm"
 )
 
+// ErrInvalidAddress is returned for entries that are neither an IP address
+// nor a CIDR prefix
+var ErrInvalidAddress = errors.New("invalid IP address or CIDR prefix")
+
+// ErrAllowlisted is returned when blocking a prefix the allowlist covers
+var ErrAllowlisted = errors.New("address is allowlisted")
+
+type ipEntry struct {
+	id        uint
+	bits      int
+	expiresAt *time.Time
+}
+
+// ipLists is an immutable snapshot of the allow and block lists and the
+// geo policies keyed by kind and value
+type ipLists struct {
+	allow ipTrie[ipEntry]
+	block ipTrie[ipEntry]
+	geo   map[string]models.GeoPolicy
+}
+
 type MonitorStore struct {
-	db *gorm.DB
+	db       *gorm.DB
+	lists    atomic.Pointer[ipLists]
+	policy   atomic.Pointer[LogPolicy]
+	redactor atomic.Pointer[redact.Redactor]
+	geo      geoip.Resolver
+	now      func() time.Time
+	// Called after every reload of the lists
+	onChange  []func()
+	publisher realtime.Publisher
+	emitter   events.Emitter
 }
 
 func NewMonitorStore(db *gorm.DB) *MonitorStore {
-	return &MonitorStore{db: db}
+	s := &MonitorStore{db: db, now: time.Now}
+	s.lists.Store(&ipLists{})
+	s.redactor.Store(redact.Default())
+	if err := s.Refresh(); err != nil {
+		// The table may not be migrated yet; the next write refreshes again
+		slog.Warn("MonitorStore: failed to load IP lists", "error", err)
+	}
+	return s
 }
 
-// CreateSecurityLog creates a new security log entry
+// CreateSecurityLog creates a new security log entry, filling in the
+// location and network owner of the source address when GeoIP is enabled.
+// Benign entries may be dropped by the log policy, leaving log.ID zero.
+// Callers redact the payload with Redactor; rule match values are redacted
+// here. Blocked requests are emitted as WAFBlocked events.
 func (s *MonitorStore) CreateSecurityLog(log *models.SecurityLog) error {
-	return s.db.Create(log).Error
+	if !s.keep(log) {
+		return nil
+	}
+	s.redactMatches(log)
+	s.enrich(log)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(log).Error; err != nil {
+			return err
+		}
+		if s.emitter == nil || log.Status != "Blocked" {
+			return nil
+		}
+		var ruleIDs []string
+		if log.RuleIDs != "" {
+			ruleIDs = strings.Split(log.RuleIDs, ",")
+		}
+		return s.emitter.EmitTx(tx, events.WAFBlocked{
+			LogID:       log.ID,
+			IP:          log.IPAddress,
+			CountryCode: log.CountryCode,
+			Method:      log.Method,
+			Path:        log.Path,
+			AttackType:  log.AttackType,
+			RiskScore:   log.RiskScore,
+			RuleIDs:     ruleIDs,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if s.publisher != nil {
+		s.publisher.Publish(realtime.TopicSecurityLogs, realtime.TypeSecurityLog, *log)
+	}
+	return nil
+}
+
+// SetPublisher streams stored security logs; call before serving
+func (s *MonitorStore) SetPublisher(p realtime.Publisher) {
+	s.publisher = p
+}
+
+// SetEmitter emits blocklist changes, WAF blocks and CloudTrail alerts;
+// call before serving
+func (s *MonitorStore) SetEmitter(e events.Emitter) {
+	s.emitter = e
 }
 
 // GetSecurityLogs fetches the most recent security logs
@@ -28,53 +121,352 @@ func (s *MonitorStore) GetSecurityLogs(limit int) ([]models.SecurityLog, error)
 	return logs, err
 }
 
-// BlockIP adds an IP to the blocked list
-func (s *MonitorStore) BlockIP(ip string, reason string, blockedBy string, duration time.Duration) error {
+// GetSecurityLog fetches a single security log entry
+func (s *MonitorStore) GetSecurityLog(id uint) (*models.SecurityLog, error) {
+	var log models.SecurityLog
+	if err := s.db.First(&log, id).Error; err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// SetSecurityLogStatus updates the status of a security log entry
+func (s *MonitorStore) SetSecurityLogStatus(id uint, status string) error {
+	return s.db.Model(&models.SecurityLog{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// CreateCloudTrailAlert stores an alert raised for a CloudTrail event and
+// emits it
+func (s *MonitorStore) CreateCloudTrailAlert(alert *models.CloudTrailAlert) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(alert).Error; err != nil {
+			return err
+		}
+		if s.emitter == nil {
+			return nil
+		}
+		return s.emitter.EmitTx(tx, events.CloudTrailAlert{
+			AlertID:     alert.ID,
+			EventName:   alert.EventName,
+			EventSource: alert.EventSource,
+			Actor:       alert.Actor,
+			SourceIP:    alert.SourceIP,
+			Region:      alert.Region,
+			Severity:    alert.Severity,
+			Message:     alert.Message,
+		})
+	})
+}
+
+// ParsePrefix accepts a single address or a CIDR prefix and returns the
+// masked prefix and its canonical form: a bare address for single hosts,
+// CIDR notation otherwise
+func ParsePrefix(value string) (netip.Prefix, string, error) {
+	var p netip.Prefix
+	if addr, err := netip.ParseAddr(value); err == nil {
+		addr = addr.Unmap().WithZone("")
+		p = netip.PrefixFrom(addr, addr.BitLen())
+	} else if p, err = netip.ParsePrefix(value); err != nil {
+		return netip.Prefix{}, "", ErrInvalidAddress
+	}
+	p = p.Masked()
+	if p.IsSingleIP() {
+		return p, p.Addr().String(), nil
+	}
+	return p, p.String(), nil
+}
+
+// BlockIP blocks an address or CIDR prefix. Blocking an entry that is
+// already listed updates its reason and expiry. logIDs link the block to
+// the security logs that triggered it.
+func (s *MonitorStore) BlockIP(ip string, reason string, blockedBy string, duration time.Duration, logIDs ...uint) error {
 	var expiresAt *time.Time
 	if duration > 0 {
-		t := time.Now().Add(duration)
+		t := s.now().Add(duration)
 		expiresAt = &t
 	}
+	return s.saveEntry(ip, models.IPActionBlock, reason, blockedBy, expiresAt, logIDs)
+}
 
-	blockedIP := models.BlockedIP{
-		IPAddress: ip,
-		Reason:    reason,
-		BlockedBy: blockedBy,
-		ExpiresAt: expiresAt,
+// AllowIP adds an address or CIDR prefix to the allowlist. Allowlisted
+// addresses are never blocked.
+func (s *MonitorStore) AllowIP(ip string, reason string, addedBy string) error {
+	return s.saveEntry(ip, models.IPActionAllow, reason, addedBy, nil, nil)
+}
+
+func (s *MonitorStore) saveEntry(ip, action, reason, by string, expiresAt *time.Time, logIDs []uint) error {
+	p, canonical, err := ParsePrefix(ip)
+	if err != nil {
+		return err
 	}
+	// Blocking must not overwrite or shadow an allowlist entry
+	if action == models.IPActionBlock && s.allowlisted(p) {
+		return ErrAllowlisted
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var entry models.BlockedIP
+		err := tx.Unscoped().Where("ip_address = ?", canonical).First(&entry).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
 
-	return s.db.Create(&blockedIP).Error
+		entry.IPAddress = canonical
+		entry.Action = action
+		entry.Reason = reason
+		entry.BlockedBy = by
+		entry.ExpiresAt = expiresAt
+		entry.DeletedAt = gorm.DeletedAt{}
+		if err := tx.Unscoped().Save(&entry).Error; err != nil {
+			return err
+		}
+		if action == models.IPActionBlock && s.emitter != nil {
+			err := s.emitter.EmitTx(tx, events.IPBlocked{IP: canonical, Reason: reason, BlockedBy: by, ExpiresAt: expiresAt})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(logIDs) == 0 {
+			return nil
+		}
+		logs := make([]models.SecurityLog, len(logIDs))
+		for i, id := range logIDs {
+			logs[i].ID = id
+		}
+		return tx.Model(&entry).Association("SecurityLogs").Append(logs)
+	})
+	if err != nil {
+		return err
+	}
+	return s.Refresh()
 }
 
-// UnblockIP removes an IP from the blocked list
+// UnblockIP removes a block entry
 func (s *MonitorStore) UnblockIP(ip string) error {
-	return s.db.Where("ip_address = ?", ip).Delete(&models.BlockedIP{}).Error
+	return s.deleteEntry(ip, models.IPActionBlock)
 }
 
-// IsIPBlocked checks if an IP is currently blocked
-func (s *MonitorStore) IsIPBlocked(ip string) (bool, error) {
-	var blockedIP models.BlockedIP
-	err := s.db.Where("ip_address = ?", ip).First(&blockedIP).Error
+// RemoveAllowedIP removes an allowlist entry
+func (s *MonitorStore) RemoveAllowedIP(ip string) error {
+	return s.deleteEntry(ip, models.IPActionAllow)
+}
+
+func (s *MonitorStore) deleteEntry(ip, action string) error {
+	_, canonical, err := ParsePrefix(ip)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return false, nil
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var entries []models.BlockedIP
+		if err := tx.Unscoped().Where("ip_address = ? AND action = ?", canonical, action).Find(&entries).Error; err != nil {
+			return err
 		}
-		return false, err
+		if len(entries) > 0 && action == models.IPActionBlock && s.emitter != nil {
+			if err := s.emitter.EmitTx(tx, events.IPUnblocked{IP: canonical}); err != nil {
+				return err
+			}
+		}
+		return deleteEntries(tx, entries)
+	})
+	if err != nil {
+		return err
 	}
+	return s.Refresh()
+}
 
-	// Check expiration
-	if blockedIP.ExpiresAt != nil && time.Now().After(*blockedIP.ExpiresAt) {
-		// Clean up expired block
-		s.UnblockIP(ip)
+// deleteEntries hard deletes entries together with their log links, so a
+// prefix can be listed again later without tripping the unique index
+func deleteEntries(tx *gorm.DB, entries []models.BlockedIP) error {
+	for i := range entries {
+		if err := tx.Model(&entries[i]).Association("SecurityLogs").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&entries[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsIPBlocked checks the in-memory lists: an allowlist match wins, then any
+// unexpired block covering the address
+func (s *MonitorStore) IsIPBlocked(ip string) (bool, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, ErrInvalidAddress
+	}
+
+	lists := s.lists.Load()
+	now := s.now()
+	if len(activeEntries(lists.allow.Matches(addr), now)) > 0 {
 		return false, nil
 	}
+	return len(activeEntries(lists.block.Matches(addr), now)) > 0, nil
+}
+
+// IsIPAllowed reports whether an address is covered by the allowlist
+func (s *MonitorStore) IsIPAllowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	return len(activeEntries(s.lists.Load().allow.Matches(addr), s.now())) > 0
+}
+
+// allowlisted reports whether an unexpired allowlist entry covers the
+// whole prefix
+func (s *MonitorStore) allowlisted(p netip.Prefix) bool {
+	for _, e := range activeEntries(s.lists.Load().allow.Matches(p.Addr()), s.now()) {
+		if e.bits <= p.Bits() {
+			return true
+		}
+	}
+	return false
+}
+
+func activeEntries(entries []ipEntry, now time.Time) []ipEntry {
+	var active []ipEntry
+	for _, e := range entries {
+		if e.expiresAt == nil || now.Before(*e.expiresAt) {
+			active = append(active, e)
+		}
+	}
+	return active
+}
+
+// Refresh rebuilds the in-memory lists from the database. Writes through
+// this store refresh automatically; call it to pick up changes made by
+// other instances.
+func (s *MonitorStore) Refresh() error {
+	var entries []models.BlockedIP
+	if err := s.db.Find(&entries).Error; err != nil {
+		return err
+	}
+	var policies []models.GeoPolicy
+	if err := s.db.Find(&policies).Error; err != nil {
+		return err
+	}
+
+	lists := &ipLists{geo: make(map[string]models.GeoPolicy, len(policies))}
+	for _, p := range policies {
+		lists.geo[geoPolicyKey(p.Kind, p.Value)] = p
+	}
+	for _, e := range entries {
+		p, _, err := ParsePrefix(e.IPAddress)
+		if err != nil {
+			continue
+		}
+		entry := ipEntry{id: e.ID, bits: p.Bits(), expiresAt: e.ExpiresAt}
+		if e.Action == models.IPActionAllow {
+			lists.allow.Insert(p, entry)
+		} else {
+			lists.block.Insert(p, entry)
+		}
+	}
+	s.lists.Store(lists)
+	for _, fn := range s.onChange {
+		fn()
+	}
+	return nil
+}
 
-	return true, nil
+// OnChange registers fn to run whenever the lists are reloaded, such as
+// after a block, unblock or expiry sweep. Register before serving; fn must
+// not block.
+func (s *MonitorStore) OnChange(fn func()) {
+	s.onChange = append(s.onChange, fn)
 }
 
-// GetBlockedIPs fetches all currently blocked IPs
+// ActivePrefixes returns the unexpired entries with the given action,
+// ranked by the number of security logs behind them and then by how
+// recently they were set, so backends with little room keep the worst
+// offenders
+func (s *MonitorStore) ActivePrefixes(action string) ([]netip.Prefix, error) {
+	var entries []models.BlockedIP
+	err := s.db.Where("action = ? AND (expires_at IS NULL OR expires_at > ?)", action, s.now()).
+		Order("(SELECT COUNT(*) FROM blocked_ip_logs WHERE blocked_ip_logs.blocked_ip_id = blocked_ips.id) DESC").
+		Order("updated_at DESC").Order("id DESC").
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, e := range entries {
+		if p, _, err := ParsePrefix(e.IPAddress); err == nil {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes, nil
+}
+
+// SweepExpired deletes expired entries and returns how many were removed
+func (s *MonitorStore) SweepExpired() (int, error) {
+	var expired []models.BlockedIP
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("expires_at IS NOT NULL AND expires_at <= ?", s.now()).Find(&expired).Error; err != nil {
+			return err
+		}
+		return deleteEntries(tx, expired)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(expired), s.Refresh()
+}
+
+// StartSweeper removes expired entries and reloads the lists every interval
+func (s *MonitorStore) StartSweeper(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			if n, err := s.SweepExpired(); err != nil {
+				slog.Warn("MonitorStore: expiry sweep failed", "error", err)
+			} else if n > 0 {
+				slog.Info("MonitorStore: removed expired IP blocks", "count", n)
+			}
+		}
+	}()
+}
+
+// SeedAllowlist makes sure loopback addresses are allowlisted
+func (s *MonitorStore) SeedAllowlist() error {
+	for _, prefix := range []string{"127.0.0.0/8", "::1"} {
+		var count int64
+		if err := s.db.Model(&models.BlockedIP{}).Where("ip_address = ?", prefix).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := s.AllowIP(prefix, "Loopback", "System"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBlockedIPs fetches all block entries
 func (s *MonitorStore) GetBlockedIPs() ([]models.BlockedIP, error) {
+	return s.listEntries(models.IPActionBlock)
+}
+
+// GetAllowedIPs fetches all allowlist entries
+func (s *MonitorStore) GetAllowedIPs() ([]models.BlockedIP, error) {
+	return s.listEntries(models.IPActionAllow)
+}
+
+func (s *MonitorStore) listEntries(action string) ([]models.BlockedIP, error) {
 	var ips []models.BlockedIP
-	err := s.db.Find(&ips).Error
+	err := s.db.Where("action = ?", action).Order("created_at desc").Find(&ips).Error
 	return ips, err
 }
+
+// GetBlockedIP fetches an entry with the security logs that triggered it
+func (s *MonitorStore) GetBlockedIP(id uint) (*models.BlockedIP, error) {
+	var entry models.BlockedIP
+	if err := s.db.Preload("SecurityLogs").First(&entry, id).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
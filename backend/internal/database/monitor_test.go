@@ -0,0 +1,470 @@
+package database
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/geoip"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/redact"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestMonitorStore(t *testing.T) (*MonitorStore, *time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&models.SecurityLog{}, &models.BlockedIP{}, &models.GeoPolicy{}))
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMonitorStore(db)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestIPTrie_LongestPrefixMatches(t *testing.T) {
+	var trie ipTrie[string]
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.3/32", "2001:db8::/32", "2001:db8:1::/48", "0.0.0.0/0"} {
+		trie.Insert(netip.MustParsePrefix(p), p)
+	}
+	assert.Equal(t, 6, trie.Len())
+
+	assert.Equal(t, []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.3/32"}, trie.Matches(netip.MustParseAddr("10.1.2.3")))
+	assert.Equal(t, []string{"0.0.0.0/0", "10.0.0.0/8"}, trie.Matches(netip.MustParseAddr("10.200.0.1")))
+	assert.Equal(t, []string{"0.0.0.0/0"}, trie.Matches(netip.MustParseAddr("192.168.0.1")))
+	assert.Equal(t, []string{"2001:db8::/32", "2001:db8:1::/48"}, trie.Matches(netip.MustParseAddr("2001:db8:1::42")))
+	assert.Empty(t, trie.Matches(netip.MustParseAddr("2001:db9::1")))
+
+	// IPv4-mapped IPv6 addresses match IPv4 prefixes
+	assert.Contains(t, trie.Matches(netip.MustParseAddr("::ffff:10.1.2.3")), "10.1.2.3/32")
+
+	// Re-inserting a prefix replaces its value
+	trie.Insert(netip.MustParsePrefix("10.1.0.0/16"), "updated")
+	assert.Equal(t, 6, trie.Len())
+	assert.Contains(t, trie.Matches(netip.MustParseAddr("10.1.9.9")), "updated")
+}
+
+func TestMonitorStore_CIDRAndAllowlist(t *testing.T) {
+	s, _ := newTestMonitorStore(t)
+
+	require.NoError(t, s.BlockIP("203.0.113.0/24", "scanner range", "Admin", 0))
+	require.NoError(t, s.BlockIP("2001:db8::/32", "v6 range", "Admin", 0))
+	require.NoError(t, s.BlockIP("198.51.100.7", "single", "Admin", 0))
+	assert.ErrorIs(t, s.BlockIP("not-an-ip", "", "Admin", 0), ErrInvalidAddress)
+
+	for ip, want := range map[string]bool{
+		"203.0.113.9":        true,
+		"203.0.114.1":        false,
+		"2001:db8::1":        true,
+		"2001:db9::1":        false,
+		"198.51.100.7":       true,
+		"198.51.100.8":       false,
+		"::ffff:203.0.113.5": true,
+	} {
+		blocked, err := s.IsIPBlocked(ip)
+		require.NoError(t, err)
+		assert.Equal(t, want, blocked, ip)
+	}
+
+	// An allowlisted host inside a blocked range stays reachable
+	require.NoError(t, s.AllowIP("203.0.113.10", "office", "Admin"))
+	blocked, _ := s.IsIPBlocked("203.0.113.10")
+	assert.False(t, blocked)
+	blocked, _ = s.IsIPBlocked("203.0.113.11")
+	assert.True(t, blocked)
+
+	// Unblocking is a hard delete, so the range can be blocked again
+	require.NoError(t, s.UnblockIP("203.0.113.0/24"))
+	blocked, _ = s.IsIPBlocked("203.0.113.9")
+	assert.False(t, blocked)
+	require.NoError(t, s.BlockIP("203.0.113.0/24", "again", "Admin", 0))
+	blocked, _ = s.IsIPBlocked("203.0.113.9")
+	assert.True(t, blocked)
+}
+
+func TestMonitorStore_ExpiryAndSweep(t *testing.T) {
+	s, now := newTestMonitorStore(t)
+
+	require.NoError(t, s.BlockIP("192.0.2.1", "short", "System", time.Hour))
+	require.NoError(t, s.BlockIP("192.0.2.2", "permanent", "Admin", 0))
+
+	blocked, _ := s.IsIPBlocked("192.0.2.1")
+	assert.True(t, blocked)
+
+	*now = now.Add(2 * time.Hour)
+	blocked, _ = s.IsIPBlocked("192.0.2.1")
+	assert.False(t, blocked, "expired entries stop matching before the sweep runs")
+
+	n, err := s.SweepExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	ips, err := s.GetBlockedIPs()
+	require.NoError(t, err)
+	require.Len(t, ips, 1)
+	assert.Equal(t, "192.0.2.2", ips[0].IPAddress)
+}
+
+func TestMonitorStore_BlockLinksSecurityLogs(t *testing.T) {
+	s, _ := newTestMonitorStore(t)
+
+	first := &models.SecurityLog{IPAddress: "192.0.2.5", AttackType: "XSS", Status: "Blocked"}
+	second := &models.SecurityLog{IPAddress: "192.0.2.5", AttackType: "SQL Injection", Status: "Blocked"}
+	require.NoError(t, s.CreateSecurityLog(first))
+	require.NoError(t, s.CreateSecurityLog(second))
+
+	require.NoError(t, s.BlockIP("192.0.2.5", "High Risk Activity: XSS", "System", time.Hour, first.ID))
+	require.NoError(t, s.BlockIP("192.0.2.5", "High Risk Activity: SQL Injection", "System", time.Hour, second.ID))
+
+	ips, err := s.GetBlockedIPs()
+	require.NoError(t, err)
+	require.Len(t, ips, 1)
+
+	entry, err := s.GetBlockedIP(ips[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "High Risk Activity: SQL Injection", entry.Reason)
+	assert.Len(t, entry.SecurityLogs, 2)
+}
+
+func TestMonitorStore_ImportExport(t *testing.T) {
+	s, _ := newTestMonitorStore(t)
+
+	feed := `; Spamhaus DROP List
+1.10.16.0/20 ; SBL256894
+2001:db8:dead::/48	# bad v6 range
+198.51.100.23
+garbage
+`
+	entries, err := ParseBlocklistText(strings.NewReader(feed))
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "SBL256894", entries[0].Reason)
+
+	result, err := s.ImportBlocklist(entries, "Imported", "Admin", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Imported)
+	assert.Equal(t, []string{"garbage"}, result.Invalid)
+
+	blocked, _ := s.IsIPBlocked("1.10.20.1")
+	assert.True(t, blocked)
+
+	exported, err := s.ExportBlocklist(models.IPActionBlock)
+	require.NoError(t, err)
+	require.Len(t, exported, 3)
+
+	var out strings.Builder
+	require.NoError(t, WriteBlocklistText(&out, exported))
+	roundTrip, err := ParseBlocklistText(strings.NewReader(out.String()))
+	require.NoError(t, err)
+	assert.Equal(t, exported[0].IPAddress, roundTrip[0].IPAddress)
+	assert.Equal(t, exported[0].Reason, roundTrip[0].Reason)
+}
+
+func TestMonitorStore_SeedAllowlist(t *testing.T) {
+	s, _ := newTestMonitorStore(t)
+	require.NoError(t, s.SeedAllowlist())
+	require.NoError(t, s.SeedAllowlist())
+
+	assert.ErrorIs(t, s.BlockIP("127.0.0.1", "oops", "System", 0), ErrAllowlisted)
+	blocked, _ := s.IsIPBlocked("127.0.0.1")
+	assert.False(t, blocked)
+	blocked, _ = s.IsIPBlocked("::1")
+	assert.False(t, blocked)
+	assert.True(t, s.IsIPAllowed("127.0.0.53"))
+}
+
+func TestMonitorStore_BlockKeepsAllowlist(t *testing.T) {
+	s, _ := newTestMonitorStore(t)
+	require.NoError(t, s.AllowIP("192.0.2.0/24", "office", "Admin"))
+
+	// Blocking the same key must not turn the allow row into a block
+	assert.ErrorIs(t, s.BlockIP("192.0.2.0/24", "", "Admin", 0), ErrAllowlisted)
+	assert.ErrorIs(t, s.BlockIP("192.0.2.9", "", "Admin", 0), ErrAllowlisted)
+	allowed, err := s.GetAllowedIPs()
+	require.NoError(t, err)
+	require.Len(t, allowed, 1)
+
+	// A wider block only partly overlaps the allowlist, which still wins
+	require.NoError(t, s.BlockIP("192.0.0.0/16", "", "Admin", 0))
+	blocked, _ := s.IsIPBlocked("192.0.2.9")
+	assert.False(t, blocked)
+
+	emitted := &recordingEmitter{}
+	s.SetEmitter(emitted)
+	result, err := s.ImportBlocklist([]BlocklistEntry{{IPAddress: "192.0.2.0/24"}, {IPAddress: "198.51.100.1"}}, "Imported", "Admin", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Imported)
+	assert.Equal(t, []string{"192.0.2.0/24"}, result.Allowlisted)
+	assert.True(t, s.IsIPAllowed("192.0.2.9"))
+	assert.Equal(t, []events.Payload{events.IPBlocked{IP: "198.51.100.1", Reason: "Imported", BlockedBy: "Admin"}}, emitted.payloads)
+}
+
+type recordingEmitter struct {
+	payloads []events.Payload
+}
+
+func (r *recordingEmitter) Emit(p events.Payload) error {
+	r.payloads = append(r.payloads, p)
+	return nil
+}
+
+func (r *recordingEmitter) EmitTx(_ *gorm.DB, p events.Payload) error {
+	return r.Emit(p)
+}
+
+type fakeResolver map[string]geoip.Info
+
+func (f fakeResolver) Lookup(ip string) geoip.Info {
+	return f[ip]
+}
+
+func TestMonitorStore_GeoEnrichmentAndPolicies(t *testing.T) {
+	s, _ := newTestMonitorStore(t)
+	s.SetGeoResolver(fakeResolver{
+		"198.51.100.1": {CountryCode: "NL", Country: "Netherlands", ASN: 14061, ASOrg: "DIGITALOCEAN-ASN"},
+		"198.51.100.2": {CountryCode: "NL", Country: "Netherlands", ASN: 1136, ASOrg: "KPN"},
+		"203.0.113.1":  {CountryCode: "US", Country: "United States", ASN: 14061, ASOrg: "DIGITALOCEAN-ASN"},
+	})
+
+	log := &models.SecurityLog{IPAddress: "198.51.100.1", AttackType: "XSS", Status: "Blocked"}
+	require.NoError(t, s.CreateSecurityLog(log))
+	assert.Equal(t, "NL", log.CountryCode)
+	assert.Equal(t, uint(14061), log.ASN)
+
+	assert.ErrorIs(t, s.SaveGeoPolicy(&models.GeoPolicy{Kind: "country", Value: "Netherlands", Action: "block"}), ErrInvalidGeoPolicy)
+	assert.ErrorIs(t, s.SaveGeoPolicy(&models.GeoPolicy{Kind: "asn", Value: "14061", Action: "allow"}), ErrInvalidGeoPolicy)
+	require.NoError(t, s.SaveGeoPolicy(&models.GeoPolicy{Kind: "country", Value: "nl", Action: "block"}))
+	require.NoError(t, s.SaveGeoPolicy(&models.GeoPolicy{Kind: "asn", Value: "AS14061", Action: "challenge"}))
+
+	// The ASN policy is more specific than the country policy
+	p, _ := s.GeoPolicyFor("198.51.100.1")
+	require.NotNil(t, p)
+	assert.Equal(t, models.GeoActionChallenge, p.Action)
+	p, _ = s.GeoPolicyFor("198.51.100.2")
+	require.NotNil(t, p)
+	assert.Equal(t, models.GeoActionBlock, p.Action)
+	p, _ = s.GeoPolicyFor("192.0.2.1")
+	assert.Nil(t, p)
+
+	// Saving the same country again updates rather than duplicates
+	require.NoError(t, s.SaveGeoPolicy(&models.GeoPolicy{Kind: "country", Value: "NL", Action: "challenge"}))
+	policies, err := s.GetGeoPolicies()
+	require.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	require.NoError(t, s.CreateSecurityLog(&models.SecurityLog{IPAddress: "198.51.100.2", AttackType: "None", Status: "Logged"}))
+	require.NoError(t, s.CreateSecurityLog(&models.SecurityLog{IPAddress: "203.0.113.1", AttackType: "SQL Injection", Status: "Detected"}))
+	require.NoError(t, s.CreateSecurityLog(&models.SecurityLog{IPAddress: "192.0.2.1", AttackType: "None", Status: "Logged"}))
+
+	// CreatedAt is set by gorm from the wall clock
+	since := time.Now().Add(-time.Hour)
+	countries, err := s.TopCountries(since, 10, false)
+	require.NoError(t, err)
+	require.Len(t, countries, 2, "unknown locations are left out")
+	assert.Equal(t, GeoCount{Key: "NL", Label: "Netherlands", Count: 2, Blocked: 1}, countries[0])
+
+	asns, err := s.TopASNs(since, 10, true)
+	require.NoError(t, err)
+	require.Len(t, asns, 1)
+	assert.Equal(t, GeoCount{Key: "14061", Label: "DIGITALOCEAN-ASN", Count: 2, Blocked: 1}, asns[0])
+}
+
+func TestMonitorStore_SearchAndAggregate(t *testing.T) {
+	s, _ := newTestMonitorStore(t)
+	s.SetLogPolicy(LogPolicy{BenignSampleRate: 1, KeepBenignPayload: true})
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.CreateSecurityLog(&models.SecurityLog{IPAddress: "192.0.2.1", Path: "/api/v1/scan", AttackType: "None", Status: "Logged", Payload: "q=1"}))
+	}
+	require.NoError(t, s.CreateSecurityLog(&models.SecurityLog{IPAddress: "192.0.2.9", Path: "/api/v1/login", AttackType: "SQL Injection", Status: "Blocked", RiskScore: 10}))
+	require.NoError(t, s.CreateSecurityLog(&models.SecurityLog{IPAddress: "192.0.2.9", Path: "/api/v1_legacy", AttackType: "XSS", Status: "Detected", RiskScore: 5}))
+
+	page, err := s.SearchSecurityLogs(LogFilter{}, "", 3)
+	require.NoError(t, err)
+	require.Len(t, page.Logs, 3)
+	assert.Equal(t, "XSS", page.Logs[0].AttackType, "newest first")
+	var seen []uint
+	for page.NextCursor != "" {
+		for _, l := range page.Logs {
+			seen = append(seen, l.ID)
+		}
+		page, err = s.SearchSecurityLogs(LogFilter{}, page.NextCursor, 3)
+		require.NoError(t, err)
+	}
+	seen = append(seen, page.Logs[0].ID)
+	assert.Len(t, seen, 7, "pages neither skip nor repeat entries")
+
+	minRisk := 6
+	page, err = s.SearchSecurityLogs(LogFilter{IP: "192.0.2.9", MinRisk: &minRisk}, "", 10)
+	require.NoError(t, err)
+	require.Len(t, page.Logs, 1)
+	assert.Equal(t, "SQL Injection", page.Logs[0].AttackType)
+
+	// "_" is a literal in path prefixes, not a LIKE wildcard
+	page, err = s.SearchSecurityLogs(LogFilter{Path: "/api/v1_"}, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, page.Logs, 1)
+
+	_, err = s.SearchSecurityLogs(LogFilter{}, "bogus", 10)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	agg, err := s.AggregateSecurityLogs(LogFilter{}, time.Hour, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), agg.Total)
+	assert.Equal(t, []LogBucket{{Key: "192.0.2.1", Count: 5}}, agg.TopIPs)
+	assert.Contains(t, agg.ByStatus, LogBucket{Key: "Blocked", Count: 1})
+	require.Len(t, agg.Histogram, 1)
+	assert.Equal(t, int64(7), agg.Histogram[0].Count)
+	assert.Equal(t, int64(1), agg.Histogram[0].Blocked)
+}
+
+func TestMonitorStore_SamplingAndRetention(t *testing.T) {
+	s, now := newTestMonitorStore(t)
+	dir := t.TempDir()
+	s.SetLogPolicy(LogPolicy{
+		BenignSampleRate: 1,
+		SkipPaths:        []string{"/health"},
+		Retention:        30 * 24 * time.Hour,
+		BenignRetention:  24 * time.Hour,
+		ArchiveDir:       dir,
+	})
+
+	health := &models.SecurityLog{IPAddress: "192.0.2.1", Path: "/health", Status: "Logged"}
+	require.NoError(t, s.CreateSecurityLog(health))
+	assert.Zero(t, health.ID, "health checks are not stored")
+
+	benign := &models.SecurityLog{IPAddress: "192.0.2.1", Path: "/api/v1/scan", Status: "Logged", Payload: "secret=1"}
+	require.NoError(t, s.CreateSecurityLog(benign))
+	assert.Empty(t, benign.Payload, "benign payloads are dropped by default")
+
+	attack := &models.SecurityLog{IPAddress: "192.0.2.5", Path: "/api/v1/login", AttackType: "XSS", Status: "Blocked"}
+	require.NoError(t, s.CreateSecurityLog(attack))
+	require.NoError(t, s.BlockIP("192.0.2.5", "XSS", "System", 0, attack.ID))
+
+	// CreatedAt comes from the wall clock, so prune relative to it
+	*now = time.Now().Add(2 * 24 * time.Hour)
+	result, err := s.PruneSecurityLogs()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Deleted, "only the benign log is past its retention")
+	require.Len(t, result.Archives, 1)
+
+	*now = time.Now().Add(31 * 24 * time.Hour)
+	result, err = s.PruneSecurityLogs()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Deleted)
+
+	entry, err := s.GetBlockedIP(s.lists.Load().block.Matches(netip.MustParseAddr("192.0.2.5"))[0].id)
+	require.NoError(t, err)
+	assert.Empty(t, entry.SecurityLogs, "blocks outlive the logs that caused them")
+
+	archives, err := s.ListLogArchives()
+	require.NoError(t, err)
+	require.Len(t, archives, 2)
+	path, err := s.LogArchivePath(archives[0].Name)
+	require.NoError(t, err)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	var archived models.SecurityLog
+	require.NoError(t, json.NewDecoder(gz).Decode(&archived))
+	assert.Equal(t, attack.ID, archived.ID)
+
+	_, err = s.LogArchivePath("../" + archives[0].Name)
+	assert.Error(t, err)
+}
+
+func TestMonitorStore_ScrubSecurityLogs(t *testing.T) {
+	s, _ := newTestMonitorStore(t)
+	s.SetLogPolicy(LogPolicy{BenignSampleRate: 1, KeepBenignPayload: true})
+
+	// Written before redaction, as older releases did
+	legacy := &models.SecurityLog{
+		IPAddress: "192.0.2.1", Path: "/api/v1/auth/login", Status: "Detected", AttackType: "SQL Injection",
+		Payload: `{"email":"a@example.com","password":"' OR 1=1 --"}`,
+		Matches: []models.RuleMatch{{RuleID: "942100", Target: "JSON:password", Value: "' OR 1=1 --"}},
+	}
+	require.NoError(t, s.db.Create(legacy).Error)
+	clean := &models.SecurityLog{IPAddress: "192.0.2.1", Path: "/api/v1/scan", Status: "Logged", Payload: "target=example.com"}
+	require.NoError(t, s.CreateSecurityLog(clean))
+
+	result, err := s.ScrubSecurityLogs(true)
+	require.NoError(t, err)
+	assert.Equal(t, &ScrubResult{Scanned: 2, Updated: 1}, result)
+	stored, err := s.GetSecurityLog(legacy.ID)
+	require.NoError(t, err)
+	assert.Contains(t, stored.Payload, "OR 1=1", "dry runs change nothing")
+
+	result, err = s.ScrubSecurityLogs(false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Updated)
+	stored, err = s.GetSecurityLog(legacy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, `{"email":"a@example.com","password":"[REDACTED]"}`, stored.Payload)
+	assert.Equal(t, redact.Mask, stored.Matches[0].Value)
+
+	result, err = s.ScrubSecurityLogs(false)
+	require.NoError(t, err)
+	assert.Zero(t, result.Updated)
+}
+
+func TestMonitorStore_ActivePrefixes(t *testing.T) {
+	s, now := newTestMonitorStore(t)
+	changes := 0
+	s.OnChange(func() { changes++ })
+
+	require.NoError(t, s.BlockIP("203.0.113.0/24", "scan", "Admin", 0))
+	require.NoError(t, s.BlockIP("198.51.100.1", "brute force", "System", time.Hour))
+	require.NoError(t, s.AllowIP("192.0.2.1", "office", "Admin"))
+	assert.Equal(t, 3, changes)
+
+	blocks, err := s.ActivePrefixes(models.IPActionBlock)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24"), netip.MustParsePrefix("198.51.100.1/32")}, blocks)
+
+	// Expired blocks are excluded even before the sweeper deletes them
+	*now = now.Add(2 * time.Hour)
+	blocks, err = s.ActivePrefixes(models.IPActionBlock)
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}, blocks)
+
+	// Blocks behind more security logs rank first, then newer ones
+	for _, b := range []struct {
+		ip   string
+		logs int
+	}{{"192.0.2.10", 1}, {"192.0.2.11", 2}, {"192.0.2.12", 0}} {
+		var ids []uint
+		for i := 0; i < b.logs; i++ {
+			log := &models.SecurityLog{IPAddress: b.ip, AttackType: "XSS", Status: "Blocked"}
+			require.NoError(t, s.CreateSecurityLog(log))
+			ids = append(ids, log.ID)
+		}
+		require.NoError(t, s.BlockIP(b.ip, "", "System", 0, ids...))
+	}
+	blocks, err = s.ActivePrefixes(models.IPActionBlock)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.11/32", "192.0.2.10/32", "192.0.2.12/32", "203.0.113.0/24"}, prefixStrings(blocks))
+}
+
+func prefixStrings(ps []netip.Prefix) []string {
+	out := make([]string, len(ps))
+	for i, p := range ps {
+		out[i] = p.String()
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/redact"
+)
+
+// Logs are scrubbed in batches to bound memory and lock time
+const scrubBatch = 500
+
+// SetRedactor replaces the redactor used for new and scrubbed logs
+func (s *MonitorStore) SetRedactor(r *redact.Redactor) {
+	s.redactor.Store(r)
+}
+
+// Redactor masks credentials in payloads before they are logged
+func (s *MonitorStore) Redactor() *redact.Redactor {
+	return s.redactor.Load()
+}
+
+func (s *MonitorStore) redactMatches(log *models.SecurityLog) bool {
+	r := s.Redactor()
+	changed := false
+	for i, m := range log.Matches {
+		if v := r.Value(m.Target, m.Value); v != m.Value {
+			log.Matches[i].Value = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ScrubResult reports what a scrub run did
+type ScrubResult struct {
+	Scanned int `json:"scanned"`
+	Updated int `json:"updated"`
+}
+
+// ScrubSecurityLogs applies the current redactor to logs written before
+// redaction was enabled, or before the redaction rules were extended. With
+// dryRun set it only counts the logs that would change.
+func (s *MonitorStore) ScrubSecurityLogs(dryRun bool) (*ScrubResult, error) {
+	r := s.Redactor()
+	result := &ScrubResult{}
+	var after uint
+	for {
+		var batch []models.SecurityLog
+		if err := s.db.Unscoped().Where("id > ?", after).Order("id").Limit(scrubBatch).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+		for i := range batch {
+			log := &batch[i]
+			after = log.ID
+			result.Scanned++
+
+			payload := r.Scrub(log.Payload)
+			matches := s.redactMatches(log)
+			if payload == log.Payload && !matches {
+				continue
+			}
+			result.Updated++
+			if dryRun {
+				continue
+			}
+			log.Payload = payload
+			err := s.db.Unscoped().Model(log).Select("payload", "matches").UpdateColumns(log).Error
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
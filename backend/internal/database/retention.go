@@ -0,0 +1,285 @@
+package database
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/models"
+	"gorm.io/gorm"
+)
+
+// LogPolicy controls which security logs are stored and for how long.
+// Benign entries are those with status "Logged": requests that passed the
+// WAF without a match.
+type LogPolicy struct {
+	// Fraction of benign requests stored, from 0 to 1
+	BenignSampleRate float64
+	// Benign requests to these path prefixes are never stored
+	SkipPaths []string
+	// Store request payloads of benign requests
+	KeepBenignPayload bool
+
+	// Logs older than this are pruned; zero keeps them forever
+	Retention time.Duration
+	// Shorter retention for benign logs; zero uses Retention
+	BenignRetention time.Duration
+	// Pruned logs are written here as gzipped JSON lines first; empty
+	// deletes without archiving
+	ArchiveDir string
+}
+
+// DefaultLogPolicy keeps every log forever, except benign health checks
+// and metrics scrapes, and drops the payloads of benign requests
+func DefaultLogPolicy() LogPolicy {
+	return LogPolicy{
+		BenignSampleRate: 1,
+		SkipPaths:        []string{"/health", "/metrics"},
+	}
+}
+
+// Logs are pruned and archived in batches to bound memory and lock time
+const pruneBatch = 1000
+
+func (s *MonitorStore) SetLogPolicy(p LogPolicy) {
+	s.policy.Store(&p)
+}
+
+func (s *MonitorStore) LogPolicy() LogPolicy {
+	if p := s.policy.Load(); p != nil {
+		return *p
+	}
+	return DefaultLogPolicy()
+}
+
+func isBenign(log *models.SecurityLog) bool {
+	return log.Status == "Logged"
+}
+
+// keep applies the sampling policy. It may clear the payload of benign
+// entries it keeps.
+func (s *MonitorStore) keep(log *models.SecurityLog) bool {
+	if !isBenign(log) {
+		return true
+	}
+	p := s.LogPolicy()
+	for _, prefix := range p.SkipPaths {
+		if prefix != "" && strings.HasPrefix(log.Path, prefix) {
+			return false
+		}
+	}
+	if p.BenignSampleRate < 1 && rand.Float64() >= p.BenignSampleRate {
+		return false
+	}
+	if !p.KeepBenignPayload {
+		log.Payload = ""
+	}
+	return true
+}
+
+// PruneResult reports what a prune run did
+type PruneResult struct {
+	Deleted  int      `json:"deleted"`
+	Archives []string `json:"archives,omitempty"`
+}
+
+// PruneSecurityLogs deletes logs past their retention, archiving them first
+// when an archive directory is configured. Logs linked to IP blocks are
+// unlinked; the blocks themselves are kept.
+func (s *MonitorStore) PruneSecurityLogs() (*PruneResult, error) {
+	p := s.LogPolicy()
+	result := &PruneResult{}
+	if p.Retention <= 0 && p.BenignRetention <= 0 {
+		return result, nil
+	}
+
+	var archive *logArchive
+	if p.ArchiveDir != "" {
+		var err error
+		if archive, err = newLogArchive(p.ArchiveDir, s.now()); err != nil {
+			return nil, err
+		}
+		defer archive.Close()
+	}
+
+	now := s.now()
+	var conds []func(*gorm.DB) *gorm.DB
+	if p.Retention > 0 {
+		cutoff := now.Add(-p.Retention)
+		conds = append(conds, func(q *gorm.DB) *gorm.DB { return q.Where("created_at < ?", cutoff) })
+	}
+	if p.BenignRetention > 0 {
+		cutoff := now.Add(-p.BenignRetention)
+		conds = append(conds, func(q *gorm.DB) *gorm.DB {
+			return q.Where("status = ? AND created_at < ?", "Logged", cutoff)
+		})
+	}
+
+	for _, cond := range conds {
+		for {
+			var batch []models.SecurityLog
+			if err := cond(s.db.Unscoped()).Order("id").Limit(pruneBatch).Find(&batch).Error; err != nil {
+				return nil, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+			if archive != nil {
+				if err := archive.Write(batch); err != nil {
+					return nil, err
+				}
+			}
+			if err := s.deleteLogs(batch); err != nil {
+				return nil, err
+			}
+			result.Deleted += len(batch)
+			if len(batch) < pruneBatch {
+				break
+			}
+		}
+	}
+
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			return nil, err
+		}
+		if archive.count > 0 {
+			result.Archives = append(result.Archives, filepath.Base(archive.path))
+		} else {
+			os.Remove(archive.path)
+		}
+	}
+	return result, nil
+}
+
+func (s *MonitorStore) deleteLogs(logs []models.SecurityLog) error {
+	ids := make([]uint, len(logs))
+	for i, l := range logs {
+		ids[i] = l.ID
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("blocked_ip_logs").Where("security_log_id IN ?", ids).Delete(nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.SecurityLog{}, ids).Error
+	})
+}
+
+// StartRetention prunes logs in the background
+func (s *MonitorStore) StartRetention(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			result, err := s.PruneSecurityLogs()
+			if err != nil {
+				slog.Warn("MonitorStore: failed to prune security logs", "error", err)
+				continue
+			}
+			if result.Deleted > 0 {
+				slog.Info("MonitorStore: pruned security logs", "count", result.Deleted, "archives", result.Archives)
+			}
+		}
+	}()
+}
+
+// logArchive writes one gzipped JSON document per line
+type logArchive struct {
+	path   string
+	file   *os.File
+	gz     *gzip.Writer
+	enc    *json.Encoder
+	count  int
+	closed bool
+}
+
+func newLogArchive(dir string, now time.Time) (*logArchive, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "security-logs-"+now.UTC().Format("20060102T150405Z")+".jsonl.gz")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	return &logArchive{path: path, file: f, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+func (a *logArchive) Write(logs []models.SecurityLog) error {
+	for i := range logs {
+		if err := a.enc.Encode(&logs[i]); err != nil {
+			return err
+		}
+	}
+	a.count += len(logs)
+	// Flush so a crash loses at most the current batch
+	return a.gz.Flush()
+}
+
+func (a *logArchive) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+// LogArchiveInfo describes an archive file
+type LogArchiveInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListLogArchives returns the archives in the configured directory, newest
+// first
+func (s *MonitorStore) ListLogArchives() ([]LogArchiveInfo, error) {
+	dir := s.LogPolicy().ArchiveDir
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []LogArchiveInfo
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".jsonl.gz") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, LogArchiveInfo{Name: e.Name(), Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name > out[j].Name })
+	return out, nil
+}
+
+// LogArchivePath resolves an archive name from ListLogArchives to a path,
+// rejecting anything outside the archive directory
+func (s *MonitorStore) LogArchivePath(name string) (string, error) {
+	dir := s.LogPolicy().ArchiveDir
+	if dir == "" || name != filepath.Base(name) || !strings.HasSuffix(name, ".jsonl.gz") {
+		return "", os.ErrNotExist
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuditEntry is a domain event kept for the audit trail
+type AuditEntry struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	EventID    string    `json:"event_id" gorm:"uniqueIndex;size:36"`
+	Type       string    `json:"type" gorm:"index"`
+	Summary    string    `json:"summary"`
+	Data       string    `json:"data"`
+	OccurredAt time.Time `json:"occurred_at" gorm:"index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditLog records every event. Unlike the outbox it is never purged.
+type AuditLog struct {
+	db *gorm.DB
+}
+
+func NewAuditLog(db *gorm.DB) *AuditLog {
+	return &AuditLog{db: db}
+}
+
+// Handle stores an event; redelivered events are ignored
+func (a *AuditLog) Handle(ctx context.Context, e Event) error {
+	entry := AuditEntry{EventID: e.ID, Type: e.Type, Data: string(e.Data), OccurredAt: e.Time}
+	if p, err := e.Payload(); err == nil {
+		entry.Summary = p.Summary()
+	}
+	return a.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error
+}
+
+// List returns entries, newest first, optionally of one type and before
+// an entry ID for paging
+func (a *AuditLog) List(eventType string, before uint, limit int) ([]AuditEntry, error) {
+	q := a.db.Order("id desc").Limit(limit)
+	if eventType != "" {
+		q = q.Where("type = ?", eventType)
+	}
+	if before > 0 {
+		q = q.Where("id < ?", before)
+	}
+	var out []AuditEntry
+	err := q.Find(&out).Error
+	return out, err
+}
@@ -0,0 +1,383 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxEvent is an emitted event. Seq orders events in the order they
+// were dispatched, which unlike ID is also the order in which their
+// transactions committed.
+type OutboxEvent struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	EventID      string     `json:"event_id" gorm:"uniqueIndex;size:36"`
+	Type         string     `json:"type" gorm:"index"`
+	Payload      string     `json:"payload"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DispatchedAt *time.Time `json:"dispatched_at" gorm:"index"`
+	Seq          *uint64    `json:"seq" gorm:"index"`
+}
+
+func (o OutboxEvent) event() Event {
+	return Event{ID: o.EventID, Type: o.Type, Time: o.CreatedAt, Data: json.RawMessage(o.Payload)}
+}
+
+// DeadLetter is an event a subscriber still failed to handle after
+// MaxAttempts. It can be redelivered once the cause is fixed.
+type DeadLetter struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	EventID    string    `json:"event_id" gorm:"index"`
+	Type       string    `json:"type"`
+	Payload    string    `json:"payload"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Subscriber string    `json:"subscriber" gorm:"index"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SubscriberStatus counts deliveries to one subscriber since startup
+type SubscriberStatus struct {
+	Name        string     `json:"name"`
+	Types       []string   `json:"types,omitempty"`
+	Broadcast   bool       `json:"broadcast,omitempty"`
+	Delivered   int64      `json:"delivered"`
+	Retries     int64      `json:"retries"`
+	DeadLetters int64      `json:"dead_letters"`
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// Status is the state of the bus
+type Status struct {
+	Transport   string             `json:"transport"`
+	Pending     int64              `json:"pending"` // Emitted but not yet dispatched
+	DeadLetters int64              `json:"dead_letters"`
+	Subscribers []SubscriberStatus `json:"subscribers"`
+}
+
+// Bus relays events from the outbox to the transport and dispatches them
+// to subscribers
+type Bus struct {
+	db        *gorm.DB
+	transport Transport
+	trigger   chan struct{}
+	now       func() time.Time
+
+	// Attempts per event and subscriber before it is dead-lettered
+	MaxAttempts int
+	// Delay before the first retry, doubled for each further attempt
+	RetryDelay time.Duration
+	// Dispatched events are deleted after this long
+	Retention time.Duration
+	// How often the outbox is checked when nothing triggers the relay
+	PollInterval time.Duration
+
+	mu      sync.Mutex
+	subs    []Subscription
+	stats   map[string]*SubscriberStatus
+	seq     uint64 // Last assigned Seq; owned by the relay
+	seqInit bool
+	stop    context.CancelFunc
+	stopped sync.WaitGroup
+}
+
+// NewBus creates a bus delivering through transport; nil delivers from the
+// outbox table itself, which only supports a single replica
+func NewBus(db *gorm.DB, transport Transport) *Bus {
+	if transport == nil {
+		transport = NewOutboxTransport(db)
+	}
+	return &Bus{
+		db:           db,
+		transport:    transport,
+		trigger:      make(chan struct{}, 1),
+		now:          time.Now,
+		MaxAttempts:  5,
+		RetryDelay:   time.Second,
+		Retention:    7 * 24 * time.Hour,
+		PollInterval: 2 * time.Second,
+		stats:        make(map[string]*SubscriberStatus),
+	}
+}
+
+// Emit records an event for delivery
+func (b *Bus) Emit(p Payload) error {
+	return b.EmitTx(b.db, p)
+}
+
+// EmitTx records an event in tx. It is delivered once tx commits and
+// discarded if it rolls back.
+func (b *Bus) EmitTx(tx *gorm.DB, p Payload) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	row := OutboxEvent{EventID: uuid.NewString(), Type: p.EventType(), Payload: string(data), CreatedAt: b.now().UTC()}
+	if err := tx.Create(&row).Error; err != nil {
+		return err
+	}
+	b.Trigger()
+	return nil
+}
+
+// Trigger makes the relay check the outbox soon
+func (b *Bus) Trigger() {
+	select {
+	case b.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe registers a subscriber; call before Start
+func (b *Bus) Subscribe(sub Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, sub)
+	b.stats[sub.Name] = &SubscriberStatus{Name: sub.Name, Types: sub.Types, Broadcast: sub.Broadcast}
+}
+
+// Start runs the relay and one consumer per subscriber until Stop
+func (b *Bus) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.mu.Lock()
+	b.stop = cancel
+	subs := append([]Subscription(nil), b.subs...)
+	b.mu.Unlock()
+
+	b.stopped.Add(1 + len(subs))
+	go func() {
+		defer b.stopped.Done()
+		b.relay(ctx)
+	}()
+	for _, sub := range subs {
+		go func(sub Subscription) {
+			defer b.stopped.Done()
+			b.transport.Consume(ctx, sub, func(e Event) { b.deliver(ctx, sub, e) })
+		}(sub)
+	}
+}
+
+// Stop stops the relay and consumers and waits for in-flight handlers
+func (b *Bus) Stop() {
+	b.mu.Lock()
+	stop := b.stop
+	b.mu.Unlock()
+	if stop != nil {
+		stop()
+		b.stopped.Wait()
+	}
+}
+
+func (b *Bus) relay(ctx context.Context) {
+	lastPurge := time.Time{}
+	for {
+		for {
+			n, err := b.Dispatch(ctx)
+			if err != nil {
+				slog.Warn("Event relay failed", "error", err)
+				break
+			}
+			if n == 0 {
+				break
+			}
+		}
+		if b.now().Sub(lastPurge) > time.Hour {
+			b.purge()
+			lastPurge = b.now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.trigger:
+		case <-time.After(b.PollInterval):
+		}
+	}
+}
+
+// Dispatch claims a batch of undispatched events in emit order and sends
+// them to the transport. It returns the number sent.
+func (b *Bus) Dispatch(ctx context.Context) (int, error) {
+	if !b.seqInit {
+		var last struct{ Seq uint64 }
+		if err := b.db.Model(&OutboxEvent{}).Select("COALESCE(MAX(seq), 0) AS seq").Scan(&last).Error; err != nil {
+			return 0, err
+		}
+		b.seq, b.seqInit = last.Seq, true
+	}
+
+	var rows []OutboxEvent
+	if err := b.db.Where("dispatched_at IS NULL").Order("id").Limit(100).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	var claimed []OutboxEvent
+	for _, row := range rows {
+		now := b.now().UTC()
+		seq := b.seq + 1
+		// Another replica's relay may have claimed it already
+		res := b.db.Model(&OutboxEvent{}).Where("id = ? AND dispatched_at IS NULL", row.ID).
+			Updates(map[string]any{"dispatched_at": now, "seq": seq})
+		if res.Error != nil {
+			return 0, res.Error
+		}
+		if res.RowsAffected == 1 {
+			b.seq = seq
+			row.DispatchedAt, row.Seq = &now, &seq
+			claimed = append(claimed, row)
+		}
+	}
+	if len(claimed) == 0 {
+		return 0, nil
+	}
+
+	batch := make([]Event, len(claimed))
+	ids := make([]uint, len(claimed))
+	for i, row := range claimed {
+		batch[i], ids[i] = row.event(), row.ID
+	}
+	if err := b.transport.Send(ctx, batch); err != nil {
+		// Release the claim so the events are sent again
+		b.db.Model(&OutboxEvent{}).Where("id IN ?", ids).Updates(map[string]any{"dispatched_at": nil, "seq": nil})
+		return 0, err
+	}
+	return len(claimed), nil
+}
+
+func (b *Bus) purge() {
+	cutoff := b.now().Add(-b.Retention)
+	if err := b.db.Where("dispatched_at < ?", cutoff).Delete(&OutboxEvent{}).Error; err != nil {
+		slog.Warn("Failed to purge event outbox", "error", err)
+	}
+}
+
+// deliver runs the handler, retrying with backoff, and dead-letters the
+// event when every attempt fails
+func (b *Bus) deliver(ctx context.Context, sub Subscription, e Event) {
+	if !sub.wants(e.Type) {
+		return
+	}
+
+	delay := b.RetryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = call(ctx, sub.Handler, e); err == nil {
+			b.record(sub.Name, func(st *SubscriberStatus) { st.Delivered++ })
+			return
+		}
+		if attempt >= b.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		b.record(sub.Name, func(st *SubscriberStatus) { st.Retries++; st.LastError = err.Error() })
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, time.Minute)
+	}
+	if ctx.Err() != nil {
+		// Shutting down; undelivered events are picked up on restart
+		return
+	}
+
+	slog.Error("Event handler failed, dead-lettering event", "subscriber", sub.Name, "event_id", e.ID, "type", e.Type, "error", err)
+	b.record(sub.Name, func(st *SubscriberStatus) { st.DeadLetters++; st.LastError = err.Error() })
+	dead := DeadLetter{
+		EventID:    e.ID,
+		Type:       e.Type,
+		Payload:    string(e.Data),
+		OccurredAt: e.Time,
+		Subscriber: sub.Name,
+		Attempts:   b.MaxAttempts,
+		Error:      err.Error(),
+	}
+	if err := b.db.Create(&dead).Error; err != nil {
+		slog.Error("Failed to store dead letter", "event_id", e.ID, "error", err)
+	}
+}
+
+// call runs a handler, turning a panic into an error so that one broken
+// handler cannot stop delivery to the others
+func call(ctx context.Context, h Handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Event handler panicked", "event_id", e.ID, "type", e.Type, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return h(ctx, e)
+}
+
+func (b *Bus) record(name string, update func(*SubscriberStatus)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if st := b.stats[name]; st != nil {
+		update(st)
+		now := b.now()
+		st.LastEventAt = &now
+	}
+}
+
+// Status returns delivery counters and backlog sizes
+func (b *Bus) Status() Status {
+	st := Status{Transport: b.transport.Name()}
+	b.db.Model(&OutboxEvent{}).Where("dispatched_at IS NULL").Count(&st.Pending)
+	b.db.Model(&DeadLetter{}).Count(&st.DeadLetters)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs {
+		st.Subscribers = append(st.Subscribers, *b.stats[sub.Name])
+	}
+	return st
+}
+
+// DeadLetters lists the most recent dead letters
+func (b *Bus) DeadLetters(limit int) ([]DeadLetter, error) {
+	var out []DeadLetter
+	err := b.db.Order("id desc").Limit(limit).Find(&out).Error
+	return out, err
+}
+
+// ErrNotFound is returned for unknown dead letters or subscribers
+var ErrNotFound = errors.New("not found")
+
+// Redeliver hands a dead letter to its subscriber once more and deletes
+// it if the handler succeeds
+func (b *Bus) Redeliver(ctx context.Context, id uint) error {
+	var dead DeadLetter
+	if err := b.db.First(&dead, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	b.mu.Lock()
+	var handler Handler
+	for _, sub := range b.subs {
+		if sub.Name == dead.Subscriber {
+			handler = sub.Handler
+		}
+	}
+	b.mu.Unlock()
+	if handler == nil {
+		return ErrNotFound
+	}
+
+	e := Event{ID: dead.EventID, Type: dead.Type, Time: dead.OccurredAt, Data: json.RawMessage(dead.Payload)}
+	if err := call(ctx, handler, e); err != nil {
+		b.db.Model(&dead).Updates(map[string]any{"attempts": dead.Attempts + 1, "error": err.Error()})
+		return err
+	}
+	return b.db.Delete(&dead).Error
+}
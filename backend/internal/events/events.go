@@ -0,0 +1,271 @@
+// Package events is the internal domain event bus. Engines emit typed
+// events into an outbox table, in the same transaction as the change they
+// describe where possible; a relay hands them to a transport, which
+// delivers them at least once to every subscriber. Handlers must therefore
+// be idempotent.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Event types
+const (
+	TypeFindingCreated    = "finding.created"
+	TypeScanCompleted     = "scan.completed"
+	TypeIPBlocked         = "ip.blocked"
+	TypeIPUnblocked       = "ip.unblocked"
+	TypeDetectionRaised   = "detection.raised"
+	TypeWAFBlocked        = "waf.blocked"
+	TypeCloudTrailAlert   = "cloudtrail.alert"
+	TypeHoneypotHit       = "honeypot.hit"
+	TypePlaybookCompleted = "playbook.completed"
+)
+
+// Payload is a typed event
+type Payload interface {
+	EventType() string
+	// Summary is a one-line description for alerts and the audit log
+	Summary() string
+}
+
+// FindingCreated is emitted for each vulnerability of a completed scan
+type FindingCreated struct {
+	ScanID    string `json:"scan_id"`
+	Target    string `json:"target"`
+	FindingID uint   `json:"finding_id"`
+	Title     string `json:"title"`
+	Severity  string `json:"severity"`
+	Category  string `json:"category"`
+	Solution  string `json:"solution,omitempty"`
+}
+
+func (FindingCreated) EventType() string { return TypeFindingCreated }
+
+func (e FindingCreated) Summary() string {
+	return fmt.Sprintf("%s finding on %s: %s", e.Severity, e.Target, e.Title)
+}
+
+// ScanCompleted is emitted once a scan stops running
+type ScanCompleted struct {
+	ScanID     string         `json:"scan_id"`
+	Target     string         `json:"target"`
+	Status     string         `json:"status"`
+	Findings   int            `json:"findings"`
+	BySeverity map[string]int `json:"by_severity,omitempty"`
+}
+
+func (ScanCompleted) EventType() string { return TypeScanCompleted }
+
+func (e ScanCompleted) Summary() string {
+	return fmt.Sprintf("Scan of %s %s with %d findings", e.Target, e.Status, e.Findings)
+}
+
+// IPBlocked is emitted when an address or prefix is added to the blocklist
+type IPBlocked struct {
+	IP        string     `json:"ip"`
+	Reason    string     `json:"reason"`
+	BlockedBy string     `json:"blocked_by"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (IPBlocked) EventType() string { return TypeIPBlocked }
+
+func (e IPBlocked) Summary() string {
+	return fmt.Sprintf("%s blocked by %s: %s", e.IP, e.BlockedBy, e.Reason)
+}
+
+// IPUnblocked is emitted when a block is removed
+type IPUnblocked struct {
+	IP string `json:"ip"`
+}
+
+func (IPUnblocked) EventType() string { return TypeIPUnblocked }
+
+func (e IPUnblocked) Summary() string { return e.IP + " unblocked" }
+
+// DetectionRaised is emitted by detection engines such as EDR and the
+// simulation engine
+type DetectionRaised struct {
+	Engine      string `json:"engine"`
+	Kind        string `json:"kind"` // e.g. SUSPICIOUS_PROCESS
+	Severity    string `json:"severity"`
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	Details     string `json:"details"`
+	Remediation string `json:"remediation,omitempty"` // Action already taken, if any
+	RecordID    uint   `json:"record_id,omitempty"`   // SimulationEvent row
+	// Simulated detections are shown to users but never alert or trigger
+	// playbooks
+	Simulated bool `json:"simulated,omitempty"`
+}
+
+func (DetectionRaised) EventType() string { return TypeDetectionRaised }
+
+func (e DetectionRaised) Summary() string {
+	s := fmt.Sprintf("%s detection by %s on %s: %s", e.Severity, e.Engine, e.Target, e.Details)
+	if e.Remediation != "" {
+		s += " (" + e.Remediation + ")"
+	}
+	return s
+}
+
+// WAFBlocked is emitted when the WAF blocks a request
+type WAFBlocked struct {
+	LogID       uint     `json:"log_id,omitempty"` // SecurityLog row
+	IP          string   `json:"ip"`
+	CountryCode string   `json:"country_code,omitempty"`
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	AttackType  string   `json:"attack_type"`
+	RiskScore   int      `json:"risk_score"`
+	RuleIDs     []string `json:"rule_ids,omitempty"`
+}
+
+func (WAFBlocked) EventType() string { return TypeWAFBlocked }
+
+func (e WAFBlocked) Summary() string {
+	return fmt.Sprintf("WAF blocked %s %s from %s: %s", e.Method, e.Path, e.IP, e.AttackType)
+}
+
+// CloudTrailAlert is emitted for each alert raised on a CloudTrail event
+type CloudTrailAlert struct {
+	AlertID     uint   `json:"alert_id"`
+	EventName   string `json:"event_name"`
+	EventSource string `json:"event_source"`
+	Actor       string `json:"actor"`
+	SourceIP    string `json:"source_ip"`
+	Region      string `json:"region"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message"`
+}
+
+func (CloudTrailAlert) EventType() string { return TypeCloudTrailAlert }
+
+func (e CloudTrailAlert) Summary() string { return e.Message }
+
+// HoneypotHit is emitted when a honeypot reports an interaction
+type HoneypotHit struct {
+	HoneypotID uint   `json:"honeypot_id"`
+	Name       string `json:"name"`
+	Kind       string `json:"kind"` // SSH, HTTP, Database
+	SourceIP   string `json:"source_ip"`
+	Port       int    `json:"port,omitempty"`
+	Details    string `json:"details,omitempty"`
+}
+
+func (HoneypotHit) EventType() string { return TypeHoneypotHit }
+
+func (e HoneypotHit) Summary() string {
+	return fmt.Sprintf("%s honeypot %q hit from %s", e.Kind, e.Name, e.SourceIP)
+}
+
+// ActionOutcome is the result of one playbook action
+type ActionOutcome struct {
+	Type  string `json:"type"`
+	Error string `json:"error,omitempty"`
+}
+
+// PlaybookCompleted is emitted after a playbook run
+type PlaybookCompleted struct {
+	PlaybookID string          `json:"playbook_id"`
+	Name       string          `json:"name"`
+	Trigger    string          `json:"trigger"`             // manual or the matched trigger
+	CausedBy   string          `json:"caused_by,omitempty"` // ID of the triggering event
+	StartedAt  time.Time       `json:"started_at"`
+	Actions    []ActionOutcome `json:"actions"`
+}
+
+func (PlaybookCompleted) EventType() string { return TypePlaybookCompleted }
+
+func (e PlaybookCompleted) Summary() string {
+	failed := 0
+	for _, a := range e.Actions {
+		if a.Error != "" {
+			failed++
+		}
+	}
+	return fmt.Sprintf("Playbook %q ran %d actions, %d failed", e.Name, len(e.Actions), failed)
+}
+
+var registry = map[string]func() Payload{
+	TypeFindingCreated:    func() Payload { return &FindingCreated{} },
+	TypeScanCompleted:     func() Payload { return &ScanCompleted{} },
+	TypeIPBlocked:         func() Payload { return &IPBlocked{} },
+	TypeIPUnblocked:       func() Payload { return &IPUnblocked{} },
+	TypeDetectionRaised:   func() Payload { return &DetectionRaised{} },
+	TypeWAFBlocked:        func() Payload { return &WAFBlocked{} },
+	TypeCloudTrailAlert:   func() Payload { return &CloudTrailAlert{} },
+	TypeHoneypotHit:       func() Payload { return &HoneypotHit{} },
+	TypePlaybookCompleted: func() Payload { return &PlaybookCompleted{} },
+}
+
+// New returns an empty payload of an event type, or nil if it is unknown
+func New(eventType string) Payload {
+	if newPayload, ok := registry[eventType]; ok {
+		return newPayload()
+	}
+	return nil
+}
+
+// Event is the envelope delivered to subscribers
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Payload decodes the typed event. Known types are returned as pointers,
+// e.g. *FindingCreated.
+func (e Event) Payload() (Payload, error) {
+	p := New(e.Type)
+	if p == nil {
+		return nil, fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if err := json.Unmarshal(e.Data, p); err != nil {
+		return nil, fmt.Errorf("decode %s event: %w", e.Type, err)
+	}
+	return p, nil
+}
+
+// Emitter records events. EmitTx writes the event in tx, so it is only
+// delivered if tx commits.
+type Emitter interface {
+	Emit(p Payload) error
+	EmitTx(tx *gorm.DB, p Payload) error
+}
+
+// Handler processes one event. Returning an error retries the event.
+type Handler func(ctx context.Context, e Event) error
+
+// Subscription registers a handler with the bus
+type Subscription struct {
+	// Name identifies the subscriber's position in the stream and must be
+	// stable across restarts
+	Name string
+	// Types limits delivery to these event types; empty means all
+	Types []string
+	// Broadcast subscribers receive events on every replica and only while
+	// running, e.g. to push them to locally connected clients. Others
+	// share the stream across replicas and resume where they stopped.
+	Broadcast bool
+	Handler   Handler
+}
+
+func (s Subscription) wants(eventType string) bool {
+	if len(s.Types) == 0 {
+		return true
+	}
+	for _, t := range s.Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
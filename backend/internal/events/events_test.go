@@ -0,0 +1,234 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&OutboxEvent{}, &EventCursor{}, &DeadLetter{}, &AuditEntry{}))
+	return db
+}
+
+// recorder collects handled events
+type recorder struct {
+	mu   sync.Mutex
+	seen []Event
+	fail func(Event) error
+}
+
+func (r *recorder) handle(ctx context.Context, e Event) error {
+	if r.fail != nil {
+		if err := r.fail(e); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen = append(r.seen, e)
+	return nil
+}
+
+func (r *recorder) events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.seen...)
+}
+
+func newTestBus(db *gorm.DB, transport Transport) *Bus {
+	b := NewBus(db, transport)
+	b.RetryDelay = time.Millisecond
+	b.PollInterval = 10 * time.Millisecond
+	if t, ok := b.transport.(*OutboxTransport); ok {
+		t.poll = 10 * time.Millisecond
+	}
+	return b
+}
+
+func TestBus_DeliversCommittedEvents(t *testing.T) {
+	db := newTestDB(t)
+	bus := newTestBus(db, nil)
+	var all, findings recorder
+	bus.Subscribe(Subscription{Name: "all", Handler: all.handle})
+	bus.Subscribe(Subscription{Name: "findings", Types: []string{TypeFindingCreated}, Handler: findings.handle})
+	bus.Start()
+	defer bus.Stop()
+
+	require.NoError(t, bus.Emit(FindingCreated{ScanID: "s1", Title: "SQL injection", Severity: "Critical"}))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, bus.EmitTx(tx, IPBlocked{IP: "203.0.113.7"}))
+		return errors.New("rolled back")
+	})
+	require.Error(t, err)
+	require.NoError(t, bus.Emit(ScanCompleted{ScanID: "s1", Status: "completed", Findings: 1}))
+
+	require.Eventually(t, func() bool { return len(all.events()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	got := all.events()
+	assert.Equal(t, []string{TypeFindingCreated, TypeScanCompleted}, []string{got[0].Type, got[1].Type},
+		"events of rolled back transactions are never delivered")
+	assert.Len(t, findings.events(), 1)
+
+	p, err := got[0].Payload()
+	require.NoError(t, err)
+	assert.Equal(t, "Critical finding on : SQL injection", p.Summary())
+	assert.Equal(t, "s1", p.(*FindingCreated).ScanID)
+}
+
+func TestBus_DeadLettersAndRedelivers(t *testing.T) {
+	db := newTestDB(t)
+	bus := newTestBus(db, nil)
+	bus.MaxAttempts = 3
+	attempts := 0
+	broken := true
+	var r recorder
+	r.fail = func(Event) error {
+		attempts++
+		if broken {
+			return errors.New("webhook down")
+		}
+		return nil
+	}
+	bus.Subscribe(Subscription{Name: "integrations", Handler: r.handle})
+	bus.Start()
+
+	require.NoError(t, bus.Emit(IPUnblocked{IP: "198.51.100.1"}))
+	require.Eventually(t, func() bool { return bus.Status().DeadLetters == 1 }, 2*time.Second, 10*time.Millisecond)
+	bus.Stop()
+	assert.Equal(t, 3, attempts)
+	st := bus.Status().Subscribers[0]
+	assert.Equal(t, int64(2), st.Retries)
+	assert.Equal(t, "webhook down", st.LastError)
+
+	dead, err := bus.DeadLetters(10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "integrations", dead[0].Subscriber)
+
+	assert.Error(t, bus.Redeliver(context.Background(), dead[0].ID))
+	broken = false
+	require.NoError(t, bus.Redeliver(context.Background(), dead[0].ID))
+	assert.Equal(t, TypeIPUnblocked, r.events()[0].Type)
+	assert.ErrorIs(t, bus.Redeliver(context.Background(), dead[0].ID), ErrNotFound)
+}
+
+func TestBus_RecoversFromPanickingHandlers(t *testing.T) {
+	db := newTestDB(t)
+	bus := newTestBus(db, nil)
+	bus.MaxAttempts = 2
+	var ok recorder
+	bus.Subscribe(Subscription{Name: "broken", Handler: func(context.Context, Event) error {
+		var m map[string]int
+		m["boom"]++
+		return nil
+	}})
+	bus.Subscribe(Subscription{Name: "working", Handler: ok.handle})
+	bus.Start()
+	defer bus.Stop()
+
+	require.NoError(t, bus.Emit(IPUnblocked{IP: "198.51.100.1"}))
+	require.Eventually(t, func() bool { return bus.Status().DeadLetters == 1 }, 2*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return len(ok.events()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	dead, err := bus.DeadLetters(10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "broken", dead[0].Subscriber)
+	assert.Contains(t, dead[0].Error, "handler panicked")
+	assert.Error(t, bus.Redeliver(context.Background(), dead[0].ID), "redelivery recovers too")
+}
+
+func TestOutboxTransport_ResumesFromCursor(t *testing.T) {
+	db := newTestDB(t)
+	var first recorder
+	bus := newTestBus(db, nil)
+	bus.Subscribe(Subscription{Name: "audit", Handler: first.handle})
+	bus.Start()
+	require.NoError(t, bus.Emit(IPBlocked{IP: "192.0.2.1"}))
+	require.Eventually(t, func() bool { return len(first.events()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	bus.Stop()
+
+	// Emitted while no process is running
+	require.NoError(t, bus.Emit(IPBlocked{IP: "192.0.2.2"}))
+
+	var second, live recorder
+	bus = newTestBus(db, nil)
+	bus.Subscribe(Subscription{Name: "audit", Handler: second.handle})
+	bus.Subscribe(Subscription{Name: "websocket", Broadcast: true, Handler: live.handle})
+	bus.Start()
+	defer bus.Stop()
+	require.Eventually(t, func() bool { return len(second.events()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	p, _ := second.events()[0].Payload()
+	assert.Equal(t, "192.0.2.2", p.(*IPBlocked).IP, "handled events are not redelivered")
+	time.Sleep(50 * time.Millisecond)
+	for _, e := range live.events() {
+		assert.Equal(t, second.events()[0].ID, e.ID, "broadcast subscribers get no history")
+	}
+}
+
+func TestRedisTransport_SharesGroupsAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	db := newTestDB(t)
+
+	var shared [2]recorder
+	var broadcast [2]recorder
+	var buses []*Bus
+	for i := range 2 {
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		transport := NewRedisTransport(rdb, "events")
+		transport.Block = 20 * time.Millisecond
+		transport.consumer = []string{"replica-a", "replica-b"}[i]
+		bus := newTestBus(db, transport)
+		bus.Subscribe(Subscription{Name: "automation", Handler: shared[i].handle})
+		bus.Subscribe(Subscription{Name: "websocket", Broadcast: true, Handler: broadcast[i].handle})
+		buses = append(buses, bus)
+	}
+	for _, bus := range buses {
+		bus.Start()
+		defer bus.Stop()
+	}
+	// Let the broadcast readers start from the end of the stream
+	time.Sleep(100 * time.Millisecond)
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		require.NoError(t, buses[0].Emit(IPBlocked{IP: ip}))
+	}
+	require.Eventually(t, func() bool {
+		return len(shared[0].events())+len(shared[1].events()) == 3 &&
+			len(broadcast[0].events()) == 3 && len(broadcast[1].events()) == 3
+	}, 3*time.Second, 20*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 3, len(shared[0].events())+len(shared[1].events()), "each event is handled by one replica")
+	pending, err := buses[0].transport.(*RedisTransport).rdb.XPending(context.Background(), "events", "automation").Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count, "handled events are acknowledged")
+}
+
+func TestAuditLog_IgnoresRedelivery(t *testing.T) {
+	db := newTestDB(t)
+	audit := NewAuditLog(db)
+	e := Event{ID: "e1", Type: TypeIPBlocked, Time: time.Now(), Data: []byte(`{"ip":"192.0.2.1","blocked_by":"Admin","reason":"scanning"}`)}
+	require.NoError(t, audit.Handle(context.Background(), e))
+	require.NoError(t, audit.Handle(context.Background(), e))
+
+	entries, err := audit.List("", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "192.0.2.1 blocked by Admin: scanning", entries[0].Summary)
+}
@@ -0,0 +1,181 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisTransport delivers events through a Redis stream so every replica
+// can relay and consume. Each subscriber is a consumer group: an event is
+// handled by one replica and acknowledged afterwards, and events left
+// unacknowledged by a replica that died are claimed by another after
+// ClaimIdle. Broadcast subscribers read the stream directly on each
+// replica.
+type RedisTransport struct {
+	rdb      *redis.Client
+	stream   string
+	consumer string
+
+	// Approximate number of events kept in the stream
+	MaxLen int64
+	// Pending events idle for this long are claimed from other consumers
+	ClaimIdle time.Duration
+	// How long a read waits for new events
+	Block time.Duration
+}
+
+// NewRedisTransport uses the given stream key. Consumers are named after
+// the host and process, which must be unique per replica.
+func NewRedisTransport(rdb *redis.Client, stream string) *RedisTransport {
+	host, _ := os.Hostname()
+	return &RedisTransport{
+		rdb:       rdb,
+		stream:    stream,
+		consumer:  fmt.Sprintf("%s-%d", host, os.Getpid()),
+		MaxLen:    100000,
+		ClaimIdle: time.Minute,
+		Block:     5 * time.Second,
+	}
+}
+
+func (t *RedisTransport) Name() string { return "redis" }
+
+func (t *RedisTransport) Send(ctx context.Context, events []Event) error {
+	pipe := t.rdb.Pipeline()
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: t.stream,
+			MaxLen: t.MaxLen,
+			Approx: true,
+			Values: map[string]any{"event": data},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (t *RedisTransport) Consume(ctx context.Context, sub Subscription, deliver func(Event)) {
+	if sub.Broadcast {
+		t.broadcast(ctx, sub, deliver)
+		return
+	}
+
+	for ctx.Err() == nil {
+		err := t.rdb.XGroupCreateMkStream(ctx, t.stream, sub.Name, "0").Err()
+		if err == nil || strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			break
+		}
+		slog.Warn("Failed to create event consumer group", "group", sub.Name, "error", err)
+		t.pause(ctx)
+	}
+
+	for ctx.Err() == nil {
+		// Take over events a crashed replica did not acknowledge
+		claimed, _, err := t.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   t.stream,
+			Group:    sub.Name,
+			Consumer: t.consumer,
+			MinIdle:  t.ClaimIdle,
+			Start:    "0-0",
+			Count:    100,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+			slog.Warn("Failed to claim pending events", "group", sub.Name, "error", err)
+		}
+		if !t.handle(ctx, sub, claimed, deliver) {
+			return
+		}
+
+		streams, err := t.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    sub.Name,
+			Consumer: t.consumer,
+			Streams:  []string{t.stream, ">"},
+			Count:    100,
+			Block:    t.Block,
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				slog.Warn("Failed to read events", "group", sub.Name, "error", err)
+				t.pause(ctx)
+			}
+			continue
+		}
+		for _, s := range streams {
+			if !t.handle(ctx, sub, s.Messages, deliver) {
+				return
+			}
+		}
+	}
+}
+
+// handle delivers and acknowledges messages and reports false when ctx is
+// done, leaving the rest pending
+func (t *RedisTransport) handle(ctx context.Context, sub Subscription, msgs []redis.XMessage, deliver func(Event)) bool {
+	for _, msg := range msgs {
+		if e, ok := decodeMessage(msg); ok {
+			deliver(e)
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if err := t.rdb.XAck(ctx, t.stream, sub.Name, msg.ID).Err(); err != nil {
+			slog.Warn("Failed to acknowledge event", "group", sub.Name, "id", msg.ID, "error", err)
+		}
+	}
+	return true
+}
+
+func (t *RedisTransport) broadcast(ctx context.Context, sub Subscription, deliver func(Event)) {
+	last := "$"
+	for ctx.Err() == nil {
+		streams, err := t.rdb.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{t.stream, last},
+			Count:   100,
+			Block:   t.Block,
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				slog.Warn("Failed to read events", "subscriber", sub.Name, "error", err)
+				t.pause(ctx)
+			}
+			continue
+		}
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				if e, ok := decodeMessage(msg); ok {
+					deliver(e)
+				}
+				last = msg.ID
+			}
+		}
+	}
+}
+
+func (t *RedisTransport) pause(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+}
+
+func decodeMessage(msg redis.XMessage) (Event, bool) {
+	var e Event
+	raw, _ := msg.Values["event"].(string)
+	if err := json.Unmarshal([]byte(raw), &e); err != nil {
+		slog.Warn("Skipping malformed event", "id", msg.ID, "error", err)
+		return e, false
+	}
+	return e, true
+}
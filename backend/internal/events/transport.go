@@ -0,0 +1,132 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Transport carries dispatched events to subscribers
+type Transport interface {
+	Name() string
+	// Send publishes events claimed from the outbox, in order
+	Send(ctx context.Context, events []Event) error
+	// Consume calls deliver for each event of the subscription until ctx
+	// is done. deliver returns once the event is handled or dead-lettered,
+	// after which the transport may consider it acknowledged.
+	Consume(ctx context.Context, sub Subscription, deliver func(Event))
+}
+
+// EventCursor is the last outbox Seq handled by a subscriber
+type EventCursor struct {
+	Subscriber string `gorm:"primaryKey;size:128"`
+	Seq        uint64 `gorm:"not null"`
+	UpdatedAt  time.Time
+}
+
+// OutboxTransport delivers straight from the outbox table, tracking each
+// subscriber's position in EventCursor. Positions are shared by all
+// processes, so it must only run on one replica; use RedisTransport for
+// more.
+type OutboxTransport struct {
+	db        *gorm.DB
+	batchSize int
+	poll      time.Duration
+
+	mu   sync.Mutex
+	wake map[chan struct{}]bool
+}
+
+func NewOutboxTransport(db *gorm.DB) *OutboxTransport {
+	return &OutboxTransport{
+		db:        db,
+		batchSize: 100,
+		poll:      5 * time.Second,
+		wake:      make(map[chan struct{}]bool),
+	}
+}
+
+func (t *OutboxTransport) Name() string { return "outbox" }
+
+// Send wakes the consumers; the events are already in the table
+func (t *OutboxTransport) Send(ctx context.Context, events []Event) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ch := range t.wake {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (t *OutboxTransport) Consume(ctx context.Context, sub Subscription, deliver func(Event)) {
+	wake := make(chan struct{}, 1)
+	t.mu.Lock()
+	t.wake[wake] = true
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.wake, wake)
+		t.mu.Unlock()
+	}()
+
+	var cursor uint64
+	if sub.Broadcast {
+		// Only events dispatched from now on
+		var last struct{ Seq uint64 }
+		t.db.Model(&OutboxEvent{}).Select("COALESCE(MAX(seq), 0) AS seq").Scan(&last)
+		cursor = last.Seq
+	} else {
+		var saved EventCursor
+		if err := t.db.Where("subscriber = ?", sub.Name).Limit(1).Find(&saved).Error; err != nil {
+			slog.Error("Failed to load event cursor", "subscriber", sub.Name, "error", err)
+			return
+		}
+		cursor = saved.Seq
+	}
+
+	for {
+		var rows []OutboxEvent
+		err := t.db.Where("seq > ?", cursor).Order("seq").Limit(t.batchSize).Find(&rows).Error
+		if err != nil {
+			slog.Warn("Failed to read event outbox", "subscriber", sub.Name, "error", err)
+		}
+		for _, row := range rows {
+			deliver(row.event())
+			if ctx.Err() != nil {
+				// The handler may have been interrupted; deliver again
+				// after a restart
+				return
+			}
+			cursor = *row.Seq
+			if !sub.Broadcast {
+				t.saveCursor(sub.Name, cursor)
+			}
+		}
+		if len(rows) == t.batchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(t.poll):
+		}
+	}
+}
+
+func (t *OutboxTransport) saveCursor(subscriber string, seq uint64) {
+	err := t.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subscriber"}},
+		DoUpdates: clause.AssignmentColumns([]string{"seq", "updated_at"}),
+	}).Create(&EventCursor{Subscriber: subscriber, Seq: seq}).Error
+	if err != nil {
+		slog.Warn("Failed to save event cursor", "subscriber", subscriber, "error", err)
+	}
+}
@@ -0,0 +1,187 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// ErrCapacity is returned when a backend has no room for more blocks
+var ErrCapacity = errors.New("firewall backend is full")
+
+// NACLAPI is the subset of the EC2 client used by AWSNetworkACL
+type NACLAPI interface {
+	DescribeNetworkAcls(ctx context.Context, in *ec2.DescribeNetworkAclsInput, opts ...func(*ec2.Options)) (*ec2.DescribeNetworkAclsOutput, error)
+	CreateNetworkAclEntry(ctx context.Context, in *ec2.CreateNetworkAclEntryInput, opts ...func(*ec2.Options)) (*ec2.CreateNetworkAclEntryOutput, error)
+	DeleteNetworkAclEntry(ctx context.Context, in *ec2.DeleteNetworkAclEntryInput, opts ...func(*ec2.Options)) (*ec2.DeleteNetworkAclEntryOutput, error)
+}
+
+// AWSNetworkACL enforces blocks as inbound deny entries in a VPC network
+// ACL. Security groups only express allows, so the subnet ACL is the
+// cloud-side place for a denylist. Entries use rule numbers
+// FirstRule..FirstRule+MaxRules-1, which must sort before the ACL's allow
+// rules; entries outside that range are never touched.
+//
+// ACLs hold 20 inbound rules by default (40 with a quota increase), so
+// this backend suits a short list of the worst offenders. The Enforcer
+// fills the range with the highest-ranked blocks; Add fails with
+// ErrCapacity when asked for more than fits.
+type AWSNetworkACL struct {
+	ACLID     string
+	FirstRule int32
+	MaxRules  int32
+	client    NACLAPI
+
+	mu sync.Mutex
+}
+
+// NewAWSNetworkACL uses the default AWS credential chain
+func NewAWSNetworkACL(ctx context.Context, aclID string) (*AWSNetworkACL, error) {
+	if aclID == "" {
+		return nil, errors.New("aws-nacl firewall backend requires AWS_NACL_ID")
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config: %w", err)
+	}
+	return NewAWSNetworkACLWithClient(ec2.NewFromConfig(cfg), aclID), nil
+}
+
+func NewAWSNetworkACLWithClient(client NACLAPI, aclID string) *AWSNetworkACL {
+	return &AWSNetworkACL{ACLID: aclID, FirstRule: 1, MaxRules: 18, client: client}
+}
+
+func (a *AWSNetworkACL) Name() string { return "aws-nacl:" + a.ACLID }
+
+func (a *AWSNetworkACL) owns(n int32) bool {
+	return n >= a.FirstRule && n < a.FirstRule+a.MaxRules
+}
+
+// entries maps the prefixes in our rule range to their rule numbers, and
+// reports every rule number in use
+func (a *AWSNetworkACL) entries(ctx context.Context) (map[netip.Prefix]int32, map[int32]bool, error) {
+	out, err := a.client.DescribeNetworkAcls(ctx, &ec2.DescribeNetworkAclsInput{NetworkAclIds: []string{a.ACLID}})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(out.NetworkAcls) == 0 {
+		return nil, nil, fmt.Errorf("network ACL %s not found", a.ACLID)
+	}
+	owned := make(map[netip.Prefix]int32)
+	used := make(map[int32]bool)
+	for _, e := range out.NetworkAcls[0].Entries {
+		if aws.ToBool(e.Egress) || e.RuleNumber == nil {
+			continue
+		}
+		n := aws.ToInt32(e.RuleNumber)
+		used[n] = true
+		if !a.owns(n) || e.RuleAction != types.RuleActionDeny {
+			continue
+		}
+		cidr := aws.ToString(e.CidrBlock)
+		if cidr == "" {
+			cidr = aws.ToString(e.Ipv6CidrBlock)
+		}
+		if p, err := parseElement(cidr); err == nil {
+			owned[p] = n
+		}
+	}
+	return owned, used, nil
+}
+
+func (a *AWSNetworkACL) List(ctx context.Context) ([]netip.Prefix, error) {
+	owned, _, err := a.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]netip.Prefix, 0, len(owned))
+	for p := range owned {
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Capacity counts the rule numbers in our range that are free or already
+// hold one of our blocks
+func (a *AWSNetworkACL) Capacity(ctx context.Context) (int, error) {
+	owned, used, err := a.entries(ctx)
+	if err != nil {
+		return 0, err
+	}
+	capacity := len(owned)
+	for n := a.FirstRule; n < a.FirstRule+a.MaxRules; n++ {
+		if !used[n] {
+			capacity++
+		}
+	}
+	return capacity, nil
+}
+
+func (a *AWSNetworkACL) Add(ctx context.Context, prefixes []netip.Prefix) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	owned, used, err := a.entries(ctx)
+	if err != nil {
+		return err
+	}
+	next := a.FirstRule
+	for _, p := range prefixes {
+		if _, ok := owned[p]; ok {
+			continue
+		}
+		for next < a.FirstRule+a.MaxRules && used[next] {
+			next++
+		}
+		if next >= a.FirstRule+a.MaxRules {
+			return fmt.Errorf("%w: %s has no free rule numbers for %s", ErrCapacity, a.ACLID, p)
+		}
+		in := &ec2.CreateNetworkAclEntryInput{
+			NetworkAclId: aws.String(a.ACLID),
+			RuleNumber:   aws.Int32(next),
+			Egress:       aws.Bool(false),
+			Protocol:     aws.String("-1"),
+			RuleAction:   types.RuleActionDeny,
+		}
+		if p.Addr().Is4() {
+			in.CidrBlock = aws.String(p.String())
+		} else {
+			in.Ipv6CidrBlock = aws.String(p.String())
+		}
+		if _, err := a.client.CreateNetworkAclEntry(ctx, in); err != nil {
+			return err
+		}
+		used[next] = true
+	}
+	return nil
+}
+
+func (a *AWSNetworkACL) Remove(ctx context.Context, prefixes []netip.Prefix) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	owned, _, err := a.entries(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range prefixes {
+		n, ok := owned[p]
+		if !ok {
+			continue
+		}
+		_, err := a.client.DeleteNetworkAclEntry(ctx, &ec2.DeleteNetworkAclEntryInput{
+			NetworkAclId: aws.String(a.ACLID),
+			RuleNumber:   aws.Int32(n),
+			Egress:       aws.Bool(false),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package firewall
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"sync"
+)
+
+// DryRun records blocks in memory and logs the changes a real backend
+// would make. Use it to preview enforcement before enabling a firewall.
+type DryRun struct {
+	mu  sync.Mutex
+	set map[netip.Prefix]bool
+}
+
+func NewDryRun() *DryRun {
+	return &DryRun{set: make(map[netip.Prefix]bool)}
+}
+
+func (d *DryRun) Name() string { return "dryrun" }
+
+func (d *DryRun) List(ctx context.Context) ([]netip.Prefix, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]netip.Prefix, 0, len(d.set))
+	for p := range d.set {
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (d *DryRun) Add(ctx context.Context, prefixes []netip.Prefix) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, p := range prefixes {
+		d.set[p] = true
+		slog.Info("Firewall dry run: would block", "prefix", p.String())
+	}
+	return nil
+}
+
+func (d *DryRun) Remove(ctx context.Context, prefixes []netip.Prefix) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, p := range prefixes {
+		delete(d.set, p)
+		slog.Info("Firewall dry run: would unblock", "prefix", p.String())
+	}
+	return nil
+}
@@ -0,0 +1,424 @@
+// Package firewall pushes the IP blocklist to enforcement points outside
+// the API, such as the host firewall or a cloud network ACL, so blocked
+// addresses are dropped before they reach any service.
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend is one enforcement point. It owns a dedicated set, chain or rule
+// range, so everything it lists was put there by the Enforcer and may be
+// removed by it. Add and Remove must be idempotent.
+type Backend interface {
+	Name() string
+	List(ctx context.Context) ([]netip.Prefix, error)
+	Add(ctx context.Context, prefixes []netip.Prefix) error
+	Remove(ctx context.Context, prefixes []netip.Prefix) error
+}
+
+// Runner runs a command with optional standard input and returns its
+// combined output
+type Runner func(ctx context.Context, stdin string, name string, args ...string) ([]byte, error)
+
+// ExecRunner runs commands on the host
+func ExecRunner(ctx context.Context, stdin string, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		return out.Bytes(), fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.Bytes(), nil
+}
+
+// Source lists the prefixes that should be enforced, most important
+// first. The blocked-IP table implements it through database.MonitorStore.
+type Source interface {
+	ActivePrefixes(action string) ([]netip.Prefix, error)
+}
+
+// Limited is implemented by backends that hold a bounded number of
+// prefixes. They are given the highest-ranked blocks that fit.
+type Limited interface {
+	Capacity(ctx context.Context) (int, error)
+}
+
+// BackendStatus is the outcome of the last sync with one backend
+type BackendStatus struct {
+	Name     string    `json:"name"`
+	LastSync time.Time `json:"last_sync"`
+	Error    string    `json:"error,omitempty"`
+	Held     int       `json:"held"`
+	Added    int       `json:"added"`
+	Removed  int       `json:"removed"`
+	Dropped  int       `json:"dropped,omitempty"` // Lower-ranked blocks left out for lack of room
+
+	held map[netip.Prefix]bool
+}
+
+// Status is the enforcement state of every backend
+type Status struct {
+	Backends []BackendStatus `json:"backends"`
+	// Blocks that overlap an allowlisted range. Host firewalls have no
+	// notion of exceptions, so these are only enforced by the API.
+	Skipped []netip.Prefix `json:"skipped,omitempty"`
+}
+
+// Enforcer reconciles backends with the blocklist: missing blocks are
+// added and blocks that were removed or expired are deleted
+type Enforcer struct {
+	source   Source
+	backends []Backend
+	trigger  chan struct{}
+	now      func() time.Time
+
+	mu      sync.Mutex
+	status  map[string]*BackendStatus
+	skipped []netip.Prefix
+}
+
+func NewEnforcer(source Source, backends ...Backend) *Enforcer {
+	return &Enforcer{
+		source:   source,
+		backends: backends,
+		trigger:  make(chan struct{}, 1),
+		now:      time.Now,
+		status:   make(map[string]*BackendStatus),
+	}
+}
+
+// Backends returns the names of the configured backends
+func (e *Enforcer) Backends() []string {
+	names := make([]string, len(e.backends))
+	for i, b := range e.backends {
+		names[i] = b.Name()
+	}
+	return names
+}
+
+// Desired computes the prefixes to enforce, most important first: active
+// blocks, with prefixes covered by a larger block folded into it and blocks
+// overlapping the allowlist skipped
+func (e *Enforcer) Desired() (enforce, skipped []netip.Prefix, err error) {
+	blocks, err := e.source.ActivePrefixes("block")
+	if err != nil {
+		return nil, nil, err
+	}
+	allows, err := e.source.ActivePrefixes("allow")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, b := range rank(collapse(blocks), blocks) {
+		if overlapsAny(b, allows) {
+			skipped = append(skipped, b)
+		} else {
+			enforce = append(enforce, b)
+		}
+	}
+	return enforce, skipped, nil
+}
+
+// rank orders collapsed prefixes by the best rank of the blocks folded into
+// them. collapsed must be sorted, as collapse returns it.
+func rank(collapsed, ranked []netip.Prefix) []netip.Prefix {
+	order := make(map[netip.Prefix]int, len(collapsed))
+	for i, b := range ranked {
+		b = b.Masked()
+		// The last collapsed prefix starting at or before b is the only
+		// one that can hold it
+		j := sort.Search(len(collapsed), func(j int) bool { return collapsed[j].Addr().Compare(b.Addr()) > 0 }) - 1
+		if j < 0 || !collapsed[j].Overlaps(b) {
+			continue
+		}
+		if _, ok := order[collapsed[j]]; !ok {
+			order[collapsed[j]] = i
+		}
+	}
+	out := append([]netip.Prefix(nil), collapsed...)
+	sort.SliceStable(out, func(i, j int) bool { return order[out[i]] < order[out[j]] })
+	return out
+}
+
+// Sync reconciles every backend once. It returns the first error, after
+// trying all backends.
+func (e *Enforcer) Sync(ctx context.Context) error {
+	desired, skipped, err := e.Desired()
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.skipped = skipped
+	e.mu.Unlock()
+
+	var firstErr error
+	for _, b := range e.backends {
+		st := e.syncBackend(ctx, b, desired)
+		e.mu.Lock()
+		e.status[b.Name()] = st
+		e.mu.Unlock()
+		if st.Error != "" && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %s", b.Name(), st.Error)
+		}
+	}
+	return firstErr
+}
+
+func (e *Enforcer) syncBackend(ctx context.Context, b Backend, desired []netip.Prefix) *BackendStatus {
+	st := &BackendStatus{Name: b.Name(), LastSync: e.now()}
+	if l, ok := b.(Limited); ok {
+		capacity, err := l.Capacity(ctx)
+		if err != nil {
+			st.Error = err.Error()
+			return st
+		}
+		if len(desired) > capacity {
+			st.Dropped = len(desired) - capacity
+			desired = desired[:capacity]
+		}
+	}
+	current, err := b.List(ctx)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	add, remove := diff(current, desired)
+
+	held := make(map[netip.Prefix]bool, len(current))
+	for _, p := range current {
+		held[p] = true
+	}
+	// Remove first, so a block narrowed to a subnet does not conflict with
+	// the range it replaces
+	if len(remove) > 0 {
+		if err := b.Remove(ctx, remove); err != nil {
+			st.Error = err.Error()
+		} else {
+			st.Removed = len(remove)
+			for _, p := range remove {
+				delete(held, p)
+			}
+		}
+	}
+	if len(add) > 0 && st.Error == "" {
+		if err := b.Add(ctx, add); err != nil {
+			st.Error = err.Error()
+		} else {
+			st.Added = len(add)
+			for _, p := range add {
+				held[p] = true
+			}
+		}
+	}
+	st.held, st.Held = held, len(held)
+	return st
+}
+
+// Trigger schedules a sync soon, coalescing bursts of changes
+func (e *Enforcer) Trigger() {
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Start syncs every interval and whenever Trigger is called
+func (e *Enforcer) Start(interval time.Duration) {
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := e.Sync(ctx); err != nil {
+				slog.Warn("Firewall sync failed", "error", err)
+			}
+			cancel()
+			select {
+			case <-e.trigger:
+				// Let related changes, such as an import, land first
+				time.Sleep(time.Second)
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// Status returns the outcome of the last sync with each backend
+func (e *Enforcer) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := Status{Skipped: e.skipped}
+	for _, b := range e.backends {
+		if st, ok := e.status[b.Name()]; ok {
+			out.Backends = append(out.Backends, *st)
+		} else {
+			out.Backends = append(out.Backends, BackendStatus{Name: b.Name()})
+		}
+	}
+	return out
+}
+
+// Holders returns the backends holding a block, as of their last sync.
+// A host address is held by a backend enforcing any prefix covering it.
+func (e *Enforcer) Holders(p netip.Prefix) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var names []string
+	for _, b := range e.backends {
+		st, ok := e.status[b.Name()]
+		if !ok {
+			continue
+		}
+		for held := range st.held {
+			if held.Bits() <= p.Bits() && held.Contains(p.Addr()) {
+				names = append(names, b.Name())
+				break
+			}
+		}
+	}
+	return names
+}
+
+// collapse sorts and deduplicates prefixes, dropping those inside another
+// one. Interval sets such as nftables reject overlapping elements.
+func collapse(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.IsValid() {
+			sorted = append(sorted, p.Masked())
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if c := sorted[i].Addr().Compare(sorted[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return sorted[i].Bits() < sorted[j].Bits()
+	})
+	var out []netip.Prefix
+	for _, p := range sorted {
+		if n := len(out); n > 0 && out[n-1].Overlaps(p) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func overlapsAny(p netip.Prefix, others []netip.Prefix) bool {
+	for _, o := range others {
+		if p.Overlaps(o) {
+			return true
+		}
+	}
+	return false
+}
+
+func diff(current, desired []netip.Prefix) (add, remove []netip.Prefix) {
+	have := make(map[netip.Prefix]bool, len(current))
+	for _, p := range current {
+		have[p.Masked()] = true
+	}
+	want := make(map[netip.Prefix]bool, len(desired))
+	for _, p := range desired {
+		want[p] = true
+		if !have[p] {
+			add = append(add, p)
+		}
+	}
+	for p := range have {
+		if !want[p] {
+			remove = append(remove, p)
+		}
+	}
+	sort.Slice(remove, func(i, j int) bool { return remove[i].String() < remove[j].String() })
+	return add, remove
+}
+
+// split separates IPv4 and IPv6 prefixes, which live in separate sets
+func split(prefixes []netip.Prefix) (v4, v6 []netip.Prefix) {
+	for _, p := range prefixes {
+		if p.Addr().Is4() {
+			v4 = append(v4, p)
+		} else {
+			v6 = append(v6, p)
+		}
+	}
+	return v4, v6
+}
+
+// element formats a prefix the way firewalls list it: host prefixes as a
+// bare address
+func element(p netip.Prefix) string {
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+	return p.String()
+}
+
+// parseElement reads an address or CIDR prefix
+func parseElement(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// chunks splits prefixes into batches of at most n
+func chunks(prefixes []netip.Prefix, n int) [][]netip.Prefix {
+	var out [][]netip.Prefix
+	for len(prefixes) > n {
+		out = append(out, prefixes[:n])
+		prefixes = prefixes[n:]
+	}
+	if len(prefixes) > 0 {
+		out = append(out, prefixes)
+	}
+	return out
+}
+
+// ErrUnknownBackend is returned by FromEnv for unsupported backend names
+var ErrUnknownBackend = errors.New("unknown firewall backend")
+
+// FromEnv builds the backends listed in FIREWALL_BACKENDS (comma
+// separated): nftables, ipset, aws-nacl (with AWS_NACL_ID) and dryrun.
+// It returns no backends when the variable is unset.
+func FromEnv() ([]Backend, error) {
+	var backends []Backend
+	for _, name := range strings.Split(os.Getenv("FIREWALL_BACKENDS"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "nftables":
+			backends = append(backends, NewNFTables(ExecRunner))
+		case "ipset":
+			backends = append(backends, NewIPSet(ExecRunner))
+		case "aws-nacl":
+			b, err := NewAWSNetworkACL(context.Background(), os.Getenv("AWS_NACL_ID"))
+			if err != nil {
+				return nil, err
+			}
+			backends = append(backends, b)
+		case "dryrun":
+			backends = append(backends, NewDryRun())
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+		}
+	}
+	return backends, nil
+}
@@ -0,0 +1,257 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource map[string][]string
+
+func (f fakeSource) ActivePrefixes(action string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, s := range f[action] {
+		p, err := parseElement(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func prefixes(ss ...string) []netip.Prefix {
+	out := make([]netip.Prefix, len(ss))
+	for i, s := range ss {
+		out[i], _ = parseElement(s)
+	}
+	return out
+}
+
+func sorted(ps []netip.Prefix) []string {
+	out := make([]string, len(ps))
+	for i, p := range ps {
+		out[i] = element(p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestEnforcer_Sync(t *testing.T) {
+	src := fakeSource{
+		"block": {"203.0.113.0/24", "203.0.113.7", "198.51.100.1", "10.0.0.0/8", "2001:db8::1"},
+		"allow": {"10.1.0.0/16"},
+	}
+	dry := NewDryRun()
+	e := NewEnforcer(src, dry)
+
+	require.NoError(t, e.Sync(context.Background()))
+	held, _ := dry.List(context.Background())
+	assert.Equal(t, []string{"198.51.100.1", "2001:db8::1", "203.0.113.0/24"}, sorted(held),
+		"covered prefixes fold into the larger block")
+	assert.Equal(t, prefixes("10.0.0.0/8"), e.Status().Skipped, "blocks overlapping the allowlist stay API-only")
+	assert.Equal(t, []string{"dryrun"}, e.Holders(netip.MustParsePrefix("203.0.113.7/32")))
+	assert.Empty(t, e.Holders(netip.MustParsePrefix("10.0.0.0/8")))
+
+	// Unblocks and expiry drop out of the source and are removed
+	src["block"] = []string{"198.51.100.1"}
+	require.NoError(t, e.Sync(context.Background()))
+	held, _ = dry.List(context.Background())
+	assert.Equal(t, []string{"198.51.100.1"}, sorted(held))
+	st := e.Status().Backends[0]
+	assert.Equal(t, 2, st.Removed)
+	assert.Equal(t, 1, st.Held)
+
+	require.NoError(t, e.Sync(context.Background()))
+	st = e.Status().Backends[0]
+	assert.Zero(t, st.Added+st.Removed, "syncing an enforced list is a no-op")
+}
+
+type call struct {
+	stdin string
+	cmd   string
+}
+
+type fakeHost struct {
+	calls []call
+	reply func(cmd string) ([]byte, error)
+}
+
+func (h *fakeHost) run(ctx context.Context, stdin string, name string, args ...string) ([]byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	h.calls = append(h.calls, call{stdin, cmd})
+	if h.reply != nil {
+		return h.reply(cmd)
+	}
+	return nil, nil
+}
+
+func TestNFTables(t *testing.T) {
+	host := &fakeHost{reply: func(cmd string) ([]byte, error) {
+		switch cmd {
+		case "nft -j list set inet cybershield blocked_v4":
+			return []byte(`{"nftables":[{"metainfo":{"version":"1.0.9"}},{"set":{"family":"inet","name":"blocked_v4","elem":["198.51.100.1",{"prefix":{"addr":"203.0.113.0","len":24}}]}}]}`), nil
+		case "nft -j list set inet cybershield blocked_v6":
+			return []byte(`{"nftables":[{"set":{"family":"inet","name":"blocked_v6"}}]}`), nil
+		}
+		return nil, nil
+	}}
+	n := NewNFTables(host.run)
+	ctx := context.Background()
+
+	listed, err := n.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"198.51.100.1", "203.0.113.0/24"}, sorted(listed))
+	require.Contains(t, host.calls[0].stdin, "add rule inet cybershield input ip saddr @blocked_v4 drop")
+	assert.Contains(t, host.calls[0].stdin, "flush chain inet cybershield input", "setup is safe to repeat")
+
+	host.calls = nil
+	require.NoError(t, n.Add(ctx, prefixes("192.0.2.1", "192.0.2.128/25", "2001:db8::/32")))
+	require.NoError(t, n.Remove(ctx, prefixes("198.51.100.1")))
+	assert.Equal(t, []call{
+		{"", "nft add element inet cybershield blocked_v4 { 192.0.2.1, 192.0.2.128/25 }"},
+		{"", "nft add element inet cybershield blocked_v6 { 2001:db8::/32 }"},
+		{"", "nft delete element inet cybershield blocked_v4 { 198.51.100.1 }"},
+	}, host.calls, "the table is only set up once")
+}
+
+func TestNFTables_RetriesSetup(t *testing.T) {
+	fail := true
+	host := &fakeHost{reply: func(cmd string) ([]byte, error) {
+		if cmd == "nft -f -" && fail {
+			return nil, errors.New("nft: not found")
+		}
+		return []byte(`{"nftables":[]}`), nil
+	}}
+	n := NewNFTables(host.run)
+	_, err := n.List(context.Background())
+	assert.Error(t, err)
+	fail = false
+	_, err = n.List(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestIPSet(t *testing.T) {
+	host := &fakeHost{reply: func(cmd string) ([]byte, error) {
+		switch {
+		case strings.HasPrefix(cmd, "iptables -C"):
+			return nil, errors.New("rule does not exist")
+		case cmd == "ipset save cybershield-v4":
+			return []byte("create cybershield-v4 hash:net family inet hashsize 1024 maxelem 65536\nadd cybershield-v4 203.0.113.0/24\nadd cybershield-v4 198.51.100.1\n"), nil
+		}
+		return nil, nil
+	}}
+	s := NewIPSet(host.run)
+	ctx := context.Background()
+
+	listed, err := s.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"198.51.100.1", "203.0.113.0/24"}, sorted(listed))
+
+	var cmds []string
+	for _, c := range host.calls {
+		cmds = append(cmds, c.cmd)
+	}
+	assert.Contains(t, cmds, "iptables -I INPUT 1 -m set --match-set cybershield-v4 src -j DROP")
+	assert.NotContains(t, cmds, "ip6tables -I INPUT 1 -m set --match-set cybershield-v6 src -j DROP", "existing rules are not duplicated")
+
+	host.calls = nil
+	require.NoError(t, s.Add(ctx, prefixes("192.0.2.1", "2001:db8::/32")))
+	assert.Equal(t, []call{{"add cybershield-v4 192.0.2.1\nadd cybershield-v6 2001:db8::/32\n", "ipset -exist restore"}}, host.calls)
+}
+
+type fakeACL struct {
+	entries []types.NetworkAclEntry
+}
+
+func (f *fakeACL) DescribeNetworkAcls(ctx context.Context, in *ec2.DescribeNetworkAclsInput, opts ...func(*ec2.Options)) (*ec2.DescribeNetworkAclsOutput, error) {
+	return &ec2.DescribeNetworkAclsOutput{NetworkAcls: []types.NetworkAcl{{Entries: f.entries}}}, nil
+}
+
+func (f *fakeACL) CreateNetworkAclEntry(ctx context.Context, in *ec2.CreateNetworkAclEntryInput, opts ...func(*ec2.Options)) (*ec2.CreateNetworkAclEntryOutput, error) {
+	f.entries = append(f.entries, types.NetworkAclEntry{
+		RuleNumber: in.RuleNumber, Egress: in.Egress, RuleAction: in.RuleAction,
+		CidrBlock: in.CidrBlock, Ipv6CidrBlock: in.Ipv6CidrBlock,
+	})
+	return &ec2.CreateNetworkAclEntryOutput{}, nil
+}
+
+func (f *fakeACL) DeleteNetworkAclEntry(ctx context.Context, in *ec2.DeleteNetworkAclEntryInput, opts ...func(*ec2.Options)) (*ec2.DeleteNetworkAclEntryOutput, error) {
+	for i, e := range f.entries {
+		if aws.ToInt32(e.RuleNumber) == aws.ToInt32(in.RuleNumber) && aws.ToBool(e.Egress) == aws.ToBool(in.Egress) {
+			f.entries = append(f.entries[:i], f.entries[i+1:]...)
+			break
+		}
+	}
+	return &ec2.DeleteNetworkAclEntryOutput{}, nil
+}
+
+func TestAWSNetworkACL(t *testing.T) {
+	client := &fakeACL{entries: []types.NetworkAclEntry{
+		// Managed by someone else: an allow rule, a deny outside our range
+		// and the default catch-all
+		{RuleNumber: aws.Int32(2), RuleAction: types.RuleActionAllow, CidrBlock: aws.String("192.0.2.0/24"), Egress: aws.Bool(false)},
+		{RuleNumber: aws.Int32(100), RuleAction: types.RuleActionAllow, CidrBlock: aws.String("0.0.0.0/0"), Egress: aws.Bool(false)},
+		{RuleNumber: aws.Int32(32767), RuleAction: types.RuleActionDeny, CidrBlock: aws.String("0.0.0.0/0"), Egress: aws.Bool(false)},
+	}}
+	acl := NewAWSNetworkACLWithClient(client, "acl-123")
+	acl.MaxRules = 3
+	e := NewEnforcer(fakeSource{"block": {"203.0.113.0/24", "2001:db8::1"}}, acl)
+	ctx := context.Background()
+
+	require.NoError(t, e.Sync(ctx))
+	listed, err := acl.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::1", "203.0.113.0/24"}, sorted(listed))
+	var numbers []int32
+	for _, entry := range client.entries {
+		numbers = append(numbers, aws.ToInt32(entry.RuleNumber))
+	}
+	assert.ElementsMatch(t, []int32{1, 2, 3, 100, 32767}, numbers, "free rule numbers are used, taken ones skipped")
+
+	err = acl.Add(ctx, prefixes("198.51.100.1"))
+	assert.ErrorIs(t, err, ErrCapacity)
+
+	e = NewEnforcer(fakeSource{}, acl)
+	require.NoError(t, e.Sync(ctx))
+	assert.Len(t, client.entries, 3, "only our entries are removed")
+}
+
+func TestAWSNetworkACL_FillsToCapacity(t *testing.T) {
+	client := &fakeACL{entries: []types.NetworkAclEntry{
+		{RuleNumber: aws.Int32(2), RuleAction: types.RuleActionAllow, CidrBlock: aws.String("192.0.2.0/24"), Egress: aws.Bool(false)},
+	}}
+	acl := NewAWSNetworkACLWithClient(client, "acl-123")
+	acl.MaxRules = 3
+	ctx := context.Background()
+
+	// Ranked most important first; 203.0.113.7 folds into the /24, which
+	// takes its rank
+	src := fakeSource{"block": {"198.51.100.1", "203.0.113.7", "192.0.2.99/32", "203.0.113.0/24", "2001:db8::1"}}
+	e := NewEnforcer(src, acl)
+	enforce, _, err := e.Desired()
+	require.NoError(t, err)
+	assert.Equal(t, prefixes("198.51.100.1", "203.0.113.0/24", "192.0.2.99", "2001:db8::1"), enforce)
+
+	require.NoError(t, e.Sync(ctx), "a full ACL is not an error")
+	listed, err := acl.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"198.51.100.1", "203.0.113.0/24"}, sorted(listed))
+	assert.Equal(t, 2, e.Status().Backends[0].Dropped)
+
+	// A new top-ranked block displaces the lowest-ranked one
+	src["block"] = append([]string{"2001:db8::1"}, src["block"]...)
+	require.NoError(t, e.Sync(ctx))
+	listed, err = acl.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"198.51.100.1", "2001:db8::1"}, sorted(listed))
+}
@@ -0,0 +1,104 @@
+package firewall
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// IPSet drops blocked sources on hosts using iptables, through a hash:net
+// ipset per address family referenced by a single DROP rule at the top of
+// INPUT. Updates go through `ipset -exist restore`, so re-adding or
+// deleting a missing entry is not an error.
+type IPSet struct {
+	SetV4 string
+	SetV6 string
+	run   Runner
+
+	mu    sync.Mutex
+	ready bool
+}
+
+func NewIPSet(run Runner) *IPSet {
+	return &IPSet{SetV4: "cybershield-v4", SetV6: "cybershield-v6", run: run}
+}
+
+func (s *IPSet) Name() string { return "ipset" }
+
+// ensure creates the sets and inserts the DROP rules unless iptables -C
+// finds them already. A failed setup is retried on the next call.
+func (s *IPSet) ensure(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ready {
+		return nil
+	}
+	for _, f := range []struct{ set, family, iptables string }{
+		{s.SetV4, "inet", "iptables"},
+		{s.SetV6, "inet6", "ip6tables"},
+	} {
+		if _, err := s.run(ctx, "", "ipset", "create", f.set, "hash:net", "family", f.family, "-exist"); err != nil {
+			return err
+		}
+		rule := []string{"INPUT", "-m", "set", "--match-set", f.set, "src", "-j", "DROP"}
+		if _, err := s.run(ctx, "", f.iptables, append([]string{"-C"}, rule...)...); err == nil {
+			continue
+		}
+		if _, err := s.run(ctx, "", f.iptables, append([]string{"-I", rule[0], "1"}, rule[1:]...)...); err != nil {
+			return err
+		}
+	}
+	s.ready = true
+	return nil
+}
+
+func (s *IPSet) List(ctx context.Context) ([]netip.Prefix, error) {
+	if err := s.ensure(ctx); err != nil {
+		return nil, err
+	}
+	var out []netip.Prefix
+	for _, set := range []string{s.SetV4, s.SetV6} {
+		raw, err := s.run(ctx, "", "ipset", "save", set)
+		if err != nil {
+			return nil, err
+		}
+		// Lines look like "add cybershield-v4 203.0.113.0/24"
+		for _, line := range strings.Split(string(raw), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || fields[0] != "add" || fields[1] != set {
+				continue
+			}
+			p, err := parseElement(fields[2])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (s *IPSet) Add(ctx context.Context, prefixes []netip.Prefix) error {
+	return s.restore(ctx, "add", prefixes)
+}
+
+func (s *IPSet) Remove(ctx context.Context, prefixes []netip.Prefix) error {
+	return s.restore(ctx, "del", prefixes)
+}
+
+func (s *IPSet) restore(ctx context.Context, verb string, prefixes []netip.Prefix) error {
+	if err := s.ensure(ctx); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, p := range prefixes {
+		set := s.SetV4
+		if !p.Addr().Is4() {
+			set = s.SetV6
+		}
+		b.WriteString(verb + " " + set + " " + element(p) + "\n")
+	}
+	_, err := s.run(ctx, b.String(), "ipset", "-exist", "restore")
+	return err
+}
@@ -0,0 +1,174 @@
+package firewall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// Elements per nft command; the kernel accepts more, but argument lists
+// and error messages stay manageable
+const nftBatch = 500
+
+// NFTables drops blocked sources with two interval sets in a dedicated
+// inet table:
+//
+//	table inet cybershield {
+//		set blocked_v4 { type ipv4_addr; flags interval; }
+//		set blocked_v6 { type ipv6_addr; flags interval; }
+//		chain input {
+//			type filter hook input priority -10; policy accept;
+//			ip saddr @blocked_v4 drop
+//			ip6 saddr @blocked_v6 drop
+//		}
+//	}
+//
+// Rules never change after setup; blocks are set elements, so adding or
+// removing one is a single atomic update regardless of list size.
+type NFTables struct {
+	Table string
+	run   Runner
+
+	mu    sync.Mutex
+	ready bool
+}
+
+func NewNFTables(run Runner) *NFTables {
+	return &NFTables{Table: "cybershield", run: run}
+}
+
+func (n *NFTables) Name() string { return "nftables" }
+
+func (n *NFTables) setName(v4 bool) string {
+	if v4 {
+		return "blocked_v4"
+	}
+	return "blocked_v6"
+}
+
+// ensure creates the table, sets and chain. The script is idempotent: add
+// is a no-op for existing objects and the chain is flushed before its two
+// rules are added, all in one transaction. A failed setup is retried on
+// the next call.
+func (n *NFTables) ensure(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ready {
+		return nil
+	}
+	t := "inet " + n.Table
+	script := strings.Join([]string{
+		"add table " + t,
+		"add set " + t + " blocked_v4 { type ipv4_addr; flags interval; }",
+		"add set " + t + " blocked_v6 { type ipv6_addr; flags interval; }",
+		"add chain " + t + " input { type filter hook input priority -10; policy accept; }",
+		"flush chain " + t + " input",
+		"add rule " + t + " input ip saddr @blocked_v4 drop",
+		"add rule " + t + " input ip6 saddr @blocked_v6 drop",
+	}, "\n") + "\n"
+	if _, err := n.run(ctx, script, "nft", "-f", "-"); err != nil {
+		return err
+	}
+	n.ready = true
+	return nil
+}
+
+func (n *NFTables) List(ctx context.Context) ([]netip.Prefix, error) {
+	if err := n.ensure(ctx); err != nil {
+		return nil, err
+	}
+	var out []netip.Prefix
+	for _, v4 := range []bool{true, false} {
+		raw, err := n.run(ctx, "", "nft", "-j", "list", "set", "inet", n.Table, n.setName(v4))
+		if err != nil {
+			return nil, err
+		}
+		prefixes, err := parseNFTSet(raw)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, prefixes...)
+	}
+	return out, nil
+}
+
+// parseNFTSet reads the elements of `nft -j list set`. Elements are
+// addresses or {"prefix": {"addr": ..., "len": ...}} objects.
+func parseNFTSet(raw []byte) ([]netip.Prefix, error) {
+	var doc struct {
+		Nftables []struct {
+			Set *struct {
+				Elem []json.RawMessage `json:"elem"`
+			} `json:"set"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse nft output: %w", err)
+	}
+	var out []netip.Prefix
+	for _, obj := range doc.Nftables {
+		if obj.Set == nil {
+			continue
+		}
+		for _, elem := range obj.Set.Elem {
+			var addr string
+			if json.Unmarshal(elem, &addr) == nil {
+				p, err := parseElement(addr)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, p)
+				continue
+			}
+			var prefix struct {
+				Prefix struct {
+					Addr string `json:"addr"`
+					Len  int    `json:"len"`
+				} `json:"prefix"`
+			}
+			if err := json.Unmarshal(elem, &prefix); err != nil || prefix.Prefix.Addr == "" {
+				return nil, fmt.Errorf("unsupported nft set element %s", elem)
+			}
+			p, err := parseElement(fmt.Sprintf("%s/%d", prefix.Prefix.Addr, prefix.Prefix.Len))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (n *NFTables) Add(ctx context.Context, prefixes []netip.Prefix) error {
+	return n.update(ctx, "add", prefixes)
+}
+
+func (n *NFTables) Remove(ctx context.Context, prefixes []netip.Prefix) error {
+	return n.update(ctx, "delete", prefixes)
+}
+
+func (n *NFTables) update(ctx context.Context, verb string, prefixes []netip.Prefix) error {
+	if err := n.ensure(ctx); err != nil {
+		return err
+	}
+	v4, v6 := split(prefixes)
+	for _, family := range []struct {
+		v4       bool
+		prefixes []netip.Prefix
+	}{{true, v4}, {false, v6}} {
+		for _, batch := range chunks(family.prefixes, nftBatch) {
+			elems := make([]string, len(batch))
+			for i, p := range batch {
+				elems[i] = element(p)
+			}
+			_, err := n.run(ctx, "", "nft", verb, "element", "inet", n.Table, n.setName(family.v4), "{ "+strings.Join(elems, ", ")+" }")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,10 +1,21 @@
 package gateway
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/ratelimit"
 	"gorm.io/gorm"
 )
 
@@ -14,6 +25,7 @@ const (
 	RuleRateLimit    RuleType = "RateLimit"
 	RuleAuthCheck    RuleType = "AuthCheck"
 	RuleSQLInjection RuleType = "SQLInjection"
+	RuleSchema       RuleType = "SchemaValidation"
 )
 
 type GatewayRule struct {
@@ -24,14 +36,50 @@ type GatewayRule struct {
 	Threshold int      `json:"threshold"`
 }
 
+// Rate limit scopes
+const (
+	ScopeIP     = "ip"
+	ScopeUser   = "user"
+	ScopeAPIKey = "api_key"
+	ScopeRoute  = "route"
+)
+
+// RateLimitRule is an enabled RateLimit GatewayRule in the form used by the
+// rate limit middleware
+type RateLimitRule struct {
+	ID    uint
+	Name  string
+	Scope string
+	Route string
+	Limit ratelimit.Limit
+}
+
+// Matches reports whether the rule applies to path
+func (r RateLimitRule) Matches(path string) bool {
+	return r.Route == "" || strings.HasPrefix(path, r.Route)
+}
+
+// snapshot is the enforced configuration, rebuilt on every change
+type snapshot struct {
+	enabled    map[RuleType]bool
+	rateLimits []RateLimitRule
+	routes     []*proxyRoute // Longest prefix first
+}
+
 type APIGateway struct {
 	db *gorm.DB
-	mu sync.Mutex
+	mu sync.Mutex // Serializes Refresh so an older load can't replace a newer one
+
+	current        atomic.Pointer[snapshot]
+	allowedTargets []netip.Prefix
 }
 
 func NewAPIGateway(db *gorm.DB) *APIGateway {
 	g := &APIGateway{db: db}
 	g.SeedRules()
+	if err := g.Refresh(); err != nil {
+		slog.Warn("Failed to load gateway rules", "error", err)
+	}
 	return g
 }
 
@@ -40,12 +88,19 @@ func (g *APIGateway) SeedRules() {
 	g.db.Model(&models.GatewayRule{}).Count(&count)
 	if count == 0 {
 		rules := []models.GatewayRule{
-			{Name: "Global Rate Limit", Type: "RateLimit", Enabled: true, Threshold: 1000},
+			{Name: "Global Rate Limit", Type: "RateLimit", Enabled: true, Threshold: 1000, Scope: ScopeIP, Window: 60},
 			{Name: "Block SQL Injection", Type: "SQLInjection", Enabled: true, Threshold: 0},
 			{Name: "Enforce Authentication", Type: "AuthCheck", Enabled: true, Threshold: 0},
 		}
 		g.db.Create(&rules)
 	}
+
+	// Added with the reverse proxy; older installs get it on upgrade
+	var schema models.GatewayRule
+	g.db.Where("type = ?", string(RuleSchema)).Limit(1).Find(&schema)
+	if schema.ID == 0 {
+		g.db.Create(&models.GatewayRule{Name: "Validate Request Schemas", Type: string(RuleSchema), Enabled: true})
+	}
 }
 
 func (g *APIGateway) GetRules() []models.GatewayRule {
@@ -60,5 +115,216 @@ func (g *APIGateway) ToggleRule(id string) error {
 		return fmt.Errorf("rule not found")
 	}
 	rule.Enabled = !rule.Enabled
-	return g.db.Save(&rule).Error
+	if err := g.db.Save(&rule).Error; err != nil {
+		return err
+	}
+	return g.Refresh()
+}
+
+// The shortest interval between requests a rate limit rule may allow
+const minRuleInterval = time.Millisecond
+
+// ValidateRule checks the rate limit settings of a rule and fills in
+// defaults
+func ValidateRule(rule *models.GatewayRule) error {
+	if rule.Type != string(RuleRateLimit) {
+		return nil
+	}
+	switch rule.Scope {
+	case "":
+		rule.Scope = ScopeIP
+	case ScopeIP, ScopeUser, ScopeAPIKey, ScopeRoute:
+	default:
+		return fmt.Errorf("scope must be ip, user, api_key or route")
+	}
+	if rule.Window <= 0 {
+		rule.Window = 60
+	}
+	if rule.Threshold <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+	if time.Duration(rule.Window)*time.Second/time.Duration(rule.Threshold) < minRuleInterval {
+		return fmt.Errorf("threshold may allow at most one request per %s", minRuleInterval)
+	}
+	if rule.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	if rule.Route != "" && !strings.HasPrefix(rule.Route, "/") {
+		return fmt.Errorf("route must start with /")
+	}
+	return nil
+}
+
+func (g *APIGateway) CreateRule(rule *models.GatewayRule) error {
+	if err := ValidateRule(rule); err != nil {
+		return err
+	}
+	if err := g.db.Create(rule).Error; err != nil {
+		return err
+	}
+	return g.Refresh()
+}
+
+// UpdateRule replaces the settings of an existing rule
+func (g *APIGateway) UpdateRule(id string, update models.GatewayRule) (*models.GatewayRule, error) {
+	var rule models.GatewayRule
+	if err := g.db.Where("id = ?", id).First(&rule).Error; err != nil {
+		return nil, fmt.Errorf("rule not found")
+	}
+	rule.Name = update.Name
+	rule.Enabled = update.Enabled
+	rule.Threshold = update.Threshold
+	rule.Scope = update.Scope
+	rule.Route = update.Route
+	rule.Window = update.Window
+	rule.Burst = update.Burst
+	if err := ValidateRule(&rule); err != nil {
+		return nil, err
+	}
+	if err := g.db.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, g.Refresh()
+}
+
+func (g *APIGateway) DeleteRule(id string) error {
+	if err := g.db.Where("id = ?", id).Delete(&models.GatewayRule{}).Error; err != nil {
+		return err
+	}
+	return g.Refresh()
+}
+
+// Refresh reloads the enabled rules and proxy routes. Changes made through
+// this gateway refresh automatically; StartRefresher picks up changes made
+// by other replicas.
+func (g *APIGateway) Refresh() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var rules []models.GatewayRule
+	if err := g.db.Where("enabled = ?", true).Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+	routes, err := g.loadRoutes()
+	if err != nil {
+		return err
+	}
+
+	snap := &snapshot{enabled: make(map[RuleType]bool), routes: routes}
+	for _, r := range rules {
+		snap.enabled[RuleType(r.Type)] = true
+		if r.Type != string(RuleRateLimit) || ValidateRule(&r) != nil {
+			continue
+		}
+		snap.rateLimits = append(snap.rateLimits, RateLimitRule{
+			ID:    r.ID,
+			Name:  r.Name,
+			Scope: r.Scope,
+			Route: r.Route,
+			Limit: ratelimit.Limit{Rate: r.Threshold, Period: time.Duration(r.Window) * time.Second, Burst: r.Burst},
+		})
+	}
+	g.current.Store(snap)
+	return nil
+}
+
+func (g *APIGateway) snapshot() *snapshot {
+	if snap := g.current.Load(); snap != nil {
+		return snap
+	}
+	return &snapshot{}
+}
+
+// Enabled reports whether any rule of type t is enabled
+func (g *APIGateway) Enabled(t RuleType) bool {
+	return g.snapshot().enabled[t]
+}
+
+func (g *APIGateway) StartRefresher(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := g.Refresh(); err != nil {
+				slog.Warn("Failed to refresh gateway rules", "error", err)
+			}
+		}
+	}()
+}
+
+// RateLimits returns the enabled rate limit rules
+func (g *APIGateway) RateLimits() []RateLimitRule {
+	return g.snapshot().rateLimits
+}
+
+// Caller identifies the sender of a request for rate limiting
+type Caller struct {
+	IP     string
+	UserID string // Empty for anonymous requests
+	APIKey string // Raw X-API-Key value, if any
+	Route  string // Route pattern, or the path when unrouted
+}
+
+// Subject is what a rule with scope counts requests against, empty when
+// the caller has no such identity
+func (c Caller) Subject(scope string) string {
+	switch scope {
+	case ScopeUser:
+		return c.UserID
+	case ScopeAPIKey:
+		if c.APIKey == "" {
+			return ""
+		}
+		// Keep raw keys out of Redis
+		sum := sha256.Sum256([]byte(c.APIKey))
+		return hex.EncodeToString(sum[:16])
+	case ScopeRoute:
+		return c.Route
+	default:
+		return c.IP
+	}
+}
+
+// CheckRateLimits counts a request against every enabled rule matching
+// path and returns the most constrained result, or nil when no rule
+// applies. Rules scoped to an identity the caller lacks are skipped, and
+// limiter errors fail open.
+func (g *APIGateway) CheckRateLimits(ctx context.Context, limiter ratelimit.Limiter, path string, caller Caller) (*ratelimit.Result, RateLimitRule) {
+	var tightest *ratelimit.Result
+	var tightestRule RateLimitRule
+	for _, rule := range g.RateLimits() {
+		if !rule.Matches(path) {
+			continue
+		}
+		sub := caller.Subject(rule.Scope)
+		if sub == "" {
+			continue
+		}
+		res, err := limiter.Allow(ctx, fmt.Sprintf("%d:%s:%s", rule.ID, rule.Scope, sub), rule.Limit)
+		if err != nil {
+			continue
+		}
+		if tightest == nil || moreConstrained(res, *tightest) {
+			tightest, tightestRule = &res, rule
+		}
+	}
+	return tightest, tightestRule
+}
+
+func moreConstrained(a, b ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	return a.Remaining < b.Remaining
+}
+
+// SetRateLimitHeaders writes the draft-ietf-httpapi-ratelimit-headers
+// fields, plus Retry-After when the request was rejected
+func SetRateLimitHeaders(h http.Header, res *ratelimit.Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit.Rate))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", ratelimit.Seconds(res.ResetAfter))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", res.Limit.Rate, int(res.Limit.Period.Seconds())))
+	if !res.Allowed {
+		h.Set("Retry-After", ratelimit.Seconds(res.RetryAfter))
+	}
 }
@@ -0,0 +1,270 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/ratelimit"
+	"github.com/cybershield-ai/core/internal/waf"
+	"github.com/gin-gonic/gin"
+)
+
+// Largest request body the proxy inspects and forwards
+const maxProxyBody = 10 << 20
+
+// Headers set by the gateway for upstreams; values sent by clients are
+// dropped so they cannot be spoofed
+const (
+	headerUser = "X-Authenticated-User"
+	headerRole = "X-Authenticated-Role"
+)
+
+// Authenticator verifies the credentials of a proxied request
+type Authenticator func(r *http.Request) (userID, role string, err error)
+
+// Proxy forwards requests under ProxyPrefix to registered upstreams after
+// applying the enabled gateway rules in order: rate limits,
+// authentication, WAF inspection and schema validation. Every decision is
+// written to the security log.
+type Proxy struct {
+	gateway  *APIGateway
+	limiter  ratelimit.Limiter
+	engine   *waf.Engine
+	policies *waf.PolicyStore
+	monitor  *database.MonitorStore
+	auth     Authenticator
+	reverse  *httputil.ReverseProxy
+}
+
+type targetKey struct{}
+
+type target struct {
+	url  *url.URL
+	path string
+}
+
+func NewProxy(gw *APIGateway, limiter ratelimit.Limiter, engine *waf.Engine, policies *waf.PolicyStore, monitor *database.MonitorStore, auth Authenticator) *Proxy {
+	p := &Proxy{
+		gateway:  gw,
+		limiter:  limiter,
+		engine:   engine,
+		policies: policies,
+		monitor:  monitor,
+		auth:     auth,
+	}
+	// Upstream host names are resolved when connecting, so internal
+	// addresses are checked here as well as when the upstream is saved
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			return gw.checkTarget(addr)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	p.reverse = &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			t := pr.In.Context().Value(targetKey{}).(target)
+			pr.Out.URL.Path, pr.Out.URL.RawPath = t.path, ""
+			pr.SetURL(t.url)
+			pr.SetXForwarded()
+			// The gateway has authenticated the caller; upstreams get the
+			// identity headers rather than the platform credentials
+			pr.Out.Header.Del("Authorization")
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Warn("Gateway upstream request failed", "path", r.URL.Path, "error", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, `{"error":"Upstream unavailable"}`)
+		},
+	}
+	return p
+}
+
+// decision is what the proxy did with a request, as recorded in the log
+type decision struct {
+	status     string // Logged, Detected or Blocked
+	attackType string
+	score      int
+	ruleIDs    []string
+	matches    []models.RuleMatch
+	autoBlock  bool // Block the source IP, as SecurityMiddleware does
+}
+
+func (p *Proxy) Handle(c *gin.Context) {
+	r := c.Request
+	path := strings.TrimPrefix(r.URL.Path, ProxyPrefix)
+	if path == "" {
+		path = "/"
+	}
+	route := p.gateway.Match(path)
+	if route == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No gateway route for " + path})
+		return
+	}
+	if !route.Allows(r.Method) {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed"})
+		return
+	}
+
+	r.Header.Del(headerUser)
+	r.Header.Del(headerRole)
+	caller := Caller{IP: c.ClientIP(), APIKey: r.Header.Get("X-API-Key"), Route: route.PathPrefix}
+	var body []byte
+	d := decision{status: "Logged", attackType: "None"}
+	defer func() { p.record(c, caller, body, d) }()
+
+	// Identify the caller first so per-user limits apply, but only enforce
+	// authentication after rate limiting so credential stuffing is limited
+	userID, role, authErr := "", "", error(nil)
+	if p.auth != nil {
+		userID, role, authErr = p.auth(r)
+	}
+	if authErr == nil {
+		caller.UserID = userID
+	}
+
+	// 1. Rate limits
+	if res, rule := p.gateway.CheckRateLimits(r.Context(), p.limiter, r.URL.Path, caller); res != nil {
+		SetRateLimitHeaders(c.Writer.Header(), res)
+		if !res.Allowed {
+			d = decision{status: "Blocked", attackType: "Rate Limit"}
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests", "rule": rule.Name})
+			return
+		}
+	}
+
+	// 2. Authentication. Routes always get what they require; the AuthCheck
+	// rule also refuses bad credentials on public routes
+	if authErr == nil && p.auth == nil {
+		authErr = errors.New("Authentication unavailable")
+	}
+	presented := r.Header.Get("Authorization") != ""
+	if route.RequireAuth || route.RequiredRole != "" || (presented && p.gateway.Enabled(RuleAuthCheck)) {
+		if authErr != nil {
+			d = decision{status: "Blocked", attackType: "Unauthenticated"}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": authErr.Error()})
+			return
+		}
+		if route.RequiredRole != "" && role != route.RequiredRole {
+			d = decision{status: "Blocked", attackType: "Access Denied"}
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+	}
+
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxProxyBody+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		if len(body) > maxProxyBody {
+			body = nil
+			d = decision{status: "Blocked", attackType: "Oversized Body"}
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		}
+	}
+
+	// 3. WAF inspection (SQLi, XSS and the rest of the ruleset)
+	if p.engine != nil && p.gateway.Enabled(RuleSQLInjection) {
+		req := waf.NewRequest(r, body)
+		req.Role = role
+		var policy *waf.Policy
+		if p.policies != nil {
+			policy = p.policies.Policy()
+		}
+		result := p.engine.Inspect(req, policy)
+		d.score, d.ruleIDs = result.Score, result.RuleIDs()
+		for _, m := range result.Matches {
+			d.matches = append(d.matches, models.RuleMatch{RuleID: m.RuleID, Msg: m.Msg, Target: m.Target, Value: m.Value, Score: m.Score})
+		}
+		switch result.Action {
+		case waf.ActionDetect:
+			d.status, d.attackType = "Detected", result.AttackType
+		case waf.ActionBlock:
+			d.status, d.attackType, d.autoBlock = "Blocked", result.AttackType, true
+			c.JSON(http.StatusForbidden, gin.H{"error": "Malicious activity detected."})
+			return
+		}
+	}
+
+	// 4. Schema validation
+	if route.schema != nil && len(body) > 0 && p.gateway.Enabled(RuleSchema) {
+		if violations := route.schema.Validate(body); len(violations) > 0 {
+			d.status, d.attackType = "Blocked", "Schema Violation"
+			d.matches = append(d.matches, models.RuleMatch{RuleID: "schema", Msg: strings.Join(violations, "; ")})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Request does not match schema", "violations": violations})
+			return
+		}
+	}
+
+	// 5. Forward
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	if caller.UserID != "" {
+		r.Header.Set(headerUser, caller.UserID)
+		r.Header.Set(headerRole, role)
+	}
+	ctx := context.WithValue(r.Context(), targetKey{}, target{url: route.target, path: route.UpstreamPath(path)})
+	p.reverse.ServeHTTP(c.Writer, r.WithContext(ctx))
+}
+
+func (p *Proxy) record(c *gin.Context, caller Caller, body []byte, d decision) {
+	if p.monitor == nil {
+		return
+	}
+	payload := p.monitor.Redactor().Payload(body, c.ContentType(), c.Request.URL.RawQuery)
+	entry := &models.SecurityLog{
+		IPAddress:  caller.IP,
+		Method:     c.Request.Method,
+		Account:    caller.UserID,
+		Path:       c.Request.URL.Path,
+		Payload:    payload,
+		RiskScore:  d.score,
+		AttackType: d.attackType,
+		Status:     d.status,
+		RuleIDs:    strings.Join(d.ruleIDs, ","),
+		Matches:    d.matches,
+	}
+	if err := p.monitor.CreateSecurityLog(entry); err != nil {
+		slog.Warn("Failed to log gateway decision", "error", err)
+		return
+	}
+	if d.autoBlock && !p.monitor.IsIPAllowed(caller.IP) {
+		p.monitor.BlockIP(caller.IP, "High Risk Activity: "+d.attackType, "System", 24*time.Hour, entry.ID)
+	}
+}
+
+// IsProxyPath reports whether path is served by the proxy
+func IsProxyPath(path string) bool {
+	return path == ProxyPrefix || strings.HasPrefix(path, ProxyPrefix+"/")
+}
@@ -0,0 +1,236 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/ratelimit"
+	"github.com/cybershield-ai/core/internal/waf"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestProxy(t *testing.T) (*gin.Engine, *APIGateway, *database.MonitorStore) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&models.GatewayRule{}, &models.GatewayUpstream{}, &models.GatewayRoute{},
+		&models.SecurityLog{}, &models.BlockedIP{}, &models.GeoPolicy{}))
+
+	engine, err := waf.NewEngine(waf.DefaultConfig())
+	require.NoError(t, err)
+	gw := NewAPIGateway(db)
+	// Test upstreams listen on loopback
+	gw.AllowTargets([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+	monitor := database.NewMonitorStore(db)
+
+	// Bearer tokens in tests are "user:role"
+	auth := func(r *http.Request) (string, string, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return "", "", errors.New("Authorization header required")
+		}
+		user, role, _ := strings.Cut(token, ":")
+		if user == "" {
+			return "", "", errors.New("Invalid token")
+		}
+		return user, role, nil
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Any(ProxyPrefix+"/*path", NewProxy(gw, ratelimit.NewMemoryLimiter(), engine, nil, monitor, auth).Handle)
+	return r, gw, monitor
+}
+
+func TestProxy_EnforcesRulesAndForwards(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Seen-Path", r.URL.Path)
+		w.Header().Set("X-Seen-User", r.Header.Get(headerUser))
+		w.Header().Set("X-Seen-Authorization", r.Header.Get("Authorization"))
+		w.Write(body)
+	}))
+	defer upstream.Close()
+
+	r, gw, monitor := newTestProxy(t)
+	u := &models.GatewayUpstream{Name: "billing", URL: upstream.URL + "/api", Enabled: true}
+	require.NoError(t, gw.SaveUpstream(u))
+	require.NoError(t, gw.SaveRoute(&models.GatewayRoute{
+		UpstreamID: u.ID, PathPrefix: "/billing/", StripPrefix: true, Methods: "GET,POST",
+		RequireAuth: true, Enabled: true,
+		Schema: `{"type":"object","required":["amount"],"properties":{"amount":{"type":"integer","minimum":1}},"additionalProperties":false}`,
+	}))
+	assert.ErrorIs(t, gw.SaveRoute(&models.GatewayRoute{UpstreamID: 999, PathPrefix: "/x"}), ErrInvalidConfig)
+	assert.ErrorIs(t, gw.SaveUpstream(&models.GatewayUpstream{Name: "bad", URL: "ftp://x"}), ErrInvalidConfig)
+
+	// The reverse proxy needs a real connection (CloseNotifier), so serve
+	// the router rather than using a ResponseRecorder
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(headerUser, "spoofed")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		w := httptest.NewRecorder()
+		w.Code = resp.StatusCode
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		io.Copy(w.Body, resp.Body)
+		return w
+	}
+
+	w := do(http.MethodPost, "/gw/billing/invoices", "alice:user", `{"amount":5}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "/api/invoices", w.Header().Get("X-Seen-Path"))
+	assert.Equal(t, "alice", w.Header().Get("X-Seen-User"), "identity headers come from the gateway, not the client")
+	assert.Empty(t, w.Header().Get("X-Seen-Authorization"), "platform credentials are not forwarded")
+	assert.Equal(t, `{"amount":5}`, w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("RateLimit-Limit"))
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/gw/billing/invoices", "", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodDelete, "/gw/billing/invoices", "alice:user", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/gw/billingx", "alice:user", "").Code)
+
+	w = do(http.MethodPost, "/gw/billing/invoices", "alice:user", `{"amount":0,"admin":true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `unexpected property \"admin\"`)
+	assert.Contains(t, w.Body.String(), "/amount: must be")
+
+	w = do(http.MethodGet, "/gw/billing/invoices?id=1'+OR+'1'='1", "alice:user", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Routes without RequireAuth are public, but the AuthCheck rule still
+	// refuses credentials that don't check out
+	require.NoError(t, gw.SaveRoute(&models.GatewayRoute{UpstreamID: u.ID, PathPrefix: "/status", Enabled: true}))
+	require.NoError(t, gw.SaveRoute(&models.GatewayRoute{UpstreamID: u.ID, PathPrefix: "/admin", RequiredRole: "admin", Enabled: true}))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/gw/status", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/gw/status", ":", "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/gw/admin", "alice:user", "").Code)
+
+	// Disabling the AuthCheck rule lets bad credentials through to public
+	// routes but never relaxes what a route requires
+	for _, rule := range gw.GetRules() {
+		if rule.Type == string(RuleAuthCheck) {
+			require.NoError(t, gw.ToggleRule(strconv.FormatUint(uint64(rule.ID), 10)))
+		}
+	}
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/gw/status", ":", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/gw/billing/invoices", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/gw/admin", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/gw/admin", "alice:user", "").Code)
+
+	logs, err := monitor.GetSecurityLogs(20)
+	require.NoError(t, err)
+	statuses := map[string]string{}
+	for _, l := range logs {
+		if _, seen := statuses[l.AttackType]; !seen {
+			statuses[l.AttackType] = l.Status
+		}
+	}
+	assert.Equal(t, "Blocked", statuses["Unauthenticated"])
+	assert.Equal(t, "Blocked", statuses["Schema Violation"])
+	assert.Equal(t, "Blocked", statuses["SQL Injection"])
+	assert.Equal(t, "Logged", statuses["None"])
+}
+
+func TestAPIGateway_RejectsInternalTargets(t *testing.T) {
+	r, gw, _ := newTestProxy(t)
+	gw.AllowTargets(nil)
+
+	for _, target := range []string{
+		"http://127.0.0.1:8080", "http://localhost/api", "http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5", "https://192.168.1.1", "http://172.16.0.1", "http://[::1]:9000", "http://[fd00::1]", "http://0.0.0.0",
+	} {
+		err := gw.SaveUpstream(&models.GatewayUpstream{Name: "internal", URL: target, Enabled: true})
+		assert.ErrorIs(t, err, ErrInvalidConfig, target)
+	}
+	require.NoError(t, gw.SaveUpstream(&models.GatewayUpstream{Name: "public", URL: "https://203.0.113.10/api"}))
+
+	prefixes, err := ParseTargets("10.0.0.0/8, 192.168.1.1")
+	require.NoError(t, err)
+	gw.AllowTargets(prefixes)
+	assert.NoError(t, gw.SaveUpstream(&models.GatewayUpstream{Name: "private", URL: "http://10.0.0.5"}))
+	assert.ErrorIs(t, gw.SaveUpstream(&models.GatewayUpstream{Name: "other", URL: "http://172.16.0.1"}), ErrInvalidConfig)
+	_, err = ParseTargets("10.0.0.0/8,nope")
+	assert.Error(t, err)
+
+	// Host names are checked against the address they resolve to
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached an internal upstream")
+	}))
+	defer upstream.Close()
+	gw.AllowTargets([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+	u := &models.GatewayUpstream{Name: "loopback", URL: upstream.URL, Enabled: true}
+	require.NoError(t, gw.SaveUpstream(u))
+	require.NoError(t, gw.SaveRoute(&models.GatewayRoute{UpstreamID: u.ID, PathPrefix: "/internal", Enabled: true}))
+	gw.AllowTargets(nil)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/gw/internal/x")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestValidateRule_IntervalFloor(t *testing.T) {
+	rule := &models.GatewayRule{Type: string(RuleRateLimit), Threshold: 60000, Window: 60}
+	assert.NoError(t, ValidateRule(rule))
+
+	rule = &models.GatewayRule{Type: string(RuleRateLimit), Threshold: 60001, Window: 60}
+	assert.Error(t, ValidateRule(rule))
+	rule = &models.GatewayRule{Type: string(RuleRateLimit), Threshold: math.MaxInt}
+	assert.Error(t, ValidateRule(rule))
+}
+
+func TestSchema_Validate(t *testing.T) {
+	s, err := ParseSchema(`{
+		"type": "object",
+		"required": ["name", "tags"],
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "pattern": "^[a-z]+$"},
+			"tags": {"type": "array", "maxItems": 2, "items": {"enum": ["a", "b"]}},
+			"note": {"type": ["string", "null"]}
+		}
+	}`)
+	require.NoError(t, err)
+
+	assert.Empty(t, s.Validate([]byte(`{"name":"ok","tags":["a"],"note":null,"extra":1}`)))
+	assert.Equal(t, []string{
+		`/: missing required property "tags"`,
+		"/name: must match ^[a-z]+$",
+	}, s.Validate([]byte(`{"name":"NO"}`)))
+	assert.Equal(t, []string{
+		"/tags: must have at most 2 items",
+		"/tags/2: must be one of [a b]",
+	}, s.Validate([]byte(`{"name":"ok","tags":["a","b","c"]}`)))
+	assert.Equal(t, []string{"/: expected object, got array"}, s.Validate([]byte(`[]`)))
+
+	_, err = ParseSchema(`{"pattern": "("}`)
+	assert.Error(t, err)
+}
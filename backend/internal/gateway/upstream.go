@@ -0,0 +1,277 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/models"
+	"gorm.io/gorm"
+)
+
+// ProxyPrefix is where proxied routes are mounted; a route with path
+// prefix /billing serves /gw/billing/...
+const ProxyPrefix = "/gw"
+
+// ErrInvalidConfig is returned for upstreams and routes that fail
+// validation
+var ErrInvalidConfig = errors.New("invalid gateway configuration")
+
+// proxyRoute is an enabled route with its upstream resolved
+type proxyRoute struct {
+	models.GatewayRoute
+	target  *url.URL
+	methods map[string]bool
+	schema  *Schema
+}
+
+// Match returns the route serving path (relative to ProxyPrefix)
+func (g *APIGateway) Match(path string) *proxyRoute {
+	for _, r := range g.snapshot().routes {
+		if hasPathPrefix(path, r.PathPrefix) {
+			return r
+		}
+	}
+	return nil
+}
+
+// hasPathPrefix matches whole segments, so /bill does not serve /billing
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "/" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Allows reports whether the route accepts method
+func (r *proxyRoute) Allows(method string) bool {
+	return len(r.methods) == 0 || r.methods[method]
+}
+
+// UpstreamPath is the path forwarded for a request to path
+func (r *proxyRoute) UpstreamPath(path string) string {
+	if !r.StripPrefix || r.PathPrefix == "/" {
+		return path
+	}
+	if rest := strings.TrimPrefix(path, r.PathPrefix); rest != "" {
+		return rest
+	}
+	return "/"
+}
+
+func (g *APIGateway) loadRoutes() ([]*proxyRoute, error) {
+	var rows []models.GatewayRoute
+	if err := g.db.Preload("Upstream").Where("enabled = ?", true).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	routes := make([]*proxyRoute, 0, len(rows))
+	for _, row := range rows {
+		if !row.Upstream.Enabled {
+			continue
+		}
+		route, err := compileRoute(row)
+		if err != nil {
+			// Validated on save; skip rows edited behind our back
+			continue
+		}
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+	return routes, nil
+}
+
+func compileRoute(row models.GatewayRoute) (*proxyRoute, error) {
+	target, err := parseUpstreamURL(row.Upstream.URL)
+	if err != nil {
+		return nil, err
+	}
+	route := &proxyRoute{GatewayRoute: row, target: target}
+	if row.Methods != "" {
+		route.methods = make(map[string]bool)
+		for _, m := range strings.Split(row.Methods, ",") {
+			route.methods[strings.ToUpper(strings.TrimSpace(m))] = true
+		}
+	}
+	if row.Schema != "" {
+		if route.schema, err = ParseSchema(row.Schema); err != nil {
+			return nil, err
+		}
+	}
+	return route, nil
+}
+
+func parseUpstreamURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: upstream url must be an absolute http(s) URL", ErrInvalidConfig)
+	}
+	return u, nil
+}
+
+// ParseTargets reads a comma-separated list of addresses and CIDR prefixes
+func ParseTargets(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range strings.Split(spec, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		p, _, err := database.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", v, err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+// AllowTargets lets upstreams point at internal addresses in prefixes,
+// such as services on a private network. Call it before serving.
+func (g *APIGateway) AllowTargets(prefixes []netip.Prefix) {
+	g.allowedTargets = prefixes
+}
+
+// checkTarget rejects loopback, link-local (including the cloud metadata
+// service at 169.254.169.254), private and unspecified addresses unless
+// they have been allowed
+func (g *APIGateway) checkTarget(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, p := range g.allowedTargets {
+		if p.Contains(addr) {
+			return nil
+		}
+	}
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsPrivate() || addr.IsUnspecified() || addr.IsMulticast() {
+		return fmt.Errorf("%w: upstream %s is an internal address", ErrInvalidConfig, addr)
+	}
+	return nil
+}
+
+// checkUpstreamHost rejects upstreams whose host is an internal address.
+// Host names are checked again when the proxy connects, against the
+// address they resolve to.
+func (g *APIGateway) checkUpstreamHost(u *url.URL) error {
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		host = "127.0.0.1"
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	return g.checkTarget(addr)
+}
+
+func (g *APIGateway) ListUpstreams() ([]models.GatewayUpstream, error) {
+	var upstreams []models.GatewayUpstream
+	err := g.db.Order("name").Find(&upstreams).Error
+	return upstreams, err
+}
+
+// SaveUpstream creates an upstream, or updates it when ID is set
+func (g *APIGateway) SaveUpstream(u *models.GatewayUpstream) error {
+	u.Name = strings.TrimSpace(u.Name)
+	if u.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidConfig)
+	}
+	target, err := parseUpstreamURL(u.URL)
+	if err != nil {
+		return err
+	}
+	if err := g.checkUpstreamHost(target); err != nil {
+		return err
+	}
+	if u.ID != 0 {
+		var existing models.GatewayUpstream
+		if err := g.db.First(&existing, u.ID).Error; err != nil {
+			return err
+		}
+		u.CreatedAt = existing.CreatedAt
+	}
+	if err := g.db.Save(u).Error; err != nil {
+		return err
+	}
+	return g.Refresh()
+}
+
+// DeleteUpstream removes an upstream and its routes
+func (g *APIGateway) DeleteUpstream(id uint) error {
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("upstream_id = ?", id).Delete(&models.GatewayRoute{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.GatewayUpstream{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	return g.Refresh()
+}
+
+func (g *APIGateway) ListRoutes() ([]models.GatewayRoute, error) {
+	var routes []models.GatewayRoute
+	err := g.db.Preload("Upstream").Order("path_prefix").Find(&routes).Error
+	return routes, err
+}
+
+// SaveRoute creates a route, or updates it when ID is set
+func (g *APIGateway) SaveRoute(r *models.GatewayRoute) error {
+	if !strings.HasPrefix(r.PathPrefix, "/") {
+		return fmt.Errorf("%w: path_prefix must start with /", ErrInvalidConfig)
+	}
+	if r.PathPrefix != "/" {
+		r.PathPrefix = strings.TrimSuffix(r.PathPrefix, "/")
+	}
+	for _, m := range strings.Split(r.Methods, ",") {
+		if m = strings.TrimSpace(m); m != "" && !validMethods[strings.ToUpper(m)] {
+			return fmt.Errorf("%w: unknown method %q", ErrInvalidConfig, m)
+		}
+	}
+	if r.Schema != "" {
+		if _, err := ParseSchema(r.Schema); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	var upstream models.GatewayUpstream
+	if err := g.db.Limit(1).Find(&upstream, r.UpstreamID).Error; err != nil {
+		return err
+	}
+	if upstream.ID == 0 {
+		return fmt.Errorf("%w: upstream %d does not exist", ErrInvalidConfig, r.UpstreamID)
+	}
+
+	if r.ID != 0 {
+		var existing models.GatewayRoute
+		if err := g.db.First(&existing, r.ID).Error; err != nil {
+			return err
+		}
+		r.CreatedAt = existing.CreatedAt
+	}
+
+	r.Upstream = models.GatewayUpstream{}
+	if err := g.db.Save(r).Error; err != nil {
+		return err
+	}
+	r.Upstream = upstream
+	return g.Refresh()
+}
+
+func (g *APIGateway) DeleteRoute(id uint) error {
+	if err := g.db.Unscoped().Delete(&models.GatewayRoute{}, id).Error; err != nil {
+		return err
+	}
+	return g.Refresh()
+}
+
+var validMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
@@ -0,0 +1,176 @@
+package geoip
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Info is the location and network owner of an address. Zero values mean
+// unknown.
+type Info struct {
+	CountryCode string `json:"country_code,omitempty"` // ISO 3166-1 alpha-2
+	Country     string `json:"country,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty"`
+	ASOrg       string `json:"as_org,omitempty"`
+}
+
+// Resolver looks up addresses in GeoIP databases
+type Resolver interface {
+	Lookup(ip string) Info
+}
+
+// Record layouts shared by the GeoLite2/GeoIP2 Country, City and ASN
+// databases (and compatible ones such as DB-IP and IPinfo lite)
+type locationRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+type asnRecord struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// MMDBResolver reads local MaxMind-format databases. Either database may be
+// missing, in which case those fields stay empty.
+type MMDBResolver struct {
+	location *maxminddb.Reader
+	asn      *maxminddb.Reader
+
+	mu    sync.Mutex
+	cache *lruCache
+}
+
+// Lookups are cached per address; attack waves repeat the same sources
+const maxCacheEntries = 50000
+
+func OpenMMDB(locationPath, asnPath string) (*MMDBResolver, error) {
+	r := &MMDBResolver{cache: newLRUCache(maxCacheEntries)}
+	var err error
+	if locationPath != "" {
+		if r.location, err = maxminddb.Open(locationPath); err != nil {
+			return nil, fmt.Errorf("open %s: %w", locationPath, err)
+		}
+	}
+	if asnPath != "" {
+		if r.asn, err = maxminddb.Open(asnPath); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("open %s: %w", asnPath, err)
+		}
+	}
+	return r, nil
+}
+
+// NewFromEnv opens GEOIP_CITY_DB (or GEOIP_COUNTRY_DB) and GEOIP_ASN_DB.
+// It returns a nil resolver when neither is configured.
+func NewFromEnv() (Resolver, error) {
+	location := os.Getenv("GEOIP_CITY_DB")
+	if location == "" {
+		location = os.Getenv("GEOIP_COUNTRY_DB")
+	}
+	asn := os.Getenv("GEOIP_ASN_DB")
+	if location == "" && asn == "" {
+		return nil, nil
+	}
+	return OpenMMDB(location, asn)
+}
+
+func (r *MMDBResolver) Lookup(ip string) Info {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return Info{}
+	}
+	addr = addr.Unmap()
+	key := addr.String()
+
+	r.mu.Lock()
+	info, ok := r.cache.get(key)
+	r.mu.Unlock()
+	if ok {
+		return info
+	}
+
+	netIP := net.IP(addr.AsSlice())
+	if r.location != nil {
+		var rec locationRecord
+		if err := r.location.Lookup(netIP, &rec); err == nil {
+			info.CountryCode = rec.Country.ISOCode
+			info.Country = rec.Country.Names["en"]
+			info.City = rec.City.Names["en"]
+		}
+	}
+	if r.asn != nil {
+		var rec asnRecord
+		if err := r.asn.Lookup(netIP, &rec); err == nil {
+			info.ASN = rec.Number
+			info.ASOrg = rec.Org
+		}
+	}
+
+	r.mu.Lock()
+	r.cache.add(key, info)
+	r.mu.Unlock()
+	return info
+}
+
+func (r *MMDBResolver) Close() error {
+	if r.location != nil {
+		r.location.Close()
+	}
+	if r.asn != nil {
+		r.asn.Close()
+	}
+	return nil
+}
+
+// lruCache holds the most recently looked up addresses, evicting the least
+// recently used one when full. It is not safe for concurrent use.
+type lruCache struct {
+	max   int
+	order *list.List // Front is most recent
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	info Info
+}
+
+func newLRUCache(max int) *lruCache {
+	return &lruCache{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) get(key string) (Info, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return Info{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).info, true
+}
+
+func (c *lruCache) add(key string, info Info) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheEntry).info = info
+		c.order.MoveToFront(el)
+		return
+	}
+	if c.order.Len() >= c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, info: info})
+}
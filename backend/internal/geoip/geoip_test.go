@@ -0,0 +1,226 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeMMDB writes a fixture database in the MaxMind DB format: an IPv6
+// search tree with 24-bit records, the data section and the metadata.
+// IPv4 networks live under ::/96, where the reader looks for them.
+func writeMMDB(t *testing.T, dbType string, networks map[string]map[string]any) string {
+	t.Helper()
+
+	const empty = -1
+	nodes := [][2]int{{empty, empty}}
+	var data bytes.Buffer
+	dataRef := map[int]int{} // Tree record marker -> data offset
+	prefixes := make([]string, 0, len(networks))
+	for p := range networks {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+
+	for _, s := range prefixes {
+		p := netip.MustParsePrefix(s)
+		bits, addr := p.Bits(), p.Addr().As16()
+		if p.Addr().Is4() {
+			bits += 96
+			addr = [16]byte{}
+			v4 := p.Addr().As4()
+			copy(addr[12:], v4[:])
+		}
+		marker := -2 - len(dataRef)
+		dataRef[marker] = data.Len()
+		data.Write(encodeMMDB(networks[s]))
+
+		node := 0
+		for i := 0; i < bits; i++ {
+			bit := int(addr[i/8]>>(7-i%8)) & 1
+			if i == bits-1 {
+				nodes[node][bit] = marker
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	var out bytes.Buffer
+	nodeCount := len(nodes)
+	for _, n := range nodes {
+		for _, r := range n {
+			v := r
+			switch {
+			case r == empty:
+				v = nodeCount
+			case r < empty:
+				v = nodeCount + 16 + dataRef[r]
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	out.Write(encodeMMDB(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               dbType,
+		"description":                 map[string]any{"en": "Test fixture"},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	}))
+
+	path := filepath.Join(t.TempDir(), dbType+".mmdb")
+	require.NoError(t, os.WriteFile(path, out.Bytes(), 0o644))
+	return path
+}
+
+// encodeMMDB encodes a value in the MaxMind DB data section format
+func encodeMMDB(v any) []byte {
+	var b bytes.Buffer
+	switch v := v.(type) {
+	case string:
+		writeControl(&b, 2, len(v))
+		b.WriteString(v)
+	case uint16:
+		writeUint(&b, 5, uint64(v))
+	case uint32:
+		writeUint(&b, 6, uint64(v))
+	case uint64:
+		writeUint(&b, 9, v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeControl(&b, 7, len(keys))
+		for _, k := range keys {
+			b.Write(encodeMMDB(k))
+			b.Write(encodeMMDB(v[k]))
+		}
+	case []any:
+		writeControl(&b, 11, len(v))
+		for _, item := range v {
+			b.Write(encodeMMDB(item))
+		}
+	default:
+		panic("unsupported type")
+	}
+	return b.Bytes()
+}
+
+func writeUint(b *bytes.Buffer, typ int, v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	trimmed := bytes.TrimLeft(buf[:], "\x00")
+	writeControl(b, typ, len(trimmed))
+	b.Write(trimmed)
+}
+
+// writeControl writes the control byte for a type and payload size.
+// Types above 7 are extended and follow in their own byte.
+func writeControl(b *bytes.Buffer, typ, size int) {
+	ctrl := byte(typ << 5)
+	if typ > 7 {
+		ctrl = 0
+	}
+	var extra []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		extra = []byte{byte(size - 29)}
+	default:
+		ctrl |= 30
+		extra = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	}
+	b.WriteByte(ctrl)
+	if typ > 7 {
+		b.WriteByte(byte(typ - 7))
+	}
+	b.Write(extra)
+}
+
+func openFixtures(t *testing.T) *MMDBResolver {
+	t.Helper()
+	city := writeMMDB(t, "GeoLite2-City", map[string]map[string]any{
+		"81.2.69.0/24": {
+			"country": map[string]any{"iso_code": "GB", "names": map[string]any{"en": "United Kingdom", "de": "Vereinigtes Königreich"}},
+			"city":    map[string]any{"names": map[string]any{"en": "London"}},
+		},
+		"2001:db8::/32": {
+			"country": map[string]any{"iso_code": "DE", "names": map[string]any{"en": "Germany"}},
+		},
+	})
+	asn := writeMMDB(t, "GeoLite2-ASN", map[string]map[string]any{
+		"81.2.69.0/24": {"autonomous_system_number": uint32(20712), "autonomous_system_organization": "Andrews & Arnold Ltd"},
+	})
+	r, err := OpenMMDB(city, asn)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	require.NoError(t, r.location.Verify(), "fixture is a valid database")
+	require.NoError(t, r.asn.Verify(), "fixture is a valid database")
+	return r
+}
+
+func TestMMDBResolver_Lookup(t *testing.T) {
+	r := openFixtures(t)
+
+	assert.Equal(t, Info{CountryCode: "GB", Country: "United Kingdom", City: "London", ASN: 20712, ASOrg: "Andrews & Arnold Ltd"}, r.Lookup("81.2.69.160"))
+	assert.Equal(t, "GB", r.Lookup("::ffff:81.2.69.1").CountryCode, "mapped IPv4")
+	assert.Equal(t, Info{CountryCode: "DE", Country: "Germany"}, r.Lookup("2001:db8::1"))
+
+	for _, ip := range []string{"81.2.70.1", "10.0.0.1", "127.0.0.1", "fe80::1", "not-an-ip"} {
+		assert.Equal(t, Info{}, r.Lookup(ip), ip)
+	}
+}
+
+func TestMMDBResolver_MissingDatabase(t *testing.T) {
+	asn := writeMMDB(t, "GeoLite2-ASN", map[string]map[string]any{
+		"81.2.69.0/24": {"autonomous_system_number": uint32(20712), "autonomous_system_organization": "Andrews & Arnold Ltd"},
+	})
+	r, err := OpenMMDB("", asn)
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, Info{ASN: 20712, ASOrg: "Andrews & Arnold Ltd"}, r.Lookup("81.2.69.160"))
+
+	_, err = OpenMMDB(filepath.Join(t.TempDir(), "missing.mmdb"), "")
+	assert.Error(t, err)
+}
+
+func TestMMDBResolver_CacheEvictsLeastRecentlyUsed(t *testing.T) {
+	r := openFixtures(t)
+	r.cache = newLRUCache(2)
+
+	r.Lookup("81.2.69.1")
+	r.Lookup("81.2.69.2")
+	r.Lookup("81.2.69.1")
+	r.Lookup("81.2.69.3")
+
+	assert.Equal(t, 2, r.cache.order.Len())
+	_, ok := r.cache.get("81.2.69.1")
+	assert.True(t, ok, "recently used entries stay")
+	_, ok = r.cache.get("81.2.69.2")
+	assert.False(t, ok, "the least recently used entry is evicted")
+	info, ok := r.cache.get("81.2.69.3")
+	assert.True(t, ok)
+	assert.Equal(t, "London", info.City)
+}
@@ -1,13 +1,21 @@
 package honeypot
 
 import (
+	"errors"
 	"fmt"
+	"net/netip"
 	"time"
 
+	"github.com/cybershield-ai/core/internal/events"
 	"github.com/cybershield-ai/core/internal/models"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrHoneypotNotFound = errors.New("honeypot not found")
+	ErrInvalidSource    = errors.New("source_ip must be an IP address")
+)
+
 type HoneypotType string
 
 const (
@@ -27,7 +35,8 @@ type Honeypot struct {
 }
 
 type HoneypotManager struct {
-	db *gorm.DB
+	db      *gorm.DB
+	emitter events.Emitter
 }
 
 func NewHoneypotManager(db *gorm.DB) *HoneypotManager {
@@ -36,6 +45,11 @@ func NewHoneypotManager(db *gorm.DB) *HoneypotManager {
 	return m
 }
 
+// SetEmitter emits a HoneypotHit event for every recorded hit
+func (m *HoneypotManager) SetEmitter(em events.Emitter) {
+	m.emitter = em
+}
+
 func (m *HoneypotManager) SeedHoneypots() {
 	var count int64
 	m.db.Model(&models.HoneypotNode{}).Count(&count)
@@ -68,3 +82,48 @@ func (m *HoneypotManager) DeployHoneypot(name string, hpType HoneypotType, port
 	}
 	m.db.Create(&node)
 }
+
+// Hit is an interaction reported by a honeypot sensor
+type Hit struct {
+	SourceIP string `json:"source_ip" binding:"required"`
+	Port     int    `json:"port"`
+	Details  string `json:"details"`
+}
+
+// RecordHit counts a hit on a honeypot and emits it
+func (m *HoneypotManager) RecordHit(id uint, hit Hit) (*models.HoneypotNode, error) {
+	addr, err := netip.ParseAddr(hit.SourceIP)
+	if err != nil {
+		return nil, ErrInvalidSource
+	}
+	var node models.HoneypotNode
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&node, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrHoneypotNotFound
+			}
+			return err
+		}
+		node.Attacks++
+		node.LastAttack = time.Now()
+		node.Status = "Attacked"
+		if err := tx.Model(&node).Select("attacks", "last_attack", "status").Updates(&node).Error; err != nil {
+			return err
+		}
+		if m.emitter == nil {
+			return nil
+		}
+		return m.emitter.EmitTx(tx, events.HoneypotHit{
+			HoneypotID: node.ID,
+			Name:       node.Name,
+			Kind:       node.Type,
+			SourceIP:   addr.Unmap().String(),
+			Port:       hit.Port,
+			Details:    hit.Details,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
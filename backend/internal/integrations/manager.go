@@ -2,11 +2,14 @@ package integrations
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/cybershield-ai/core/internal/events"
 	"github.com/cybershield-ai/core/internal/models"
 	"gorm.io/gorm"
 )
@@ -82,8 +85,11 @@ func (m *IntegrationManager) SendAlert(integrationType IntegrationType, message
 	if !config.Enabled {
 		return fmt.Errorf("integration not enabled")
 	}
+	return m.alert(config, message)
+}
 
-	switch integrationType {
+func (m *IntegrationManager) alert(config models.IntegrationConfig, message string) error {
+	switch IntegrationType(config.Type) {
 	case Slack:
 		payload := map[string]string{"text": fmt.Sprintf("🚨 *CyberHash Alert*: %s", message)}
 		return m.sendWebhook(config.Webhook, payload)
@@ -95,6 +101,43 @@ func (m *IntegrationManager) SendAlert(integrationType IntegrationType, message
 	}
 }
 
+// Notify sends an alert to every enabled chat integration
+func (m *IntegrationManager) Notify(message string) error {
+	var configs []models.IntegrationConfig
+	if err := m.db.Where("enabled = ? AND type IN ?", true, []IntegrationType{Slack, Teams}).Find(&configs).Error; err != nil {
+		return err
+	}
+	var errs []error
+	for _, config := range configs {
+		if err := m.alert(config, message); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", config.Type, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HandleEvent alerts on critical findings and on real high or critical
+// detections, such as a process killed by EDR
+func (m *IntegrationManager) HandleEvent(ctx context.Context, ev events.Event) error {
+	p, err := ev.Payload()
+	if err != nil {
+		return nil
+	}
+	switch p := p.(type) {
+	case *events.FindingCreated:
+		if p.Severity != "Critical" {
+			return nil
+		}
+	case *events.DetectionRaised:
+		if p.Simulated || (p.Severity != "High" && p.Severity != "Critical") {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return m.Notify(p.Summary())
+}
+
 func (m *IntegrationManager) sendWebhook(url string, payload interface{}) error {
 	if url == "" {
 		return fmt.Errorf("webhook URL is empty")
@@ -0,0 +1,186 @@
+package intel
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrInvalidVector is wrapped by the errors of malformed CVSS vectors
+var ErrInvalidVector = errors.New("invalid CVSS vector")
+
+// CVSS is a parsed vector. Score is the base score of v3.0 and v3.1
+// vectors. v4.0 scores also take the threat and environmental metrics of
+// the vector into account, as the specification does.
+type CVSS struct {
+	Version string            `json:"version"` // 3.0, 3.1 or 4.0
+	Vector  string            `json:"vector"`
+	Metrics map[string]string `json:"metrics"`
+	Score   float64           `json:"score,omitempty"`
+	Scored  bool              `json:"scored"`
+}
+
+// Severity is the qualitative rating of the score, or empty if unscored
+func (c *CVSS) Severity() string {
+	if !c.Scored {
+		return ""
+	}
+	return SeverityOf(c.Score)
+}
+
+// SeverityOf rates a CVSS score as the specification does
+func SeverityOf(score float64) string {
+	switch {
+	case score >= 9:
+		return "Critical"
+	case score >= 7:
+		return "High"
+	case score >= 4:
+		return "Medium"
+	case score > 0:
+		return "Low"
+	}
+	return "None"
+}
+
+// Allowed values of each metric. Base metrics are required; the others
+// are optional and, in v3, not part of the base score.
+var (
+	cvss3Base = map[string][]string{
+		"AV": {"N", "A", "L", "P"}, "AC": {"L", "H"}, "PR": {"N", "L", "H"}, "UI": {"N", "R"},
+		"S": {"U", "C"}, "C": {"H", "L", "N"}, "I": {"H", "L", "N"}, "A": {"H", "L", "N"},
+	}
+	cvss3Optional = map[string][]string{
+		"E": {"X", "H", "F", "P", "U"}, "RL": {"X", "U", "W", "T", "O"}, "RC": {"X", "C", "R", "U"},
+		"CR": {"X", "H", "M", "L"}, "IR": {"X", "H", "M", "L"}, "AR": {"X", "H", "M", "L"},
+		"MAV": {"X", "N", "A", "L", "P"}, "MAC": {"X", "L", "H"}, "MPR": {"X", "N", "L", "H"},
+		"MUI": {"X", "N", "R"}, "MS": {"X", "U", "C"},
+		"MC": {"X", "H", "L", "N"}, "MI": {"X", "H", "L", "N"}, "MA": {"X", "H", "L", "N"},
+	}
+	cvss4Base = map[string][]string{
+		"AV": {"N", "A", "L", "P"}, "AC": {"L", "H"}, "AT": {"N", "P"}, "PR": {"N", "L", "H"},
+		"UI": {"N", "P", "A"}, "VC": {"H", "L", "N"}, "VI": {"H", "L", "N"}, "VA": {"H", "L", "N"},
+		"SC": {"H", "L", "N"}, "SI": {"H", "L", "N"}, "SA": {"H", "L", "N"},
+	}
+	cvss4Optional = map[string][]string{
+		"E": {"X", "A", "P", "U"}, "CR": {"X", "H", "M", "L"}, "IR": {"X", "H", "M", "L"}, "AR": {"X", "H", "M", "L"},
+		"MAV": {"X", "N", "A", "L", "P"}, "MAC": {"X", "L", "H"}, "MAT": {"X", "N", "P"}, "MPR": {"X", "N", "L", "H"},
+		"MUI": {"X", "N", "P", "A"}, "MVC": {"X", "H", "L", "N"}, "MVI": {"X", "H", "L", "N"}, "MVA": {"X", "H", "L", "N"},
+		"MSC": {"X", "H", "L", "N"}, "MSI": {"X", "S", "H", "L", "N"}, "MSA": {"X", "S", "H", "L", "N"},
+		"S": {"X", "N", "P"}, "AU": {"X", "N", "Y"}, "R": {"X", "A", "U", "I"}, "V": {"X", "D", "C"},
+		"RE": {"X", "L", "M", "H"}, "U": {"X", "Clear", "Green", "Amber", "Red"},
+	}
+)
+
+// ParseCVSS parses a CVSS v3.0, v3.1 or v4.0 vector such as
+// CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H
+func ParseCVSS(vector string) (*CVSS, error) {
+	vector = strings.TrimSpace(vector)
+	prefix, rest, ok := strings.Cut(vector, "/")
+	version, found := strings.CutPrefix(prefix, "CVSS:")
+	if !ok || !found {
+		return nil, fmt.Errorf("%w: %q does not start with CVSS:<version>/", ErrInvalidVector, vector)
+	}
+	var base, optional map[string][]string
+	switch version {
+	case "3.0", "3.1":
+		base, optional = cvss3Base, cvss3Optional
+	case "4.0":
+		base, optional = cvss4Base, cvss4Optional
+	default:
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidVector, version)
+	}
+
+	c := &CVSS{Version: version, Vector: vector, Metrics: make(map[string]string)}
+	for _, part := range strings.Split(rest, "/") {
+		key, value, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed metric %q", ErrInvalidVector, part)
+		}
+		allowed, known := base[key]
+		if !known {
+			allowed, known = optional[key]
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: unknown metric %q", ErrInvalidVector, key)
+		}
+		if _, dup := c.Metrics[key]; dup {
+			return nil, fmt.Errorf("%w: metric %s repeated", ErrInvalidVector, key)
+		}
+		if !contains(allowed, value) {
+			return nil, fmt.Errorf("%w: %s cannot be %q", ErrInvalidVector, key, value)
+		}
+		c.Metrics[key] = value
+	}
+	for key := range base {
+		if _, ok := c.Metrics[key]; !ok {
+			return nil, fmt.Errorf("%w: missing base metric %s", ErrInvalidVector, key)
+		}
+	}
+
+	if version == "4.0" {
+		c.Score = c.score4()
+	} else {
+		c.Score = c.baseScore3()
+	}
+	c.Scored = true
+	return c, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Metric weights of CVSS v3
+var (
+	weightAV  = map[string]float64{"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2}
+	weightAC  = map[string]float64{"L": 0.77, "H": 0.44}
+	weightUI  = map[string]float64{"N": 0.85, "R": 0.62}
+	weightCIA = map[string]float64{"H": 0.56, "L": 0.22, "N": 0}
+)
+
+// baseScore3 computes the base score as in section 7.1 of the v3.1
+// specification; v3.0 differs only in its rounding
+func (c *CVSS) baseScore3() float64 {
+	m := c.Metrics
+	changed := m["S"] == "C"
+	pr := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}[m["PR"]]
+	if changed {
+		pr = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}[m["PR"]]
+	}
+
+	iss := 1 - (1-weightCIA[m["C"]])*(1-weightCIA[m["I"]])*(1-weightCIA[m["A"]])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	exploitability := 8.22 * weightAV[m["AV"]] * weightAC[m["AC"]] * pr * weightUI[m["UI"]]
+	if impact <= 0 {
+		return 0
+	}
+	score := impact + exploitability
+	if changed {
+		score *= 1.08
+	}
+	return c.roundUp(math.Min(score, 10))
+}
+
+// roundUp returns the smallest number with one decimal that is not less
+// than x. v3.1 first rounds to five decimals so floating point error does
+// not push exact values up.
+func (c *CVSS) roundUp(x float64) float64 {
+	if c.Version == "3.0" {
+		return math.Ceil(x*10) / 10
+	}
+	n := int(math.Round(x * 100000))
+	if n%10000 == 0 {
+		return float64(n) / 100000
+	}
+	return float64(n/10000+1) / 10
+}
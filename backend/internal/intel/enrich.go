@@ -0,0 +1,259 @@
+package intel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/scanner"
+	"gorm.io/gorm"
+)
+
+var (
+	cveID = regexp.MustCompile(`^CVE-\d{4}-\d{4,}$`)
+	// CVE IDs and CVSS vectors mentioned in a finding's text
+	cveMention    = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)
+	cvssMention   = regexp.MustCompile(`CVSS:(?:3\.[01]|4\.0)(?:/[A-Za-z]+:[A-Za-z]+)+`)
+	enrichColumns = []string{"cves", "cvss_vector", "cvss_score", "epss", "epss_percentile", "known_exploited", "ransomware", "priority", "enriched_at"}
+)
+
+// Impact assumed from the severity of findings without a CVSS score
+var severityImpact = map[string]float64{"Critical": 9.5, "High": 7.5, "Medium": 5, "Low": 2.5}
+
+// Priority scores a finding from 0 to 100: its impact (the CVSS base
+// score, or else its severity) scaled by how likely it is to be exploited.
+// Known exploited vulnerabilities count as certain and others as their
+// EPSS probability, so a critical finding ranges from 57 to 95.
+func Priority(v scanner.Vuln) float64 {
+	impact := v.CVSSScore
+	if impact == 0 {
+		impact = severityImpact[v.Severity]
+	}
+	likelihood := v.EPSS
+	if v.KnownExploited {
+		likelihood = 1
+	}
+	return math.Round(impact*(6+4*likelihood)*10) / 10
+}
+
+// CVEs returns the CVE IDs of a finding, and those mentioned in its title
+// and description
+func CVEs(v scanner.Vuln) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		id = strings.ToUpper(id)
+		if !seen[id] && cveID.MatchString(id) {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range v.CVEs {
+		add(id)
+	}
+	for _, id := range cveMention.FindAllString(v.Title+"\n"+v.Description, -1) {
+		add(id)
+	}
+	return ids
+}
+
+// Enricher adds the feeds to findings and keeps the feeds current by
+// importing KEVFile and EPSSFile every Interval
+type Enricher struct {
+	db    *gorm.DB
+	store *Store
+	now   func() time.Time
+
+	// Files the feeds are imported from; empty ones are skipped
+	KEVFile  string
+	EPSSFile string
+	Interval time.Duration
+}
+
+func NewEnricher(db *gorm.DB) *Enricher {
+	return &Enricher{db: db, store: NewStore(db), now: time.Now, Interval: 24 * time.Hour}
+}
+
+// Store returns the feeds
+func (e *Enricher) Store() *Store {
+	return e.store
+}
+
+// Enrich sets the intelligence fields and priority of findings in place.
+// If the feeds cannot be read the priority still reflects the impact.
+func (e *Enricher) Enrich(ctx context.Context, vulns []scanner.Vuln) {
+	var all []string
+	for i := range vulns {
+		vulns[i].CVEs = CVEs(vulns[i])
+		all = append(all, vulns[i].CVEs...)
+	}
+	known, err := e.store.Lookup(all)
+	if err != nil {
+		slog.Warn("Failed to look up exploit intelligence", "error", err)
+	}
+
+	now := e.now()
+	for i := range vulns {
+		v := &vulns[i]
+		v.CVSSScore, v.EPSS, v.EPSSPercentile, v.KnownExploited, v.Ransomware = 0, 0, 0, false, false
+		if v.CVSSVector == "" {
+			v.CVSSVector = cvssMention.FindString(v.Description)
+		}
+		if v.CVSSVector != "" {
+			if c, err := ParseCVSS(v.CVSSVector); err == nil {
+				v.CVSSScore = c.Score
+			} else {
+				v.CVSSVector = ""
+			}
+		}
+		for _, id := range v.CVEs {
+			info := known[id]
+			if info == nil {
+				continue
+			}
+			if info.KEV != nil {
+				v.KnownExploited = true
+				v.Ransomware = v.Ransomware || info.KEV.RansomwareUse
+			}
+			if info.EPSS != nil && info.EPSS.Score > v.EPSS {
+				v.EPSS, v.EPSSPercentile = info.EPSS.Score, info.EPSS.Percentile
+			}
+		}
+		v.Priority = Priority(*v)
+		v.EnrichedAt = &now
+	}
+}
+
+// EnrichStored enriches stored findings: all of them, or only those not
+// yet enriched. It returns how many were updated.
+func (e *Enricher) EnrichStored(ctx context.Context, pendingOnly bool) (int, error) {
+	q := e.db.WithContext(ctx).Model(&scanner.Vuln{})
+	if pendingOnly {
+		q = q.Where("enriched_at IS NULL")
+	}
+	updated := 0
+	var batch []scanner.Vuln
+	err := q.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		e.Enrich(ctx, batch)
+		return e.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for i := range batch {
+				err := tx.Model(&batch[i]).Select(enrichColumns).Updates(&batch[i]).Error
+				if err != nil {
+					return err
+				}
+			}
+			updated += len(batch)
+			return nil
+		})
+	}).Error
+	return updated, err
+}
+
+// Import replaces a feed and, if it changed, re-enriches every finding
+func (e *Enricher) Import(ctx context.Context, feed string, data []byte) (*FeedImport, error) {
+	imp, changed, err := e.store.Import(feed, data)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if _, err := e.EnrichStored(ctx, false); err != nil {
+			return imp, fmt.Errorf("enrich findings: %w", err)
+		}
+	}
+	return imp, nil
+}
+
+// Refresh imports the configured feed files that changed and re-enriches
+// the findings
+func (e *Enricher) Refresh(ctx context.Context) error {
+	changed := false
+	for _, f := range []struct{ feed, path string }{{FeedKEV, e.KEVFile}, {FeedEPSS, e.EPSSFile}} {
+		if f.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return fmt.Errorf("read %s feed: %w", f.feed, err)
+		}
+		imp, ok, err := e.store.Import(f.feed, data)
+		if err != nil {
+			return fmt.Errorf("import %s: %w", f.path, err)
+		}
+		if ok {
+			slog.Info("Imported exploit intelligence", "feed", f.feed, "version", imp.Version, "records", imp.Records)
+			changed = true
+		}
+	}
+	// EPSS scores change daily, so every finding is updated with a new file
+	if changed {
+		_, err := e.EnrichStored(ctx, false)
+		return err
+	}
+	return nil
+}
+
+// Start refreshes the feeds now and every Interval, and enriches new
+// findings every minute, in the background
+func (e *Enricher) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		last := time.Time{}
+		for {
+			ctx := context.Background()
+			if time.Since(last) >= e.Interval {
+				if err := e.Refresh(ctx); err != nil {
+					slog.Warn("Failed to refresh exploit intelligence", "error", err)
+				}
+				last = time.Now()
+			}
+			if _, err := e.EnrichStored(ctx, true); err != nil {
+				slog.Warn("Failed to enrich findings", "error", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// FindingFilter selects findings. Zero fields match everything.
+type FindingFilter struct {
+	KnownExploited bool
+	Severity       string
+	CVE            string
+	MinPriority    float64
+	Limit          int // Default 100
+}
+
+// Findings returns matching findings, highest priority first, and how
+// many match in total
+func (e *Enricher) Findings(ctx context.Context, f FindingFilter) ([]scanner.Vuln, int64, error) {
+	q := e.db.WithContext(ctx).Model(&scanner.Vuln{})
+	if f.KnownExploited {
+		q = q.Where("known_exploited = ?", true)
+	}
+	if f.Severity != "" {
+		q = q.Where("severity = ?", f.Severity)
+	}
+	if f.CVE != "" {
+		// CVEs are stored as a JSON list of upper-case IDs
+		q = q.Where("cves LIKE ?", `%"`+strings.ToUpper(f.CVE)+`"%`)
+	}
+	if f.MinPriority > 0 {
+		q = q.Where("priority >= ?", f.MinPriority)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	var vulns []scanner.Vuln
+	err := q.Order("priority DESC").Order("id DESC").Limit(f.Limit).Find(&vulns).Error
+	return vulns, total, err
+}
@@ -0,0 +1,93 @@
+package intel
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cybershield-ai/core/internal/scanner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriority(t *testing.T) {
+	assert.Equal(t, 57.0, Priority(scanner.Vuln{Severity: "Critical"}))
+	assert.Equal(t, 95.0, Priority(scanner.Vuln{Severity: "Critical", KnownExploited: true}))
+	assert.Equal(t, 98.0, Priority(scanner.Vuln{Severity: "Low", CVSSScore: 9.8, KnownExploited: true}), "the CVSS score outweighs the severity")
+	assert.Equal(t, 60.0, Priority(scanner.Vuln{Severity: "High", EPSS: 0.5}))
+	assert.Equal(t, 0.0, Priority(scanner.Vuln{Severity: "Info"}))
+}
+
+func TestEnricher_Enrich(t *testing.T) {
+	e := NewEnricher(newTestDB(t))
+	_, _, err := e.Store().Import(FeedKEV, []byte(kevCatalog))
+	require.NoError(t, err)
+	_, _, err = e.Store().Import(FeedEPSS, []byte(epssCSV))
+	require.NoError(t, err)
+
+	vulns := []scanner.Vuln{
+		{Title: "log4j-core 2.14.1 (cve-2021-44228)", Severity: "High",
+			Description: "Remote code execution. CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H"},
+		{Title: "Outdated library", Severity: "Medium", CVEs: []string{"CVE-2024-0001"}},
+		{Title: "Missing header", Severity: "Low", CVSSVector: "CVSS:3.1/AV:N"},
+	}
+	e.Enrich(context.Background(), vulns)
+
+	log4j := vulns[0]
+	assert.Equal(t, []string{"CVE-2021-44228"}, log4j.CVEs)
+	assert.Equal(t, 10.0, log4j.CVSSScore)
+	assert.True(t, log4j.KnownExploited)
+	assert.True(t, log4j.Ransomware)
+	assert.InDelta(t, 0.94358, log4j.EPSS, 1e-9)
+	assert.Equal(t, 100.0, log4j.Priority)
+	assert.NotNil(t, log4j.EnrichedAt)
+
+	assert.False(t, vulns[1].KnownExploited)
+	assert.InDelta(t, 0.00043, vulns[1].EPSS, 1e-9)
+	assert.Equal(t, 30.0, vulns[1].Priority)
+
+	assert.Empty(t, vulns[2].CVSSVector, "invalid vectors are dropped")
+	assert.Equal(t, 15.0, vulns[2].Priority)
+}
+
+func TestEnricher_RefreshAndFindings(t *testing.T) {
+	db := newTestDB(t)
+	e := NewEnricher(db)
+	ctx := context.Background()
+	require.NoError(t, db.Create(&[]scanner.Vuln{
+		{Title: "Log4Shell in api", Description: "CVE-2021-44228", Severity: "High"},
+		{Title: "Weak TLS", Severity: "Critical"},
+		{Title: "Citrix Bleed", Description: "CVE-2023-4966", Severity: "Medium"},
+	}).Error)
+
+	n, err := e.EnrichStored(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = e.EnrichStored(ctx, true)
+	require.NoError(t, err)
+	assert.Zero(t, n, "enriched findings are not pending")
+
+	findings, _, err := e.Findings(ctx, FindingFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, "Weak TLS", findings[0].Title, "without feeds the severity decides")
+
+	dir := t.TempDir()
+	e.KEVFile = filepath.Join(dir, "known_exploited_vulnerabilities.json")
+	require.NoError(t, os.WriteFile(e.KEVFile, []byte(kevCatalog), 0o644))
+	require.NoError(t, e.Refresh(ctx))
+
+	exploited, total, err := e.Findings(ctx, FindingFilter{KnownExploited: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, "Log4Shell in api", exploited[0].Title)
+	assert.Equal(t, "Citrix Bleed", exploited[1].Title)
+
+	byCVE, _, err := e.Findings(ctx, FindingFilter{CVE: "cve-2023-4966"})
+	require.NoError(t, err)
+	require.Len(t, byCVE, 1)
+	assert.Equal(t, "Citrix Bleed", byCVE[0].Title)
+
+	e.EPSSFile = filepath.Join(dir, "missing.csv")
+	assert.Error(t, e.Refresh(ctx))
+}
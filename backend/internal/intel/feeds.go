@@ -0,0 +1,300 @@
+// Package intel enriches findings with exploit intelligence: CISA's Known
+// Exploited Vulnerabilities catalog, FIRST's EPSS scores and CVSS vectors.
+// Feeds are imported from local files, so nothing is fetched at runtime.
+package intel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Feeds
+const (
+	FeedKEV  = "kev"
+	FeedEPSS = "epss"
+)
+
+var (
+	ErrUnknownFeed = errors.New("unknown feed")
+	// Wraps parse errors of feed files
+	ErrInvalidFeed = errors.New("invalid feed file")
+)
+
+// KEVEntry is a vulnerability in CISA's Known Exploited Vulnerabilities
+// catalog
+type KEVEntry struct {
+	CVE            string    `json:"cve" gorm:"primaryKey"`
+	VendorProject  string    `json:"vendor_project"`
+	Product        string    `json:"product"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	RequiredAction string    `json:"required_action"`
+	DateAdded      time.Time `json:"date_added"`
+	DueDate        time.Time `json:"due_date"`
+	RansomwareUse  bool      `json:"ransomware_use"` // Known use in ransomware campaigns
+}
+
+func (KEVEntry) TableName() string { return "kev_entries" }
+
+// EPSSScore is the probability that a CVE is exploited in the next 30
+// days, and its percentile among all scored CVEs
+type EPSSScore struct {
+	CVE        string    `json:"cve" gorm:"primaryKey"`
+	Score      float64   `json:"epss"`
+	Percentile float64   `json:"percentile"`
+	Date       time.Time `json:"date"`
+}
+
+func (EPSSScore) TableName() string { return "epss_scores" }
+
+// FeedImport records the last import of a feed
+type FeedImport struct {
+	Feed       string    `json:"feed" gorm:"primaryKey"`
+	Version    string    `json:"version"`  // Catalog version or EPSS model
+	Released   time.Time `json:"released"` // Release or score date
+	Records    int       `json:"records"`
+	Checksum   string    `json:"checksum"` // SHA-256 of the file
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+func (FeedImport) TableName() string { return "intel_imports" }
+
+// ParseKEV reads the JSON catalog published at
+// https://www.cisa.gov/known-exploited-vulnerabilities-catalog
+func ParseKEV(data []byte) ([]KEVEntry, *FeedImport, error) {
+	var catalog struct {
+		CatalogVersion  string `json:"catalogVersion"`
+		DateReleased    string `json:"dateReleased"`
+		Vulnerabilities []struct {
+			CVEID                      string `json:"cveID"`
+			VendorProject              string `json:"vendorProject"`
+			Product                    string `json:"product"`
+			VulnerabilityName          string `json:"vulnerabilityName"`
+			DateAdded                  string `json:"dateAdded"`
+			ShortDescription           string `json:"shortDescription"`
+			RequiredAction             string `json:"requiredAction"`
+			DueDate                    string `json:"dueDate"`
+			KnownRansomwareCampaignUse string `json:"knownRansomwareCampaignUse"`
+		} `json:"vulnerabilities"`
+	}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+	}
+	if catalog.Vulnerabilities == nil {
+		return nil, nil, fmt.Errorf("%w: no vulnerabilities list, is this the KEV JSON catalog?", ErrInvalidFeed)
+	}
+
+	imp := &FeedImport{Feed: FeedKEV, Version: catalog.CatalogVersion}
+	imp.Released, _ = time.Parse(time.RFC3339, catalog.DateReleased)
+	entries := make([]KEVEntry, 0, len(catalog.Vulnerabilities))
+	seen := make(map[string]bool)
+	for _, v := range catalog.Vulnerabilities {
+		cve := strings.ToUpper(strings.TrimSpace(v.CVEID))
+		if !cveID.MatchString(cve) || seen[cve] {
+			continue
+		}
+		seen[cve] = true
+		e := KEVEntry{
+			CVE:            cve,
+			VendorProject:  v.VendorProject,
+			Product:        v.Product,
+			Name:           v.VulnerabilityName,
+			Description:    v.ShortDescription,
+			RequiredAction: v.RequiredAction,
+			RansomwareUse:  strings.EqualFold(v.KnownRansomwareCampaignUse, "Known"),
+		}
+		e.DateAdded, _ = time.Parse("2006-01-02", v.DateAdded)
+		e.DueDate, _ = time.Parse("2006-01-02", v.DueDate)
+		entries = append(entries, e)
+	}
+	imp.Records = len(entries)
+	return entries, imp, nil
+}
+
+// ParseEPSS reads the daily CSV published at https://www.first.org/epss/data_stats,
+// compressed or not. Its first line holds the model version and score date.
+func ParseEPSS(data []byte) ([]EPSSScore, *FeedImport, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+		}
+	}
+
+	imp := &FeedImport{Feed: FeedEPSS}
+	// #model_version:v2023.03.01,score_date:2023-03-07T00:00:00+0000
+	if rest, ok := bytes.CutPrefix(data, []byte("#")); ok {
+		line, body, _ := bytes.Cut(rest, []byte("\n"))
+		for _, field := range strings.Split(strings.TrimSpace(string(line)), ",") {
+			key, value, _ := strings.Cut(field, ":")
+			switch key {
+			case "model_version":
+				imp.Version = value
+			case "score_date":
+				imp.Released, _ = time.Parse("2006-01-02T15:04:05-0700", value)
+			}
+		}
+		data = body
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.TrimSpace(name)] = i
+	}
+	cveCol, ok1 := col["cve"]
+	epssCol, ok2 := col["epss"]
+	pctCol, ok3 := col["percentile"]
+	if !ok1 || !ok2 || !ok3 {
+		return nil, nil, fmt.Errorf("%w: expected the columns cve, epss and percentile", ErrInvalidFeed)
+	}
+
+	var scores []EPSSScore
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+		}
+		s := EPSSScore{CVE: strings.ToUpper(rec[cveCol]), Date: imp.Released}
+		s.Score, err = strconv.ParseFloat(rec[epssCol], 64)
+		if err == nil {
+			s.Percentile, err = strconv.ParseFloat(rec[pctCol], 64)
+		}
+		if err != nil || !cveID.MatchString(s.CVE) {
+			return nil, nil, fmt.Errorf("%w: line %d: %q", ErrInvalidFeed, line, strings.Join(rec, ","))
+		}
+		scores = append(scores, s)
+	}
+	imp.Records = len(scores)
+	return scores, imp, nil
+}
+
+// Store keeps the imported feeds
+type Store struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db, now: time.Now}
+}
+
+// Import replaces a feed with the contents of a file. It reports false,
+// without changes, when the file is the one imported last.
+func (s *Store) Import(feed string, data []byte) (*FeedImport, bool, error) {
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	var last FeedImport
+	if err := s.db.Where("feed = ?", feed).Limit(1).Find(&last).Error; err != nil {
+		return nil, false, err
+	}
+	if last.Checksum == checksum {
+		return &last, false, nil
+	}
+
+	var (
+		imp     *FeedImport
+		records any
+		model   any
+		err     error
+	)
+	switch feed {
+	case FeedKEV:
+		var entries []KEVEntry
+		entries, imp, err = ParseKEV(data)
+		records, model = entries, &KEVEntry{}
+	case FeedEPSS:
+		var scores []EPSSScore
+		scores, imp, err = ParseEPSS(data)
+		records, model = scores, &EPSSScore{}
+	default:
+		return nil, false, fmt.Errorf("%w %q", ErrUnknownFeed, feed)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	imp.Checksum = checksum
+	imp.ImportedAt = s.now()
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+			return err
+		}
+		if imp.Records > 0 {
+			if err := tx.CreateInBatches(records, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(imp).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return imp, true, nil
+}
+
+// Imports lists the last import of each feed
+func (s *Store) Imports() ([]FeedImport, error) {
+	var imports []FeedImport
+	err := s.db.Order("feed").Find(&imports).Error
+	return imports, err
+}
+
+// CVEIntel is what the feeds know about a CVE
+type CVEIntel struct {
+	CVE  string     `json:"cve"`
+	KEV  *KEVEntry  `json:"kev,omitempty"`
+	EPSS *EPSSScore `json:"epss,omitempty"`
+}
+
+// Lookup returns the intelligence on each CVE that appears in a feed
+func (s *Store) Lookup(cves []string) (map[string]*CVEIntel, error) {
+	found := make(map[string]*CVEIntel)
+	get := func(cve string) *CVEIntel {
+		if found[cve] == nil {
+			found[cve] = &CVEIntel{CVE: cve}
+		}
+		return found[cve]
+	}
+	// Stay well below the bound parameter limits of the databases
+	for start := 0; start < len(cves); start += 500 {
+		chunk := cves[start:min(start+500, len(cves))]
+		var kev []KEVEntry
+		if err := s.db.Where("cve IN ?", chunk).Find(&kev).Error; err != nil {
+			return nil, err
+		}
+		for i := range kev {
+			get(kev[i].CVE).KEV = &kev[i]
+		}
+		var epss []EPSSScore
+		if err := s.db.Where("cve IN ?", chunk).Find(&epss).Error; err != nil {
+			return nil, err
+		}
+		for i := range epss {
+			get(epss[i].CVE).EPSS = &epss[i]
+		}
+	}
+	return found, nil
+}
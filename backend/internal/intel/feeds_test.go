@@ -0,0 +1,117 @@
+package intel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/scanner"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const kevCatalog = `{
+  "title": "CISA Catalog of Known Exploited Vulnerabilities",
+  "catalogVersion": "2026.10.16",
+  "dateReleased": "2026-10-16T17:03:12.0000Z",
+  "count": 2,
+  "vulnerabilities": [
+    {"cveID": "CVE-2021-44228", "vendorProject": "Apache", "product": "Log4j2", "vulnerabilityName": "Apache Log4j2 Remote Code Execution Vulnerability",
+     "dateAdded": "2021-12-10", "shortDescription": "JNDI features do not protect against attacker-controlled LDAP endpoints.",
+     "requiredAction": "Apply updates per vendor instructions.", "dueDate": "2021-12-24", "knownRansomwareCampaignUse": "Known", "notes": "", "cwes": ["CWE-20"]},
+    {"cveID": "CVE-2023-4966", "vendorProject": "Citrix", "product": "NetScaler ADC", "vulnerabilityName": "Citrix Bleed",
+     "dateAdded": "2023-10-18", "shortDescription": "Sensitive information disclosure.", "requiredAction": "Apply mitigations.",
+     "dueDate": "2023-11-08", "knownRansomwareCampaignUse": "Unknown", "notes": "", "cwes": ["CWE-119"]}
+  ]
+}`
+
+const epssCSV = `#model_version:v2025.03.14,score_date:2026-10-18T12:55:00+0000
+cve,epss,percentile
+CVE-2021-44228,0.94358,0.99962
+CVE-2024-0001,0.00043,0.11204
+`
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&KEVEntry{}, &EPSSScore{}, &FeedImport{}, &scanner.Vuln{}))
+	return db
+}
+
+func TestParseKEV(t *testing.T) {
+	entries, imp, err := ParseKEV([]byte(kevCatalog))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "2026.10.16", imp.Version)
+	assert.Equal(t, 2, imp.Records)
+	assert.Equal(t, "CVE-2021-44228", entries[0].CVE)
+	assert.True(t, entries[0].RansomwareUse)
+	assert.False(t, entries[1].RansomwareUse)
+	assert.Equal(t, time.Date(2021, 12, 24, 0, 0, 0, 0, time.UTC), entries[0].DueDate)
+
+	_, _, err = ParseKEV([]byte(`{"cve": []}`))
+	assert.ErrorIs(t, err, ErrInvalidFeed)
+}
+
+func TestParseEPSS(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(epssCSV))
+	zw.Close()
+
+	for name, data := range map[string][]byte{"plain": []byte(epssCSV), "gzip": gz.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			scores, imp, err := ParseEPSS(data)
+			require.NoError(t, err)
+			require.Len(t, scores, 2)
+			assert.Equal(t, "v2025.03.14", imp.Version)
+			assert.Equal(t, 2026, imp.Released.Year())
+			assert.Equal(t, EPSSScore{CVE: "CVE-2021-44228", Score: 0.94358, Percentile: 0.99962, Date: imp.Released}, scores[0])
+		})
+	}
+
+	_, _, err := ParseEPSS([]byte("cve,epss,percentile\nCVE-2021-44228,high,0.9\n"))
+	assert.ErrorIs(t, err, ErrInvalidFeed)
+	_, _, err = ParseEPSS([]byte("id,score\n"))
+	assert.ErrorIs(t, err, ErrInvalidFeed)
+}
+
+func TestStore_Import(t *testing.T) {
+	store := NewStore(newTestDB(t))
+
+	imp, changed, err := store.Import(FeedKEV, []byte(kevCatalog))
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 2, imp.Records)
+	_, changed, err = store.Import(FeedKEV, []byte(kevCatalog))
+	require.NoError(t, err)
+	assert.False(t, changed, "the same file is not imported twice")
+
+	_, _, err = store.Import(FeedEPSS, []byte(epssCSV))
+	require.NoError(t, err)
+	// A new file replaces the feed
+	_, changed, err = store.Import(FeedEPSS, []byte("cve,epss,percentile\nCVE-2023-4966,0.97,0.999\n"))
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	found, err := store.Lookup([]string{"CVE-2021-44228", "CVE-2023-4966", "CVE-2024-0001"})
+	require.NoError(t, err)
+	assert.NotNil(t, found["CVE-2021-44228"].KEV)
+	assert.Nil(t, found["CVE-2021-44228"].EPSS)
+	assert.InDelta(t, 0.97, found["CVE-2023-4966"].EPSS.Score, 1e-9)
+	assert.NotContains(t, found, "CVE-2024-0001")
+
+	imports, err := store.Imports()
+	require.NoError(t, err)
+	assert.Len(t, imports, 2)
+
+	_, _, err = store.Import("nvd", []byte("{}"))
+	assert.ErrorIs(t, err, ErrUnknownFeed)
+}
@@ -0,0 +1,336 @@
+// Package knowledge gives the chat assistant access to platform records:
+// an indexer loads findings, scans, cloud resources, security logs,
+// blocklist entries, compliance controls and playbooks into a local
+// retrieval index, and read-only tools query them directly.
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/automation"
+	"github.com/cybershield-ai/core/internal/compliance"
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/scanner"
+	"gorm.io/gorm"
+)
+
+// Document kinds, which prefix record IDs
+const (
+	KindFinding   = "finding"
+	KindScan      = "scan"
+	KindCloud     = "cloud"
+	KindLog       = "log"
+	KindBlockedIP = "blocked_ip"
+	KindStandard  = "compliance"
+	KindControl   = "control"
+	KindPlaybook  = "playbook"
+)
+
+// PlaybookLister returns the configured playbooks
+type PlaybookLister interface {
+	GetPlaybooks() []automation.Playbook
+}
+
+// Indexer keeps an index in sync with the database. It reloads every
+// Interval, and sooner after events that change indexed records.
+type Indexer struct {
+	db        *gorm.DB
+	index     *ai.Index
+	playbooks PlaybookLister
+	dirty     atomic.Bool
+
+	Interval time.Duration
+	// Security logs older than LogWindow are left to the tools
+	LogWindow time.Duration
+	// Newest records indexed per kind
+	MaxDocs int
+}
+
+func NewIndexer(db *gorm.DB, index *ai.Index, playbooks PlaybookLister) *Indexer {
+	return &Indexer{
+		db:        db,
+		index:     index,
+		playbooks: playbooks,
+		Interval:  10 * time.Minute,
+		LogWindow: 7 * 24 * time.Hour,
+		MaxDocs:   5000,
+	}
+}
+
+// Start refreshes the index now and then in the background
+func (ix *Indexer) Start() {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		last := time.Time{}
+		for {
+			if ix.dirty.Swap(false) || time.Since(last) >= ix.Interval {
+				if err := ix.Refresh(); err != nil {
+					slog.Warn("Failed to refresh knowledge index", "error", err)
+				}
+				last = time.Now()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// HandleEvent schedules a refresh after records change
+func (ix *Indexer) HandleEvent(ctx context.Context, ev events.Event) error {
+	ix.dirty.Store(true)
+	return nil
+}
+
+// Refresh reloads every kind of record
+func (ix *Indexer) Refresh() error {
+	loaders := []struct {
+		kind string
+		load func() ([]ai.Document, error)
+	}{
+		{KindFinding, ix.findings},
+		{KindScan, ix.scans},
+		{KindCloud, ix.cloudResources},
+		{KindLog, ix.securityLogs},
+		{KindBlockedIP, ix.blockedIPs},
+		{KindStandard, ix.standards},
+		{KindControl, controls},
+		{KindPlaybook, ix.playbookDocs},
+	}
+	var failed []string
+	for _, l := range loaders {
+		docs, err := l.load()
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", l.kind, err))
+			continue
+		}
+		ix.index.Replace(l.kind, docs)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("load %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// findingRow is a finding with the target of its scan
+type findingRow struct {
+	scanner.Vuln
+	Target    string     `json:"target"`
+	ScannedAt *time.Time `json:"scanned_at"` // Null for findings without a scan
+}
+
+// findingsQuery joins findings to their scans
+func findingsQuery(db *gorm.DB) *gorm.DB {
+	return db.Table("vulns").
+		Select("vulns.*, COALESCE(scan_results.target, '') AS target, scan_results.created_at AS scanned_at").
+		Joins("LEFT JOIN scan_results ON scan_results.scan_id = vulns.scan_id")
+}
+
+func (ix *Indexer) findings() ([]ai.Document, error) {
+	var rows []findingRow
+	if err := findingsQuery(ix.db).Order("vulns.id DESC").Limit(ix.MaxDocs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	docs := make([]ai.Document, 0, len(rows))
+	for _, r := range rows {
+		doc := ai.Document{
+			ID:    ID(KindFinding, r.ID),
+			Title: fmt.Sprintf("%s %s finding: %s", r.Severity, r.Category, r.Title),
+			Text: fmt.Sprintf("Target %s, scan %s. %s Solution: %s Compliance: %s",
+				r.Target, r.ScanID, r.Description, r.Solution, strings.Join(r.Compliance, ", ")),
+		}
+		if r.ScannedAt != nil {
+			doc.Time = *r.ScannedAt
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func (ix *Indexer) scans() ([]ai.Document, error) {
+	var rows []struct {
+		scanner.ScanResult
+		Findings int
+	}
+	err := ix.db.Model(&scanner.ScanResult{}).
+		Select("scan_results.*, (SELECT COUNT(*) FROM vulns WHERE vulns.scan_id = scan_results.scan_id) AS findings").
+		Order("created_at DESC").Limit(ix.MaxDocs).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]ai.Document, 0, len(rows))
+	for _, r := range rows {
+		docs = append(docs, ai.Document{
+			ID:    ID(KindScan, r.ScanID),
+			Title: fmt.Sprintf("%s scan of %s", r.Type, r.Target),
+			Text:  fmt.Sprintf("Status %s, %d findings, started %s", r.Status, r.Findings, r.CreatedAt.UTC().Format(time.RFC3339)),
+			Time:  r.CreatedAt,
+		})
+	}
+	return docs, nil
+}
+
+func (ix *Indexer) cloudResources() ([]ai.Document, error) {
+	var rows []models.CloudResource
+	if err := ix.db.Order("id DESC").Limit(ix.MaxDocs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	docs := make([]ai.Document, 0, len(rows))
+	for _, r := range rows {
+		docs = append(docs, ai.Document{
+			ID:    ID(KindCloud, r.ResourceID),
+			Title: fmt.Sprintf("%s %s %s", r.Provider, r.Service, r.ResourceID),
+			Text:  fmt.Sprintf("Account %s, region %s, status %s", r.AccountID, r.Region, r.Status),
+			Time:  r.LastScanned,
+		})
+	}
+	return docs, nil
+}
+
+// securityLogs indexes recent requests that were flagged; the rest are only
+// reachable through the log tool
+func (ix *Indexer) securityLogs() ([]ai.Document, error) {
+	var rows []models.SecurityLog
+	err := ix.db.Where("created_at >= ? AND (risk_score > 0 OR attack_type NOT IN ?)", time.Now().Add(-ix.LogWindow), []string{"", "None"}).
+		Order("id DESC").Limit(ix.MaxDocs).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]ai.Document, 0, len(rows))
+	for _, r := range rows {
+		var rules []string
+		for _, m := range r.Matches {
+			rules = append(rules, m.Msg)
+		}
+		docs = append(docs, ai.Document{
+			ID:    ID(KindLog, r.ID),
+			Title: fmt.Sprintf("%s %s request from %s", r.Status, r.AttackType, r.IPAddress),
+			Text: fmt.Sprintf("%s %s at %s, risk %d, country %s, AS %s. Rules: %s",
+				r.Method, r.Path, r.CreatedAt.UTC().Format(time.RFC3339), r.RiskScore, r.Country, r.ASOrg, strings.Join(rules, "; ")),
+			Time: r.CreatedAt,
+		})
+	}
+	return docs, nil
+}
+
+func (ix *Indexer) blockedIPs() ([]ai.Document, error) {
+	var rows []models.BlockedIP
+	if err := ix.db.Order("id DESC").Limit(ix.MaxDocs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	docs := make([]ai.Document, 0, len(rows))
+	for _, r := range rows {
+		action := r.Action
+		if action == "" {
+			action = models.IPActionBlock
+		}
+		expiry := "never expires"
+		if r.ExpiresAt != nil {
+			expiry = "expires " + r.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		docs = append(docs, ai.Document{
+			ID:    ID(KindBlockedIP, r.ID),
+			Title: fmt.Sprintf("IP %s: %s", action, r.IPAddress),
+			Text: fmt.Sprintf("Reason: %s. Added by %s at %s, %s",
+				r.Reason, r.BlockedBy, r.CreatedAt.UTC().Format(time.RFC3339), expiry),
+			Time: r.CreatedAt,
+		})
+	}
+	return docs, nil
+}
+
+func (ix *Indexer) standards() ([]ai.Document, error) {
+	var rows []models.ComplianceStandard
+	if err := ix.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	docs := make([]ai.Document, 0, len(rows))
+	for _, r := range rows {
+		docs = append(docs, ai.Document{
+			ID:    ID(KindStandard, r.ID),
+			Title: fmt.Sprintf("%s compliance: %s", r.Name, r.Status),
+			Text:  fmt.Sprintf("%s. Score %d, last audit %s", r.Description, r.Score, r.LastAudit.UTC().Format("2006-01-02")),
+			Time:  r.LastAudit,
+		})
+	}
+	return docs, nil
+}
+
+func controls() ([]ai.Document, error) {
+	var docs []ai.Document
+	for _, c := range compliance.Controls() {
+		applies := "vulnerabilities without a specific mapping"
+		if len(c.Categories) > 0 {
+			applies = strings.Join(c.Categories, ", ") + " vulnerabilities"
+		}
+		docs = append(docs, ai.Document{
+			ID:    ControlID(string(c.Standard), c.Control.ID),
+			Title: fmt.Sprintf("%s control %s: %s", c.Standard, c.Control.ID, c.Control.Description),
+			Text:  "Mapped to " + applies,
+		})
+	}
+	return docs, nil
+}
+
+func (ix *Indexer) playbookDocs() ([]ai.Document, error) {
+	if ix.playbooks == nil {
+		return nil, nil
+	}
+	var docs []ai.Document
+	for _, pb := range ix.playbooks.GetPlaybooks() {
+		var actions []string
+		for _, a := range pb.Actions {
+			actions = append(actions, string(a.Type))
+		}
+		state := "disabled"
+		if pb.Enabled {
+			state = "enabled"
+		}
+		doc := ai.Document{
+			ID:    ID(KindPlaybook, pb.ID),
+			Title: fmt.Sprintf("Playbook %s (%s)", pb.Name, state),
+			Text:  fmt.Sprintf("%s Trigger %s, actions %s", pb.Description, pb.Trigger, strings.Join(actions, ", ")),
+		}
+		if pb.LastRun != nil {
+			doc.Time = *pb.LastRun
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// ID formats the ID of a record, e.g. finding:42
+func ID(kind string, id any) string {
+	return fmt.Sprintf("%s:%v", kind, id)
+}
+
+// ControlID identifies a control without spaces, e.g.
+// control:PCI-DSS:6.5.1
+func ControlID(standard, control string) string {
+	return KindControl + ":" + slug(standard) + ":" + slug(control)
+}
+
+func slug(s string) string {
+	var sb strings.Builder
+	dash := false
+	// "Art. 32" becomes Art-32
+	for _, r := range strings.ReplaceAll(s, ". ", " ") {
+		if r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return strings.TrimRight(sb.String(), ".")
+}
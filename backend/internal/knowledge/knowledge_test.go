@@ -0,0 +1,138 @@
+package knowledge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/automation"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/scanner"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type playbookList []automation.Playbook
+
+func (p playbookList) GetPlaybooks() []automation.Playbook { return p }
+
+func newTestDB(t *testing.T, now time.Time) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&scanner.ScanResult{}, &scanner.Vuln{}, &models.SecurityLog{}, &models.BlockedIP{},
+		&models.CloudResource{}, &models.ComplianceStandard{}))
+
+	require.NoError(t, db.Create(&[]scanner.ScanResult{
+		{ScanID: "s1", Target: "https://api.example.com", Type: "ZAP", Status: "Completed", CreatedAt: now.Add(-48 * time.Hour)},
+		{ScanID: "s2", Target: "https://www.example.com", Type: "ZAP", Status: "Completed", CreatedAt: now.Add(-2 * time.Hour)},
+	}).Error)
+	require.NoError(t, db.Create(&[]scanner.Vuln{
+		{ID: 1, ScanID: "s1", Title: "SQL Injection", Description: "login form", Severity: "High", Category: "DAST"},
+		{ID: 2, ScanID: "s2", Title: "SQL Injection", Description: "search", Severity: "High", Category: "DAST"},
+		{ID: 3, ScanID: "s1", Title: "Missing CSP header", Severity: "Low", Category: "DAST"},
+	}).Error)
+	require.NoError(t, db.Create(&[]models.BlockedIP{
+		{IPAddress: "203.0.113.9", Action: models.IPActionBlock, Reason: "Brute force", BlockedBy: "System", CreatedAt: now.Add(-10 * time.Hour)},
+		{IPAddress: "198.51.100.0/24", Action: models.IPActionBlock, Reason: "Scanner", BlockedBy: "Admin", CreatedAt: now.Add(-72 * time.Hour)},
+	}).Error)
+	require.NoError(t, db.Create(&[]models.SecurityLog{
+		{IPAddress: "203.0.113.9", Method: "POST", Path: "/login", Payload: "password=hunter2", AttackType: "Brute Force", Status: "Blocked", RiskScore: 80, CreatedAt: now.Add(-10 * time.Hour)},
+		{IPAddress: "192.0.2.1", Method: "GET", Path: "/", AttackType: "None", Status: "Logged", CreatedAt: now.Add(-1 * time.Hour)},
+	}).Error)
+	require.NoError(t, db.Create(&models.CloudResource{Provider: "GCP", Service: "Cloud Storage", ResourceID: "gcp-bucket-logs", Status: "Active"}).Error)
+	require.NoError(t, db.Create(&models.ComplianceStandard{Name: "PCI DSS", Description: "Payment Card Industry", Status: "Compliant"}).Error)
+	return db
+}
+
+func TestIndexer_Refresh(t *testing.T) {
+	now := time.Now()
+	db := newTestDB(t, now)
+	index := ai.NewIndex()
+	ix := NewIndexer(db, index, playbookList{{ID: "pb-001", Name: "Block Malicious IPs", Trigger: "HighThreatScore"}})
+	require.NoError(t, ix.Refresh())
+
+	assert.Equal(t, map[string]int{
+		KindFinding: 3, KindScan: 2, KindCloud: 1, KindLog: 1, KindBlockedIP: 2,
+		KindStandard: 1, KindControl: len(controlsOrFail(t)), KindPlaybook: 1,
+	}, index.Len(), "unflagged requests are not indexed")
+
+	hits := index.Search("SQL injection api.example.com", 1)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "finding:1", hits[0].ID)
+
+	hits = index.Search("PCI DSS injection flaws", 1, KindControl)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "control:PCI-DSS:6.5.1", hits[0].ID)
+
+	hits = index.Search("gcp-bucket-logs", 1)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "cloud:gcp-bucket-logs", hits[0].ID)
+}
+
+func controlsOrFail(t *testing.T) []ai.Document {
+	docs, err := controls()
+	require.NoError(t, err)
+	return docs
+}
+
+func runTool(t *testing.T, tools []ai.Tool, name string, args ai.Args) ai.ToolResult {
+	t.Helper()
+	for _, tool := range tools {
+		if tool.Spec.Name == name {
+			result, err := tool.Run(context.Background(), args)
+			require.NoError(t, err)
+			return result
+		}
+	}
+	t.Fatalf("no tool %s", name)
+	return ai.ToolResult{}
+}
+
+func TestTools(t *testing.T) {
+	now := time.Now()
+	db := newTestDB(t, now)
+	index := ai.NewIndex()
+	require.NoError(t, NewIndexer(db, index, nil).Refresh())
+	tools := Tools(db, index, nil)
+
+	// "Which scans found SQLi on api.example.com?"
+	result := runTool(t, tools, "find_findings", ai.Args{"target": "API.example.com", "text": "sql injection"})
+	assert.Equal(t, []string{"finding:1"}, result.Citations)
+	rows := result.Data.([]findingRow)
+	assert.Equal(t, "s1", rows[0].ScanID)
+	assert.Equal(t, "https://api.example.com", rows[0].Target)
+
+	// "Show blocked IPs from last night"
+	result = runTool(t, tools, "list_blocked_ips", ai.Args{"since": "24h", "action": "block"})
+	assert.Equal(t, []string{"blocked_ip:1"}, result.Citations)
+
+	result = runTool(t, tools, "list_security_logs", ai.Args{"ip": "203.0.113.9", "min_risk": float64(50)})
+	require.Equal(t, []string{"log:1"}, result.Citations)
+	assert.Empty(t, result.Data.([]models.SecurityLog)[0].Payload, "request bodies are not returned")
+
+	result = runTool(t, tools, "list_scans", ai.Args{"since": now.Add(-24 * time.Hour).Format(time.RFC3339)})
+	assert.Equal(t, []string{"scan:s2"}, result.Citations)
+
+	result = runTool(t, tools, "search_records", ai.Args{"query": "brute force", "kind": KindBlockedIP})
+	assert.Equal(t, []string{"blocked_ip:1"}, result.Citations)
+
+	for _, tool := range tools {
+		if tool.Spec.Name == "list_scans" {
+			_, err := tool.Run(context.Background(), ai.Args{"since": "last tuesday"})
+			assert.ErrorContains(t, err, "since")
+		}
+	}
+}
+
+func TestControlID(t *testing.T) {
+	assert.Equal(t, "control:GDPR:Art-32", ControlID("GDPR", "Art. 32"))
+	assert.Equal(t, "control:ISO-27001:A.14.1.2", ControlID("ISO 27001", "A.14.1.2"))
+}
@@ -0,0 +1,298 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/scanner"
+	"gorm.io/gorm"
+)
+
+// Rows returned by a tool call, at most
+const maxRows = 50
+
+var (
+	sinceParam = ai.Param{Name: "since", Type: "string", Description: "Start of the time range: RFC 3339 time, date (2006-01-02) or duration before now (12h)"}
+	untilParam = ai.Param{Name: "until", Type: "string", Description: "End of the time range, in the same formats as since"}
+	limitParam = ai.Param{Name: "limit", Type: "integer", Description: fmt.Sprintf("Maximum rows, up to %d", maxRows)}
+)
+
+// Tools returns read-only queries over platform records. Each result
+// cites the records it contains.
+func Tools(db *gorm.DB, index ai.Retriever, playbooks PlaybookLister) []ai.Tool {
+	t := &tools{db: db, index: index, playbooks: playbooks, now: time.Now}
+	return []ai.Tool{
+		{Spec: ai.ToolSpec{
+			Name:        "search_records",
+			Description: "Full-text search over findings, scans, cloud resources, recent flagged requests, blocklist entries, compliance standards and controls, and playbooks",
+			Params: []ai.Param{
+				{Name: "query", Type: "string", Description: "Search terms", Required: true},
+				{Name: "kind", Type: "string", Description: "Only return records of this kind",
+					Enum: []string{KindFinding, KindScan, KindCloud, KindLog, KindBlockedIP, KindStandard, KindControl, KindPlaybook}},
+				limitParam,
+			},
+		}, Run: t.searchRecords},
+		{Spec: ai.ToolSpec{
+			Name:        "find_findings",
+			Description: "List vulnerabilities found by scans, newest first, with the scan and target",
+			Params: []ai.Param{
+				{Name: "target", Type: "string", Description: "Scanned target or part of it, e.g. api.example.com"},
+				{Name: "text", Type: "string", Description: "Text in the title, description or category, e.g. SQL Injection"},
+				{Name: "severity", Type: "string", Enum: []string{"Critical", "High", "Medium", "Low", "Info"}},
+				{Name: "category", Type: "string", Description: "e.g. SCA, SAST, DAST"},
+				sinceParam, untilParam, limitParam,
+			},
+		}, Run: t.findFindings},
+		{Spec: ai.ToolSpec{
+			Name:        "list_scans",
+			Description: "List scans, newest first, with their number of findings",
+			Params: []ai.Param{
+				{Name: "target", Type: "string", Description: "Scanned target or part of it"},
+				{Name: "status", Type: "string", Description: "e.g. Running, Completed, Failed"},
+				sinceParam, untilParam, limitParam,
+			},
+		}, Run: t.listScans},
+		{Spec: ai.ToolSpec{
+			Name:        "list_blocked_ips",
+			Description: "List blocklist and allowlist entries added in a time range, newest first",
+			Params: []ai.Param{
+				{Name: "action", Type: "string", Enum: []string{models.IPActionBlock, models.IPActionAllow}},
+				{Name: "ip", Type: "string", Description: "Address or prefix, or part of it"},
+				sinceParam, untilParam, limitParam,
+			},
+		}, Run: t.listBlockedIPs},
+		{Spec: ai.ToolSpec{
+			Name:        "list_security_logs",
+			Description: "List requests recorded by the WAF and monitor, newest first",
+			Params: []ai.Param{
+				{Name: "ip", Type: "string", Description: "Client IP address"},
+				{Name: "attack_type", Type: "string", Description: "e.g. SQLi, XSS, Brute Force"},
+				{Name: "status", Type: "string", Enum: []string{"Blocked", "Detected", "Logged", "Resolved", "False Positive"}},
+				{Name: "min_risk", Type: "integer", Description: "Minimum risk score"},
+				sinceParam, untilParam, limitParam,
+			},
+		}, Run: t.listSecurityLogs},
+		{Spec: ai.ToolSpec{
+			Name:        "list_cloud_resources",
+			Description: "List discovered cloud resources",
+			Params: []ai.Param{
+				{Name: "provider", Type: "string", Enum: []string{"AWS", "Azure", "GCP"}},
+				{Name: "service", Type: "string", Description: "e.g. S3, Virtual Machine"},
+				{Name: "status", Type: "string"},
+				limitParam,
+			},
+		}, Run: t.listCloudResources},
+		{Spec: ai.ToolSpec{
+			Name:        "list_playbooks",
+			Description: "List automation playbooks with their triggers, actions and last run",
+		}, Run: t.listPlaybooks},
+	}
+}
+
+type tools struct {
+	db        *gorm.DB
+	index     ai.Retriever
+	playbooks PlaybookLister
+	now       func() time.Time
+}
+
+func limit(args ai.Args) int {
+	n := args.Int("limit", 20)
+	if n <= 0 || n > maxRows {
+		return maxRows
+	}
+	return n
+}
+
+// timeRange filters column by the since and until arguments
+func (t *tools) timeRange(q *gorm.DB, args ai.Args, column string) (*gorm.DB, error) {
+	now := t.now()
+	if since, ok, err := args.Time("since", now); err != nil {
+		return nil, err
+	} else if ok {
+		q = q.Where(column+" >= ?", since)
+	}
+	if until, ok, err := args.Time("until", now); err != nil {
+		return nil, err
+	} else if ok {
+		q = q.Where(column+" <= ?", until)
+	}
+	return q, nil
+}
+
+func like(s string) string {
+	return "%" + strings.ToLower(s) + "%"
+}
+
+func (t *tools) searchRecords(ctx context.Context, args ai.Args) (ai.ToolResult, error) {
+	query := args.String("query")
+	if query == "" {
+		return ai.ToolResult{}, fmt.Errorf("query is required")
+	}
+	var kinds []string
+	if kind := args.String("kind"); kind != "" {
+		kinds = append(kinds, kind)
+	}
+	hits := t.index.Search(query, limit(args), kinds...)
+	result := ai.ToolResult{Data: hits}
+	for _, h := range hits {
+		result.Citations = append(result.Citations, h.ID)
+	}
+	return result, nil
+}
+
+func (t *tools) findFindings(ctx context.Context, args ai.Args) (ai.ToolResult, error) {
+	q := findingsQuery(t.db.WithContext(ctx))
+	if target := args.String("target"); target != "" {
+		q = q.Where("LOWER(scan_results.target) LIKE ?", like(target))
+	}
+	if text := args.String("text"); text != "" {
+		q = q.Where("(LOWER(vulns.title) LIKE ? OR LOWER(vulns.description) LIKE ? OR LOWER(vulns.category) LIKE ?)", like(text), like(text), like(text))
+	}
+	if severity := args.String("severity"); severity != "" {
+		q = q.Where("LOWER(vulns.severity) = ?", strings.ToLower(severity))
+	}
+	if category := args.String("category"); category != "" {
+		q = q.Where("LOWER(vulns.category) = ?", strings.ToLower(category))
+	}
+	q, err := t.timeRange(q, args, "scan_results.created_at")
+	if err != nil {
+		return ai.ToolResult{}, err
+	}
+
+	var rows []findingRow
+	if err := q.Order("vulns.id DESC").Limit(limit(args)).Find(&rows).Error; err != nil {
+		return ai.ToolResult{}, err
+	}
+	result := ai.ToolResult{Data: rows}
+	for _, r := range rows {
+		result.Citations = append(result.Citations, ID(KindFinding, r.ID))
+	}
+	return result, nil
+}
+
+func (t *tools) listScans(ctx context.Context, args ai.Args) (ai.ToolResult, error) {
+	q := t.db.WithContext(ctx).Model(&scanner.ScanResult{}).
+		Select("scan_id, target, type, status, created_at, (SELECT COUNT(*) FROM vulns WHERE vulns.scan_id = scan_results.scan_id) AS findings")
+	if target := args.String("target"); target != "" {
+		q = q.Where("LOWER(target) LIKE ?", like(target))
+	}
+	if status := args.String("status"); status != "" {
+		q = q.Where("LOWER(status) = ?", strings.ToLower(status))
+	}
+	q, err := t.timeRange(q, args, "created_at")
+	if err != nil {
+		return ai.ToolResult{}, err
+	}
+
+	var rows []struct {
+		ScanID    string    `json:"scan_id"`
+		Target    string    `json:"target"`
+		Type      string    `json:"type"`
+		Status    string    `json:"status"`
+		CreatedAt time.Time `json:"created_at"`
+		Findings  int       `json:"findings"`
+	}
+	if err := q.Order("created_at DESC").Limit(limit(args)).Find(&rows).Error; err != nil {
+		return ai.ToolResult{}, err
+	}
+	result := ai.ToolResult{Data: rows}
+	for _, r := range rows {
+		result.Citations = append(result.Citations, ID(KindScan, r.ScanID))
+	}
+	return result, nil
+}
+
+func (t *tools) listBlockedIPs(ctx context.Context, args ai.Args) (ai.ToolResult, error) {
+	q := t.db.WithContext(ctx).Model(&models.BlockedIP{})
+	if action := args.String("action"); action != "" {
+		q = q.Where("action = ?", strings.ToLower(action))
+	}
+	if ip := args.String("ip"); ip != "" {
+		q = q.Where("ip_address LIKE ?", like(ip))
+	}
+	q, err := t.timeRange(q, args, "created_at")
+	if err != nil {
+		return ai.ToolResult{}, err
+	}
+
+	var rows []models.BlockedIP
+	if err := q.Order("created_at DESC").Limit(limit(args)).Find(&rows).Error; err != nil {
+		return ai.ToolResult{}, err
+	}
+	result := ai.ToolResult{Data: rows}
+	for _, r := range rows {
+		result.Citations = append(result.Citations, ID(KindBlockedIP, r.ID))
+	}
+	return result, nil
+}
+
+func (t *tools) listSecurityLogs(ctx context.Context, args ai.Args) (ai.ToolResult, error) {
+	q := t.db.WithContext(ctx).Model(&models.SecurityLog{}).
+		Omit("payload") // Request bodies are not needed to answer and may hold personal data
+	if ip := args.String("ip"); ip != "" {
+		q = q.Where("ip_address = ?", ip)
+	}
+	if attack := args.String("attack_type"); attack != "" {
+		q = q.Where("LOWER(attack_type) LIKE ?", like(attack))
+	}
+	if status := args.String("status"); status != "" {
+		q = q.Where("LOWER(status) = ?", strings.ToLower(status))
+	}
+	if risk := args.Int("min_risk", 0); risk > 0 {
+		q = q.Where("risk_score >= ?", risk)
+	}
+	q, err := t.timeRange(q, args, "created_at")
+	if err != nil {
+		return ai.ToolResult{}, err
+	}
+
+	var rows []models.SecurityLog
+	if err := q.Order("id DESC").Limit(limit(args)).Find(&rows).Error; err != nil {
+		return ai.ToolResult{}, err
+	}
+	result := ai.ToolResult{Data: rows}
+	for _, r := range rows {
+		result.Citations = append(result.Citations, ID(KindLog, r.ID))
+	}
+	return result, nil
+}
+
+func (t *tools) listCloudResources(ctx context.Context, args ai.Args) (ai.ToolResult, error) {
+	q := t.db.WithContext(ctx).Model(&models.CloudResource{})
+	if provider := args.String("provider"); provider != "" {
+		q = q.Where("LOWER(provider) = ?", strings.ToLower(provider))
+	}
+	if service := args.String("service"); service != "" {
+		q = q.Where("LOWER(service) LIKE ?", like(service))
+	}
+	if status := args.String("status"); status != "" {
+		q = q.Where("LOWER(status) = ?", strings.ToLower(status))
+	}
+
+	var rows []models.CloudResource
+	if err := q.Order("id DESC").Limit(limit(args)).Find(&rows).Error; err != nil {
+		return ai.ToolResult{}, err
+	}
+	result := ai.ToolResult{Data: rows}
+	for _, r := range rows {
+		result.Citations = append(result.Citations, ID(KindCloud, r.ResourceID))
+	}
+	return result, nil
+}
+
+func (t *tools) listPlaybooks(ctx context.Context, args ai.Args) (ai.ToolResult, error) {
+	if t.playbooks == nil {
+		return ai.ToolResult{Data: []any{}}, nil
+	}
+	pbs := t.playbooks.GetPlaybooks()
+	result := ai.ToolResult{Data: pbs}
+	for _, pb := range pbs {
+		result.Citations = append(result.Citations, ID(KindPlaybook, pb.ID))
+	}
+	return result, nil
+}
@@ -0,0 +1,339 @@
+package logquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidQuery is wrapped by the errors of queries that are rejected
+var ErrInvalidQuery = errors.New("invalid query")
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+// Operators of a condition
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpIn       = "in"
+	OpContains = "contains"
+	OpPrefix   = "prefix"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpLt       = "lt"
+	OpLte      = "lte"
+)
+
+var comparisons = map[string]string{OpGt: ">", OpGte: ">=", OpLt: "<", OpLte: "<="}
+
+// Condition compares a field with a value. String comparisons ignore
+// case. Value is a list for in.
+type Condition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+}
+
+// Query selects records of one dataset. With GroupBy it counts the
+// records of each combination of values instead of returning them.
+type Query struct {
+	Dataset string      `json:"dataset"`
+	Filters []Condition `json:"filters,omitempty"`
+	// Time range over the dataset's time field: an RFC 3339 time, a date,
+	// or a duration before the query runs such as 24h or 7d
+	Since   string   `json:"since,omitempty"`
+	Until   string   `json:"until,omitempty"`
+	GroupBy []string `json:"group_by,omitempty"`
+	Limit   int      `json:"limit,omitempty"` // Rows or groups, up to 500
+}
+
+// Result holds the rows of a query, newest first, or its groups, largest
+// first. Total counts all matching records, also those past the limit.
+type Result struct {
+	Dataset string           `json:"dataset"`
+	Total   int64            `json:"total"`
+	Rows    []map[string]any `json:"rows,omitempty"`
+	Groups  []Group          `json:"groups,omitempty"`
+}
+
+// Group is the count of one combination of GroupBy values
+type Group struct {
+	Key   map[string]any `json:"key"`
+	Count int64          `json:"count"`
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidQuery, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the query against the schema
+func (q Query) Validate() error {
+	_, err := q.compile(time.Now())
+	return err
+}
+
+// compiled is a validated query with its values converted
+type compiled struct {
+	dataset *Dataset
+	where   []clause
+	groupBy []string
+	limit   int
+}
+
+type clause struct {
+	sql  string
+	args []any
+}
+
+func (q Query) compile(now time.Time) (*compiled, error) {
+	ds, ok := findDataset(q.Dataset)
+	if !ok {
+		return nil, invalid("unknown dataset %q", q.Dataset)
+	}
+	c := &compiled{dataset: ds, limit: q.Limit}
+	if c.limit == 0 {
+		c.limit = defaultLimit
+	}
+	if c.limit < 0 || c.limit > maxLimit {
+		return nil, invalid("limit must be between 1 and %d", maxLimit)
+	}
+
+	for _, cond := range q.Filters {
+		cl, err := compileCondition(ds, cond, now)
+		if err != nil {
+			return nil, err
+		}
+		c.where = append(c.where, cl)
+	}
+	for _, bound := range []struct{ name, value, op string }{{"since", q.Since, ">="}, {"until", q.Until, "<"}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseTime(bound.value, now)
+		if err != nil {
+			return nil, invalid("%s: %v", bound.name, err)
+		}
+		c.where = append(c.where, clause{sql: ds.Time + " " + bound.op + " ?", args: []any{t}})
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range q.GroupBy {
+		f, ok := ds.field(name)
+		if !ok {
+			return nil, invalid("unknown field %q in group_by", name)
+		}
+		if f.Type == TypeTime {
+			return nil, invalid("cannot group by time field %q", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			c.groupBy = append(c.groupBy, name)
+		}
+	}
+	return c, nil
+}
+
+func compileCondition(ds *Dataset, cond Condition, now time.Time) (clause, error) {
+	f, ok := ds.field(cond.Field)
+	if !ok {
+		return clause{}, invalid("unknown field %q", cond.Field)
+	}
+	column := f.Name
+	if f.Type == TypeString {
+		column = "LOWER(" + f.Name + ")"
+	}
+
+	switch cond.Op {
+	case OpEq, OpNe:
+		v, err := convert(f, cond.Value, now)
+		if err != nil {
+			return clause{}, err
+		}
+		op := "="
+		if cond.Op == OpNe {
+			op = "<>"
+		}
+		return clause{sql: column + " " + op + " ?", args: []any{v}}, nil
+	case OpIn:
+		list, ok := cond.Value.([]any)
+		if !ok || len(list) == 0 {
+			return clause{}, invalid("%s: in needs a list of values", f.Name)
+		}
+		values := make([]any, len(list))
+		for i, item := range list {
+			v, err := convert(f, item, now)
+			if err != nil {
+				return clause{}, err
+			}
+			values[i] = v
+		}
+		return clause{sql: column + " IN ?", args: []any{values}}, nil
+	case OpContains, OpPrefix:
+		if f.Type != TypeString {
+			return clause{}, invalid("%s: %s only applies to text", f.Name, cond.Op)
+		}
+		v, err := convert(f, cond.Value, now)
+		if err != nil {
+			return clause{}, err
+		}
+		pattern := escapeLike(v.(string)) + "%"
+		if cond.Op == OpContains {
+			pattern = "%" + pattern
+		}
+		return clause{sql: column + ` LIKE ? ESCAPE '\'`, args: []any{pattern}}, nil
+	case OpGt, OpGte, OpLt, OpLte:
+		if f.Type == TypeString {
+			return clause{}, invalid("%s: %s does not apply to text", f.Name, cond.Op)
+		}
+		v, err := convert(f, cond.Value, now)
+		if err != nil {
+			return clause{}, err
+		}
+		return clause{sql: column + " " + comparisons[cond.Op] + " ?", args: []any{v}}, nil
+	}
+	return clause{}, invalid("%s: unknown operator %q", f.Name, cond.Op)
+}
+
+// convert checks a value against the type of a field. Text is lower-cased
+// to match the LOWER() of the column.
+func convert(f Field, value any, now time.Time) (any, error) {
+	switch f.Type {
+	case TypeString:
+		switch v := value.(type) {
+		case string:
+			return strings.ToLower(v), nil
+		case float64, int:
+			return fmt.Sprint(v), nil
+		}
+	case TypeInteger:
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case int:
+			return int64(v), nil
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	case TypeTime:
+		if s, ok := value.(string); ok {
+			t, err := parseTime(s, now)
+			if err != nil {
+				return nil, invalid("%s: %v", f.Name, err)
+			}
+			return t, nil
+		}
+	}
+	return nil, invalid("%s: expected a %s value, got %v", f.Name, f.Type, value)
+}
+
+// parseTime reads an RFC 3339 time, a date, or a duration before now.
+// Durations may be in days, e.g. 7d.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("expected an RFC 3339 time, a date or a duration such as 24h or 7d, got %q", s)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Engine runs queries read-only. Queries are built from the schema, so
+// the only SQL they produce is a SELECT over the dataset's table with
+// bound values.
+type Engine struct {
+	db  *gorm.DB
+	now func() time.Time
+	// A query is cancelled after Timeout
+	Timeout time.Duration
+}
+
+func NewEngine(db *gorm.DB) *Engine {
+	return &Engine{db: db, now: time.Now, Timeout: 10 * time.Second}
+}
+
+// Run validates and executes a query
+func (e *Engine) Run(ctx context.Context, q Query) (*Result, error) {
+	c, err := q.compile(e.now())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	// Nothing is written, so the transaction is always rolled back
+	tx := e.db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+	if tx.Dialector.Name() == "postgres" {
+		if err := tx.Exec("SET TRANSACTION READ ONLY").Error; err != nil {
+			return nil, err
+		}
+	}
+
+	base := func() *gorm.DB {
+		q := tx.Model(c.dataset.model)
+		for _, cl := range c.where {
+			q = q.Where(cl.sql, cl.args...)
+		}
+		return q
+	}
+
+	result := &Result{Dataset: c.dataset.Name}
+	if err := base().Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	if len(c.groupBy) > 0 {
+		var rows []map[string]any
+		cols := strings.Join(c.groupBy, ", ")
+		err := base().Select(cols + ", COUNT(*) AS count").Group(cols).
+			Order("count DESC").Limit(c.limit).Find(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		result.Groups = make([]Group, len(rows))
+		for i, row := range rows {
+			g := Group{Key: make(map[string]any, len(c.groupBy))}
+			for _, col := range c.groupBy {
+				g.Key[col] = row[col]
+			}
+			g.Count, _ = row["count"].(int64)
+			result.Groups[i] = g
+		}
+		return result, nil
+	}
+
+	err = base().Select(c.dataset.columns()).Order(c.dataset.Time + " DESC").Order("id DESC").
+		Limit(c.limit).Find(&result.Rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
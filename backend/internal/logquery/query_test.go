@@ -0,0 +1,154 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var testNow = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func newTestEngine(t *testing.T) (*Engine, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&models.SecurityLog{}, &models.SimulationEvent{}, &models.CloudTrailAlert{}))
+
+	logs := []models.SecurityLog{
+		{CreatedAt: testNow.Add(-time.Hour), IPAddress: "198.51.100.1", Account: "alice", AttackType: "Credential Attack", Status: "Logged", CountryCode: "RU", RiskScore: 40},
+		{CreatedAt: testNow.Add(-2 * time.Hour), IPAddress: "198.51.100.1", Account: "alice", AttackType: "Credential Attack", Status: "Locked", CountryCode: "RU", RiskScore: 80},
+		{CreatedAt: testNow.Add(-3 * time.Hour), IPAddress: "198.51.100.2", Account: "bob", AttackType: "Credential Attack", Status: "Logged", CountryCode: "RU", RiskScore: 40},
+		{CreatedAt: testNow.Add(-4 * time.Hour), IPAddress: "203.0.113.9", Account: "bob", AttackType: "Credential Attack", Status: "Logged", CountryCode: "DE", RiskScore: 40},
+		{CreatedAt: testNow.Add(-48 * time.Hour), IPAddress: "198.51.100.1", Account: "carol", AttackType: "Credential Attack", Status: "Logged", CountryCode: "RU", RiskScore: 40},
+		{CreatedAt: testNow.Add(-5 * time.Hour), IPAddress: "198.51.100.3", Path: "/api/v1/search", AttackType: "SQL Injection", Status: "Blocked", CountryCode: "RU", RiskScore: 95},
+	}
+	require.NoError(t, db.Create(&logs).Error)
+	require.NoError(t, db.Create(&models.CloudTrailAlert{
+		EventTime: testNow.Add(-time.Hour), EventName: "StopLogging", Actor: "arn:aws:iam::1:user/mallory", Severity: "Critical",
+	}).Error)
+
+	e := NewEngine(db)
+	e.now = func() time.Time { return testNow }
+	return e, db
+}
+
+func TestRun_GroupBy(t *testing.T) {
+	e, _ := newTestEngine(t)
+
+	// Failed logins from Russia in the last 24 hours grouped by user
+	res, err := e.Run(context.Background(), Query{
+		Dataset: "security_logs",
+		Filters: []Condition{
+			{Field: "attack_type", Op: OpEq, Value: "credential attack"},
+			{Field: "country_code", Op: OpEq, Value: "RU"},
+		},
+		Since:   "24h",
+		GroupBy: []string{"account"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Total)
+	assert.Equal(t, []Group{
+		{Key: map[string]any{"account": "alice"}, Count: 2},
+		{Key: map[string]any{"account": "bob"}, Count: 1},
+	}, res.Groups)
+	assert.Empty(t, res.Rows)
+}
+
+func TestRun_Rows(t *testing.T) {
+	e, _ := newTestEngine(t)
+
+	res, err := e.Run(context.Background(), Query{
+		Dataset: "security_logs",
+		Filters: []Condition{
+			{Field: "risk_score", Op: OpGte, Value: float64(80)},
+			{Field: "status", Op: OpIn, Value: []any{"locked", "Blocked"}},
+		},
+		Since: "1d",
+		Limit: 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Total)
+	require.Len(t, res.Rows, 1)
+	// Newest first, without the request payload
+	assert.Equal(t, "Locked", res.Rows[0]["status"])
+	assert.NotContains(t, res.Rows[0], "payload")
+
+	res, err = e.Run(context.Background(), Query{
+		Dataset: "security_logs",
+		Filters: []Condition{{Field: "path", Op: OpPrefix, Value: "/api/v1/"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Total)
+
+	res, err = e.Run(context.Background(), Query{
+		Dataset: "cloudtrail_alerts",
+		Filters: []Condition{{Field: "actor", Op: OpContains, Value: "mallory"}},
+		Until:   "2026-03-10T11:30:00Z",
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, "StopLogging", res.Rows[0]["event_name"])
+}
+
+func TestRun_LikeIsEscaped(t *testing.T) {
+	e, _ := newTestEngine(t)
+
+	res, err := e.Run(context.Background(), Query{
+		Dataset: "security_logs",
+		Filters: []Condition{{Field: "account", Op: OpContains, Value: "%"}},
+	})
+	require.NoError(t, err)
+	assert.Zero(t, res.Total)
+}
+
+func TestRun_Invalid(t *testing.T) {
+	e, db := newTestEngine(t)
+
+	tests := map[string]Query{
+		"dataset":        {Dataset: "users"},
+		"field":          {Dataset: "security_logs", Filters: []Condition{{Field: "payload", Op: OpEq, Value: "x"}}},
+		"injected field": {Dataset: "security_logs", Filters: []Condition{{Field: "1=1; DELETE FROM security_logs; --", Op: OpEq, Value: "x"}}},
+		"operator":       {Dataset: "security_logs", Filters: []Condition{{Field: "status", Op: "like", Value: "x"}}},
+		"type":           {Dataset: "security_logs", Filters: []Condition{{Field: "risk_score", Op: OpGt, Value: "high"}}},
+		"text compare":   {Dataset: "security_logs", Filters: []Condition{{Field: "status", Op: OpGt, Value: "a"}}},
+		"in":             {Dataset: "security_logs", Filters: []Condition{{Field: "status", Op: OpIn, Value: "Blocked"}}},
+		"since":          {Dataset: "security_logs", Since: "yesterday"},
+		"group by":       {Dataset: "security_logs", GroupBy: []string{"created_at"}},
+		"limit":          {Dataset: "security_logs", Limit: 10000},
+	}
+	for name, q := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := e.Run(context.Background(), q)
+			assert.ErrorIs(t, err, ErrInvalidQuery)
+		})
+	}
+
+	var count int64
+	require.NoError(t, db.Model(&models.SecurityLog{}).Count(&count).Error)
+	assert.Equal(t, int64(6), count)
+}
+
+func TestParseTime(t *testing.T) {
+	for s, want := range map[string]time.Time{
+		"24h":                  testNow.Add(-24 * time.Hour),
+		"7d":                   testNow.AddDate(0, 0, -7),
+		"2026-03-01":           time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		"2026-03-01T08:00:00Z": time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC),
+	} {
+		got, err := parseTime(s, testNow)
+		require.NoError(t, err, s)
+		assert.True(t, want.Equal(got), s)
+	}
+	_, err := parseTime("-5h", testNow)
+	assert.Error(t, err)
+}
@@ -0,0 +1,117 @@
+package logquery
+
+import "github.com/cybershield-ai/core/internal/models"
+
+// Types of fields
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeTime    = "time"
+)
+
+// Field is a column that can be filtered, grouped and returned
+type Field struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Values      []string `json:"values,omitempty"` // Common values, not a closed list
+}
+
+// Dataset is a table of logs or events that can be queried
+type Dataset struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Time        string  `json:"time"` // Field the time range applies to
+	Fields      []Field `json:"fields"`
+	model       any
+}
+
+func (d *Dataset) field(name string) (Field, bool) {
+	for _, f := range d.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func (d *Dataset) columns() []string {
+	cols := []string{"id"}
+	for _, f := range d.Fields {
+		cols = append(cols, f.Name)
+	}
+	return cols
+}
+
+// Field names are column names; they are the only identifiers that reach
+// SQL, values are always bound
+var datasets = []Dataset{
+	{
+		Name:        "security_logs",
+		Description: "HTTP requests flagged by the WAF, the request monitor and the login guard. Failed logins have attack_type Credential Attack.",
+		Time:        "created_at",
+		model:       &models.SecurityLog{},
+		Fields: []Field{
+			{Name: "created_at", Type: TypeTime},
+			{Name: "ip_address", Type: TypeString, Description: "Client IP address"},
+			{Name: "method", Type: TypeString},
+			{Name: "path", Type: TypeString},
+			{Name: "account", Type: TypeString, Description: "Account targeted by a login attempt"},
+			{Name: "risk_score", Type: TypeInteger, Description: "0 to 100"},
+			{Name: "attack_type", Type: TypeString, Values: []string{"SQL Injection", "XSS", "Remote Code Execution", "Path Traversal", "Scanner", "Credential Attack", "Geo Policy"}},
+			{Name: "status", Type: TypeString, Values: []string{"Blocked", "Detected", "Logged", "Locked", "Resolved", "False Positive"}},
+			{Name: "rule_ids", Type: TypeString, Description: "Comma separated WAF rule IDs"},
+			{Name: "country_code", Type: TypeString, Description: "ISO 3166 code of the client, e.g. RU"},
+			{Name: "country", Type: TypeString, Description: "English country name"},
+			{Name: "city", Type: TypeString},
+			{Name: "asn", Type: TypeInteger, Description: "Autonomous system number"},
+			{Name: "as_org", Type: TypeString, Description: "Organisation of the autonomous system"},
+		},
+	},
+	{
+		Name:        "simulation_events",
+		Description: "Events of the EDR, red team and other simulation engines",
+		Time:        "timestamp",
+		model:       &models.SimulationEvent{},
+		Fields: []Field{
+			{Name: "timestamp", Type: TypeTime},
+			{Name: "engine", Type: TypeString, Values: []string{"EDR", "APT", "Ransomware", "ITDR", "Insider", "ZeroDay"}},
+			{Name: "event_type", Type: TypeString},
+			{Name: "severity", Type: TypeString, Values: []string{"Critical", "High", "Medium", "Low"}},
+			{Name: "source", Type: TypeString},
+			{Name: "target", Type: TypeString},
+			{Name: "details", Type: TypeString},
+			{Name: "status", Type: TypeString, Values: []string{"Active", "Mitigated"}},
+		},
+	},
+	{
+		Name:        "cloudtrail_alerts",
+		Description: "High-risk AWS API calls reported by CloudTrail",
+		Time:        "event_time",
+		model:       &models.CloudTrailAlert{},
+		Fields: []Field{
+			{Name: "event_time", Type: TypeTime},
+			{Name: "event_name", Type: TypeString, Values: []string{"StopLogging", "AuthorizeSecurityGroupIngress"}},
+			{Name: "event_source", Type: TypeString, Description: "e.g. cloudtrail.amazonaws.com"},
+			{Name: "actor", Type: TypeString, Description: "ARN of the caller"},
+			{Name: "source_ip", Type: TypeString},
+			{Name: "region", Type: TypeString, Description: "AWS region, e.g. us-east-1"},
+			{Name: "severity", Type: TypeString, Values: []string{"Critical", "High", "Medium"}},
+			{Name: "message", Type: TypeString},
+		},
+	},
+}
+
+// Datasets describes the data that can be queried
+func Datasets() []Dataset {
+	return datasets
+}
+
+func findDataset(name string) (*Dataset, bool) {
+	for i := range datasets {
+		if datasets[i].Name == name {
+			return &datasets[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,94 @@
+package logquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validAnswer = "Here is the query:\n```json\n" + `{"query": {"dataset": "security_logs", "filters": [
+  {"field": "attack_type", "op": "eq", "value": "Credential Attack"},
+  {"field": "country_code", "op": "eq", "value": "RU"}], "since": "24h", "group_by": ["account"]},
+ "explanation": "Failed logins from Russia in the last day, counted per account."}` + "\n```"
+
+func newTestTranslator(mock *ai.Mock) *Translator {
+	llm := ai.NewClient()
+	llm.AddProvider(mock, "m")
+	tr := NewTranslator(llm)
+	tr.now = func() time.Time { return testNow }
+	return tr
+}
+
+func TestTranslate(t *testing.T) {
+	mock := ai.NewMock().Reply("failed logins", validAnswer)
+	tr := newTestTranslator(mock)
+
+	question := "failed logins from Russia in the last 24 hours grouped by user"
+	got, err := tr.Translate(context.Background(), question)
+	require.NoError(t, err)
+	assert.Equal(t, question, got.Question)
+	assert.Equal(t, "security_logs", got.Query.Dataset)
+	assert.Equal(t, "24h", got.Query.Since)
+	assert.Equal(t, []string{"account"}, got.Query.GroupBy)
+	assert.Len(t, got.Query.Filters, 2)
+	assert.Contains(t, got.Explanation, "per account")
+
+	reqs := mock.Requests()
+	require.Len(t, reqs, 1)
+	assert.Contains(t, reqs[0].System, "cloudtrail_alerts")
+	assert.Contains(t, reqs[0].System, "2026-03-10T12:00:00Z")
+
+	// The time is given to the hour, so the prompt stays cacheable
+	tr.now = func() time.Time { return testNow.Add(42 * time.Minute) }
+	assert.Equal(t, reqs[0].System, tr.systemPrompt())
+}
+
+func TestTranslate_Retry(t *testing.T) {
+	mock := ai.NewMock().
+		Reply("rejected", validAnswer).
+		Reply("failed logins", `{"query": {"dataset": "logins"}, "explanation": "?"}`)
+	tr := newTestTranslator(mock)
+
+	got, err := tr.Translate(context.Background(), "failed logins from Russia")
+	require.NoError(t, err)
+	assert.Equal(t, "security_logs", got.Query.Dataset)
+
+	reqs := mock.Requests()
+	require.Len(t, reqs, 2)
+	assert.Contains(t, reqs[1].Messages[2].Content, `unknown dataset "logins"`)
+}
+
+func TestTranslate_NoQuery(t *testing.T) {
+	tr := newTestTranslator(ai.NewMock().Reply("weather", "I can only answer questions about logs."))
+
+	_, err := tr.Translate(context.Background(), "what is the weather")
+	assert.ErrorIs(t, err, ErrNoQuery)
+}
+
+func TestTranslate_NotConfigured(t *testing.T) {
+	tr := NewTranslator(nil)
+
+	assert.False(t, tr.Available())
+	_, err := tr.Translate(context.Background(), "failed logins")
+	assert.ErrorIs(t, err, ai.ErrNotConfigured)
+}
+
+func TestSummarize(t *testing.T) {
+	mock := ai.NewMock().Reply("matching records", "alice had 2 failed logins, bob 1.")
+	tr := newTestTranslator(mock)
+
+	summary, err := tr.Summarize(context.Background(), "failed logins by user", Query{Dataset: "security_logs", GroupBy: []string{"account"}}, &Result{
+		Dataset: "security_logs",
+		Total:   3,
+		Groups:  []Group{{Key: map[string]any{"account": "alice"}, Count: 2}, {Key: map[string]any{"account": "bob"}, Count: 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "alice had 2 failed logins, bob 1.", summary)
+	prompt := mock.Requests()[0].Messages[0].Content
+	assert.Contains(t, prompt, "3 matching records")
+	assert.Contains(t, prompt, `"account":"alice"`)
+}
@@ -0,0 +1,116 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a rendered email ready to be delivered
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer delivers mail through a plain SMTP relay (MailHog locally)
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func NewSMTPMailer(host, port, from, username, password string) *SMTPMailer {
+	return &SMTPMailer{
+		Addr:     net.JoinHostPort(host, port),
+		From:     from,
+		Username: username,
+		Password: password,
+	}
+}
+
+// NewFromEnv returns an SMTPMailer when SMTP_HOST is configured and a
+// LogMailer otherwise, so local development never silently drops mail
+func NewFromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		slog.Warn("SMTP_HOST is not set. Emails will be logged instead of sent.")
+		return &LogMailer{ShowBody: os.Getenv("MAIL_LOG_BODIES") == "true"}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "1025"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@cybershield.local"
+	}
+	return NewSMTPMailer(host, port, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid header value")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, m.format(msg))
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("smtp send failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *SMTPMailer) format(msg Message) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + m.From + "\r\n")
+	sb.WriteString("To: " + msg.To + "\r\n")
+	sb.WriteString("Subject: " + msg.Subject + "\r\n")
+	sb.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(sb.String())
+}
+
+// LogMailer writes messages to the structured log instead of sending them
+type LogMailer struct {
+	// ShowBody logs the body too. Bodies carry reset and verification
+	// tokens, so this is for local development only (MAIL_LOG_BODIES=true)
+	ShowBody bool
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if m.ShowBody {
+		slog.Info("Email (not sent, SMTP disabled)", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+	slog.Info("Email (not sent, SMTP disabled)", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
@@ -0,0 +1,124 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpSink is a tiny MailHog-style SMTP server that captures one message
+type smtpSink struct {
+	ln       net.Listener
+	messages chan string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	sink := &smtpSink{ln: ln, messages: make(chan string, 1)}
+	go sink.serve()
+	t.Cleanup(func() { ln.Close() })
+	return sink
+}
+
+func (s *smtpSink) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 sink ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.messages <- data.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	sink := newSMTPSink(t)
+	host, port, _ := net.SplitHostPort(sink.ln.Addr().String())
+	m := NewSMTPMailer(host, port, "no-reply@cybershield.local", "", "")
+
+	msg, err := Render(TemplatePasswordReset, "analyst@example.com", map[string]string{
+		"Name":      "Jane",
+		"Link":      "http://localhost/reset-password?token=abc",
+		"ExpiresIn": "30 minutes",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, m.Send(context.Background(), msg))
+
+	select {
+	case raw := <-sink.messages:
+		assert.Contains(t, raw, "To: analyst@example.com")
+		assert.Contains(t, raw, "Subject: Reset your CyberShield password")
+		assert.Contains(t, raw, "http://localhost/reset-password?token=abc")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received by SMTP sink")
+	}
+}
+
+func TestSMTPMailer_RejectsHeaderInjection(t *testing.T) {
+	m := NewSMTPMailer("127.0.0.1", "1", "from@example.com", "", "")
+	err := m.Send(context.Background(), Message{To: "a@example.com\r\nBcc: evil@example.com", Subject: "x"})
+	assert.Error(t, err)
+}
+
+func TestLogMailer_HidesBodyByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+
+	msg := Message{To: "alice@example.com", Subject: "Reset your password", Body: "https://app/reset?token=secret"}
+
+	require.NoError(t, (&LogMailer{}).Send(context.Background(), msg))
+	assert.Contains(t, buf.String(), "alice@example.com")
+	assert.Contains(t, buf.String(), "Reset your password")
+	assert.NotContains(t, buf.String(), "secret")
+
+	buf.Reset()
+	require.NoError(t, (&LogMailer{ShowBody: true}).Send(context.Background(), msg))
+	assert.Contains(t, buf.String(), "token=secret")
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+// Template names available to Render
+const (
+	TemplateVerifyEmail     = "verify_email"
+	TemplatePasswordReset   = "password_reset"
+	TemplatePasswordChanged = "password_changed"
+	TemplateAccountLocked   = "account_locked"
+)
+
+// Render builds a Message from the named template. Each template file
+// defines "<name>_subject" and "<name>_body".
+func Render(name, to string, data any) (Message, error) {
+	var subject, body bytes.Buffer
+	if err := templates.ExecuteTemplate(&subject, name+"_subject", data); err != nil {
+		return Message{}, fmt.Errorf("render %s subject: %w", name, err)
+	}
+	if err := templates.ExecuteTemplate(&body, name+"_body", data); err != nil {
+		return Message{}, fmt.Errorf("render %s body: %w", name, err)
+	}
+	return Message{To: to, Subject: subject.String(), Body: body.String()}, nil
+}
@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -19,37 +22,70 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			return
-		}
+// SessionValidator decides whether a correctly signed token is still
+// honoured, e.g. after a password reset revoked earlier sessions
+type SessionValidator interface {
+	ValidateSession(userID string, issuedAt time.Time) error
+}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
-			return
-		}
+// Errors returned by Authenticate; the messages are safe to return to
+// clients
+var (
+	ErrMissingToken   = errors.New("Authorization header required")
+	ErrBearerRequired = errors.New("Bearer token required")
+	ErrInvalidToken   = errors.New("Invalid token")
+	ErrSessionExpired = errors.New("Session expired, please sign in again")
+)
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtSecret, nil
-		})
+// Authenticate verifies the bearer token of r and returns its claims
+func Authenticate(r *http.Request, sessions SessionValidator) (jwt.MapClaims, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, ErrMissingToken
+	}
 
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return nil, ErrBearerRequired
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			c.Set("user_id", claims["user_id"])
-			c.Set("role", claims["role"])
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if sessions != nil {
+		userID, _ := claims["user_id"].(string)
+		var issuedAt time.Time
+		if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+			issuedAt = iat.Time
+		}
+		if err := sessions.ValidateSession(userID, issuedAt); err != nil {
+			return nil, ErrSessionExpired
 		}
+	}
+	return claims, nil
+}
 
+func AuthMiddleware(sessions SessionValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := Authenticate(c.Request, sessions)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set("user_id", claims["user_id"])
+		c.Set("role", claims["role"])
 		c.Next()
 	}
 }
@@ -71,3 +107,16 @@ func RequireRole(requiredRole string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireBearer admits requests presenting a static bearer token, for
+// machine clients such as sensors
+func RequireBearer(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		presented := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing bearer token"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	challengeHeader = "X-Challenge-Solution"
+	clearanceHeader = "X-Challenge-Clearance"
+	clearanceCookie = "cs_clearance"
+
+	challengeTTL = 5 * time.Minute
+	clearanceTTL = time.Hour
+)
+
+// Challenger issues proof-of-work challenges to clients that must prove
+// they are willing to spend CPU before being served. Challenges and
+// clearances are HMAC-signed and bound to the client IP, so no server
+// state is kept.
+//
+// A client receives {"challenge": c, "difficulty": d} and retries with the
+// header "X-Challenge-Solution: c:n", where sha256(c + ":" + n) has at
+// least d leading zero bits. On success the response carries a clearance
+// token (cookie and header) that skips the challenge for an hour.
+type Challenger struct {
+	secret     []byte
+	difficulty int
+	now        func() time.Time
+}
+
+func NewChallenger(secret []byte, difficulty int) *Challenger {
+	if difficulty <= 0 {
+		difficulty = 18
+	}
+	return &Challenger{secret: secret, difficulty: difficulty, now: time.Now}
+}
+
+func (ch *Challenger) Difficulty() int {
+	return ch.difficulty
+}
+
+// sign returns "kind.expiry.nonce.mac"; the ip is covered by the mac but
+// not included in the token
+func (ch *Challenger) sign(kind, ip string, ttl time.Duration) string {
+	nonce := make([]byte, 12)
+	rand.Read(nonce)
+	body := kind + "." + strconv.FormatInt(ch.now().Add(ttl).Unix(), 10) + "." + base64.RawURLEncoding.EncodeToString(nonce)
+	return body + "." + ch.mac(ip, body)
+}
+
+func (ch *Challenger) mac(ip, body string) string {
+	h := hmac.New(sha256.New, ch.secret)
+	h.Write([]byte(ip + "|" + body))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (ch *Challenger) verify(token, kind, ip string) bool {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return false
+	}
+	body, sig := token[:i], token[i+1:]
+	parts := strings.Split(body, ".")
+	if len(parts) != 3 || parts[0] != kind {
+		return false
+	}
+	if !hmac.Equal([]byte(sig), []byte(ch.mac(ip, body))) {
+		return false
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	return err == nil && ch.now().Unix() < expiry
+}
+
+// NewChallenge returns a challenge for ip
+func (ch *Challenger) NewChallenge(ip string) string {
+	return ch.sign("c", ip, challengeTTL)
+}
+
+// Solve brute-forces a challenge. It exists for tests and reference
+// clients; browsers do the same in JavaScript.
+func (ch *Challenger) Solve(challenge string) string {
+	for n := uint64(0); ; n++ {
+		counter := strconv.FormatUint(n, 10)
+		if leadingZeroBits(challenge, counter) >= ch.difficulty {
+			return challenge + ":" + counter
+		}
+	}
+}
+
+// Verify checks a "challenge:counter" solution for ip
+func (ch *Challenger) Verify(solution, ip string) bool {
+	challenge, counter, ok := strings.Cut(solution, ":")
+	if !ok || counter == "" || len(counter) > 20 {
+		return false
+	}
+	return ch.verify(challenge, "c", ip) && leadingZeroBits(challenge, counter) >= ch.difficulty
+}
+
+// NewClearance returns a token proving ip solved a challenge
+func (ch *Challenger) NewClearance(ip string) string {
+	return ch.sign("k", ip, clearanceTTL)
+}
+
+func (ch *Challenger) HasClearance(token, ip string) bool {
+	return token != "" && ch.verify(token, "k", ip)
+}
+
+func leadingZeroBits(challenge, counter string) int {
+	sum := sha256.Sum256([]byte(challenge + ":" + counter))
+	n := 0
+	for i := 0; i < len(sum); i += 8 {
+		word := binary.BigEndian.Uint64(sum[i:])
+		n += bits.LeadingZeros64(word)
+		if word != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// GeoPolicyMiddleware blocks or challenges requests whose source country or
+// ASN has a policy. Monitor endpoints and allowlisted addresses are exempt
+// so administrators cannot lock themselves out.
+func GeoPolicyMiddleware(store *database.MonitorStore, challenger *Challenger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if strings.HasPrefix(c.Request.URL.Path, "/api/v1/monitor") || store.IsIPAllowed(ip) {
+			c.Next()
+			return
+		}
+
+		policy, info := store.GeoPolicyFor(ip)
+		if policy == nil {
+			c.Next()
+			return
+		}
+
+		if policy.Action == models.GeoActionChallenge && challenger != nil {
+			if passChallenge(c, challenger, ip) {
+				c.Next()
+				return
+			}
+		}
+
+		status := "Blocked"
+		if policy.Action == models.GeoActionChallenge {
+			status = "Detected"
+		}
+		store.CreateSecurityLog(&models.SecurityLog{
+			IPAddress:   ip,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			AttackType:  "Geo Policy",
+			Status:      status,
+			Payload:     fmt.Sprintf("%s %s: %s", policy.Kind, policy.Value, policy.Action),
+			CountryCode: info.CountryCode,
+			Country:     info.Country,
+			City:        info.City,
+			ASN:         info.ASN,
+			ASOrg:       info.ASOrg,
+		})
+
+		if policy.Action == models.GeoActionChallenge && challenger != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":      "Challenge required.",
+				"challenge":  challenger.NewChallenge(ip),
+				"difficulty": challenger.Difficulty(),
+				"header":     challengeHeader,
+			})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied from your network or region."})
+	}
+}
+
+// passChallenge accepts a valid clearance or solution, issuing a clearance
+// for the latter
+func passChallenge(c *gin.Context, ch *Challenger, ip string) bool {
+	token := c.GetHeader(clearanceHeader)
+	if token == "" {
+		token, _ = c.Cookie(clearanceCookie)
+	}
+	if ch.HasClearance(token, ip) {
+		return true
+	}
+
+	solution := c.GetHeader(challengeHeader)
+	if solution == "" || !ch.Verify(solution, ip) {
+		return false
+	}
+	clearance := ch.NewClearance(ip)
+	c.Header(clearanceHeader, clearance)
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(clearanceCookie, clearance, int(clearanceTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	return true
+}
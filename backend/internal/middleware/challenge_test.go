@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChallenger_SolveAndClearance(t *testing.T) {
+	ch := NewChallenger([]byte("secret"), 8)
+	challenge := ch.NewChallenge("192.0.2.1")
+
+	solution := ch.Solve(challenge)
+	assert.True(t, ch.Verify(solution, "192.0.2.1"))
+	assert.False(t, ch.Verify(solution, "192.0.2.2"), "challenges are bound to the client IP")
+	assert.False(t, ch.Verify(challenge+":not-a-solution", "192.0.2.1"))
+
+	forged := NewChallenger([]byte("other"), 8).NewChallenge("192.0.2.1")
+	assert.False(t, ch.Verify(ch.Solve(forged), "192.0.2.1"), "challenges must be signed with our secret")
+
+	clearance := ch.NewClearance("192.0.2.1")
+	assert.True(t, ch.HasClearance(clearance, "192.0.2.1"))
+	assert.False(t, ch.HasClearance(clearance, "192.0.2.2"))
+	assert.False(t, ch.HasClearance(challenge, "192.0.2.1"), "a challenge is not a clearance")
+
+	ch.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	assert.False(t, ch.HasClearance(clearance, "192.0.2.1"), "clearances expire")
+	assert.False(t, ch.Verify(solution, "192.0.2.1"), "challenges expire")
+}
@@ -2,50 +2,44 @@ package middleware
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/gateway"
 	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/waf"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-var (
-	sqliPatterns = []string{
-		`(?i)(\%27)|(\')|(\-\-)`,
-		`(?i)((\%27)|(\'))union`,
-		`(?i)exec(\s|\+)+(s|x)p\w+`,
-		`(?i)(or|and)\s+1=1`,
-	}
-	xssPatterns = []string{
-		`(?i)<script.*?>.*?<\/script>`,
-		`(?i)javascript:`,
-		`(?i)on\w+\s*=`,
-	}
-)
-
-func SecurityMiddleware(store *database.MonitorStore) gin.HandlerFunc {
+// SecurityMiddleware blocks requests from blocked IPs and scores every
+// request against the WAF ruleset. Route modes and exclusions come from
+// policies; nil policies enforce block mode everywhere.
+func SecurityMiddleware(store *database.MonitorStore, engine *waf.Engine, policies *waf.PolicyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 
 		// 1. Check if IP is blocked
-		// Allow monitor endpoints to be accessed even if blocked (to allow unblocking)
-		// Also whitelist localhost for development
-		if !strings.HasPrefix(c.Request.URL.Path, "/api/v1/monitor") && ip != "::1" && ip != "127.0.0.1" {
-			blocked, err := store.IsIPBlocked(ip)
-			if err != nil {
-				// Log error but proceed? Or fail safe?
-				// For now, proceed but log error internally if possible
-			}
-			if blocked {
+		// Allow monitor endpoints to be accessed even if blocked (to allow
+		// unblocking); allowlisted ranges such as loopback are never blocked
+		if !strings.HasPrefix(c.Request.URL.Path, "/api/v1/monitor") {
+			if blocked, _ := store.IsIPBlocked(ip); blocked {
 				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied. Your IP is blocked."})
 				return
 			}
 		}
 
+		// Proxied requests are inspected and logged by the gateway, which
+		// applies its own rule toggles
+		if gateway.IsProxyPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
 		// 2. Analyze Request
 		var bodyBytes []byte
 		if c.Request.Body != nil {
@@ -53,36 +47,22 @@ func SecurityMiddleware(store *database.MonitorStore) gin.HandlerFunc {
 			c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes)) // Restore body
 		}
 
-		payload := string(bodyBytes) + c.Request.URL.RawQuery
-		riskScore := 0
-		attackType := "None"
-
-		// Check SQLi
-		for _, pattern := range sqliPatterns {
-			if match, _ := regexp.MatchString(pattern, payload); match {
-				riskScore += 50
-				attackType = "SQL Injection"
-				break
-			}
-		}
-
-		// Check XSS
-		if riskScore == 0 {
-			for _, pattern := range xssPatterns {
-				if match, _ := regexp.MatchString(pattern, payload); match {
-					riskScore += 30
-					attackType = "XSS"
-					break
-				}
-			}
+		payload := store.Redactor().Payload(bodyBytes, c.ContentType(), c.Request.URL.RawQuery)
+		req := waf.NewRequest(c.Request, bodyBytes)
+		req.Role = peekRole(c)
+		var policy *waf.Policy
+		if policies != nil {
+			policy = policies.Policy()
 		}
+		result := engine.Inspect(req, policy)
 
 		// 3. Log Request
 		status := "Logged"
-		if riskScore >= 50 {
+		switch result.Action {
+		case waf.ActionDetect:
+			status = "Detected"
+		case waf.ActionBlock:
 			status = "Blocked"
-			// Auto-block high risk
-			store.BlockIP(ip, "High Risk Activity: "+attackType, "System", 24*time.Hour)
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Malicious activity detected."})
 		}
 
@@ -91,16 +71,57 @@ func SecurityMiddleware(store *database.MonitorStore) gin.HandlerFunc {
 			Method:     c.Request.Method,
 			Path:       c.Request.URL.Path,
 			Payload:    payload,
-			RiskScore:  riskScore,
-			AttackType: attackType,
+			RiskScore:  result.Score,
+			AttackType: result.AttackType,
 			Status:     status,
+			RuleIDs:    strings.Join(result.RuleIDs(), ","),
+		}
+		for _, m := range result.Matches {
+			logEntry.Matches = append(logEntry.Matches, models.RuleMatch{
+				RuleID: m.RuleID,
+				Msg:    m.Msg,
+				Target: m.Target,
+				Value:  m.Value,
+				Score:  m.Score,
+			})
 		}
 		store.CreateSecurityLog(logEntry)
 
 		if status == "Blocked" {
+			// Auto-block high risk, linked to the request that caused it
+			if !store.IsIPAllowed(ip) {
+				store.BlockIP(ip, "High Risk Activity: "+result.AttackType, "System", 24*time.Hour, logEntry.ID)
+			}
 			return
 		}
 
 		c.Next()
 	}
 }
+
+// peekClaims returns the claims of a valid bearer token without enforcing
+// authentication, so exclusions and rate limits can depend on who is
+// calling. Session revocation is not checked here; AuthMiddleware still
+// does that for protected routes.
+func peekClaims(c *gin.Context) jwt.MapClaims {
+	tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return nil
+	}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return claims
+}
+
+func peekRole(c *gin.Context) string {
+	role, _ := peekClaims(c)["role"].(string)
+	return role
+}
@@ -1,12 +1,12 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
-	"sync"
-	"time"
 
+	"github.com/cybershield-ai/core/internal/gateway"
+	"github.com/cybershield-ai/core/internal/ratelimit"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
 )
 
 // SecurityHeaders adds common security headers to responses
@@ -28,62 +28,41 @@ func SecurityHeaders() gin.HandlerFunc {
 	}
 }
 
-// IPRateLimiter implements a rate limiter based on IP address
-type IPRateLimiter struct {
-	ips map[string]*rate.Limiter
-	mu  sync.RWMutex
-	r   rate.Limit
-	b   int
-}
-
-// NewIPRateLimiter creates a new IP rate limiter
-func NewIPRateLimiter(r rate.Limit, b int) *IPRateLimiter {
-	i := &IPRateLimiter{
-		ips: make(map[string]*rate.Limiter),
-		r:   r,
-		b:   b,
-	}
-
-	// Cleanup old entries periodically
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			i.mu.Lock()
-			// In a real implementation, we'd track last access time and cleanup
-			// For now, we just reset the map to avoid memory leaks in this simple version
-			if len(i.ips) > 10000 {
-				i.ips = make(map[string]*rate.Limiter)
-			}
-			i.mu.Unlock()
+// RateLimitMiddleware enforces the enabled RateLimit gateway rules. Every
+// matching rule is checked; the request is rejected when any of them is
+// exhausted, and the RateLimit-* headers describe the most constrained
+// one. Rules scoped to users or API keys skip anonymous requests.
+func RateLimitMiddleware(limiter ratelimit.Limiter, gw *gateway.APIGateway) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Proxied requests are limited by the gateway itself
+		if gateway.IsProxyPath(c.Request.URL.Path) {
+			c.Next()
+			return
 		}
-	}()
-
-	return i
-}
-
-// GetLimiter returns the rate limiter for the provided IP address
-func (i *IPRateLimiter) GetLimiter(ip string) *rate.Limiter {
-	i.mu.Lock()
-	defer i.mu.Unlock()
 
-	limiter, exists := i.ips[ip]
-	if !exists {
-		limiter = rate.NewLimiter(i.r, i.b)
-		i.ips[ip] = limiter
-	}
-
-	return limiter
-}
+		caller := gateway.Caller{
+			IP:     c.ClientIP(),
+			APIKey: c.GetHeader("X-API-Key"),
+			Route:  c.FullPath(),
+		}
+		if userID, ok := peekClaims(c)["user_id"]; ok {
+			caller.UserID = fmt.Sprint(userID)
+		}
+		if caller.Route == "" {
+			caller.Route = c.Request.URL.Path
+		}
 
-// RateLimitMiddleware creates a middleware for rate limiting
-func RateLimitMiddleware(limit rate.Limit, burst int) gin.HandlerFunc {
-	limiter := NewIPRateLimiter(limit, burst)
+		res, rule := gw.CheckRateLimits(c.Request.Context(), limiter, c.Request.URL.Path, caller)
+		if res == nil {
+			c.Next()
+			return
+		}
 
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if !limiter.GetLimiter(ip).Allow() {
+		gateway.SetRateLimitHeaders(c.Writer.Header(), res)
+		if !res.Allowed {
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"error": "Too many requests",
+				"rule":  rule.Name,
 			})
 			return
 		}
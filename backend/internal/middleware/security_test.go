@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cybershield-ai/core/internal/gateway"
+	"github.com/cybershield-ai/core/internal/models"
+	"github.com/cybershield-ai/core/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRateLimitMiddleware_GatewayRules(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&models.GatewayRule{}, &models.GatewayUpstream{}, &models.GatewayRoute{}))
+
+	gw := gateway.NewAPIGateway(db)
+	require.Len(t, gw.RateLimits(), 1, "the seeded global rule is enforced")
+	require.NoError(t, gw.CreateRule(&models.GatewayRule{
+		Name: "Scan quota", Type: "RateLimit", Enabled: true,
+		Threshold: 2, Window: 60, Scope: gateway.ScopeAPIKey, Route: "/api/v1/scan",
+	}))
+	assert.Error(t, gw.CreateRule(&models.GatewayRule{Name: "bad", Type: "RateLimit", Threshold: 1, Scope: "tenant"}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimitMiddleware(ratelimit.NewMemoryLimiter(), gw))
+	r.GET("/api/v1/scan", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/scan", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("key-a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"), "headers describe the tightest rule")
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+
+	assert.Equal(t, http.StatusOK, do("key-a").Code)
+	w = do("key-a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// Another key has its own quota; requests without a key only count
+	// against the per-IP rule
+	assert.Equal(t, http.StatusOK, do("key-b").Code)
+	w = do("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1000", w.Header().Get("RateLimit-Limit"))
+}
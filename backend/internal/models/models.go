@@ -40,6 +40,20 @@ type CloudResource struct {
 	LastScanned time.Time
 }
 
+// CloudTrailAlert is a high-risk AWS API call reported by CloudTrail
+type CloudTrailAlert struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	EventTime   time.Time `json:"event_time" gorm:"index"`
+	EventName   string    `json:"event_name" gorm:"index"` // e.g. StopLogging
+	EventSource string    `json:"event_source"`            // e.g. cloudtrail.amazonaws.com
+	Actor       string    `json:"actor" gorm:"index"`      // ARN of the caller
+	SourceIP    string    `json:"source_ip,omitempty"`
+	Region      string    `json:"region,omitempty"`
+	Severity    string    `json:"severity" gorm:"index"` // Critical, High, Medium
+	Message     string    `json:"message"`
+}
+
 // SimulationEvent represents a dynamic event for Red Hat engines (APT, Quantum, etc.)
 type SimulationEvent struct {
 	gorm.Model
@@ -111,7 +125,35 @@ type GatewayRule struct {
 	Name      string `json:"name"`
 	Type      string `json:"type"` // RateLimit, AuthCheck, SQLInjection
 	Enabled   bool   `json:"enabled"`
-	Threshold int    `json:"threshold"`
+	Threshold int    `json:"threshold"` // For RateLimit: requests per window
+
+	// RateLimit settings
+	Scope  string `gorm:"default:ip" json:"scope"`  // ip, user, api_key or route
+	Route  string `json:"route"`                    // Path prefix; empty for all routes
+	Window int    `gorm:"default:60" json:"window"` // Seconds
+	Burst  int    `json:"burst"`                    // Defaults to Threshold
+}
+
+// GatewayUpstream is an internal service the gateway proxies to
+type GatewayUpstream struct {
+	gorm.Model
+	Name    string `gorm:"uniqueIndex" json:"name"`
+	URL     string `json:"url"` // e.g. http://billing.internal:8080
+	Enabled bool   `json:"enabled"`
+}
+
+// GatewayRoute maps a path under the proxy prefix to an upstream
+type GatewayRoute struct {
+	gorm.Model
+	UpstreamID   uint            `json:"upstream_id"`
+	Upstream     GatewayUpstream `json:"upstream,omitempty"`
+	PathPrefix   string          `gorm:"uniqueIndex" json:"path_prefix"` // e.g. /billing
+	StripPrefix  bool            `json:"strip_prefix"`                   // Forward /gw/billing/x as /x
+	Methods      string          `json:"methods"`                        // Comma-separated; empty allows all
+	RequireAuth  bool            `json:"require_auth"`
+	RequiredRole string          `json:"required_role"`
+	Schema       string          `json:"schema"` // JSON Schema for request bodies; empty skips validation
+	Enabled      bool            `json:"enabled"`
 }
 
 // IntegrationConfig represents an external integration
@@ -8,25 +8,74 @@ import (
 
 type SecurityLog struct {
 	ID         uint           `gorm:"primaryKey" json:"id"`
-	CreatedAt  time.Time      `json:"created_at"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"index"`
 	UpdatedAt  time.Time      `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
-	IPAddress  string         `json:"ip_address"`
+	IPAddress  string         `json:"ip_address" gorm:"index"`
 	Method     string         `json:"method"`
+	Account    string         `json:"account,omitempty" gorm:"index"` // Targeted account for credential attacks
 	Path       string         `json:"path"`
 	Payload    string         `json:"payload"` // Request body or query params
 	RiskScore  int            `json:"risk_score"`
-	AttackType string         `json:"attack_type"` // SQLi, XSS, etc.
-	Status     string         `json:"status"`      // Blocked, Logged, Resolved
+	AttackType string         `json:"attack_type" gorm:"index"` // SQLi, XSS, etc.
+	Status     string         `json:"status" gorm:"index"`      // Blocked, Detected, Logged, Resolved, False Positive
+	RuleIDs    string         `json:"rule_ids,omitempty"`       // Comma separated WAF rule IDs that matched
+	Matches    []RuleMatch    `json:"matches,omitempty" gorm:"serializer:json"`
+
+	// GeoIP enrichment, empty when unknown
+	CountryCode string `json:"country_code,omitempty" gorm:"index"`
+	Country     string `json:"country,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty" gorm:"index"`
+	ASOrg       string `json:"as_org,omitempty"`
+}
+
+// RuleMatch is a WAF rule hit recorded on a SecurityLog
+type RuleMatch struct {
+	RuleID string `json:"rule_id"`
+	Msg    string `json:"msg"`
+	Target string `json:"target"` // e.g. ARGS:q, REQUEST_HEADERS:user-agent
+	Value  string `json:"value"`
+	Score  int    `json:"score"`
 }
 
+const (
+	IPActionBlock = "block"
+	IPActionAllow = "allow"
+)
+
+// BlockedIP is a blocklist or allowlist entry for a single address or a
+// CIDR prefix (IPv4 or IPv6). Allow entries take precedence over blocks.
 type BlockedIP struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	IPAddress string         `gorm:"uniqueIndex" json:"ip_address"`
-	Reason    string         `json:"reason"`
-	BlockedBy string         `json:"blocked_by"` // System or Admin
-	ExpiresAt *time.Time     `json:"expires_at"` // Null for permanent
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	IPAddress    string         `gorm:"uniqueIndex" json:"ip_address"`     // Address or CIDR, e.g. 203.0.113.0/24
+	Action       string         `gorm:"default:block;index" json:"action"` // block or allow
+	Reason       string         `json:"reason"`
+	BlockedBy    string         `json:"blocked_by"`                                                // System or Admin
+	ExpiresAt    *time.Time     `json:"expires_at" gorm:"index"`                                   // Null for permanent
+	SecurityLogs []SecurityLog  `gorm:"many2many:blocked_ip_logs;" json:"security_logs,omitempty"` // Requests that triggered the block
+}
+
+const (
+	GeoPolicyCountry = "country"
+	GeoPolicyASN     = "asn"
+
+	GeoActionBlock     = "block"
+	GeoActionChallenge = "challenge"
+)
+
+// GeoPolicy blocks or challenges traffic from a country or autonomous
+// system
+type GeoPolicy struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Kind      string    `gorm:"uniqueIndex:idx_geo_policy" json:"kind"`  // country or asn
+	Value     string    `gorm:"uniqueIndex:idx_geo_policy" json:"value"` // ISO country code or AS number
+	Action    string    `json:"action"`                                  // block or challenge
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
 }
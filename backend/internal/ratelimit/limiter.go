@@ -0,0 +1,231 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Limit allows Rate requests per Period with bursts of up to Burst
+// requests. With Burst equal to Rate this behaves like a sliding window.
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// interval is the time one request's worth of capacity takes to come
+// back. It is at least a nanosecond so gcra never divides by zero.
+func (l Limit) interval() time.Duration {
+	if l.Rate <= 0 {
+		return max(l.Period, 1)
+	}
+	return max(l.Period/time.Duration(l.Rate), 1)
+}
+
+// Result describes the state of a key after a request
+type Result struct {
+	Allowed    bool
+	Limit      Limit
+	Remaining  int
+	RetryAfter time.Duration // Zero when allowed
+	ResetAfter time.Duration // Until the key is back to a full burst
+}
+
+// Limiter counts requests against a limit per key
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// gcra is the generic cell rate algorithm. tat is the theoretical arrival
+// time of the next request; a request is allowed while tat stays within
+// burst intervals of now.
+func gcra(now, tat time.Time, limit Limit) (Result, time.Time) {
+	interval := limit.interval()
+	if tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(interval)
+	allowAt := newTAT.Add(-interval * time.Duration(limit.burst()))
+
+	if now.Before(allowAt) {
+		return Result{
+			Limit:      limit,
+			RetryAfter: allowAt.Sub(now),
+			ResetAfter: tat.Sub(now),
+		}, tat
+	}
+	return Result{
+		Allowed:    true,
+		Limit:      limit,
+		Remaining:  int(now.Sub(allowAt) / interval),
+		ResetAfter: newTAT.Sub(now),
+	}, newTAT
+}
+
+// MemoryLimiter keeps state in process. It is used when Redis is not
+// available, and limits are then per replica.
+type MemoryLimiter struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+	now  func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{tats: make(map[string]time.Time), now: time.Now}
+}
+
+func (m *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res, tat := gcra(m.now(), m.tats[key], limit)
+	m.tats[key] = tat
+	return res, nil
+}
+
+// Sweep forgets keys that are back to a full burst, which is the same as
+// never having been seen
+func (m *MemoryLimiter) Sweep() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	n := 0
+	for key, tat := range m.tats {
+		if !tat.After(now) {
+			delete(m.tats, key)
+			n++
+		}
+	}
+	return n
+}
+
+// StartSweeper runs Sweep in the background
+func (m *MemoryLimiter) StartSweeper(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			m.Sweep()
+		}
+	}()
+}
+
+// gcraScript runs the same algorithm atomically in Redis. Times are in
+// microseconds taken from the Redis clock, so replicas with skewed clocks
+// still agree.
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local interval = math.max(tonumber(ARGV[2]), 1)
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = tonumber(redis.call("GET", key) or now)
+if tat < now then
+	tat = now
+end
+local new_tat = tat + interval
+local allow_at = new_tat - interval * burst
+
+if now < allow_at then
+	return {0, 0, allow_at - now, tat - now}
+end
+
+local reset_after = new_tat - now
+redis.call("SET", key, new_tat, "PX", math.ceil(reset_after / 1000))
+return {1, math.floor((now - allow_at) / interval), 0, reset_after}
+`)
+
+// RedisLimiter shares limits between replicas through Redis
+type RedisLimiter struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+func NewRedisLimiter(rdb redis.UniversalClient) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb, prefix: "ratelimit:"}
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	interval := limit.interval().Microseconds()
+	if interval <= 0 {
+		interval = 1
+	}
+	values, err := gcraScript.Run(ctx, r.rdb, []string{r.prefix + key}, limit.burst(), interval).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("unexpected rate limit script result: %v", values)
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		ResetAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
+
+// FallbackLimiter uses Primary and switches to Secondary while Primary
+// returns errors, so a Redis outage degrades to per-replica limits instead
+// of failing requests
+type FallbackLimiter struct {
+	Primary   Limiter
+	Secondary Limiter
+
+	mu       sync.Mutex
+	failedAt time.Time
+}
+
+// Time to wait before retrying the primary after a failure
+const fallbackBackoff = 10 * time.Second
+
+func (f *FallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	f.mu.Lock()
+	degraded := time.Since(f.failedAt) < fallbackBackoff
+	f.mu.Unlock()
+
+	if !degraded {
+		res, err := f.Primary.Allow(ctx, key, limit)
+		if err == nil {
+			return res, nil
+		}
+		slog.Warn("Rate limiter unavailable, using in-process limits", "error", err)
+		f.mu.Lock()
+		f.failedAt = time.Now()
+		f.mu.Unlock()
+	}
+	return f.Secondary.Allow(ctx, key, limit)
+}
+
+// New returns a Redis-backed limiter that falls back to memory, or a
+// memory limiter when rdb is nil
+func New(rdb *redis.Client) Limiter {
+	mem := NewMemoryLimiter()
+	mem.StartSweeper(time.Minute)
+	if rdb == nil {
+		return mem
+	}
+	return &FallbackLimiter{Primary: NewRedisLimiter(rdb), Secondary: mem}
+}
+
+// Seconds rounds a duration up to whole seconds for response headers
+func Seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
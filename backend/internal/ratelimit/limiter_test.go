@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLimiter_GCRA(t *testing.T) {
+	m := NewMemoryLimiter()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	limit := Limit{Rate: 5, Period: time.Minute}
+	ctx := context.Background()
+
+	for i := 4; i >= 0; i-- {
+		res, err := m.Allow(ctx, "k", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, _ := m.Allow(ctx, "k", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 12*time.Second, res.RetryAfter)
+	assert.Equal(t, time.Minute, res.ResetAfter)
+
+	// Other keys are independent
+	res, _ = m.Allow(ctx, "other", limit)
+	assert.True(t, res.Allowed)
+
+	// One request's worth of capacity comes back per interval
+	now = now.Add(12 * time.Second)
+	res, _ = m.Allow(ctx, "k", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, 2, m.Sweep())
+}
+
+func TestLimiter_HugeRate(t *testing.T) {
+	limit := Limit{Rate: math.MaxInt, Period: time.Second}
+	ctx := context.Background()
+
+	res, err := NewMemoryLimiter().Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	mr := miniredis.RunT(t)
+	res, err = NewRedisLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()})).Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestRedisLimiter_SharedBetweenClients(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := NewRedisLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	b := NewRedisLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	limit := Limit{Rate: 3, Period: time.Minute}
+	ctx := context.Background()
+
+	for _, l := range []*RedisLimiter{a, b, a} {
+		res, err := l.Allow(ctx, "ip:192.0.2.1", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	res, err := b.Allow(ctx, "ip:192.0.2.1", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed, "replicas share one budget")
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+	assert.True(t, mr.Exists("ratelimit:ip:192.0.2.1"))
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	f := &FallbackLimiter{Primary: failingLimiter{}, Secondary: NewMemoryLimiter()}
+	limit := Limit{Rate: 1, Period: time.Minute}
+
+	res, err := f.Allow(context.Background(), "k", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, _ = f.Allow(context.Background(), "k", limit)
+	assert.False(t, res.Allowed, "limits still apply while degraded")
+}
@@ -0,0 +1,291 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Appends the event to the log stream and publishes it with its ID in one
+// step, so every replica receives events in log order
+var publishScript = redis.NewScript(`
+local id = redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'event', ARGV[2])
+redis.call('PUBLISH', KEYS[2], id .. ' ' .. ARGV[2])
+return id
+`)
+
+// Hub fans events out to every replica and keeps a bounded log of them
+// for replay. With Redis, events are appended to a stream and published on
+// a channel every replica subscribes to; without, they are delivered and
+// logged in this process only. Event IDs increase in publish order.
+type Hub struct {
+	rdb     *redis.Client
+	stream  string
+	channel string
+	size    int
+	queue   chan queuedEvent
+
+	mu        sync.Mutex
+	listeners []func(Event)
+	ring      []Event // In-memory log, oldest first
+	trimmed   bool
+	lastID    eventID
+	warned    time.Time
+}
+
+type queuedEvent struct {
+	Event
+	transient bool
+}
+
+// NewHub keeps the last size events. rdb may be nil for a single replica;
+// prefix names the Redis stream and channel.
+func NewHub(rdb *redis.Client, prefix string, size int) *Hub {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Hub{
+		rdb:     rdb,
+		stream:  prefix + ":log",
+		channel: prefix + ":events",
+		size:    size,
+		queue:   make(chan queuedEvent, 1024),
+	}
+}
+
+// Listen registers a function receiving every event, from any replica.
+// It is called in log order and must not block.
+func (h *Hub) Listen(fn func(Event)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// Start subscribes to events from other replicas and starts publishing.
+// It does nothing without Redis, and falls back to the in-memory log when
+// Redis is unreachable. Call it before publishing.
+func (h *Hub) Start() {
+	if h.rdb == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err := h.rdb.Ping(ctx).Err()
+	cancel()
+	if err != nil {
+		slog.Warn("Redis is unreachable, realtime events stay on this replica", "error", err)
+		h.rdb = nil
+		return
+	}
+	go h.publishLoop()
+	go h.receiveLoop()
+}
+
+// Publish sends an event to the listeners of every replica without
+// blocking the caller
+func (h *Hub) Publish(topic, eventType string, data any) {
+	h.publish(topic, eventType, data, false)
+}
+
+// PublishTransient is like Publish, but the event is not logged, so it
+// has no ID and is not replayed. It suits frequent events that are
+// useless later, such as the fragments of a streamed answer.
+func (h *Hub) PublishTransient(topic, eventType string, data any) {
+	h.publish(topic, eventType, data, true)
+}
+
+func (h *Hub) publish(topic, eventType string, data any, transient bool) {
+	event := Event{Topic: topic, Type: eventType, Time: time.Now().UTC(), Data: data}
+	if h.rdb == nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if !transient {
+			event.ID = h.nextID().String()
+			h.ring = append(h.ring, event)
+			if len(h.ring) > h.size {
+				h.ring = h.ring[len(h.ring)-h.size:]
+				h.trimmed = true
+			}
+		}
+		h.emit(event)
+		return
+	}
+
+	select {
+	case h.queue <- queuedEvent{Event: event, transient: transient}:
+	default:
+		h.warn("Realtime publish queue full, dropping event", nil)
+	}
+}
+
+func (h *Hub) publishLoop() {
+	for q := range h.queue {
+		data, err := json.Marshal(q.Event)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if q.transient {
+				// Without an ID; receivers see an empty one
+				err = h.rdb.Publish(ctx, h.channel, " "+string(data)).Err()
+			} else {
+				err = publishScript.Run(ctx, h.rdb, []string{h.stream, h.channel}, h.size, data).Err()
+			}
+			cancel()
+		}
+		if err != nil {
+			// Reach at least the clients of this replica; without an ID the
+			// event cannot be replayed
+			h.warn("Failed to publish realtime event, delivering locally", err)
+			h.mu.Lock()
+			h.emit(q.Event)
+			h.mu.Unlock()
+		}
+	}
+}
+
+func (h *Hub) receiveLoop() {
+	// go-redis resubscribes after reconnecting
+	sub := h.rdb.Subscribe(context.Background(), h.channel)
+	for msg := range sub.Channel() {
+		id, data, ok := strings.Cut(msg.Payload, " ")
+		if !ok {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		event.ID = id
+		h.mu.Lock()
+		h.emit(event)
+		h.mu.Unlock()
+	}
+}
+
+// emit must be called with the mutex held, which keeps listeners in order
+func (h *Hub) emit(event Event) {
+	for _, fn := range h.listeners {
+		fn(event)
+	}
+}
+
+func (h *Hub) warn(msg string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.warned) < time.Minute {
+		return
+	}
+	h.warned = time.Now()
+	slog.Warn(msg, "error", err)
+}
+
+// Since returns logged events published after lastID, oldest first.
+// complete is false when events after lastID have already been dropped
+// from the log, or lastID is not a valid ID.
+func (h *Hub) Since(ctx context.Context, lastID string) (events []Event, complete bool, err error) {
+	after, err := parseEventID(lastID)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	if h.rdb == nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		complete = !h.trimmed || !after.less(parseIDOrZero(h.ring[0].ID))
+		for _, e := range h.ring {
+			if after.less(parseIDOrZero(e.ID)) {
+				events = append(events, e)
+			}
+		}
+		return events, complete, nil
+	}
+
+	first, err := h.rdb.XRangeN(ctx, h.stream, "-", "+", 1).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(first) == 0 {
+		return nil, true, nil
+	}
+	complete = !after.less(parseIDOrZero(first[0].ID))
+
+	msgs, err := h.rdb.XRangeN(ctx, h.stream, after.String(), "+", int64(h.size)*2).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, msg := range msgs {
+		if msg.ID == after.String() {
+			complete = true
+			continue
+		}
+		raw, _ := msg.Values["event"].(string)
+		var e Event
+		if json.Unmarshal([]byte(raw), &e) == nil {
+			e.ID = msg.ID
+			events = append(events, e)
+		}
+	}
+	return events, complete, nil
+}
+
+// CompareIDs orders two event IDs; IDs that do not parse sort first
+func CompareIDs(a, b string) int {
+	x, _ := parseEventID(a)
+	y, _ := parseEventID(b)
+	switch {
+	case x.less(y):
+		return -1
+	case y.less(x):
+		return 1
+	}
+	return 0
+}
+
+// eventID has the form of a Redis stream ID: milliseconds-sequence
+type eventID struct {
+	ms, seq uint64
+}
+
+func (id eventID) String() string { return fmt.Sprintf("%d-%d", id.ms, id.seq) }
+
+func (id eventID) less(o eventID) bool {
+	return id.ms < o.ms || (id.ms == o.ms && id.seq < o.seq)
+}
+
+func parseEventID(s string) (eventID, error) {
+	ms, seq, ok := strings.Cut(s, "-")
+	if !ok {
+		return eventID{}, fmt.Errorf("invalid event ID %q", s)
+	}
+	var id eventID
+	var err error
+	if id.ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return eventID{}, fmt.Errorf("invalid event ID %q", s)
+	}
+	if id.seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+		return eventID{}, fmt.Errorf("invalid event ID %q", s)
+	}
+	return id, nil
+}
+
+// parseIDOrZero is for IDs read back from the log, which are valid
+func parseIDOrZero(s string) eventID {
+	id, _ := parseEventID(s)
+	return id
+}
+
+// nextID must be called with the mutex held. Like Redis it uses the clock,
+// so IDs keep increasing across restarts.
+func (h *Hub) nextID() eventID {
+	id := eventID{ms: uint64(time.Now().UnixMilli())}
+	if !h.lastID.less(id) {
+		id = eventID{ms: h.lastID.ms, seq: h.lastID.seq + 1}
+	}
+	h.lastID = id
+	return id
+}
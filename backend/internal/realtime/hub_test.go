@@ -0,0 +1,105 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type collector struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (c *collector) add(e Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+func (c *collector) get() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.events...)
+}
+
+func TestHub_LocalReplay(t *testing.T) {
+	hub := NewHub(nil, "", 3)
+	var got collector
+	hub.Listen(got.add)
+
+	for i := range 5 {
+		hub.Publish(TopicFindings, "finding.created", i)
+	}
+	events := got.get()
+	require.Len(t, events, 5)
+	for i := 1; i < len(events); i++ {
+		assert.Equal(t, -1, CompareIDs(events[i-1].ID, events[i].ID), "IDs increase in publish order")
+	}
+
+	missed, complete, err := hub.Since(context.Background(), events[2].ID)
+	require.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, events[3:], missed)
+
+	missed, complete, _ = hub.Since(context.Background(), events[0].ID)
+	assert.False(t, complete, "events[1] is no longer logged")
+	assert.Equal(t, events[2:], missed)
+
+	_, complete, _ = hub.Since(context.Background(), "not-an-id")
+	assert.False(t, complete)
+}
+
+func TestHub_FallsBackWhenRedisIsDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	mr.Close()
+
+	hub := NewHub(rdb, "test", 10)
+	hub.Start()
+	var got collector
+	hub.Listen(got.add)
+
+	hub.Publish(TopicFindings, "finding.created", 1)
+	events := got.get()
+	require.Len(t, events, 1, "delivered synchronously from the in-memory log")
+	missed, complete, err := hub.Since(context.Background(), "0-0")
+	require.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, events, missed)
+}
+
+func TestHub_FansOutThroughRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	var hubs []*Hub
+	var got [2]collector
+	for i := range 2 {
+		hub := NewHub(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "test", 100)
+		hub.Listen(got[i].add)
+		hub.Start()
+		hubs = append(hubs, hub)
+	}
+	// Wait for both replicas to subscribe
+	require.Eventually(t, func() bool { return mr.PubSubNumSub("test:events")["test:events"] == 2 }, 2*time.Second, 10*time.Millisecond)
+
+	hubs[0].Publish(ScanTopic("s1"), TypeScanProgress, map[string]any{"progress": 10})
+	hubs[1].Publish(ScanTopic("s1"), TypeScanProgress, map[string]any{"progress": 20})
+	require.Eventually(t, func() bool { return len(got[0].get()) == 2 && len(got[1].get()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, got[0].get(), got[1].get(), "every replica sees the same events in the same order")
+
+	first := got[0].get()[0]
+	assert.NotEmpty(t, first.ID)
+	missed, complete, err := hubs[1].Since(context.Background(), first.ID)
+	require.NoError(t, err)
+	assert.True(t, complete)
+	require.Len(t, missed, 1)
+	second := got[0].get()[1]
+	assert.Equal(t, second.ID, missed[0].ID)
+	assert.Equal(t, second.Data, missed[0].Data)
+}
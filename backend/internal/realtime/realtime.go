@@ -0,0 +1,79 @@
+// Package realtime defines the events pushed to connected clients and the
+// topics they subscribe to. Frequent, transient events are published
+// through Publisher; domain events are forwarded from the event bus. The
+// API delivers both to WebSocket clients.
+package realtime
+
+import (
+	"strings"
+	"time"
+)
+
+// Topics clients can subscribe to
+const (
+	TopicFindings     = "findings"      // New vulnerabilities from any scan
+	TopicSecurityLogs = "security_logs" // Every stored security log
+	TopicSimulation   = "simulation"    // Detections, simulated or real
+	TopicPlaybooks    = "playbooks"     // Playbook runs and their actions
+
+	// Progress of a single scan, see ScanTopic
+	scanTopicPrefix = "scan:"
+	// Messages of a chat conversation, see ChatTopic
+	chatTopicPrefix = "chat:"
+)
+
+// Event types published directly. Domain events from the event bus keep
+// their own type, e.g. finding.created.
+const (
+	TypeScanProgress = "scan.progress"
+	TypeSecurityLog  = "security_log.created"
+	// A fragment of an answer being generated, published transiently
+	TypeChatDelta = "chat.delta"
+	// A message stored in a conversation
+	TypeChatMessage = "chat.message"
+)
+
+// ScanTopic is the topic for progress of one scan
+func ScanTopic(scanID string) string {
+	return scanTopicPrefix + scanID
+}
+
+// ChatTopic is the topic for messages of one conversation. Subscribers
+// must be able to read the conversation.
+func ChatTopic(conversationID string) string {
+	return chatTopicPrefix + conversationID
+}
+
+// ChatConversation returns the conversation of a chat topic
+func ChatConversation(topic string) (string, bool) {
+	return strings.CutPrefix(topic, chatTopicPrefix)
+}
+
+// ValidTopic reports whether topic is well-formed. Chat topics also need
+// the subscriber to be authorised.
+func ValidTopic(topic string) bool {
+	switch topic {
+	case TopicFindings, TopicSecurityLogs, TopicSimulation, TopicPlaybooks:
+		return true
+	}
+	id, ok := strings.CutPrefix(topic, scanTopicPrefix)
+	if !ok {
+		id, ok = strings.CutPrefix(topic, chatTopicPrefix)
+	}
+	return ok && id != "" && len(id) <= 128
+}
+
+// Event is the envelope delivered to subscribers
+type Event struct {
+	ID    string    `json:"id,omitempty"` // Empty when the event could not be logged
+	Topic string    `json:"topic"`
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data"`
+}
+
+// Publisher delivers events to the subscribers of a topic. Publish must
+// not block the caller.
+type Publisher interface {
+	Publish(topic, eventType string, data any)
+}
@@ -0,0 +1,425 @@
+// Package redact masks credentials and other sensitive values in request
+// payloads before they are written to the security log.
+package redact
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mask replaces every redacted value
+const Mask = "[REDACTED]"
+
+// Config selects what is redacted
+type Config struct {
+	// Field names whose values are always masked. Matching ignores case,
+	// "-" and "_", and also hits names containing a key, so "password"
+	// covers "new_password" and "X-Api-Key" matches "apikey".
+	Keys []string
+	// Regular expressions masked wherever they appear. When a pattern has
+	// a group named "v" only that group is masked.
+	Patterns []string
+	// Mask digit runs that pass the Luhn check (payment card numbers)
+	CardNumbers bool
+	// Redacted payloads are truncated to this many bytes; zero keeps them
+	// whole
+	MaxBytes int
+}
+
+// DefaultConfig covers passwords, tokens, API keys, session cookies,
+// private keys and card numbers, and caps payloads at 4 KiB
+func DefaultConfig() Config {
+	return Config{
+		Keys: []string{
+			"password", "passwd", "pwd", "passphrase", "secret", "token",
+			"apikey", "accesskey", "privatekey", "authorization", "cookie",
+			"sessionid", "credential", "mfacode", "cardnumber", "creditcard",
+			"ccnumber", "cvv", "cvc", "ssn",
+		},
+		Patterns: []string{
+			`(?i)\bbearer\s+(?P<v>[A-Za-z0-9._~+/=-]+)`,
+			`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`, // JWT
+			`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,                       // AWS access key ID
+			`\b(?:sk|pk|rk)_(?:live|test)_[0-9A-Za-z]{16,}\b`,     // Stripe
+			`\bsk-[A-Za-z0-9_-]{20,}`,                             // OpenAI style
+			`\bgh[pousr]_[A-Za-z0-9]{36}\b`,                       // GitHub
+			`\bxox[abposr]-[A-Za-z0-9-]{10,}`,                     // Slack
+			`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+		},
+		CardNumbers: true,
+		MaxBytes:    4096,
+	}
+}
+
+// FromEnv extends DefaultConfig with REDACT_KEYS (comma separated) and
+// REDACT_PATTERNS_FILE (one regular expression per line), and reads the
+// payload cap from LOG_MAX_PAYLOAD_BYTES
+func FromEnv() (*Redactor, error) {
+	cfg := DefaultConfig()
+	for _, k := range strings.Split(os.Getenv("REDACT_KEYS"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			cfg.Keys = append(cfg.Keys, k)
+		}
+	}
+	if path := os.Getenv("REDACT_PATTERNS_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				cfg.Patterns = append(cfg.Patterns, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOG_MAX_PAYLOAD_BYTES")); err == nil && n >= 0 {
+		cfg.MaxBytes = n
+	}
+	return New(cfg)
+}
+
+// Redactor applies a Config. It is safe for concurrent use.
+type Redactor struct {
+	keys     []string
+	patterns []*regexp.Regexp
+	// key=value and "key": "value" pairs in text that is not valid JSON or
+	// form data, such as truncated bodies
+	pairs    *regexp.Regexp
+	cards    bool
+	maxBytes int
+}
+
+// Bodies larger than this are not parsed; they are cut to MaxBytes and
+// redacted as text
+const maxParse = 1 << 20
+
+var cardRun = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+func New(cfg Config) (*Redactor, error) {
+	r := &Redactor{cards: cfg.CardNumbers, maxBytes: cfg.MaxBytes}
+	for _, k := range cfg.Keys {
+		if k = normalizeKey(k); k != "" {
+			r.keys = append(r.keys, k)
+		}
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if len(r.keys) > 0 {
+		// Any name matches here; SensitiveKey decides which values to mask
+		r.pairs = regexp.MustCompile(`(?i)("?)([A-Za-z0-9_-]+)("?\s*[:=]\s*)(?P<v>"(?:[^"\\]|\\.)*"?|[^\s&,;}"]+)`)
+	}
+	return r, nil
+}
+
+// Default returns a Redactor for DefaultConfig
+func Default() *Redactor {
+	r, err := New(DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func normalizeKey(k string) string {
+	k = strings.ToLower(k)
+	return strings.NewReplacer("-", "", "_", "", " ", "", ".", "").Replace(k)
+}
+
+// SensitiveKey reports whether values of the field name are masked
+func (r *Redactor) SensitiveKey(name string) bool {
+	n := normalizeKey(name)
+	if n == "" {
+		return false
+	}
+	for _, k := range r.keys {
+		if strings.Contains(n, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload redacts a request body and query string for the security log.
+// JSON and form bodies are masked field by field; anything else is
+// masked by pattern. The result is capped at MaxBytes.
+func (r *Redactor) Payload(body []byte, contentType, rawQuery string) string {
+	var out string
+	switch {
+	case len(body) == 0:
+	case len(body) > maxParse:
+		out = r.Text(string(body[:r.capFor(maxParse)]))
+	case strings.Contains(contentType, "json"):
+		if s, ok := r.json(body); ok {
+			out = s
+		} else {
+			out = r.Text(string(body))
+		}
+	case strings.Contains(contentType, "x-www-form-urlencoded"):
+		out = r.Form(string(body))
+	default:
+		out = r.Text(string(body))
+	}
+	if rawQuery != "" {
+		out += r.Form(rawQuery)
+	}
+	return r.truncate(out)
+}
+
+// Scrub redacts a stored payload whose content type is unknown: a JSON
+// document optionally followed by a query string, form data, or text
+func (r *Redactor) Scrub(payload string) string {
+	if payload == "" {
+		return payload
+	}
+	if len(payload) > maxParse {
+		return r.truncate(r.Text(payload[:r.capFor(maxParse)]))
+	}
+	trimmed := strings.TrimLeft(payload, " \t\r\n")
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		dec := json.NewDecoder(strings.NewReader(trimmed))
+		var v any
+		if dec.Decode(&v) == nil {
+			end := int(dec.InputOffset())
+			if s, ok := r.json([]byte(trimmed[:end])); ok {
+				if rest := trimmed[end:]; rest != "" {
+					s += r.Form(rest)
+				}
+				return r.truncate(s)
+			}
+		}
+	}
+	if looksLikeForm(payload) {
+		return r.truncate(r.Form(payload))
+	}
+	return r.truncate(r.Text(payload))
+}
+
+func (r *Redactor) capFor(n int) int {
+	if r.maxBytes > 0 && r.maxBytes < n {
+		return r.maxBytes
+	}
+	return n
+}
+
+func looksLikeForm(s string) bool {
+	return strings.Contains(s, "=") && !strings.ContainsAny(s, " \t\r\n")
+}
+
+// Text masks pattern matches, card numbers and key=value pairs with
+// sensitive keys
+func (r *Redactor) Text(s string) string {
+	for _, re := range r.patterns {
+		s = maskMatches(re, s)
+	}
+	if r.pairs != nil {
+		s = r.maskPairs(s)
+	}
+	if r.cards {
+		s = cardRun.ReplaceAllStringFunc(s, func(m string) string {
+			if luhn(m) {
+				return Mask
+			}
+			return m
+		})
+	}
+	return s
+}
+
+// maskMatches replaces each match, or only its "v" group when present
+func maskMatches(re *regexp.Regexp, s string) string {
+	group := re.SubexpIndex("v")
+	if group < 0 {
+		return re.ReplaceAllLiteralString(s, Mask)
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(Mask)
+		last = end
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func (r *Redactor) maskPairs(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range r.pairs.FindAllStringSubmatchIndex(s, -1) {
+		if !r.SensitiveKey(s[m[4]:m[5]]) {
+			continue
+		}
+		start, end := m[8], m[9]
+		if s[start:end] == Mask || s[start:end] == `"`+Mask+`"` {
+			continue
+		}
+		b.WriteString(s[last:start])
+		if strings.HasPrefix(s[start:end], `"`) {
+			b.WriteString(`"` + Mask + `"`)
+		} else {
+			b.WriteString(Mask)
+		}
+		last = end
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Form masks the values of sensitive fields in URL-encoded data, keeping
+// the rest as sent so attack payloads stay readable
+func (r *Redactor) Form(s string) string {
+	pairs := strings.Split(s, "&")
+	for i, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			pairs[i] = r.Text(pair)
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if r.SensitiveKey(name) {
+			pairs[i] = key + "=" + Mask
+		} else {
+			pairs[i] = key + "=" + r.Text(value)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// json masks a JSON document. Sensitive fields are replaced whatever their
+// type; other strings are masked by pattern. Documents without anything
+// to mask are returned as sent.
+func (r *Redactor) json(body []byte) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return "", false
+	}
+	v, changed := r.walk(v)
+	if !changed {
+		return string(body), true
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// Keep <script> and friends readable in the log
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+func (r *Redactor) walk(v any) (any, bool) {
+	changed := false
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if r.SensitiveKey(k) {
+				if child != Mask {
+					t[k], changed = Mask, true
+				}
+				continue
+			}
+			var c bool
+			if t[k], c = r.walk(child); c {
+				changed = true
+			}
+		}
+	case []any:
+		for i, child := range t {
+			var c bool
+			if t[i], c = r.walk(child); c {
+				changed = true
+			}
+		}
+	case string:
+		masked := r.Text(t)
+		return masked, masked != t
+	case json.Number:
+		if r.cards && luhn(t.String()) {
+			return Mask, true
+		}
+	}
+	return v, changed
+}
+
+// Value redacts a single value read from the named field, such as a WAF
+// match target like "ARGS:password"
+func (r *Redactor) Value(field, value string) string {
+	if _, key, ok := strings.Cut(field, ":"); ok && r.SensitiveKey(key) {
+		return Mask
+	}
+	return r.truncate(r.Text(value))
+}
+
+func (r *Redactor) truncate(s string) string {
+	if r.maxBytes <= 0 || len(s) <= r.maxBytes {
+		return s
+	}
+	cut := r.maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("...[truncated %d bytes]", len(s)-cut)
+}
+
+// luhn validates the check digit of a card number, ignoring spaces and
+// dashes
+func luhn(s string) bool {
+	sum, n, double := 0, 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
@@ -3,8 +3,10 @@ package redhat
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cybershield-ai/core/internal/events"
 	"github.com/cybershield-ai/core/internal/models"
 	"github.com/shirou/gopsutil/v3/process"
 	"gorm.io/gorm"
@@ -12,6 +14,9 @@ import (
 
 type EDREngine struct {
 	db *gorm.DB
+
+	mu      sync.Mutex
+	emitter events.Emitter
 }
 
 func NewEDREngine(db *gorm.DB) *EDREngine {
@@ -20,6 +25,19 @@ func NewEDREngine(db *gorm.DB) *EDREngine {
 	return e
 }
 
+// SetEmitter emits a detection for every suspicious process found
+func (e *EDREngine) SetEmitter(em events.Emitter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.emitter = em
+}
+
+func (e *EDREngine) getEmitter() events.Emitter {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.emitter
+}
+
 func (e *EDREngine) StartRealMonitoring() {
 	go func() {
 		for {
@@ -57,11 +75,15 @@ func (e *EDREngine) StartRealMonitoring() {
 				}
 
 				if isSuspicious {
+					detection := details
 					// Active Enforcement: Kill the process
+					var remediation string
 					if err := p.Kill(); err == nil {
 						details += " [REMEDIATED: Process Killed]"
+						remediation = "Process killed"
 					} else {
 						details += fmt.Sprintf(" [REMEDIATION FAILED: %v]", err)
+						remediation = fmt.Sprintf("Kill failed: %v", err)
 					}
 
 					event := models.SimulationEvent{
@@ -74,7 +96,9 @@ func (e *EDREngine) StartRealMonitoring() {
 						Status:    "Active",
 						Timestamp: time.Now(),
 					}
-					e.db.Create(&event)
+					if err := e.record(event, detection, remediation); err != nil {
+						fmt.Printf("EDR: failed to record detection: %v\n", err)
+					}
 				}
 			}
 
@@ -88,6 +112,29 @@ func (e *EDREngine) StartRealMonitoring() {
 	}()
 }
 
+// record stores the event and emits it as a detection
+func (e *EDREngine) record(event models.SimulationEvent, details, remediation string) error {
+	emitter := e.getEmitter()
+	return e.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+		if emitter == nil {
+			return nil
+		}
+		return emitter.EmitTx(tx, events.DetectionRaised{
+			Engine:      event.Engine,
+			Kind:        event.EventType,
+			Severity:    event.Severity,
+			Source:      event.Source,
+			Target:      event.Target,
+			Details:     details,
+			Remediation: remediation,
+			RecordID:    event.ID,
+		})
+	})
+}
+
 func (e *EDREngine) GetEvents() []models.SimulationEvent {
 	var events []models.SimulationEvent
 	e.db.Where("engine = ?", "EDR").Order("timestamp desc").Limit(20).Find(&events)
@@ -0,0 +1,184 @@
+package sast
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directories that hold dependencies, build output or tooling rather than
+// the project's code
+var skipDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "testdata": true, "__pycache__": true,
+	"venv": true, "site-packages": true, "dist": true, "bower_components": true,
+}
+
+// Analyzer finds flows of untrusted data into dangerous calls in Go,
+// JavaScript and Python code
+type Analyzer struct {
+	rules []Rule
+	// Larger files are skipped, they are usually generated or bundled
+	MaxFileSize int64
+}
+
+func NewAnalyzer(rules []Rule) *Analyzer {
+	return &Analyzer{rules: rules, MaxFileSize: 1 << 20}
+}
+
+func (a *Analyzer) Rules() []Rule {
+	return a.rules
+}
+
+// language returns the language of a file from its name, or ""
+func language(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_test.go"):
+		return ""
+	case strings.HasSuffix(name, ".go"):
+		return LangGo
+	case strings.HasSuffix(name, ".min.js"):
+		return ""
+	case strings.HasSuffix(name, ".js"), strings.HasSuffix(name, ".mjs"), strings.HasSuffix(name, ".cjs"):
+		return LangJavaScript
+	case strings.HasSuffix(name, ".py"):
+		return LangPython
+	}
+	return ""
+}
+
+// AnalyzeDir analyses the source files under root. Findings are reported
+// with paths relative to root.
+func (a *Analyzer) AnalyzeDir(ctx context.Context, root string) ([]Finding, error) {
+	module := goModule(root)
+	goPackages := make(map[string]map[string][]byte) // By directory
+	var files []*sourceFile
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != root && (skipDirs[name] || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		lang := language(name)
+		if lang == "" || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > a.MaxFileSize {
+			return nil
+		}
+		src, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch lang {
+		case LangGo:
+			dir := path.Dir(rel)
+			if goPackages[dir] == nil {
+				goPackages[dir] = make(map[string][]byte)
+			}
+			goPackages[dir][rel] = src
+		case LangJavaScript:
+			files = append(files, parseJS(rel, src))
+		case LangPython:
+			files = append(files, parsePython(rel, src))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range sortedDirs(goPackages) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pkgPath := module
+		if dir != "." {
+			pkgPath = path.Join(module, dir)
+		}
+		parsed, err := parseGoPackage(pkgPath, goPackages[dir])
+		if err != nil {
+			slog.Warn("SAST: skipping Go package that does not parse", "dir", dir, "error", err)
+			continue
+		}
+		files = append(files, parsed...)
+	}
+	return analyze(files, a.rules), nil
+}
+
+// AnalyzeFile analyses a single file; a Go file is checked as a package
+// of its own
+func (a *Analyzer) AnalyzeFile(name string, src []byte) ([]Finding, error) {
+	var files []*sourceFile
+	switch language(name) {
+	case LangGo:
+		parsed, err := parseGoPackage("main", map[string][]byte{name: src})
+		if err != nil {
+			return nil, err
+		}
+		files = parsed
+	case LangJavaScript:
+		files = append(files, parseJS(name, src))
+	case LangPython:
+		files = append(files, parsePython(name, src))
+	}
+	return analyze(files, a.rules), nil
+}
+
+// goModule returns the module path declared in root/go.mod, or "main"
+func goModule(root string) string {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return "main"
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		if fields := strings.Fields(s.Text()); len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return "main"
+}
+
+func splitLines(src []byte) []string {
+	return strings.Split(string(src), "\n")
+}
+
+func sortedFiles(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedDirs(dirs map[string]map[string][]byte) []string {
+	names := make([]string, 0, len(dirs))
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,197 @@
+package sast
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAnalyzer(t *testing.T) *Analyzer {
+	t.Helper()
+	rules, err := LoadRules("")
+	require.NoError(t, err)
+	return NewAnalyzer(rules)
+}
+
+// locations returns findings as "rule file:line"
+func locations(findings []Finding) []string {
+	var out []string
+	for _, f := range findings {
+		out = append(out, fmt.Sprintf("%s %s:%d", f.RuleID, f.File, f.Line))
+	}
+	return out
+}
+
+// notes returns the trace of a finding as "line note"
+func notes(f Finding) []string {
+	var out []string
+	for _, s := range f.Trace {
+		out = append(out, fmt.Sprintf("%d %s", s.Line, s.Note))
+	}
+	return out
+}
+
+func analyzeDir(t *testing.T, dir string) []Finding {
+	t.Helper()
+	findings, err := newTestAnalyzer(t).AnalyzeDir(context.Background(), dir)
+	require.NoError(t, err)
+	return findings
+}
+
+func analyzeFile(t *testing.T, name, src string) []Finding {
+	t.Helper()
+	findings, err := newTestAnalyzer(t).AnalyzeFile(name, []byte(src))
+	require.NoError(t, err)
+	return findings
+}
+
+func TestAnalyzeDir_Go(t *testing.T) {
+	findings := analyzeDir(t, "testdata/app")
+
+	// The queries of GetUserSafe and the filepath.Base call in Download are
+	// not reported
+	assert.Equal(t, []string{
+		"go-sql-injection handlers/users.go:22",
+		"go-path-traversal handlers/users.go:40",
+		"go-command-injection handlers/users.go:53",
+	}, locations(findings))
+
+	assert.Equal(t, []string{
+		"20 source r.URL, assigned to id",
+		"21 assigned to query",
+		"22 reaches h.db.Query",
+	}, notes(findings[0]))
+	assert.Equal(t, "CWE-89", findings[0].CWE)
+	assert.Equal(t, `rows, err := h.db.Query(query)`, findings[0].Trace[2].Code)
+
+	// Through the call to run
+	assert.Equal(t, []string{
+		"48 source c.Query(), assigned to host",
+		"49 passed to run",
+		"52 parameter target of run",
+		"53 reaches exec.Command",
+	}, notes(findings[2]))
+}
+
+func TestAnalyzeDir_JavaScript(t *testing.T) {
+	findings := analyzeDir(t, "testdata/web")
+
+	assert.Equal(t, []string{
+		"js-sql-injection app.js:11",
+		"js-command-injection app.js:23",
+		"js-path-traversal app.js:27",
+		"js-ssrf app.js:39",
+	}, locations(findings))
+	assert.Equal(t, []string{
+		"31 source req.params.name, passed to readReport",
+		"26 parameter name of readReport",
+		"27 reaches fs.readFileSync",
+	}, notes(findings[2]))
+}
+
+func TestAnalyzeDir_Python(t *testing.T) {
+	findings := analyzeDir(t, "testdata/py")
+
+	assert.Equal(t, []string{
+		"py-sql-injection views.py:16",
+		"py-command-injection views.py:24",
+		"py-template-injection views.py:30",
+		"py-path-traversal views.py:38",
+		"py-ssrf views.py:53",
+		"py-code-injection views.py:57",
+	}, locations(findings))
+	assert.Equal(t, []string{
+		"45 source request.args.name, passed to reports.read",
+		"37 parameter name of read",
+		"38 reaches open",
+	}, notes(findings[3]))
+	assert.Equal(t, []string{"57 source input(), reaches eval"}, notes(findings[5]))
+}
+
+func TestAnalyzeFile_Sanitized(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"app.py", `
+from flask import request
+import os
+
+def view():
+    n = int(request.args["n"])
+    os.system("sleep %d" % n)
+`},
+		{"app.js", `
+const cp = require('child_process');
+app.get('/', (req, res) => {
+  const n = Number(req.query.n);
+  cp.execSync('sleep ' + n);
+});
+`},
+		{"main.go", `package main
+
+import (
+	"net/http"
+	"os/exec"
+	"strconv"
+)
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.FormValue("n"))
+	exec.Command("sleep", strconv.Itoa(n)).Run()
+}
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Empty(t, locations(analyzeFile(t, tt.name, tt.src)))
+		})
+	}
+}
+
+func TestAnalyzeFile_Reassigned(t *testing.T) {
+	findings := analyzeFile(t, "app.py", `
+from flask import request
+import subprocess
+
+def view():
+    cmd = request.args.get("cmd")
+    cmd = "uptime"
+    subprocess.run(cmd, shell=True)
+
+def branch():
+    cmd = request.args.get("cmd")
+    if not cmd:
+        cmd = "uptime"
+    subprocess.run(cmd, shell=True)
+`)
+	// Only an assignment on every path clears the taint
+	assert.Equal(t, []string{"py-command-injection app.py:14"}, locations(findings))
+}
+
+func TestAnalyzeFile_JavaScriptSyntax(t *testing.T) {
+	findings := analyzeFile(t, "app.mjs", `
+import { exec as run } from 'child_process';
+import * as fs from 'fs';
+
+export class Files {
+  read({ query: { name } }) {
+    const re = /\.\.\//g;
+    return fs.readFileSync(name.replace(re, ''));
+  }
+}
+
+router.post('/run', async (req, res) => {
+  const { cmd, args = [] } = req.body;
+  run(`+"`${cmd} ${args.join(' ')}`"+`);
+});
+`)
+	assert.Equal(t, []string{"js-command-injection app.mjs:14"}, locations(findings))
+}
+
+func TestAnalyzeFile_NotSupported(t *testing.T) {
+	assert.Empty(t, analyzeFile(t, "README.md", "eval(input())"))
+}
@@ -0,0 +1,571 @@
+package sast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// stdImporter type-checks imports of the standard library only. Other
+// packages are left unresolved, and calls into them are named from the
+// syntax instead: the import path and the declared type of the receiver.
+type stdImporter struct {
+	std types.Importer
+}
+
+func (i stdImporter) Import(p string) (*types.Package, error) {
+	if first, _, _ := strings.Cut(p, "/"); strings.Contains(first, ".") || p == "C" {
+		return nil, fmt.Errorf("%s is not in the standard library", p)
+	}
+	return i.std.Import(p)
+}
+
+// parseGoPackage parses and type-checks the files of one package. pkgPath
+// is its import path, used to name its functions.
+func parseGoPackage(pkgPath string, files map[string][]byte) ([]*sourceFile, error) {
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	var sources []*sourceFile
+	for _, name := range sortedFiles(files) {
+		f, err := parser.ParseFile(fset, name, files[name], parser.SkipObjectResolution)
+		if err != nil && f == nil {
+			return nil, err
+		}
+		parsed = append(parsed, f)
+		sources = append(sources, &sourceFile{path: name, lang: LangGo, lines: splitLines(files[name])})
+	}
+
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{
+		Importer:    stdImporter{importer.Default()},
+		Error:       func(error) {}, // Unresolved imports are expected
+		FakeImportC: true,
+	}
+	conf.Check(pkgPath, fset, parsed, info)
+
+	for i, f := range parsed {
+		l := &goLowerer{fset: fset, info: info, pkg: pkgPath, file: sources[i], imports: goImports(f)}
+		l.lowerFile(f)
+	}
+	return sources, nil
+}
+
+// goImports maps the names of a file's imports to their paths
+func goImports(f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(p)
+		if strings.HasPrefix(name, "v") && len(name) > 1 && strings.Trim(name[1:], "0123456789") == "" {
+			// Major version suffix, e.g. github.com/labstack/echo/v4
+			name = path.Base(path.Dir(p))
+		}
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "go-"), "go.")
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = p
+	}
+	return imports
+}
+
+type goLowerer struct {
+	fset    *token.FileSet
+	info    *types.Info
+	pkg     string
+	file    *sourceFile
+	imports map[string]string
+
+	fn    *function
+	depth int // Nesting of branches and loops
+	lits  int // Function literals in fn
+	// Declared types of the function's variables, for receivers whose
+	// type could not be checked
+	vars map[string]string
+}
+
+func (l *goLowerer) lowerFile(f *ast.File) {
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Body == nil {
+			continue
+		}
+		name := l.pkg + "." + d.Name.Name
+		if obj, ok := l.info.Defs[d.Name].(*types.Func); ok {
+			name = l.funcName(obj)
+		} else if d.Recv != nil && len(d.Recv.List) > 0 {
+			name = l.typeExprName(d.Recv.List[0].Type) + "." + d.Name.Name
+		}
+		l.lowerFunc(name, d.Recv, d.Type, d.Body)
+	}
+}
+
+// lowerFunc adds a function to the file. Function literals inside it are
+// added as functions of their own.
+func (l *goLowerer) lowerFunc(name string, recv *ast.FieldList, typ *ast.FuncType, body *ast.BlockStmt) {
+	outer, outerDepth, outerLits, outerVars := l.fn, l.depth, l.lits, l.vars
+	defer func() { l.fn, l.depth, l.lits, l.vars = outer, outerDepth, outerLits, outerVars }()
+
+	l.fn = &function{name: name, line: l.line(typ), file: l.file}
+	l.depth, l.lits = 0, 0
+	l.vars = make(map[string]string)
+	for k, v := range outerVars {
+		l.vars[k] = v
+	}
+	for _, list := range []*ast.FieldList{recv, typ.Params} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			t := l.typeExprName(field.Type)
+			for _, n := range field.Names {
+				l.vars[n.Name] = t
+				if list == typ.Params {
+					l.fn.params = append(l.fn.params, n.Name)
+				}
+			}
+			if len(field.Names) == 0 && list == typ.Params {
+				l.fn.params = append(l.fn.params, "_")
+			}
+		}
+	}
+	l.file.funcs = append(l.file.funcs, l.fn)
+	l.stmts(body.List)
+}
+
+func (l *goLowerer) line(n ast.Node) int {
+	return l.fset.Position(n.Pos()).Line
+}
+
+func (l *goLowerer) emit(n ast.Node, value *expr, targets ...string) {
+	l.fn.body = append(l.fn.body, stmt{line: l.line(n), targets: targets, value: value, branch: l.depth > 0})
+}
+
+// branch lowers statements that may not run
+func (l *goLowerer) branch(list []ast.Stmt) {
+	l.depth++
+	l.stmts(list)
+	l.depth--
+}
+
+func (l *goLowerer) stmts(list []ast.Stmt) {
+	for _, s := range list {
+		l.stmt(s)
+	}
+}
+
+func (l *goLowerer) stmt(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		l.assign(s)
+	case *ast.DeclStmt:
+		gen, ok := s.Decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			return
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, n := range vs.Names {
+				if vs.Type != nil {
+					l.vars[n.Name] = l.typeExprName(vs.Type)
+				}
+				if i < len(vs.Values) {
+					l.emit(s, l.expr(vs.Values[i]), n.Name)
+				} else if len(vs.Values) == 1 {
+					l.emit(s, l.expr(vs.Values[0]), n.Name)
+				}
+			}
+		}
+	case *ast.ExprStmt:
+		l.emit(s, l.expr(s.X))
+	case *ast.ReturnStmt:
+		l.emit(s, l.exprs(s, s.Results))
+	case *ast.GoStmt:
+		l.emit(s, l.expr(s.Call))
+	case *ast.DeferStmt:
+		l.emit(s, l.expr(s.Call))
+	case *ast.SendStmt:
+		l.emit(s, l.expr(s.Value), l.targetPath(s.Chan))
+	case *ast.BlockStmt:
+		l.stmts(s.List)
+	case *ast.LabeledStmt:
+		l.stmt(s.Stmt)
+	case *ast.IfStmt:
+		if s.Init != nil {
+			l.stmt(s.Init)
+		}
+		l.emit(s.Cond, l.expr(s.Cond))
+		l.branch(s.Body.List)
+		if s.Else != nil {
+			l.branch([]ast.Stmt{s.Else})
+		}
+	case *ast.ForStmt:
+		if s.Init != nil {
+			l.stmt(s.Init)
+		}
+		l.depth++
+		if s.Cond != nil {
+			l.emit(s.Cond, l.expr(s.Cond))
+		}
+		if s.Post != nil {
+			l.stmt(s.Post)
+		}
+		l.depth--
+		l.branch(s.Body.List)
+	case *ast.RangeStmt:
+		l.depth++
+		var targets []string
+		for _, t := range []ast.Expr{s.Key, s.Value} {
+			if t != nil {
+				targets = append(targets, l.targetPath(t))
+			}
+		}
+		l.emit(s, l.expr(s.X), targets...)
+		l.depth--
+		l.branch(s.Body.List)
+	case *ast.SwitchStmt:
+		if s.Init != nil {
+			l.stmt(s.Init)
+		}
+		if s.Tag != nil {
+			l.emit(s.Tag, l.expr(s.Tag))
+		}
+		l.clauses(s.Body)
+	case *ast.TypeSwitchStmt:
+		if s.Init != nil {
+			l.stmt(s.Init)
+		}
+		l.stmt(s.Assign)
+		l.clauses(s.Body)
+	case *ast.SelectStmt:
+		l.clauses(s.Body)
+	}
+}
+
+func (l *goLowerer) clauses(body *ast.BlockStmt) {
+	l.depth++
+	defer func() { l.depth-- }()
+	for _, c := range body.List {
+		switch c := c.(type) {
+		case *ast.CaseClause:
+			for _, e := range c.List {
+				l.emit(e, l.expr(e))
+			}
+			l.stmts(c.Body)
+		case *ast.CommClause:
+			if c.Comm != nil {
+				l.stmt(c.Comm)
+			}
+			l.stmts(c.Body)
+		}
+	}
+}
+
+func (l *goLowerer) assign(s *ast.AssignStmt) {
+	if s.Tok == token.DEFINE {
+		for i, lhs := range s.Lhs {
+			id, ok := lhs.(*ast.Ident)
+			if ok && len(s.Lhs) == len(s.Rhs) {
+				if t := l.literalType(s.Rhs[i]); t != "" {
+					l.vars[id.Name] = t
+				}
+			}
+		}
+	}
+	if len(s.Lhs) != len(s.Rhs) {
+		// Values of a multi-value call
+		var targets []string
+		for _, lhs := range s.Lhs {
+			if p := l.targetPath(lhs); p != "" {
+				targets = append(targets, p)
+			}
+		}
+		l.emit(s, l.expr(s.Rhs[0]), targets...)
+		return
+	}
+	for i, lhs := range s.Lhs {
+		value := l.expr(s.Rhs[i])
+		if s.Tok != token.ASSIGN && s.Tok != token.DEFINE {
+			value = other(value.line, l.expr(lhs), value)
+		}
+		target := l.targetPath(lhs)
+		if _, ok := unparen(lhs).(*ast.IndexExpr); ok {
+			// An element is set, the rest of the collection keeps its taint
+			l.depth++
+			l.emit(s, value, target)
+			l.depth--
+			continue
+		}
+		l.emit(s, value, target)
+	}
+}
+
+// targetPath returns the variable an assignment writes to, or "" for _
+func (l *goLowerer) targetPath(e ast.Expr) string {
+	switch e := unparen(e).(type) {
+	case *ast.Ident:
+		if e.Name == "_" {
+			return ""
+		}
+		return e.Name
+	case *ast.SelectorExpr:
+		if x := l.targetPath(e.X); x != "" {
+			return x + "." + e.Sel.Name
+		}
+	case *ast.IndexExpr:
+		return l.targetPath(e.X)
+	case *ast.StarExpr:
+		return l.targetPath(e.X)
+	}
+	return ""
+}
+
+func (l *goLowerer) exprs(n ast.Node, list []ast.Expr) *expr {
+	e := other(l.line(n))
+	for _, x := range list {
+		e.args = append(e.args, l.expr(x))
+	}
+	return e
+}
+
+func (l *goLowerer) expr(e ast.Expr) *expr {
+	line := l.line(e)
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		return lit(line)
+	case *ast.Ident:
+		return l.ident(e)
+	case *ast.ParenExpr:
+		return l.expr(e.X)
+	case *ast.StarExpr:
+		return l.expr(e.X)
+	case *ast.UnaryExpr:
+		return l.expr(e.X)
+	case *ast.TypeAssertExpr:
+		return l.expr(e.X)
+	case *ast.KeyValueExpr:
+		return l.expr(e.Value)
+	case *ast.BinaryExpr:
+		x := other(line, l.expr(e.X), l.expr(e.Y))
+		switch e.Op {
+		case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ, token.LAND, token.LOR:
+			x.kind = exprCond
+		}
+		return x
+	case *ast.IndexExpr:
+		return other(line, l.expr(e.X), cond(line, l.expr(e.Index)))
+	case *ast.IndexListExpr:
+		return l.expr(e.X)
+	case *ast.SliceExpr:
+		return other(line, l.expr(e.X))
+	case *ast.CompositeLit:
+		return l.exprs(e, e.Elts)
+	case *ast.FuncLit:
+		l.lits++
+		l.lowerFunc(fmt.Sprintf("%s.func%d", l.fn.name, l.lits), nil, e.Type, e.Body)
+		return lit(line)
+	case *ast.SelectorExpr:
+		return l.selector(e)
+	case *ast.CallExpr:
+		return l.call(e)
+	}
+	return lit(line)
+}
+
+func (l *goLowerer) ident(id *ast.Ident) *expr {
+	line := l.line(id)
+	switch obj := l.info.Uses[id].(type) {
+	case *types.Const, *types.Nil, *types.TypeName, *types.Func, *types.Builtin:
+		return lit(line)
+	case *types.Var:
+		if obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope() {
+			// Package variable
+			return &expr{kind: exprName, name: obj.Pkg().Path() + "." + id.Name, path: id.Name, line: line}
+		}
+	}
+	if id.Name == "nil" || id.Name == "true" || id.Name == "false" {
+		return lit(line)
+	}
+	return &expr{kind: exprName, name: id.Name, path: id.Name, line: line}
+}
+
+func (l *goLowerer) selector(sel *ast.SelectorExpr) *expr {
+	line := l.line(sel)
+	if pkg := l.packageOf(sel); pkg != "" {
+		name := pkg + "." + sel.Sel.Name
+		return &expr{kind: exprName, name: name, path: types.ExprString(sel), line: line}
+	}
+	return &expr{kind: exprAttr, name: l.member(sel), path: l.targetPath(sel), x: l.expr(sel.X), line: line}
+}
+
+func (l *goLowerer) call(c *ast.CallExpr) *expr {
+	line := l.line(c)
+	var args []*expr
+	for _, a := range c.Args {
+		args = append(args, l.expr(a))
+	}
+	fun := unparen(c.Fun)
+	if tv, ok := l.info.Types[fun]; ok && tv.IsType() {
+		// A conversion keeps the data
+		return other(line, args...)
+	}
+	switch fun.(type) {
+	case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.StructType:
+		return other(line, args...)
+	}
+
+	call := &expr{kind: exprCall, path: types.ExprString(fun), args: args, line: line}
+	switch f := fun.(type) {
+	case *ast.Ident:
+		call.name = f.Name
+		switch obj := l.info.Uses[f].(type) {
+		case *types.Func:
+			call.name = l.funcName(obj)
+		case *types.TypeName:
+			return other(line, args...)
+		}
+	case *ast.SelectorExpr:
+		if pkg := l.packageOf(f); pkg != "" {
+			call.name = pkg + "." + f.Sel.Name
+		} else {
+			call.name = l.member(f)
+			call.x = l.expr(f.X)
+		}
+	default:
+		call.x = l.expr(fun)
+	}
+	return call
+}
+
+// packageOf returns the import path if sel is a member of an imported
+// package
+func (l *goLowerer) packageOf(sel *ast.SelectorExpr) string {
+	id, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	if pkg, ok := l.info.Uses[id].(*types.PkgName); ok {
+		return pkg.Imported().Path()
+	}
+	if _, local := l.vars[id.Name]; local {
+		return ""
+	}
+	if _, known := l.info.Uses[id]; known {
+		return ""
+	}
+	return l.imports[id.Name]
+}
+
+// member names a field or method by the type declaring it, e.g.
+// database/sql.DB.Query
+func (l *goLowerer) member(sel *ast.SelectorExpr) string {
+	if s, ok := l.info.Selections[sel]; ok {
+		if fn, ok := s.Obj().(*types.Func); ok {
+			if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+				if t := typeName(recv.Type()); t != "" {
+					return t + "." + sel.Sel.Name
+				}
+			}
+		}
+		if t := typeName(s.Recv()); t != "" {
+			return t + "." + sel.Sel.Name
+		}
+	}
+	if tv, ok := l.info.Types[sel.X]; ok {
+		if t := typeName(tv.Type); t != "" {
+			return t + "." + sel.Sel.Name
+		}
+	}
+	if id, ok := sel.X.(*ast.Ident); ok && l.vars[id.Name] != "" {
+		return l.vars[id.Name] + "." + sel.Sel.Name
+	}
+	return "?." + sel.Sel.Name
+}
+
+func (l *goLowerer) funcName(fn *types.Func) string {
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		if t := typeName(recv.Type()); t != "" {
+			return t + "." + fn.Name()
+		}
+	}
+	if fn.Pkg() == nil {
+		return fn.Name()
+	}
+	return fn.Pkg().Path() + "." + fn.Name()
+}
+
+// typeName is the qualified name of a named type or pointer to one, or ""
+func typeName(t types.Type) string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	t = types.Unalias(t)
+	named, ok := t.(*types.Named)
+	if !ok {
+		return ""
+	}
+	obj := named.Obj()
+	if obj.Pkg() == nil {
+		return obj.Name()
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// typeExprName names a type from its syntax, resolving the package
+func (l *goLowerer) typeExprName(e ast.Expr) string {
+	if tv, ok := l.info.Types[e]; ok {
+		if t := typeName(tv.Type); t != "" {
+			return t
+		}
+	}
+	switch e := e.(type) {
+	case *ast.StarExpr:
+		return l.typeExprName(e.X)
+	case *ast.Ident:
+		return l.pkg + "." + e.Name
+	case *ast.SelectorExpr:
+		if x, ok := e.X.(*ast.Ident); ok {
+			if p := l.imports[x.Name]; p != "" {
+				return p + "." + e.Sel.Name
+			}
+		}
+	case *ast.IndexExpr:
+		return l.typeExprName(e.X)
+	}
+	return ""
+}
+
+// literalType is the type of &T{} and T{}
+func (l *goLowerer) literalType(e ast.Expr) string {
+	if u, ok := e.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		e = u.X
+	}
+	if c, ok := e.(*ast.CompositeLit); ok && c.Type != nil {
+		return l.typeExprName(c.Type)
+	}
+	return ""
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
@@ -0,0 +1,147 @@
+package sast
+
+import "strings"
+
+// The parsers lower every language to the same small representation: a
+// file is a list of functions, a function a flat list of assignments and
+// expressions in source order. Control flow is dropped, except that
+// statements in branches and loops are marked so a reassignment there does
+// not clear the taint of a variable.
+
+type exprKind int
+
+const (
+	exprLit   exprKind = iota // A constant or anything that carries no data
+	exprName                  // A variable
+	exprAttr                  // A field or attribute of X
+	exprCall                  // A call of Name, a method of X when X is set
+	exprOther                 // Any other expression; tainted if an operand is
+	exprCond                  // A comparison; its operands carry no data out
+)
+
+type expr struct {
+	kind exprKind
+	// Name is matched against the rules: the qualified name of the
+	// variable, attribute or called function
+	name string
+	// Path is the variable as written, e.g. req.query.id, for names and
+	// attributes that taint can be recorded for. For calls it is the
+	// callee as written, used in traces.
+	path string
+	// Value of a string literal
+	value    string
+	x        *expr
+	args     []*expr
+	keywords map[string]*expr
+	line     int
+}
+
+type stmt struct {
+	line int
+	// Targets are the paths assigned the value, if any
+	targets []string
+	value   *expr
+	// Branch is set for statements that may not run
+	branch bool
+}
+
+type function struct {
+	name   string
+	params []string
+	body   []stmt
+	line   int
+	file   *sourceFile
+}
+
+type sourceFile struct {
+	path  string // Relative to the scanned directory, with forward slashes
+	lang  string
+	lines []string
+	funcs []*function
+}
+
+// code returns the trimmed source line
+func (f *sourceFile) code(line int) string {
+	if line < 1 || line > len(f.lines) {
+		return ""
+	}
+	code := strings.TrimSpace(f.lines[line-1])
+	if len(code) > 200 {
+		code = code[:200] + "…"
+	}
+	return code
+}
+
+func lit(line int) *expr {
+	return &expr{kind: exprLit, line: line}
+}
+
+func other(line int, operands ...*expr) *expr {
+	e := &expr{kind: exprOther, line: line}
+	for _, o := range operands {
+		if o != nil {
+			e.args = append(e.args, o)
+		}
+	}
+	return e
+}
+
+func cond(line int, operands ...*expr) *expr {
+	e := other(line, operands...)
+	e.kind = exprCond
+	return e
+}
+
+// member returns the property name of e
+func member(e *expr, name string, line int) *expr {
+	m := &expr{kind: exprAttr, x: e, line: line}
+	if e.kind == exprName || e.kind == exprAttr {
+		m.name = e.name + "." + name
+	} else {
+		m.name = "?." + name
+	}
+	if e.path != "" && e.kind != exprCall {
+		m.path = e.path + "." + name
+	}
+	return m
+}
+
+// callOf returns a call of the function fun evaluates to
+func callOf(fun *expr, line int) *expr {
+	call := &expr{kind: exprCall, line: line}
+	switch fun.kind {
+	case exprName:
+		call.name, call.path = fun.name, fun.path
+	case exprAttr:
+		call.name, call.path, call.x = fun.name, fun.path, fun.x
+		if call.path == "" {
+			call.path = call.name
+		}
+	default:
+		call.x = fun
+	}
+	return call
+}
+
+// walk calls fn for e and every expression inside it, innermost first
+func (e *expr) walk(fn func(*expr)) {
+	if e == nil {
+		return
+	}
+	e.x.walk(fn)
+	for _, a := range e.args {
+		a.walk(fn)
+	}
+	for _, k := range sortedKeys(e.keywords) {
+		e.keywords[k].walk(fn)
+	}
+	fn(e)
+}
+
+// display is the name shown in traces
+func (e *expr) display() string {
+	if e.path != "" {
+		return e.path
+	}
+	return e.name
+}
@@ -0,0 +1,1043 @@
+package sast
+
+import "fmt"
+
+// parseJS lowers a JavaScript file. The parser covers the statements and
+// expressions of ES2022 modules and scripts; it skips what it does not
+// understand, so a syntax error only loses the flows through it. JSX and
+// TypeScript annotations are not supported.
+func parseJS(name string, src []byte) *sourceFile {
+	file := &sourceFile{path: name, lang: LangJavaScript, lines: splitLines(src)}
+	p := &jsParser{toks: lexJS(string(src)), file: file, aliases: make(map[string]string)}
+	p.function("<module>", 1, nil, func() {
+		for !p.at(jsEOF, "") {
+			p.statement()
+		}
+	})
+	return file
+}
+
+// Deepest nesting of expressions followed; deeper ones are skipped
+const maxNesting = 200
+
+type jsParser struct {
+	toks []jsToken
+	pos  int
+	file *sourceFile
+	// Local names of required and imported modules and their members
+	aliases map[string]string
+
+	fn       *function
+	depth    int    // Nesting of branches and loops
+	nesting  int    // Nesting of expressions
+	nameHint string // Name for the next function expression
+	// The value of the last assignment, so an expression statement that is
+	// an assignment is not recorded twice
+	assigned *expr
+}
+
+func (p *jsParser) peek() jsToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	line := 1
+	if len(p.toks) > 0 {
+		line = p.toks[len(p.toks)-1].line
+	}
+	return jsToken{kind: jsEOF, line: line}
+}
+
+func (p *jsParser) peekAt(n int) jsToken {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return jsToken{kind: jsEOF}
+}
+
+func (p *jsParser) next() jsToken {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+// at reports whether the next token has the kind and, if set, the text
+func (p *jsParser) at(kind jsTokenKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && (text == "" || t.text == text)
+}
+
+func (p *jsParser) punct(text string) bool {
+	return p.at(jsPunct, text)
+}
+
+func (p *jsParser) keyword(text string) bool {
+	return p.at(jsIdent, text)
+}
+
+// accept consumes the punctuator if it is next
+func (p *jsParser) accept(text string) bool {
+	if p.punct(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *jsParser) emit(line int, value *expr, targets ...string) {
+	var ts []string
+	for _, t := range targets {
+		if t != "" {
+			ts = append(ts, t)
+		}
+	}
+	p.fn.body = append(p.fn.body, stmt{line: line, targets: ts, value: value, branch: p.depth > 0})
+}
+
+// function adds a function to the file and parses its body with body
+func (p *jsParser) function(name string, line int, params []string, body func()) {
+	outer, outerDepth := p.fn, p.depth
+	p.fn = &function{name: name, params: params, line: line, file: p.file}
+	p.depth = 0
+	p.file.funcs = append(p.file.funcs, p.fn)
+	body()
+	p.fn, p.depth = outer, outerDepth
+}
+
+// funcName names a function expression after the variable or property it
+// is assigned to
+func (p *jsParser) funcName(line int) string {
+	name := p.nameHint
+	p.nameHint = ""
+	if name == "" {
+		name = fmt.Sprintf("<anonymous:%d>", line)
+	}
+	return name
+}
+
+// skipBalanced skips to after the bracket closing the one just consumed
+func (p *jsParser) skipBalanced(open, close string) {
+	level := 1
+	for !p.at(jsEOF, "") {
+		t := p.next()
+		if t.kind != jsPunct {
+			continue
+		}
+		switch t.text {
+		case open:
+			level++
+		case close:
+			level--
+			if level == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *jsParser) block() {
+	if !p.accept("{") {
+		p.statement()
+		return
+	}
+	for !p.punct("}") && !p.at(jsEOF, "") {
+		p.statement()
+	}
+	p.accept("}")
+}
+
+// branch parses a statement that may not run
+func (p *jsParser) branch() {
+	p.depth++
+	p.statement()
+	p.depth--
+}
+
+// paren parses a parenthesised condition
+func (p *jsParser) paren() *expr {
+	line := p.peek().line
+	if !p.accept("(") {
+		return lit(line)
+	}
+	e := p.expression()
+	p.accept(")")
+	return e
+}
+
+func (p *jsParser) statement() {
+	start := p.pos
+	defer func() {
+		if p.pos == start {
+			// Skip a token the parser does not understand
+			p.next()
+		}
+	}()
+
+	t := p.peek()
+	if t.kind == jsPunct {
+		switch t.text {
+		case "{":
+			p.block()
+			return
+		case ";":
+			p.next()
+			return
+		}
+	}
+	if t.kind != jsIdent {
+		p.expressionStatement()
+		return
+	}
+
+	switch t.text {
+	case "var", "let", "const":
+		if next := p.peekAt(1); next.kind == jsIdent || next.text == "{" || next.text == "[" {
+			p.next()
+			p.declarations()
+			p.accept(";")
+			return
+		}
+	case "function":
+		p.functionDecl()
+		return
+	case "async":
+		if p.peekAt(1).text == "function" {
+			p.next()
+			p.functionDecl()
+			return
+		}
+	case "class":
+		p.class()
+		return
+	case "import":
+		if next := p.peekAt(1); next.text != "(" && next.text != "." {
+			p.importDecl()
+			return
+		}
+	case "export":
+		p.next()
+		if p.keyword("default") {
+			p.next()
+		}
+		if p.punct("{") || p.punct("*") {
+			// Export lists and re-exports
+			if p.accept("{") {
+				p.skipBalanced("{", "}")
+			}
+			if p.accept("*") && p.keyword("as") {
+				p.pos += 2
+			}
+			if p.keyword("from") {
+				p.pos += 2
+			}
+			p.accept(";")
+			return
+		}
+		p.statement()
+		return
+	case "if":
+		p.next()
+		p.emit(t.line, p.paren())
+		p.branch()
+		if p.keyword("else") {
+			p.next()
+			p.branch()
+		}
+		return
+	case "for":
+		p.forStatement()
+		return
+	case "while":
+		p.next()
+		p.depth++
+		p.emit(t.line, p.paren())
+		p.depth--
+		p.branch()
+		return
+	case "do":
+		p.next()
+		p.branch()
+		if p.keyword("while") {
+			p.next()
+			p.emit(t.line, p.paren())
+		}
+		p.accept(";")
+		return
+	case "switch":
+		p.next()
+		p.emit(t.line, p.paren())
+		if !p.accept("{") {
+			return
+		}
+		p.depth++
+		for !p.punct("}") && !p.at(jsEOF, "") {
+			switch {
+			case p.keyword("case"):
+				line := p.next().line
+				p.emit(line, p.expression())
+				p.accept(":")
+			case p.keyword("default"):
+				p.next()
+				p.accept(":")
+			default:
+				p.statement()
+			}
+		}
+		p.depth--
+		p.accept("}")
+		return
+	case "try":
+		p.next()
+		p.block()
+		if p.keyword("catch") {
+			p.next()
+			if p.accept("(") {
+				p.skipBalanced("(", ")")
+			}
+			p.depth++
+			p.block()
+			p.depth--
+		}
+		if p.keyword("finally") {
+			p.next()
+			p.block()
+		}
+		return
+	case "return", "throw":
+		p.next()
+		if !p.punct(";") && !p.punct("}") && p.peek().line == t.line {
+			p.emit(t.line, p.expression())
+		}
+		p.accept(";")
+		return
+	case "break", "continue":
+		p.next()
+		if p.at(jsIdent, "") && p.peek().line == t.line {
+			p.next()
+		}
+		p.accept(";")
+		return
+	}
+	if p.peekAt(1).text == ":" && p.peekAt(1).kind == jsPunct {
+		// Label
+		p.pos += 2
+		p.statement()
+		return
+	}
+	p.expressionStatement()
+}
+
+func (p *jsParser) expressionStatement() {
+	line := p.peek().line
+	e := p.expression()
+	if e != p.assigned {
+		p.emit(line, e)
+	}
+	p.accept(";")
+}
+
+// declarations parses the bindings of var, let and const
+func (p *jsParser) declarations() {
+	for {
+		line := p.peek().line
+		targets, names := p.pattern()
+		if p.accept("=") {
+			if len(targets) == 1 {
+				p.nameHint = targets[0]
+			}
+			value := p.assignment()
+			p.nameHint = ""
+			p.alias(value, targets, names)
+			p.emit(line, value, targets...)
+		}
+		if !p.accept(",") {
+			return
+		}
+	}
+}
+
+// pattern parses a binding target: a name, or an object or array
+// pattern. It returns the bound names and, for object patterns, the
+// property each name is bound from.
+func (p *jsParser) pattern() (targets, props []string) {
+	switch {
+	case p.accept("{"):
+		for !p.punct("}") && !p.at(jsEOF, "") {
+			p.accept("...")
+			key := p.next()
+			if key.text == "[" {
+				p.skipBalanced("[", "]")
+			}
+			if p.accept(":") {
+				t, _ := p.pattern()
+				targets = append(targets, t...)
+				for range t {
+					props = append(props, key.text)
+				}
+			} else if key.kind == jsIdent {
+				targets = append(targets, key.text)
+				props = append(props, key.text)
+			}
+			if p.accept("=") {
+				p.assignment()
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.accept("}")
+	case p.accept("["):
+		for !p.punct("]") && !p.at(jsEOF, "") {
+			if p.accept(",") {
+				continue
+			}
+			p.accept("...")
+			t, _ := p.pattern()
+			targets = append(targets, t...)
+			if p.accept("=") {
+				p.assignment()
+			}
+			p.accept(",")
+		}
+		p.accept("]")
+	case p.at(jsIdent, ""):
+		targets = append(targets, p.next().text)
+	}
+	return targets, props
+}
+
+// alias records names bound to required modules, e.g.
+// const cp = require('child_process') or const { exec } = require(...)
+func (p *jsParser) alias(value *expr, targets, props []string) {
+	module := ""
+	switch {
+	case value.kind == exprCall && value.name == "require" && len(value.args) == 1 && value.args[0].value != "":
+		module = value.args[0].value
+	case value.kind == exprAttr && value.x.kind == exprCall && value.x.name == "require" && len(value.x.args) == 1 && value.x.args[0].value != "":
+		// require('mod').member
+		module = value.x.args[0].value + "." + shortName(value.name)
+	default:
+		return
+	}
+	for i, t := range targets {
+		if i < len(props) {
+			p.aliases[t] = module + "." + props[i]
+		} else {
+			p.aliases[t] = module
+		}
+	}
+}
+
+func (p *jsParser) importDecl() {
+	p.next()
+	if p.at(jsString, "") {
+		p.next()
+		p.accept(";")
+		return
+	}
+	bindings := make(map[string]string) // Local name to imported member
+	for !p.keyword("from") && !p.at(jsEOF, "") && !p.punct(";") {
+		switch {
+		case p.accept("*"):
+			if p.keyword("as") {
+				p.next()
+				bindings[p.next().text] = ""
+			}
+		case p.accept("{"):
+			for !p.punct("}") && !p.at(jsEOF, "") {
+				member := p.next().text
+				local := member
+				if p.keyword("as") {
+					p.next()
+					local = p.next().text
+				}
+				bindings[local] = member
+				p.accept(",")
+			}
+			p.accept("}")
+		case p.accept(","):
+		case p.at(jsIdent, ""):
+			bindings[p.next().text] = "default"
+		default:
+			p.next()
+		}
+	}
+	if p.keyword("from") {
+		p.next()
+	}
+	module := p.next().text
+	for local, member := range bindings {
+		switch member {
+		case "", "default":
+			// The default export of most Node modules is the module
+			p.aliases[local] = module
+		default:
+			p.aliases[local] = module + "." + member
+		}
+	}
+	p.accept(";")
+}
+
+func (p *jsParser) forStatement() {
+	line := p.next().line
+	if p.keyword("await") {
+		p.next()
+	}
+	if !p.accept("(") {
+		return
+	}
+	p.depth++
+	// for (x of y) and for (const [k, v] of y)
+	save := p.pos
+	if p.keyword("var") || p.keyword("let") || p.keyword("const") {
+		p.next()
+	}
+	targets, _ := p.pattern()
+	if len(targets) > 0 && (p.keyword("of") || p.keyword("in")) {
+		p.next()
+		p.emit(line, p.expression(), targets...)
+		p.accept(")")
+		p.depth--
+		p.branch()
+		return
+	}
+
+	p.pos = save
+	if !p.punct(";") {
+		p.statement() // The initialiser, which consumes the ;
+	} else {
+		p.next()
+	}
+	if !p.punct(";") {
+		p.emit(line, p.expression())
+	}
+	p.accept(";")
+	if !p.punct(")") {
+		p.emit(line, p.expression())
+	}
+	p.accept(")")
+	p.depth--
+	p.branch()
+}
+
+func (p *jsParser) functionDecl() {
+	line := p.next().line // function
+	p.accept("*")
+	name := ""
+	if p.at(jsIdent, "") {
+		name = p.next().text
+	}
+	if name == "" {
+		name = p.funcName(line)
+	}
+	p.functionRest(name, line)
+}
+
+// functionRest parses the parameters and body of a function
+func (p *jsParser) functionRest(name string, line int) {
+	params := p.params()
+	p.function(name, line, params, func() {
+		p.block()
+	})
+}
+
+// params parses a parameter list, naming destructured parameters after
+// their first binding
+func (p *jsParser) params() []string {
+	var params []string
+	if !p.accept("(") {
+		return nil
+	}
+	for !p.punct(")") && !p.at(jsEOF, "") {
+		p.accept("...")
+		targets, _ := p.pattern()
+		if len(targets) == 0 {
+			p.next()
+			continue
+		}
+		params = append(params, targets[0])
+		if p.accept("=") {
+			p.assignment()
+		}
+		p.accept(",")
+	}
+	p.accept(")")
+	return params
+}
+
+func (p *jsParser) class() *expr {
+	line := p.next().line
+	name := ""
+	if p.at(jsIdent, "") && !p.keyword("extends") {
+		name = p.next().text
+	}
+	if name == "" {
+		name = p.funcName(line)
+	}
+	if p.keyword("extends") {
+		p.next()
+		p.unary()
+	}
+	if !p.accept("{") {
+		return lit(line)
+	}
+	for !p.punct("}") && !p.at(jsEOF, "") {
+		if p.accept(";") {
+			continue
+		}
+		for p.keyword("static") || p.keyword("async") || p.keyword("get") || p.keyword("set") || p.punct("*") {
+			if next := p.peekAt(1); next.text == "(" || next.text == "=" {
+				break // A member of that name
+			}
+			p.next()
+		}
+		if p.punct("{") {
+			// Static initialisation block
+			p.function(name+".<static>", p.peek().line, nil, p.block)
+			continue
+		}
+		keyLine := p.peek().line
+		key := p.propertyKey()
+		if p.punct("(") {
+			p.functionRest(name+"."+key, keyLine)
+			continue
+		}
+		if p.accept("=") {
+			p.nameHint = name + "." + key
+			p.emit(keyLine, p.assignment())
+			p.nameHint = ""
+		}
+		p.accept(";")
+	}
+	p.accept("}")
+	return lit(line)
+}
+
+// propertyKey parses the key of an object property or class member
+func (p *jsParser) propertyKey() string {
+	t := p.next()
+	switch {
+	case t.kind == jsPunct && t.text == "[":
+		p.expression()
+		p.accept("]")
+		return "[computed]"
+	case t.kind == jsPunct && t.text == "#":
+		return "#" + p.next().text
+	}
+	return t.text
+}
+
+// expression parses a comma-separated sequence and returns its value
+func (p *jsParser) expression() *expr {
+	e := p.assignment()
+	for p.accept(",") {
+		e = p.assignment()
+	}
+	return e
+}
+
+var jsAssignOps = map[string]bool{
+	"=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true, "**=": true, "<<=": true, ">>=": true,
+	">>>=": true, "&=": true, "|=": true, "^=": true, "&&=": true, "||=": true, "??=": true,
+}
+
+func (p *jsParser) assignment() *expr {
+	if p.nesting > maxNesting {
+		line := p.next().line
+		return lit(line)
+	}
+	p.nesting++
+	defer func() { p.nesting-- }()
+
+	if p.keyword("yield") {
+		p.next()
+		if p.punct(")") || p.punct("]") || p.punct("}") || p.punct(",") || p.punct(";") {
+			return lit(p.peek().line)
+		}
+		p.accept("*")
+	}
+	if p.keyword("async") && p.peekAt(1).kind == jsIdent && p.peekAt(2).text == "=>" {
+		p.next()
+	}
+	if t := p.peek(); t.kind == jsIdent && p.peekAt(1).text == "=>" {
+		p.next()
+		return p.arrow([]string{t.text}, t.line)
+	}
+
+	line := p.peek().line
+	target := p.conditional()
+	t := p.peek()
+	if t.kind != jsPunct || !jsAssignOps[t.text] {
+		return target
+	}
+	p.next()
+	path := target.path
+	if target.kind == exprName || target.kind == exprAttr {
+		p.nameHint = path
+	}
+	value := p.assignment()
+	p.nameHint = ""
+	if t.text != "=" {
+		value = other(line, target, value)
+	}
+	if path != "" {
+		p.emit(line, value, path)
+		p.assigned = value
+	}
+	return value
+}
+
+func (p *jsParser) conditional() *expr {
+	e := p.binary(0)
+	if !p.accept("?") {
+		return e
+	}
+	yes := p.assignment()
+	p.accept(":")
+	no := p.assignment()
+	return other(e.line, cond(e.line, e), yes, no)
+}
+
+// Binary operators by precedence, lowest first
+var jsBinary = [][]string{
+	{"??"},
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!=", "===", "!=="},
+	{"<", ">", "<=", ">=", "instanceof", "in"},
+	{"<<", ">>", ">>>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+	{"**"},
+}
+
+func (p *jsParser) binaryOp(level int) bool {
+	t := p.peek()
+	if t.kind != jsPunct && (t.kind != jsIdent || t.text != "instanceof" && t.text != "in") {
+		return false
+	}
+	for _, op := range jsBinary[level] {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *jsParser) binary(level int) *expr {
+	if level == len(jsBinary) {
+		return p.unary()
+	}
+	e := p.binary(level + 1)
+	for p.binaryOp(level) {
+		p.next()
+		right := p.binary(level + 1)
+		e = other(e.line, e, right)
+		if level >= 6 && level <= 7 {
+			// Comparisons yield a boolean
+			e.kind = exprCond
+		}
+	}
+	return e
+}
+
+func (p *jsParser) unary() *expr {
+	t := p.peek()
+	switch {
+	case t.kind == jsPunct && (t.text == "!" || t.text == "~" || t.text == "+" || t.text == "-" || t.text == "++" || t.text == "--"):
+		p.next()
+		e := p.unary()
+		if t.text == "!" {
+			return cond(t.line, e)
+		}
+		return e
+	case t.kind == jsIdent && (t.text == "typeof" || t.text == "void" || t.text == "delete"):
+		p.next()
+		return cond(t.line, p.unary())
+	case t.kind == jsIdent && t.text == "await":
+		p.next()
+		return p.unary()
+	}
+	e := p.postfix(p.primary())
+	if p.punct("++") || p.punct("--") {
+		if t := p.peek(); t.line == e.line {
+			p.next()
+		}
+	}
+	return e
+}
+
+// postfix parses member accesses, calls and tagged templates after e
+func (p *jsParser) postfix(e *expr) *expr {
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == jsPunct && (t.text == "." || t.text == "?."):
+			p.next()
+			if p.punct("(") {
+				e = p.call(e)
+				continue
+			}
+			if p.punct("[") {
+				continue
+			}
+			p.accept("#")
+			e = member(e, p.next().text, t.line)
+		case t.kind == jsPunct && t.text == "[":
+			p.next()
+			index := p.expression()
+			p.accept("]")
+			if index.kind == exprLit && index.value != "" {
+				e = member(e, index.value, t.line)
+			} else {
+				e = other(t.line, e, cond(t.line, index))
+			}
+		case t.kind == jsPunct && t.text == "(":
+			e = p.call(e)
+		case t.kind == jsTemplate:
+			p.next()
+			call := callOf(e, t.line)
+			call.args = append(call.args, p.template(t))
+			e = call
+		case t.kind == jsPunct && t.text == "!" && t.line == e.line && !isOperandStart(p.peekAt(1)):
+			// TypeScript non-null assertion
+			p.next()
+		default:
+			return e
+		}
+	}
+}
+
+func isOperandStart(t jsToken) bool {
+	return t.kind != jsPunct || t.text == "(" || t.text == "[" || t.text == "{" || t.text == "!"
+}
+
+func (p *jsParser) call(fun *expr) *expr {
+	line := p.next().line // (
+	call := callOf(fun, line)
+	p.nameHint = ""
+	for !p.punct(")") && !p.at(jsEOF, "") {
+		p.accept("...")
+		call.args = append(call.args, p.assignment())
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.accept(")")
+	return call
+}
+
+func (p *jsParser) template(t jsToken) *expr {
+	e := other(t.line)
+	toks, pos := p.toks, p.pos
+	for _, part := range t.parts {
+		p.toks, p.pos = part, 0
+		e.args = append(e.args, p.expression())
+	}
+	p.toks, p.pos = toks, pos
+	return e
+}
+
+// arrow parses the body of an arrow function after its parameters
+func (p *jsParser) arrow(params []string, line int) *expr {
+	p.accept("=>")
+	name := p.funcName(line)
+	p.function(name, line, params, func() {
+		if p.punct("{") {
+			p.block()
+			return
+		}
+		bodyLine := p.peek().line
+		p.emit(bodyLine, p.assignment())
+	})
+	return lit(line)
+}
+
+// arrowParams reports whether the ( at the current position opens the
+// parameters of an arrow function
+func (p *jsParser) arrowParams() bool {
+	level := 0
+	for i := p.pos; i < len(p.toks); i++ {
+		t := p.toks[i]
+		if t.kind != jsPunct {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			level++
+		case ")", "]", "}":
+			level--
+			if level == 0 {
+				return i+1 < len(p.toks) && p.toks[i+1].text == "=>"
+			}
+		}
+	}
+	return false
+}
+
+func (p *jsParser) primary() *expr {
+	t := p.peek()
+	switch t.kind {
+	case jsEOF:
+		return lit(t.line)
+	case jsNumber, jsRegex:
+		p.next()
+		return lit(t.line)
+	case jsString:
+		p.next()
+		return &expr{kind: exprLit, value: t.text, line: t.line}
+	case jsTemplate:
+		p.next()
+		return p.template(t)
+	case jsPunct:
+		switch t.text {
+		case "(":
+			if p.arrowParams() {
+				return p.arrow(p.params(), t.line)
+			}
+			p.next()
+			e := p.expression()
+			p.accept(")")
+			return e
+		case "[":
+			p.next()
+			e := other(t.line)
+			for !p.punct("]") && !p.at(jsEOF, "") {
+				if p.accept(",") {
+					continue
+				}
+				p.accept("...")
+				e.args = append(e.args, p.assignment())
+			}
+			p.accept("]")
+			return e
+		case "{":
+			return p.object()
+		}
+		p.next()
+		return lit(t.line)
+	}
+
+	switch t.text {
+	case "null", "undefined", "true", "false":
+		p.next()
+		return lit(t.line)
+	case "function":
+		p.next()
+		p.accept("*")
+		hint := p.funcName(t.line)
+		if p.at(jsIdent, "") {
+			hint = p.next().text
+		}
+		p.functionRest(hint, t.line)
+		return lit(t.line)
+	case "async":
+		switch next := p.peekAt(1); {
+		case next.text == "function":
+			p.next()
+			return p.primary()
+		case next.text == "(" && next.line == t.line:
+			p.next()
+			if p.arrowParams() {
+				return p.arrow(p.params(), t.line)
+			}
+			p.pos--
+		}
+	case "class":
+		return p.class()
+	case "new":
+		p.next()
+		if p.accept(".") {
+			// new.target
+			p.next()
+			return lit(t.line)
+		}
+		callee := p.primary()
+		for p.punct(".") || p.punct("[") {
+			callee = p.postfixOne(callee)
+		}
+		call := callOf(callee, t.line)
+		if p.punct("(") {
+			call = p.call(callee)
+		}
+		return call
+	case "import":
+		p.next()
+		if p.accept(".") {
+			// import.meta
+			p.next()
+			return lit(t.line)
+		}
+		return &expr{kind: exprName, name: "import", path: "import", line: t.line}
+	}
+
+	p.next()
+	name := t.text
+	if module, ok := p.aliases[name]; ok {
+		name = module
+	}
+	return &expr{kind: exprName, name: name, path: t.text, line: t.line}
+}
+
+// postfixOne parses a single member access
+func (p *jsParser) postfixOne(e *expr) *expr {
+	t := p.next()
+	if t.text == "." {
+		return member(e, p.next().text, t.line)
+	}
+	index := p.expression()
+	p.accept("]")
+	if index.kind == exprLit && index.value != "" {
+		return member(e, index.value, t.line)
+	}
+	return other(t.line, e, cond(t.line, index))
+}
+
+func (p *jsParser) object() *expr {
+	line := p.next().line // {
+	e := other(line)
+	for !p.punct("}") && !p.at(jsEOF, "") {
+		if p.accept(",") {
+			continue
+		}
+		if p.accept("...") {
+			e.args = append(e.args, p.assignment())
+			continue
+		}
+		for (p.keyword("async") || p.keyword("get") || p.keyword("set") || p.punct("*")) && !isPropertyEnd(p.peekAt(1)) {
+			p.next()
+		}
+		keyTok := p.peek()
+		key := p.propertyKey()
+		switch {
+		case p.punct("("):
+			p.functionRest(key, keyTok.line)
+		case p.accept(":"):
+			p.nameHint = key
+			e.args = append(e.args, p.assignment())
+			p.nameHint = ""
+		case p.accept("="):
+			// Default in a destructuring pattern
+			p.assignment()
+		default:
+			// Shorthand
+			if keyTok.kind == jsIdent {
+				name := key
+				if module, ok := p.aliases[key]; ok {
+					name = module
+				}
+				e.args = append(e.args, &expr{kind: exprName, name: name, path: key, line: keyTok.line})
+			}
+		}
+	}
+	p.accept("}")
+	return e
+}
+
+func isPropertyEnd(t jsToken) bool {
+	return t.kind == jsPunct && (t.text == "(" || t.text == ":" || t.text == "," || t.text == "}" || t.text == "=")
+}
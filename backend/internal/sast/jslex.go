@@ -0,0 +1,242 @@
+package sast
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type jsTokenKind int
+
+const (
+	jsEOF jsTokenKind = iota
+	jsIdent
+	jsNumber
+	jsString
+	jsTemplate
+	jsRegex
+	jsPunct
+)
+
+type jsToken struct {
+	kind jsTokenKind
+	text string // Identifier, punctuator, or the value of a string
+	line int
+	// The tokens of each ${} of a template
+	parts [][]jsToken
+}
+
+// Punctuators, longest first
+var jsPuncts = []string{
+	">>>=", "...", "===", "!==", "**=", "<<=", ">>=", ">>>", "&&=", "||=", "??=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "**", "<<", ">>",
+}
+
+// Keywords after which a slash starts a regular expression
+var jsRegexAfter = map[string]bool{
+	"return": true, "typeof": true, "case": true, "do": true, "else": true, "in": true, "instanceof": true,
+	"new": true, "delete": true, "void": true, "throw": true, "yield": true, "await": true, "of": true,
+}
+
+type jsLexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// lexJS splits JavaScript source into tokens. It does not fail: anything
+// it does not understand becomes a punctuator.
+func lexJS(src string) []jsToken {
+	l := &jsLexer{src: src, line: 1}
+	return l.tokens(false)
+}
+
+// tokens lexes until the end, or the } closing a template substitution
+func (l *jsLexer) tokens(inTemplate bool) []jsToken {
+	var toks []jsToken
+	braces := 0
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.src) {
+			return toks
+		}
+		c := l.src[l.pos]
+		line := l.line
+		switch {
+		case c == '}' && inTemplate && braces == 0:
+			l.pos++
+			return toks
+		case c == '"' || c == '\'':
+			toks = append(toks, jsToken{kind: jsString, text: l.quoted(c), line: line})
+		case c == '`':
+			toks = append(toks, l.template())
+		case c >= '0' && c <= '9' || c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+			start := l.pos
+			for l.pos < len(l.src) && (isIdentByte(l.src[l.pos]) || l.src[l.pos] == '.') {
+				l.pos++
+			}
+			toks = append(toks, jsToken{kind: jsNumber, text: l.src[start:l.pos], line: line})
+		case c == '/' && regexAllowed(toks):
+			toks = append(toks, jsToken{kind: jsRegex, text: l.regex(), line: line})
+		case isIdentStart(l.src[l.pos:]):
+			start := l.pos
+			for l.pos < len(l.src) && isIdentStart(l.src[l.pos:]) || l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+				_, size := utf8.DecodeRuneInString(l.src[l.pos:])
+				l.pos += size
+			}
+			toks = append(toks, jsToken{kind: jsIdent, text: l.src[start:l.pos], line: line})
+		default:
+			p := string(c)
+			for _, candidate := range jsPuncts {
+				if strings.HasPrefix(l.src[l.pos:], candidate) {
+					p = candidate
+					break
+				}
+			}
+			l.pos += len(p)
+			switch p {
+			case "{":
+				braces++
+			case "}":
+				braces--
+			}
+			toks = append(toks, jsToken{kind: jsPunct, text: p, line: line})
+		}
+	}
+}
+
+func (l *jsLexer) skipSpace() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"), l.pos == 0 && strings.HasPrefix(l.src, "#!"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				end = len(l.src) - l.pos - 2
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos = min(l.pos+end+4, len(l.src))
+		default:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			if !unicode.IsSpace(r) {
+				return
+			}
+			l.pos += size
+		}
+	}
+}
+
+// quoted reads a string literal and returns its value. Escapes are kept
+// except for escaped quotes.
+func (l *jsLexer) quoted(quote byte) string {
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return b.String()
+		case c == '\n':
+			// Unterminated
+			return b.String()
+		case c == '\\' && l.pos+1 < len(l.src):
+			if l.src[l.pos+1] == '\n' {
+				l.line++
+			} else {
+				b.WriteByte(l.src[l.pos+1])
+			}
+			l.pos += 2
+			continue
+		}
+		b.WriteByte(c)
+		l.pos++
+	}
+	return b.String()
+}
+
+func (l *jsLexer) template() jsToken {
+	tok := jsToken{kind: jsTemplate, line: l.line}
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '`':
+			l.pos++
+			return tok
+		case c == '\\':
+			l.pos += 2
+			continue
+		case c == '\n':
+			l.line++
+		case c == '$' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '{':
+			l.pos += 2
+			tok.parts = append(tok.parts, l.tokens(true))
+			continue
+		}
+		l.pos++
+	}
+	return tok
+}
+
+func (l *jsLexer) regex() string {
+	start := l.pos
+	l.pos++
+	inClass := false
+	for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+		c := l.src[l.pos]
+		l.pos++
+		switch {
+		case c == '\\':
+			l.pos++
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			for l.pos < len(l.src) && isIdentByte(l.src[l.pos]) {
+				l.pos++
+			}
+			return l.src[start:min(l.pos, len(l.src))]
+		}
+	}
+	return l.src[start:min(l.pos, len(l.src))]
+}
+
+// regexAllowed reports whether a slash after toks starts a regular
+// expression rather than a division
+func regexAllowed(toks []jsToken) bool {
+	if len(toks) == 0 {
+		return true
+	}
+	last := toks[len(toks)-1]
+	switch last.kind {
+	case jsIdent:
+		return jsRegexAfter[last.text]
+	case jsPunct:
+		return last.text != ")" && last.text != "]" && last.text != "}"
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
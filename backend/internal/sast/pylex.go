@@ -0,0 +1,290 @@
+package sast
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type pyTokenKind int
+
+const (
+	pyEOF pyTokenKind = iota
+	pyName
+	pyNumber
+	pyString
+	pyOp
+	pyNewline
+	pyIndent
+	pyDedent
+)
+
+type pyToken struct {
+	kind pyTokenKind
+	text string // Name, operator, or the value of a string
+	line int
+	// The tokens of each {} of an f-string
+	parts [][]pyToken
+}
+
+// Operators, longest first
+var pyOps = []string{
+	"**=", "//=", ">>=", "<<=", "...", "->", ":=", "**", "//", "<<", ">>", "<=", ">=", "==", "!=",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "@=",
+}
+
+type pyLexer struct {
+	src     string
+	pos     int
+	line    int
+	toks    []pyToken
+	indents []int
+	depth   int // Open brackets, inside which lines are joined
+}
+
+// lexPython splits Python source into tokens, with the NEWLINE, INDENT
+// and DEDENT tokens of the language grammar. It does not fail.
+func lexPython(src string, line int) []pyToken {
+	l := &pyLexer{src: src, line: line, indents: []int{0}}
+	l.lex()
+	return l.toks
+}
+
+func (l *pyLexer) emit(kind pyTokenKind, text string, line int) {
+	l.toks = append(l.toks, pyToken{kind: kind, text: text, line: line})
+}
+
+func (l *pyLexer) lex() {
+	lineStart := true
+	for l.pos < len(l.src) {
+		if lineStart && l.depth == 0 {
+			if !l.indent() {
+				continue
+			}
+			lineStart = false
+		}
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			l.pos++
+		case c == '\\' && l.pos+1 < len(l.src) && (l.src[l.pos+1] == '\n' || l.src[l.pos+1] == '\r'):
+			l.pos = strings.IndexByte(l.src[l.pos:], '\n') + l.pos + 1
+			l.line++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '\n':
+			if l.depth == 0 && len(l.toks) > 0 && l.toks[len(l.toks)-1].kind != pyNewline {
+				l.emit(pyNewline, "", l.line)
+			}
+			l.pos++
+			l.line++
+			lineStart = true
+		case l.stringStart():
+			l.str()
+		case isDigit(c) || c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+			start := l.pos
+			for l.pos < len(l.src) {
+				b := l.src[l.pos]
+				if (b == '+' || b == '-') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E') && !strings.HasPrefix(l.src[start:], "0x") {
+					l.pos++
+					continue
+				}
+				if !isIdentByte(b) && b != '.' {
+					break
+				}
+				l.pos++
+			}
+			l.emit(pyNumber, l.src[start:l.pos], l.line)
+		case isIdentStart(l.src[l.pos:]):
+			start := l.pos
+			for l.pos < len(l.src) && (isIdentStart(l.src[l.pos:]) || isDigit(l.src[l.pos])) {
+				_, size := utf8.DecodeRuneInString(l.src[l.pos:])
+				l.pos += size
+			}
+			l.emit(pyName, l.src[start:l.pos], l.line)
+		default:
+			op := string(c)
+			for _, candidate := range pyOps {
+				if strings.HasPrefix(l.src[l.pos:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			switch op {
+			case "(", "[", "{":
+				l.depth++
+			case ")", "]", "}":
+				if l.depth > 0 {
+					l.depth--
+				}
+			}
+			l.pos += len(op)
+			l.emit(pyOp, op, l.line)
+		}
+	}
+	if len(l.toks) > 0 && l.toks[len(l.toks)-1].kind != pyNewline {
+		l.emit(pyNewline, "", l.line)
+	}
+	for len(l.indents) > 1 {
+		l.indents = l.indents[:len(l.indents)-1]
+		l.emit(pyDedent, "", l.line)
+	}
+}
+
+// indent measures the indentation of a line and emits INDENT or DEDENT
+// tokens. It returns false for blank lines and comments, which it skips.
+func (l *pyLexer) indent() bool {
+	width, i := 0, l.pos
+	for ; i < len(l.src); i++ {
+		switch l.src[i] {
+		case ' ':
+			width++
+			continue
+		case '\t':
+			width = width/8*8 + 8
+			continue
+		case '\f', '\r':
+			continue
+		}
+		break
+	}
+	if i == len(l.src) || l.src[i] == '\n' || l.src[i] == '#' {
+		l.pos = i
+		for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+			l.pos++
+		}
+		if l.pos < len(l.src) {
+			l.pos++
+			l.line++
+		}
+		return false
+	}
+	l.pos = i
+	top := l.indents[len(l.indents)-1]
+	switch {
+	case width > top:
+		l.indents = append(l.indents, width)
+		l.emit(pyIndent, "", l.line)
+	case width < top:
+		for len(l.indents) > 1 && width < l.indents[len(l.indents)-1] {
+			l.indents = l.indents[:len(l.indents)-1]
+			l.emit(pyDedent, "", l.line)
+		}
+	}
+	return true
+}
+
+// stringStart reports whether a string literal, possibly with a prefix
+// such as f or rb, starts at the current position
+func (l *pyLexer) stringStart() bool {
+	for i := l.pos; i < len(l.src) && i < l.pos+3; i++ {
+		switch l.src[i] {
+		case '"', '\'':
+			return true
+		case 'r', 'R', 'b', 'B', 'u', 'U', 'f', 'F':
+			continue
+		}
+		return false
+	}
+	return false
+}
+
+func (l *pyLexer) str() {
+	line := l.line
+	prefix := ""
+	for l.src[l.pos] != '"' && l.src[l.pos] != '\'' {
+		prefix += strings.ToLower(string(l.src[l.pos]))
+		l.pos++
+	}
+	raw := strings.Contains(prefix, "r")
+	quote := l.src[l.pos : l.pos+1]
+	if strings.HasPrefix(l.src[l.pos:], quote+quote+quote) {
+		quote += quote + quote
+	}
+	l.pos += len(quote)
+
+	start := l.pos
+	for l.pos < len(l.src) && !strings.HasPrefix(l.src[l.pos:], quote) {
+		switch l.src[l.pos] {
+		case '\\':
+			if l.pos+1 < len(l.src) && l.src[l.pos+1] == '\n' {
+				l.line++
+			}
+			l.pos++
+		case '\n':
+			if len(quote) == 1 {
+				// Unterminated
+				l.emit(pyString, l.src[start:l.pos], line)
+				return
+			}
+			l.line++
+		}
+		l.pos++
+	}
+	value := l.src[start:min(l.pos, len(l.src))]
+	l.pos = min(l.pos+len(quote), len(l.src))
+
+	tok := pyToken{kind: pyString, text: value, line: line}
+	if !raw || strings.Contains(prefix, "f") {
+		tok.text = strings.ReplaceAll(strings.ReplaceAll(value, `\'`, `'`), `\"`, `"`)
+	}
+	if strings.Contains(prefix, "f") {
+		tok.parts = fStringParts(value, line)
+	}
+	l.toks = append(l.toks, tok)
+}
+
+// fStringParts lexes the replacement fields of an f-string, without their
+// conversions and format specs
+func fStringParts(value string, line int) [][]pyToken {
+	var parts [][]pyToken
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\n':
+			line++
+		case strings.HasPrefix(value[i:], "{{"):
+			i++
+		case value[i] == '{':
+			level, end := 0, -1
+			start := i + 1
+			for j := start; j < len(value) && end < 0; j++ {
+				switch value[j] {
+				case '(', '[', '{':
+					level++
+				case ')', ']':
+					level--
+				case '}':
+					if level == 0 {
+						end = j
+					}
+					level--
+				case '!', ':', '=':
+					if level == 0 && end < 0 && !strings.HasPrefix(value[j:], "!=") && !strings.HasPrefix(value[j:], "==") &&
+						(value[j] != '=' || j+1 < len(value) && value[j+1] == '}') && !(j > start && strings.ContainsRune("<>!=", rune(value[j-1]))) {
+						end = j
+					}
+				}
+			}
+			if end < 0 {
+				return parts
+			}
+			toks := lexPython(value[start:end], line)
+			parts = append(parts, toks)
+			line += strings.Count(value[start:end], "\n")
+			// Skip the rest of the field
+			level = 0
+			for i = end; i < len(value); i++ {
+				if value[i] == '{' {
+					level++
+				} else if value[i] == '}' {
+					if level == 0 {
+						break
+					}
+					level--
+				}
+			}
+		}
+	}
+	return parts
+}
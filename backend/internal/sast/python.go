@@ -0,0 +1,878 @@
+package sast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parsePython lowers a Python 3 file. Like parseJS it skips what it does
+// not understand.
+func parsePython(name string, src []byte) *sourceFile {
+	file := &sourceFile{path: name, lang: LangPython, lines: splitLines(src)}
+	p := &pyParser{
+		toks:       lexPython(string(src), 1),
+		file:       file,
+		aliases:    make(map[string]string),
+		tuples:     make(map[*expr]bool),
+		subscripts: make(map[*expr]bool),
+	}
+	p.function("<module>", 1, nil, func() {
+		for !p.at(pyEOF, "") {
+			p.statement()
+		}
+	})
+	return file
+}
+
+type pyParser struct {
+	toks []pyToken
+	pos  int
+	file *sourceFile
+	// Local names of imported modules and their members
+	aliases map[string]string
+	// Tuple displays and subscripts, which are assigned element by element
+	tuples     map[*expr]bool
+	subscripts map[*expr]bool
+
+	fn      *function
+	class   string // Class whose body is being parsed
+	depth   int    // Nesting of branches and loops
+	nesting int    // Nesting of expressions
+	// The value of the last assignment expression
+	assigned *expr
+}
+
+func (p *pyParser) peek() pyToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	line := 1
+	if len(p.toks) > 0 {
+		line = p.toks[len(p.toks)-1].line
+	}
+	return pyToken{kind: pyEOF, line: line}
+}
+
+func (p *pyParser) next() pyToken {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *pyParser) at(kind pyTokenKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && (text == "" || t.text == text)
+}
+
+func (p *pyParser) op(text string) bool {
+	return p.at(pyOp, text)
+}
+
+func (p *pyParser) keyword(text string) bool {
+	return p.at(pyName, text)
+}
+
+func (p *pyParser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == pyOp || t.kind == pyName) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// atEnd reports whether the simple statement ends here
+func (p *pyParser) atEnd() bool {
+	return p.at(pyNewline, "") || p.at(pyEOF, "") || p.op(";")
+}
+
+func (p *pyParser) emit(line int, value *expr, targets ...string) {
+	var ts []string
+	for _, t := range targets {
+		if t != "" {
+			ts = append(ts, t)
+		}
+	}
+	p.fn.body = append(p.fn.body, stmt{line: line, targets: ts, value: value, branch: p.depth > 0})
+}
+
+func (p *pyParser) function(name string, line int, params []string, body func()) {
+	outer, outerDepth, outerClass := p.fn, p.depth, p.class
+	p.fn = &function{name: name, params: params, line: line, file: p.file}
+	p.depth, p.class = 0, ""
+	p.file.funcs = append(p.file.funcs, p.fn)
+	body()
+	p.fn, p.depth, p.class = outer, outerDepth, outerClass
+}
+
+// suite parses the block after a colon
+func (p *pyParser) suite() {
+	p.accept(":")
+	if !p.at(pyNewline, "") {
+		p.simpleStatements()
+		return
+	}
+	p.next()
+	if !p.at(pyIndent, "") {
+		return
+	}
+	p.next()
+	for !p.at(pyDedent, "") && !p.at(pyEOF, "") {
+		p.statement()
+	}
+	p.next()
+}
+
+// branch parses a block that may not run
+func (p *pyParser) branch() {
+	p.depth++
+	p.suite()
+	p.depth--
+}
+
+func (p *pyParser) statement() {
+	start := p.pos
+	defer func() {
+		if p.pos == start {
+			p.next()
+		}
+	}()
+
+	t := p.peek()
+	switch t.kind {
+	case pyNewline, pyIndent, pyDedent:
+		p.next()
+		return
+	case pyOp:
+		if t.text == "@" {
+			p.next()
+			p.emit(t.line, p.test())
+			if p.at(pyNewline, "") {
+				p.next()
+			}
+			return
+		}
+	case pyName:
+		switch t.text {
+		case "def":
+			p.def()
+			return
+		case "async":
+			p.next()
+			p.statement()
+			return
+		case "class":
+			p.classDef()
+			return
+		case "if", "while":
+			p.next()
+			if t.text == "while" {
+				p.depth++
+			}
+			p.emit(t.line, p.test())
+			if t.text == "while" {
+				p.depth--
+			}
+			p.branch()
+			for p.keyword("elif") {
+				line := p.next().line
+				p.depth++
+				p.emit(line, p.test())
+				p.depth--
+				p.branch()
+			}
+			if p.accept("else") {
+				p.branch()
+			}
+			return
+		case "for":
+			p.next()
+			targets := p.targets(p.exprList())
+			p.accept("in")
+			p.depth++
+			p.emit(t.line, p.testList(), targets...)
+			p.depth--
+			p.branch()
+			if p.accept("else") {
+				p.branch()
+			}
+			return
+		case "try":
+			p.next()
+			p.suite()
+			for p.keyword("except") {
+				line := p.next().line
+				p.accept("*")
+				var targets []string
+				if !p.op(":") {
+					p.test()
+					if p.accept("as") {
+						targets = append(targets, p.next().text)
+					}
+				}
+				p.depth++
+				p.emit(line, lit(line), targets...)
+				p.depth--
+				p.branch()
+			}
+			if p.accept("else") {
+				p.branch()
+			}
+			if p.accept("finally") {
+				p.suite()
+			}
+			return
+		case "with":
+			p.next()
+			parens := p.op("(") && p.withParens()
+			if parens {
+				p.next()
+			}
+			for !p.op(":") && !p.at(pyNewline, "") && !p.at(pyEOF, "") {
+				line := p.peek().line
+				e := p.test()
+				var targets []string
+				if p.accept("as") {
+					targets = p.targets(p.exprOnly())
+				}
+				p.emit(line, e, targets...)
+				if !p.accept(",") {
+					break
+				}
+			}
+			if parens {
+				p.accept(")")
+			}
+			p.suite()
+			return
+		}
+	}
+	p.simpleStatements()
+}
+
+// withParens reports whether the ( after with groups the items, as in
+// with (open(a) as f, open(b) as g):
+func (p *pyParser) withParens() bool {
+	level := 0
+	for i := p.pos; i < len(p.toks); i++ {
+		t := p.toks[i]
+		if t.kind == pyNewline {
+			return false
+		}
+		switch {
+		case t.kind == pyOp && (t.text == "(" || t.text == "[" || t.text == "{"):
+			level++
+		case t.kind == pyOp && (t.text == ")" || t.text == "]" || t.text == "}"):
+			level--
+			if level == 0 {
+				return i+1 < len(p.toks) && p.toks[i+1].text == ":"
+			}
+		}
+	}
+	return false
+}
+
+func (p *pyParser) simpleStatements() {
+	for {
+		p.simple()
+		if !p.accept(";") || p.at(pyNewline, "") {
+			break
+		}
+	}
+	for !p.at(pyNewline, "") && !p.at(pyEOF, "") && !p.at(pyDedent, "") {
+		// Skip the rest of a line that did not parse
+		p.next()
+	}
+	if p.at(pyNewline, "") {
+		p.next()
+	}
+}
+
+func (p *pyParser) simple() {
+	t := p.peek()
+	if t.kind == pyName {
+		switch t.text {
+		case "pass", "break", "continue", "global", "nonlocal", "del":
+			for !p.atEnd() {
+				p.next()
+			}
+			return
+		case "return", "raise", "assert":
+			p.next()
+			if !p.atEnd() {
+				e := p.testList()
+				if t.text == "assert" {
+					e = cond(t.line, e)
+				}
+				p.emit(t.line, e)
+			}
+			for p.accept("from") || p.accept(",") {
+				p.emit(t.line, p.test())
+			}
+			return
+		case "import":
+			p.next()
+			p.importNames()
+			return
+		case "from":
+			p.next()
+			p.fromImport()
+			return
+		}
+	}
+
+	line := t.line
+	first := p.testListStar()
+	switch {
+	case p.op("="):
+		targets := []*expr{first}
+		var value *expr
+		for p.accept("=") {
+			value = p.testListStar()
+			targets = append(targets, value)
+		}
+		targets = targets[:len(targets)-1]
+		p.assign(line, targets, value)
+	case p.op(":"):
+		// Annotated assignment
+		p.next()
+		p.test()
+		if p.accept("=") {
+			p.assign(line, []*expr{first}, p.testListStar())
+		}
+	case p.peek().kind == pyOp && len(p.peek().text) >= 2 && p.peek().text[len(p.peek().text)-1] == '=' &&
+		p.peek().text != "==" && p.peek().text != "<=" && p.peek().text != ">=" && p.peek().text != "!=":
+		// Augmented assignment
+		p.next()
+		value := p.testList()
+		p.assign(line, []*expr{first}, other(line, first, value))
+	default:
+		if first != p.assigned {
+			p.emit(line, first)
+		}
+	}
+}
+
+// assign records an assignment of value to each target
+func (p *pyParser) assign(line int, targets []*expr, value *expr) {
+	for _, target := range targets {
+		if p.subscripts[target] {
+			// An element is set, the rest of the collection keeps its taint
+			p.depth++
+			p.emit(line, value, p.targets(target)...)
+			p.depth--
+			continue
+		}
+		p.emit(line, value, p.targets(target)...)
+	}
+}
+
+// targets returns the paths an assignment to e writes
+func (p *pyParser) targets(e *expr) []string {
+	switch {
+	case p.tuples[e]:
+		var paths []string
+		for _, a := range e.args {
+			paths = append(paths, p.targets(a)...)
+		}
+		return paths
+	case p.subscripts[e]:
+		return p.targets(e.args[0])
+	case e.path != "" && (e.kind == exprName || e.kind == exprAttr):
+		return []string{e.path}
+	}
+	return nil
+}
+
+func (p *pyParser) importNames() {
+	for !p.atEnd() {
+		module := p.dottedName()
+		if p.accept("as") {
+			p.aliases[p.next().text] = module
+		} else if root, _, _ := strings.Cut(module, "."); root != "" {
+			// import os.path binds os
+			p.aliases[root] = root
+		}
+		if !p.accept(",") {
+			return
+		}
+	}
+}
+
+func (p *pyParser) fromImport() {
+	module := p.dottedName()
+	p.accept("import")
+	parens := p.accept("(")
+	for !p.atEnd() && !p.op(")") {
+		if p.accept("*") {
+			break
+		}
+		name := p.next().text
+		local := name
+		if p.accept("as") {
+			local = p.next().text
+		}
+		if module == "" || module[len(module)-1] == '.' {
+			p.aliases[local] = module + name
+		} else {
+			p.aliases[local] = module + "." + name
+		}
+		if !p.accept(",") {
+			break
+		}
+		for p.at(pyNewline, "") {
+			p.next()
+		}
+	}
+	if parens {
+		p.accept(")")
+	}
+}
+
+// dottedName reads a module name such as os.path or ..models
+func (p *pyParser) dottedName() string {
+	name := ""
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == pyOp && (t.text == "." || t.text == "..."):
+			name += t.text
+		case t.kind == pyName && t.text != "import" && t.text != "as" && (name == "" || name[len(name)-1] == '.'):
+			name += t.text
+		default:
+			return name
+		}
+		p.next()
+	}
+}
+
+func (p *pyParser) def() {
+	line := p.next().line // def
+	name := p.next().text
+	if p.class != "" {
+		name = p.class + "." + name
+	}
+	params := p.params("(", ")")
+	if p.class != "" && len(params) > 0 && (params[0] == "self" || params[0] == "cls") {
+		params = params[1:]
+	}
+	if p.accept("->") {
+		p.test()
+	}
+	p.function(name, line, params, p.suite)
+}
+
+// params parses a parameter list up to close, the ) of def or the : of
+// lambda
+func (p *pyParser) params(open, close string) []string {
+	var params []string
+	if open != "" && !p.accept(open) {
+		return nil
+	}
+	for !p.op(close) && !p.at(pyEOF, "") && !p.at(pyNewline, "") {
+		switch {
+		case p.accept("/"), p.accept(","):
+			continue
+		case p.accept("**"), p.accept("*"):
+			if p.op(",") || p.op(close) {
+				continue
+			}
+		}
+		t := p.next()
+		if t.kind != pyName {
+			continue
+		}
+		params = append(params, t.text)
+		if close == ")" && p.accept(":") {
+			p.test()
+		}
+		if p.accept("=") {
+			p.test()
+		}
+	}
+	if close == ")" {
+		p.accept(")")
+	}
+	return params
+}
+
+func (p *pyParser) classDef() {
+	p.next() // class
+	name := p.next().text
+	if p.accept("(") {
+		for !p.op(")") && !p.at(pyEOF, "") && !p.at(pyNewline, "") {
+			p.test()
+			p.accept("=")
+			p.accept(",")
+		}
+		p.accept(")")
+	}
+	if p.class != "" {
+		name = p.class + "." + name
+	}
+	outer := p.class
+	p.class = name
+	p.suite()
+	p.class = outer
+}
+
+// testListStar parses expressions separated by commas, which form a tuple
+func (p *pyParser) testListStar() *expr {
+	line := p.peek().line
+	first := p.starTest()
+	if !p.op(",") {
+		return first
+	}
+	tuple := other(line, first)
+	p.tuples[tuple] = true
+	for p.accept(",") {
+		if p.atEnd() || p.op("=") || p.op(")") || p.op(":") {
+			break
+		}
+		tuple.args = append(tuple.args, p.starTest())
+	}
+	return tuple
+}
+
+func (p *pyParser) testList() *expr {
+	return p.testListStar()
+}
+
+func (p *pyParser) starTest() *expr {
+	if p.accept("*") {
+		return p.bitwise(0)
+	}
+	return p.test()
+}
+
+// exprList parses the targets of for and comprehensions, which stop
+// before in
+func (p *pyParser) exprList() *expr {
+	line := p.peek().line
+	first := p.exprOnly()
+	if !p.op(",") {
+		return first
+	}
+	tuple := other(line, first)
+	p.tuples[tuple] = true
+	for p.accept(",") && !p.keyword("in") {
+		tuple.args = append(tuple.args, p.exprOnly())
+	}
+	return tuple
+}
+
+func (p *pyParser) exprOnly() *expr {
+	p.accept("*")
+	return p.bitwise(0)
+}
+
+func (p *pyParser) test() *expr {
+	if p.nesting > maxNesting {
+		return lit(p.next().line)
+	}
+	p.nesting++
+	defer func() { p.nesting-- }()
+
+	t := p.peek()
+	if t.kind == pyName && t.text == "lambda" {
+		p.next()
+		params := p.params("", ":")
+		p.accept(":")
+		p.function(fmt.Sprintf("<lambda:%d>", t.line), t.line, params, func() {
+			line := p.peek().line
+			p.emit(line, p.test())
+		})
+		return lit(t.line)
+	}
+	if t.kind == pyName && p.pos+1 < len(p.toks) && p.toks[p.pos+1].text == ":=" {
+		p.pos += 2
+		value := p.test()
+		p.emit(t.line, value, t.text)
+		return value
+	}
+
+	e := p.orTest()
+	if p.keyword("if") {
+		p.next()
+		c := p.orTest()
+		p.accept("else")
+		alt := p.test()
+		return other(e.line, cond(e.line, c), e, alt)
+	}
+	return e
+}
+
+func (p *pyParser) orTest() *expr {
+	e := p.andTest()
+	for p.accept("or") {
+		e = other(e.line, e, p.andTest())
+	}
+	return e
+}
+
+func (p *pyParser) andTest() *expr {
+	e := p.notTest()
+	for p.accept("and") {
+		e = other(e.line, e, p.notTest())
+	}
+	return e
+}
+
+func (p *pyParser) notTest() *expr {
+	if t := p.peek(); t.kind == pyName && t.text == "not" {
+		p.next()
+		return cond(t.line, p.notTest())
+	}
+	return p.comparison()
+}
+
+func (p *pyParser) comparison() *expr {
+	e := p.bitwise(0)
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == pyOp && (t.text == "<" || t.text == ">" || t.text == "==" || t.text == ">=" || t.text == "<=" || t.text == "!="):
+			p.next()
+		case t.kind == pyName && (t.text == "in" || t.text == "is"):
+			p.next()
+			p.accept("not")
+		case t.kind == pyName && t.text == "not" && p.pos+1 < len(p.toks) && p.toks[p.pos+1].text == "in":
+			p.pos += 2
+		default:
+			return e
+		}
+		e = cond(e.line, e, p.bitwise(0))
+	}
+}
+
+// Binary operators by precedence, lowest first
+var pyBinary = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "//", "%", "@"},
+}
+
+func (p *pyParser) bitwise(level int) *expr {
+	if level == len(pyBinary) {
+		return p.factor()
+	}
+	e := p.bitwise(level + 1)
+	for {
+		t := p.peek()
+		found := false
+		for _, op := range pyBinary[level] {
+			if t.kind == pyOp && t.text == op {
+				found = true
+			}
+		}
+		if !found {
+			return e
+		}
+		p.next()
+		e = other(e.line, e, p.bitwise(level+1))
+	}
+}
+
+func (p *pyParser) factor() *expr {
+	if t := p.peek(); t.kind == pyOp && (t.text == "-" || t.text == "+" || t.text == "~") {
+		p.next()
+		return p.factor()
+	}
+	p.accept("await")
+	e := p.trailers(p.atom())
+	if p.accept("**") {
+		e = other(e.line, e, p.factor())
+	}
+	return e
+}
+
+func (p *pyParser) trailers(e *expr) *expr {
+	for {
+		t := p.peek()
+		if t.kind != pyOp {
+			return e
+		}
+		switch t.text {
+		case ".":
+			p.next()
+			e = member(e, p.next().text, t.line)
+		case "[":
+			p.next()
+			index := p.subscript()
+			p.accept("]")
+			if index.kind == exprLit && index.value != "" {
+				e = member(e, index.value, t.line)
+			} else {
+				e = other(t.line, e, cond(t.line, index))
+				p.subscripts[e] = true
+			}
+		case "(":
+			e = p.call(e)
+		default:
+			return e
+		}
+	}
+}
+
+func (p *pyParser) subscript() *expr {
+	line := p.peek().line
+	e := other(line)
+	for !p.op("]") && !p.at(pyEOF, "") {
+		if p.accept(":") || p.accept(",") {
+			continue
+		}
+		e.args = append(e.args, p.test())
+	}
+	if len(e.args) == 1 {
+		return e.args[0]
+	}
+	return e
+}
+
+func (p *pyParser) call(fun *expr) *expr {
+	line := p.next().line // (
+	call := callOf(fun, line)
+	for !p.op(")") && !p.at(pyEOF, "") {
+		if p.accept("**") || p.accept("*") {
+			call.args = append(call.args, p.test())
+		} else if t := p.peek(); t.kind == pyName && p.pos+1 < len(p.toks) && p.toks[p.pos+1].text == "=" {
+			p.pos += 2
+			if call.keywords == nil {
+				call.keywords = make(map[string]*expr)
+			}
+			call.keywords[t.text] = p.test()
+		} else {
+			arg := p.test()
+			if p.keyword("for") || p.keyword("async") {
+				arg = p.comprehension(arg)
+			}
+			call.args = append(call.args, arg)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.accept(")")
+	return call
+}
+
+// comprehension parses the for and if clauses after the element; the
+// result is tainted if an iterable is
+func (p *pyParser) comprehension(elem *expr) *expr {
+	e := other(elem.line, elem)
+	for {
+		switch {
+		case p.accept("async"):
+		case p.accept("for"):
+			p.exprList()
+			p.accept("in")
+			e.args = append(e.args, p.orTest())
+		case p.accept("if"):
+			e.args = append(e.args, cond(e.line, p.orTest()))
+		default:
+			return e
+		}
+	}
+}
+
+func (p *pyParser) atom() *expr {
+	t := p.peek()
+	switch t.kind {
+	case pyNumber:
+		p.next()
+		return lit(t.line)
+	case pyString:
+		// Adjacent literals are concatenated
+		e := other(t.line)
+		value := ""
+		for p.at(pyString, "") {
+			s := p.next()
+			value += s.text
+			for _, part := range s.parts {
+				toks, pos := p.toks, p.pos
+				p.toks, p.pos = part, 0
+				e.args = append(e.args, p.testList())
+				p.toks, p.pos = toks, pos
+			}
+		}
+		if len(e.args) == 0 {
+			return &expr{kind: exprLit, value: value, line: t.line}
+		}
+		return e
+	case pyName:
+		switch t.text {
+		case "None", "True", "False":
+			p.next()
+			return lit(t.line)
+		case "yield":
+			p.next()
+			p.accept("from")
+			if p.atEnd() || p.op(")") {
+				return lit(t.line)
+			}
+			return p.testList()
+		}
+		p.next()
+		name := t.text
+		if module, ok := p.aliases[name]; ok {
+			name = module
+		}
+		return &expr{kind: exprName, name: name, path: t.text, line: t.line}
+	case pyOp:
+		switch t.text {
+		case "(":
+			p.next()
+			if p.accept(")") {
+				return lit(t.line)
+			}
+			e := p.testListStar()
+			if p.keyword("for") || p.keyword("async") {
+				e = p.comprehension(e)
+			}
+			p.accept(")")
+			return e
+		case "[", "{":
+			return p.display()
+		case "...":
+			p.next()
+			return lit(t.line)
+		}
+	}
+	p.next()
+	return lit(t.line)
+}
+
+// display parses a list, set or dict display or comprehension
+func (p *pyParser) display() *expr {
+	open := p.next()
+	close := "]"
+	if open.text == "{" {
+		close = "}"
+	}
+	e := other(open.line)
+	for !p.op(close) && !p.at(pyEOF, "") {
+		if p.accept(",") {
+			continue
+		}
+		var item *expr
+		if p.accept("**") {
+			item = p.bitwise(0)
+		} else {
+			item = p.starTest()
+			if p.accept(":") {
+				item = p.test()
+			}
+		}
+		if p.keyword("for") || p.keyword("async") {
+			item = p.comprehension(item)
+		}
+		e.args = append(e.args, item)
+	}
+	p.accept(close)
+	return e
+}
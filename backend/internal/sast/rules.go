@@ -0,0 +1,219 @@
+package sast
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed rules/*.yaml
+var defaultRules embed.FS
+
+// Languages with a parser
+const (
+	LangGo         = "go"
+	LangJavaScript = "javascript"
+	LangPython     = "python"
+)
+
+// Sink is a call whose arguments must not be attacker controlled
+type Sink struct {
+	// Call is a name pattern, see Rule
+	Call string `yaml:"call" json:"call"`
+	// Args lists the checked positions, counted from 0 without the
+	// receiver. Empty means every argument.
+	Args []int `yaml:"args,omitempty" json:"args,omitempty"`
+	// Keywords lists checked keyword arguments (Python)
+	Keywords []string `yaml:"keywords,omitempty" json:"keywords,omitempty"`
+}
+
+// Rule reports data flowing from a source to a sink without passing a
+// sanitizer. Sources, sinks and sanitizers are name patterns where *
+// matches any text, including dots. Go names are qualified with the
+// package path and receiver type, e.g. database/sql.DB.Query or
+// net/http.Request.FormValue; JavaScript and Python names are written as
+// in the code, with imports resolved, e.g. child_process.exec or
+// flask.request.args.
+type Rule struct {
+	ID         string   `yaml:"id" json:"id"`
+	Language   string   `yaml:"-" json:"language"`
+	Title      string   `yaml:"title" json:"title"`
+	CWE        string   `yaml:"cwe" json:"cwe"`
+	Severity   string   `yaml:"severity" json:"severity"`
+	Message    string   `yaml:"message" json:"message"`
+	Fix        string   `yaml:"fix" json:"fix"`
+	Sources    []string `yaml:"sources" json:"sources"`
+	Sinks      []Sink   `yaml:"sinks" json:"sinks"`
+	Sanitizers []string `yaml:"sanitizers" json:"sanitizers,omitempty"`
+}
+
+// ruleFile is the layout of a rules file. Its sources and sanitizers are
+// shared by all of its rules.
+type ruleFile struct {
+	Language   string   `yaml:"language"`
+	Sources    []string `yaml:"sources"`
+	Sanitizers []string `yaml:"sanitizers"`
+	Rules      []Rule   `yaml:"rules"`
+}
+
+var severities = []string{"Critical", "High", "Medium", "Low", "Info"}
+
+// LoadRules returns the built-in rules and those in the *.yaml files of
+// dir, if any. A rule in dir replaces the built-in rule with the same ID.
+func LoadRules(dir string) ([]Rule, error) {
+	rules, err := loadRules(defaultRules, "rules")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return rules, nil
+	}
+	custom, err := loadRules(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int, len(rules))
+	for i, r := range rules {
+		index[r.ID] = i
+	}
+	for _, r := range custom {
+		if i, ok := index[r.ID]; ok {
+			rules[i] = r
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func loadRules(fsys fs.FS, dir string) ([]Rule, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := fs.Glob(fsys, path.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	var rules []Rule
+	seen := make(map[string]string)
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := ParseRules(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, r := range parsed {
+			if prev, dup := seen[r.ID]; dup {
+				return nil, fmt.Errorf("%s: duplicate rule id %s (first defined in %s)", name, r.ID, prev)
+			}
+			seen[r.ID] = name
+		}
+		rules = append(rules, parsed...)
+	}
+	return rules, nil
+}
+
+// ParseRules reads the rules of one file
+func ParseRules(data []byte) ([]Rule, error) {
+	var file ruleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	switch file.Language {
+	case LangGo, LangJavaScript, LangPython:
+	default:
+		return nil, fmt.Errorf("language must be %s, %s or %s, not %q", LangGo, LangJavaScript, LangPython, file.Language)
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	for _, r := range file.Rules {
+		r.Language = file.Language
+		r.Sources = append(append([]string{}, file.Sources...), r.Sources...)
+		r.Sanitizers = append(append([]string{}, file.Sanitizers...), r.Sanitizers...)
+		if r.Severity == "" {
+			r.Severity = "Medium"
+		}
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (r *Rule) validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("rule without id")
+	}
+	if r.Title == "" {
+		return fmt.Errorf("rule %s: title is required", r.ID)
+	}
+	if len(r.Sources) == 0 {
+		return fmt.Errorf("rule %s: no sources", r.ID)
+	}
+	if len(r.Sinks) == 0 {
+		return fmt.Errorf("rule %s: no sinks", r.ID)
+	}
+	for _, s := range r.Sinks {
+		if s.Call == "" {
+			return fmt.Errorf("rule %s: sink without call", r.ID)
+		}
+	}
+	for _, s := range severities {
+		if r.Severity == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("rule %s: severity must be one of %s", r.ID, strings.Join(severities, ", "))
+}
+
+// match reports whether name matches any of the patterns
+func match(patterns []string, name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, p := range patterns {
+		if glob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// glob matches name against a pattern where * stands for any text
+func glob(pattern, name string) bool {
+	star, next := -1, 0
+	p, n := 0, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, n
+			p++
+		case p < len(pattern) && pattern[p] == name[n]:
+			p++
+			n++
+		case star >= 0:
+			// Let the last star absorb one more character
+			next++
+			p, n = star+1, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,117 @@
+package sast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findRule(rules []Rule, id string) *Rule {
+	for i := range rules {
+		if rules[i].ID == id {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func TestLoadRules_Default(t *testing.T) {
+	rules, err := LoadRules("")
+	require.NoError(t, err)
+
+	for _, lang := range []string{"go", "js", "py"} {
+		for _, kind := range []string{"sql-injection", "command-injection", "path-traversal", "ssrf", "template-injection"} {
+			assert.NotNil(t, findRule(rules, lang+"-"+kind), lang+"-"+kind)
+		}
+	}
+	r := findRule(rules, "py-ssrf")
+	require.NotNil(t, r)
+	assert.Equal(t, LangPython, r.Language)
+	assert.Equal(t, "CWE-918", r.CWE)
+	// Shared sources of the file come first
+	assert.Contains(t, r.Sources, "flask.request.args*")
+}
+
+func TestLoadRules_Custom(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "team.yml"), []byte(`
+language: python
+sources: [config.untrusted]
+rules:
+  - id: py-ssrf
+    title: SSRF from config
+    cwe: CWE-918
+    sinks:
+      - call: urllib3.request
+  - id: py-log-injection
+    title: Log injection
+    severity: Low
+    sources: [flask.request.*]
+    sinks:
+      - call: logging.info
+        args: [0]
+`), 0o644))
+
+	rules, err := LoadRules(dir)
+	require.NoError(t, err)
+
+	r := findRule(rules, "py-ssrf")
+	require.NotNil(t, r)
+	assert.Equal(t, "SSRF from config", r.Title)
+	assert.Equal(t, []string{"config.untrusted"}, r.Sources)
+
+	r = findRule(rules, "py-log-injection")
+	require.NotNil(t, r)
+	assert.Equal(t, "Low", r.Severity)
+	assert.Equal(t, []string{"config.untrusted", "flask.request.*"}, r.Sources)
+
+	findings, err := NewAnalyzer(rules).AnalyzeFile("app.py", []byte(`
+import logging
+from flask import request
+
+def view():
+    logging.info("user " + request.args["user"])
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"py-log-injection app.py:6"}, locations(findings))
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"language":  "language: ruby\nrules: []",
+		"id":        "language: go\nrules:\n  - title: x\n    sources: [a]\n    sinks: [{call: b}]",
+		"title":     "language: go\nrules:\n  - id: x\n    sources: [a]\n    sinks: [{call: b}]",
+		"sources":   "language: go\nrules:\n  - id: x\n    title: x\n    sinks: [{call: b}]",
+		"sinks":     "language: go\nrules:\n  - id: x\n    title: x\n    sources: [a]",
+		"sink call": "language: go\nrules:\n  - id: x\n    title: x\n    sources: [a]\n    sinks: [{args: [0]}]",
+		"severity":  "language: go\nrules:\n  - id: x\n    title: x\n    severity: urgent\n    sources: [a]\n    sinks: [{call: b}]",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseRules([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadRules_Duplicate(t *testing.T) {
+	dir := t.TempDir()
+	rule := "language: go\nrules:\n  - id: x\n    title: x\n    sources: [a]\n    sinks: [{call: b}]\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte(rule), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yaml"), []byte(rule), 0o644))
+
+	_, err := LoadRules(dir)
+	assert.ErrorContains(t, err, "duplicate rule id x")
+}
+
+func TestGlob(t *testing.T) {
+	assert.True(t, glob("flask.request.args*", "flask.request.args.get"))
+	assert.True(t, glob("*.execute", "sqlite3.Cursor.execute"))
+	assert.True(t, glob("os.system", "os.system"))
+	assert.False(t, glob("os.system", "os.systemd"))
+	assert.False(t, glob("request.GET*", "flask.request.GET"))
+	assert.False(t, match(nil, "eval"))
+}
@@ -0,0 +1,198 @@
+package sast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/scanner"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOutsideRoot  = errors.New("path is outside the directory open to scans")
+	ErrNotDirectory = errors.New("path is not a directory")
+)
+
+// Scanner runs the analyzer over directories below root as a
+// scanner.Scanner. Scans and findings are stored like those of the other
+// scanners, with type SAST.
+type Scanner struct {
+	db       *gorm.DB
+	analyzer *Analyzer
+	root     string
+	emitter  events.Emitter
+	// A scan is cancelled after Timeout
+	Timeout time.Duration
+}
+
+func NewScanner(db *gorm.DB, analyzer *Analyzer, root string) *Scanner {
+	return &Scanner{db: db, analyzer: analyzer, root: root, Timeout: 30 * time.Minute}
+}
+
+func (s *Scanner) Analyzer() *Analyzer {
+	return s.analyzer
+}
+
+// SetEmitter emits the findings and completion of scans started
+// afterwards
+func (s *Scanner) SetEmitter(e events.Emitter) {
+	s.emitter = e
+}
+
+// resolve returns the directory for a target relative to root. Symbolic
+// links are followed before checking it is inside root.
+func (s *Scanner) resolve(target string) (string, error) {
+	root, err := filepath.Abs(s.root)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, target)
+	if filepath.IsAbs(target) {
+		dir = filepath.Clean(target)
+	}
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideRoot
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", ErrNotDirectory
+	}
+	return dir, nil
+}
+
+// Start scans the directory target, relative to the root
+func (s *Scanner) Start(ctx context.Context, target string) (string, error) {
+	dir, err := s.resolve(target)
+	if err != nil {
+		return "", err
+	}
+	scanID := fmt.Sprintf("sast-%d", time.Now().UnixNano())
+	result := scanner.ScanResult{
+		ScanID:    scanID,
+		Target:    target,
+		Status:    "running",
+		Type:      "SAST",
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.Create(&result).Error; err != nil {
+		return "", err
+	}
+
+	go s.runScan(scanID, target, dir)
+	return scanID, nil
+}
+
+func (s *Scanner) runScan(scanID, target, dir string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	status := "completed"
+	findings, err := s.analyzer.AnalyzeDir(ctx, dir)
+	if err != nil {
+		fmt.Printf("SAST scan %s failed: %v\n", scanID, err)
+		status = "failed"
+	}
+
+	completed := events.ScanCompleted{
+		ScanID:     scanID,
+		Target:     target,
+		Status:     status,
+		Findings:   len(findings),
+		BySeverity: make(map[string]int),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, f := range findings {
+			v := f.Vuln()
+			v.ScanID = scanID
+			if err := tx.Create(&v).Error; err != nil {
+				return err
+			}
+			completed.BySeverity[v.Severity]++
+			if s.emitter == nil {
+				continue
+			}
+			err := s.emitter.EmitTx(tx, events.FindingCreated{
+				ScanID:    scanID,
+				Target:    target,
+				FindingID: v.ID,
+				Title:     v.Title,
+				Severity:  v.Severity,
+				Category:  v.Category,
+				Solution:  v.Solution,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Model(&scanner.ScanResult{}).Where("scan_id = ?", scanID).
+			Updates(map[string]any{"status": status, "updated_at": time.Now()}).Error
+		if err != nil || s.emitter == nil {
+			return err
+		}
+		return s.emitter.EmitTx(tx, completed)
+	})
+	if err != nil {
+		fmt.Printf("Failed to save SAST scan %s: %v\n", scanID, err)
+		s.db.Model(&scanner.ScanResult{}).Where("scan_id = ?", scanID).Update("status", "failed")
+	}
+}
+
+// Vuln converts a finding to the form stored for every scanner
+func (f Finding) Vuln() scanner.Vuln {
+	var desc strings.Builder
+	desc.WriteString(f.Message)
+	desc.WriteString("\n\nData flow:")
+	for i, step := range f.Trace {
+		fmt.Fprintf(&desc, "\n%d. %s:%d %s\n   %s", i+1, step.File, step.Line, step.Note, step.Code)
+	}
+	return scanner.Vuln{
+		Title:       fmt.Sprintf("%s (%s)", f.Title, f.RuleID),
+		Description: desc.String(),
+		Severity:    f.Severity,
+		Category:    "SAST",
+		Solution:    f.Fix,
+		File:        f.File,
+		Line:        f.Line,
+		CWE:         f.CWE,
+		Trace:       f.Trace,
+	}
+}
+
+func (s *Scanner) GetStatus(ctx context.Context, scanID string) (string, int, error) {
+	var result scanner.ScanResult
+	if err := s.db.Where("scan_id = ? AND type = ?", scanID, "SAST").First(&result).Error; err != nil {
+		return "unknown", 0, fmt.Errorf("scan not found")
+	}
+	progress := 0
+	if result.Status != "running" {
+		progress = 100
+	}
+	return result.Status, progress, nil
+}
+
+func (s *Scanner) GetResults(ctx context.Context, scanID string) (*scanner.ScanResult, error) {
+	var result scanner.ScanResult
+	if err := s.db.Preload("Vulnerabilities").Where("scan_id = ? AND type = ?", scanID, "SAST").First(&result).Error; err != nil {
+		return nil, fmt.Errorf("scan not found")
+	}
+	return &result, nil
+}
+
+func (s *Scanner) GetHistory(ctx context.Context) ([]*scanner.ScanResult, error) {
+	var history []*scanner.ScanResult
+	err := s.db.Where("type = ?", "SAST").Order("created_at desc").Find(&history).Error
+	return history, err
+}
@@ -0,0 +1,135 @@
+package sast
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/scanner"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestScanner(t *testing.T, root string) *Scanner {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&scanner.ScanResult{}, &scanner.Vuln{}))
+	return NewScanner(db, newTestAnalyzer(t), root)
+}
+
+func TestScanner_Start(t *testing.T) {
+	s := newTestScanner(t, "testdata")
+	ctx := context.Background()
+
+	scanID, err := s.Start(ctx, "py")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		status, _, err := s.GetStatus(ctx, scanID)
+		return err == nil && status == "completed"
+	}, 10*time.Second, 20*time.Millisecond)
+
+	result, err := s.GetResults(ctx, scanID)
+	require.NoError(t, err)
+	assert.Equal(t, "SAST", result.Type)
+	require.Len(t, result.Vulnerabilities, 6)
+
+	v := result.Vulnerabilities[0]
+	assert.Equal(t, "SQL injection (py-sql-injection)", v.Title)
+	assert.Equal(t, "views.py", v.File)
+	assert.Equal(t, 16, v.Line)
+	assert.Equal(t, "CWE-89", v.CWE)
+	require.Len(t, v.Trace, 2)
+	assert.Equal(t, `name = request.args.get("name")`, v.Trace[0].Code)
+	assert.Contains(t, v.Description, "Data flow:\n1. views.py:13")
+
+	history, err := s.GetHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "py", history[0].Target)
+}
+
+func TestScanner_OutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "app"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app", "main.py"), nil, 0o644))
+	require.NoError(t, os.Symlink(os.TempDir(), filepath.Join(root, "tmp")))
+	s := newTestScanner(t, root)
+
+	for _, target := range []string{"..", "../etc", "/etc", "tmp", "app/../.."} {
+		_, err := s.Start(context.Background(), target)
+		assert.ErrorIs(t, err, ErrOutsideRoot, target)
+	}
+	_, err := s.Start(context.Background(), "app/main.py")
+	assert.ErrorIs(t, err, ErrNotDirectory)
+	_, err = s.Start(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotDirectory)
+
+	scanID, err := s.Start(context.Background(), "app")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		status, _, _ := s.GetStatus(context.Background(), scanID)
+		return status == "completed"
+	}, 10*time.Second, 20*time.Millisecond)
+}
+
+func TestScanner_EmitsFindings(t *testing.T) {
+	s := newTestScanner(t, "testdata")
+	emitted := &recordingEmitter{}
+	s.SetEmitter(emitted)
+	ctx := context.Background()
+
+	scanID, err := s.Start(ctx, "py")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		status, _, err := s.GetStatus(ctx, scanID)
+		return err == nil && status == "completed"
+	}, 10*time.Second, 20*time.Millisecond)
+
+	emitted.mu.Lock()
+	defer emitted.mu.Unlock()
+	require.Len(t, emitted.payloads, 7)
+	finding, ok := emitted.payloads[0].(events.FindingCreated)
+	require.True(t, ok)
+	assert.Equal(t, scanID, finding.ScanID)
+	assert.Equal(t, "py", finding.Target)
+	assert.Equal(t, "SQL injection (py-sql-injection)", finding.Title)
+	assert.NotZero(t, finding.FindingID)
+	completed, ok := emitted.payloads[6].(events.ScanCompleted)
+	require.True(t, ok)
+	assert.Equal(t, "completed", completed.Status)
+	assert.Equal(t, 6, completed.Findings)
+	assert.Equal(t, 7, emitted.inTx, "events are written with the findings")
+}
+
+type recordingEmitter struct {
+	mu       sync.Mutex
+	payloads []events.Payload
+	inTx     int
+}
+
+func (r *recordingEmitter) Emit(p events.Payload) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloads = append(r.payloads, p)
+	return nil
+}
+
+func (r *recordingEmitter) EmitTx(tx *gorm.DB, p events.Payload) error {
+	if tx != nil {
+		r.mu.Lock()
+		r.inTx++
+		r.mu.Unlock()
+	}
+	return r.Emit(p)
+}
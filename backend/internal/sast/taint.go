@@ -0,0 +1,365 @@
+package sast
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cybershield-ai/core/internal/scanner"
+)
+
+// Finding is a flow from a source to a sink
+type Finding struct {
+	RuleID   string `json:"rule_id"`
+	Title    string `json:"title"`
+	CWE      string `json:"cwe"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Fix      string `json:"fix"`
+	// Location of the sink
+	File  string              `json:"file"`
+	Line  int                 `json:"line"`
+	Trace []scanner.TraceStep `json:"trace"`
+}
+
+type step struct {
+	file *sourceFile
+	line int
+	note string
+}
+
+// summary records that a parameter of a function reaches a sink
+type summary struct {
+	param int
+	trace []step
+}
+
+// Rounds of summaries, i.e. how many calls deep a flow is followed
+const summaryRounds = 3
+
+// analyze runs every rule over the functions of its language. Parameters
+// that reach a sink are summarised first, so calls passing tainted data to
+// such functions are reported as well.
+func analyze(files []*sourceFile, rules []Rule) []Finding {
+	var findings []Finding
+	for i := range rules {
+		rule := &rules[i]
+		var funcs []*function
+		for _, f := range files {
+			if f.lang == rule.Language {
+				funcs = append(funcs, f.funcs...)
+			}
+		}
+		if len(funcs) == 0 {
+			continue
+		}
+
+		// Calls whose callee cannot be named exactly, such as methods of
+		// objects of unknown type, are matched by the last part of the
+		// name if only one function has it
+		byShort := make(map[string][]string)
+		for _, fn := range funcs {
+			short := shortName(fn.name)
+			byShort[short] = append(byShort[short], fn.name)
+		}
+
+		var sums map[string][]summary
+		for round := 0; round < summaryRounds; round++ {
+			next := make(map[string][]summary)
+			for _, fn := range funcs {
+				if len(fn.params) == 0 {
+					continue
+				}
+				// One parameter at a time, as only the first tainted
+				// operand of an expression is followed
+				for i, p := range fn.params {
+					t := newTaint(rule, sums, byShort, fn.file)
+					t.fromParams = true
+					t.state[p] = []step{{file: fn.file, line: fn.line, note: "parameter " + p + " of " + shortName(fn.name)}}
+					t.run(fn)
+					for _, trace := range t.findings {
+						next[fn.name] = append(next[fn.name], summary{param: i, trace: trace})
+					}
+				}
+			}
+			sums = next
+		}
+
+		seen := make(map[string]bool)
+		for _, fn := range funcs {
+			t := newTaint(rule, sums, byShort, fn.file)
+			t.run(fn)
+			for _, trace := range t.findings {
+				key := trace[len(trace)-1].key()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				findings = append(findings, newFinding(rule, trace))
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+func newFinding(rule *Rule, trace []step) Finding {
+	sink := trace[len(trace)-1]
+	f := Finding{
+		RuleID:   rule.ID,
+		Title:    rule.Title,
+		CWE:      rule.CWE,
+		Severity: rule.Severity,
+		Message:  rule.Message,
+		Fix:      rule.Fix,
+		File:     sink.file.path,
+		Line:     sink.line,
+	}
+	for _, s := range trace {
+		f.Trace = append(f.Trace, scanner.TraceStep{File: s.file.path, Line: s.line, Code: s.file.code(s.line), Note: s.note})
+	}
+	return f
+}
+
+// taint tracks the variables holding data from a rule's sources through
+// one function
+type taint struct {
+	rule      *Rule
+	summaries map[string][]summary
+	byShort   map[string][]string
+	file      *sourceFile
+	state     map[string][]step
+	findings  [][]step
+	reported  map[string]bool
+	// Only flows from the parameters are followed, to summarise the
+	// function
+	fromParams bool
+}
+
+func newTaint(rule *Rule, summaries map[string][]summary, byShort map[string][]string, file *sourceFile) *taint {
+	return &taint{
+		rule:      rule,
+		summaries: summaries,
+		byShort:   byShort,
+		file:      file,
+		state:     make(map[string][]step),
+		reported:  make(map[string]bool),
+	}
+}
+
+// run walks the body until no more variables become tainted, so flows
+// around loops are found
+func (t *taint) run(fn *function) {
+	for pass := 0; pass < 3; pass++ {
+		changed := false
+		for _, s := range fn.body {
+			t.checkSinks(s.value)
+			if len(s.targets) == 0 {
+				continue
+			}
+			trace := t.eval(s.value)
+			for _, target := range s.targets {
+				if trace != nil {
+					if t.state[target] == nil {
+						changed = true
+					}
+					t.state[target] = t.extend(trace, s.line, "assigned to "+target)
+				} else if !s.branch || t.sanitizer(s.value) {
+					t.clear(target)
+				}
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+func (t *taint) clear(target string) {
+	delete(t.state, target)
+	for path := range t.state {
+		if strings.HasPrefix(path, target+".") {
+			delete(t.state, path)
+		}
+	}
+}
+
+// eval returns the flow into the value of e, or nil if it is not tainted
+func (t *taint) eval(e *expr) []step {
+	if e == nil {
+		return nil
+	}
+	switch e.kind {
+	case exprName, exprAttr:
+		if t.source(e) {
+			return []step{{file: t.file, line: e.line, note: "source " + e.display()}}
+		}
+		if trace := t.lookup(e.path); trace != nil {
+			return trace
+		}
+		if e.kind == exprAttr {
+			return t.eval(e.x)
+		}
+	case exprCall:
+		if t.sanitizer(e) {
+			return nil
+		}
+		if t.source(e) {
+			return []step{{file: t.file, line: e.line, note: "source " + e.display() + "()"}}
+		}
+		fallthrough
+	case exprOther:
+		if trace := t.eval(e.x); trace != nil {
+			return trace
+		}
+		for _, a := range e.args {
+			if trace := t.eval(a); trace != nil {
+				return trace
+			}
+		}
+		for _, k := range sortedKeys(e.keywords) {
+			if trace := t.eval(e.keywords[k]); trace != nil {
+				return trace
+			}
+		}
+	}
+	return nil
+}
+
+func (t *taint) source(e *expr) bool {
+	return !t.fromParams && match(t.rule.Sources, e.name)
+}
+
+func (t *taint) sanitizer(e *expr) bool {
+	return e != nil && e.kind == exprCall && match(t.rule.Sanitizers, e.name)
+}
+
+// lookup finds the taint of a path or of the object it is part of
+func (t *taint) lookup(path string) []step {
+	for path != "" {
+		if trace, ok := t.state[path]; ok {
+			return trace
+		}
+		i := strings.LastIndexByte(path, '.')
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return nil
+}
+
+// checkSinks reports tainted arguments of sinks, and of functions whose
+// parameters reach a sink
+func (t *taint) checkSinks(value *expr) {
+	value.walk(func(e *expr) {
+		if e.kind != exprCall {
+			return
+		}
+		for _, sink := range t.rule.Sinks {
+			if !glob(sink.Call, e.name) {
+				continue
+			}
+			for _, arg := range sinkArgs(e, sink) {
+				if trace := t.eval(arg); trace != nil {
+					t.report(t.extend(trace, e.line, "reaches "+e.display()))
+					break
+				}
+			}
+		}
+		for _, s := range t.summaryFor(e) {
+			if s.param >= len(e.args) {
+				continue
+			}
+			if trace := t.eval(e.args[s.param]); trace != nil {
+				trace = t.extend(trace, e.line, "passed to "+e.display())
+				t.report(append(trace, s.trace...))
+			}
+		}
+	})
+}
+
+func sinkArgs(call *expr, sink Sink) []*expr {
+	if len(sink.Args) == 0 && len(sink.Keywords) == 0 {
+		args := append([]*expr{}, call.args...)
+		for _, k := range sortedKeys(call.keywords) {
+			args = append(args, call.keywords[k])
+		}
+		return args
+	}
+	var args []*expr
+	for _, i := range sink.Args {
+		if i >= 0 && i < len(call.args) {
+			args = append(args, call.args[i])
+		}
+	}
+	for _, k := range sink.Keywords {
+		if a, ok := call.keywords[k]; ok {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// summaryFor returns the summaries of the function a call may reach
+func (t *taint) summaryFor(call *expr) []summary {
+	if t.summaries == nil {
+		return nil
+	}
+	if s, ok := t.summaries[call.name]; ok {
+		return s
+	}
+	if names := t.byShort[shortName(call.name)]; len(names) == 1 {
+		return t.summaries[names[0]]
+	}
+	return nil
+}
+
+// report records a flow once per sink
+func (t *taint) report(trace []step) {
+	key := trace[len(trace)-1].key()
+	if t.reported[key] {
+		return
+	}
+	t.reported[key] = true
+	t.findings = append(t.findings, trace)
+}
+
+// extend returns a copy of trace followed by a step on line of the current
+// file; steps on the same line are merged
+func (t *taint) extend(trace []step, line int, note string) []step {
+	out := make([]step, len(trace), len(trace)+1)
+	copy(out, trace)
+	if last := &out[len(out)-1]; last.file == t.file && last.line == line {
+		last.note += ", " + note
+		return out
+	}
+	return append(out, step{file: t.file, line: line, note: note})
+}
+
+// key identifies the location of a step
+func (s step) key() string {
+	return s.file.path + ":" + strconv.Itoa(s.line)
+}
+
+// shortName is the last part of a dotted name
+func shortName(name string) string {
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+func sortedKeys(m map[string]*expr) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
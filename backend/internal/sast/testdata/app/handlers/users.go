@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	db *sql.DB
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	query := "SELECT * FROM users WHERE id = " + id
+	rows, err := h.db.Query(query)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+}
+
+func (h *Handler) GetUserSafe(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		return
+	}
+	h.db.Query(fmt.Sprintf("SELECT * FROM users WHERE id = %d", id))
+	h.db.Query("SELECT * FROM users WHERE name = ?", r.FormValue("name"))
+}
+
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("file")
+	data, _ := os.ReadFile(filepath.Join("/srv/files", name))
+	w.Write(data)
+
+	safe := filepath.Base(r.FormValue("file"))
+	os.ReadFile(filepath.Join("/srv/files", safe))
+}
+
+func Ping(c *gin.Context) {
+	host := c.Query("host")
+	run(host)
+}
+
+func run(target string) {
+	cmd := exec.Command("sh", "-c", "ping -c 1 "+target)
+	cmd.Run()
+}
@@ -0,0 +1,57 @@
+import os
+import subprocess as sp
+import sqlite3
+
+import requests
+from flask import Flask, request, render_template_string
+
+app = Flask(__name__)
+
+
+@app.route("/user")
+def user():
+    name = request.args.get("name")
+    conn = sqlite3.connect("app.db")
+    cur = conn.cursor()
+    cur.execute(f"SELECT * FROM users WHERE name = '{name}'")
+    cur.execute("SELECT * FROM users WHERE name = ?", (name,))
+    return "ok"
+
+
+@app.route("/ping")
+def ping():
+    host = request.form["host"]
+    return sp.check_output("ping -c 1 %s" % host, shell=True)
+
+
+@app.route("/hello")
+def hello():
+    template = "<h1>Hello {}</h1>".format(request.args.get("who", ""))
+    return render_template_string(template)
+
+
+class Reports:
+    def __init__(self, base):
+        self.base = base
+
+    def read(self, name):
+        with open(os.path.join(self.base, name)) as f:
+            return f.read()
+
+
+@app.route("/report")
+def report():
+    reports = Reports("/srv/reports")
+    return reports.read(request.args["name"])
+
+
+@app.route("/fetch")
+def fetch():
+    count = int(request.args.get("count", 1))
+    url = request.args.get("url")
+    for _ in range(count):
+        requests.get(url=url, timeout=5)
+
+
+def calc():
+    return eval(input())
@@ -0,0 +1,41 @@
+const express = require('express');
+const { exec } = require('child_process');
+const fs = require('fs');
+const path = require('path');
+const axios = require('axios');
+
+const app = express();
+
+app.get('/users', async (req, res) => {
+  const sql = `SELECT * FROM users WHERE name = '${req.query.name}'`;
+  const rows = await db.query(sql);
+  res.json(rows);
+});
+
+app.get('/safe', async (req, res) => {
+  const id = parseInt(req.query.id, 10);
+  await db.query('SELECT * FROM users WHERE id = ' + id);
+  await db.query('SELECT * FROM users WHERE name = $1', [req.query.name]);
+});
+
+app.post('/ping', (req, res) => {
+  const { host } = req.body;
+  exec('ping -c 1 ' + host, (err, out) => res.send(out));
+});
+
+function readReport(name) {
+  return fs.readFileSync(path.join(__dirname, 'reports', name));
+}
+
+app.get('/report', (req, res) => {
+  res.send(readReport(req.params.name));
+});
+
+app.get('/fetch', async function (req, res) {
+  let target = req.query['url'];
+  if (!target) {
+    target = 'https://example.com';
+  }
+  const r = await axios.get(target);
+  res.send(r.data);
+});
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/cybershield-ai/core/internal/models"
 )
 
 type AWSScanner struct {
@@ -129,20 +130,39 @@ type CloudTrailEvent struct {
 	UserIdentity struct {
 		Arn string `json:"arn"`
 	} `json:"userIdentity"`
-	EventTime time.Time `json:"eventTime"`
+	EventTime       time.Time `json:"eventTime"`
+	SourceIPAddress string    `json:"sourceIPAddress"`
+	AWSRegion       string    `json:"awsRegion"`
 }
 
 func (a *AWSScanner) HandleCloudTrailEvent(event CloudTrailEvent) (string, error) {
-	// Logic to analyze the event
-	// For MVP, we flag specific high-risk events
-
-	if event.EventName == "StopLogging" && event.EventSource == "cloudtrail.amazonaws.com" {
-		return fmt.Sprintf("CRITICAL: CloudTrail logging stopped by %s at %s", event.UserIdentity.Arn, event.EventTime), nil
+	alert := CloudTrailAlert(event)
+	if alert == nil {
+		return "", nil // No alert needed
 	}
+	return alert.Message, nil
+}
 
-	if event.EventName == "AuthorizeSecurityGroupIngress" {
-		return fmt.Sprintf("WARNING: Security Group Ingress modified by %s", event.UserIdentity.Arn), nil
+// CloudTrailAlert returns the alert for a high-risk event, or nil
+func CloudTrailAlert(event CloudTrailEvent) *models.CloudTrailAlert {
+	// For MVP, we flag specific high-risk events
+	alert := &models.CloudTrailAlert{
+		EventTime:   event.EventTime,
+		EventName:   event.EventName,
+		EventSource: event.EventSource,
+		Actor:       event.UserIdentity.Arn,
+		SourceIP:    event.SourceIPAddress,
+		Region:      event.AWSRegion,
 	}
-
-	return "", nil // No alert needed
+	switch {
+	case event.EventName == "StopLogging" && event.EventSource == "cloudtrail.amazonaws.com":
+		alert.Severity = "Critical"
+		alert.Message = fmt.Sprintf("CRITICAL: CloudTrail logging stopped by %s at %s", event.UserIdentity.Arn, event.EventTime)
+	case event.EventName == "AuthorizeSecurityGroupIngress":
+		alert.Severity = "High"
+		alert.Message = fmt.Sprintf("WARNING: Security Group Ingress modified by %s", event.UserIdentity.Arn)
+	default:
+		return nil
+	}
+	return alert
 }
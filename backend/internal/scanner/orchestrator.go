@@ -4,24 +4,51 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/cybershield-ai/core/internal/compliance"
+	"github.com/cybershield-ai/core/internal/events"
+	"github.com/cybershield-ai/core/internal/realtime"
 	"gorm.io/gorm"
 )
 
+// Scans are watched for at most this long after they start
+const maxScanWatch = 2 * time.Hour
+
 // Orchestrator manages multiple scanner instances
 type Orchestrator struct {
-	scanners []Scanner
-	db       *gorm.DB
+	scanners     []Scanner
+	db           *gorm.DB
+	publisher    realtime.Publisher
+	emitter      events.Emitter
+	enricher     Enricher
+	pollInterval time.Duration
 }
 
 func NewOrchestrator(db *gorm.DB, scanners ...Scanner) *Orchestrator {
 	return &Orchestrator{
-		scanners: scanners,
-		db:       db,
+		scanners:     scanners,
+		db:           db,
+		pollInterval: 5 * time.Second,
 	}
 }
 
+// SetPublisher streams the progress of scans started afterwards
+func (o *Orchestrator) SetPublisher(p realtime.Publisher) {
+	o.publisher = p
+}
+
+// SetEmitter emits the findings and completion of scans started
+// afterwards
+func (o *Orchestrator) SetEmitter(e events.Emitter) {
+	o.emitter = e
+}
+
+// SetEnricher enriches findings whenever results are stored
+func (o *Orchestrator) SetEnricher(e Enricher) {
+	o.enricher = e
+}
+
 func (o *Orchestrator) Start(ctx context.Context, target string) (string, error) {
 	var wg sync.WaitGroup
 	scanIDs := make([]string, len(o.scanners))
@@ -60,9 +87,87 @@ func (o *Orchestrator) Start(ctx context.Context, target string) (string, error)
 		return "", fmt.Errorf("failed to create scan record: %v", err)
 	}
 
+	if o.publisher != nil || o.emitter != nil {
+		go o.watch(id, target)
+	}
 	return id, nil
 }
 
+// ScanProgress is published on the scan's topic whenever its status or
+// progress changes
+type ScanProgress struct {
+	ScanID   string `json:"scan_id"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+}
+
+// watch polls a scan until it is no longer running, then emits its
+// findings
+func (o *Orchestrator) watch(scanID, target string) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxScanWatch)
+	defer cancel()
+	topic := realtime.ScanTopic(scanID)
+
+	last := ScanProgress{Progress: -1}
+	for {
+		status, progress, err := o.GetStatus(ctx, scanID)
+		if err == nil {
+			current := ScanProgress{ScanID: scanID, Status: status, Progress: progress}
+			if current != last && o.publisher != nil {
+				o.publisher.Publish(topic, realtime.TypeScanProgress, current)
+				last = current
+			}
+			if status != "running" && status != "queued" {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(o.pollInterval):
+		}
+	}
+
+	if o.emitter == nil {
+		return
+	}
+	results, err := o.GetResults(ctx, scanID)
+	if err != nil {
+		fmt.Printf("Orchestrator: failed to fetch results of scan %s: %v\n", scanID, err)
+		return
+	}
+	completed := events.ScanCompleted{
+		ScanID:     scanID,
+		Target:     target,
+		Status:     results.Status,
+		Findings:   len(results.Vulnerabilities),
+		BySeverity: make(map[string]int),
+	}
+	// GetResults replaces the findings, so they are only emitted here,
+	// together, once the scan is done
+	err = o.db.Transaction(func(tx *gorm.DB) error {
+		for _, v := range results.Vulnerabilities {
+			completed.BySeverity[v.Severity]++
+			err := o.emitter.EmitTx(tx, events.FindingCreated{
+				ScanID:    scanID,
+				Target:    target,
+				FindingID: v.ID,
+				Title:     v.Title,
+				Severity:  v.Severity,
+				Category:  v.Category,
+				Solution:  v.Solution,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return o.emitter.EmitTx(tx, completed)
+	})
+	if err != nil {
+		fmt.Printf("Orchestrator: failed to emit results of scan %s: %v\n", scanID, err)
+	}
+}
+
 func (o *Orchestrator) GetStatus(ctx context.Context, scanID string) (string, int, error) {
 	if len(o.scanners) > 0 {
 		status, progress, err := o.scanners[0].GetStatus(ctx, scanID)
@@ -103,6 +208,9 @@ func (o *Orchestrator) GetResults(ctx context.Context, scanID string) (*ScanResu
 
 		combinedVulns = append(combinedVulns, res.Vulnerabilities...)
 	}
+	if o.enricher != nil {
+		o.enricher.Enrich(ctx, combinedVulns)
+	}
 
 	// Update DB
 	var scan ScanResult
@@ -79,3 +79,29 @@ func TestOrchestrator_GetResults(t *testing.T) {
 		t.Errorf("Expected 2 vulnerabilities, got %d", len(results.Vulnerabilities))
 	}
 }
+
+type priorityEnricher struct{}
+
+func (priorityEnricher) Enrich(ctx context.Context, vulns []Vuln) {
+	for i := range vulns {
+		vulns[i].Priority = 42
+	}
+}
+
+func TestOrchestrator_GetResultsEnriches(t *testing.T) {
+	db := setupTestDB()
+	orch := NewOrchestrator(db, &MockScanner{ID: "scanner1"})
+	orch.SetEnricher(priorityEnricher{})
+	db.Create(&ScanResult{ScanID: "scan-enrich", Target: "localhost", Status: "running"})
+
+	if _, err := orch.GetResults(context.Background(), "scan-enrich"); err != nil {
+		t.Fatalf("GetResults failed: %v", err)
+	}
+	var stored Vuln
+	if err := db.Where("scan_id = ?", "scan-enrich").First(&stored).Error; err != nil {
+		t.Fatalf("finding not stored: %v", err)
+	}
+	if stored.Priority != 42 {
+		t.Errorf("Expected the stored finding to be enriched, got priority %v", stored.Priority)
+	}
+}
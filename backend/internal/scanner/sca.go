@@ -62,8 +62,8 @@ func (s *SCAScanner) runScan(scanID, targetPath string) {
 
 	// 2. Analyze with AI
 	for filename, content := range foundFiles {
-		if s.aiEngine == nil {
-			fmt.Printf("WARNING: AI Engine not initialized. Skipping analysis for %s\n", filename)
+		if s.aiEngine == nil || !s.aiEngine.Available(ai.FeatureDependencies) {
+			fmt.Printf("WARNING: No AI provider configured. Skipping analysis for %s\n", filename)
 			continue
 		}
 
@@ -27,6 +27,36 @@ type Vuln struct {
 	Category    string   `json:"category"` // SCA, SAST, DAST, Container, etc.
 	Solution    string   `json:"solution"`
 	Compliance  []string `json:"compliance" gorm:"serializer:json"` // e.g., "ISO 27001: A.12.6.1"
+	// Location in the scanned repository, for code findings
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// Weakness and data flow of static analysis findings
+	CWE   string      `json:"cwe,omitempty"`
+	Trace []TraceStep `json:"trace,omitempty" gorm:"serializer:json"`
+	// Exploit intelligence, see package intel. Priority (0-100) combines
+	// impact with the likelihood of exploitation.
+	CVEs           []string   `json:"cves,omitempty" gorm:"column:cves;serializer:json"`
+	CVSSVector     string     `json:"cvss_vector,omitempty"`
+	CVSSScore      float64    `json:"cvss_score,omitempty"`
+	EPSS           float64    `json:"epss,omitempty"`
+	EPSSPercentile float64    `json:"epss_percentile,omitempty"`
+	KnownExploited bool       `json:"known_exploited" gorm:"index"`
+	Ransomware     bool       `json:"ransomware,omitempty"` // Known use in ransomware campaigns
+	Priority       float64    `json:"priority" gorm:"index"`
+	EnrichedAt     *time.Time `json:"enriched_at,omitempty" gorm:"index"`
+}
+
+// TraceStep is one hop of the flow of untrusted data to a finding
+type TraceStep struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Code string `json:"code"`
+	Note string `json:"note"`
+}
+
+// Enricher adds exploit intelligence to findings before they are stored
+type Enricher interface {
+	Enrich(ctx context.Context, vulns []Vuln)
 }
 
 // Scanner defines the interface for all security scanners (ZAP, Nuclei, etc.)
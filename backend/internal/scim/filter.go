@@ -0,0 +1,272 @@
+package scim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2)
+type Filter interface {
+	Match(attrs Attributes) bool
+}
+
+// Attributes is a flattened, case-insensitive view of a resource used for
+// filter evaluation, e.g. "username", "name.familyname", "emails.value"
+type Attributes map[string][]string
+
+func (a Attributes) Add(path string, values ...string) {
+	key := strings.ToLower(path)
+	a[key] = append(a[key], values...)
+}
+
+type compareFilter struct {
+	path  string
+	op    string
+	value string
+}
+
+type logicalFilter struct {
+	op          string // and, or
+	left, right Filter
+}
+
+type notFilter struct {
+	inner Filter
+}
+
+func (f compareFilter) Match(attrs Attributes) bool {
+	values, present := attrs[f.path]
+	if f.op == "pr" {
+		return present && len(values) > 0 && values[0] != ""
+	}
+	for _, v := range values {
+		if compare(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f logicalFilter) Match(attrs Attributes) bool {
+	if f.op == "and" {
+		return f.left.Match(attrs) && f.right.Match(attrs)
+	}
+	return f.left.Match(attrs) || f.right.Match(attrs)
+}
+
+func (f notFilter) Match(attrs Attributes) bool {
+	return !f.inner.Match(attrs)
+}
+
+// Strings compare case-insensitively, which matches the caseExact=false
+// attributes we expose; numbers and booleans go through the same path
+func compare(actual, op, expected string) bool {
+	a, e := strings.ToLower(actual), strings.ToLower(expected)
+	switch op {
+	case "eq":
+		return a == e
+	case "ne":
+		return a != e
+	case "co":
+		return strings.Contains(a, e)
+	case "sw":
+		return strings.HasPrefix(a, e)
+	case "ew":
+		return strings.HasSuffix(a, e)
+	case "gt":
+		return a > e
+	case "ge":
+		return a >= e
+	case "lt":
+		return a < e
+	case "le":
+		return a <= e
+	}
+	return false
+}
+
+// ParseFilter parses expressions such as
+//
+//	userName eq "jdoe" and (active eq true or emails.value co "@example.com")
+//	members[value eq "2819c223"]
+func ParseFilter(expr string) (Filter, error) {
+	p := &filterParser{tokens: tokenize(expr)}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q", p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+	prefix string // attribute prefix inside a value path, e.g. "members."
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalFilter{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalFilter{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	switch tok := p.peek(); {
+	case strings.EqualFold(tok, "not"):
+		p.next()
+		if p.peek() != "(" {
+			return nil, fmt.Errorf("expected ( after not")
+		}
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{inner: inner}, nil
+	case tok == "(":
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return f, nil
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+
+	path := p.next()
+	if p.peek() == "[" {
+		// Value path: members[value eq "x"] scopes the inner filter
+		p.next()
+		outer := p.prefix
+		p.prefix = outer + strings.ToLower(path) + "."
+		f, err := p.parseOr()
+		p.prefix = outer
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != "]" {
+			return nil, fmt.Errorf("missing ]")
+		}
+		return f, nil
+	}
+
+	op := strings.ToLower(p.next())
+	attr := p.prefix + strings.ToLower(stripSchemaURN(path))
+	if op == "pr" {
+		return compareFilter{path: attr, op: op}, nil
+	}
+	switch op {
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", op)
+	}
+
+	raw := p.next()
+	if raw == "" {
+		return nil, fmt.Errorf("missing value for %s", path)
+	}
+	value := raw
+	if strings.HasPrefix(raw, `"`) {
+		unquoted, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", raw)
+		}
+		value = unquoted
+	}
+	return compareFilter{path: attr, op: op, value: value}, nil
+}
+
+// stripSchemaURN turns "urn:ietf:params:scim:schemas:core:2.0:User:userName"
+// into "userName"
+func stripSchemaURN(path string) string {
+	if !strings.HasPrefix(strings.ToLower(path), "urn:") {
+		return path
+	}
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+func tokenize(expr string) []string {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '[' || r == ']':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()[]\"", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,46 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	attrs := Attributes{}
+	attrs.Add("userName", "jdoe@example.com")
+	attrs.Add("active", "true")
+	attrs.Add("emails.value", "jdoe@example.com")
+	attrs.Add("members.value", "abc-123")
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "JDoe@example.com"`, true},
+		{`userName eq "someone@example.com"`, false},
+		{`userName sw "jdoe" and active eq true`, true},
+		{`userName sw "x" or emails.value ew "@example.com"`, true},
+		{`not (active eq true)`, false},
+		{`externalId pr`, false},
+		{`(userName co "doe" and active eq false) or userName eq "jdoe@example.com"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "jdoe@example.com"`, true},
+		{`members[value eq "abc-123"]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, f.Match(attrs))
+		})
+	}
+}
+
+func TestParseFilter_Errors(t *testing.T) {
+	for _, expr := range []string{`userName`, `userName xx "a"`, `(userName eq "a"`, `userName eq`} {
+		_, err := ParseFilter(expr)
+		assert.Error(t, err, expr)
+	}
+}
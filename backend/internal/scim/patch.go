@@ -0,0 +1,240 @@
+package scim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cybershield-ai/core/internal/auth"
+)
+
+// applyUserPatch applies PatchOp operations to a user. Identity providers
+// differ in casing and value shapes (Azure sends "Replace" and "False"),
+// so both are normalised here.
+func applyUserPatch(u *auth.User, ops []PatchOperation) error {
+	for _, op := range ops {
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" && kind != "remove" {
+			return fmt.Errorf("unsupported op %q", op.Op)
+		}
+
+		if op.Path == "" {
+			values, ok := op.Value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("value must be an object when path is omitted")
+			}
+			for path, value := range values {
+				if err := setUserAttr(u, kind, path, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := setUserAttr(u, kind, op.Path, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setUserAttr(u *auth.User, kind, path string, value any) error {
+	path = strings.ToLower(stripSchemaURN(path))
+	remove := kind == "remove"
+
+	switch {
+	case path == "active":
+		if remove {
+			return fmt.Errorf("active cannot be removed")
+		}
+		active, err := toBool(value)
+		if err != nil {
+			return err
+		}
+		u.Disabled = !active
+	case path == "username":
+		if remove {
+			return fmt.Errorf("userName cannot be removed")
+		}
+		u.Email = toString(value)
+	case path == "externalid":
+		u.ExternalID = ifNotRemoved(remove, value)
+	case path == "displayname", path == "name.formatted":
+		u.Name = ifNotRemoved(remove, value)
+	case path == "name":
+		if m, ok := value.(map[string]any); ok && !remove {
+			given, family := toString(m["givenName"]), toString(m["familyName"])
+			if f := toString(m["formatted"]); f != "" {
+				u.Name = f
+			} else {
+				u.Name = strings.TrimSpace(given + " " + family)
+			}
+		}
+	case path == "name.givenname", path == "name.familyname":
+		given, family, _ := strings.Cut(u.Name, " ")
+		if path == "name.givenname" {
+			given = ifNotRemoved(remove, value)
+		} else {
+			family = ifNotRemoved(remove, value)
+		}
+		u.Name = strings.TrimSpace(given + " " + family)
+	case strings.HasPrefix(path, "emails"):
+		if remove {
+			return fmt.Errorf("the primary email cannot be removed")
+		}
+		if email := firstEmail(value); email != "" {
+			u.Email = email
+		}
+	default:
+		// Unknown attributes (enterprise extension, phone numbers, ...) are
+		// accepted and ignored so provisioning doesn't stall on them
+	}
+	return nil
+}
+
+// applyGroupPatch applies PatchOp operations to a group and returns the
+// resulting member IDs
+func applyGroupPatch(g *auth.Group, members []string, ops []PatchOperation) ([]string, error) {
+	set := make(map[string]bool)
+	for _, id := range members {
+		set[id] = true
+	}
+
+	for _, op := range ops {
+		kind := strings.ToLower(op.Op)
+		path := strings.ToLower(op.Path)
+
+		switch {
+		case path == "" && kind != "remove":
+			values, ok := op.Value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("value must be an object when path is omitted")
+			}
+			for key, value := range values {
+				switch strings.ToLower(key) {
+				case "displayname":
+					g.DisplayName = toString(value)
+				case "externalid":
+					g.ExternalID = toString(value)
+				case "members":
+					if kind == "replace" {
+						set = make(map[string]bool)
+					}
+					for _, id := range memberIDs(value) {
+						set[id] = true
+					}
+				}
+			}
+		case path == "displayname":
+			if kind == "remove" {
+				return nil, fmt.Errorf("displayName cannot be removed")
+			}
+			g.DisplayName = toString(op.Value)
+		case path == "externalid":
+			g.ExternalID = ifNotRemoved(kind == "remove", op.Value)
+		case path == "members":
+			switch kind {
+			case "add":
+				for _, id := range memberIDs(op.Value) {
+					set[id] = true
+				}
+			case "replace":
+				set = make(map[string]bool)
+				for _, id := range memberIDs(op.Value) {
+					set[id] = true
+				}
+			case "remove":
+				ids := memberIDs(op.Value)
+				if len(ids) == 0 {
+					set = make(map[string]bool)
+				}
+				for _, id := range ids {
+					delete(set, id)
+				}
+			}
+		case strings.HasPrefix(path, "members["):
+			// members[value eq "id"] selects the members to remove
+			if kind != "remove" {
+				return nil, fmt.Errorf("unsupported op %q for %s", op.Op, op.Path)
+			}
+			filter, err := ParseFilter(op.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path: %v", err)
+			}
+			for id := range set {
+				if filter.Match(Attributes{"members.value": {id}}) {
+					delete(set, id)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported path %q", op.Path)
+		}
+	}
+
+	result := make([]string, 0, len(set))
+	for id := range set {
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+func memberIDs(value any) []string {
+	var ids []string
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				if id := toString(m["value"]); id != "" {
+					ids = append(ids, id)
+				}
+			}
+		}
+	case map[string]any:
+		if id := toString(v["value"]); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func firstEmail(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				return toString(m["value"])
+			}
+		}
+	case map[string]any:
+		return toString(v["value"])
+	}
+	return ""
+}
+
+func toBool(value any) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(strings.ToLower(v))
+	}
+	return false, fmt.Errorf("active must be a boolean")
+}
+
+func toString(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func ifNotRemoved(remove bool, value any) string {
+	if remove {
+		return ""
+	}
+	return toString(value)
+}
@@ -0,0 +1,188 @@
+package scim
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/auth"
+)
+
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type UserResource struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *Name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Groups      []MultiValue `json:"groups,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+type GroupResource struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func userToResource(u *auth.User, groups []auth.Group, baseURL string) UserResource {
+	active := !u.Disabled
+	res := UserResource{
+		Schemas:     []string{SchemaUser},
+		ID:          u.ID,
+		ExternalID:  u.ExternalID,
+		UserName:    u.Email,
+		DisplayName: u.Name,
+		Emails:      []MultiValue{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     baseURL + "/Users/" + u.ID,
+		},
+	}
+	if u.Name != "" {
+		given, family, _ := strings.Cut(u.Name, " ")
+		res.Name = &Name{Formatted: u.Name, GivenName: given, FamilyName: family}
+	}
+	for _, g := range groups {
+		res.Groups = append(res.Groups, MultiValue{Value: g.ID, Display: g.DisplayName, Ref: baseURL + "/Groups/" + g.ID})
+	}
+	return res
+}
+
+func groupToResource(g *auth.Group, baseURL string) GroupResource {
+	res := GroupResource{
+		Schemas:     []string{SchemaGroup},
+		ID:          g.ID,
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      g.CreatedAt,
+			LastModified: g.UpdatedAt,
+			Location:     baseURL + "/Groups/" + g.ID,
+		},
+	}
+	for _, m := range g.Members {
+		res.Members = append(res.Members, MultiValue{Value: m.ID, Display: m.Email, Ref: baseURL + "/Users/" + m.ID})
+	}
+	return res
+}
+
+func userAttributes(u *auth.User, groups []auth.Group) Attributes {
+	attrs := Attributes{}
+	attrs.Add("id", u.ID)
+	attrs.Add("externalId", u.ExternalID)
+	attrs.Add("userName", u.Email)
+	attrs.Add("displayName", u.Name)
+	attrs.Add("name.formatted", u.Name)
+	attrs.Add("emails", u.Email)
+	attrs.Add("emails.value", u.Email)
+	attrs.Add("active", strconv.FormatBool(!u.Disabled))
+	attrs.Add("meta.created", u.CreatedAt.UTC().Format(time.RFC3339))
+	attrs.Add("meta.lastModified", u.UpdatedAt.UTC().Format(time.RFC3339))
+	for _, g := range groups {
+		attrs.Add("groups.value", g.ID)
+		attrs.Add("groups.display", g.DisplayName)
+	}
+	return attrs
+}
+
+func groupAttributes(g *auth.Group) Attributes {
+	attrs := Attributes{}
+	attrs.Add("id", g.ID)
+	attrs.Add("externalId", g.ExternalID)
+	attrs.Add("displayName", g.DisplayName)
+	attrs.Add("meta.created", g.CreatedAt.UTC().Format(time.RFC3339))
+	attrs.Add("meta.lastModified", g.UpdatedAt.UTC().Format(time.RFC3339))
+	for _, m := range g.Members {
+		attrs.Add("members.value", m.ID)
+		attrs.Add("members.display", m.Email)
+	}
+	return attrs
+}
+
+// applyUser copies the writable attributes of a SCIM user onto the model
+func applyUser(u *auth.User, res UserResource) {
+	if res.UserName != "" {
+		u.Email = res.UserName
+	} else if len(res.Emails) > 0 {
+		u.Email = res.Emails[0].Value
+	}
+	u.ExternalID = res.ExternalID
+	switch {
+	case res.DisplayName != "":
+		u.Name = res.DisplayName
+	case res.Name != nil && res.Name.Formatted != "":
+		u.Name = res.Name.Formatted
+	case res.Name != nil:
+		u.Name = strings.TrimSpace(res.Name.GivenName + " " + res.Name.FamilyName)
+	}
+	if res.Active != nil {
+		u.Disabled = !*res.Active
+	}
+}
@@ -0,0 +1,420 @@
+package scim
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cybershield-ai/core/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+const maxResults = 200
+
+// Handler serves the SCIM 2.0 Users and Groups endpoints so the identity
+// provider can provision and deprovision accounts
+type Handler struct {
+	users   *auth.UserStore
+	groups  *auth.GroupStore
+	token   string
+	baseURL string
+}
+
+func NewHandler(users *auth.UserStore, groups *auth.GroupStore, token, baseURL string) *Handler {
+	return &Handler{
+		users:   users,
+		groups:  groups,
+		token:   token,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Register mounts the SCIM routes on the given group (typically /scim/v2)
+func (h *Handler) Register(rg *gin.RouterGroup) {
+	rg.Use(h.requireToken())
+
+	rg.GET("/ServiceProviderConfig", h.serviceProviderConfig)
+	rg.GET("/ResourceTypes", h.resourceTypes)
+
+	rg.GET("/Users", h.listUsers)
+	rg.POST("/Users", h.createUser)
+	rg.GET("/Users/:id", h.getUser)
+	rg.PUT("/Users/:id", h.replaceUser)
+	rg.PATCH("/Users/:id", h.patchUser)
+	rg.DELETE("/Users/:id", h.deleteUser)
+
+	rg.GET("/Groups", h.listGroups)
+	rg.POST("/Groups", h.createGroup)
+	rg.GET("/Groups/:id", h.getGroup)
+	rg.PUT("/Groups/:id", h.replaceGroup)
+	rg.PATCH("/Groups/:id", h.patchGroup)
+	rg.DELETE("/Groups/:id", h.deleteGroup)
+}
+
+func (h *Handler) requireToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		presented := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if h.token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(h.token)) != 1 {
+			writeError(c, http.StatusUnauthorized, "", "Invalid or missing bearer token")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (h *Handler) serviceProviderConfig(c *gin.Context) {
+	respond(c, http.StatusOK, gin.H{
+		"schemas":        []string{SchemaSPConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": maxResults},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Static bearer token configured via SCIM_BEARER_TOKEN",
+		}},
+	})
+}
+
+func (h *Handler) resourceTypes(c *gin.Context) {
+	types := []any{
+		gin.H{"schemas": []string{SchemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users", "schema": SchemaUser},
+		gin.H{"schemas": []string{SchemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": SchemaGroup},
+	}
+	respond(c, http.StatusOK, ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(types),
+		StartIndex:   1,
+		ItemsPerPage: len(types),
+		Resources:    types,
+	})
+}
+
+// Users
+
+func (h *Handler) listUsers(c *gin.Context) {
+	filter, ok := parseFilterParam(c)
+	if !ok {
+		return
+	}
+
+	users, err := h.users.List()
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to list users")
+		return
+	}
+
+	memberships, err := h.groups.Memberships()
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to list users")
+		return
+	}
+
+	var matched []any
+	for i := range users {
+		groups := memberships[users[i].ID]
+		if filter != nil && !filter.Match(userAttributes(&users[i], groups)) {
+			continue
+		}
+		matched = append(matched, userToResource(&users[i], groups, h.baseURL))
+	}
+
+	respond(c, http.StatusOK, paginate(c, matched))
+}
+
+func (h *Handler) getUser(c *gin.Context) {
+	user, err := h.users.GetByID(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	h.writeUser(c, http.StatusOK, user)
+}
+
+func (h *Handler) createUser(c *gin.Context) {
+	var res UserResource
+	if err := c.ShouldBindJSON(&res); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	user := &auth.User{}
+	applyUser(user, res)
+	if user.Email == "" {
+		writeError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	if _, err := h.users.GetUserByUsername(user.Email); err == nil {
+		writeError(c, http.StatusConflict, "uniqueness", "User already exists")
+		return
+	}
+
+	// IdP-managed addresses are trusted
+	user.EmailVerified = true
+	if err := h.users.Provision(user); err != nil {
+		writeError(c, http.StatusConflict, "uniqueness", err.Error())
+		return
+	}
+
+	h.writeUser(c, http.StatusCreated, user)
+}
+
+func (h *Handler) replaceUser(c *gin.Context) {
+	user, err := h.users.GetByID(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+
+	var res UserResource
+	if err := c.ShouldBindJSON(&res); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	applyUser(user, res)
+
+	if err := h.users.Update(user); err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to update user")
+		return
+	}
+	h.writeUser(c, http.StatusOK, user)
+}
+
+func (h *Handler) patchUser(c *gin.Context) {
+	user, err := h.users.GetByID(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+
+	var req PatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if err := applyUserPatch(user, req.Operations); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	if err := h.users.Update(user); err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to update user")
+		return
+	}
+	h.writeUser(c, http.StatusOK, user)
+}
+
+func (h *Handler) deleteUser(c *gin.Context) {
+	if _, err := h.users.GetByID(c.Param("id")); err != nil {
+		writeError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	if err := h.users.Delete(c.Param("id")); err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to delete user")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) writeUser(c *gin.Context, status int, user *auth.User) {
+	groups, _ := h.groups.GroupsOf(user.ID)
+	respond(c, status, userToResource(user, groups, h.baseURL))
+}
+
+// Groups
+
+func (h *Handler) listGroups(c *gin.Context) {
+	filter, ok := parseFilterParam(c)
+	if !ok {
+		return
+	}
+
+	groups, err := h.groups.List()
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to list groups")
+		return
+	}
+
+	excludeMembers := strings.Contains(strings.ToLower(c.Query("excludedAttributes")), "members")
+	var matched []any
+	for i := range groups {
+		if filter != nil && !filter.Match(groupAttributes(&groups[i])) {
+			continue
+		}
+		res := groupToResource(&groups[i], h.baseURL)
+		if excludeMembers {
+			res.Members = nil
+		}
+		matched = append(matched, res)
+	}
+
+	respond(c, http.StatusOK, paginate(c, matched))
+}
+
+func (h *Handler) getGroup(c *gin.Context) {
+	group, err := h.groups.Get(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	respond(c, http.StatusOK, groupToResource(group, h.baseURL))
+}
+
+func (h *Handler) createGroup(c *gin.Context) {
+	var res GroupResource
+	if err := c.ShouldBindJSON(&res); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if res.DisplayName == "" {
+		writeError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	group := &auth.Group{DisplayName: res.DisplayName, ExternalID: res.ExternalID}
+	if err := h.groups.Create(group, valuesOf(res.Members)); err != nil {
+		writeError(c, http.StatusConflict, "uniqueness", err.Error())
+		return
+	}
+	respond(c, http.StatusCreated, groupToResource(group, h.baseURL))
+}
+
+func (h *Handler) replaceGroup(c *gin.Context) {
+	group, err := h.groups.Get(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	var res GroupResource
+	if err := c.ShouldBindJSON(&res); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if res.DisplayName != "" {
+		group.DisplayName = res.DisplayName
+	}
+	group.ExternalID = res.ExternalID
+
+	if err := h.groups.Save(group, valuesOf(res.Members)); err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to update group")
+		return
+	}
+	respond(c, http.StatusOK, groupToResource(group, h.baseURL))
+}
+
+func (h *Handler) patchGroup(c *gin.Context) {
+	group, err := h.groups.Get(c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+
+	var req PatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	current := make([]string, 0, len(group.Members))
+	for _, m := range group.Members {
+		current = append(current, m.ID)
+	}
+	members, err := applyGroupPatch(group, current, req.Operations)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "invalidPath", err.Error())
+		return
+	}
+
+	if err := h.groups.Save(group, members); err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to update group")
+		return
+	}
+	respond(c, http.StatusOK, groupToResource(group, h.baseURL))
+}
+
+func (h *Handler) deleteGroup(c *gin.Context) {
+	if _, err := h.groups.Get(c.Param("id")); err != nil {
+		writeError(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	if err := h.groups.Delete(c.Param("id")); err != nil {
+		writeError(c, http.StatusInternalServerError, "", "Failed to delete group")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Helpers
+
+func parseFilterParam(c *gin.Context) (Filter, bool) {
+	expr := c.Query("filter")
+	if expr == "" {
+		return nil, true
+	}
+	filter, err := ParseFilter(expr)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return nil, false
+	}
+	return filter, true
+}
+
+// paginate applies the 1-based startIndex and count query parameters
+func paginate(c *gin.Context, resources []any) ListResponse {
+	start, _ := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if start < 1 {
+		start = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count > maxResults {
+		count = maxResults
+	}
+	if count < 0 {
+		count = 0
+	}
+
+	page := []any{}
+	if start-1 < len(resources) {
+		end := start - 1 + count
+		if end > len(resources) {
+			end = len(resources)
+		}
+		page = resources[start-1 : end]
+	}
+
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+func valuesOf(values []MultiValue) []string {
+	ids := make([]string, 0, len(values))
+	for _, v := range values {
+		ids = append(ids, v.Value)
+	}
+	return ids
+}
+
+func respond(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+func writeError(c *gin.Context, status int, scimType, detail string) {
+	respond(c, status, Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,132 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybershield-ai/core/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupSCIM(t *testing.T) (*gin.Engine, *auth.UserStore) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&auth.User{}, &auth.Group{}))
+
+	users := auth.NewUserStore(db)
+	groups := auth.NewGroupStore(db, auth.ParseRoleMapping("Security Admins=admin"))
+
+	r := gin.New()
+	NewHandler(users, groups, "scim-token", "http://localhost/scim/v2").Register(r.Group("/scim/v2"))
+	return r, users
+}
+
+func scimRequest(r *gin.Engine, method, path string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer scim-token")
+	req.Header.Set("Content-Type", "application/scim+json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSCIM_RequiresToken(t *testing.T) {
+	r, _ := setupSCIM(t)
+
+	req, _ := http.NewRequest("GET", "/scim/v2/Users", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSCIM_UserLifecycle(t *testing.T) {
+	r, users := setupSCIM(t)
+
+	w := scimRequest(r, "POST", "/scim/v2/Users", map[string]any{
+		"schemas":    []string{SchemaUser},
+		"userName":   "leaver@example.com",
+		"externalId": "00u1",
+		"name":       map[string]string{"givenName": "Lee", "familyName": "Ver"},
+		"active":     true,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created UserResource
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "Lee Ver", created.DisplayName)
+
+	w = scimRequest(r, "GET", `/scim/v2/Users?filter=userName+eq+"leaver@example.com"`, nil)
+	var list ListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.TotalResults)
+
+	issuedAt := time.Now().Add(-time.Minute)
+	require.NoError(t, users.ValidateSession(created.ID, issuedAt))
+
+	// Azure AD style deactivation
+	w = scimRequest(r, "PATCH", "/scim/v2/Users/"+created.ID, map[string]any{
+		"schemas":    []string{SchemaPatchOp},
+		"Operations": []map[string]any{{"op": "Replace", "path": "active", "value": "False"}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.ErrorIs(t, users.ValidateSession(created.ID, time.Now()), auth.ErrSessionRevoked)
+}
+
+func TestSCIM_GroupRoleMapping(t *testing.T) {
+	r, users := setupSCIM(t)
+
+	w := scimRequest(r, "POST", "/scim/v2/Users", map[string]any{"userName": "admin@example.com"})
+	var user UserResource
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+
+	w = scimRequest(r, "POST", "/scim/v2/Groups", map[string]any{"displayName": "Security Admins"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var group GroupResource
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &group))
+
+	w = scimRequest(r, "PATCH", "/scim/v2/Groups/"+group.ID, map[string]any{
+		"Operations": []map[string]any{{"op": "add", "path": "members", "value": []map[string]string{{"value": user.ID}}}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	u, _ := users.GetByID(user.ID)
+	assert.Equal(t, "admin", u.Role)
+
+	w = scimRequest(r, "GET", `/scim/v2/Users?filter=groups.display eq "Security Admins"`, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list struct {
+		TotalResults int            `json:"totalResults"`
+		Resources    []UserResource `json:"Resources"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Equal(t, 1, list.TotalResults)
+	require.Len(t, list.Resources[0].Groups, 1)
+	assert.Equal(t, group.ID, list.Resources[0].Groups[0].Value)
+
+	w = scimRequest(r, "PATCH", "/scim/v2/Groups/"+group.ID, map[string]any{
+		"Operations": []map[string]any{{"op": "remove", "path": `members[value eq "` + user.ID + `"]`}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	u, _ = users.GetByID(user.ID)
+	assert.Equal(t, "user", u.Role)
+}
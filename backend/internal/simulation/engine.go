@@ -5,18 +5,26 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/cybershield-ai/core/internal/events"
 	"github.com/cybershield-ai/core/internal/models"
 	"gorm.io/gorm"
 )
 
 type SimulationEngine struct {
-	db *gorm.DB
+	db      *gorm.DB
+	emitter events.Emitter
 }
 
 func NewSimulationEngine(db *gorm.DB) *SimulationEngine {
 	return &SimulationEngine{db: db}
 }
 
+// SetEmitter emits generated events as simulated detections; call before
+// Start
+func (s *SimulationEngine) SetEmitter(e events.Emitter) {
+	s.emitter = e
+}
+
 func (s *SimulationEngine) Start() {
 	go func() {
 		for {
@@ -46,7 +54,25 @@ func (s *SimulationEngine) generateRandomEvent() {
 		Timestamp: time.Now(),
 	}
 
-	if err := s.db.Create(&event).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+		if s.emitter == nil {
+			return nil
+		}
+		return s.emitter.EmitTx(tx, events.DetectionRaised{
+			Engine:    event.Engine,
+			Kind:      event.EventType,
+			Severity:  event.Severity,
+			Source:    event.Source,
+			Target:    event.Target,
+			Details:   event.Details,
+			RecordID:  event.ID,
+			Simulated: true,
+		})
+	})
+	if err != nil {
 		fmt.Printf("Failed to create simulation event: %v\n", err)
 	} else {
 		fmt.Printf("Generated Simulation Event: %s [%s]\n", event.EventType, event.Severity)
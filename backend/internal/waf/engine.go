@@ -0,0 +1,390 @@
+package waf
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//go:embed rules/*.conf
+var defaultRules embed.FS
+
+// Config controls rule loading and scoring
+type Config struct {
+	// RulesDir holds *.conf rule files. When empty the embedded default
+	// ruleset is used and hot reload is disabled.
+	RulesDir string
+	// Paranoia enables rules up to and including this level (1-4)
+	Paranoia int
+	// Threshold is the inbound anomaly score at which a request is blocked
+	Threshold int
+}
+
+func DefaultConfig() Config {
+	return Config{Paranoia: 1, Threshold: 5}
+}
+
+// Match records a single rule hit
+type Match struct {
+	RuleID   string   `json:"rule_id"`
+	Msg      string   `json:"msg"`
+	Severity string   `json:"severity"`
+	Score    int      `json:"score"`
+	Target   string   `json:"target"`
+	Value    string   `json:"value"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// Actions recorded on a Result
+const (
+	ActionOff    = "off"
+	ActionAllow  = "allow"
+	ActionDetect = "detect"
+	ActionBlock  = "block"
+)
+
+// Result is the outcome of evaluating a request
+type Result struct {
+	Score      int
+	Matches    []Match
+	Excluded   []string // IDs of rules that matched but were excluded
+	Anomalous  bool     // Score reached the threshold
+	Blocked    bool     // Anomalous and the effective mode is block
+	AttackType string
+	Mode       Mode
+	Action     string
+}
+
+// RuleIDs lists the matched rule IDs in evaluation order
+func (r *Result) RuleIDs() []string {
+	ids := make([]string, 0, len(r.Matches))
+	for _, m := range r.Matches {
+		ids = append(ids, m.RuleID)
+	}
+	return ids
+}
+
+type ruleSet struct {
+	rules    []*Rule
+	stamp    string
+	loadedAt time.Time
+}
+
+// Engine evaluates requests against the active ruleset. The ruleset is
+// swapped atomically on reload so evaluation never takes a lock.
+type Engine struct {
+	cfg   Config
+	rules atomic.Pointer[ruleSet]
+	stats *statsCollector
+}
+
+func NewEngine(cfg Config) (*Engine, error) {
+	if cfg.Paranoia < 1 {
+		cfg.Paranoia = 1
+	}
+	if cfg.Threshold < 1 {
+		cfg.Threshold = DefaultConfig().Threshold
+	}
+	e := &Engine{cfg: cfg, stats: newStatsCollector()}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) Config() Config {
+	return e.cfg
+}
+
+// Rules returns the active rules, including those above the paranoia level
+func (e *Engine) Rules() []*Rule {
+	return e.rules.Load().rules
+}
+
+// Reload parses the rule files again. On error the previous ruleset stays
+// active.
+func (e *Engine) Reload() error {
+	var fsys fs.FS = defaultRules
+	dir := "rules"
+	if e.cfg.RulesDir != "" {
+		fsys = os.DirFS(e.cfg.RulesDir)
+		dir = "."
+	}
+
+	stamp, err := dirStamp(fsys, dir)
+	if err != nil {
+		return err
+	}
+	rules, err := loadRules(fsys, dir)
+	if err != nil {
+		return err
+	}
+	e.rules.Store(&ruleSet{rules: rules, stamp: stamp, loadedAt: time.Now()})
+	return nil
+}
+
+// Watch polls the rules directory and reloads when a file is added,
+// removed or modified, until the returned stop func is called. It is a
+// no-op for the embedded ruleset.
+func (e *Engine) Watch(interval time.Duration) (stop func()) {
+	if e.cfg.RulesDir == "" {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			stamp, err := dirStamp(os.DirFS(e.cfg.RulesDir), ".")
+			if err != nil || stamp == e.rules.Load().stamp {
+				continue
+			}
+			if err := e.Reload(); err != nil {
+				slog.Warn("WAF: keeping previous rules, reload failed", "error", err)
+				continue
+			}
+			slog.Info("WAF: reloaded rules", "count", len(e.Rules()), "dir", e.cfg.RulesDir)
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func loadRules(fsys fs.FS, dir string) ([]*Rule, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var rules []*Rule
+	seen := make(map[string]string)
+	for _, name := range files {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := ParseRules(f, name)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range parsed {
+			if prev, dup := seen[r.ID]; dup {
+				return nil, fmt.Errorf("%s: duplicate rule id %s (first defined in %s)", name, r.ID, prev)
+			}
+			seen[r.ID] = name
+		}
+		rules = append(rules, parsed...)
+	}
+	return rules, nil
+}
+
+// dirStamp summarises names, sizes and mtimes so changes can be detected
+// without reading the files
+func dirStamp(fsys fs.FS, dir string) (string, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.conf"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	var b strings.Builder
+	for _, name := range files {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+// Evaluate runs every enabled rule against the request and sums the
+// anomaly score. Each rule contributes at most once per request. The result
+// is blocking whenever the threshold is reached; use Inspect to apply
+// modes and exclusions.
+func (e *Engine) Evaluate(req *Request) *Result {
+	return e.evaluate(req, nil)
+}
+
+// Inspect evaluates the request under policy: the mode for the request
+// path decides the action and matching exclusions suppress rules. Results
+// are counted in Stats and the WAF Prometheus metrics.
+func (e *Engine) Inspect(req *Request, policy *Policy) *Result {
+	mode := policy.ModeFor(req.Path)
+
+	var res *Result
+	if mode == ModeOff {
+		res = &Result{AttackType: "None", Action: ActionOff}
+	} else {
+		res = e.evaluate(req, policy.exclusionsFor(req.Path, req.Role))
+	}
+	res.Mode = mode
+
+	switch {
+	case mode == ModeOff:
+	case !res.Anomalous:
+		res.Action = ActionAllow
+	case mode == ModeDetect:
+		res.Action = ActionDetect
+	default:
+		res.Action = ActionBlock
+	}
+	res.Blocked = res.Action == ActionBlock
+
+	e.stats.record(res)
+	return res
+}
+
+// Stats returns rule hit counts since startup
+func (e *Engine) Stats() Stats {
+	return e.stats.snapshot(e.Rules())
+}
+
+func (e *Engine) evaluate(req *Request, exclusions []Exclusion) *Result {
+	res := &Result{Mode: ModeBlock}
+	cache := make(map[string]string)
+
+	for _, rule := range e.rules.Load().rules {
+		if rule.Paranoia > e.cfg.Paranoia {
+			continue
+		}
+
+		var params []*Exclusion
+		skip := false
+		for i := range exclusions {
+			x := &exclusions[i]
+			if x.RuleID != "" && x.RuleID != rule.ID {
+				continue
+			}
+			if x.Parameter == "" {
+				skip = true
+				break
+			}
+			params = append(params, x)
+		}
+
+		m, ok := evaluateRule(rule, req, cache, params)
+		if !ok {
+			continue
+		}
+		if skip {
+			res.Excluded = append(res.Excluded, rule.ID)
+			continue
+		}
+		res.Matches = append(res.Matches, m)
+		res.Score += rule.Score
+	}
+
+	res.Anomalous = res.Score >= e.cfg.Threshold
+	res.Blocked = res.Anomalous
+	res.AttackType = attackType(res.Matches)
+	return res
+}
+
+func evaluateRule(rule *Rule, req *Request, cache map[string]string, params []*Exclusion) (Match, bool) {
+	chain := strings.Join(rule.Transforms, ",")
+
+	for _, v := range req.Vars {
+		if !selected(rule, v) || excludedVar(params, v) {
+			continue
+		}
+
+		key := chain + "\x00" + v.Value
+		value, ok := cache[key]
+		if !ok {
+			value = applyTransforms(v.Value, rule.Transforms)
+			cache[key] = value
+		}
+
+		if rule.Operator.Match(value) {
+			target := Target{Collection: v.Collection, Key: v.Key}
+			return Match{
+				RuleID:   rule.ID,
+				Msg:      rule.Msg,
+				Severity: rule.Severity,
+				Score:    rule.Score,
+				Target:   target.String(),
+				Value:    truncate(v.Value, 128),
+				Tags:     rule.Tags,
+			}, true
+		}
+	}
+	return Match{}, false
+}
+
+func excludedVar(params []*Exclusion, v Variable) bool {
+	for _, x := range params {
+		if x.excludesVar(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func selected(rule *Rule, v Variable) bool {
+	for _, ex := range rule.Exclusions {
+		if ex.Collection == v.Collection && matchesKey(ex, v.Key) {
+			return false
+		}
+	}
+	for _, t := range rule.Targets {
+		if t.Collection == v.Collection && matchesKey(t, v.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+var attackTags = []struct {
+	tag, name string
+}{
+	{"attack-sqli", "SQL Injection"},
+	{"attack-xss", "XSS"},
+	{"attack-rce", "Remote Code Execution"},
+	{"attack-lfi", "Path Traversal"},
+	{"attack-rfi", "Remote File Inclusion"},
+	{"attack-injection-java", "Java Injection"},
+	{"attack-protocol", "Protocol Violation"},
+	{"attack-reputation-scanner", "Scanner"},
+}
+
+// attackType names the attack from the highest scoring match's tags
+func attackType(matches []Match) string {
+	best := -1
+	name := "None"
+	for _, m := range matches {
+		if m.Score <= best {
+			continue
+		}
+		for _, at := range attackTags {
+			for _, tag := range m.Tags {
+				if tag == at.tag {
+					best, name = m.Score, at.name
+				}
+			}
+		}
+	}
+	return name
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
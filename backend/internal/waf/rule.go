@@ -0,0 +1,343 @@
+package waf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity scores follow the CRS anomaly scoring defaults
+var severityScores = map[string]int{
+	"CRITICAL": 5,
+	"ERROR":    4,
+	"WARNING":  3,
+	"NOTICE":   2,
+}
+
+// Rule is a single precompiled SecRule
+type Rule struct {
+	ID         string
+	Msg        string
+	Severity   string
+	Score      int
+	Paranoia   int
+	Tags       []string
+	Targets    []Target
+	Exclusions []Target // "!ARGS:password" style exclusions
+	Transforms []string
+	Operator   Operator
+}
+
+// Target selects a collection and optionally a single key inside it,
+// e.g. ARGS, ARGS:username, REQUEST_HEADERS:User-Agent, JSON:user.name
+type Target struct {
+	Collection string
+	Key        string
+}
+
+func (t Target) String() string {
+	if t.Key == "" {
+		return t.Collection
+	}
+	return t.Collection + ":" + t.Key
+}
+
+// Operator is a compiled "@op argument" expression
+type Operator struct {
+	Name    string
+	Arg     string
+	Negated bool
+	re      *regexp.Regexp
+	phrases []string
+}
+
+func (o *Operator) Match(value string) bool {
+	var matched bool
+	switch o.Name {
+	case "rx":
+		matched = o.re.MatchString(value)
+	case "pm":
+		lower := strings.ToLower(value)
+		for _, p := range o.phrases {
+			if strings.Contains(lower, p) {
+				matched = true
+				break
+			}
+		}
+	case "contains":
+		matched = strings.Contains(value, o.Arg)
+	case "streq":
+		matched = value == o.Arg
+	case "beginsWith":
+		matched = strings.HasPrefix(value, o.Arg)
+	case "endsWith":
+		matched = strings.HasSuffix(value, o.Arg)
+	}
+	return matched != o.Negated
+}
+
+var collections = map[string]bool{
+	"ARGS":             true,
+	"ARGS_NAMES":       true,
+	"REQUEST_HEADERS":  true,
+	"REQUEST_COOKIES":  true,
+	"REQUEST_BODY":     true,
+	"REQUEST_URI":      true,
+	"REQUEST_FILENAME": true,
+	"JSON":             true,
+}
+
+// ParseRules reads SecRule directives. Lines ending in a backslash are
+// joined, "#" starts a comment.
+//
+//	SecRule ARGS|JSON:user.name "@rx (?i)union\s+select" \
+//	    "id:942100,severity:CRITICAL,paranoia:1,t:urlDecode,t:lowercase,tag:attack-sqli,msg:'SQL Injection'"
+func ParseRules(r io.Reader, source string) ([]*Rule, error) {
+	var rules []*Rule
+	var pending strings.Builder
+	lineNo, startLine := 0, 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if pending.Len() == 0 {
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			startLine = lineNo
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			pending.WriteString(strings.TrimSuffix(line, "\\"))
+			pending.WriteString(" ")
+			continue
+		}
+		pending.WriteString(line)
+
+		rule, err := parseDirective(pending.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, startLine, err)
+		}
+		rules = append(rules, rule)
+		pending.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if pending.Len() > 0 {
+		return nil, fmt.Errorf("%s:%d: unterminated directive", source, startLine)
+	}
+	return rules, nil
+}
+
+func parseDirective(line string) (*Rule, error) {
+	fields, err := splitDirective(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 4 || fields[0] != "SecRule" {
+		return nil, fmt.Errorf("expected: SecRule TARGETS \"@op arg\" \"actions\"")
+	}
+
+	rule := &Rule{Paranoia: 1, Severity: "WARNING"}
+
+	if err := parseTargets(rule, fields[1]); err != nil {
+		return nil, err
+	}
+	if err := parseOperator(&rule.Operator, fields[2]); err != nil {
+		return nil, err
+	}
+	if err := parseActions(rule, fields[3]); err != nil {
+		return nil, err
+	}
+
+	if rule.ID == "" {
+		return nil, fmt.Errorf("rule is missing an id")
+	}
+	if rule.Score == 0 {
+		rule.Score = severityScores[rule.Severity]
+	}
+	return rule, nil
+}
+
+func parseTargets(rule *Rule, spec string) error {
+	for _, part := range strings.Split(spec, "|") {
+		part = strings.TrimSpace(part)
+		exclude := strings.HasPrefix(part, "!")
+		part = strings.TrimPrefix(part, "!")
+
+		collection, key, _ := strings.Cut(part, ":")
+		collection = strings.ToUpper(collection)
+		if !collections[collection] {
+			return fmt.Errorf("unknown target %q", collection)
+		}
+		if collection == "REQUEST_HEADERS" {
+			key = strings.ToLower(key)
+		}
+
+		t := Target{Collection: collection, Key: key}
+		if exclude {
+			rule.Exclusions = append(rule.Exclusions, t)
+		} else {
+			rule.Targets = append(rule.Targets, t)
+		}
+	}
+	if len(rule.Targets) == 0 {
+		return fmt.Errorf("rule has no targets")
+	}
+	return nil
+}
+
+func parseOperator(op *Operator, spec string) error {
+	if strings.HasPrefix(spec, "!") {
+		op.Negated = true
+		spec = spec[1:]
+	}
+	if !strings.HasPrefix(spec, "@") {
+		// Bare pattern defaults to @rx, as in ModSecurity
+		spec = "@rx " + spec
+	}
+	name, arg, _ := strings.Cut(spec[1:], " ")
+	op.Name = name
+	op.Arg = arg
+
+	switch name {
+	case "rx":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		op.re = re
+	case "pm":
+		for _, p := range strings.Fields(arg) {
+			op.phrases = append(op.phrases, strings.ToLower(p))
+		}
+	case "contains", "streq", "beginsWith", "endsWith":
+	default:
+		return fmt.Errorf("unsupported operator @%s", name)
+	}
+	return nil
+}
+
+func parseActions(rule *Rule, spec string) error {
+	for _, action := range splitActions(spec) {
+		name, value, _ := strings.Cut(action, ":")
+		name = strings.TrimSpace(name)
+		value = strings.Trim(strings.TrimSpace(value), "'")
+
+		switch name {
+		case "id":
+			rule.ID = value
+		case "msg":
+			rule.Msg = value
+		case "severity":
+			sev := strings.ToUpper(value)
+			if _, ok := severityScores[sev]; !ok {
+				return fmt.Errorf("unknown severity %q", value)
+			}
+			rule.Severity = sev
+		case "score":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid score %q", value)
+			}
+			rule.Score = n
+		case "paranoia":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 4 {
+				return fmt.Errorf("paranoia must be 1-4")
+			}
+			rule.Paranoia = n
+		case "tag":
+			rule.Tags = append(rule.Tags, value)
+			// CRS marks paranoia with a tag rather than an action
+			if lvl, ok := strings.CutPrefix(value, "paranoia-level/"); ok {
+				if n, err := strconv.Atoi(lvl); err == nil {
+					rule.Paranoia = n
+				}
+			}
+		case "t":
+			if value == "none" {
+				rule.Transforms = nil
+				continue
+			}
+			if _, ok := transforms[value]; !ok {
+				return fmt.Errorf("unknown transform %q", value)
+			}
+			rule.Transforms = append(rule.Transforms, value)
+		case "phase", "block", "deny", "pass", "log", "nolog", "capture", "rev", "ver", "accuracy", "maturity":
+			// Accepted for CRS compatibility; disruptive behaviour comes from
+			// anomaly scoring instead
+		default:
+			return fmt.Errorf("unsupported action %q", name)
+		}
+	}
+	return nil
+}
+
+// splitDirective splits on whitespace while keeping double-quoted strings
+// (with backslash escapes for quotes) together
+func splitDirective(line string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	inQuote := false
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case inQuote && ch == '\\' && i+1 < len(line) && line[i+1] == '"':
+			cur.WriteByte('"')
+			i++
+		case ch == '"':
+			if inQuote {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+			inQuote = !inQuote
+		case !inQuote && (ch == ' ' || ch == '\t'):
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteByte(ch)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
+
+// splitActions splits "a:1,msg:'x, y',t:lowercase" on commas outside quotes
+func splitActions(spec string) []string {
+	var actions []string
+	var cur strings.Builder
+	inQuote := false
+	for _, ch := range spec {
+		switch {
+		case ch == '\'':
+			inQuote = !inQuote
+			cur.WriteRune(ch)
+		case ch == ',' && !inQuote:
+			if s := strings.TrimSpace(cur.String()); s != "" {
+				actions = append(actions, s)
+			}
+			cur.Reset()
+		default:
+			cur.WriteRune(ch)
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		actions = append(actions, s)
+	}
+	return actions
+}
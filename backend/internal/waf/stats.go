@@ -0,0 +1,117 @@
+package waf
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	wafRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "waf_requests_total",
+			Help: "Requests inspected by the WAF by mode and action taken",
+		},
+		[]string{"mode", "action"},
+	)
+
+	wafRuleHitsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "waf_rule_hits_total",
+			Help: "WAF rule matches by rule ID and mode",
+		},
+		[]string{"rule_id", "mode"},
+	)
+
+	wafExcludedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "waf_rule_exclusions_total",
+			Help: "WAF rule matches suppressed by an exclusion",
+		},
+		[]string{"rule_id"},
+	)
+)
+
+// RuleStat is the hit count of a single rule since startup
+type RuleStat struct {
+	RuleID   string  `json:"rule_id"`
+	Msg      string  `json:"msg"`
+	Hits     uint64  `json:"hits"`
+	Excluded uint64  `json:"excluded"`
+	HitRate  float64 `json:"hit_rate"` // hits per inspected request
+}
+
+// Stats summarises WAF activity since startup
+type Stats struct {
+	Inspected uint64            `json:"inspected"`
+	Actions   map[string]uint64 `json:"actions"`
+	Rules     []RuleStat        `json:"rules"`
+}
+
+type statsCollector struct {
+	mu        sync.Mutex
+	inspected uint64
+	actions   map[string]uint64
+	hits      map[string]uint64
+	excluded  map[string]uint64
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		actions:  make(map[string]uint64),
+		hits:     make(map[string]uint64),
+		excluded: make(map[string]uint64),
+	}
+}
+
+func (s *statsCollector) record(res *Result) {
+	mode := string(res.Mode)
+	wafRequestsTotal.WithLabelValues(mode, res.Action).Inc()
+	for _, m := range res.Matches {
+		wafRuleHitsTotal.WithLabelValues(m.RuleID, mode).Inc()
+	}
+	for _, id := range res.Excluded {
+		wafExcludedTotal.WithLabelValues(id).Inc()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions[res.Action]++
+	if res.Mode == ModeOff {
+		return
+	}
+	s.inspected++
+	for _, m := range res.Matches {
+		s.hits[m.RuleID]++
+	}
+	for _, id := range res.Excluded {
+		s.excluded[id]++
+	}
+}
+
+func (s *statsCollector) snapshot(rules []*Rule) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := Stats{Inspected: s.inspected, Actions: make(map[string]uint64)}
+	for action, n := range s.actions {
+		stats.Actions[action] = n
+	}
+	for _, r := range rules {
+		hits, excluded := s.hits[r.ID], s.excluded[r.ID]
+		if hits == 0 && excluded == 0 {
+			continue
+		}
+		rs := RuleStat{RuleID: r.ID, Msg: r.Msg, Hits: hits, Excluded: excluded}
+		if s.inspected > 0 {
+			rs.HitRate = float64(hits) / float64(s.inspected)
+		}
+		stats.Rules = append(stats.Rules, rs)
+	}
+	sort.Slice(stats.Rules, func(i, j int) bool {
+		return stats.Rules[i].Hits > stats.Rules[j].Hits
+	})
+	return stats
+}
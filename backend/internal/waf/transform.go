@@ -0,0 +1,86 @@
+package waf
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	sqlCommentRe    = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	whitespaceRunRe = regexp.MustCompile(`\s+`)
+)
+
+// transforms normalise a value before the operator runs so encoded
+// payloads can't slip past a pattern
+var transforms = map[string]func(string) string{
+	"urlDecode":        urlDecode,
+	"urlDecodeUni":     urlDecode,
+	"htmlEntityDecode": html.UnescapeString,
+	"lowercase":        strings.ToLower,
+	"removeNulls": func(s string) string {
+		return strings.ReplaceAll(s, "\x00", "")
+	},
+	"removeWhitespace": func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, s)
+	},
+	"compressWhitespace": func(s string) string {
+		return whitespaceRunRe.ReplaceAllString(s, " ")
+	},
+	"replaceComments": func(s string) string {
+		return sqlCommentRe.ReplaceAllString(s, " ")
+	},
+}
+
+// urlDecode is lenient: invalid escapes are left as they are instead of
+// failing the whole value
+func urlDecode(s string) string {
+	if !strings.ContainsAny(s, "%+") {
+		return s
+	}
+	if decoded, err := url.QueryUnescape(s); err == nil {
+		return decoded
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '+':
+			b.WriteByte(' ')
+		case s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func applyTransforms(value string, names []string) string {
+	for _, name := range names {
+		value = transforms[name](value)
+	}
+	return value
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -11,6 +13,8 @@ import (
 
 	"github.com/cybershield-ai/core/internal/api"
 	"github.com/cybershield-ai/core/internal/cache"
+	"github.com/cybershield-ai/core/internal/database"
+	"github.com/cybershield-ai/core/internal/redact"
 	"github.com/cybershield-ai/core/internal/secrets"
 )
 
@@ -19,6 +23,10 @@ func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
+	if len(os.Args) > 1 && os.Args[1] == "scrub-logs" {
+		os.Exit(scrubLogs(os.Args[2:]))
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -69,3 +77,36 @@ func main() {
 
 	slog.Info("Server exiting")
 }
+
+// scrubLogs redacts security logs stored before redaction was enabled,
+// using the same REDACT_* settings as the server
+func scrubLogs(args []string) int {
+	fs := flag.NewFlagSet("scrub-logs", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "count the logs that would change without updating them")
+	fs.Parse(args)
+
+	db, err := database.InitDB()
+	if err != nil {
+		slog.Error("Failed to open database", "error", err)
+		return 1
+	}
+	redactor, err := redact.FromEnv()
+	if err != nil {
+		slog.Error("Invalid redaction config", "error", err)
+		return 1
+	}
+	store := database.NewMonitorStore(db)
+	store.SetRedactor(redactor)
+
+	result, err := store.ScrubSecurityLogs(*dryRun)
+	if err != nil {
+		slog.Error("Failed to scrub security logs", "error", err)
+		return 1
+	}
+	verb := "updated"
+	if *dryRun {
+		verb = "would update"
+	}
+	fmt.Printf("scanned %d security logs, %s %d\n", result.Scanned, verb, result.Updated)
+	return 0
+}
@@ -20,6 +20,8 @@ func TestAnalystWorkflow(t *testing.T) {
 	dbName := fmt.Sprintf("e2e_test_%d.db", time.Now().UnixNano())
 	os.Setenv("DB_DRIVER", "sqlite")
 	os.Setenv("DB_NAME", dbName)
+	// Deterministic answers without calling a model
+	os.Setenv("AI_PROVIDER", "mock")
 
 	// Clean up
 	defer os.Remove(dbName)
@@ -128,14 +130,8 @@ func TestAnalystWorkflow(t *testing.T) {
 			"tech_stack":  "Go, Gorm",
 		}
 		w := makeRequest("POST", "/api/v1/remediate/fix", authToken, payload)
-		// This might fail if API key is missing (which it is in test env),
-		// but we should handle it gracefully (500 or error message).
-		// In server.go, we log error and return 500 if AI fails.
-		// So 500 is expected here without a mock AI engine.
-		// However, we want to verify the flow.
-		// Ideally we mock the AI engine.
-		// For now, let's accept 500 or 200.
-		assert.True(t, w.Code == http.StatusOK || w.Code == http.StatusInternalServerError)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "mock response")
 	})
 
 	// 8. Schedule Scan